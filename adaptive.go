@@ -0,0 +1,230 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Default adaptive concurrency settings.
+var (
+	DefaultAdaptiveMinLimit      = 1
+	DefaultAdaptiveLatencyTarget = 500 * time.Millisecond
+	DefaultAdaptiveBackoffRatio  = 0.7
+)
+
+// An AdaptiveLimiter limits the number of concurrent requests to a backend,
+// adjusting the limit by the observed latency and errors (AIMD). Every request
+// completing within LatencyTarget while the limit is in use increases the
+// limit additively by about one per limit requests. A request taking longer
+// or failing with a busy error decreases the limit multiplicatively by
+// BackoffRatio, at most once per LatencyTarget so concurrent requests
+// observing the same overload do not collapse the limit. Waiting requests are
+// served by the Priority of their context.
+type AdaptiveLimiter struct {
+	MinLimit      int
+	MaxLimit      int
+	LatencyTarget time.Duration
+	BackoffRatio  float64
+
+	mutex        sync.Mutex
+	limit        float64
+	inFlight     int
+	queue        priorityQueue
+	lastDecrease time.Time
+}
+
+// NewAdaptiveLimiter creates a new AdaptiveLimiter allowing up to maxLimit
+// concurrent requests which are expected to complete within latencyTarget.
+// The limit starts at maxLimit.
+func NewAdaptiveLimiter(maxLimit int, latencyTarget time.Duration) *AdaptiveLimiter {
+	l := &AdaptiveLimiter{
+		MinLimit:     DefaultAdaptiveMinLimit,
+		BackoffRatio: DefaultAdaptiveBackoffRatio,
+	}
+	l.SetLimit(maxLimit, latencyTarget)
+	l.limit = float64(l.MaxLimit)
+
+	return l
+}
+
+// SetLimit changes the maximum concurrency limit and the latency target of
+// the accociated AdaptiveLimiter. A latencyTarget of 0 selects the default.
+func (l *AdaptiveLimiter) SetLimit(maxLimit int, latencyTarget time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if maxLimit < l.MinLimit {
+		maxLimit = l.MinLimit
+	}
+	if latencyTarget <= 0 {
+		latencyTarget = DefaultAdaptiveLatencyTarget
+	}
+	l.MaxLimit = maxLimit
+	l.LatencyTarget = latencyTarget
+	if l.limit > float64(maxLimit) {
+		l.limit = float64(maxLimit)
+	}
+	l.dispatch()
+}
+
+// Limit returns the current concurrency limit of the accociated
+// AdaptiveLimiter.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return int(l.limit)
+}
+
+// InFlight returns the number of requests currently allowed by the accociated
+// AdaptiveLimiter.
+func (l *AdaptiveLimiter) InFlight() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.inFlight
+}
+
+// acquire blocks until the accociated AdaptiveLimiter allows another request
+// with the Priority of the provided context or the provided context is done.
+func (l *AdaptiveLimiter) acquire(ctx context.Context) error {
+	p := PriorityFromContext(ctx)
+
+	l.mutex.Lock()
+	if l.inFlight < int(l.limit) && !l.queue.waiting(p) {
+		l.inFlight++
+		l.mutex.Unlock()
+		return nil
+	}
+	w := l.queue.push(p)
+	l.mutex.Unlock()
+
+	beginBackendWait()
+	select {
+	case <-w.ready:
+		endBackendWait(ctx, nil)
+		return nil
+	case <-ctx.Done():
+		l.mutex.Lock()
+		if !l.queue.remove(w) {
+			// Was granted meanwhile, give it back.
+			l.inFlight--
+			l.dispatch()
+		}
+		l.mutex.Unlock()
+		endBackendWait(ctx, ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// release returns a request allowed with acquire. If sample is true, the
+// provided latency and overload state are used to adjust the limit.
+func (l *AdaptiveLimiter) release(sample bool, latency time.Duration, overloaded bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	atLimit := l.inFlight >= int(l.limit)
+	l.inFlight--
+
+	if sample {
+		if overloaded || latency > l.LatencyTarget {
+			now := time.Now()
+			if now.Sub(l.lastDecrease) >= l.LatencyTarget {
+				l.limit *= l.BackoffRatio
+				l.lastDecrease = now
+			}
+		} else if atLimit {
+			// Only grow when the limit is in use, so it does not drift up
+			// while idle.
+			l.limit += 1 / l.limit
+		}
+		if l.limit < float64(l.MinLimit) {
+			l.limit = float64(l.MinLimit)
+		}
+		if l.limit > float64(l.MaxLimit) {
+			l.limit = float64(l.MaxLimit)
+		}
+	}
+
+	l.dispatch()
+}
+
+// dispatch grants waiting requests by priority while below the limit. It
+// must be called with the accociated mutex held.
+func (l *AdaptiveLimiter) dispatch() {
+	for l.inFlight < int(l.limit) {
+		w := l.queue.pop()
+		if w == nil {
+			return
+		}
+		l.inFlight++
+		close(w.ready)
+	}
+}
+
+// An AdaptiveSOAPClient wraps a SOAPClient, limiting its concurrent requests
+// with an AdaptiveLimiter.
+type AdaptiveSOAPClient struct {
+	Client  SOAPClient
+	Limiter *AdaptiveLimiter
+}
+
+// NewAdaptiveSOAPClient creates a new AdaptiveSOAPClient for the provided
+// client using the provided limiter.
+func NewAdaptiveSOAPClient(client SOAPClient, limiter *AdaptiveLimiter) *AdaptiveSOAPClient {
+	return &AdaptiveSOAPClient{
+		Client:  client,
+		Limiter: limiter,
+	}
+}
+
+// DoRequest sends the provided payload data as SOAP through the means of the
+// accociated client, once the accociated limiter allows it. Latency and busy
+// responses of the request adjust the limit, canceled requests do not.
+func (ac *AdaptiveSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ac.Limiter.acquire(ctx); err != nil {
+		return err
+	}
+
+	started := time.Now()
+	err := ac.Client.DoRequest(ctx, payload, v)
+	latency := time.Since(started)
+
+	if err != nil && ctx.Err() != nil {
+		ac.Limiter.release(false, latency, false)
+		return err
+	}
+	busyErr := err
+	if busyErr == nil {
+		busyErr = responseKCError(v)
+	}
+	busy, _ := IsServerBusy(busyErr)
+	ac.Limiter.release(true, latency, busy)
+
+	return err
+}
+
+func (ac *AdaptiveSOAPClient) String() string {
+	return fmt.Sprintf("%s", ac.Client)
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	l := NewAdaptiveLimiter(4, time.Hour)
+	ctx := context.Background()
+
+	// Fill the limit.
+	for i := 0; i < 4; i++ {
+		if err := l.acquire(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Further requests wait until canceled.
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(waitCtx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// Overload decreases the limit multiplicatively, once per latency target.
+	l.release(true, 0, true)
+	l.release(true, 0, true)
+	if limit := l.Limit(); limit != 2 {
+		t.Errorf("expected limit 2 after overload, got %d", limit)
+	}
+
+	// A waiter is granted once below the limit.
+	granted := make(chan error)
+	go func() {
+		granted <- l.acquire(ctx)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	l.release(false, 0, false)
+	if err := <-granted; err != nil {
+		t.Fatal(err)
+	}
+	if inFlight := l.InFlight(); inFlight != 2 {
+		t.Errorf("expected 2 in flight, got %d", inFlight)
+	}
+
+	// Fast requests at the limit increase it additively.
+	for i := 0; i < 20; i++ {
+		l.release(true, time.Millisecond, false)
+		if err := l.acquire(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if limit := l.Limit(); limit <= 2 || limit > 4 {
+		t.Errorf("expected limit to grow up to 4, got %d", limit)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"strconv"
+)
+
+// PurgeSoftDelete permanently removes all soft deleted items which were
+// deleted more than the provided number of days ago using the provided
+// session, which must be a session of an administrator.
+func (c *KCC) PurgeSoftDelete(ctx context.Context, days uint64, sessionID KCSessionID) (*PurgeResponse, error) {
+	payload := "<ns:purgeSoftDelete><ulSessionId>" +
+		sessionID.String() +
+		"</ulSessionId><ulDays>" +
+		strconv.FormatUint(days, 10) +
+		"</ulDays></ns:purgeSoftDelete>"
+
+	var purgeResponse PurgeResponse
+	err := c.Client.DoRequest(ctx, &payload, &purgeResponse)
+
+	return &purgeResponse, err
+}
+
+// PurgeDeferredUpdates processes pending deferred updates of the server using
+// the provided session, which must be a session of an administrator. The
+// number of remaining deferred updates is returned with the response.
+func (c *KCC) PurgeDeferredUpdates(ctx context.Context, sessionID KCSessionID) (*PurgeDeferredUpdatesResponse, error) {
+	payload := "<ns:purgeDeferredUpdates><ulSessionId>" +
+		sessionID.String() +
+		"</ulSessionId></ns:purgeDeferredUpdates>"
+
+	var purgeDeferredUpdatesResponse PurgeDeferredUpdatesResponse
+	err := c.Client.DoRequest(ctx, &payload, &purgeDeferredUpdatesResponse)
+
+	return &purgeDeferredUpdatesResponse, err
+}
+
+// PurgeCache clears the server caches selected by the provided PURGE_CACHE_*
+// flags using the provided session, which must be a session of an
+// administrator.
+func (c *KCC) PurgeCache(ctx context.Context, flags KCFlag, sessionID KCSessionID) (*PurgeResponse, error) {
+	payload := "<ns:purgeCache><ulSessionId>" +
+		sessionID.String() +
+		"</ulSessionId><ulFlags>" +
+		flags.String() +
+		"</ulFlags></ns:purgeCache>"
+
+	var purgeResponse PurgeResponse
+	err := c.Client.DoRequest(ctx, &payload, &purgeResponse)
+
+	return &purgeResponse, err
+}
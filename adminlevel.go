@@ -0,0 +1,134 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+)
+
+// AdminLevel is the administrative level of a Kopano user, as returned in the
+// IsAdmin field of User.
+type AdminLevel uint64
+
+// Kopano admin levels as defined in common/include/kopano/ECDefs.h.
+const (
+	ADMIN_LEVEL_NONE     AdminLevel = 0
+	ADMIN_LEVEL_ADMIN    AdminLevel = 1
+	ADMIN_LEVEL_SYSADMIN AdminLevel = 2
+)
+
+func (level AdminLevel) String() string {
+	switch level {
+	case ADMIN_LEVEL_NONE:
+		return "none"
+	case ADMIN_LEVEL_ADMIN:
+		return "admin"
+	case ADMIN_LEVEL_SYSADMIN:
+		return "sysadmin"
+	default:
+		return fmt.Sprintf("level %d", uint64(level))
+	}
+}
+
+// An AdminLevelError is returned by RequireAdminLevel when the user of a
+// session has a lower admin level than required.
+type AdminLevelError struct {
+	Required AdminLevel
+	Actual   AdminLevel
+}
+
+func (err *AdminLevelError) Error() string {
+	return fmt.Sprintf("admin level %s required, user has %s", err.Required, err.Actual)
+}
+
+// GetAdminLevel returns the admin level of the user logged on with the
+// provided session.
+func GetAdminLevel(ctx context.Context, c KopanoClient, sessionID KCSessionID) (AdminLevel, error) {
+	// NOTE(longsleep): getUser without user returns the session's own user.
+	response, err := c.GetUser(ctx, "", sessionID)
+	if err != nil {
+		return ADMIN_LEVEL_NONE, fmt.Errorf("get admin level getUser failed: %v", err)
+	}
+	if response.Er != KCSuccess {
+		return ADMIN_LEVEL_NONE, response.Er
+	}
+	if response.User == nil {
+		return ADMIN_LEVEL_NONE, fmt.Errorf("get admin level getUser returned no user")
+	}
+
+	return AdminLevel(response.User.IsAdmin), nil
+}
+
+// RequireAdminLevel returns an AdminLevelError if the user logged on with the
+// provided session has a lower admin level than the provided level. Use it
+// before admin calls to fail early with a clear error, instead of the
+// KCERR_NO_ACCESS the server returns.
+func RequireAdminLevel(ctx context.Context, c KopanoClient, sessionID KCSessionID, level AdminLevel) error {
+	actual, err := GetAdminLevel(ctx, c, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return checkAdminLevel(actual, level)
+}
+
+func checkAdminLevel(actual, required AdminLevel) error {
+	if actual < required {
+		return &AdminLevelError{
+			Required: required,
+			Actual:   actual,
+		}
+	}
+
+	return nil
+}
+
+// AdminLevel returns the admin level of the user logged on with the
+// accociated Session. The level is fetched from the server once and then
+// remembered for the lifetime of the Session.
+func (s *Session) AdminLevel(ctx context.Context) (AdminLevel, error) {
+	s.mutex.RLock()
+	level, known := s.adminLevel, s.adminLevelKnown
+	s.mutex.RUnlock()
+	if known {
+		return level, nil
+	}
+
+	level, err := GetAdminLevel(ctx, s.c, s.id)
+	if err != nil {
+		return ADMIN_LEVEL_NONE, err
+	}
+
+	s.mutex.Lock()
+	s.adminLevel = level
+	s.adminLevelKnown = true
+	s.mutex.Unlock()
+
+	return level, nil
+}
+
+// RequireAdminLevel returns an AdminLevelError if the user logged on with the
+// accociated Session has a lower admin level than the provided level.
+func (s *Session) RequireAdminLevel(ctx context.Context, level AdminLevel) error {
+	actual, err := s.AdminLevel(ctx)
+	if err != nil {
+		return err
+	}
+
+	return checkAdminLevel(actual, level)
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSessionAdminLevel(t *testing.T) {
+	client := &cannedSOAPClient{
+		response: "<ns:getUserResponse><er>0</er><lpsUser><ulUserId>3</ulUserId><lpszUsername>admin1</lpszUsername><ulIsAdmin>1</ulIsAdmin></lpsUser></ns:getUserResponse>",
+	}
+	c := NewKCCWithClient(client)
+	session, err := CreateSession(context.Background(), c, 1, "guid", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = session.RequireAdminLevel(context.Background(), ADMIN_LEVEL_ADMIN); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = session.RequireAdminLevel(context.Background(), ADMIN_LEVEL_SYSADMIN)
+	if levelErr, ok := err.(*AdminLevelError); !ok || levelErr.Required != ADMIN_LEVEL_SYSADMIN || levelErr.Actual != ADMIN_LEVEL_ADMIN {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(client.payloads) != 1 {
+		t.Errorf("admin level not remembered, %d requests", len(client.payloads))
+	}
+}
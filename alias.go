@@ -0,0 +1,241 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrAmbiguousAlias is the error of an alias which is an address of more
+// than one user.
+var ErrAmbiguousAlias = errors.New("ambiguous alias")
+
+// Aliases returns the email aliases of the accociated user from its
+// PR_EMS_AB_PROXY_ADDRESSES. Address type prefixes like smtp: are removed and
+// proxy addresses of other types than SMTP are skipped.
+func (u *User) Aliases() []string {
+	if u.MVProps == nil {
+		return nil
+	}
+
+	var aliases []string
+	for _, pt := range []PT{PR_EMS_AB_PROXY_ADDRESSES_A, PR_EMS_AB_PROXY_ADDRESSES_W} {
+		values, _ := u.MVProps.Get(pt)
+		for _, value := range values {
+			if idx := strings.IndexByte(value, ':'); idx >= 0 && strings.IndexByte(value[:idx], '@') < 0 {
+				if !strings.EqualFold(value[:idx], "smtp") {
+					continue
+				}
+				value = value[idx+1:]
+			}
+			if value != "" {
+				aliases = append(aliases, value)
+			}
+		}
+	}
+
+	return aliases
+}
+
+// SetAliases replaces the email aliases of the accociated user with the
+// provided aliases. Aliases are validated, and duplicates and the primary mail
+// address are removed, ignoring case. Update the user with SetUser to save
+// them.
+func (u *User) SetAliases(aliases []string) error {
+	normalized, err := normalizeAliases(aliases, u.MailAddress)
+	if err != nil {
+		return err
+	}
+
+	props := MVPropMap{}
+	if u.MVProps != nil {
+		for _, value := range *u.MVProps {
+			if value.ID != PR_EMS_AB_PROXY_ADDRESSES_A && value.ID != PR_EMS_AB_PROXY_ADDRESSES_W {
+				props = append(props, value)
+			}
+		}
+	}
+	props = append(props, &MVPropMapValue{
+		ID:           PR_EMS_AB_PROXY_ADDRESSES_A,
+		StringValues: normalized,
+	})
+	u.MVProps = &props
+
+	return nil
+}
+
+// HasAddress returns true if the provided address is the primary mail address
+// or an alias of the accociated user, ignoring case.
+func (u *User) HasAddress(address string) bool {
+	if address == "" {
+		return false
+	}
+	if strings.EqualFold(u.MailAddress, address) {
+		return true
+	}
+	for _, alias := range u.Aliases() {
+		if strings.EqualFold(alias, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeAliases validates the provided aliases and returns them without
+// duplicates and without the provided primary address.
+func normalizeAliases(aliases []string, primary string) ([]string, error) {
+	normalized := make([]string, 0, len(aliases))
+	seen := make(map[string]bool, len(aliases))
+	for _, alias := range aliases {
+		alias = strings.TrimSpace(alias)
+		if idx := strings.LastIndexByte(alias, '@'); idx <= 0 || idx == len(alias)-1 || strings.ContainsAny(alias, " \t<>,;:") {
+			return nil, KCERR_INVALID_PARAMETER
+		}
+		key := strings.ToLower(alias)
+		if seen[key] || strings.EqualFold(alias, primary) {
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, alias)
+	}
+
+	return normalized, nil
+}
+
+// GetUserAliases returns the email aliases of the user with the provided Entry
+// ID using the provided session.
+func (c *KCC) GetUserAliases(ctx context.Context, userEntryID string, sessionID KCSessionID) ([]string, error) {
+	user, err := c.getUserForAliases(ctx, userEntryID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.Aliases(), nil
+}
+
+// SetUserAliases replaces the email aliases of the user with the provided
+// Entry ID with the provided aliases using the provided session, which must
+// have admin rights. See User.SetAliases for how aliases are normalized.
+func (c *KCC) SetUserAliases(ctx context.Context, userEntryID string, aliases []string, sessionID KCSessionID) error {
+	return c.modifyUserAliases(ctx, userEntryID, sessionID, func([]string) []string {
+		return aliases
+	})
+}
+
+// AddUserAliases adds the provided email aliases to the user with the provided
+// Entry ID using the provided session, which must have admin rights. Aliases
+// the user has already are ignored.
+func (c *KCC) AddUserAliases(ctx context.Context, userEntryID string, aliases []string, sessionID KCSessionID) error {
+	return c.modifyUserAliases(ctx, userEntryID, sessionID, func(current []string) []string {
+		return append(current, aliases...)
+	})
+}
+
+// RemoveUserAliases removes the provided email aliases, ignoring case, from the
+// user with the provided Entry ID using the provided session, which must have
+// admin rights. Aliases the user does not have are ignored.
+func (c *KCC) RemoveUserAliases(ctx context.Context, userEntryID string, aliases []string, sessionID KCSessionID) error {
+	return c.modifyUserAliases(ctx, userEntryID, sessionID, func(current []string) []string {
+		kept := make([]string, 0, len(current))
+		for _, alias := range current {
+			remove := false
+			for _, removed := range aliases {
+				if strings.EqualFold(alias, removed) {
+					remove = true
+					break
+				}
+			}
+			if !remove {
+				kept = append(kept, alias)
+			}
+		}
+		return kept
+	})
+}
+
+// modifyUserAliases fetches the user with the provided Entry ID, replaces its
+// aliases with the ones returned by the provided function and saves the user.
+func (c *KCC) modifyUserAliases(ctx context.Context, userEntryID string, sessionID KCSessionID, modify func([]string) []string) error {
+	user, err := c.getUserForAliases(ctx, userEntryID, sessionID)
+	if err != nil {
+		return err
+	}
+	if err = user.SetAliases(modify(user.Aliases())); err != nil {
+		return err
+	}
+
+	resp, err := c.SetUser(ctx, user, "", sessionID)
+	if err != nil {
+		return fmt.Errorf("user aliases setUser failed: %v", err)
+	}
+	if resp.Er != KCSuccess {
+		return resp.Er
+	}
+
+	return nil
+}
+
+func (c *KCC) getUserForAliases(ctx context.Context, userEntryID string, sessionID KCSessionID) (*User, error) {
+	resp, err := c.GetUser(ctx, userEntryID, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("user aliases getUser failed: %v", err)
+	}
+	if resp.Er != KCSuccess {
+		return nil, resp.Er
+	}
+	if resp.User == nil {
+		return nil, KCERR_NOT_FOUND
+	}
+
+	return resp.User, nil
+}
+
+// ResolveAlias returns the user which has the provided address as primary mail
+// address or as alias, ignoring case, using the provided session. The users of
+// the default company are listed to find it. KCERR_NOT_FOUND is returned if no
+// user has the address and ErrAmbiguousAlias if more than one user has it.
+func (c *KCC) ResolveAlias(ctx context.Context, address string, sessionID KCSessionID) (*User, error) {
+	if address == "" {
+		return nil, KCERR_INVALID_PARAMETER
+	}
+
+	var found *User
+	err := c.ListUsers(ctx, "", sessionID, func(user *User) error {
+		if !user.HasAddress(address) {
+			return nil
+		}
+		if found != nil {
+			return ErrAmbiguousAlias
+		}
+		found = user
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(KCError); ok || err == ErrAmbiguousAlias {
+			return nil, err
+		}
+		return nil, fmt.Errorf("resolve alias failed: %v", err)
+	}
+	if found == nil {
+		return nil, KCERR_NOT_FOUND
+	}
+
+	return found, nil
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// An actionSOAPClient responds with the canned response of the action of the
+// request.
+type actionSOAPClient struct {
+	responses map[string]string
+	payloads  []string
+}
+
+func (ac *actionSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	ac.payloads = append(ac.payloads, *payload)
+	return parseSOAPResponse(http.StatusOK, strings.NewReader(soapHeader+ac.responses[SOAPAction(*payload)]+soapFooter), v)
+}
+
+func TestUserAliases(t *testing.T) {
+	user := &User{
+		MailAddress: "jonas@example.com",
+		MVProps: &MVPropMap{
+			{ID: PR_EC_SENDAS_USER_ENTRYIDS, StringValues: []string{"AAAA02"}},
+			{ID: PR_EMS_AB_PROXY_ADDRESSES_A, StringValues: []string{"jd@example.com", "SMTP:Jonas.Doe@example.com", "x500:/o=Kopano/cn=jdoe"}},
+		},
+	}
+	if aliases := user.Aliases(); !reflect.DeepEqual(aliases, []string{"jd@example.com", "Jonas.Doe@example.com"}) {
+		t.Errorf("unexpected aliases: %v", aliases)
+	}
+	if !user.HasAddress("JONAS.DOE@example.com") || !user.HasAddress("jonas@example.com") || user.HasAddress("jane@example.com") {
+		t.Errorf("unexpected addresses of user")
+	}
+
+	if err := user.SetAliases([]string{"jd@example.com", "JD@example.com", "Jonas@example.com", " doe@example.com "}); err != nil {
+		t.Fatal(err)
+	}
+	if aliases := user.Aliases(); !reflect.DeepEqual(aliases, []string{"jd@example.com", "doe@example.com"}) {
+		t.Errorf("unexpected normalized aliases: %v", aliases)
+	}
+	if len(*user.MVProps) != 2 || (*user.MVProps)[0].ID != PR_EC_SENDAS_USER_ENTRYIDS {
+		t.Errorf("unexpected props after setting aliases: %v", *user.MVProps)
+	}
+	for _, alias := range []string{"", "jd", "@example.com", "jd@", "jd <jd@example.com>", "a@example.com,b@example.com"} {
+		if err := user.SetAliases([]string{alias}); err != KCERR_INVALID_PARAMETER {
+			t.Errorf("expected invalid parameter for %q, got %v", alias, err)
+		}
+	}
+}
+
+func TestModifyUserAliases(t *testing.T) {
+	client := &actionSOAPClient{
+		responses: map[string]string{
+			"getUser": "<ns:getUserResponse><er>0</er><lpsUser><ulUserId>3</ulUserId><lpszUsername>jdoe</lpszUsername><lpszMailAddress>jonas@example.com</lpszMailAddress>" +
+				"<lpsMVPropmap><item><ulPropId>2148470814</ulPropId><sValues><item>jd@example.com</item></sValues></item></lpsMVPropmap>" +
+				"<sUserId>AAAA01</sUserId></lpsUser></ns:getUserResponse>",
+			"setUser": "<ns:setUserResponse><er>0</er></ns:setUserResponse>",
+		},
+	}
+	c := NewKCCWithClient(client)
+
+	aliases, err := c.GetUserAliases(context.Background(), "AAAA01", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(aliases, []string{"jd@example.com"}) {
+		t.Errorf("unexpected aliases: %v", aliases)
+	}
+
+	if err = c.AddUserAliases(context.Background(), "AAAA01", []string{"doe@example.com", "JD@example.com"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if payload := client.payloads[len(client.payloads)-1]; !strings.Contains(payload, "<sValues><item>jd@example.com</item><item>doe@example.com</item></sValues>") {
+		t.Errorf("unexpected setUser payload: %s", payload)
+	}
+
+	if err = c.RemoveUserAliases(context.Background(), "AAAA01", []string{"JD@example.com"}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if payload := client.payloads[len(client.payloads)-1]; !strings.Contains(payload, "<sValues></sValues>") {
+		t.Errorf("unexpected setUser payload: %s", payload)
+	}
+
+	if err = c.SetUserAliases(context.Background(), "AAAA01", []string{"invalid"}, 1); err != KCERR_INVALID_PARAMETER {
+		t.Errorf("expected invalid parameter, got %v", err)
+	}
+	if len(client.payloads) != 6 {
+		t.Errorf("unexpected number of requests: %d", len(client.payloads))
+	}
+}
+
+func TestResolveAlias(t *testing.T) {
+	client := &cannedSOAPClient{
+		response: "<ns:getUserListResponse><sUserArray>" +
+			"<item><lpszUsername>jdoe</lpszUsername><lpszMailAddress>jonas@example.com</lpszMailAddress><lpsMVPropmap><item><ulPropId>2148470814</ulPropId><sValues><item>jd@example.com</item><item>info@example.com</item></sValues></item></lpsMVPropmap><sUserId>AAAA01</sUserId></item>" +
+			"<item><lpszUsername>jsmith</lpszUsername><lpszMailAddress>jo@example.com</lpszMailAddress><lpsMVPropmap><item><ulPropId>2148470814</ulPropId><sValues><item>info@example.com</item></sValues></item></lpsMVPropmap><sUserId>AAAA02</sUserId></item>" +
+			"</sUserArray><er>0</er></ns:getUserListResponse>",
+	}
+	c := NewKCCWithClient(client)
+
+	for _, test := range []struct {
+		address string
+		entryID string
+		err     error
+	}{
+		{"JD@example.com", "AAAA01", nil},
+		{"jo@example.com", "AAAA02", nil},
+		{"info@example.com", "", ErrAmbiguousAlias},
+		{"nobody@example.com", "", KCERR_NOT_FOUND},
+		{"", "", KCERR_INVALID_PARAMETER},
+	} {
+		user, err := c.ResolveAlias(context.Background(), test.address, 1)
+		if err != test.err {
+			t.Errorf("unexpected error for %q: %v", test.address, err)
+			continue
+		}
+		if err == nil && user.UserEntryID != test.entryID {
+			t.Errorf("unexpected user for %q: %s", test.address, user.UserEntryID)
+		}
+	}
+}
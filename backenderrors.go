@@ -0,0 +1,153 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// A BackendErrorClass groups backend failures by their likely cause.
+type BackendErrorClass string
+
+// BackendErrorClass values.
+const (
+	// BackendErrorAuth is for rejected credentials, sessions and permissions.
+	BackendErrorAuth BackendErrorClass = "auth"
+	// BackendErrorNetwork is for servers which could not be reached or did
+	// not respond in time.
+	BackendErrorNetwork BackendErrorClass = "network"
+	// BackendErrorBusy is for servers which are too busy to handle requests.
+	BackendErrorBusy BackendErrorClass = "busy"
+	// BackendErrorQuota is for stores which are full or objects which are too
+	// big.
+	BackendErrorQuota BackendErrorClass = "quota"
+	// BackendErrorNotFound is for objects which do not exist.
+	BackendErrorNotFound BackendErrorClass = "not_found"
+	// BackendErrorProtocol is for responses which are no SOAP responses of
+	// the Kopano server, see ProtocolError.
+	BackendErrorProtocol BackendErrorClass = "protocol"
+	// BackendErrorOther is for all other failures.
+	BackendErrorOther BackendErrorClass = "other"
+)
+
+// ClassifyBackendError returns the BackendErrorClass of the provided error of
+// a backend request together with its code, either the KC error code like
+// KC:0x80000009 or the HTTP status like HTTP:503. Errors without code, like
+// transport errors, have an empty code.
+func ClassifyBackendError(err error) (BackendErrorClass, string) {
+	switch e := err.(type) {
+	case KCError:
+		code := fmt.Sprintf("KC:0x%x", uint64(e))
+		switch e {
+		case KCERR_LOGON_FAILED, KCERR_NO_ACCESS, KCERR_END_OF_SESSION:
+			return BackendErrorAuth, code
+		case KCERR_NETWORK_ERROR, KCERR_SERVER_NOT_RESPONDING, KCERR_TIMEOUT:
+			return BackendErrorNetwork, code
+		case KCERR_BUSY:
+			return BackendErrorBusy, code
+		case KCERR_STORE_FULL, KCERR_TOO_BIG:
+			return BackendErrorQuota, code
+		case KCERR_NOT_FOUND, KCERR_UNKNOWN_OBJECT, KCERR_OBJECT_DELETED:
+			return BackendErrorNotFound, code
+		}
+		return BackendErrorOther, code
+
+	case *HTTPStatusError:
+		code := fmt.Sprintf("HTTP:%d", e.StatusCode)
+		switch {
+		case e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden:
+			return BackendErrorAuth, code
+		case e.StatusCode == http.StatusServiceUnavailable || e.StatusCode == http.StatusTooManyRequests:
+			return BackendErrorBusy, code
+		case e.StatusCode == http.StatusBadGateway || e.StatusCode == http.StatusGatewayTimeout:
+			return BackendErrorNetwork, code
+		case e.StatusCode == http.StatusNotFound:
+			return BackendErrorNotFound, code
+		}
+		return BackendErrorOther, code
+
+	case *ProtocolError:
+		return BackendErrorProtocol, ""
+
+	case *CircuitOpenError:
+		return BackendErrorNetwork, ""
+	}
+
+	if IsRetryable(err) {
+		return BackendErrorNetwork, ""
+	}
+	return BackendErrorOther, ""
+}
+
+// A BackendErrorCount is the number of backend failures of a class and code.
+type BackendErrorCount struct {
+	Class BackendErrorClass
+	Code  string
+	Count uint64
+}
+
+type backendErrorKey struct {
+	class BackendErrorClass
+	code  string
+}
+
+var backendErrors = struct {
+	sync.Mutex
+	m map[backendErrorKey]uint64
+}{
+	m: make(map[backendErrorKey]uint64),
+}
+
+// countBackendError counts the provided error of a backend request by its
+// class and code.
+func countBackendError(err error) {
+	class, code := ClassifyBackendError(err)
+	key := backendErrorKey{class, code}
+
+	backendErrors.Lock()
+	backendErrors.m[key]++
+	backendErrors.Unlock()
+}
+
+// BackendErrors returns the number of failed backend requests of all SOAP
+// clients of this process by class and code, sorted by class and code. Both
+// transport errors and KC errors returned by the server are counted, requests
+// aborted by the caller are not.
+func BackendErrors() []BackendErrorCount {
+	backendErrors.Lock()
+	counts := make([]BackendErrorCount, 0, len(backendErrors.m))
+	for key, count := range backendErrors.m {
+		counts = append(counts, BackendErrorCount{
+			Class: key.class,
+			Code:  key.code,
+			Count: count,
+		})
+	}
+	backendErrors.Unlock()
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Class != counts[j].Class {
+			return counts[i].Class < counts[j].Class
+		}
+		return counts[i].Code < counts[j].Code
+	})
+
+	return counts
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// BackendStats holds a snapshot of the backend request counters of all SOAP
+// clients of this process.
+type BackendStats struct {
+	// InFlight is the number of requests currently sent to a server.
+	InFlight int64
+	// Waiting is the number of requests waiting for a connection slot or for
+	// a rate limiter.
+	Waiting int64
+	// Requests is the total number of requests sent to a server.
+	Requests uint64
+	// Canceled is the total number of requests which were aborted, because
+	// their context was done while waiting or in flight.
+	Canceled uint64
+}
+
+var backendStats BackendStats
+
+// Stats returns a snapshot of the current backend request counters.
+func Stats() BackendStats {
+	return BackendStats{
+		InFlight: atomic.LoadInt64(&backendStats.InFlight),
+		Waiting:  atomic.LoadInt64(&backendStats.Waiting),
+		Requests: atomic.LoadUint64(&backendStats.Requests),
+		Canceled: atomic.LoadUint64(&backendStats.Canceled),
+	}
+}
+
+func beginBackendRequest() time.Time {
+	atomic.AddInt64(&backendStats.InFlight, 1)
+	atomic.AddUint64(&backendStats.Requests, 1)
+	return time.Now()
+}
+
+// endBackendRequest records the end of a backend request which failed with
+// the provided error, if not nil, or returned the provided response.
+func endBackendRequest(ctx context.Context, started time.Time, err error, v interface{}) {
+	atomic.AddInt64(&backendStats.InFlight, -1)
+	countCanceled(ctx, err)
+
+	// NOTE(longsleep): Requests aborted by the caller say nothing about the
+	// backend, so they are not tracked for the SLO nor counted as errors.
+	if err != nil && ctx != nil && ctx.Err() != nil {
+		return
+	}
+	if tracker := DefaultSLOTracker; tracker != nil {
+		tracker.Observe(time.Since(started), err)
+	}
+	if err == nil {
+		err = responseKCError(v)
+	}
+	if err != nil {
+		countBackendError(err)
+	}
+}
+
+func beginBackendWait() {
+	atomic.AddInt64(&backendStats.Waiting, 1)
+}
+
+func endBackendWait(ctx context.Context, err error) {
+	atomic.AddInt64(&backendStats.Waiting, -1)
+	countCanceled(ctx, err)
+}
+
+func countCanceled(ctx context.Context, err error) {
+	if err != nil && ctx != nil && ctx.Err() != nil {
+		atomic.AddUint64(&backendStats.Canceled, 1)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestBackendStats(t *testing.T) {
+	block := make(chan bool)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		select {
+		case <-block:
+		case <-req.Context().Done():
+			return
+		}
+		rw.Write([]byte(soapHeader + "<ns:logoffResponse><er>0</er></ns:logoffResponse>" + soapFooter))
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewKCCWithClient(client)
+
+	before := Stats()
+
+	// Completed request.
+	done := make(chan error)
+	go func() {
+		_, logoffErr := c.Logoff(context.Background(), 1)
+		done <- logoffErr
+	}()
+	block <- true
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// Canceled request.
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, logoffErr := c.Logoff(ctx, 1)
+		done <- logoffErr
+	}()
+	cancel()
+	if err = <-done; err == nil {
+		t.Fatal("expected error for canceled request")
+	}
+
+	after := Stats()
+	if after.Requests-before.Requests != 2 {
+		t.Errorf("expected 2 requests, got %d", after.Requests-before.Requests)
+	}
+	if after.Canceled-before.Canceled != 1 {
+		t.Errorf("expected 1 canceled request, got %d", after.Canceled-before.Canceled)
+	}
+	if after.InFlight != before.InFlight {
+		t.Errorf("expected no requests in flight, got %d", after.InFlight-before.InFlight)
+	}
+}
+
+func TestBackendErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/down" {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Write([]byte(soapHeader + "<ns:logonResponse><er>" + strconv.FormatUint(uint64(KCERR_LOGON_FAILED), 10) + "</er></ns:logonResponse>" + soapFooter))
+	}))
+	defer srv.Close()
+
+	count := func(class BackendErrorClass, code string) uint64 {
+		for _, count := range BackendErrors() {
+			if count.Class == class && count.Code == code {
+				return count.Count
+			}
+		}
+		return 0
+	}
+	authBefore := count(BackendErrorAuth, "KC:0x80000009")
+	busyBefore := count(BackendErrorBusy, "HTTP:503")
+
+	for _, path := range []string{"/", "/down"} {
+		uri, _ := url.Parse(srv.URL + path)
+		client, err := NewSOAPHTTPClient(uri, srv.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		NewKCCWithClient(client).Logon(context.Background(), "user1", "wrong", 0)
+	}
+
+	if n := count(BackendErrorAuth, "KC:0x80000009") - authBefore; n != 1 {
+		t.Errorf("expected 1 auth error, got %d", n)
+	}
+	if n := count(BackendErrorBusy, "HTTP:503") - busyBefore; n != 1 {
+		t.Errorf("expected 1 busy error, got %d", n)
+	}
+}
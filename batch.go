@@ -0,0 +1,243 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrAmbiguousName is the error of a name which matches more than one entry
+// of the AB.
+var ErrAmbiguousName = errors.New("ambiguous name")
+
+// DefaultNameCandidatesLimit is the default maximum number of candidates
+// returned per ambiguous name by ResolveNameCandidates.
+var DefaultNameCandidatesLimit = 20
+
+// A ResolveNameResult is the result of a single name of a ResolveNames batch.
+// Either Props or Err is set. Candidates are set for ambiguous names by
+// ResolveNameCandidates. MatchType and Score are set for resolved names if
+// the name matches the PR_ACCOUNT, PR_SMTP_ADDRESS or PR_DISPLAY_NAME of the
+// fetched props.
+type ResolveNameResult struct {
+	Index      int
+	Name       string
+	Props      *PropTagRowSet
+	Err        error
+	Candidates []*NameCandidate
+
+	MatchType NameMatchType
+	Score     float64
+}
+
+// A NameCandidate is a user matching an ambiguous name, so applications can
+// let the user pick the intended one. MatchType is the most relevant field
+// matching the name and Score its relevance between 0 and 1, where 1 is an
+// exact match of the username.
+type NameCandidate struct {
+	DisplayName  string        `json:"displayName"`
+	EmailAddress string        `json:"emailAddress,omitempty"`
+	Username     string        `json:"username"`
+	EntryID      string        `json:"entryID"`
+	MatchType    NameMatchType `json:"matchType"`
+	Score        float64       `json:"score"`
+}
+
+// ResolveNames resolves the provided names against the display names of the
+// AB using the provided session, fetching the provided props for each match.
+// A result is returned for each name at the same index. Names which cannot be
+// resolved fail individually with KCERR_NOT_FOUND, ErrAmbiguousName or
+// KCERR_INVALID_PARAMETER for empty names. An error is only returned if the
+// whole batch failed.
+func (c *KCC) ResolveNames(ctx context.Context, names []string, props []PT, sessionID KCSessionID) ([]*ResolveNameResult, error) {
+	results := make([]*ResolveNameResult, len(names))
+	rows := make([]map[PT]interface{}, 0, len(names))
+	flags := make([]ABFlag, 0, len(names))
+	indexes := make([]int, 0, len(names))
+	for idx, name := range names {
+		results[idx] = &ResolveNameResult{
+			Index: idx,
+			Name:  name,
+		}
+		if name == "" {
+			results[idx].Err = KCERR_INVALID_PARAMETER
+			continue
+		}
+		rows = append(rows, map[PT]interface{}{
+			PR_DISPLAY_NAME: name,
+		})
+		flags = append(flags, MAPI_UNRESOLVED)
+		indexes = append(indexes, idx)
+	}
+	if len(rows) == 0 {
+		return results, nil
+	}
+
+	response, err := c.ABResolveNamesRows(ctx, props, rows, flags, sessionID, 0)
+	if err != nil {
+		return nil, fmt.Errorf("resolve names abResolveNames failed: %v", err)
+	}
+	if response.Er != KCSuccess {
+		return nil, response.Er
+	}
+	if len(response.Flags) != len(rows) {
+		return nil, fmt.Errorf("resolve names abResolveNames returned %d flags for %d names", len(response.Flags), len(rows))
+	}
+
+	for pos, idx := range indexes {
+		result := results[idx]
+		switch response.Flags[pos] {
+		case MAPI_RESOLVED:
+			if pos < len(response.RowSet) {
+				result.Props = response.RowSet[pos]
+				if m := matchProps(result.Props, result.Name); m.matched() {
+					result.MatchType, result.Score = m.matchType, m.score
+				}
+			} else {
+				result.Err = KCERR_NOT_FOUND
+			}
+		case MAPI_AMBIGUOUS:
+			result.Err = ErrAmbiguousName
+		default:
+			result.Err = KCERR_NOT_FOUND
+		}
+	}
+
+	return results, nil
+}
+
+// ResolveNameCandidates sets the Candidates of the provided results which
+// failed with ErrAmbiguousName to up to limit users matching their name,
+// using the provided session. A limit of 0 or less uses
+// DefaultNameCandidatesLimit. Users match if their username, their mail
+// address, their full name, any word of it or any of their aliases starts with
+// the name, ignoring case. Candidates are sorted by descending score, the most
+// relevant are kept. Users hidden from the AB are skipped. The users of the default company are
+// listed once for all results, so the request is only made if there are
+// ambiguous results.
+func (c *KCC) ResolveNameCandidates(ctx context.Context, results []*ResolveNameResult, limit int, sessionID KCSessionID) error {
+	if limit <= 0 {
+		limit = DefaultNameCandidatesLimit
+	}
+
+	ambiguous := make([]*ResolveNameResult, 0, len(results))
+	for _, result := range results {
+		if result.Err == ErrAmbiguousName {
+			result.Candidates = make([]*NameCandidate, 0)
+			ambiguous = append(ambiguous, result)
+		}
+	}
+	if len(ambiguous) == 0 {
+		return nil
+	}
+
+	err := c.ListUsers(ctx, "", sessionID, func(user *User) error {
+		if user.IsABHidden != 0 {
+			return nil
+		}
+		for _, result := range ambiguous {
+			m := matchUser(user, result.Name)
+			if !m.matched() {
+				continue
+			}
+			result.Candidates = append(result.Candidates, &NameCandidate{
+				DisplayName:  user.FullName,
+				EmailAddress: user.MailAddress,
+				Username:     user.Username,
+				EntryID:      user.UserEntryID,
+				MatchType:    m.matchType,
+				Score:        m.score,
+			})
+			// NOTE(longsleep): Trim in batches, so memory stays bounded
+			// without sorting on every match.
+			if len(result.Candidates) >= 2*limit {
+				sortNameCandidates(result.Candidates)
+				result.Candidates = result.Candidates[:limit]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("resolve name candidates failed: %v", err)
+	}
+
+	for _, result := range ambiguous {
+		sortNameCandidates(result.Candidates)
+		if len(result.Candidates) > limit {
+			result.Candidates = result.Candidates[:limit]
+		}
+	}
+
+	return nil
+}
+
+// A UserResult is the result of a single user of a GetUsersByName batch.
+// Either User or Err is set.
+type UserResult struct {
+	Index    int
+	Username string
+	User     *User
+	Err      error
+}
+
+// GetUsersByName fetches the details of the users with the provided usernames
+// using the provided session. A result is returned for each username at the
+// same index. Users which cannot be fetched fail individually. An error is
+// only returned if the whole batch failed, which is the case when the session
+// has ended or the provided context is done.
+func (c *KCC) GetUsersByName(ctx context.Context, usernames []string, sessionID KCSessionID) ([]*UserResult, error) {
+	results := make([]*UserResult, len(usernames))
+	for idx, username := range usernames {
+		result := &UserResult{
+			Index:    idx,
+			Username: username,
+		}
+		results[idx] = result
+		if username == "" {
+			result.Err = KCERR_INVALID_PARAMETER
+			continue
+		}
+
+		resolve, err := c.ResolveUsername(ctx, username, sessionID)
+		if err == nil && resolve.Er == KCSuccess {
+			var response *GetUserResponse
+			response, err = c.GetUser(ctx, resolve.UserEntryID, sessionID)
+			if err == nil {
+				if response.Er == KCSuccess {
+					result.User = response.User
+				} else {
+					result.Err = response.Er
+				}
+			}
+		} else if err == nil {
+			result.Err = resolve.Er
+		}
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			result.Err = err
+		}
+		if result.Err == KCERR_END_OF_SESSION {
+			return nil, result.Err
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// A cannedSOAPClient responds to all requests with the same SOAP body.
+type cannedSOAPClient struct {
+	response string
+	payloads []string
+}
+
+func (cc *cannedSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	cc.payloads = append(cc.payloads, *payload)
+	return parseSOAPResponse(http.StatusOK, strings.NewReader(soapHeader+cc.response+soapFooter), v)
+}
+
+func TestResolveNamesPartialFailure(t *testing.T) {
+	client := &cannedSOAPClient{
+		response: "<ns:abResolveNamesResponse><er>0</er><sRowSet>" +
+			"<item><item><ulPropTag>972947487</ulPropTag><lpszA>Jonas</lpszA></item></item>" +
+			"<item></item>" +
+			"<item></item>" +
+			"</sRowSet><aFlags><item>2</item><item>1</item><item>0</item></aFlags></ns:abResolveNamesResponse>",
+	}
+	c := NewKCCWithClient(client)
+
+	results, err := c.ResolveNames(context.Background(), []string{"jonas", "", "jo", "nobody"}, []PT{PR_SMTP_ADDRESS}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("unexpected number of results: %d", len(results))
+	}
+	for idx, result := range results {
+		if result.Index != idx {
+			t.Errorf("unexpected index %d for result %d", result.Index, idx)
+		}
+	}
+	if results[0].Err != nil || results[0].Props.GetString(PR_SMTP_ADDRESS) != "Jonas" {
+		t.Errorf("unexpected result 0: %+v", results[0])
+	}
+	if results[1].Err != KCERR_INVALID_PARAMETER {
+		t.Errorf("unexpected result 1: %+v", results[1])
+	}
+	if results[2].Err != ErrAmbiguousName {
+		t.Errorf("unexpected result 2: %+v", results[2])
+	}
+	if results[3].Err != KCERR_NOT_FOUND {
+		t.Errorf("unexpected result 3: %+v", results[3])
+	}
+	if len(client.payloads) != 1 || strings.Count(client.payloads[0], "<lpszA>") != 3 {
+		t.Errorf("unexpected requests: %v", client.payloads)
+	}
+}
+
+func TestResolveNameCandidates(t *testing.T) {
+	client := &cannedSOAPClient{
+		response: "<ns:getUserListResponse><sUserArray>" +
+			"<item><lpszUsername>jdoe</lpszUsername><lpszFullName>Jonas Doe</lpszFullName><lpszMailAddress>jonas@example.com</lpszMailAddress><sUserId>AAAA01</sUserId></item>" +
+			"<item><lpszUsername>jsmith</lpszUsername><lpszFullName>Jo Smith</lpszFullName><sUserId>AAAA02</sUserId></item>" +
+			"<item><lpszUsername>hidden</lpszUsername><lpszFullName>Jo Hidden</lpszFullName><ulIsABHidden>1</ulIsABHidden><sUserId>AAAA03</sUserId></item>" +
+			"<item><lpszUsername>amy</lpszUsername><lpszFullName>Amy Smith</lpszFullName><sUserId>AAAA04</sUserId></item>" +
+			"<item><lpszUsername>mb</lpszUsername><lpszFullName>Mailbox</lpszFullName><lpsMVPropmap><item><ulPropId>2148470814</ulPropId><sValues><item>smtp:jo@example.com</item></sValues></item></lpsMVPropmap><sUserId>AAAA05</sUserId></item>" +
+			"</sUserArray><er>0</er></ns:getUserListResponse>",
+	}
+	c := NewKCCWithClient(client)
+
+	results := []*ResolveNameResult{
+		{Index: 0, Name: "jo", Err: ErrAmbiguousName},
+		{Index: 1, Name: "amy", Err: KCERR_NOT_FOUND},
+		{Index: 2, Name: "SMITH", Err: ErrAmbiguousName},
+	}
+	if err := c.ResolveNameCandidates(context.Background(), results, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	candidateIDs := func(result *ResolveNameResult) string {
+		ids := make([]string, len(result.Candidates))
+		for idx, candidate := range result.Candidates {
+			ids[idx] = candidate.EntryID
+		}
+		return strings.Join(ids, ",")
+	}
+	if ids := candidateIDs(results[0]); ids != "AAAA02,AAAA01,AAAA05" {
+		t.Errorf("unexpected candidates of jo: %s", ids)
+	}
+	if candidate := results[0].Candidates[1]; candidate.DisplayName != "Jonas Doe" || candidate.EmailAddress != "jonas@example.com" {
+		t.Errorf("unexpected candidate: %+v", candidate)
+	}
+	for idx, expected := range []struct {
+		matchType NameMatchType
+		score     float64
+	}{
+		{NameMatchDisplayName, 0.7},
+		{NameMatchEmail, 0.503},
+		{NameMatchAlias, 0.343},
+	} {
+		if candidate := results[0].Candidates[idx]; candidate.MatchType != expected.matchType || candidate.Score != expected.score {
+			t.Errorf("unexpected match of candidate %d: %s %v", idx, candidate.MatchType, candidate.Score)
+		}
+	}
+	if results[1].Candidates != nil {
+		t.Errorf("unexpected candidates of a name which is not ambiguous: %v", results[1].Candidates)
+	}
+	if ids := candidateIDs(results[2]); ids != "AAAA02,AAAA04" {
+		t.Errorf("unexpected candidates of SMITH: %s", ids)
+	}
+
+	results[2].Candidates = nil
+	if err := c.ResolveNameCandidates(context.Background(), results[2:], 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if ids := candidateIDs(results[2]); ids != "AAAA02" {
+		t.Errorf("unexpected limited candidates: %s", ids)
+	}
+	if len(client.payloads) != 2 {
+		t.Errorf("unexpected number of requests: %d", len(client.payloads))
+	}
+}
+
+func TestNameMatch(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		user      *User
+		matchType NameMatchType
+		score     float64
+	}{
+		{"jdoe", &User{Username: "jdoe", FullName: "jdoe"}, NameMatchLogin, 1},
+		{"JONAS@example.com", &User{Username: "jdoe", MailAddress: "jonas@example.com"}, NameMatchEmail, 0.9},
+		{"jonas d", &User{Username: "jdoe", FullName: "Jonas Doe"}, NameMatchDisplayName, 0.711},
+		{"doe", &User{Username: "jdoe", FullName: "Jonas Doe"}, NameMatchDisplayName, 0.7},
+		{"smith", &User{Username: "jdoe", FullName: "Jonas Doe"}, "", 0},
+		{"", &User{Username: "jdoe"}, "", 0},
+	} {
+		m := matchUser(test.user, test.name)
+		if m.matchType != test.matchType || m.score != test.score {
+			t.Errorf("unexpected match of %q: %s %v", test.name, m.matchType, m.score)
+		}
+	}
+
+	props := &PropTagRowSet{
+		PropTagValues: []*PropTagRowSetValue{
+			StringPropValue(PR_DISPLAY_NAME, "Jonas Doe"),
+			StringPropValue(PR_SMTP_ADDRESS, "jonas@example.com"),
+		},
+	}
+	if m := matchProps(props, "jonas@example.com"); m.matchType != NameMatchEmail || m.score != 0.9 {
+		t.Errorf("unexpected match of props: %s %v", m.matchType, m.score)
+	}
+}
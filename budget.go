@@ -0,0 +1,111 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// A Budget splits the time until the deadline of a context across a number of
+// sequential backend calls of a composite operation. Each call gets an equal
+// share of the remaining time, so a slow call fails fast instead of using up
+// the time of the calls after it. Time not used by a call is passed on to the
+// following calls.
+type Budget struct {
+	ctx       context.Context
+	calls     int
+	completed []string
+	step      string
+	stepCtx   context.Context
+}
+
+// NewBudget creates a new Budget for the provided number of calls using the
+// deadline of the provided context. If the context has no deadline, the calls
+// are not limited.
+func NewBudget(ctx context.Context, calls int) *Budget {
+	return &Budget{
+		ctx:   ctx,
+		calls: calls,
+	}
+}
+
+// Next returns the context for the next call, named by the provided step. The
+// previous step is considered completed. The returned cancel function must be
+// called when the call is done.
+func (b *Budget) Next(step string) (context.Context, context.CancelFunc) {
+	if b.step != "" {
+		b.completed = append(b.completed, b.step)
+	}
+	b.step = step
+
+	deadline, ok := b.ctx.Deadline()
+	left := b.calls - len(b.completed)
+	if !ok || left <= 1 {
+		ctx, cancel := context.WithCancel(b.ctx)
+		b.stepCtx = ctx
+		return ctx, cancel
+	}
+
+	share := time.Until(deadline) / time.Duration(left)
+	ctx, cancel := context.WithTimeout(b.ctx, share)
+	b.stepCtx = ctx
+	return ctx, cancel
+}
+
+// Completed returns the names of the steps which were completed before the
+// current step.
+func (b *Budget) Completed() []string {
+	return b.completed
+}
+
+// Step returns the name of the current step.
+func (b *Budget) Step() string {
+	return b.step
+}
+
+// Exceeded returns true if the current step ran out of its share of the time.
+func (b *Budget) Exceeded() bool {
+	return b.stepCtx != nil && b.stepCtx.Err() == context.DeadlineExceeded
+}
+
+// Err returns a *BudgetExceededError if the current step ran out of its share
+// of the time, otherwise the provided error is returned as is.
+func (b *Budget) Err(err error) error {
+	if err == nil || !b.Exceeded() {
+		return err
+	}
+
+	return &BudgetExceededError{
+		Step:      b.step,
+		Completed: b.completed,
+		Err:       err,
+	}
+}
+
+// A BudgetExceededError is returned when a step of a composite operation ran
+// out of its share of a Budget.
+type BudgetExceededError struct {
+	Step      string
+	Completed []string
+	Err       error
+}
+
+func (err *BudgetExceededError) Error() string {
+	return fmt.Sprintf("time budget exceeded in step %s after %d completed steps: %v", err.Step, len(err.Completed), err.Err)
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBudget(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	budget := NewBudget(ctx, 2)
+	first, firstCancel := budget.Next("resolve")
+	firstDeadline, ok := first.Deadline()
+	if !ok || !firstDeadline.Before(deadline.Add(-50*time.Millisecond)) {
+		t.Errorf("first step got too much time: %v", time.Until(firstDeadline))
+	}
+	<-first.Done()
+	firstCancel()
+
+	err := budget.Err(first.Err())
+	if exceeded, ok := err.(*BudgetExceededError); !ok || exceeded.Step != "resolve" || len(exceeded.Completed) != 0 {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	second, secondCancel := budget.Next("getUser")
+	defer secondCancel()
+	if secondDeadline, _ := second.Deadline(); !secondDeadline.Equal(deadline) {
+		t.Errorf("last step did not get the remaining time: %v", time.Until(secondDeadline))
+	}
+	if completed := budget.Completed(); len(completed) != 1 || completed[0] != "resolve" {
+		t.Errorf("unexpected completed steps: %v", completed)
+	}
+	if err := budget.Err(nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
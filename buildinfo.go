@@ -0,0 +1,66 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"runtime"
+	"strings"
+)
+
+// Build details, set at link time together with Version, for example with
+//
+//	go build -ldflags "-X stash.kopano.io/kgol/kcc-go.Version=1.2.3 \
+//		-X stash.kopano.io/kgol/kcc-go.BuildCommit=$(git rev-parse --short HEAD) \
+//		-X stash.kopano.io/kgol/kcc-go.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	// BuildCommit is the version control commit the binary was built from.
+	BuildCommit = ""
+	// BuildDate is the date the binary was built at.
+	BuildDate = ""
+)
+
+// VersionInfo holds the version and build details of this client
+// implementation.
+type VersionInfo struct {
+	Version       string `json:"version"`
+	Commit        string `json:"commit,omitempty"`
+	BuildDate     string `json:"buildDate,omitempty"`
+	GoVersion     string `json:"goVersion"`
+	ClientVersion int    `json:"clientVersion"`
+}
+
+// BuildInfo returns the version and build details of this client
+// implementation.
+func BuildInfo() VersionInfo {
+	return VersionInfo{
+		Version:       Version,
+		Commit:        BuildCommit,
+		BuildDate:     BuildDate,
+		GoVersion:     runtime.Version(),
+		ClientVersion: ClientVersion,
+	}
+}
+
+// UserAgent returns the provided product name with the version and build
+// details in a form suitable for User-Agent headers.
+func (vi VersionInfo) UserAgent(product string) string {
+	details := []string{vi.GoVersion}
+	if vi.Commit != "" {
+		details = append([]string{vi.Commit}, details...)
+	}
+	return product + "/" + vi.Version + " (" + strings.Join(details, "; ") + ")"
+}
@@ -0,0 +1,46 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"testing"
+)
+
+func TestVersionInfoUserAgent(t *testing.T) {
+	vi := VersionInfo{
+		Version:   "1.2.3",
+		GoVersion: "go1.12.9",
+	}
+	if ua := vi.UserAgent("kcc-go-fakesoap"); ua != "kcc-go-fakesoap/1.2.3 (go1.12.9)" {
+		t.Errorf("unexpected user agent without commit: %s", ua)
+	}
+
+	vi.Commit = "abc1234"
+	if ua := vi.UserAgent("kcc-go-fakesoap"); ua != "kcc-go-fakesoap/1.2.3 (abc1234; go1.12.9)" {
+		t.Errorf("unexpected user agent with commit: %s", ua)
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	bi := BuildInfo()
+	if bi.Version != Version || bi.ClientVersion != ClientVersion {
+		t.Errorf("unexpected build info: %+v", bi)
+	}
+	if bi.GoVersion == "" {
+		t.Error("build info without Go version")
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// cacheMagic prefixes all encoded cache values.
+const cacheMagic = "KC"
+
+// Kinds of encoded cache values.
+const (
+	cacheKindUser    byte = 1
+	cacheKindFolder  byte = 2
+	cacheKindSession byte = 3
+)
+
+// cacheSchemaVersions holds the current schema version of each kind of cache
+// value. Bump the version of a kind whenever its struct changes incompatibly,
+// so values encoded by other releases are treated as cache misses.
+var cacheSchemaVersions = map[byte]byte{
+	cacheKindUser:    1,
+	cacheKindFolder:  1,
+	cacheKindSession: 1,
+}
+
+// Errors returned when decoding cache values.
+var (
+	ErrCacheSchemaVersion = errors.New("cache value has different schema version")
+	ErrCacheInvalidValue  = errors.New("invalid cache value")
+)
+
+// A SessionState holds the data of a Session needed to restore it with
+// CreateSession, for example from a shared session store.
+type SessionState struct {
+	ID         KCSessionID `json:"id"`
+	ServerGUID string      `json:"serverGUID"`
+	When       time.Time   `json:"when"`
+}
+
+// State returns the SessionState of the accociated Session.
+func (s *Session) State() *SessionState {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return &SessionState{
+		ID:         s.id,
+		ServerGUID: s.serverGUID,
+		When:       s.when,
+	}
+}
+
+func cacheKind(v interface{}) (byte, error) {
+	switch v.(type) {
+	case *User:
+		return cacheKindUser, nil
+	case *Folder:
+		return cacheKindFolder, nil
+	case *SessionState:
+		return cacheKindSession, nil
+	default:
+		return 0, fmt.Errorf("unsupported cache value type %T", v)
+	}
+}
+
+// EncodeCacheValue encodes the provided decoded object for cache layers and
+// session stores, without the cost of XML. Supported are *User, *Folder and
+// *SessionState values. The encoding carries the schema version of the
+// value's kind.
+func EncodeCacheValue(v interface{}) ([]byte, error) {
+	kind, err := cacheKind(v)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 0, len(cacheMagic)+2+len(data))
+	b = append(b, cacheMagic...)
+	b = append(b, kind, cacheSchemaVersions[kind])
+	b = append(b, data...)
+
+	return b, nil
+}
+
+// DecodeCacheValue decodes the provided data as created by EncodeCacheValue
+// into the provided value, which must be of the encoded kind. If the data was
+// encoded with a different schema version, ErrCacheSchemaVersion is returned
+// and callers should treat the value as a cache miss.
+func DecodeCacheValue(data []byte, v interface{}) error {
+	kind, err := cacheKind(v)
+	if err != nil {
+		return err
+	}
+
+	header := len(cacheMagic) + 2
+	if len(data) < header || string(data[:len(cacheMagic)]) != cacheMagic || data[len(cacheMagic)] != kind {
+		return ErrCacheInvalidValue
+	}
+	if data[len(cacheMagic)+1] != cacheSchemaVersions[kind] {
+		return ErrCacheSchemaVersion
+	}
+
+	return json.Unmarshal(data[header:], v)
+}
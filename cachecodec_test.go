@@ -0,0 +1,58 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCacheValueCodec(t *testing.T) {
+	props := PropMap{&PropMapValue{ID: 1, StringValue: "value"}}
+	user := &User{
+		ID:          3,
+		Username:    "user1",
+		MailAddress: "user1@example.com",
+		UserEntryID: "AAAAAKwhqVBA0+5Isxn7p1MwRCUAAAAABgAAAAMAAAAAAAAA",
+		Props:       &props,
+	}
+
+	data, err := EncodeCacheValue(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded User
+	if err = DecodeCacheValue(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(user, &decoded) {
+		t.Errorf("decoded user differs: %+v", decoded)
+	}
+
+	// Other kinds and schema versions are rejected.
+	if err = DecodeCacheValue(data, &Folder{}); err != ErrCacheInvalidValue {
+		t.Errorf("expected invalid value error, got %v", err)
+	}
+	data[len(cacheMagic)+1]++
+	if err = DecodeCacheValue(data, &decoded); err != ErrCacheSchemaVersion {
+		t.Errorf("expected schema version error, got %v", err)
+	}
+
+	if _, err = EncodeCacheValue(&Store{}); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+}
@@ -0,0 +1,249 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Default circuit breaker settings.
+var (
+	DefaultCircuitBreakerThreshold = 5
+	DefaultCircuitBreakerCooldown  = 10 * time.Second
+)
+
+// A CircuitBreakerState is the state of a CircuitBreaker.
+type CircuitBreakerState string
+
+// CircuitBreakerState values.
+const (
+	// CircuitClosed lets all requests pass.
+	CircuitClosed CircuitBreakerState = "closed"
+	// CircuitOpen fails all requests with CircuitOpenError.
+	CircuitOpen CircuitBreakerState = "open"
+	// CircuitHalfOpen lets a single probe request pass, which closes the
+	// circuit when it reaches the backend or opens it again when it fails.
+	CircuitHalfOpen CircuitBreakerState = "half-open"
+)
+
+// A CircuitBreaker stops sending requests to a backend which is unreachable.
+// It opens after Threshold consecutive transport failures and fails all
+// requests immediately with CircuitOpenError for Cooldown, so callers do not
+// pile up waiting for a dead backend. After Cooldown a single probe request is
+// sent, closing the circuit again if it reaches the backend. Responses of the
+// backend, including KC errors, count as success. A CircuitBreaker is safe for
+// concurrent use.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	// OnStateChange is called with the new state whenever the state of the
+	// circuit changes. It must not block.
+	OnStateChange func(state CircuitBreakerState)
+
+	mutex    sync.Mutex
+	state    CircuitBreakerState
+	failures int
+	until    time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker creates a new closed CircuitBreaker which opens after
+// threshold consecutive transport failures for cooldown. Values of 0 select
+// the defaults.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	b := &CircuitBreaker{
+		state: CircuitClosed,
+	}
+	b.SetLimit(threshold, cooldown)
+
+	return b
+}
+
+// SetLimit changes the failure threshold and the cool-down period of the
+// accociated CircuitBreaker. Values of 0 select the defaults.
+func (b *CircuitBreaker) SetLimit(threshold int, cooldown time.Duration) {
+	if threshold <= 0 {
+		threshold = DefaultCircuitBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultCircuitBreakerCooldown
+	}
+
+	b.mutex.Lock()
+	b.Threshold = threshold
+	b.Cooldown = cooldown
+	b.mutex.Unlock()
+}
+
+// State returns the current state of the accociated CircuitBreaker.
+func (b *CircuitBreaker) State() CircuitBreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == CircuitOpen && !time.Now().Before(b.until) {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// allow returns nil if a request may be sent to the backend, or a
+// CircuitOpenError if the circuit is open. The returned bool is true if the
+// request is the probe of a half-open circuit.
+func (b *CircuitBreaker) allow() (bool, error) {
+	b.mutex.Lock()
+	switch b.state {
+	case CircuitClosed:
+		b.mutex.Unlock()
+		return false, nil
+
+	case CircuitOpen:
+		if wait := time.Until(b.until); wait > 0 {
+			b.mutex.Unlock()
+			return false, &CircuitOpenError{RetryAfter: wait}
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		b.mutex.Unlock()
+		b.notify(CircuitHalfOpen)
+		return true, nil
+	}
+
+	if b.probing {
+		// NOTE(longsleep): Another request is probing the backend already.
+		b.mutex.Unlock()
+		return false, &CircuitOpenError{}
+	}
+	b.probing = true
+	b.mutex.Unlock()
+
+	return true, nil
+}
+
+// record records the outcome of a request allowed with allow. If sample is
+// false, the request was canceled and does not change the circuit.
+func (b *CircuitBreaker) record(probe bool, sample bool, failed bool) {
+	b.mutex.Lock()
+	if probe {
+		b.probing = false
+	}
+	if !sample {
+		b.mutex.Unlock()
+		return
+	}
+
+	state := b.state
+	if failed {
+		b.failures++
+		if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= b.Threshold) {
+			b.state = CircuitOpen
+			b.until = time.Now().Add(b.Cooldown)
+		}
+	} else {
+		b.failures = 0
+		b.state = CircuitClosed
+	}
+	changed := b.state != state
+	state = b.state
+	b.mutex.Unlock()
+
+	if changed {
+		b.notify(state)
+	}
+}
+
+// notify calls the OnStateChange function of the accociated CircuitBreaker.
+func (b *CircuitBreaker) notify(state CircuitBreakerState) {
+	if b.OnStateChange != nil {
+		runSafely(func() {
+			b.OnStateChange(state)
+		})
+	}
+}
+
+// A CircuitOpenError is returned for requests which were not sent because the
+// circuit of a CircuitBreaker is open.
+type CircuitOpenError struct {
+	// RetryAfter is the remaining cool-down period, 0 while another request
+	// is probing the backend.
+	RetryAfter time.Duration
+}
+
+func (err *CircuitOpenError) Error() string {
+	if err.RetryAfter > 0 {
+		return fmt.Sprintf("circuit breaker is open, retry after %v", err.RetryAfter.Round(time.Millisecond))
+	}
+	return "circuit breaker is open"
+}
+
+// IsCircuitOpen returns true if the provided error was returned because the
+// circuit of a CircuitBreaker is open.
+func IsCircuitOpen(err error) bool {
+	_, ok := err.(*CircuitOpenError)
+	return ok
+}
+
+// A CircuitBreakerSOAPClient wraps a SOAPClient, failing requests fast with
+// CircuitOpenError while the backend is unreachable.
+type CircuitBreakerSOAPClient struct {
+	Client  SOAPClient
+	Breaker *CircuitBreaker
+}
+
+// NewCircuitBreakerSOAPClient creates a new CircuitBreakerSOAPClient for the
+// provided client using the provided breaker.
+func NewCircuitBreakerSOAPClient(client SOAPClient, breaker *CircuitBreaker) *CircuitBreakerSOAPClient {
+	return &CircuitBreakerSOAPClient{
+		Client:  client,
+		Breaker: breaker,
+	}
+}
+
+// DoRequest sends the provided payload data as SOAP through the means of the
+// accociated client, unless the circuit of the accociated breaker is open.
+// Transport failures, classified as BackendErrorNetwork, count towards opening
+// the circuit. Canceled requests are not counted.
+func (bc *CircuitBreakerSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	probe, err := bc.Breaker.allow()
+	if err != nil {
+		return err
+	}
+
+	err = bc.Client.DoRequest(ctx, payload, v)
+	if err != nil && ctx.Err() != nil {
+		bc.Breaker.record(probe, false, false)
+		return err
+	}
+	failed := false
+	if err != nil {
+		class, _ := ClassifyBackendError(err)
+		failed = class == BackendErrorNetwork
+	}
+	bc.Breaker.record(probe, true, failed)
+
+	return err
+}
+
+func (bc *CircuitBreakerSOAPClient) String() string {
+	return fmt.Sprintf("%s", bc.Client)
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// A failingSOAPClient fails all requests with its error.
+type failingSOAPClient struct {
+	err   error
+	calls int
+}
+
+func (fc *failingSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	fc.calls++
+	return fc.err
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	client := &failingSOAPClient{
+		err: &HTTPStatusError{StatusCode: http.StatusBadGateway},
+	}
+	var states []CircuitBreakerState
+	breaker := NewCircuitBreaker(3, 20*time.Millisecond)
+	breaker.OnStateChange = func(state CircuitBreakerState) {
+		states = append(states, state)
+	}
+	bc := NewCircuitBreakerSOAPClient(client, breaker)
+	ctx := context.Background()
+	payload := ""
+
+	// Opens after threshold consecutive transport failures.
+	for i := 0; i < 5; i++ {
+		bc.DoRequest(ctx, &payload, nil)
+	}
+	if client.calls != 3 {
+		t.Errorf("expected 3 requests to reach the client, got %d", client.calls)
+	}
+	err := bc.DoRequest(ctx, &payload, nil)
+	if !IsCircuitOpen(err) || err.(*CircuitOpenError).RetryAfter <= 0 {
+		t.Fatalf("expected circuit open error with retry after, got %v", err)
+	}
+	if class, _ := ClassifyBackendError(err); class != BackendErrorNetwork {
+		t.Errorf("unexpected class of circuit open error: %v", class)
+	}
+
+	// A failed probe opens it again.
+	time.Sleep(25 * time.Millisecond)
+	if state := breaker.State(); state != CircuitHalfOpen {
+		t.Errorf("expected half-open circuit after cool-down, got %v", state)
+	}
+	bc.DoRequest(ctx, &payload, nil)
+	if client.calls != 4 || breaker.State() != CircuitOpen {
+		t.Errorf("expected single probe to open circuit again, got %d calls in state %v", client.calls, breaker.State())
+	}
+
+	// A successful probe closes it, KC errors count as success.
+	time.Sleep(25 * time.Millisecond)
+	client.err = KCERR_NOT_FOUND
+	if err = bc.DoRequest(ctx, &payload, nil); err != KCERR_NOT_FOUND {
+		t.Errorf("unexpected error of probe: %v", err)
+	}
+	if state := breaker.State(); state != CircuitClosed {
+		t.Errorf("expected closed circuit after successful probe, got %v", state)
+	}
+
+	expected := []CircuitBreakerState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(states) != len(expected) {
+		t.Fatalf("unexpected state changes: %v", states)
+	}
+	for idx, state := range expected {
+		if states[idx] != state {
+			t.Errorf("unexpected state changes: %v", states)
+			break
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+)
+
+// KopanoClient is the public call surface of KCC. Code which talks to Kopano
+// server should depend on KopanoClient rather than on *KCC, so it can be unit
+// tested with the mock implementation found in the mock sub package.
+type KopanoClient interface {
+	// Sessions and users.
+	Logon(ctx context.Context, username, password string, logonFlags KCFlag) (*LogonResponse, error)
+	SSOLogon(ctx context.Context, prefix SSOType, username string, input []byte, sessionID KCSessionID, logonFlags KCFlag) (*LogonResponse, error)
+	LocalAdminLogon(ctx context.Context, logonFlags KCFlag) (*LogonResponse, error)
+	Logoff(ctx context.Context, sessionID KCSessionID) (*LogoffResponse, error)
+	ResolveUsername(ctx context.Context, username string, sessionID KCSessionID) (*ResolveUserResponse, error)
+	GetUser(ctx context.Context, userEntryID string, sessionID KCSessionID) (*GetUserResponse, error)
+	GetUsersByName(ctx context.Context, usernames []string, sessionID KCSessionID) ([]*UserResult, error)
+	ListUsers(ctx context.Context, companyEntryID string, sessionID KCSessionID, cb func(*User) error) error
+	ABResolveNames(ctx context.Context, props []PT, request map[PT]interface{}, requestFlags ABFlag, sessionID KCSessionID, resolveNamesFlags KCFlag) (*ABResolveNamesResponse, error)
+	ABResolveNamesRows(ctx context.Context, props []PT, rows []map[PT]interface{}, requestFlags []ABFlag, sessionID KCSessionID, resolveNamesFlags KCFlag) (*ABResolveNamesResponse, error)
+	ResolveNames(ctx context.Context, names []string, props []PT, sessionID KCSessionID) ([]*ResolveNameResult, error)
+	ResolveNameCandidates(ctx context.Context, results []*ResolveNameResult, limit int, sessionID KCSessionID) error
+	GetCompany(ctx context.Context, companyEntryID string, sessionID KCSessionID) (*GetCompanyResponse, error)
+	GetUserAliases(ctx context.Context, userEntryID string, sessionID KCSessionID) ([]string, error)
+	ResolveAlias(ctx context.Context, address string, sessionID KCSessionID) (*User, error)
+	CheckSendAs(ctx context.Context, username string, address string, sessionID KCSessionID) (*SendAsPermission, error)
+	ResolveRecipients(ctx context.Context, addresses []string, sessionID KCSessionID) ([]*RecipientResult, error)
+
+	// Administration.
+	CreateUser(ctx context.Context, user *User, password string, sessionID KCSessionID) (*CreateUserResponse, error)
+	SetUser(ctx context.Context, user *User, password string, sessionID KCSessionID) (*UserAdminResponse, error)
+	DeleteUser(ctx context.Context, userEntryID string, sessionID KCSessionID) (*UserAdminResponse, error)
+	SetQuota(ctx context.Context, userEntryID string, quota *Quota, sessionID KCSessionID) (*UserAdminResponse, error)
+	ListGroups(ctx context.Context, companyEntryID string, sessionID KCSessionID) (*GetGroupListResponse, error)
+	CreateGroup(ctx context.Context, group *Group, sessionID KCSessionID) (*CreateGroupResponse, error)
+	SetGroup(ctx context.Context, group *Group, sessionID KCSessionID) (*UserAdminResponse, error)
+	DeleteGroup(ctx context.Context, groupEntryID string, sessionID KCSessionID) (*UserAdminResponse, error)
+	ListGroupUsers(ctx context.Context, groupEntryID string, sessionID KCSessionID) (*GetUserListResponse, error)
+	AddGroupUser(ctx context.Context, groupEntryID, userEntryID string, sessionID KCSessionID) (*UserAdminResponse, error)
+	DeleteGroupUser(ctx context.Context, groupEntryID, userEntryID string, sessionID KCSessionID) (*UserAdminResponse, error)
+	SetUserAliases(ctx context.Context, userEntryID string, aliases []string, sessionID KCSessionID) error
+	AddUserAliases(ctx context.Context, userEntryID string, aliases []string, sessionID KCSessionID) error
+	RemoveUserAliases(ctx context.Context, userEntryID string, aliases []string, sessionID KCSessionID) error
+	PurgeSoftDelete(ctx context.Context, days uint64, sessionID KCSessionID) (*PurgeResponse, error)
+	PurgeDeferredUpdates(ctx context.Context, sessionID KCSessionID) (*PurgeDeferredUpdatesResponse, error)
+	PurgeCache(ctx context.Context, flags KCFlag, sessionID KCSessionID) (*PurgeResponse, error)
+
+	// Stores, folders and objects.
+	GetStore(ctx context.Context, storeEntryID string, sessionID KCSessionID) (*GetStoreResponse, error)
+	ResolveUserStore(ctx context.Context, username string, flags KCFlag, sessionID KCSessionID) (*ResolveUserStoreResponse, error)
+	GetReceiveFolder(ctx context.Context, storeEntryID string, messageClass string, sessionID KCSessionID) (*GetReceiveFolderResponse, error)
+	OpenStore(ctx context.Context, storeEntryID string, sessionID KCSessionID) (*Store, error)
+	OpenUserStore(ctx context.Context, username string, sessionID KCSessionID) (*Store, error)
+	DefaultFolderEntryID(ctx context.Context, pt PT, sessionID KCSessionID) (string, error)
+	ListFolders(ctx context.Context, folderEntryID string, sessionID KCSessionID) ([]*Folder, error)
+	GetFolderStats(ctx context.Context, folderEntryID string, sessionID KCSessionID) (*FolderStats, error)
+	GetStoreStats(ctx context.Context, store *Store, sessionID KCSessionID) (*StoreStats, error)
+	LoadObject(ctx context.Context, entryID string, flags KCFlag, sessionID KCSessionID) (*LoadObjectResponse, error)
+	GetProps(ctx context.Context, entryID string, props []PT, sessionID KCSessionID) ([]*PropTagRowSetValue, error)
+	SaveObject(ctx context.Context, parentEntryID string, entryID string, object *SaveObject, flags KCFlag, sessionID KCSessionID) (*LoadObjectResponse, error)
+	SubmitMessage(ctx context.Context, entryID string, flags KCFlag, sessionID KCSessionID) (*SubmitMessageResponse, error)
+	DeleteObjects(ctx context.Context, entryIDs []string, flags KCFlag, sessionID KCSessionID) (*DeleteObjectsResponse, error)
+	GetIDsFromNames(ctx context.Context, names []*NamedProp, flags KCFlag, sessionID KCSessionID) (*GetIDsFromNamesResponse, error)
+	NamedPropTags(ctx context.Context, sessionID KCSessionID, names ...*NamedProp) ([]PT, error)
+
+	// Tables.
+	TableOpen(ctx context.Context, entryID string, tableType TableType, objType MAPIType, flags KCFlag, sessionID KCSessionID) (*TableOpenResponse, error)
+	TableSetColumns(ctx context.Context, tableID uint64, props []PT, sessionID KCSessionID) (*TableResponse, error)
+	TableQueryRows(ctx context.Context, tableID uint64, rowCount uint64, flags KCFlag, sessionID KCSessionID) (*TableQueryRowsResponse, error)
+	TableQueryRowsStream(ctx context.Context, tableID uint64, rowCount uint64, flags KCFlag, sessionID KCSessionID, cb func(*PropTagRowSet) error) (*TableQueryRowsStreamResponse, error)
+	TableClose(ctx context.Context, tableID uint64, sessionID KCSessionID) (*TableResponse, error)
+	QueryTableRows(ctx context.Context, entryID string, tableType TableType, objType MAPIType, flags KCFlag, props []PT, sessionID KCSessionID, cb func([]*PropTagRowSet) error) error
+	QueryTableRowsStream(ctx context.Context, entryID string, tableType TableType, objType MAPIType, flags KCFlag, props []PT, sessionID KCSessionID, cb func(*PropTagRowSet) error) error
+
+	// Incremental change sync.
+	SetSyncStatus(ctx context.Context, folderSourceKey string, syncID, changeID uint64, syncType KCFlag, flags KCFlag, sessionID KCSessionID) (*SetSyncStatusResponse, error)
+	GetChanges(ctx context.Context, folderSourceKey string, syncID, changeID uint64, syncType KCFlag, flags KCFlag, sessionID KCSessionID) (*GetChangesResponse, error)
+	GetEntryIDFromSourceKey(ctx context.Context, storeEntryID string, folderSourceKey string, messageSourceKey string, sessionID KCSessionID) (*GetEntryIDFromSourceKeyResponse, error)
+	SyncContents(ctx context.Context, folderSourceKey string, state *ICSState, sessionID KCSessionID) ([]*ICSChange, *ICSState, error)
+
+	// Items, messages, contacts and calendar.
+	ListItems(ctx context.Context, folderEntryID string, sessionID KCSessionID) ([]*Item, error)
+	SendMessage(ctx context.Context, props []*PropTagRowSetValue, recipients []*Recipient, sessionID KCSessionID) (string, error)
+	CreateMessage(ctx context.Context, folderEntryID string, props []*PropTagRowSetValue, recipients []*Recipient, sessionID KCSessionID) (string, error)
+	ImportMessage(ctx context.Context, folderEntryID string, message *ImportMessage, sessionID KCSessionID) (string, error)
+	ListContacts(ctx context.Context, folderEntryID string, sessionID KCSessionID) ([]*Contact, error)
+	GetContact(ctx context.Context, entryID string, sessionID KCSessionID) (*Contact, error)
+	CreateContact(ctx context.Context, folderEntryID string, contact *Contact, sessionID KCSessionID) (string, error)
+	UpdateContact(ctx context.Context, contact *Contact, sessionID KCSessionID) error
+	DeleteContact(ctx context.Context, entryID string, sessionID KCSessionID) error
+	ListEvents(ctx context.Context, folderEntryID string, sessionID KCSessionID) ([]*Event, error)
+	GetMeetingRequest(ctx context.Context, entryID string, sessionID KCSessionID) (*MeetingRequest, error)
+	RespondToMeetingRequest(ctx context.Context, request *MeetingRequest, response MeetingResponse, body string, sessionID KCSessionID) error
+	AcceptMeetingRequest(ctx context.Context, entryID string, body string, sessionID KCSessionID) error
+	TentativelyAcceptMeetingRequest(ctx context.Context, entryID string, body string, sessionID KCSessionID) error
+	DeclineMeetingRequest(ctx context.Context, entryID string, body string, sessionID KCSessionID) error
+}
+
+// Make sure KCC implements KopanoClient.
+var _ KopanoClient = (*KCC)(nil)
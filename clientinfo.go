@@ -0,0 +1,66 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"strings"
+)
+
+// A ClientInfo describes the end-user client requests are made for, when
+// they are made by a service on behalf of other clients. It is forwarded to
+// the Kopano server on logon, so its session lists show the real client.
+type ClientInfo struct {
+	// RemoteAddr is the IP address of the client. It is sent by HTTP SOAP
+	// clients with the X-Forwarded-For header, which the Kopano server uses
+	// when its proxy_header setting is configured accordingly.
+	RemoteAddr string
+	// UserAgent is the user agent of the client. It is sent as the client
+	// app misc value of logons.
+	UserAgent string
+}
+
+type clientInfoKey struct{}
+
+// WithClientInfo returns a copy of the provided context with the provided
+// ClientInfo. Logons using the returned context forward it to the Kopano
+// server.
+func WithClientInfo(ctx context.Context, info *ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+// ClientInfoFromContext returns the ClientInfo of the provided context, or
+// nil if it has none.
+func ClientInfoFromContext(ctx context.Context) *ClientInfo {
+	if ctx != nil {
+		if info, ok := ctx.Value(clientInfoKey{}).(*ClientInfo); ok {
+			return info
+		}
+	}
+
+	return nil
+}
+
+// writeClientAppMisc writes the szClientAppMisc element with the user agent of
+// the ClientInfo of the provided context, if any.
+func writeClientAppMisc(ctx context.Context, b *strings.Builder) {
+	if info := ClientInfoFromContext(ctx); info != nil && info.UserAgent != "" {
+		b.WriteString("<szClientAppMisc>")
+		b.WriteString(xmlCharData(info.UserAgent).Escape())
+		b.WriteString("</szClientAppMisc>")
+	}
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLogonClientInfo(t *testing.T) {
+	var forwardedFor, payload string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		forwardedFor = req.Header.Get("X-Forwarded-For")
+		payload = string(body)
+		rw.Write([]byte(soapHeader + "<ns:logonResponse><er>0</er><ulSessionId>1</ulSessionId></ns:logonResponse>" + soapFooter))
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewKCCWithClient(client)
+
+	if _, err = c.Logon(context.Background(), "user1", "pass", 0); err != nil {
+		t.Fatal(err)
+	}
+	if forwardedFor != "" || strings.Contains(payload, "szClientAppMisc") {
+		t.Errorf("expected no client info without context, got %q and %s", forwardedFor, payload)
+	}
+
+	ctx := WithClientInfo(context.Background(), &ClientInfo{
+		RemoteAddr: "192.0.2.1",
+		UserAgent:  "Mozilla/5.0 <test>",
+	})
+	if _, err = c.Logon(ctx, "user1", "pass", 0); err != nil {
+		t.Fatal(err)
+	}
+	if forwardedFor != "192.0.2.1" {
+		t.Errorf("expected X-Forwarded-For 192.0.2.1, got %q", forwardedFor)
+	}
+	if !strings.Contains(payload, "<szClientAppMisc>Mozilla/5.0 &lt;test&gt;</szClientAppMisc>") {
+		t.Errorf("expected user agent in logon payload, got %s", payload)
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+const archiveIndexVersion = 1
+
+// An archive is the on disk backup of a single user. It consists of an index
+// file and a directory of content addressed blobs holding the exported
+// messages.
+type archive struct {
+	path  string
+	index *archiveIndex
+}
+
+type archiveIndex struct {
+	Version  int                        `json:"version"`
+	User     string                     `json:"user"`
+	Updated  time.Time                  `json:"updated"`
+	Folders  map[string]*archiveFolder  `json:"folders"`
+	Messages map[string]*archiveMessage `json:"messages"`
+}
+
+type archiveFolder struct {
+	Path  string        `json:"path"`
+	State *kcc.ICSState `json:"state,omitempty"`
+}
+
+type archiveMessage struct {
+	Folder   string `json:"folder"`
+	EntryID  string `json:"entryID"`
+	ChangeID uint64 `json:"changeID"`
+	Blob     string `json:"blob"`
+}
+
+// openArchive opens the archive of the provided user below the provided
+// directory, creating it if it does not exist.
+func openArchive(dir string, user string) (*archive, error) {
+	a := &archive{
+		path: filepath.Join(dir, user),
+	}
+
+	if err := os.MkdirAll(filepath.Join(a.path, "blobs"), 0700); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(a.path, "index.json"))
+	switch {
+	case os.IsNotExist(err):
+		a.index = &archiveIndex{
+			Version:  archiveIndexVersion,
+			User:     user,
+			Folders:  make(map[string]*archiveFolder),
+			Messages: make(map[string]*archiveMessage),
+		}
+		return a, nil
+	case err != nil:
+		return nil, err
+	}
+
+	a.index = &archiveIndex{}
+	if err = json.Unmarshal(data, a.index); err != nil {
+		return nil, fmt.Errorf("invalid archive index: %v", err)
+	}
+	if a.index.Version != archiveIndexVersion {
+		return nil, fmt.Errorf("unsupported archive index version: %d", a.index.Version)
+	}
+
+	return a, nil
+}
+
+// writeBlob writes the provided data as blob, returning its name. Blobs are
+// named by the hash of their content, so existing blobs are not written again.
+func (a *archive) writeBlob(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:])
+	fn := filepath.Join(a.path, "blobs", name[:2], name+".json")
+
+	if _, err := os.Stat(fn); err == nil {
+		return name, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(fn), 0700); err != nil {
+		return "", err
+	}
+
+	return name, writeFileAtomic(fn, data)
+}
+
+// save writes the index of the accociated archive.
+func (a *archive) save() error {
+	a.index.Updated = time.Now()
+	data, err := json.MarshalIndent(a.index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(a.path, "index.json"), data)
+}
+
+// writeFileAtomic writes the provided data to a temporary file which is then
+// renamed to the provided name, so readers never see partial files.
+func writeFileAtomic(fn string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(fn), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), fn)
+}
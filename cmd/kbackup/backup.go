@@ -0,0 +1,186 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// saveInterval is the number of exported messages after which the index is
+// saved while a folder is processed, limiting the work lost on interruption.
+const saveInterval = 100
+
+type backup struct {
+	c         *kcc.KCC
+	sessionID kcc.KCSessionID
+	archive   *archive
+
+	store    *kcc.Store
+	exported uint64
+	deleted  uint64
+}
+
+func (b *backup) run(ctx context.Context) error {
+	store, err := b.c.OpenUserStore(ctx, b.archive.index.User, b.sessionID)
+	if err != nil {
+		return err
+	}
+	b.store = store
+
+	folders, err := b.c.ListFolders(ctx, store.RootEntryID, b.sessionID)
+	if err != nil {
+		return err
+	}
+
+	// Forget folders which no longer exist, together with their messages.
+	existing := make(map[string]bool)
+	for _, folder := range folders {
+		existing[folder.SourceKey] = true
+	}
+	for sourceKey := range b.archive.index.Folders {
+		if !existing[sourceKey] {
+			b.removeFolder(sourceKey)
+		}
+	}
+
+	for _, folder := range folders {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		if err = b.syncFolder(ctx, folder); err != nil {
+			break
+		}
+	}
+
+	if saveErr := b.archive.save(); err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+func (b *backup) removeFolder(sourceKey string) {
+	delete(b.archive.index.Folders, sourceKey)
+	for messageSourceKey, message := range b.archive.index.Messages {
+		if message.Folder == sourceKey {
+			delete(b.archive.index.Messages, messageSourceKey)
+			b.deleted++
+		}
+	}
+}
+
+func (b *backup) syncFolder(ctx context.Context, folder *kcc.Folder) error {
+	index := b.archive.index
+	archived, ok := index.Folders[folder.SourceKey]
+	if !ok {
+		archived = &archiveFolder{}
+		index.Folders[folder.SourceKey] = archived
+	}
+	archived.Path = folder.Path
+
+	changes, state, err := b.c.SyncContents(ctx, folder.SourceKey, archived.State, b.sessionID)
+	if err != nil {
+		return fmt.Errorf("sync of folder %s failed: %v", folder.Path, err)
+	}
+
+	count := 0
+	for _, change := range changes {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if change.ChangeType&(kcc.ICS_HARD_DELETE|kcc.ICS_SOFT_DELETE) != 0 {
+			if _, ok := index.Messages[change.SourceKey]; ok {
+				delete(index.Messages, change.SourceKey)
+				b.deleted++
+			}
+			continue
+		}
+
+		// Skip changes which were already exported by an interrupted run.
+		if message, ok := index.Messages[change.SourceKey]; ok && message.ChangeID >= change.ChangeID {
+			continue
+		}
+
+		message, err := b.exportMessage(ctx, folder, change)
+		if err != nil {
+			return err
+		}
+		if message == nil {
+			// Gone in the meantime.
+			continue
+		}
+		index.Messages[change.SourceKey] = message
+		b.exported++
+
+		count++
+		if count%saveInterval == 0 {
+			if err = b.archive.save(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Only advance the folder state once all its changes are archived.
+	archived.State = state
+	return b.archive.save()
+}
+
+func (b *backup) exportMessage(ctx context.Context, folder *kcc.Folder, change *kcc.ICSChange) (*archiveMessage, error) {
+	resolved, err := b.c.GetEntryIDFromSourceKey(ctx, b.store.EntryID, folder.SourceKey, change.SourceKey, b.sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("getEntryIDFromSourceKey failed: %v", err)
+	}
+	switch resolved.Er {
+	case kcc.KCSuccess:
+	case kcc.KCERR_NOT_FOUND:
+		return nil, nil
+	default:
+		return nil, resolved.Er
+	}
+
+	loaded, err := b.c.LoadObject(ctx, resolved.EntryID, 0, b.sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("loadObject failed: %v", err)
+	}
+	switch loaded.Er {
+	case kcc.KCSuccess:
+	case kcc.KCERR_NOT_FOUND:
+		return nil, nil
+	default:
+		return nil, loaded.Er
+	}
+
+	data, err := json.Marshal(loaded.Object)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := b.archive.writeBlob(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &archiveMessage{
+		Folder:   folder.SourceKey,
+		EntryID:  resolved.EntryID,
+		ChangeID: change.ChangeID,
+		Blob:     blob,
+	}, nil
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"stash.kopano.io/kgol/kcc-go"
+	"stash.kopano.io/kgol/kcc-go/cmd"
+)
+
+func main() {
+	cmd.RootCmd.Use = "kbackup"
+	cmd.RootCmd.AddCommand(commandRun())
+
+	if err := cmd.RootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func commandRun() *cobra.Command {
+	runCmd := &cobra.Command{
+		Use:   "run username [...username]",
+		Short: "Incrementally export the stores of the given users",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := run(cmd, args); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	runCmd.Flags().String("out", "", "Directory where the per user archives are written")
+
+	return runCmd
+}
+
+func run(cmd *cobra.Command, args []string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	out, _ := cmd.Flags().GetString("out")
+	if out == "" {
+		return fmt.Errorf("out is required")
+	}
+
+	username := "SYSTEM"
+	password := ""
+	if usernameOverride := os.Getenv("KOPANO_USERNAME"); usernameOverride != "" {
+		username = usernameOverride
+	}
+	if passwordOverride := os.Getenv("KOPANO_PASSWORD"); passwordOverride != "" {
+		password = passwordOverride
+	}
+
+	// Stop cleanly on signal, archives stay resumable.
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signalCh
+		fmt.Println("Received signal, stopping")
+		cancel()
+	}()
+
+	// Back off when the server is busy, to not overwhelm it with bulk requests.
+	client, err := kcc.NewSOAPClient(nil)
+	if err != nil {
+		return err
+	}
+	c := kcc.NewKCCWithClient(kcc.NewThrottledSOAPClient(client, nil))
+	c.SetClientApp("kcc-go-kbackup", kcc.Version)
+
+	session, err := kcc.NewSession(ctx, c, username, password)
+	if err != nil {
+		return err
+	}
+	defer session.Destroy(context.Background(), true)
+
+	for _, user := range args {
+		fmt.Printf("Backup of %s\n", user)
+
+		a, err := openArchive(out, user)
+		if err != nil {
+			return err
+		}
+
+		b := &backup{
+			c:         c,
+			sessionID: session.ID(),
+			archive:   a,
+		}
+		if err = b.run(kcc.WithPriority(ctx, kcc.PriorityBatch)); err != nil {
+			return fmt.Errorf("backup of %s failed: %v", user, err)
+		}
+
+		fmt.Printf("Backup of %s complete: %d new or changed, %d deleted, %d messages total\n", user, b.exported, b.deleted, len(a.index.Messages))
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"stash.kopano.io/kgol/kcc-go"
+	"stash.kopano.io/kgol/kcc-go/cmd"
+)
+
+func main() {
+	cmd.RootCmd.Use = "kdiskusage"
+	cmd.RootCmd.AddCommand(commandReport())
+
+	if err := cmd.RootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+func commandReport() *cobra.Command {
+	reportCmd := &cobra.Command{
+		Use:   "report [username]",
+		Short: "Report store size, folder statistics and message classes",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := report(cmd, args); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	reportCmd.Flags().Bool("json", false, "Output report as JSON")
+
+	return reportCmd
+}
+
+func report(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	username := "SYSTEM"
+	password := ""
+	if usernameOverride := os.Getenv("KOPANO_USERNAME"); usernameOverride != "" {
+		username = usernameOverride
+	}
+	if passwordOverride := os.Getenv("KOPANO_PASSWORD"); passwordOverride != "" {
+		password = passwordOverride
+	}
+
+	// Back off when the server is busy, to not overwhelm it with bulk requests.
+	client, err := kcc.NewSOAPClient(nil)
+	if err != nil {
+		return err
+	}
+	c := kcc.NewKCCWithClient(kcc.NewThrottledSOAPClient(client, nil))
+	c.SetClientApp("kcc-go-kdiskusage", kcc.Version)
+
+	session, err := kcc.NewSession(ctx, c, username, password)
+	if err != nil {
+		return err
+	}
+	defer session.Destroy(ctx, true)
+
+	var store *kcc.Store
+	if len(args) > 0 {
+		store, err = c.OpenUserStore(ctx, args[0], session.ID())
+	} else {
+		store, err = c.OpenStore(ctx, "", session.ID())
+	}
+	if err != nil {
+		return err
+	}
+
+	stats, err := c.GetStoreStats(ctx, store, session.ID())
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "Store size\t%s\t\n", formatSize(stats.Size))
+	fmt.Fprintf(w, "Messages\t%d\t\n", stats.Count)
+	fmt.Fprintln(w, "\t\t")
+
+	fmt.Fprintln(w, "Items\tSize\t Folder")
+	for _, folder := range stats.Folders {
+		fmt.Fprintf(w, "%d\t%s\t %s\n", folder.Count, formatSize(folder.Size), folder.Path)
+	}
+	fmt.Fprintln(w, "\t\t")
+
+	messageClasses := make([]string, 0, len(stats.MessageClasses))
+	for messageClass := range stats.MessageClasses {
+		messageClasses = append(messageClasses, messageClass)
+	}
+	sort.SliceStable(messageClasses, func(i, j int) bool {
+		a := stats.MessageClasses[messageClasses[i]]
+		b := stats.MessageClasses[messageClasses[j]]
+		if a == b {
+			return messageClasses[i] < messageClasses[j]
+		}
+		return a > b
+	})
+
+	fmt.Fprintln(w, "Items\t\t Message class")
+	for _, messageClass := range messageClasses {
+		fmt.Fprintf(w, "%d\t\t %s\n", stats.MessageClasses[messageClass], messageClass)
+	}
+
+	return w.Flush()
+}
+
+func formatSize(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
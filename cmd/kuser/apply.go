@@ -0,0 +1,127 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"stash.kopano.io/kgol/kcc-go/reconcile"
+)
+
+func commandApply() *cobra.Command {
+	applyCmd := &cobra.Command{
+		Use:   "apply state.json",
+		Short: "Apply a desired state of users and groups",
+		Long: `Create, update and with --prune delete users, groups and group memberships
+so they match the desired state read from the provided JSON file, - for
+stdin. With --dry-run the planned operations are only shown and the command
+exits with 1 if there are any. Exits with 2 on errors.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pending, err := apply(cmd, args)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(2)
+			}
+			if pending {
+				os.Exit(1)
+			}
+		},
+	}
+	applyCmd.Flags().Bool("dry-run", false, "Only show the planned operations")
+	applyCmd.Flags().Bool("prune", false, "Delete users and groups which are not in the state")
+	applyCmd.Flags().Int("batch-size", reconcile.DefaultBatchSize, "Number of operations applied concurrently")
+	applyCmd.Flags().Bool("continue-on-error", false, "Continue with the remaining operations when an operation fails")
+	applyCmd.Flags().String("company", "", "Entry ID of the company in multi-tenant setups")
+	applyCmd.Flags().Bool("json", false, "Output the planned operations as JSON")
+
+	return applyCmd
+}
+
+func apply(cmd *cobra.Command, args []string) (bool, error) {
+	ctx := context.Background()
+
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	state, err := reconcile.ReadState(args[0])
+	if err != nil {
+		return false, err
+	}
+
+	c, session, err := logon(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer session.Destroy(ctx, true)
+
+	r := reconcile.New(c, session.ID())
+	r.Prune, _ = cmd.Flags().GetBool("prune")
+	r.BatchSize, _ = cmd.Flags().GetInt("batch-size")
+	r.ContinueOnError, _ = cmd.Flags().GetBool("continue-on-error")
+	r.CompanyEntryID, _ = cmd.Flags().GetString("company")
+	r.DryRun = dryRun
+
+	plan, err := r.Plan(ctx, state)
+	if err != nil {
+		return false, err
+	}
+
+	if asJSON {
+		if plan.Operations == nil {
+			plan.Operations = []*reconcile.Operation{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(plan); err != nil {
+			return false, err
+		}
+	} else {
+		r.Progress = func(done, total int, result *reconcile.Result) {
+			status := "ok"
+			switch {
+			case result.Err != nil:
+				status = fmt.Sprintf("failed: %v", result.Err)
+			case dryRun:
+				status = "planned"
+			}
+			fmt.Printf("[%d/%d] %s %s\n", done, total, result.Operation, status)
+			for _, d := range result.Operation.Diffs {
+				fmt.Printf("\t%s\n", d)
+			}
+		}
+	}
+
+	if dryRun {
+		if !asJSON {
+			// Report the plan in order, a dry run applies nothing.
+			r.BatchSize = 1
+			if _, err = r.Apply(ctx, plan); err != nil {
+				return false, err
+			}
+		}
+		return !plan.Empty(), nil
+	}
+
+	_, err = r.Apply(ctx, plan)
+	return false, err
+}
@@ -0,0 +1,185 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"stash.kopano.io/kgol/kcc-go"
+	"stash.kopano.io/kgol/kcc-go/cmd"
+)
+
+func main() {
+	cmd.RootCmd.Use = "kuser"
+	cmd.RootCmd.AddCommand(commandDiff())
+	cmd.RootCmd.AddCommand(commandApply())
+
+	if err := cmd.RootCmd.Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+}
+
+func commandDiff() *cobra.Command {
+	diffCmd := &cobra.Command{
+		Use:   "diff username [other-username]",
+		Short: "Show the differences of user details",
+		Long: `Show the differences of the details of two users, of a user and a JSON
+spec with the expected details, or of a user fetched twice with --wait in
+between. Exits with 1 if there are differences and with 2 on errors.`,
+		Args: cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			differ, err := diff(cmd, args)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(2)
+			}
+			if differ {
+				os.Exit(1)
+			}
+		},
+	}
+	diffCmd.Flags().String("spec", "", "JSON file with the expected user details, - for stdin")
+	diffCmd.Flags().Duration("wait", 0, "Fetch the user again after this duration and compare both")
+	diffCmd.Flags().Bool("json", false, "Output differences as JSON")
+
+	return diffCmd
+}
+
+func diff(cmd *cobra.Command, args []string) (bool, error) {
+	ctx := context.Background()
+
+	specFile, _ := cmd.Flags().GetString("spec")
+	wait, _ := cmd.Flags().GetDuration("wait")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	modes := 0
+	if len(args) > 1 {
+		modes++
+	}
+	if specFile != "" {
+		modes++
+	}
+	if wait > 0 {
+		modes++
+	}
+	if modes != 1 {
+		return false, fmt.Errorf("compare with either another username, --spec or --wait")
+	}
+
+	var spec *userSpec
+	if specFile != "" {
+		var err error
+		if spec, err = readUserSpec(specFile); err != nil {
+			return false, err
+		}
+	}
+
+	c, session, err := logon(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer session.Destroy(ctx, true)
+
+	user, err := getUser(ctx, c, args[0], session.ID())
+	if err != nil {
+		return false, err
+	}
+
+	var diffs []*kcc.UserDiff
+	switch {
+	case spec != nil:
+		diffs = spec.filter(kcc.DiffUsers(spec.user, user))
+	case wait > 0:
+		time.Sleep(wait)
+		again, againErr := getUser(ctx, c, args[0], session.ID())
+		if againErr != nil {
+			return false, againErr
+		}
+		diffs = kcc.DiffUsers(user, again)
+	default:
+		other, otherErr := getUser(ctx, c, args[1], session.ID())
+		if otherErr != nil {
+			return false, otherErr
+		}
+		diffs = kcc.DiffUsers(user, other)
+	}
+
+	if asJSON {
+		if diffs == nil {
+			diffs = []*kcc.UserDiff{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return len(diffs) > 0, enc.Encode(diffs)
+	}
+
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	return len(diffs) > 0, nil
+}
+
+// logon creates a session for SYSTEM, or the user and password set with the
+// KOPANO_USERNAME and KOPANO_PASSWORD environment variables.
+func logon(ctx context.Context) (*kcc.KCC, *kcc.Session, error) {
+	username := "SYSTEM"
+	password := ""
+	if usernameOverride := os.Getenv("KOPANO_USERNAME"); usernameOverride != "" {
+		username = usernameOverride
+	}
+	if passwordOverride := os.Getenv("KOPANO_PASSWORD"); passwordOverride != "" {
+		password = passwordOverride
+	}
+
+	c := kcc.NewKCC(nil)
+	c.SetClientApp("kcc-go-kuser", kcc.Version)
+
+	session, err := kcc.NewSession(ctx, c, username, password)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c, session, nil
+}
+
+// getUser fetches the details of the user with the provided username.
+func getUser(ctx context.Context, c *kcc.KCC, username string, sessionID kcc.KCSessionID) (*kcc.User, error) {
+	resolveResp, err := c.ResolveUsername(ctx, username, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("resolve user %s failed: %v", username, err)
+	}
+	if resolveResp.Er != kcc.KCSuccess {
+		return nil, fmt.Errorf("resolve user %s mapi error: %v", username, resolveResp.Er)
+	}
+
+	userResp, err := c.GetUser(ctx, resolveResp.UserEntryID, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("get user %s failed: %v", username, err)
+	}
+	if userResp.Er != kcc.KCSuccess {
+		return nil, fmt.Errorf("get user %s mapi error: %v", username, userResp.Er)
+	}
+
+	return userResp.User, nil
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// A userSpec holds the expected details of a user, as JSON like the details
+// of a kcc.User. Only the fields and properties set in the JSON are compared.
+type userSpec struct {
+	user   *kcc.User
+	fields map[string]bool
+}
+
+// readUserSpec reads a userSpec from the file with the provided name, or
+// from stdin if the name is "-".
+func readUserSpec(name string) (*userSpec, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec: %v", err)
+	}
+
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse spec: %v", err)
+	}
+	spec := &userSpec{
+		user:   &kcc.User{},
+		fields: make(map[string]bool),
+	}
+	if err = json.Unmarshal(data, spec.user); err != nil {
+		return nil, fmt.Errorf("failed to parse spec: %v", err)
+	}
+	for field := range fields {
+		spec.fields[field] = true
+	}
+
+	return spec, nil
+}
+
+// filter returns the provided differences from the accociated spec, which
+// are of fields or properties set in the spec.
+func (spec *userSpec) filter(diffs []*kcc.UserDiff) []*kcc.UserDiff {
+	var filtered []*kcc.UserDiff
+	for _, d := range diffs {
+		if !spec.fields[d.Field] {
+			continue
+		}
+		if d.PropID != 0 && d.From == nil {
+			// Property not set in spec.
+			continue
+		}
+		filtered = append(filtered, d)
+	}
+
+	return filtered
+}
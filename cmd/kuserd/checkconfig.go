@@ -0,0 +1,691 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"stash.kopano.io/kgol/kcc-go"
+	"stash.kopano.io/kgol/kcc-go/userdsrv"
+)
+
+// Exit codes of the check-config command.
+const (
+	checkExitOK      = 0
+	checkExitError   = 1
+	checkExitWarning = 2
+)
+
+// Status values of configuration checks, ordered by severity.
+const (
+	checkStatusOK      = "ok"
+	checkStatusSkipped = "skipped"
+	checkStatusWarning = "warning"
+	checkStatusError   = "error"
+)
+
+// Secrets shorter than this are reported as weak.
+const checkMinSecretLength = 32
+
+// Certificates expiring within this duration are reported with a warning.
+const checkCertificateExpiryWarning = 30 * 24 * time.Hour
+
+type checkResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+type checkReport struct {
+	Status string         `json:"status"`
+	Checks []*checkResult `json:"checks"`
+}
+
+func (r *checkReport) add(name, status, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, &checkResult{
+		Name:    name,
+		Status:  status,
+		Message: fmt.Sprintf(format, args...),
+	})
+	if checkSeverity(status) > checkSeverity(r.Status) {
+		r.Status = status
+	}
+}
+
+func checkSeverity(status string) int {
+	switch status {
+	case checkStatusError:
+		return 2
+	case checkStatusWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func commandCheckConfig() *cobra.Command {
+	checkCmd := &cobra.Command{
+		Use:   "check-config [...args]",
+		Short: "Validate server configuration and backend connectivity",
+		Long: `Validate the configuration given by the serve flags and environment,
+including backend reachability, TLS material and endpoint authentication
+settings. Exits with 0 when all checks pass, 1 when a check failed and 2 when
+a check raised a warning and --fail-on-warning is set.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			code, err := checkConfig(cmd, args)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(checkExitError)
+			}
+			os.Exit(code)
+		},
+	}
+	setServeFlags(checkCmd)
+	checkCmd.Flags().String("format", "text", "Output format of the report (text or json)")
+	checkCmd.Flags().Duration("timeout", 10*time.Second, "Maximum duration of backend checks")
+	checkCmd.Flags().Bool("skip-logon", false, "Skip logon to the Kopano server with the configured credentials")
+	checkCmd.Flags().Bool("fail-on-warning", false, "Exit with non-zero status when a check raised a warning")
+
+	return checkCmd
+}
+
+func checkConfig(cmd *cobra.Command, args []string) (int, error) {
+	format, _ := cmd.Flags().GetString("format")
+	if format != "text" && format != "json" {
+		return checkExitError, fmt.Errorf("unsupported format: %v", format)
+	}
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	report := &checkReport{
+		Status: checkStatusOK,
+	}
+
+	checkListen(cmd, report)
+	serverURI := checkServerURI(cmd, report)
+	tlsConfig := checkTLS(cmd, report, serverURI)
+	checkSocketOwner(cmd, report, serverURI)
+	reachable := checkBackend(report, serverURI, timeout)
+	if skipLogon, _ := cmd.Flags().GetBool("skip-logon"); skipLogon {
+		report.add("credentials", checkStatusSkipped, "logon skipped")
+	} else {
+		checkCredentials(report, serverURI, tlsConfig, reachable, timeout)
+	}
+	checkBackendLimits(cmd, report)
+	checkFDBudget(cmd, report)
+	checkRuntime(cmd, report)
+	checkSLO(cmd, report)
+	checkUserCache(cmd, report)
+	checkAdminAPI(cmd, report)
+	checkPortal(cmd, report)
+	checkCalendar(cmd, report)
+	checkSPA(cmd, report)
+	checkLegacyAPISunset(cmd, report)
+	checkStateDump(cmd, report)
+	checkTrustedProxies(cmd, report)
+	checkFeatures(cmd, report)
+	checkConsul(cmd, report, timeout)
+
+	if err := writeCheckReport(os.Stdout, format, report); err != nil {
+		return checkExitError, err
+	}
+
+	switch report.Status {
+	case checkStatusError:
+		return checkExitError, nil
+	case checkStatusWarning:
+		if failOnWarning, _ := cmd.Flags().GetBool("fail-on-warning"); failOnWarning {
+			return checkExitWarning, nil
+		}
+	}
+	return checkExitOK, nil
+}
+
+func writeCheckReport(w io.Writer, format string, report *checkReport) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, result := range report.Checks {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", result.Status, result.Name, result.Message)
+	}
+	fmt.Fprintf(tw, "\nresult: %s\n", report.Status)
+	return tw.Flush()
+}
+
+func checkListen(cmd *cobra.Command, report *checkReport) {
+	listenAddr, _ := cmd.Flags().GetString("listen")
+	if _, err := net.ResolveTCPAddr("tcp", listenAddr); err != nil {
+		report.add("listen", checkStatusError, "invalid listen address: %v", err)
+		return
+	}
+	report.add("listen", checkStatusOK, "%s", listenAddr)
+}
+
+// checkServerURI returns the Kopano server URI used by the server, or nil if
+// it is invalid.
+func checkServerURI(cmd *cobra.Command, report *checkReport) *url.URL {
+	serverURIString, _ := cmd.Flags().GetString("server-uri")
+	source := "server-uri"
+	if serverURIString == "" {
+		serverURIString = kcc.DefaultURI
+		source = "default"
+	}
+
+	serverURI, err := url.Parse(serverURIString)
+	if err != nil {
+		report.add("server-uri", checkStatusError, "invalid %s: %v", source, err)
+		return nil
+	}
+	switch serverURI.Scheme {
+	case "https", "http", "http+unix", "file", "npipe", "tcp":
+	default:
+		report.add("server-uri", checkStatusError, "unsupported %s scheme: %v", source, serverURI.Scheme)
+		return nil
+	}
+
+	report.add("server-uri", checkStatusOK, "%s (%s)", serverURI, source)
+	return serverURI
+}
+
+// checkTLS validates the TLS settings of the provided server URI and returns
+// the TLS client configuration to be used when connecting.
+func checkTLS(cmd *cobra.Command, report *checkReport, serverURI *url.URL) *tls.Config {
+	serverAuthPEM, _ := cmd.Flags().GetString("server-auth-pem")
+	serverCAFile, _ := cmd.Flags().GetString("server-ca-file")
+	if serverURI == nil {
+		report.add("tls", checkStatusSkipped, "no valid server-uri")
+		return nil
+	}
+	if serverURI.Scheme != "https" {
+		if serverAuthPEM != "" {
+			report.add("tls", checkStatusError, "server-auth-pem requires a https:// server-uri")
+		} else if serverCAFile != "" {
+			report.add("tls", checkStatusError, "server-ca-file requires a https:// server-uri")
+		} else {
+			report.add("tls", checkStatusSkipped, "server-uri is not https://")
+		}
+		return nil
+	}
+
+	tlsSessionCacheSize, _ := cmd.Flags().GetInt("tls-session-cache-size")
+	tlsConfig := kcc.SetTLSSessionCacheToTLSConfig(tlsSessionCacheSize, nil)
+	status := checkStatusOK
+	message := "TLS enabled"
+	if tlsSessionCacheSize <= 0 {
+		message = "TLS enabled, session resumption disabled"
+	}
+	if tlsInsecureSkipVerify, _ := cmd.Flags().GetBool("insecure"); tlsInsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+		status = checkStatusWarning
+		message = "insecure mode, certificate and hostname validation disabled"
+	}
+	report.add("tls", status, "%s", message)
+
+	if serverCAFile != "" {
+		if _, err := kcc.SetRootCAsToTLSConfig(serverCAFile, tlsConfig); err != nil {
+			report.add("server-ca-file", checkStatusError, "failed to load %s: %v", serverCAFile, err)
+		} else {
+			report.add("server-ca-file", checkStatusOK, "%d CA certificates loaded", len(tlsConfig.RootCAs.Subjects()))
+		}
+	}
+
+	if serverAuthPEM == "" {
+		return tlsConfig
+	}
+	if _, err := kcc.SetX509KeyPairToTLSConfig(serverAuthPEM, serverAuthPEM, tlsConfig); err != nil {
+		report.add("server-auth-pem", checkStatusError, "failed to load %s: %v", serverAuthPEM, err)
+		return tlsConfig
+	}
+	leaf, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+	if err != nil {
+		report.add("server-auth-pem", checkStatusError, "failed to parse certificate: %v", err)
+		return tlsConfig
+	}
+	now := time.Now()
+	switch {
+	case now.Before(leaf.NotBefore):
+		report.add("server-auth-pem", checkStatusError, "certificate %q not valid before %s", leaf.Subject.CommonName, leaf.NotBefore.Format(time.RFC3339))
+	case now.After(leaf.NotAfter):
+		report.add("server-auth-pem", checkStatusError, "certificate %q expired %s", leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339))
+	case now.Add(checkCertificateExpiryWarning).After(leaf.NotAfter):
+		report.add("server-auth-pem", checkStatusWarning, "certificate %q expires %s", leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339))
+	default:
+		report.add("server-auth-pem", checkStatusOK, "certificate %q valid until %s", leaf.Subject.CommonName, leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	return tlsConfig
+}
+
+func checkSocketOwner(cmd *cobra.Command, report *checkReport, serverURI *url.URL) {
+	serverSocketOwner, _ := cmd.Flags().GetString("server-socket-owner")
+	if serverSocketOwner == "" {
+		report.add("server-socket-owner", checkStatusSkipped, "socket owner not checked")
+		return
+	}
+	if serverURI == nil || (serverURI.Scheme != "file" && serverURI.Scheme != "http+unix") {
+		report.add("server-socket-owner", checkStatusWarning, "server-socket-owner is set but server-uri is not file:// or http+unix://")
+		return
+	}
+	if !kcc.SocketPeerCredentialsSupported {
+		report.add("server-socket-owner", checkStatusError, "server-socket-owner is not supported on %s", runtime.GOOS)
+		return
+	}
+
+	owner, err := parseSocketPeerOwner(serverSocketOwner)
+	if err != nil {
+		report.add("server-socket-owner", checkStatusError, "invalid server-socket-owner: %v", err)
+		return
+	}
+	kcc.DefaultSocketPeerOwner = owner
+	report.add("server-socket-owner", checkStatusOK, "uid %d gid %d", owner.UID, owner.GID)
+}
+
+// checkBackend returns true if a connection to the provided server URI can
+// be established.
+func checkBackend(report *checkReport, serverURI *url.URL, timeout time.Duration) bool {
+	if serverURI == nil {
+		report.add("backend", checkStatusSkipped, "no valid server-uri")
+		return false
+	}
+
+	network, address := "tcp", serverURI.Host
+	switch serverURI.Scheme {
+	case "npipe":
+		// NOTE(longsleep): Named pipes cannot be dialed with net, the
+		// credentials check connects to them.
+		report.add("backend", checkStatusSkipped, "named pipe is checked with credentials")
+		return true
+	case "file", "http+unix":
+		network, address = "unix", serverURI.Path
+	case "https":
+		if serverURI.Port() == "" {
+			address = net.JoinHostPort(serverURI.Hostname(), "443")
+		}
+	case "http":
+		if serverURI.Port() == "" {
+			address = net.JoinHostPort(serverURI.Hostname(), "80")
+		}
+	case "tcp":
+		if serverURI.Port() == "" {
+			address = net.JoinHostPort(serverURI.Hostname(), kcc.DefaultTCPPort)
+		}
+	}
+
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		report.add("backend", checkStatusError, "failed to connect: %v", err)
+		return false
+	}
+	conn.Close()
+
+	report.add("backend", checkStatusOK, "%s %s reachable", network, address)
+	return true
+}
+
+// checkCredentials logs on to the Kopano server with the credentials from the
+// environment, the same way the server does on start.
+func checkCredentials(report *checkReport, serverURI *url.URL, tlsConfig *tls.Config, reachable bool, timeout time.Duration) {
+	username := "SYSTEM"
+	password := ""
+	if usernameOverride := os.Getenv("KOPANO_USERNAME"); usernameOverride != "" {
+		username = usernameOverride
+	}
+	if passwordOverride := os.Getenv("KOPANO_PASSWORD"); passwordOverride != "" {
+		password = passwordOverride
+	}
+
+	if !reachable {
+		report.add("credentials", checkStatusSkipped, "backend not reachable")
+		return
+	}
+
+	if tlsConfig != nil {
+		kcc.DefaultHTTPClient.Transport.(*http.Transport).TLSClientConfig = tlsConfig
+	}
+	c := kcc.NewKCC(serverURI)
+	c.SetClientApp("kcc-go-kuserd", kcc.Version)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	response, err := c.Logon(ctx, username, password, kcc.KOPANO_LOGON_NO_REGISTER_SESSION)
+	if err != nil {
+		report.add("credentials", checkStatusError, "logon as %s failed: %v", username, err)
+		return
+	}
+	if response.Er != kcc.KCSuccess {
+		report.add("credentials", checkStatusError, "logon as %s failed: %v", username, response.Er)
+		return
+	}
+	if _, err := c.Logoff(ctx, response.SessionID); err != nil {
+		report.add("credentials", checkStatusWarning, "logoff after logon as %s failed: %v", username, err)
+		return
+	}
+
+	report.add("credentials", checkStatusOK, "logon as %s succeeded (server %s)", username, response.ServerGUID)
+}
+
+func checkBackendLimits(cmd *cobra.Command, report *checkReport) {
+	backendRateLimit, _ := cmd.Flags().GetFloat64("backend-rate-limit")
+	backendRateBurst, _ := cmd.Flags().GetInt("backend-rate-burst")
+	if backendRateLimit < 0 {
+		report.add("backend-limits", checkStatusError, "backend-rate-limit must not be negative")
+		return
+	}
+	if backendRateLimit > 0 && backendRateBurst < 1 {
+		report.add("backend-limits", checkStatusError, "backend-rate-burst must be at least 1")
+		return
+	}
+	if backendMaxConcurrency, _ := cmd.Flags().GetInt("backend-max-concurrency"); backendMaxConcurrency > 0 {
+		if backendLatencyTarget, _ := cmd.Flags().GetDuration("backend-latency-target"); backendLatencyTarget <= 0 {
+			report.add("backend-limits", checkStatusError, "backend-latency-target must be positive")
+			return
+		}
+	}
+	backendCircuitThreshold, _ := cmd.Flags().GetInt("backend-circuit-threshold")
+	if backendCircuitThreshold < 0 {
+		report.add("backend-limits", checkStatusError, "backend-circuit-threshold must not be negative")
+		return
+	}
+	if backendCircuitThreshold > 0 {
+		if backendCircuitCooldown, _ := cmd.Flags().GetDuration("backend-circuit-cooldown"); backendCircuitCooldown <= 0 {
+			report.add("backend-limits", checkStatusError, "backend-circuit-cooldown must be positive")
+			return
+		}
+	}
+	report.add("backend-limits", checkStatusOK, "")
+}
+
+func checkFDBudget(cmd *cobra.Command, report *checkReport) {
+	budget := kcc.FDBudget()
+	if budget == 0 {
+		report.add("fd-budget", checkStatusSkipped, "file descriptor limit not available")
+		return
+	}
+	if backendMaxConcurrency, _ := cmd.Flags().GetInt("backend-max-concurrency"); backendMaxConcurrency > budget {
+		report.add("fd-budget", checkStatusWarning, "backend-max-concurrency %d exceeds the file descriptor budget of %d, raise RLIMIT_NOFILE", backendMaxConcurrency, budget)
+		return
+	}
+	report.add("fd-budget", checkStatusOK, "%d file descriptors for connection pools", budget)
+}
+
+func checkRuntime(cmd *cobra.Command, report *checkReport) {
+	maxProcs, _ := cmd.Flags().GetInt("gomaxprocs")
+	switch {
+	case maxProcs < 0:
+		report.add("runtime", checkStatusError, "gomaxprocs must not be negative")
+	case maxProcs > 0:
+		report.add("runtime", checkStatusOK, "gomaxprocs %d of %d CPUs", maxProcs, runtime.NumCPU())
+	case os.Getenv("GOMAXPROCS") != "":
+		report.add("runtime", checkStatusOK, "gomaxprocs %d from environment", runtime.GOMAXPROCS(0))
+	default:
+		quota, ok, err := cgroupCPUQuota()
+		switch {
+		case err != nil:
+			report.add("runtime", checkStatusWarning, "failed to detect cgroup CPU quota: %v", err)
+		case ok:
+			report.add("runtime", checkStatusOK, "gomaxprocs %d from cgroup CPU quota %v of %d CPUs", cpuQuotaToMaxProcs(quota), quota, runtime.NumCPU())
+		default:
+			report.add("runtime", checkStatusOK, "gomaxprocs %d, no cgroup CPU quota", runtime.NumCPU())
+		}
+	}
+}
+
+func checkSLO(cmd *cobra.Command, report *checkReport) {
+	sloObjective, _ := cmd.Flags().GetFloat64("slo-objective")
+	sloLatencyTarget, _ := cmd.Flags().GetDuration("slo-latency-target")
+	sloWindow, _ := cmd.Flags().GetDuration("slo-window")
+
+	switch {
+	case sloObjective <= 0 || sloObjective >= 1:
+		report.add("slo", checkStatusError, "invalid slo-objective: %v, must be between 0 and 1", sloObjective)
+	case sloLatencyTarget <= 0 || sloWindow <= 0:
+		report.add("slo", checkStatusError, "slo-latency-target and slo-window must be positive")
+	default:
+		report.add("slo", checkStatusOK, "%v within %v over %v", sloObjective, sloLatencyTarget, sloWindow)
+	}
+}
+
+func checkUserCache(cmd *cobra.Command, report *checkReport) {
+	userCacheTTL, _ := cmd.Flags().GetDuration("user-cache-ttl")
+	preloadUsers, _ := cmd.Flags().GetString("preload-users")
+	preloadTopFile, _ := cmd.Flags().GetString("preload-top-file")
+	userCacheDir, _ := cmd.Flags().GetString("user-cache-dir")
+
+	switch {
+	case userCacheTTL <= 0 && (preloadUsers != "" || preloadTopFile != ""):
+		report.add("user-cache", checkStatusWarning, "preload is configured but the user cache is not enabled")
+	case userCacheTTL <= 0 && userCacheDir != "":
+		report.add("user-cache", checkStatusWarning, "user-cache-dir is set but the user cache is not enabled")
+	case userCacheTTL <= 0:
+		report.add("user-cache", checkStatusSkipped, "user cache not enabled")
+	default:
+		var usernames []string
+		if preloadUsers != "" {
+			var err error
+			if usernames, err = userdsrv.ReadUsernames(preloadUsers); err != nil {
+				report.add("user-cache", checkStatusError, "invalid preload-users: %v", err)
+				return
+			}
+		}
+		if userCacheDir != "" {
+			if fi, err := os.Stat(userCacheDir); err == nil && !fi.IsDir() {
+				report.add("user-cache", checkStatusError, "invalid user-cache-dir: %v", userCacheDir)
+				return
+			}
+		}
+		report.add("user-cache", checkStatusOK, "ttl %v, %d users to preload", userCacheTTL, len(usernames))
+	}
+}
+
+func checkAdminAPI(cmd *cobra.Command, report *checkReport) {
+	enableAdminAPI, _ := cmd.Flags().GetBool("enable-admin-api")
+	signingSecret, _ := cmd.Flags().GetString("admin-signing-secret")
+	signingSkew, _ := cmd.Flags().GetDuration("admin-signing-skew")
+
+	switch {
+	case !enableAdminAPI && signingSecret != "":
+		report.add("admin-api", checkStatusWarning, "admin-signing-secret is set but the admin API is not enabled")
+	case !enableAdminAPI:
+		report.add("admin-api", checkStatusSkipped, "admin API not enabled")
+	case signingSecret == "":
+		report.add("admin-api", checkStatusWarning, "admin requests are not signed, set admin-signing-secret")
+	case signingSkew <= 0:
+		report.add("admin-api", checkStatusError, "admin-signing-skew must be positive")
+	case len(signingSecret) < checkMinSecretLength:
+		report.add("admin-api", checkStatusWarning, "admin-signing-secret is shorter than %d bytes", checkMinSecretLength)
+	default:
+		report.add("admin-api", checkStatusOK, "admin requests must be signed")
+	}
+}
+
+func checkPortal(cmd *cobra.Command, report *checkReport) {
+	enablePortal, _ := cmd.Flags().GetBool("enable-portal")
+	portalSecret, _ := cmd.Flags().GetString("portal-secret")
+
+	switch {
+	case !enablePortal && portalSecret != "":
+		report.add("portal", checkStatusWarning, "portal-secret is set but the portal is not enabled")
+	case !enablePortal:
+		report.add("portal", checkStatusSkipped, "portal not enabled")
+	case portalSecret == "":
+		report.add("portal", checkStatusWarning, "no portal-secret, portal sessions are invalidated on restart")
+	case len(portalSecret) < checkMinSecretLength:
+		report.add("portal", checkStatusWarning, "portal-secret is shorter than %d bytes", checkMinSecretLength)
+	default:
+		report.add("portal", checkStatusOK, "")
+	}
+}
+
+func checkCalendar(cmd *cobra.Command, report *checkReport) {
+	calendarTokenSecret, _ := cmd.Flags().GetString("calendar-token-secret")
+	calendarTimezone, _ := cmd.Flags().GetString("calendar-timezone")
+
+	if calendarTimezone != "" {
+		if _, err := time.LoadLocation(calendarTimezone); err != nil {
+			report.add("calendar", checkStatusError, "invalid calendar-timezone: %v", err)
+			return
+		}
+	}
+
+	switch {
+	case calendarTokenSecret == "" && calendarTimezone != "":
+		report.add("calendar", checkStatusWarning, "calendar-timezone is set but calendar subscriptions are not enabled")
+	case calendarTokenSecret == "":
+		report.add("calendar", checkStatusSkipped, "calendar subscriptions not enabled")
+	case len(calendarTokenSecret) < checkMinSecretLength:
+		report.add("calendar", checkStatusWarning, "calendar-token-secret is shorter than %d bytes", checkMinSecretLength)
+	default:
+		report.add("calendar", checkStatusOK, "")
+	}
+}
+
+func checkSPA(cmd *cobra.Command, report *checkReport) {
+	spaDir, _ := cmd.Flags().GetString("spa-dir")
+	enableSPA, _ := cmd.Flags().GetBool("enable-spa")
+
+	switch {
+	case spaDir != "":
+		if fi, err := os.Stat(spaDir); err != nil || !fi.IsDir() {
+			report.add("spa", checkStatusError, "invalid spa-dir: %v", spaDir)
+			return
+		}
+		if _, err := os.Stat(spaDir + "/index.html"); err != nil {
+			report.add("spa", checkStatusWarning, "spa-dir has no index.html")
+			return
+		}
+		report.add("spa", checkStatusOK, "%s", spaDir)
+	case enableSPA && userdsrv.EmbeddedSPAAssets == nil:
+		report.add("spa", checkStatusError, "enable-spa requires a binary with embedded single-page app, use spa-dir instead")
+	case enableSPA:
+		report.add("spa", checkStatusOK, "embedded")
+	default:
+		report.add("spa", checkStatusSkipped, "single-page app hosting not enabled")
+	}
+}
+
+func checkStateDump(cmd *cobra.Command, report *checkReport) {
+	stateDumpFile, _ := cmd.Flags().GetString("state-dump-file")
+	if stateDumpFile == "" {
+		report.add("state-dump", checkStatusOK, "logged")
+		return
+	}
+	if fi, err := os.Stat(filepath.Dir(stateDumpFile)); err != nil || !fi.IsDir() {
+		report.add("state-dump", checkStatusError, "invalid state-dump-file, directory does not exist: %v", stateDumpFile)
+		return
+	}
+	if fi, err := os.Stat(stateDumpFile); err == nil && fi.IsDir() {
+		report.add("state-dump", checkStatusError, "invalid state-dump-file, is a directory: %v", stateDumpFile)
+		return
+	}
+	report.add("state-dump", checkStatusOK, "%s", stateDumpFile)
+}
+
+func checkLegacyAPISunset(cmd *cobra.Command, report *checkReport) {
+	legacyAPISunset, _ := cmd.Flags().GetString("legacy-api-sunset")
+	if legacyAPISunset == "" {
+		report.add("legacy-api-sunset", checkStatusSkipped, "no sunset announced")
+		return
+	}
+
+	sunset, err := time.Parse("2006-01-02", legacyAPISunset)
+	if err != nil {
+		report.add("legacy-api-sunset", checkStatusError, "invalid legacy-api-sunset: %v", err)
+		return
+	}
+	if sunset.Before(time.Now()) {
+		report.add("legacy-api-sunset", checkStatusWarning, "sunset %s has passed", legacyAPISunset)
+		return
+	}
+	report.add("legacy-api-sunset", checkStatusOK, "%s", legacyAPISunset)
+}
+
+func checkTrustedProxies(cmd *cobra.Command, report *checkReport) {
+	trustedProxies, _ := cmd.Flags().GetStringSlice("trusted-proxies")
+	if len(trustedProxies) == 0 {
+		report.add("trusted-proxies", checkStatusSkipped, "no trusted proxies, forwarded headers are ignored")
+		return
+	}
+
+	if _, err := userdsrv.ParseTrustedProxies(trustedProxies); err != nil {
+		report.add("trusted-proxies", checkStatusError, "%v", err)
+		return
+	}
+	report.add("trusted-proxies", checkStatusOK, "%s", strings.Join(trustedProxies, ","))
+}
+
+func checkFeatures(cmd *cobra.Command, report *checkReport) {
+	features, _ := cmd.Flags().GetString("features")
+	if features != "" {
+		if err := kcc.SetFeatures(features, kcc.FeatureSourceConfig); err != nil {
+			report.add("features", checkStatusError, "invalid features: %v", err)
+			return
+		}
+	}
+
+	var enabled []string
+	for _, feature := range kcc.Features() {
+		if feature.Enabled {
+			enabled = append(enabled, feature.Name)
+		}
+	}
+	if len(enabled) == 0 {
+		report.add("features", checkStatusOK, "no experimental features enabled")
+		return
+	}
+	report.add("features", checkStatusOK, "experimental features enabled: %s", strings.Join(enabled, ", "))
+}
+
+func checkConsul(cmd *cobra.Command, report *checkReport, timeout time.Duration) {
+	listenAddr, _ := cmd.Flags().GetString("listen")
+	registration, err := newConsulRegistration(cmd, listenAddr)
+	switch {
+	case err != nil:
+		report.add("consul", checkStatusError, "%v", err)
+		return
+	case registration == nil:
+		report.add("consul", checkStatusSkipped, "service registration not enabled")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err = registration.ping(ctx); err != nil {
+		report.add("consul", checkStatusError, "agent not usable: %v", err)
+		return
+	}
+	report.add("consul", checkStatusOK, "%s as %s, check %s", registration.agentURI, registration.service.ID, registration.service.Check.HTTP)
+}
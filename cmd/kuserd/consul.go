@@ -0,0 +1,214 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// consulRegisterRetryInterval is the duration to wait before registering with
+// the Consul agent again after it failed.
+const consulRegisterRetryInterval = 10 * time.Second
+
+// A consulService is the service definition of the Consul agent API.
+type consulService struct {
+	ID      string       `json:"ID"`
+	Name    string       `json:"Name"`
+	Tags    []string     `json:"Tags,omitempty"`
+	Address string       `json:"Address,omitempty"`
+	Port    int          `json:"Port"`
+	Check   *consulCheck `json:"Check"`
+}
+
+// A consulCheck is the check definition of the Consul agent API.
+type consulCheck struct {
+	HTTP                           string `json:"HTTP"`
+	Method                         string `json:"Method"`
+	Interval                       string `json:"Interval"`
+	Timeout                        string `json:"Timeout"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter,omitempty"`
+}
+
+// consulRegistration registers kuserd as service with a Consul agent. Its
+// check polls /health-check, so the service is only discovered while kuserd
+// is ready to handle requests and not in maintenance mode.
+type consulRegistration struct {
+	agentURI *url.URL
+	token    string
+	client   *http.Client
+	service  *consulService
+}
+
+// newConsulRegistration creates the Consul registration of the serve flags of
+// the provided command for the provided listen address. It returns nil if
+// registration is not enabled.
+func newConsulRegistration(cmd *cobra.Command, listenAddr string) (*consulRegistration, error) {
+	consulAddr, _ := cmd.Flags().GetString("consul-addr")
+	if consulAddr == "" {
+		return nil, nil
+	}
+	agentURI, err := url.Parse(consulAddr)
+	if err != nil || (agentURI.Scheme != "http" && agentURI.Scheme != "https") || agentURI.Host == "" {
+		return nil, fmt.Errorf("invalid consul-addr: %v", consulAddr)
+	}
+
+	host, portString, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid listen address: %v", err)
+	}
+	port, err := strconv.Atoi(portString)
+	if err != nil || port <= 0 {
+		return nil, fmt.Errorf("invalid listen port: %v", portString)
+	}
+
+	address, _ := cmd.Flags().GetString("consul-service-address")
+	if address == "" {
+		if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+			address = host
+		}
+	}
+	checkHost := address
+	if checkHost == "" {
+		// NOTE(longsleep): Without address, Consul uses the address of the
+		// node of the agent, which is expected to run on the same host.
+		checkHost = "127.0.0.1"
+	}
+
+	name, _ := cmd.Flags().GetString("consul-service-name")
+	id, _ := cmd.Flags().GetString("consul-service-id")
+	if id == "" {
+		hostname, _ := os.Hostname()
+		id = fmt.Sprintf("%s-%s-%d", name, hostname, port)
+	}
+	tags, _ := cmd.Flags().GetStringSlice("consul-tags")
+	interval, _ := cmd.Flags().GetDuration("consul-check-interval")
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid consul-check-interval: %v", interval)
+	}
+	deregisterAfter, _ := cmd.Flags().GetDuration("consul-deregister-after")
+
+	r := &consulRegistration{
+		agentURI: agentURI,
+		token:    os.Getenv("CONSUL_HTTP_TOKEN"),
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		service: &consulService{
+			ID:      id,
+			Name:    name,
+			Tags:    tags,
+			Address: address,
+			Port:    port,
+			Check: &consulCheck{
+				HTTP:     "http://" + net.JoinHostPort(checkHost, portString) + "/health-check",
+				Method:   http.MethodGet,
+				Interval: interval.String(),
+				Timeout:  interval.String(),
+			},
+		},
+	}
+	if deregisterAfter > 0 {
+		r.service.Check.DeregisterCriticalServiceAfter = deregisterAfter.String()
+	}
+
+	return r, nil
+}
+
+// run registers the service with the Consul agent, retrying until it succeeds
+// or the provided context is done.
+func (r *consulRegistration) run(ctx context.Context, logger logrus.FieldLogger) {
+	logger = logger.WithFields(logrus.Fields{
+		"agent":   r.agentURI.String(),
+		"service": r.service.ID,
+	})
+	for {
+		err := r.register(ctx)
+		if err == nil {
+			logger.Infoln("registered with consul")
+			return
+		}
+		logger.WithError(err).Warnln("failed to register with consul, will retry")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(consulRegisterRetryInterval):
+		}
+	}
+}
+
+// register registers the service with the Consul agent.
+func (r *consulRegistration) register(ctx context.Context) error {
+	body, err := json.Marshal(r.service)
+	if err != nil {
+		return err
+	}
+	return r.do(ctx, http.MethodPut, "/v1/agent/service/register", bytes.NewReader(body))
+}
+
+// deregister removes the service from the Consul agent.
+func (r *consulRegistration) deregister(ctx context.Context) error {
+	return r.do(ctx, http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(r.service.ID), nil)
+}
+
+// ping checks that the Consul agent is reachable and accepts the token.
+func (r *consulRegistration) ping(ctx context.Context) error {
+	return r.do(ctx, http.MethodGet, "/v1/agent/self", nil)
+}
+
+// do sends a request to the provided path of the Consul agent API.
+func (r *consulRegistration) do(ctx context.Context, method string, path string, body io.Reader) error {
+	uri := *r.agentURI
+	uri.Path = path
+	req, err := http.NewRequest(method, uri.String(), body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if r.token != "" {
+		req.Header.Set("X-Consul-Token", r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("consul agent responded with status %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
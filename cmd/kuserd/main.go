@@ -23,16 +23,23 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"os/user"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"stash.kopano.io/kgol/kcc-go"
 	"stash.kopano.io/kgol/kcc-go/cmd"
+	"stash.kopano.io/kgol/kcc-go/userdsrv"
 )
 
 func main() {
 	cmd.RootCmd.AddCommand(commandServe())
+	cmd.RootCmd.AddCommand(commandCheckConfig())
 
 	if err := cmd.RootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
@@ -47,18 +54,71 @@ func commandServe() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			if err := serve(cmd, args); err != nil {
 				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				writeTerminationLog(cmd, err)
 				os.Exit(1)
 			}
 		},
 	}
-	serveCmd.Flags().String("listen", "127.0.0.1:8769", "TCP listen address")
-	serveCmd.Flags().String("server-uri", "", "Kopano server URI")
-	serveCmd.Flags().String("server-auth-pem", "", "Full path to a PEM encoded x509 certificate with private key file")
-	serveCmd.Flags().Bool("insecure", false, "Disable TLS certificate and hostname validation")
+	setServeFlags(serveCmd)
+	serveCmd.Flags().String("termination-log", "/dev/termination-log", "Full path to an existing file the reason is written to when serve fails, shown by Kubernetes as termination message (empty disables)")
 
 	return serveCmd
 }
 
+// setServeFlags adds the flags of the serve command to the provided command,
+// so commands checking the server configuration accept the same flags.
+func setServeFlags(cmd *cobra.Command) {
+	cmd.Flags().String("listen", "127.0.0.1:8769", "TCP listen address")
+	cmd.Flags().String("server-uri", "", "Kopano server URI")
+	cmd.Flags().String("server-auth-pem", "", "Full path to a PEM encoded x509 certificate with private key file")
+	cmd.Flags().String("server-ca-file", "", "Full path to a PEM encoded file with the CA certificates to validate the server certificate with")
+	cmd.Flags().Bool("insecure", false, "Disable TLS certificate and hostname validation")
+	cmd.Flags().String("server-socket-owner", "", "Expected user[:group] of the Kopano server process for file:// and http+unix:// server URIs, checked on every socket connect (Linux only)")
+	cmd.Flags().Int("tls-session-cache-size", kcc.DefaultTLSSessionCacheSize, "Number of TLS sessions kept for resumption of connections to the Kopano server (0 disables resumption)")
+	cmd.Flags().String("calendar-token-secret", "", "Secret used to validate calendar subscription tokens, enables /calendar.ics when set")
+	cmd.Flags().Bool("enable-admin-api", false, "Enable the authenticated /admin API endpoints")
+	cmd.Flags().String("admin-signing-secret", "", "Secret used to validate HMAC signatures of admin requests, requires signed admin requests when set")
+	cmd.Flags().Duration("admin-signing-skew", 5*time.Minute, "Maximum clock skew accepted for signed admin requests")
+	cmd.Flags().Duration("idempotency-ttl", 10*time.Minute, "Duration responses of requests with Idempotency-Key header are kept for retries (0 disables)")
+	cmd.Flags().StringSlice("trusted-proxies", nil, "Comma separated CIDRs or addresses of proxies whose Forwarded and X-Forwarded-For headers are trusted to determine client addresses")
+	cmd.Flags().Duration("request-timeout", 0, "Maximum duration of requests, shared by all backend calls of a request (0 means no limit)")
+	cmd.Flags().Duration("drain-delay", 0, "Duration requests are still handled after SIGTERM while /health-check reports draining, before shutdown begins")
+	cmd.Flags().String("state-dump-file", "", "Full path to a file state dumps requested with SIGQUIT or /admin/state are written to (empty logs them)")
+	cmd.Flags().Int("gomaxprocs", 0, "Maximum number of CPUs executing Go code simultaneously (0 detects the CPU quota of the cgroup, unless GOMAXPROCS is set)")
+	cmd.Flags().Int("gc-percent", 0, "Garbage collection target percentage like GOGC (0 keeps the default, negative disables garbage collection)")
+	cmd.Flags().Float64("backend-rate-limit", 0, "Maximum requests per second sent to the Kopano server (0 means no limit)")
+	cmd.Flags().Int("backend-rate-burst", kcc.DefaultRateBurst, "Number of requests allowed to exceed the backend rate limit in bursts")
+	cmd.Flags().Int("backend-max-concurrency", 0, "Maximum concurrent requests sent to the Kopano server, enables adaptive concurrency control when set")
+	cmd.Flags().Duration("backend-latency-target", kcc.DefaultAdaptiveLatencyTarget, "Latency of backend requests above which adaptive concurrency control lowers the limit")
+	cmd.Flags().Int("backend-circuit-threshold", 0, "Number of consecutive backend transport failures after which backend requests fail fast for the circuit cool-down (0 disables the circuit breaker)")
+	cmd.Flags().Duration("backend-circuit-cooldown", kcc.DefaultCircuitBreakerCooldown, "Duration backend requests fail fast after the circuit breaker opened, before the backend is probed again")
+	cmd.Flags().Float64("slo-objective", kcc.DefaultSLOObjective, "Share of backend requests which must succeed within slo-latency-target, reported at /slo")
+	cmd.Flags().Duration("slo-latency-target", kcc.DefaultSLOLatencyTarget, "Duration above which backend requests count against the SLO error budget")
+	cmd.Flags().Duration("slo-window", kcc.DefaultSLOWindow, "Rolling window backend requests are tracked in for the SLO")
+	cmd.Flags().Duration("slow-call-threshold", 0, "Duration above which backend calls are logged as slow (0 disables)")
+	cmd.Flags().Bool("enable-portal", false, "Enable the HTML logon portal at /portal/")
+	cmd.Flags().String("portal-secret", "", "Secret used to sign portal session cookies (default is a random secret, invalidating sessions on restart)")
+	cmd.Flags().Bool("enable-spa", false, "Serve the single-page app compiled into the binary under /")
+	cmd.Flags().String("spa-dir", "", "Full path to a directory with a single-page app to serve under /, enables SPA hosting when set")
+	cmd.Flags().Duration("spa-max-age", time.Hour, "Duration single-page app assets other than index.html may be cached by clients")
+	cmd.Flags().String("legacy-api-sunset", "", "Date (YYYY-MM-DD) announced in Sunset headers of unversioned legacy API paths")
+	cmd.Flags().String("calendar-timezone", "", "Time zone used for calendar subscriptions (default is the local time zone)")
+	cmd.Flags().Duration("user-cache-ttl", 0, "Duration user records of /userinfo are cached (0 disables)")
+	cmd.Flags().String("user-cache-dir", "", "Full path to a directory user records are persisted in, served as stale when the Kopano server is unreachable, requires user-cache-ttl")
+	cmd.Flags().Duration("user-cache-max-age", 7*24*time.Hour, "Maximum age of persisted user records (0 keeps them until replaced)")
+	cmd.Flags().String("preload-users", "", "Full path to a file with usernames (one per line) whose user records are cached at startup, requires user-cache-ttl")
+	cmd.Flags().String("preload-top-file", "", "Full path to a file the most requested usernames are saved to on shutdown and preloaded from at startup, requires user-cache-ttl")
+	cmd.Flags().Int("preload-top", 100, "Number of most requested usernames saved to preload-top-file")
+	cmd.Flags().String("features", "", "Comma separated feature flags of experimental behaviors to enable, prefix with - to disable (overrides KCC_GO_FEATURES)")
+	cmd.Flags().String("consul-addr", "", "URL of the Consul agent to register the service with, enables registration when set (token is read from CONSUL_HTTP_TOKEN)")
+	cmd.Flags().String("consul-service-name", "kuserd", "Name of the service registered with Consul")
+	cmd.Flags().String("consul-service-id", "", "ID of the service registered with Consul (default is name-hostname-port)")
+	cmd.Flags().String("consul-service-address", "", "Address of the service registered with Consul (default is the listen host, or the address of the Consul node if unspecified)")
+	cmd.Flags().StringSlice("consul-tags", nil, "Comma separated tags of the service registered with Consul")
+	cmd.Flags().Duration("consul-check-interval", 10*time.Second, "Interval the Consul agent checks /health-check of the service in")
+	cmd.Flags().Duration("consul-deregister-after", time.Minute, "Duration after which Consul removes the service when its check is critical (0 disables)")
+}
+
 func serve(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 	logger := &logrus.Logger{
@@ -67,7 +127,25 @@ func serve(cmd *cobra.Command, args []string) error {
 		Level:     logrus.DebugLevel,
 	}
 
-	logger.Infoln("serve start")
+	buildInfo := kcc.BuildInfo()
+	logger.WithFields(logrus.Fields{
+		"version":   buildInfo.Version,
+		"commit":    buildInfo.Commit,
+		"buildDate": buildInfo.BuildDate,
+		"go":        buildInfo.GoVersion,
+	}).Infoln("serve start")
+
+	if budget := kcc.FDBudget(); budget > 0 {
+		logger.WithField("budget", budget).Debugln("file descriptor budget of connection pools")
+	}
+
+	kcc.SetPanicHandler(func(err *kcc.PanicError) {
+		logger.WithField("panic", err.Value).Errorf("recovered panic\n%s", err.Stack)
+	})
+
+	if err := setRuntimeTuning(cmd, logger); err != nil {
+		return err
+	}
 
 	var serverURI *url.URL
 	var tlsConfig *tls.Config
@@ -92,26 +170,38 @@ func serve(cmd *cobra.Command, args []string) error {
 
 	switch serverURI.Scheme {
 	case "https":
-		tlsConfig = &tls.Config{
-			ClientSessionCache: tls.NewLRUClientSessionCache(0),
-		}
+		tlsSessionCacheSize, _ := cmd.Flags().GetInt("tls-session-cache-size")
+		tlsConfig = kcc.SetTLSSessionCacheToTLSConfig(tlsSessionCacheSize, nil)
 
 		tlsInsecureSkipVerify, _ := cmd.Flags().GetBool("insecure")
 		if tlsInsecureSkipVerify {
-			// NOTE(longsleep): This disable http2 client support. See https://github.com/golang/go/issues/14275 for reasons.
 			tlsConfig.InsecureSkipVerify = true
 			logger.Warnln("insecure mode, TLS client connections are susceptible to man-in-the-middle attacks")
-			logger.Debugln("http2 client support is disabled (insecure mode)")
 		}
 
 		kcc.DefaultHTTPClient.Transport.(*http.Transport).TLSClientConfig = tlsConfig
 		fallthrough
 	case "http":
+	case "http+unix":
 	case "file":
+	case "npipe":
+	case "tcp":
 	default:
 		return fmt.Errorf("unsupported server-uri scheme: %v", serverURI.Scheme)
 	}
 
+	if serverCAFile, err := cmd.Flags().GetString("server-ca-file"); err == nil && serverCAFile != "" {
+		if tlsConfig == nil {
+			return fmt.Errorf("this server-uri cannot be used together with server-ca-file, a https:// uri is required")
+		}
+
+		_, err := kcc.SetRootCAsToTLSConfig(serverCAFile, tlsConfig)
+		if err != nil {
+			return fmt.Errorf("failed to set server-ca-file: %v", err)
+		}
+		logger.Infoln("using CA certificates for server auth")
+	}
+
 	if serverAuthPEM, err := cmd.Flags().GetString("server-auth-pem"); err == nil && serverAuthPEM != "" {
 		if tlsConfig == nil {
 			return fmt.Errorf("this server-uri cannot be used together with server-auth-cert, a https:// uri is required")
@@ -124,8 +214,284 @@ func serve(cmd *cobra.Command, args []string) error {
 		logger.Infoln("using TLS client certificate for server auth")
 	}
 
-	srv := NewServer(listenAddr, serverURI, logger)
+	if features, _ := cmd.Flags().GetString("features"); features != "" {
+		if err := kcc.SetFeatures(features, kcc.FeatureSourceConfig); err != nil {
+			return fmt.Errorf("invalid features: %v", err)
+		}
+	}
+	for _, feature := range kcc.Features() {
+		if feature.Enabled {
+			logger.WithFields(logrus.Fields{
+				"feature": feature.Name,
+				"source":  feature.Source,
+			}).Infoln("experimental feature enabled")
+		}
+	}
+
+	if serverSocketOwner, _ := cmd.Flags().GetString("server-socket-owner"); serverSocketOwner != "" {
+		if !kcc.SocketPeerCredentialsSupported {
+			return fmt.Errorf("server-socket-owner is not supported on %s", runtime.GOOS)
+		}
+		owner, err := parseSocketPeerOwner(serverSocketOwner)
+		if err != nil {
+			return fmt.Errorf("invalid server-socket-owner: %v", err)
+		}
+		kcc.DefaultSocketPeerOwner = owner
+		logger.WithFields(logrus.Fields{
+			"uid": owner.UID,
+			"gid": owner.GID,
+		}).Infoln("server socket owner check enabled")
+	}
+
+	config := &userdsrv.Config{}
+
+	if trustedProxies, _ := cmd.Flags().GetStringSlice("trusted-proxies"); len(trustedProxies) > 0 {
+		proxies, err := userdsrv.ParseTrustedProxies(trustedProxies)
+		if err != nil {
+			return err
+		}
+		config.TrustedProxies = proxies
+		logger.WithField("proxies", trustedProxies).Infoln("trusted proxies set")
+	}
+
+	if requestTimeout, _ := cmd.Flags().GetDuration("request-timeout"); requestTimeout > 0 {
+		config.RequestTimeout = requestTimeout
+		logger.WithField("timeout", requestTimeout).Infoln("request timeout enabled")
+	}
+
+	config.DrainDelay, _ = cmd.Flags().GetDuration("drain-delay")
+	config.StateDumpPath, _ = cmd.Flags().GetString("state-dump-file")
+
+	if enableAdminAPI, _ := cmd.Flags().GetBool("enable-admin-api"); enableAdminAPI {
+		config.AdminAPI = true
+		logger.Infoln("admin API enabled")
+	}
+
+	if signingSecret, _ := cmd.Flags().GetString("admin-signing-secret"); signingSecret != "" {
+		config.AdminSigningSecret = []byte(signingSecret)
+		config.AdminSigningSkew, _ = cmd.Flags().GetDuration("admin-signing-skew")
+		logger.WithField("skew", config.AdminSigningSkew).Infoln("admin request signatures required")
+	}
+
+	config.IdempotencyTTL, _ = cmd.Flags().GetDuration("idempotency-ttl")
+
+	if enablePortal, _ := cmd.Flags().GetBool("enable-portal"); enablePortal {
+		config.Portal = true
+		if portalSecret, _ := cmd.Flags().GetString("portal-secret"); portalSecret != "" {
+			config.PortalSecret = []byte(portalSecret)
+		}
+		logger.Infoln("HTML portal enabled")
+	}
+
+	if legacyAPISunset, _ := cmd.Flags().GetString("legacy-api-sunset"); legacyAPISunset != "" {
+		sunset, err := time.Parse("2006-01-02", legacyAPISunset)
+		if err != nil {
+			return fmt.Errorf("invalid legacy-api-sunset: %v", err)
+		}
+		config.LegacyAPISunset = sunset
+		logger.WithField("sunset", legacyAPISunset).Infoln("legacy API sunset announced")
+	}
+
+	if spaDir, _ := cmd.Flags().GetString("spa-dir"); spaDir != "" {
+		if fi, err := os.Stat(spaDir); err != nil || !fi.IsDir() {
+			return fmt.Errorf("invalid spa-dir: %v", spaDir)
+		}
+		config.SPAAssets = http.Dir(spaDir)
+		logger.WithField("dir", spaDir).Infoln("single-page app hosting enabled")
+	} else if enableSPA, _ := cmd.Flags().GetBool("enable-spa"); enableSPA {
+		if userdsrv.EmbeddedSPAAssets == nil {
+			return fmt.Errorf("enable-spa requires a binary with embedded single-page app, use spa-dir instead")
+		}
+		config.SPAAssets = userdsrv.EmbeddedSPAAssets
+		logger.Infoln("embedded single-page app hosting enabled")
+	}
+	config.SPAMaxAge, _ = cmd.Flags().GetDuration("spa-max-age")
+
+	if calendarTokenSecret, _ := cmd.Flags().GetString("calendar-token-secret"); calendarTokenSecret != "" {
+		config.CalendarTokenSecret = []byte(calendarTokenSecret)
+		config.CalendarLocation = time.Local
+		if calendarTimezone, _ := cmd.Flags().GetString("calendar-timezone"); calendarTimezone != "" {
+			loc, err := time.LoadLocation(calendarTimezone)
+			if err != nil {
+				return fmt.Errorf("invalid calendar-timezone: %v", err)
+			}
+			config.CalendarLocation = loc
+		}
+		logger.WithField("timezone", config.CalendarLocation.String()).Infoln("calendar subscriptions enabled")
+	}
+
+	if userCacheTTL, _ := cmd.Flags().GetDuration("user-cache-ttl"); userCacheTTL > 0 {
+		config.UserCache = kcc.NewUserCache(userCacheTTL, nil)
+		if preloadUsers, _ := cmd.Flags().GetString("preload-users"); preloadUsers != "" {
+			usernames, err := userdsrv.ReadUsernames(preloadUsers)
+			if err != nil {
+				return fmt.Errorf("invalid preload-users: %v", err)
+			}
+			config.PreloadUsernames = usernames
+		}
+		if userCacheDir, _ := cmd.Flags().GetString("user-cache-dir"); userCacheDir != "" {
+			userCacheMaxAge, _ := cmd.Flags().GetDuration("user-cache-max-age")
+			diskUsers, err := kcc.NewDiskUserCache(userCacheDir, userCacheTTL, userCacheMaxAge, nil)
+			if err != nil {
+				return fmt.Errorf("invalid user-cache-dir: %v", err)
+			}
+			config.DiskUserCache = diskUsers
+			logger.WithFields(logrus.Fields{
+				"dir":    userCacheDir,
+				"maxAge": userCacheMaxAge,
+				"users":  diskUsers.Len(),
+			}).Infoln("persistent user cache enabled")
+		}
+		config.PreloadTopPath, _ = cmd.Flags().GetString("preload-top-file")
+		config.PreloadTop, _ = cmd.Flags().GetInt("preload-top")
+		logger.WithFields(logrus.Fields{
+			"ttl":     userCacheTTL,
+			"preload": len(config.PreloadUsernames),
+			"top":     config.PreloadTopPath,
+		}).Infoln("user cache enabled")
+	}
+
+	registration, err := newConsulRegistration(cmd, listenAddr)
+	if err != nil {
+		return err
+	}
+
+	srv, err := userdsrv.NewServer(listenAddr, serverURI, logger, config)
+	if err != nil {
+		return err
+	}
+
+	if backendRateLimit, _ := cmd.Flags().GetFloat64("backend-rate-limit"); backendRateLimit > 0 {
+		backendRateBurst, _ := cmd.Flags().GetInt("backend-rate-burst")
+		srv.Client().SetRateLimit(backendRateLimit, backendRateBurst)
+		logger.WithFields(logrus.Fields{
+			"limit": backendRateLimit,
+			"burst": backendRateBurst,
+		}).Infoln("backend rate limit enabled")
+	}
+
+	if backendMaxConcurrency, _ := cmd.Flags().GetInt("backend-max-concurrency"); backendMaxConcurrency > 0 {
+		backendLatencyTarget, _ := cmd.Flags().GetDuration("backend-latency-target")
+		srv.Client().SetAdaptiveConcurrency(backendMaxConcurrency, backendLatencyTarget)
+		logger.WithFields(logrus.Fields{
+			"max":    backendMaxConcurrency,
+			"target": backendLatencyTarget,
+		}).Infoln("backend adaptive concurrency control enabled")
+	}
+
+	if backendCircuitThreshold, _ := cmd.Flags().GetInt("backend-circuit-threshold"); backendCircuitThreshold > 0 {
+		backendCircuitCooldown, _ := cmd.Flags().GetDuration("backend-circuit-cooldown")
+		breaker := srv.Client().SetCircuitBreaker(backendCircuitThreshold, backendCircuitCooldown)
+		breaker.OnStateChange = func(state kcc.CircuitBreakerState) {
+			logger.WithField("state", state).Warnln("backend circuit breaker state changed")
+		}
+		logger.WithFields(logrus.Fields{
+			"threshold": backendCircuitThreshold,
+			"cooldown":  backendCircuitCooldown,
+		}).Infoln("backend circuit breaker enabled")
+	}
+
+	sloObjective, _ := cmd.Flags().GetFloat64("slo-objective")
+	if sloObjective <= 0 || sloObjective >= 1 {
+		return fmt.Errorf("invalid slo-objective: %v", sloObjective)
+	}
+	sloLatencyTarget, _ := cmd.Flags().GetDuration("slo-latency-target")
+	sloWindow, _ := cmd.Flags().GetDuration("slo-window")
+	kcc.DefaultSLOTracker = kcc.NewSLOTracker(sloObjective, sloLatencyTarget, sloWindow)
+	logger.WithFields(logrus.Fields{
+		"objective":     sloObjective,
+		"latencyTarget": sloLatencyTarget,
+		"window":        sloWindow,
+	}).Debugln("backend SLO tracking")
+
+	if slowCallThreshold, _ := cmd.Flags().GetDuration("slow-call-threshold"); slowCallThreshold > 0 {
+		srv.Client().SetSlowCallLog(slowCallThreshold, func(call *kcc.SlowCall) {
+			logger.WithFields(logrus.Fields{
+				"action":      call.Action,
+				"duration":    call.Duration,
+				"payloadSize": call.PayloadSize,
+				"user":        call.TargetUserHash,
+				"err":         call.Err,
+			}).Warnln("slow backend call")
+		})
+		logger.WithField("threshold", slowCallThreshold).Infoln("slow backend call log enabled")
+	}
+
+	if registration != nil {
+		registerCtx, registerCtxCancel := context.WithCancel(ctx)
+		go registration.run(registerCtx, logger)
+		defer func() {
+			registerCtxCancel()
+			deregisterCtx, deregisterCtxCancel := context.WithTimeout(ctx, 10*time.Second)
+			defer deregisterCtxCancel()
+			if deregisterErr := registration.deregister(deregisterCtx); deregisterErr != nil {
+				logger.WithError(deregisterErr).Warnln("failed to deregister from consul")
+				return
+			}
+			logger.Infoln("deregistered from consul")
+		}()
+	}
 
 	logger.Infof("serve started")
 	return srv.Serve(ctx, username, password)
 }
+
+// terminationLogMaxSize is the maximum size of termination messages read by
+// Kubernetes.
+const terminationLogMaxSize = 4096
+
+// writeTerminationLog writes the provided error as termination reason to the
+// termination-log file of the provided command. The file is not created, so
+// nothing is written outside of containers which provide it.
+func writeTerminationLog(cmd *cobra.Command, err error) {
+	fn, _ := cmd.Flags().GetString("termination-log")
+	if fn == "" {
+		return
+	}
+	f, openErr := os.OpenFile(fn, os.O_WRONLY|os.O_TRUNC, 0)
+	if openErr != nil {
+		return
+	}
+	defer f.Close()
+
+	message := err.Error()
+	if len(message) > terminationLogMaxSize {
+		message = message[:terminationLogMaxSize]
+	}
+	f.WriteString(message)
+}
+
+// parseSocketPeerOwner parses the provided user[:group] value, accepting
+// names and numeric IDs.
+func parseSocketPeerOwner(value string) (*kcc.SocketPeerOwner, error) {
+	owner := &kcc.SocketPeerOwner{
+		UID: -1,
+		GID: -1,
+	}
+
+	parts := strings.SplitN(value, ":", 2)
+	if parts[0] != "" {
+		uid, err := strconv.Atoi(parts[0])
+		if err != nil {
+			u, lookupErr := user.Lookup(parts[0])
+			if lookupErr != nil {
+				return nil, lookupErr
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+		owner.UID = uid
+	}
+	if len(parts) == 2 && parts[1] != "" {
+		gid, err := strconv.Atoi(parts[1])
+		if err != nil {
+			g, lookupErr := user.LookupGroup(parts[1])
+			if lookupErr != nil {
+				return nil, lookupErr
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+		owner.GID = gid
+	}
+
+	return owner, nil
+}
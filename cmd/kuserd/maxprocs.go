@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// setRuntimeTuning applies the GOMAXPROCS and GC settings of the provided
+// command. A gomaxprocs flag of 0 detects the limit from the CPU quota of the
+// cgroup of the process, unless the GOMAXPROCS environment variable is set.
+func setRuntimeTuning(cmd *cobra.Command, logger logrus.FieldLogger) error {
+	maxProcs, _ := cmd.Flags().GetInt("gomaxprocs")
+	switch {
+	case maxProcs < 0:
+		return fmt.Errorf("invalid gomaxprocs: %d", maxProcs)
+	case maxProcs > 0:
+		runtime.GOMAXPROCS(maxProcs)
+		logger.WithField("gomaxprocs", maxProcs).Infoln("GOMAXPROCS set")
+	case os.Getenv("GOMAXPROCS") != "":
+		logger.WithField("gomaxprocs", runtime.GOMAXPROCS(0)).Debugln("GOMAXPROCS set by environment")
+	default:
+		quota, ok, err := cgroupCPUQuota()
+		if err != nil {
+			logger.WithError(err).Warnln("failed to detect cgroup CPU quota")
+		}
+		if ok {
+			maxProcs = cpuQuotaToMaxProcs(quota)
+			if maxProcs < runtime.NumCPU() {
+				runtime.GOMAXPROCS(maxProcs)
+			}
+			logger.WithFields(logrus.Fields{
+				"quota":      quota,
+				"gomaxprocs": runtime.GOMAXPROCS(0),
+			}).Infoln("GOMAXPROCS set from cgroup CPU quota")
+		}
+	}
+
+	if gcPercent, _ := cmd.Flags().GetInt("gc-percent"); gcPercent != 0 {
+		debug.SetGCPercent(gcPercent)
+		logger.WithField("percent", gcPercent).Infoln("GC target percentage set")
+	}
+
+	return nil
+}
+
+// cpuQuotaToMaxProcs returns the GOMAXPROCS value for the provided CPU quota,
+// rounded down so the quota is not exceeded, but at least 1.
+func cpuQuotaToMaxProcs(quota float64) int {
+	maxProcs := int(math.Floor(quota))
+	if maxProcs < 1 {
+		maxProcs = 1
+	}
+
+	return maxProcs
+}
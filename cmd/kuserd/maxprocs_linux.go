@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupRoot is the mount point of the cgroup file systems.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupCPUQuota returns the CPU quota of the cgroup of this process in CPUs.
+// The returned bool is false if there is no quota.
+func cgroupCPUQuota() (float64, bool, error) {
+	paths, err := cgroupPaths()
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	// cgroup v2, cpu.max holds quota and period or max for no quota. Inside
+	// of a cgroup namespace the own cgroup is the root.
+	if path, ok := paths[""]; ok {
+		for _, dir := range []string{filepath.Join(cgroupRoot, path), cgroupRoot} {
+			data, readErr := ioutil.ReadFile(filepath.Join(dir, "cpu.max"))
+			if readErr != nil {
+				continue
+			}
+			fields := strings.Fields(string(data))
+			if len(fields) != 2 || fields[0] == "max" {
+				return 0, false, nil
+			}
+			return cpuQuota(fields[0], fields[1])
+		}
+	}
+
+	// cgroup v1, quota and period are separate files of the cpu controller
+	// and the quota is -1 for no quota.
+	if path, ok := paths["cpu"]; ok {
+		for _, mount := range []string{"cpu", "cpu,cpuacct", "cpuacct,cpu"} {
+			for _, dir := range []string{filepath.Join(cgroupRoot, mount, path), filepath.Join(cgroupRoot, mount)} {
+				quota, readErr := ioutil.ReadFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+				if readErr != nil {
+					continue
+				}
+				period, readErr := ioutil.ReadFile(filepath.Join(dir, "cpu.cfs_period_us"))
+				if readErr != nil {
+					continue
+				}
+				return cpuQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+			}
+		}
+	}
+
+	return 0, false, nil
+}
+
+// cgroupPaths returns the cgroup paths of this process by controller, the
+// cgroup v2 path with the empty controller.
+func cgroupPaths() (map[string]string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	paths := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Lines are hierarchy-ID:controller-list:cgroup-path.
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+
+	return paths, scanner.Err()
+}
+
+// cpuQuota returns the CPU quota of the provided quota and period.
+func cpuQuota(quota, period string) (float64, bool, error) {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	if q <= 0 || p <= 0 {
+		return 0, false, nil
+	}
+
+	return float64(q) / float64(p), true, nil
+}
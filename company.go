@@ -0,0 +1,40 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"strings"
+)
+
+// GetCompany fetches the detail meta data of the company with the provided
+// Entry ID using the provided session. An empty company Entry ID fetches the
+// company of the user accociated with the session.
+func (c *KCC) GetCompany(ctx context.Context, companyEntryID string, sessionID KCSessionID) (*GetCompanyResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:getCompany><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><ulCompanyId>0</ulCompanyId><sCompanyId>")
+	b.WriteString(xmlCharData(companyEntryID).Escape())
+	b.WriteString("</sCompanyId></ns:getCompany>")
+	payload := b.String()
+
+	var getCompanyResponse GetCompanyResponse
+	err := c.Client.DoRequest(ctx, &payload, &getCompanyResponse)
+
+	return &getCompanyResponse, err
+}
@@ -0,0 +1,65 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+var errConnUnexpectedData = errors.New("connection has unexpected data to read")
+
+// connAlive peeks at the provided connection without blocking, to find
+// connections which were closed by their peer.
+func connAlive(conn net.Conn) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var n int
+	var peekErr error
+	var buf [1]byte
+	err = raw.Read(func(fd uintptr) bool {
+		n, _, peekErr = syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		// Never wait for the connection to become readable.
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case peekErr == syscall.EAGAIN || peekErr == syscall.EWOULDBLOCK:
+		return nil
+	case peekErr != nil:
+		return peekErr
+	case n == 0:
+		return io.EOF
+	default:
+		return errConnUnexpectedData
+	}
+}
@@ -0,0 +1,436 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ContactMessageClass is the message class of contacts.
+const ContactMessageClass = "IPM.Contact"
+
+// A Contact represents a contact as stored in a contacts folder.
+type Contact struct {
+	EntryID      string    `json:"entryID,omitempty"`
+	LastModified time.Time `json:"lastModified,omitempty"`
+
+	DisplayName string `json:"displayName"`
+	FileUnder   string `json:"fileUnder,omitempty"`
+	GivenName   string `json:"givenName,omitempty"`
+	MiddleName  string `json:"middleName,omitempty"`
+	Surname     string `json:"surname,omitempty"`
+	Prefix      string `json:"prefix,omitempty"`
+	Suffix      string `json:"suffix,omitempty"`
+	Nickname    string `json:"nickname,omitempty"`
+
+	Company    string `json:"company,omitempty"`
+	Department string `json:"department,omitempty"`
+	Title      string `json:"title,omitempty"`
+
+	Emails []*ContactEmail `json:"emails,omitempty"`
+
+	BusinessPhone string `json:"businessPhone,omitempty"`
+	HomePhone     string `json:"homePhone,omitempty"`
+	MobilePhone   string `json:"mobilePhone,omitempty"`
+	BusinessFax   string `json:"businessFax,omitempty"`
+
+	HomeAddress     *PostalAddress `json:"homeAddress,omitempty"`
+	BusinessAddress *PostalAddress `json:"businessAddress,omitempty"`
+
+	Birthday time.Time `json:"birthday,omitempty"`
+	HomePage string    `json:"homePage,omitempty"`
+	Notes    string    `json:"notes,omitempty"`
+}
+
+// A ContactEmail is an email address of a Contact.
+type ContactEmail struct {
+	Address     string `json:"address"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// A PostalAddress is a postal address of a Contact.
+type PostalAddress struct {
+	Street     string `json:"street,omitempty"`
+	City       string `json:"city,omitempty"`
+	State      string `json:"state,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// IsEmpty returns true if none of the accociated PostalAddress's fields are
+// set.
+func (pa *PostalAddress) IsEmpty() bool {
+	return pa == nil || *pa == PostalAddress{}
+}
+
+// MaxContactEmails is the number of email addresses which can be stored with
+// a Contact.
+const MaxContactEmails = 3
+
+var contactNamedProps = []*NamedProp{
+	PidLidFileUnder,
+	PidLidEmail1DisplayName,
+	PidLidEmail1AddressType,
+	PidLidEmail1EmailAddress,
+	PidLidEmail2DisplayName,
+	PidLidEmail2AddressType,
+	PidLidEmail2EmailAddress,
+	PidLidEmail3DisplayName,
+	PidLidEmail3AddressType,
+	PidLidEmail3EmailAddress,
+}
+
+// contactStringFields maps the string properties of contacts to the
+// accociated Contact fields.
+var contactStringFields = []struct {
+	pt    PT
+	field func(*Contact) *string
+}{
+	{PR_DISPLAY_NAME, func(c *Contact) *string { return &c.DisplayName }},
+	{PR_GIVEN_NAME, func(c *Contact) *string { return &c.GivenName }},
+	{PR_MIDDLE_NAME, func(c *Contact) *string { return &c.MiddleName }},
+	{PR_SURNAME, func(c *Contact) *string { return &c.Surname }},
+	{PR_DISPLAY_NAME_PREFIX, func(c *Contact) *string { return &c.Prefix }},
+	{PR_GENERATION, func(c *Contact) *string { return &c.Suffix }},
+	{PR_NICKNAME, func(c *Contact) *string { return &c.Nickname }},
+	{PR_COMPANY_NAME, func(c *Contact) *string { return &c.Company }},
+	{PR_DEPARTMENT_NAME, func(c *Contact) *string { return &c.Department }},
+	{PR_TITLE, func(c *Contact) *string { return &c.Title }},
+	{PR_BUSINESS_TELEPHONE_NUMBER, func(c *Contact) *string { return &c.BusinessPhone }},
+	{PR_HOME_TELEPHONE_NUMBER, func(c *Contact) *string { return &c.HomePhone }},
+	{PR_MOBILE_TELEPHONE_NUMBER, func(c *Contact) *string { return &c.MobilePhone }},
+	{PR_BUSINESS_FAX_NUMBER, func(c *Contact) *string { return &c.BusinessFax }},
+	{PR_BUSINESS_HOME_PAGE, func(c *Contact) *string { return &c.HomePage }},
+	{PR_BODY, func(c *Contact) *string { return &c.Notes }},
+}
+
+// contactAddressFields maps the address properties of contacts to the
+// accociated PostalAddress fields. The first set is the home address, the
+// second set the business address.
+var contactAddressFields = [2][]struct {
+	pt    PT
+	field func(*PostalAddress) *string
+}{
+	{
+		{PR_HOME_ADDRESS_STREET, func(a *PostalAddress) *string { return &a.Street }},
+		{PR_HOME_ADDRESS_CITY, func(a *PostalAddress) *string { return &a.City }},
+		{PR_HOME_ADDRESS_STATE_OR_PROVINCE, func(a *PostalAddress) *string { return &a.State }},
+		{PR_HOME_ADDRESS_POSTAL_CODE, func(a *PostalAddress) *string { return &a.PostalCode }},
+		{PR_HOME_ADDRESS_COUNTRY, func(a *PostalAddress) *string { return &a.Country }},
+	},
+	{
+		{PR_STREET_ADDRESS, func(a *PostalAddress) *string { return &a.Street }},
+		{PR_LOCALITY, func(a *PostalAddress) *string { return &a.City }},
+		{PR_STATE_OR_PROVINCE, func(a *PostalAddress) *string { return &a.State }},
+		{PR_POSTAL_CODE, func(a *PostalAddress) *string { return &a.PostalCode }},
+		{PR_COUNTRY, func(a *PostalAddress) *string { return &a.Country }},
+	},
+}
+
+// contactProps returns all prop tags which are mapped to Contact fields. The
+// tags must be the resolved contactNamedProps.
+func contactProps(tags []PT) []PT {
+	props := []PT{
+		PR_ENTRYID,
+		PR_MESSAGE_CLASS,
+		PR_LAST_MODIFICATION_TIME,
+		PR_BIRTHDAY,
+	}
+	for _, entry := range contactStringFields {
+		props = append(props, entry.pt)
+	}
+	for _, fields := range contactAddressFields {
+		for _, entry := range fields {
+			props = append(props, entry.pt)
+		}
+	}
+
+	return append(props, tags...)
+}
+
+// newContactFromProps maps the provided properties to a Contact. The tags must
+// be the resolved contactNamedProps.
+func newContactFromProps(props *PropTagRowSet, tags []PT) *Contact {
+	contact := &Contact{
+		LastModified: props.GetTime(PR_LAST_MODIFICATION_TIME),
+		Birthday:     props.GetTime(PR_BIRTHDAY),
+		FileUnder:    props.GetString(tags[0]),
+	}
+	if value, ok := props.Get(PR_ENTRYID); ok {
+		contact.EntryID = string(value.BinValue)
+	}
+	for _, entry := range contactStringFields {
+		*entry.field(contact) = props.GetString(entry.pt)
+	}
+	for idx, fields := range contactAddressFields {
+		address := &PostalAddress{}
+		for _, entry := range fields {
+			*entry.field(address) = props.GetString(entry.pt)
+		}
+		if address.IsEmpty() {
+			continue
+		}
+		if idx == 0 {
+			contact.HomeAddress = address
+		} else {
+			contact.BusinessAddress = address
+		}
+	}
+	for idx := 0; idx < MaxContactEmails; idx++ {
+		address := props.GetString(tags[1+idx*3+2])
+		if address == "" {
+			continue
+		}
+		contact.Emails = append(contact.Emails, &ContactEmail{
+			Address:     address,
+			DisplayName: props.GetString(tags[1+idx*3]),
+		})
+	}
+
+	return contact
+}
+
+// contactSaveProps returns the properties to set and to delete for the
+// provided contact. The tags must be the resolved contactNamedProps.
+func contactSaveProps(contact *Contact, tags []PT) ([]*PropTagRowSetValue, []PT, error) {
+	if len(contact.Emails) > MaxContactEmails {
+		return nil, nil, fmt.Errorf("contact has more than %d email addresses", MaxContactEmails)
+	}
+
+	var modProps []*PropTagRowSetValue
+	var delProps []PT
+	setString := func(pt PT, value string) {
+		if value != "" {
+			modProps = append(modProps, StringPropValue(pt, value))
+		} else {
+			delProps = append(delProps, pt)
+		}
+	}
+
+	modProps = append(modProps, StringPropValue(PR_MESSAGE_CLASS, ContactMessageClass))
+	for _, entry := range contactStringFields {
+		setString(entry.pt, *entry.field(contact))
+	}
+	for idx, address := range []*PostalAddress{contact.HomeAddress, contact.BusinessAddress} {
+		if address == nil {
+			address = &PostalAddress{}
+		}
+		for _, entry := range contactAddressFields[idx] {
+			setString(entry.pt, *entry.field(address))
+		}
+	}
+	if !contact.Birthday.IsZero() {
+		modProps = append(modProps, TimePropValue(PR_BIRTHDAY, contact.Birthday))
+	} else {
+		delProps = append(delProps, PR_BIRTHDAY)
+	}
+
+	fileUnder := contact.FileUnder
+	if fileUnder == "" {
+		fileUnder = contact.DisplayName
+	}
+	setString(tags[0], fileUnder)
+	for idx := 0; idx < MaxContactEmails; idx++ {
+		var email *ContactEmail
+		if idx < len(contact.Emails) {
+			email = contact.Emails[idx]
+		}
+		if email == nil || email.Address == "" {
+			delProps = append(delProps, tags[1+idx*3], tags[1+idx*3+1], tags[1+idx*3+2])
+			continue
+		}
+		displayName := email.DisplayName
+		if displayName == "" {
+			displayName = email.Address
+		}
+		modProps = append(modProps,
+			StringPropValue(tags[1+idx*3], displayName),
+			StringPropValue(tags[1+idx*3+1], "SMTP"),
+			StringPropValue(tags[1+idx*3+2], email.Address),
+		)
+	}
+
+	return modProps, delProps, nil
+}
+
+// ListContacts lists the contacts in the folder with the provided Entry ID
+// using the provided session. An empty folder Entry ID lists the default
+// contacts folder of the session's user.
+func (c *KCC) ListContacts(ctx context.Context, folderEntryID string, sessionID KCSessionID) ([]*Contact, error) {
+	if folderEntryID == "" {
+		var err error
+		folderEntryID, err = c.DefaultFolderEntryID(ctx, PR_IPM_CONTACT_ENTRYID, sessionID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tags, err := c.NamedPropTags(ctx, sessionID, contactNamedProps...)
+	if err != nil {
+		return nil, fmt.Errorf("list contacts named props failed: %v", err)
+	}
+
+	var contacts []*Contact
+	err = c.QueryTableRows(ctx, folderEntryID, TABLETYPE_MS, MAPI_MESSAGE, 0, contactProps(tags), sessionID, func(rows []*PropTagRowSet) error {
+		for _, row := range rows {
+			if ItemTypeFromMessageClass(row.GetString(PR_MESSAGE_CLASS)) != ItemTypeContact {
+				continue
+			}
+			contacts = append(contacts, newContactFromProps(row, tags))
+		}
+		return nil
+	})
+
+	return contacts, err
+}
+
+// GetContact loads the contact with the provided Entry ID using the provided
+// session. An error is returned if the message is not a contact.
+func (c *KCC) GetContact(ctx context.Context, entryID string, sessionID KCSessionID) (*Contact, error) {
+	tags, err := c.NamedPropTags(ctx, sessionID, contactNamedProps...)
+	if err != nil {
+		return nil, fmt.Errorf("get contact named props failed: %v", err)
+	}
+
+	object, err := c.loadContactObject(ctx, entryID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	contact := newContactFromProps(object.Props(), tags)
+	contact.EntryID = entryID
+
+	return contact, nil
+}
+
+// CreateContact creates the provided contact in the folder with the provided
+// Entry ID using the provided session. An empty folder Entry ID creates the
+// contact in the default contacts folder of the session's user. The Entry ID
+// of the new contact is returned.
+func (c *KCC) CreateContact(ctx context.Context, folderEntryID string, contact *Contact, sessionID KCSessionID) (string, error) {
+	if folderEntryID == "" {
+		var err error
+		folderEntryID, err = c.DefaultFolderEntryID(ctx, PR_IPM_CONTACT_ENTRYID, sessionID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	tags, err := c.NamedPropTags(ctx, sessionID, contactNamedProps...)
+	if err != nil {
+		return "", fmt.Errorf("create contact named props failed: %v", err)
+	}
+
+	modProps, _, err := contactSaveProps(contact, tags)
+	if err != nil {
+		return "", err
+	}
+
+	return c.CreateMessage(ctx, folderEntryID, append([]*PropTagRowSetValue{
+		ULPropValue(PR_MESSAGE_FLAGS, uint64(MSGFLAG_READ)),
+	}, modProps...), nil, sessionID)
+}
+
+// UpdateContact replaces the data of the contact with the Entry ID of the
+// provided contact with the provided contact's data using the provided
+// session. Fields which are empty in the provided contact are removed.
+func (c *KCC) UpdateContact(ctx context.Context, contact *Contact, sessionID KCSessionID) error {
+	if contact.EntryID == "" {
+		return fmt.Errorf("update contact without entry ID")
+	}
+
+	tags, err := c.NamedPropTags(ctx, sessionID, contactNamedProps...)
+	if err != nil {
+		return fmt.Errorf("update contact named props failed: %v", err)
+	}
+
+	modProps, delProps, err := contactSaveProps(contact, tags)
+	if err != nil {
+		return err
+	}
+
+	existing, err := c.loadContactObject(ctx, contact.EntryID, sessionID)
+	if err != nil {
+		return err
+	}
+	parent, ok := existing.Props().Get(PR_PARENT_ENTRYID)
+	if !ok {
+		return fmt.Errorf("update contact has no parent entry ID")
+	}
+
+	// Only delete properties which actually exist.
+	existingProps := existing.Props()
+	var del []PT
+	for _, pt := range delProps {
+		if _, ok := existingProps.Get(pt); ok {
+			del = append(del, pt)
+		}
+	}
+
+	object := &SaveObject{
+		ModProps: modProps,
+		DelProps: del,
+		ServerID: existing.ServerID,
+		ObjType:  MAPI_MESSAGE,
+	}
+
+	saved, err := c.SaveObject(ctx, string(parent.BinValue), contact.EntryID, object, 0, sessionID)
+	if err != nil {
+		return fmt.Errorf("update contact saveObject failed: %v", err)
+	}
+	if saved.Er != KCSuccess {
+		return saved.Er
+	}
+
+	return nil
+}
+
+// DeleteContact deletes the contact with the provided Entry ID using the
+// provided session.
+func (c *KCC) DeleteContact(ctx context.Context, entryID string, sessionID KCSessionID) error {
+	resp, err := c.DeleteObjects(ctx, []string{entryID}, 0, sessionID)
+	if err != nil {
+		return fmt.Errorf("delete contact deleteObjects failed: %v", err)
+	}
+	if resp.Er != KCSuccess {
+		return resp.Er
+	}
+
+	return nil
+}
+
+func (c *KCC) loadContactObject(ctx context.Context, entryID string, sessionID KCSessionID) (*SaveObject, error) {
+	resp, err := c.LoadObject(ctx, entryID, 0, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("contact loadObject failed: %v", err)
+	}
+	if resp.Er != KCSuccess {
+		return nil, resp.Er
+	}
+	if resp.Object == nil {
+		return nil, fmt.Errorf("contact loadObject returned no object")
+	}
+
+	messageClass := resp.Object.Props().GetString(PR_MESSAGE_CLASS)
+	if ItemTypeFromMessageClass(messageClass) != ItemTypeContact {
+		return nil, fmt.Errorf("message is not a contact: %v", messageClass)
+	}
+
+	return resp.Object, nil
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"strings"
+)
+
+// contentLineLength is the maximum length of content lines in vCard and
+// iCalendar data, which share the same content line format.
+const contentLineLength = 75
+
+// writeContentLine writes the provided content line to the provided buffer,
+// folding it as needed. The value must already be escaped.
+func writeContentLine(b *bytes.Buffer, name string, params []string, value string) {
+	line := name
+	if len(params) > 0 {
+		line += ";" + strings.Join(params, ";")
+	}
+	line += ":" + value
+
+	// Fold at the line length limit, without splitting UTF-8 sequences.
+	// Continuation lines start with a space, which counts towards the limit.
+	limit := contentLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		limit = contentLineLength - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+var contentTextEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\n", "\\n",
+	"\r", "",
+	",", "\\,",
+	";", "\\;",
+)
+
+func escapeContentText(value string) string {
+	return contentTextEscaper.Replace(value)
+}
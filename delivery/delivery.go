@@ -0,0 +1,163 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// Errors of recipients which cannot be delivered to.
+var (
+	ErrGroupRecipient = errors.New("delivery to groups is not supported")
+	ErrQuotaExceeded  = errors.New("recipient is over quota")
+)
+
+// errDuplicateFound stops the scan of the Inbox for duplicates.
+var errDuplicateFound = errors.New("duplicate found")
+
+// A Result is the result of the delivery of a message to a single recipient.
+// Either EntryID is set, Duplicate is true or Err is set.
+type Result struct {
+	Index     int
+	Recipient string
+	Username  string
+	EntryID   string
+	Duplicate bool
+	Err       error
+}
+
+// A Deliverer delivers messages into the Inbox of Kopano users using a session
+// which must have access to the stores of all recipients, like a session of
+// the SYSTEM user.
+type Deliverer struct {
+	// DuplicateDetection makes the Deliverer skip messages which are already
+	// in the Inbox of a recipient, detected by their Message-ID header. The
+	// Inbox is scanned for every delivery of a message with Message-ID.
+	DuplicateDetection bool
+
+	c         kcc.KopanoClient
+	sessionID kcc.KCSessionID
+	now       func() time.Time
+}
+
+// New creates a new Deliverer using the provided client and session, with
+// duplicate detection enabled.
+func New(c kcc.KopanoClient, sessionID kcc.KCSessionID) *Deliverer {
+	return &Deliverer{
+		DuplicateDetection: true,
+
+		c:         c,
+		sessionID: sessionID,
+		now:       time.Now,
+	}
+}
+
+// Deliver delivers the provided RFC 2822 message to the provided recipient
+// addresses, which are resolved with a single request. A result is returned
+// for each recipient at the same index, so LMTP servers can reply with a
+// status per recipient. Recipients which do not exist fail with
+// KCERR_NOT_FOUND, groups with ErrGroupRecipient and recipients over quota
+// with ErrQuotaExceeded. An error is only returned if the message cannot be
+// parsed or the recipients cannot be resolved.
+func (d *Deliverer) Deliver(ctx context.Context, recipients []string, raw []byte) ([]*Result, error) {
+	msg, err := parseMessage(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := d.c.ResolveRecipients(ctx, recipients, d.sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("delivery failed to resolve recipients: %v", err)
+	}
+
+	results := make([]*Result, len(resolved))
+	for idx, recipient := range resolved {
+		result := &Result{
+			Index:     idx,
+			Recipient: recipient.Address,
+			Username:  recipient.Username,
+		}
+		results[idx] = result
+		switch {
+		case recipient.Err != nil:
+			result.Err = recipient.Err
+		case recipient.Group:
+			result.Err = ErrGroupRecipient
+		case recipient.Quota == kcc.RecipientQuotaExceeded:
+			result.Err = ErrQuotaExceeded
+		default:
+			result.EntryID, result.Duplicate, result.Err = d.deliver(ctx, recipient, msg)
+		}
+	}
+
+	return results, nil
+}
+
+// deliver imports the provided message into the Inbox of the provided
+// recipient, unless it is a duplicate.
+func (d *Deliverer) deliver(ctx context.Context, recipient *kcc.RecipientResult, msg *message) (string, bool, error) {
+	store, err := d.c.OpenUserStore(ctx, recipient.Username, d.sessionID)
+	if err != nil {
+		return "", false, err
+	}
+	folder, err := d.c.GetReceiveFolder(ctx, store.EntryID, "", d.sessionID)
+	if err != nil {
+		return "", false, fmt.Errorf("delivery getReceiveFolder failed: %v", err)
+	}
+	if folder.Er != kcc.KCSuccess {
+		return "", false, folder.Er
+	}
+
+	if d.DuplicateDetection && msg.messageID != "" {
+		duplicate, err := d.isDuplicate(ctx, folder.EntryID, msg.messageID)
+		if err != nil {
+			return "", false, err
+		}
+		if duplicate {
+			return "", true, nil
+		}
+	}
+
+	entryID, err := d.c.ImportMessage(ctx, folder.EntryID, msg.importMessage(recipient, d.now()), d.sessionID)
+	return entryID, false, err
+}
+
+// isDuplicate returns true if the folder with the provided Entry ID contains a
+// message with the provided Message-ID.
+func (d *Deliverer) isDuplicate(ctx context.Context, folderEntryID string, messageID string) (bool, error) {
+	err := d.c.QueryTableRows(ctx, folderEntryID, kcc.TABLETYPE_MS, kcc.MAPI_MESSAGE, 0, []kcc.PT{kcc.PR_INTERNET_MESSAGE_ID}, d.sessionID, func(rows []*kcc.PropTagRowSet) error {
+		for _, row := range rows {
+			if row.GetString(kcc.PR_INTERNET_MESSAGE_ID) == messageID {
+				return errDuplicateFound
+			}
+		}
+		return nil
+	})
+	switch err {
+	case nil:
+		return false, nil
+	case errDuplicateFound:
+		return true, nil
+	default:
+		return false, fmt.Errorf("delivery duplicate detection failed: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package delivery
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+	"stash.kopano.io/kgol/kcc-go/mock"
+)
+
+const testMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: User 1 <user1@example.com>\r\n" +
+	"Cc: dup@example.com, =?utf-8?q?J=C3=B6rg?= <joerg@example.com>\r\n" +
+	"Subject: =?utf-8?q?Hello_W=C3=B6rld?=\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 +0000\r\n" +
+	"Message-ID: <id1@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=b1\r\n" +
+	"\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Caf=C3=A9 at noon?\r\n" +
+	"--b1\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>Caf&eacute; at noon?</p>\r\n" +
+	"--b1--\r\n"
+
+func getProp(props []*kcc.PropTagRowSetValue, pt kcc.PT) *kcc.PropTagRowSetValue {
+	for _, prop := range props {
+		if prop.PropTag == pt {
+			return prop
+		}
+	}
+	return nil
+}
+
+func TestDeliver(t *testing.T) {
+	var imported []*kcc.ImportMessage
+	client := &mock.KopanoClient{
+		ResolveRecipientsFunc: func(ctx context.Context, addresses []string, sessionID kcc.KCSessionID) ([]*kcc.RecipientResult, error) {
+			return []*kcc.RecipientResult{
+				{Index: 0, Address: addresses[0], Exists: true, Username: "user1", MailAddress: "user1@example.com", Quota: kcc.RecipientQuotaOK},
+				{Index: 1, Address: addresses[1], Exists: true, Username: "dup", MailAddress: "dup@example.com"},
+				{Index: 2, Address: addresses[2], Exists: true, Group: true},
+				{Index: 3, Address: addresses[3], Exists: true, Username: "full", Quota: kcc.RecipientQuotaExceeded},
+				{Index: 4, Address: addresses[4], Err: kcc.KCERR_NOT_FOUND},
+			}, nil
+		},
+		OpenUserStoreFunc: func(ctx context.Context, username string, sessionID kcc.KCSessionID) (*kcc.Store, error) {
+			return &kcc.Store{EntryID: "store-" + username}, nil
+		},
+		GetReceiveFolderFunc: func(ctx context.Context, storeEntryID string, messageClass string, sessionID kcc.KCSessionID) (*kcc.GetReceiveFolderResponse, error) {
+			return &kcc.GetReceiveFolderResponse{EntryID: "inbox-" + storeEntryID}, nil
+		},
+		QueryTableRowsFunc: func(ctx context.Context, entryID string, tableType kcc.TableType, objType kcc.MAPIType, flags kcc.KCFlag, props []kcc.PT, sessionID kcc.KCSessionID, cb func([]*kcc.PropTagRowSet) error) error {
+			messageID := "<other@example.com>"
+			if entryID == "inbox-store-dup" {
+				messageID = "<id1@example.com>"
+			}
+			return cb([]*kcc.PropTagRowSet{{PropTagValues: []*kcc.PropTagRowSetValue{
+				kcc.StringPropValue(kcc.PR_INTERNET_MESSAGE_ID, messageID),
+			}}})
+		},
+		ImportMessageFunc: func(ctx context.Context, folderEntryID string, message *kcc.ImportMessage, sessionID kcc.KCSessionID) (string, error) {
+			if folderEntryID != "inbox-store-user1" {
+				t.Errorf("unexpected import folder: %s", folderEntryID)
+			}
+			imported = append(imported, message)
+			return "msg1", nil
+		},
+	}
+	now := time.Date(2006, 1, 2, 16, 0, 0, 0, time.UTC)
+	d := New(client, 1)
+	d.now = func() time.Time { return now }
+
+	results, err := d.Deliver(context.Background(), []string{"user1@example.com", "dup@example.com", "group@example.com", "full@example.com", "nobody@example.com"}, []byte(testMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 5 {
+		t.Fatalf("unexpected number of results: %d", len(results))
+	}
+	if results[0].Err != nil || results[0].EntryID != "msg1" || results[0].Duplicate {
+		t.Errorf("unexpected result 0: %+v", results[0])
+	}
+	if results[1].Err != nil || results[1].EntryID != "" || !results[1].Duplicate {
+		t.Errorf("unexpected result 1: %+v", results[1])
+	}
+	for idx, expected := range map[int]error{2: ErrGroupRecipient, 3: ErrQuotaExceeded, 4: kcc.KCERR_NOT_FOUND} {
+		if results[idx].Err != expected {
+			t.Errorf("unexpected result %d: %+v", idx, results[idx])
+		}
+	}
+
+	if len(imported) != 1 {
+		t.Fatalf("unexpected number of imported messages: %d", len(imported))
+	}
+	message := imported[0]
+	for pt, expected := range map[kcc.PT]string{
+		kcc.PR_MESSAGE_CLASS:             "IPM.Note",
+		kcc.PR_SUBJECT:                   "Hello Wörld",
+		kcc.PR_INTERNET_MESSAGE_ID:       "<id1@example.com>",
+		kcc.PR_BODY:                      "Café at noon?",
+		kcc.PR_RECEIVED_BY_EMAIL_ADDRESS: "user1@example.com",
+	} {
+		if prop := getProp(message.Props, pt); prop == nil || strings.TrimSpace(prop.AStringValue) != expected {
+			t.Errorf("unexpected prop %v: %+v", pt, prop)
+		}
+	}
+	if prop := getProp(message.Props, kcc.PR_EC_IMAP_EMAIL); prop == nil {
+		t.Errorf("missing raw message")
+	} else if raw, _ := prop.Bytes(); string(raw) != testMessage {
+		t.Errorf("unexpected raw message: %s", raw)
+	}
+	if prop := getProp(message.Props, kcc.PR_TRANSPORT_MESSAGE_HEADERS); prop == nil || !strings.HasSuffix(prop.AStringValue, "boundary=b1\r\n") {
+		t.Errorf("unexpected transport headers: %+v", prop)
+	}
+	if message.Sender == nil || message.Sender.Email != "alice@example.com" || message.Sender.DisplayName != "Alice" {
+		t.Errorf("unexpected sender: %+v", message.Sender)
+	}
+	if len(message.Recipients) != 3 || message.Recipients[2].DisplayName != "Jörg" || message.Recipients[2].Type != kcc.MAPI_CC {
+		t.Errorf("unexpected recipients: %+v", message.Recipients)
+	}
+	if !message.DeliveryTime.Equal(now) || !message.SubmitTime.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected times: %v %v", message.DeliveryTime, message.SubmitTime)
+	}
+}
+
+func TestParseMessageBody(t *testing.T) {
+	msg, err := parseMessage([]byte("Subject: test\n" +
+		"Content-Type: text/plain; charset=ISO-8859-1\n" +
+		"Content-Transfer-Encoding: base64\n" +
+		"\n" +
+		"Q2Fm6SBhdCBu\nb29uPw==\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.messageID != "" || msg.sender != nil || len(msg.recipients) != 0 {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if prop := getProp(msg.props, kcc.PR_BODY); prop == nil || prop.AStringValue != "Café at noon?" {
+		t.Errorf("unexpected body: %+v", prop)
+	}
+	if prop := getProp(msg.props, kcc.PR_INTERNET_MESSAGE_ID); prop != nil {
+		t.Errorf("unexpected message ID: %+v", prop)
+	}
+
+	if _, err := parseMessage([]byte("no header\r\n")); err == nil {
+		t.Errorf("expected error for invalid message")
+	}
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package delivery
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// maxBodyDepth limits the nesting of multipart messages which is searched for
+// the plain text body.
+const maxBodyDepth = 8
+
+// A message is a parsed RFC 2822 message, ready to be imported for every
+// recipient.
+type message struct {
+	messageID  string
+	props      []*kcc.PropTagRowSetValue
+	recipients []*kcc.Recipient
+	sender     *kcc.Recipient
+	date       time.Time
+}
+
+// parseMessage parses the provided RFC 2822 message. The raw message is kept
+// in PR_EC_IMAP_EMAIL, so the server can provide it to IMAP clients unchanged.
+func parseMessage(raw []byte) (*message, error) {
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("delivery failed to parse message: %v", err)
+	}
+
+	decoder := &mime.WordDecoder{}
+	header := parsed.Header
+	msg := &message{
+		messageID: strings.TrimSpace(header.Get("Message-Id")),
+	}
+	msg.date, _ = header.Date()
+
+	subject := header.Get("Subject")
+	if decoded, err := decoder.DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	msg.props = []*kcc.PropTagRowSetValue{
+		kcc.StringPropValue(kcc.PR_MESSAGE_CLASS, "IPM.Note"),
+		kcc.StringPropValue(kcc.PR_SUBJECT, validUTF8(subject)),
+		kcc.StringPropValue(kcc.PR_TRANSPORT_MESSAGE_HEADERS, validUTF8(string(rawHeader(raw)))),
+		kcc.BinPropValue(kcc.PR_EC_IMAP_EMAIL, raw),
+		kcc.ULPropValue(kcc.PR_EC_IMAP_EMAIL_SIZE, uint64(len(raw))),
+	}
+	if msg.messageID != "" {
+		msg.props = append(msg.props, kcc.StringPropValue(kcc.PR_INTERNET_MESSAGE_ID, validUTF8(msg.messageID)))
+	}
+	if body, ok := textBody(header.Get("Content-Type"), header.Get("Content-Transfer-Encoding"), parsed.Body, 0); ok {
+		msg.props = append(msg.props, kcc.StringPropValue(kcc.PR_BODY, body))
+	}
+
+	parser := &mail.AddressParser{WordDecoder: decoder}
+	if from, err := parser.Parse(header.Get("From")); err == nil {
+		msg.sender = &kcc.Recipient{
+			DisplayName: from.Name,
+			Email:       from.Address,
+		}
+	}
+	for _, field := range []struct {
+		name          string
+		recipientType kcc.RecipientType
+	}{
+		{"To", kcc.MAPI_TO},
+		{"Cc", kcc.MAPI_CC},
+	} {
+		addresses, err := parser.ParseList(header.Get(field.name))
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			msg.recipients = append(msg.recipients, &kcc.Recipient{
+				Type:        field.recipientType,
+				DisplayName: address.Name,
+				Email:       address.Address,
+			})
+		}
+	}
+
+	return msg, nil
+}
+
+// importMessage returns the accociated message as kcc.ImportMessage for the
+// provided recipient, delivered at the provided time.
+func (msg *message) importMessage(recipient *kcc.RecipientResult, now time.Time) *kcc.ImportMessage {
+	address := recipient.MailAddress
+	if address == "" {
+		address = recipient.Address
+	}
+	props := append(make([]*kcc.PropTagRowSetValue, 0, len(msg.props)+3), msg.props...)
+	props = append(props,
+		kcc.StringPropValue(kcc.PR_RECEIVED_BY_NAME, recipient.Username),
+		kcc.StringPropValue(kcc.PR_RECEIVED_BY_EMAIL_ADDRESS, address),
+		kcc.StringPropValue(kcc.PR_RECEIVED_BY_ADDRTYPE, "SMTP"),
+	)
+
+	submitTime := msg.date
+	if submitTime.IsZero() {
+		submitTime = now
+	}
+
+	return &kcc.ImportMessage{
+		Props:        props,
+		Recipients:   msg.recipients,
+		Sender:       msg.sender,
+		DeliveryTime: now,
+		SubmitTime:   submitTime,
+	}
+}
+
+// rawHeader returns the header section of the provided raw message, without
+// the empty line which separates it from the body.
+func rawHeader(raw []byte) []byte {
+	for _, sep := range [][]byte{[]byte("\r\n\r\n"), []byte("\n\n")} {
+		if idx := bytes.Index(raw, sep); idx >= 0 {
+			return raw[:idx+len(sep)/2]
+		}
+	}
+	return raw
+}
+
+// textBody returns the decoded plain text body of a message or message part
+// with the provided content type and transfer encoding, searching multipart
+// messages for their first text/plain part which is no attachment. Only
+// UTF-8, US-ASCII and ISO-8859-1 texts are decoded.
+func textBody(contentType string, encoding string, body io.Reader, depth int) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if contentType == "" || err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxBodyDepth || params["boundary"] == "" {
+			return "", false
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				return "", false
+			}
+			if disposition, _, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition")); disposition == "attachment" {
+				continue
+			}
+			// NOTE(longsleep): NextPart decodes quoted-printable parts and
+			// removes their Content-Transfer-Encoding header.
+			if text, ok := textBody(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part, depth+1); ok {
+				return text, true
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(params["charset"]) {
+	case "", "utf-8", "us-ascii":
+		return validUTF8(string(data)), true
+	case "iso-8859-1", "latin1":
+		runes := make([]rune, len(data))
+		for idx, c := range data {
+			runes[idx] = rune(c)
+		}
+		return string(runes), true
+	default:
+		return "", false
+	}
+}
+
+// validUTF8 replaces invalid UTF-8 sequences in the provided string, as SOAP
+// requests must be valid XML.
+func validUTF8(s string) string {
+	if utf8.ValidString(s) {
+		return s
+	}
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
@@ -0,0 +1,243 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// diskCacheSuffix is the file name suffix of DiskUserCache entries.
+const diskCacheSuffix = ".user"
+
+// A CachedUser is a user record read from a DiskUserCache. Stale is true if
+// the record is older than the TTL of the cache, stale records should only be
+// used when the Kopano server is unreachable and marked as such.
+type CachedUser struct {
+	User   *User
+	Stored time.Time
+	Stale  bool
+}
+
+// A DiskUserCache persists user records by username in a directory, so they
+// survive restarts and can be served when the Kopano server is unreachable.
+// Every user is stored in its own file named after the hash of the username,
+// encoded with EncodeCacheValue. Records are fresh for the TTL of the cache,
+// after that they are returned as stale until they reach the maximum age.
+// Users are removed when a matching Invalidation is published on the
+// InvalidationBus the cache subscribed to. A DiskUserCache is safe for
+// concurrent use.
+type DiskUserCache struct {
+	dir    string
+	ttl    time.Duration
+	maxAge time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]string // key -> user entry ID
+
+	unsubscribe func()
+}
+
+// NewDiskUserCache opens or creates the provided directory as DiskUserCache,
+// with records being fresh for ttl and removed after maxAge. A maxAge of 0
+// keeps records until they are replaced or invalidated. Records which are
+// too old or were written with a different schema version are removed. If
+// bus is nil, DefaultInvalidationBus is used.
+func NewDiskUserCache(dir string, ttl, maxAge time.Duration, bus *InvalidationBus) (*DiskUserCache, error) {
+	if bus == nil {
+		bus = DefaultInvalidationBus
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("disk user cache create failed: %v", err)
+	}
+
+	dc := &DiskUserCache{
+		dir:    dir,
+		ttl:    ttl,
+		maxAge: maxAge,
+
+		entries: make(map[string]string),
+	}
+	if err := dc.load(); err != nil {
+		return nil, fmt.Errorf("disk user cache load failed: %v", err)
+	}
+	dc.unsubscribe = bus.Subscribe(dc.invalidate)
+
+	return dc, nil
+}
+
+// Get returns the stored user of the provided username. The second return
+// value is false if the user is not stored or too old.
+func (dc *DiskUserCache) Get(username string) (*CachedUser, bool) {
+	key := dc.key(username)
+
+	dc.mutex.Lock()
+	_, ok := dc.entries[key]
+	dc.mutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	cached, err := dc.read(key)
+	if err != nil || dc.expired(cached) {
+		dc.remove(key)
+		return nil, false
+	}
+
+	return cached, true
+}
+
+// Set stores the provided user for the provided username.
+func (dc *DiskUserCache) Set(username string, user *User) error {
+	value, err := EncodeCacheValue(user)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(data, uint64(time.Now().UnixNano()))
+	data = append(data, value...)
+
+	key := dc.key(username)
+	f, err := ioutil.TempFile(dc.dir, key+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+	if err = os.Rename(f.Name(), filepath.Join(dc.dir, key+diskCacheSuffix)); err != nil {
+		return err
+	}
+	dc.entries[key] = user.UserEntryID
+
+	return nil
+}
+
+// Remove removes the stored user of the provided username.
+func (dc *DiskUserCache) Remove(username string) {
+	dc.remove(dc.key(username))
+}
+
+// Len returns the number of stored users of the accociated DiskUserCache.
+func (dc *DiskUserCache) Len() int {
+	dc.mutex.Lock()
+	defer dc.mutex.Unlock()
+
+	return len(dc.entries)
+}
+
+// Close unsubscribes the accociated DiskUserCache from its InvalidationBus.
+func (dc *DiskUserCache) Close() {
+	dc.unsubscribe()
+}
+
+func (dc *DiskUserCache) key(username string) string {
+	sum := sha256.Sum256([]byte(username))
+	return hex.EncodeToString(sum[:])
+}
+
+func (dc *DiskUserCache) read(key string) (*CachedUser, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dc.dir, key+diskCacheSuffix))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, ErrCacheInvalidValue
+	}
+
+	var user User
+	if err = DecodeCacheValue(data[8:], &user); err != nil {
+		return nil, err
+	}
+	stored := time.Unix(0, int64(binary.BigEndian.Uint64(data)))
+
+	return &CachedUser{
+		User:   &user,
+		Stored: stored,
+		Stale:  time.Since(stored) > dc.ttl,
+	}, nil
+}
+
+func (dc *DiskUserCache) expired(cached *CachedUser) bool {
+	return dc.maxAge > 0 && time.Since(cached.Stored) > dc.maxAge
+}
+
+func (dc *DiskUserCache) remove(key string) {
+	dc.mutex.Lock()
+	delete(dc.entries, key)
+	os.Remove(filepath.Join(dc.dir, key+diskCacheSuffix))
+	dc.mutex.Unlock()
+}
+
+// load indexes the stored users, removing the ones which cannot be used.
+func (dc *DiskUserCache) load() error {
+	infos, err := ioutil.ReadDir(dc.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		if strings.Contains(name, ".tmp") {
+			// Left over from an interrupted Set.
+			os.Remove(filepath.Join(dc.dir, name))
+			continue
+		}
+		if info.IsDir() || !strings.HasSuffix(name, diskCacheSuffix) {
+			continue
+		}
+		key := strings.TrimSuffix(name, diskCacheSuffix)
+		cached, readErr := dc.read(key)
+		if readErr != nil || dc.expired(cached) {
+			os.Remove(filepath.Join(dc.dir, name))
+			continue
+		}
+		dc.entries[key] = cached.User.UserEntryID
+	}
+
+	return nil
+}
+
+// invalidate removes the users matching the provided invalidation. The cache
+// does not know the server of its users, so the server GUID is not checked.
+func (dc *DiskUserCache) invalidate(inv *Invalidation) {
+	dc.mutex.Lock()
+	for key, entryID := range dc.entries {
+		if inv.EntryID == "" || inv.EntryID == entryID {
+			delete(dc.entries, key)
+			os.Remove(filepath.Join(dc.dir, key+diskCacheSuffix))
+		}
+	}
+	dc.mutex.Unlock()
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDiskUserCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kcc-go-diskcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	bus := NewInvalidationBus()
+	dc, err := NewDiskUserCache(dir, time.Nanosecond, 0, bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dc.Set("user1", &User{Username: "user1", UserEntryID: "user1-id"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = dc.Set("user2", &User{Username: "user2", UserEntryID: "user2-id"}); err != nil {
+		t.Fatal(err)
+	}
+	dc.Close()
+
+	// Reopen, records survive and are stale after the TTL.
+	dc, err = NewDiskUserCache(dir, time.Nanosecond, 0, bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dc.Close()
+	if dc.Len() != 2 {
+		t.Errorf("unexpected number of records after reopen: %d", dc.Len())
+	}
+	cached, ok := dc.Get("user1")
+	if !ok || cached.User.Username != "user1" || !cached.Stale {
+		t.Errorf("unexpected cached user: %+v", cached)
+	}
+
+	bus.Publish(&Invalidation{EntryID: "user1-id"})
+	if _, ok = dc.Get("user1"); ok {
+		t.Errorf("invalidated user still cached")
+	}
+	if _, ok = dc.Get("user2"); !ok {
+		t.Errorf("other user was invalidated")
+	}
+
+	dc.maxAge = time.Nanosecond
+	if _, ok = dc.Get("user2"); ok || dc.Len() != 0 {
+		t.Errorf("too old user still cached")
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+)
+
+// Version numbers as used by Kopano store EntryID implementations.
+const (
+	EIDV1VersionNumber = 1
+)
+
+// An EID defines a Kopano store object EntryID of version 1 as defined in
+// common/include/kopano/ECDefs.h.
+type EID struct {
+	ABFlags  [4]byte
+	GUID     [16]byte
+	Version  uint32
+	Type     uint16
+	Flags    uint16
+	UniqueID [16]byte
+	Server   [4]byte
+}
+
+// NewEIDV1 creates a new random EntryID for an object of the provided type in
+// the store identified by the provided store GUID. Kopano server expects
+// clients to generate the EntryIDs of new objects like this.
+func NewEIDV1(storeGUID [16]byte, typE MAPIType) (*EID, error) {
+	eid := &EID{
+		GUID:    storeGUID,
+		Version: EIDV1VersionNumber,
+		Type:    uint16(typE),
+	}
+	if _, err := rand.Read(eid.UniqueID[:]); err != nil {
+		return nil, err
+	}
+
+	return eid, nil
+}
+
+// NewEIDFromBase64 takes a base64Std encoded byte value and returns the EID
+// represented by those bytes.
+func NewEIDFromBase64(base64Value []byte) (*EID, error) {
+	value := make([]byte, base64.StdEncoding.DecodedLen(len(base64Value)))
+
+	n, err := base64.StdEncoding.Decode(value, base64Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var eid EID
+	err = binary.Read(bytes.NewReader(value[:n]), binary.LittleEndian, &eid)
+	if err != nil {
+		return nil, err
+	}
+	if eid.Version != EIDV1VersionNumber {
+		return nil, fmt.Errorf("EID unsupported version %d", eid.Version)
+	}
+
+	return &eid, nil
+}
+
+// String returns the base64Std encoded representation of the accociated EID as
+// used in SOAP requests.
+func (eid *EID) String() string {
+	buf := new(bytes.Buffer)
+	enc := base64.NewEncoder(base64.StdEncoding, buf)
+	binary.Write(enc, binary.LittleEndian, eid)
+	enc.Close()
+
+	return buf.String()
+}
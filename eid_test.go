@@ -0,0 +1,54 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"testing"
+)
+
+func TestEIDV1RoundTrip(t *testing.T) {
+	guid := [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+
+	eid, err := NewEIDV1(guid, MAPI_MESSAGE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewEIDV1(guid, MAPI_MESSAGE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eid.UniqueID == other.UniqueID {
+		t.Errorf("EID unique IDs are not unique")
+	}
+
+	parsed, err := NewEIDFromBase64([]byte(eid.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *parsed != *eid {
+		t.Errorf("EID round trip mismatch: got %v want %v", parsed, eid)
+	}
+	if parsed.GUID != guid {
+		t.Errorf("EID unexpected GUID: %v", parsed.GUID)
+	}
+	if MAPIType(parsed.Type) != MAPI_MESSAGE {
+		t.Errorf("EID unexpected Type: %v", parsed.Type)
+	}
+	if len(eid.String()) != 64 {
+		t.Errorf("EID unexpected encoded length: %d", len(eid.String()))
+	}
+}
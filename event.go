@@ -0,0 +1,158 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BusyStatus is the type representing the free/busy status of an event. The
+// values match the MAPI busy status values.
+type BusyStatus uint64
+
+// Busy status values as defined in [MS-OXOCAL].
+const (
+	BusyStatusFree             BusyStatus = 0
+	BusyStatusTentative        BusyStatus = 1
+	BusyStatusBusy             BusyStatus = 2
+	BusyStatusOutOfOffice      BusyStatus = 3
+	BusyStatusWorkingElsewhere BusyStatus = 4
+)
+
+func (bs BusyStatus) String() string {
+	switch bs {
+	case BusyStatusFree:
+		return "Free"
+	case BusyStatusTentative:
+		return "Tentative"
+	case BusyStatusBusy:
+		return "Busy"
+	case BusyStatusOutOfOffice:
+		return "OutOfOffice"
+	case BusyStatusWorkingElsewhere:
+		return "WorkingElsewhere"
+	default:
+		return fmt.Sprintf("BusyStatus(%d)", uint64(bs))
+	}
+}
+
+// An Event represents a calendar item as listed from a calendar folder.
+type Event struct {
+	EntryID      string     `json:"entryID"`
+	UID          string     `json:"uid"`
+	Subject      string     `json:"subject"`
+	Location     string     `json:"location"`
+	Start        time.Time  `json:"start"`
+	End          time.Time  `json:"end"`
+	AllDay       bool       `json:"allDay"`
+	BusyStatus   BusyStatus `json:"busyStatus"`
+	Recurring    bool       `json:"recurring"`
+	Sequence     uint64     `json:"sequence"`
+	LastModified time.Time  `json:"lastModified"`
+}
+
+var eventProps = []PT{
+	PR_ENTRYID,
+	PR_MESSAGE_CLASS,
+	PR_SUBJECT,
+	PR_LAST_MODIFICATION_TIME,
+}
+
+var eventNamedProps = []*NamedProp{
+	PidLidAppointmentStartWhole,
+	PidLidAppointmentEndWhole,
+	PidLidLocation,
+	PidLidBusyStatus,
+	PidLidAppointmentSubType,
+	PidLidRecurring,
+	PidLidAppointmentSequence,
+	PidLidGlobalObjectID,
+}
+
+// ListEvents lists the events in the calendar folder with the provided Entry
+// ID using the provided session. An empty folder Entry ID lists the default
+// calendar folder of the session's user.
+func (c *KCC) ListEvents(ctx context.Context, folderEntryID string, sessionID KCSessionID) ([]*Event, error) {
+	if folderEntryID == "" {
+		var err error
+		folderEntryID, err = c.DefaultFolderEntryID(ctx, PR_IPM_APPOINTMENT_ENTRYID, sessionID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tags, err := c.NamedPropTags(ctx, sessionID, eventNamedProps...)
+	if err != nil {
+		return nil, fmt.Errorf("list events named props failed: %v", err)
+	}
+
+	props := append(append([]PT{}, eventProps...), tags...)
+
+	var events []*Event
+	err = c.QueryTableRows(ctx, folderEntryID, TABLETYPE_MS, MAPI_MESSAGE, 0, props, sessionID, func(rows []*PropTagRowSet) error {
+		for _, row := range rows {
+			if ItemTypeFromMessageClass(row.GetString(PR_MESSAGE_CLASS)) != ItemTypeAppointment {
+				continue
+			}
+			events = append(events, newEventFromRow(row, tags))
+		}
+		return nil
+	})
+
+	return events, err
+}
+
+// newEventFromRow maps the provided table row to an Event. The tags must be
+// the resolved eventNamedProps.
+func newEventFromRow(row *PropTagRowSet, tags []PT) *Event {
+	event := &Event{
+		Subject:      row.GetString(PR_SUBJECT),
+		LastModified: row.GetTime(PR_LAST_MODIFICATION_TIME),
+		Start:        row.GetTime(tags[0]),
+		End:          row.GetTime(tags[1]),
+		Location:     row.GetString(tags[2]),
+	}
+	if value, ok := row.Get(PR_ENTRYID); ok {
+		event.EntryID = string(value.BinValue)
+	}
+	if value, ok := row.Get(tags[3]); ok {
+		event.BusyStatus = BusyStatus(value.ULValue)
+	}
+	if value, ok := row.Get(tags[4]); ok {
+		event.AllDay = value.BoolValue
+	}
+	if value, ok := row.Get(tags[5]); ok {
+		event.Recurring = value.BoolValue
+	}
+	if value, ok := row.Get(tags[6]); ok {
+		event.Sequence = value.ULValue
+	}
+	if value, ok := row.Get(tags[7]); ok {
+		if goid, err := value.Bytes(); err == nil && len(goid) > 0 {
+			event.UID = strings.ToUpper(hex.EncodeToString(goid))
+		}
+	}
+	if event.UID == "" {
+		event.UID = event.EntryID
+	}
+
+	return event
+}
@@ -19,7 +19,9 @@ package kcc
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -27,35 +29,50 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
-
-	"github.com/eternnoir/gncp"
 )
 
 const (
-	soapUserAgent = "kcc-go-fakesoap"
-	soapHeader    = `<?xml version="1.0" encoding="UTF-8"?>
-<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/" xmlns:SOAP-ENC="http://schemas.xmlsoap.org/soap/encoding/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xop="http://www.w3.org/2004/08/xop/include" xmlns:xmlmime="http://www.w3.org/2004/11/xmlmime" xmlns:ns="urn:zarafa"><SOAP-ENV:Body SOAP-ENV:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`
-	soapFooter = `</SOAP-ENV:Body></SOAP-ENV:Envelope>`
+	soapUserAgent     = "kcc-go-fakesoap"
+	soapEnvelopeStart = `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/" xmlns:SOAP-ENC="http://schemas.xmlsoap.org/soap/encoding/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xop="http://www.w3.org/2004/08/xop/include" xmlns:xmlmime="http://www.w3.org/2004/11/xmlmime" xmlns:ns="urn:zarafa">`
+	soapBodyStart = `<SOAP-ENV:Body SOAP-ENV:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`
+	soapHeader    = soapEnvelopeStart + soapBodyStart
+	soapFooter    = `</SOAP-ENV:Body></SOAP-ENV:Envelope>`
 )
 
-func soapEnvelope(payload *string) *bytes.Buffer {
+// soapEnvelope returns the SOAP envelope for the provided payload with the
+// provided header blocks.
+func soapEnvelope(payload *string, headers []SOAPHeader) *bytes.Buffer {
 	var b bytes.Buffer
-	b.WriteString(soapHeader)
+	if len(headers) == 0 {
+		b.WriteString(soapHeader)
+	} else {
+		b.WriteString(soapEnvelopeStart)
+		b.WriteString("<SOAP-ENV:Header>")
+		for _, header := range headers {
+			b.WriteString(string(header))
+		}
+		b.WriteString("</SOAP-ENV:Header>")
+		b.WriteString(soapBodyStart)
+	}
 	b.WriteString(*payload)
 	b.WriteString(soapFooter)
 
-	if debug {
-		raw, _ := ioutil.ReadAll(&b)
-		b = *bytes.NewBuffer(raw)
-		fmt.Printf("SOAP --- request start ---\n%s\nSOAP --- request end  ---\n", string(raw))
+	if logPayloads() {
+		raw := b.Bytes()
+		if debug {
+			fmt.Printf("SOAP --- request start ---\n%s\nSOAP --- request end  ---\n", RedactSOAPPayload(string(raw)))
+		}
+		logPayload(PayloadRequest, 0, raw)
 	}
 	return &b
 }
 
 func newSOAPRequest(ctx context.Context, url string, payload *string) (*http.Request, error) {
-	body := soapEnvelope(payload)
+	body := soapEnvelope(payload, SOAPHeadersFromContext(ctx))
 
 	req, err := http.NewRequest(http.MethodPost, url, body)
 	if err != nil {
@@ -66,7 +83,7 @@ func newSOAPRequest(ctx context.Context, url string, payload *string) (*http.Req
 	}
 
 	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	req.Header.Set("User-Agent", soapUserAgent+"/"+Version)
+	req.Header.Set("User-Agent", BuildInfo().UserAgent(soapUserAgent))
 
 	return req, nil
 }
@@ -77,13 +94,30 @@ func debugRawResponse(code int, data io.Reader) (io.Reader, error) {
 		return nil, err
 	}
 
-	fmt.Printf("SOAP --- response %d start ---\n%s\nSOAP --- response end  ---\n", code, string(raw))
+	if debug {
+		fmt.Printf("SOAP --- response %d start ---\n%s\nSOAP --- response end  ---\n", code, RedactSOAPPayload(string(raw)))
+	}
+	logPayload(PayloadResponse, code, raw)
 
 	return bytes.NewBuffer(raw), nil
 }
 
+// gzipBody returns the gzip compressed content of the provided buffer.
+func gzipBody(body *bytes.Buffer) (*bytes.Buffer, error) {
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := body.WriteTo(zw); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
 func parseSOAPResponse(code int, data io.Reader, v interface{}) error {
-	if debug {
+	if logPayloads() {
 		var err error
 		data, err = debugRawResponse(code, data)
 		if err != nil {
@@ -91,18 +125,61 @@ func parseSOAPResponse(code int, data io.Reader, v interface{}) error {
 		}
 	}
 
+	return decodeSOAPResponse(data, v)
+}
+
+// DecodeSOAPResponse decodes the body of the SOAP response envelope read from
+// the provided reader into v, like the SOAP clients of this package do. Use it
+// to implement SOAPClient, for example in tests. Responses which are no SOAP
+// response or hold a SOAP fault are returned as ProtocolError.
+func DecodeSOAPResponse(data io.Reader, v interface{}) error {
+	return decodeSOAPResponse(data, v)
+}
+
+// decodeSOAPResponse decodes the body of the SOAP response read from the
+// provided reader into v. Responses which are no SOAP response or hold a SOAP
+// fault are returned as ProtocolError.
+func decodeSOAPResponse(data io.Reader, v interface{}) error {
 	decoder := xml.NewDecoder(data)
 
+	root := false
+	text := false
 	match := false
 	for {
-		t, _ := decoder.Token()
+		t, err := decoder.Token()
 		if t == nil {
+			if !root && err != nil {
+				return tokenProtocolError(err, text)
+			}
+			if err != nil && err != io.EOF && FeatureStrictXML.Enabled() {
+				return fmt.Errorf("failed to parse SOAP response: %v", err)
+			}
 			break
 		}
 
 		switch se := t.(type) {
+		case xml.CharData:
+			if !root && len(bytes.TrimSpace(se)) > 0 {
+				text = true
+			}
 		case xml.StartElement:
+			if !root {
+				root = true
+				if protocolErr := rootProtocolError(&se); protocolErr != nil {
+					return protocolErr
+				}
+			}
 			if match {
+				if se.Name.Local == "Fault" {
+					var fault soapFault
+					if err := decoder.DecodeElement(&fault, &se); err != nil {
+						return err
+					}
+					return faultProtocolError(&fault)
+				}
+				if sd, ok := v.(soapStreamDecoder); ok {
+					return sd.decodeSOAPStream(decoder, &se)
+				}
 				return decoder.DecodeElement(v, &se)
 			}
 
@@ -115,6 +192,40 @@ func parseSOAPResponse(code int, data io.Reader, v interface{}) error {
 	return fmt.Errorf("failed to unmarshal SOAP response body")
 }
 
+// An HTTPStatusError is returned by SOAP clients when the server responds with
+// an unexpected HTTP status.
+type HTTPStatusError struct {
+	StatusCode int
+	// RetryAfter is the delay requested by the server with the Retry-After
+	// header, or 0 if there was none.
+	RetryAfter time.Duration
+	// Hint describes the likely cause of the status, or is empty if the
+	// cause is not known.
+	Hint string
+}
+
+func newHTTPStatusError(resp *http.Response) *HTTPStatusError {
+	err := &HTTPStatusError{
+		StatusCode: resp.StatusCode,
+	}
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, parseErr := strconv.ParseUint(value, 10, 32); parseErr == nil {
+			err.RetryAfter = time.Duration(seconds) * time.Second
+		} else if when, parseErr := http.ParseTime(value); parseErr == nil {
+			err.RetryAfter = time.Until(when)
+		}
+	}
+
+	return err
+}
+
+func (err *HTTPStatusError) Error() string {
+	if err.Hint != "" {
+		return fmt.Sprintf("unexpected http response status: %v - %s", err.StatusCode, err.Hint)
+	}
+	return fmt.Sprintf("unexpected http response status: %v", err.StatusCode)
+}
+
 // A SOAPClient is a network client which sends SOAP requests.
 type SOAPClient interface {
 	DoRequest(ctx context.Context, payload *string, v interface{}) error
@@ -123,8 +234,72 @@ type SOAPClient interface {
 // A SOAPClientConfig is a collection of configuration settings used when
 // constructing SOAP clients.
 type SOAPClientConfig struct {
-	HTTPClient   *http.Client
-	SocketDialer *net.Dialer
+	HTTPClient *http.Client
+	// TLSConfig is used for the connections of HTTP SOAP clients, to set root
+	// CAs, client certificates or the server name per client. If HTTPClient
+	// is set, TLSConfig is ignored.
+	TLSConfig *tls.Config
+	// HTTPProxy returns the proxy HTTP SOAP clients of http:// and https://
+	// URIs connect through, instead of the proxies of the environment. Use
+	// NoProxy to connect directly. HTTPProxyURL sets a single proxy for all
+	// requests, if HTTPProxy is nil. If HTTPClient is set, both are ignored.
+	HTTPProxy    ProxyFunc
+	HTTPProxyURL *url.URL
+
+	SocketDialer    *net.Dialer
+	SocketPeerOwner *SocketPeerOwner
+	// SocketDialTimeout, SocketWriteTimeout and SocketReadTimeout set the
+	// timeouts of socket SOAP clients, see SOAPSocketClient.DialTimeout.
+	SocketDialTimeout  time.Duration
+	SocketWriteTimeout time.Duration
+	SocketReadTimeout  time.Duration
+	// SocketPool defines the connection pool of socket SOAP clients. If nil,
+	// the pool is created with default settings.
+	SocketPool *SocketPoolConfig
+	// AllowLocalAdminLogon allows KCC.LocalAdminLogon requests for socket
+	// SOAP clients connecting to a unix socket, see
+	// SOAPSocketClient.AllowLocalAdminLogon.
+	AllowLocalAdminLogon bool
+	// Warmup is the number of connections the SOAP clients open in the
+	// background when they are created, see SOAPSocketClient.Warmup and
+	// SOAPHTTPClient.Warmup.
+	Warmup int
+
+	// RetryPolicy is used by the SOAP clients to retry requests which failed
+	// with a transient error. If nil, DefaultRetryPolicy is used.
+	RetryPolicy *RetryPolicy
+
+	// HTTPGzip enables gzip compression for HTTP SOAP clients, in addition to
+	// DefaultHTTPGzip.
+	HTTPGzip bool
+	// HTTPH2C makes HTTP SOAP clients of http:// and http+unix:// URIs send
+	// requests with HTTP/2 without TLS, in addition to DefaultHTTPH2C. If
+	// HTTPClient is set, HTTPH2C is ignored. See NewH2CTransport.
+	HTTPH2C bool
+
+	// Middleware wraps all requests of the SOAP clients.
+	Middleware []SOAPMiddleware
+	// Tracer makes the SOAP clients wrap all requests in spans, outside of
+	// Middleware. See TracingMiddleware.
+	Tracer Tracer
+
+	// Headers are sent in the SOAP header of all requests of the SOAP
+	// clients, see SOAPHeader.
+	Headers []SOAPHeader
+
+	// Metrics receives the metrics of the SOAP clients. If nil, no metrics
+	// are recorded.
+	Metrics MetricsRegistry
+}
+
+// middleware returns the TracingMiddleware for the provided target if the
+// accociated config has a Tracer, followed by the Middleware of the config.
+func (config *SOAPClientConfig) middleware(target string) []SOAPMiddleware {
+	if config.Tracer == nil {
+		return config.Middleware
+	}
+
+	return append([]SOAPMiddleware{TracingMiddleware(config.Tracer, target)}, config.Middleware...)
 }
 
 // DefaultSOAPClientConfig is the default SOAP client config which is used when
@@ -135,13 +310,72 @@ var DefaultSOAPClientConfig = &SOAPClientConfig{}
 type SOAPHTTPClient struct {
 	Client *http.Client
 	URI    string
+	// RetryPolicy is used to retry requests which failed with a transient
+	// error. If nil, DefaultRetryPolicy is used.
+	RetryPolicy *RetryPolicy
+	// Gzip enables gzip compression of request payloads and asks the server
+	// for compressed responses, which reduces the bandwidth of large
+	// responses. The server must support compressed requests.
+	Gzip bool
+	// Middleware wraps all requests of the client, the first middleware
+	// being the outermost. Retries happen within the middleware.
+	Middleware []SOAPMiddleware
+	// Headers are sent in the SOAP header of all requests of the client,
+	// followed by the SOAP headers of the request context.
+	Headers []SOAPHeader
+	// Metrics receives the metrics of all requests of the client. If nil, no
+	// metrics are recorded.
+	Metrics MetricsRegistry
+
+	socketPath string
 }
 
-// A SOAPSocketClient implements a SOAP client connecting to a unix socket.
+// A SOAPSocketClient implements a SOAP client connecting to a unix socket, a
+// named pipe on Windows, or to the plain gsoap listener of a Kopano server on
+// a TCP port.
 type SOAPSocketClient struct {
 	Dialer *net.Dialer
-	Pool   gncp.ConnPool
-	Path   string
+	Pool   ConnPool
+	// DialTimeout limits opening a connection and waiting for a connection
+	// of the pool. WriteTimeout and ReadTimeout limit writing a request and
+	// reading its response, from the time the connection is ready. Each
+	// falls back to the Timeout of the Dialer if 0. The deadline of the
+	// request context applies in addition.
+	DialTimeout  time.Duration
+	WriteTimeout time.Duration
+	ReadTimeout  time.Duration
+	// Network is the network of the connections, "unix" if empty, "pipe" or
+	// "tcp".
+	Network string
+	// Path is the path of the unix socket or named pipe, or the host and port
+	// of the TCP listener.
+	Path string
+	// PeerOwner is the expected owner of the process serving the socket,
+	// checked on every new unix socket connection. If nil, the owner is not
+	// checked.
+	PeerOwner *SocketPeerOwner
+	// RetryPolicy is used to retry requests which failed with a transient
+	// error. If nil, DefaultRetryPolicy is used.
+	RetryPolicy *RetryPolicy
+	// Middleware wraps all requests of the client, the first middleware
+	// being the outermost. Waiting for a connection slot and retries happen
+	// within the middleware.
+	Middleware []SOAPMiddleware
+	// Headers are sent in the SOAP header of all requests of the client,
+	// followed by the SOAP headers of the request context.
+	Headers []SOAPHeader
+	// Metrics receives the metrics of all requests and the pool utilization
+	// of the client. If nil, no metrics are recorded. Set it before the
+	// client is used, or create the client with NewSOAPClientWithConfig, so
+	// connections opened in advance are observed as well.
+	Metrics MetricsRegistry
+	// AllowLocalAdminLogon allows KCC.LocalAdminLogon requests over a unix
+	// socket. Enable it only for management tools run by a local admin user
+	// of the Kopano server.
+	AllowLocalAdminLogon bool
+
+	slots    *prioritySemaphore
+	pipeline *socketPipeline
 }
 
 // NewSOAPClient creates a new SOAP client for the protocol matching the
@@ -155,9 +389,15 @@ func NewSOAPClient(uri *url.URL) (SOAPClient, error) {
 	case "https":
 		fallthrough
 	case "http":
+		fallthrough
+	case "http+unix":
 		return NewSOAPHTTPClient(uri, nil)
 
 	case "file":
+		fallthrough
+	case "npipe":
+		fallthrough
+	case "tcp":
 		return NewSOAPSocketClient(uri, nil)
 
 	default:
@@ -179,10 +419,81 @@ func NewSOAPClientWithConfig(uri *url.URL, config *SOAPClientConfig) (SOAPClient
 	case "https":
 		fallthrough
 	case "http":
-		return NewSOAPHTTPClient(uri, config.HTTPClient)
+		fallthrough
+	case "http+unix":
+		client := config.HTTPClient
+		if client == nil {
+			h2c := config.HTTPH2C || DefaultHTTPH2C
+			switch {
+			case uri.Scheme == "http+unix":
+				owner := config.SocketPeerOwner
+				if owner == nil {
+					owner = DefaultSocketPeerOwner
+				}
+				if h2c {
+					client = NewH2CHTTPClient(uri.Path, owner)
+				} else {
+					client = NewUnixHTTPClient(uri.Path, owner)
+				}
+			case uri.Scheme == "http" && h2c:
+				client = NewH2CHTTPClient("", nil)
+			case config.HTTPProxy != nil:
+				client = NewHTTPClientWithProxy(config.TLSConfig, config.HTTPProxy)
+			case config.HTTPProxyURL != nil:
+				client = NewHTTPClientWithProxy(config.TLSConfig, http.ProxyURL(config.HTTPProxyURL))
+			case config.TLSConfig != nil:
+				client = NewHTTPClient(config.TLSConfig)
+			}
+		}
+		c, err := NewSOAPHTTPClient(uri, client)
+		if err == nil {
+			c.RetryPolicy = config.RetryPolicy
+			c.Gzip = c.Gzip || config.HTTPGzip
+			c.Middleware = config.middleware(uri.String())
+			c.Headers = config.Headers
+			c.Metrics = config.Metrics
+			if config.Warmup > 0 {
+				warmupInBackground(c, config.Warmup)
+			}
+		}
+		return c, err
 
 	case "file":
-		return NewSOAPSocketClient(uri, config.SocketDialer)
+		fallthrough
+	case "npipe":
+		fallthrough
+	case "tcp":
+		poolConfig := config.SocketPool
+		if poolConfig == nil {
+			poolConfig = NewSocketPoolConfig()
+		}
+		dialer := config.SocketDialer
+		if config.SocketDialTimeout > 0 {
+			// NOTE(longsleep): The timeout is set on the dialer, since
+			// connections might be opened in advance by the pool.
+			if dialer == nil {
+				dialer = DefaultUnixDialer
+			}
+			d := *dialer
+			d.Timeout = config.SocketDialTimeout
+			dialer = &d
+		}
+		c, err := newSOAPSocketClient(uri, dialer, poolConfig, config.Metrics)
+		if err == nil {
+			if config.SocketPeerOwner != nil {
+				c.PeerOwner = config.SocketPeerOwner
+			}
+			c.WriteTimeout = config.SocketWriteTimeout
+			c.ReadTimeout = config.SocketReadTimeout
+			c.RetryPolicy = config.RetryPolicy
+			c.Middleware = config.middleware(uri.String())
+			c.Headers = config.Headers
+			c.AllowLocalAdminLogon = config.AllowLocalAdminLogon
+			if config.Warmup > 0 {
+				warmupInBackground(c, config.Warmup)
+			}
+		}
+		return c, err
 
 	default:
 		return nil, fmt.Errorf("invalid scheme '%v' for SOAP client", uri.Scheme)
@@ -192,7 +503,9 @@ func NewSOAPClientWithConfig(uri *url.URL, config *SOAPClientConfig) (SOAPClient
 // NewSOAPHTTPClient creates a new SOAP HTTP client for the protocol matching the
 // provided URL. A http.Client can be provided to futher customize the behavior
 // of the client instead of using the defaults. If the protocol is unsupported,
-// an error is returned.
+// an error is returned. For http+unix URLs, the path of the URL is the Unix
+// socket the server speaks HTTP on and the default client connects to it, a
+// provided client must connect to the socket by itself.
 func NewSOAPHTTPClient(uri *url.URL, client *http.Client) (*SOAPHTTPClient, error) {
 	var err error
 
@@ -211,9 +524,34 @@ func NewSOAPHTTPClient(uri *url.URL, client *http.Client) (*SOAPHTTPClient, erro
 	case "https":
 		fallthrough
 	case "http":
+		if client == DefaultHTTPClient && DefaultHTTPH2C && uri.Scheme == "http" {
+			client = NewH2CHTTPClient("", nil)
+		}
 		c := &SOAPHTTPClient{
 			Client: client,
 			URI:    uri.String(),
+			Gzip:   DefaultHTTPGzip,
+		}
+		return c, nil
+	case "http+unix":
+		if uri.Path == "" {
+			return nil, fmt.Errorf("missing socket path for SOAP HTTP client")
+		}
+		if client == DefaultHTTPClient {
+			if DefaultHTTPH2C {
+				client = NewH2CHTTPClient(uri.Path, DefaultSocketPeerOwner)
+			} else {
+				client = NewUnixHTTPClient(uri.Path, DefaultSocketPeerOwner)
+			}
+		}
+		c := &SOAPHTTPClient{
+			Client: client,
+			// NOTE(longsleep): The host is ignored when connecting, it is
+			// only sent in the Host header.
+			URI:  "http://localhost/",
+			Gzip: DefaultHTTPGzip,
+
+			socketPath: uri.Path,
 		}
 		return c, nil
 	default:
@@ -224,8 +562,15 @@ func NewSOAPHTTPClient(uri *url.URL, client *http.Client) (*SOAPHTTPClient, erro
 // NewSOAPSocketClient creates a new SOAP socket client for the protocol
 // matching the provided URL. A net.Dialer can be provided to further customize
 // the behavior of the client instead of using the defaults. If the protocol is
-//  unsupported, an error is returned.
+//  unsupported, an error is returned. File URLs connect to the unix socket at
+// their path, npipe URLs like npipe:////./pipe/kopano to the named pipe of
+// their path on Windows and TCP URLs to their host and port, DefaultTCPPort if
+// missing.
 func NewSOAPSocketClient(uri *url.URL, dialer *net.Dialer) (*SOAPSocketClient, error) {
+	return newSOAPSocketClient(uri, dialer, NewSocketPoolConfig(), nil)
+}
+
+func newSOAPSocketClient(uri *url.URL, dialer *net.Dialer, poolConfig *SocketPoolConfig, metrics MetricsRegistry) (*SOAPSocketClient, error) {
 	var err error
 
 	if uri == nil {
@@ -239,20 +584,43 @@ func NewSOAPSocketClient(uri *url.URL, dialer *net.Dialer) (*SOAPSocketClient, e
 		dialer = DefaultUnixDialer
 	}
 
-	if uri.Scheme != "file" {
-		return nil, fmt.Errorf("invalid scheme '%v' for SOAP socket client", uri.Scheme)
-	}
-
 	c := &SOAPSocketClient{
-		Dialer: dialer,
-		Path:   uri.Path,
+		Dialer:    dialer,
+		PeerOwner: DefaultSocketPeerOwner,
+		Metrics:   metrics,
+
+		slots: newPrioritySemaphore((poolConfig.MaxConnections + poolConfig.OverflowConnections) * poolConfig.pipelineDepth()),
+	}
+	switch uri.Scheme {
+	case "file":
+		c.Path = uri.Path
+	case "npipe":
+		c.Network = "pipe"
+		c.Path = pipePath(uri)
+		if c.Path == "" {
+			return nil, fmt.Errorf("missing pipe path for SOAP socket client")
+		}
+	case "tcp":
+		if uri.Hostname() == "" {
+			return nil, fmt.Errorf("missing host for SOAP socket client")
+		}
+		c.Network = "tcp"
+		c.Path = uri.Host
+		if uri.Port() == "" {
+			c.Path = net.JoinHostPort(uri.Hostname(), DefaultTCPPort)
+		}
+	default:
+		return nil, fmt.Errorf("invalid scheme '%v' for SOAP socket client", uri.Scheme)
 	}
 
-	pool, err := gncp.NewPool(0, DefaultUnixMaxConnections, c.connect)
+	pool, err := newSocketPool(poolConfig, c.connect, c.observePool)
 	if err != nil {
 		return nil, err
 	}
 	c.Pool = pool
+	if depth := poolConfig.pipelineDepth(); depth > 1 {
+		c.pipeline = newSocketPipeline(pool, depth)
+	}
 
 	return c, nil
 }
@@ -260,102 +628,366 @@ func NewSOAPSocketClient(uri *url.URL, dialer *net.Dialer) (*SOAPSocketClient, e
 // DoRequest sends the provided payload data as SOAP through the means of the
 // accociated client. Connections are automatically reused according to keep-alive
 // configuration provided by the http.Client attached to the SOAPHTTPClient.
+// Requests failing with a transient error are retried according to the
+// RetryPolicy of the provided context or the accociated client. Requests are
+// wrapped with the Middleware of the accociated client.
 func (sc *SOAPHTTPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
-	body := soapEnvelope(payload)
+	return doRequestWithMiddleware(ctx, payload, v, sc.roundTrip, sc.Middleware)
+}
 
-	req, err := http.NewRequest(http.MethodPost, sc.URI, body)
+// roundTrip sends the provided payload data, retrying it according to the
+// RetryPolicy of the provided context or the accociated client.
+func (sc *SOAPHTTPClient) roundTrip(ctx context.Context, payload *string, v interface{}) error {
+	policy := retryPolicyFromContext(ctx, sc.RetryPolicy)
+	for attempt := 1; ; attempt++ {
+		retry, err := sc.doRequest(ctx, payload, v)
+		if !retry || !policy.wait(ctx, attempt, err) {
+			return err
+		}
+	}
+}
+
+// doRequest sends the provided payload data once. The returned retry value is
+// true if the request failed with a transient error before the response was
+// decoded.
+func (sc *SOAPHTTPClient) doRequest(ctx context.Context, payload *string, v interface{}) (retry bool, err error) {
+	action := soapAction(*payload)
+
+	started := beginBackendRequest()
+	defer func() {
+		endBackendRequest(ctx, started, err, v)
+		observeRequest(ctx, sc.Metrics, action, started, err, v)
+	}()
+
+	// NOTE(longsleep): Local admin logons are only trusted on the unix socket
+	// of the Kopano server.
+	if err = checkLocalAdminLogon(ctx, false); err != nil {
+		return false, err
+	}
+
+	// NOTE(longsleep): MTOM requests are not compressed, their attachments
+	// are streamed as is.
+	var attachments []*SOAPAttachment
+	if r := mtomRequestFromContext(ctx); r != nil {
+		attachments = r.attachments
+	}
+	gzipRequest := sc.Gzip && len(attachments) == 0
+
+	var body *bytes.Buffer
+	profileRegion(ctx, action, profilePhaseEnvelope, func(context.Context) {
+		body = soapEnvelope(payload, soapHeaders(ctx, sc.Headers))
+		if gzipRequest {
+			body, err = gzipBody(body)
+		}
+	})
 	if err != nil {
-		return err
+		return false, err
+	}
+
+	var reqBody io.Reader = body
+	contentType := "text/xml; charset=utf-8"
+	if len(attachments) > 0 {
+		reqBody, contentType = newMTOMBody(body, attachments)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sc.URI, reqBody)
+	if err != nil {
+		if closer, ok := reqBody.(io.Closer); ok {
+			closer.Close()
+		}
+		return false, err
 	}
 	if ctx != nil {
 		req = req.WithContext(ctx)
 	}
 
-	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	req.Header.Set("User-Agent", soapUserAgent+"/"+Version)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", BuildInfo().UserAgent(soapUserAgent))
+	if info := ClientInfoFromContext(ctx); info != nil && info.RemoteAddr != "" {
+		req.Header.Set("X-Forwarded-For", info.RemoteAddr)
+	}
+	setHTTPHeaders(ctx, req)
+	if gzipRequest {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if sc.Gzip {
+		// NOTE(longsleep): Setting Accept-Encoding disables the transparent
+		// decompression of net/http, responses are decompressed below.
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
 
 	resp, err := sc.Client.Do(req)
 	if err != nil {
-		return err
+		return IsRetryable(err), err
+	}
+	if raw, ok := v.(*RawResponse); ok {
+		err = raw.setHTTPResponse(resp, nil)
+		return IsRetryable(err), err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		debugRawResponse(resp.StatusCode, resp.Body)
-		return fmt.Errorf("unexpected http response status: %v", resp.StatusCode)
+		err = statusResponseError(resp)
+		return IsRetryable(err), err
 	}
 
-	return parseSOAPResponse(resp.StatusCode, resp.Body, v)
+	var data io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		zr, zErr := gzip.NewReader(resp.Body)
+		if zErr != nil {
+			return IsRetryable(zErr), fmt.Errorf("failed to read gzip response: %v", zErr)
+		}
+		defer zr.Close()
+		data = zr
+	}
+
+	profileRegion(ctx, action, profilePhaseDecode, func(context.Context) {
+		err = parseSOAPHTTPResponse(ctx, resp, data, v)
+	})
+	return false, err
 }
 
 func (sc *SOAPHTTPClient) String() string {
+	if sc.socketPath != "" {
+		return fmt.Sprintf("<http+unix:%s>", sc.socketPath)
+	}
 	return fmt.Sprintf("<http:%s>", sc.URI)
 }
 
 // DoRequest sends the provided payload data as SOAP through the means of the
-// accociated client.
+// accociated client. Requests wait for connections by the Priority of the
+// provided context. Requests failing with a transient error are retried
+// according to the RetryPolicy of the provided context or the accociated
+// client. Requests are wrapped with the Middleware of the accociated client.
+// Socket reads and writes time out with the ReadTimeout and WriteTimeout of
+// the accociated client or the deadline of the provided context if it is
+// earlier, requests return the error of the provided context when it is done.
 func (sc *SOAPSocketClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	return doRequestWithMiddleware(ctx, payload, v, sc.roundTrip, sc.Middleware)
+}
+
+// roundTrip waits for a connection slot and sends the provided payload data,
+// retrying it according to the RetryPolicy of the provided context or the
+// accociated client.
+func (sc *SOAPSocketClient) roundTrip(ctx context.Context, payload *string, v interface{}) error {
+	if sc.slots != nil {
+		// Wait for a free connection slot, so requests with higher priority
+		// get the next connection.
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		if err := sc.slots.acquire(ctx); err != nil {
+			return err
+		}
+		defer sc.slots.release()
+	}
+
+	policy := retryPolicyFromContext(ctx, sc.RetryPolicy)
+	for attempt := 1; ; attempt++ {
+		retry, err := sc.doRequest(ctx, payload, v)
+		if !retry || !policy.wait(ctx, attempt, err) {
+			return err
+		}
+	}
+}
+
+// doRequest sends the provided payload data once. The returned retry value is
+// true if the request failed with a transient error before the response was
+// decoded.
+func (sc *SOAPSocketClient) doRequest(ctx context.Context, payload *string, v interface{}) (retry bool, err error) {
+	action := soapAction(*payload)
+
+	started := beginBackendRequest()
+	defer func() {
+		endBackendRequest(ctx, started, err, v)
+		observeRequest(ctx, sc.Metrics, action, started, err, v)
+	}()
+
+	if r := mtomRequestFromContext(ctx); r != nil && len(r.attachments) > 0 {
+		return false, errMTOMUnsupported
+	}
+	if err = checkLocalAdminLogon(ctx, sc.AllowLocalAdminLogon && sc.network() == "unix"); err != nil {
+		return false, err
+	}
+	if sc.pipeline != nil {
+		return sc.doPipelinedRequest(ctx, action, payload, v)
+	}
+
 	for {
-		// TODO(longsleep): Use a pool which allows to add additional connections
-		// in burst situations. With this current implementation based on Go
-		// channel select, requests can timeout on burst situations where
-		// constantly more requests than pooled connections are available come
-		// in as Go's select is non-deterministic.
-		c, err := sc.Pool.GetWithTimeout(sc.Dialer.Timeout)
+		if ctxErr := socketContextErr(ctx); ctxErr != nil {
+			return false, ctxErr
+		}
+
+		c, err := sc.Pool.GetWithTimeout(sc.dialTimeout())
 		if err != nil {
-			return fmt.Errorf("failed to open unix socket: %v", err)
+			return IsRetryable(err), fmt.Errorf("failed to open %s socket: %v", sc.network(), err)
 		}
 
-		body := soapEnvelope(payload)
+		var body *bytes.Buffer
+		profileRegion(ctx, action, profilePhaseEnvelope, func(context.Context) {
+			body = soapEnvelope(payload, soapHeaders(ctx, sc.Headers))
+		})
 
 		r := bufio.NewReader(c)
+		stop := interruptOnDone(ctx, c)
 
-		c.SetWriteDeadline(time.Now().Add(sc.Dialer.Timeout))
+		c.SetWriteDeadline(socketDeadline(ctx, sc.writeTimeout()))
 		_, err = body.WriteTo(c)
 		if err != nil {
 			// Remove from pool and retry on any write error. This will retry
 			// until the pool is not able to return a socket connection fast
-			// enough anymore.
+			// enough anymore or the context is done.
+			stop()
 			sc.Pool.Remove(c)
+			if ctxErr := socketContextErr(ctx); ctxErr != nil {
+				return false, ctxErr
+			}
 			continue
 		}
 
 		// NOTE(longsleep): Kopano SOAP socket return HTTP protocol data.
-		c.SetReadDeadline(time.Now().Add(sc.Dialer.Timeout))
+		c.SetReadDeadline(socketDeadline(ctx, sc.readTimeout()))
 		resp, err := http.ReadResponse(r, nil)
 		if err != nil {
+			stop()
 			sc.Pool.Remove(c)
-			return fmt.Errorf("failed to read from unix socket: %v", err)
+			if ctxErr := socketContextErr(ctx); ctxErr != nil {
+				return false, ctxErr
+			}
+			return IsRetryable(err), fmt.Errorf("failed to read from %s socket: %v", sc.network(), err)
 		}
 
-		canReuseConnection := resp.Header.Get("Connection") == "keep-alive"
-		defer func() {
-			resp.Body.Close()
-			if canReuseConnection {
+		return sc.decodeResponse(ctx, action, resp, v, stop, func(reuse bool) {
+			if reuse {
 				// Close makes the connection available to the pool again.
 				c.Close()
 			} else {
 				sc.Pool.Remove(c)
 			}
-		}()
+		})
+	}
+}
 
-		if resp.StatusCode != http.StatusOK {
-			debugRawResponse(resp.StatusCode, resp.Body)
-			return fmt.Errorf("unexpected http response status: %v", resp.StatusCode)
-		}
+// decodeResponse decodes the provided response of a socket request into v.
+// The provided release function is called with the response body done, after
+// stop, telling if the connection of the response can be reused.
+func (sc *SOAPSocketClient) decodeResponse(ctx context.Context, action string, resp *http.Response, v interface{}, stop func(), release func(reuse bool)) (retry bool, err error) {
+	canReuseConnection := resp.Header.Get("Connection") == "keep-alive"
+	if raw, ok := v.(*RawResponse); ok {
+		// NOTE(longsleep): The connection is released when the raw body is
+		// closed, it is only reused if the body was read completely.
+		err = raw.setHTTPResponse(resp, func(eof bool) {
+			stop()
+			release(canReuseConnection && eof && socketContextErr(ctx) == nil)
+		})
+		return false, err
+	}
+	defer func() {
+		resp.Body.Close()
+		stop()
+		release(canReuseConnection && socketContextErr(ctx) == nil)
+	}()
 
-		return parseSOAPResponse(resp.StatusCode, resp.Body, v)
+	if resp.StatusCode != http.StatusOK {
+		err = statusResponseError(resp)
+		return IsRetryable(err), err
 	}
+
+	profileRegion(ctx, action, profilePhaseDecode, func(context.Context) {
+		err = parseSOAPHTTPResponse(ctx, resp, resp.Body, v)
+	})
+	if err != nil {
+		stop()
+		if ctxErr := socketContextErr(ctx); ctxErr != nil {
+			return false, ctxErr
+		}
+	}
+	return false, err
 }
 
 func (sc *SOAPSocketClient) connect() (net.Conn, error) {
-	return sc.Dialer.Dial("unix", sc.Path)
+	var conn net.Conn
+	var err error
+	network := sc.network()
+	if network == "pipe" {
+		conn, err = dialPipe(sc.Path, sc.dialTimeout())
+	} else {
+		dialer := sc.Dialer
+		if sc.DialTimeout > 0 {
+			d := *dialer
+			d.Timeout = sc.DialTimeout
+			dialer = &d
+		}
+		conn, err = dialer.Dial(network, sc.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sc.PeerOwner != nil && network == "unix" {
+		if err = checkSocketPeer(conn, sc.Path, sc.PeerOwner); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// observePool passes the provided pool utilization to the Metrics of the
+// accociated client, if any.
+func (sc *SOAPSocketClient) observePool(stats SocketPoolStats) {
+	if registry := sc.Metrics; registry != nil {
+		runSafely(func() {
+			registry.ObservePool(sc.Path, stats)
+		})
+	}
 }
 
 func (sc *SOAPSocketClient) String() string {
+	switch sc.network() {
+	case "tcp":
+		return fmt.Sprintf("<tcp:%s>", sc.Path)
+	case "pipe":
+		return fmt.Sprintf("<pipe:%s>", sc.Path)
+	}
 	return fmt.Sprintf("<socket:%s>", sc.Path)
 }
 
+// dialTimeout returns the DialTimeout of the accociated client, or the Timeout
+// of its Dialer if not set.
+func (sc *SOAPSocketClient) dialTimeout() time.Duration {
+	if sc.DialTimeout > 0 {
+		return sc.DialTimeout
+	}
+	return sc.Dialer.Timeout
+}
+
+// writeTimeout returns the WriteTimeout of the accociated client, or the
+// Timeout of its Dialer if not set.
+func (sc *SOAPSocketClient) writeTimeout() time.Duration {
+	if sc.WriteTimeout > 0 {
+		return sc.WriteTimeout
+	}
+	return sc.Dialer.Timeout
+}
+
+// readTimeout returns the ReadTimeout of the accociated client, or the
+// Timeout of its Dialer if not set.
+func (sc *SOAPSocketClient) readTimeout() time.Duration {
+	if sc.ReadTimeout > 0 {
+		return sc.ReadTimeout
+	}
+	return sc.Dialer.Timeout
+}
+
+// network returns the network of the connections of the accociated client.
+func (sc *SOAPSocketClient) network() string {
+	if sc.Network == "" {
+		return "unix"
+	}
+	return sc.Network
+}
+
 type xmlCharData []byte
 
 func (s xmlCharData) String() string {
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// DefaultFDBudgetRatio is the share of the file descriptor limit of the
+// process which connection pools may use. The rest is left to the
+// application. A ratio of 0 or less disables capping of pool sizes.
+var DefaultFDBudgetRatio = 0.5
+
+func init() {
+	if s := os.Getenv("KCC_GO_FD_BUDGET_RATIO"); s != "" {
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			DefaultFDBudgetRatio = n
+		}
+	}
+}
+
+// FDBudget returns the number of file descriptors connection pools may use,
+// derived from the soft RLIMIT_NOFILE of the process and
+// DefaultFDBudgetRatio. It returns 0 if there is no budget, because the limit
+// is unknown on this platform or capping is disabled.
+func FDBudget() int {
+	if DefaultFDBudgetRatio <= 0 {
+		return 0
+	}
+	limit, err := fileDescriptorLimit()
+	if err != nil || limit == 0 {
+		return 0
+	}
+
+	budget := int(float64(limit) * DefaultFDBudgetRatio)
+	if budget < 1 {
+		budget = 1
+	}
+	return budget
+}
+
+// ApplyFDBudget caps the default connection pool sizes to the file
+// descriptor budget of the process, printing every capped size in debug mode.
+// Large pools would otherwise fail with EMFILE at peak. It is applied on
+// startup, call it again after changing the defaults or the limit. Returns
+// the budget, or 0 if there is none.
+func ApplyFDBudget() int {
+	budget := FDBudget()
+	if budget == 0 {
+		return 0
+	}
+
+	for _, pool := range []struct {
+		name string
+		size *int
+	}{
+		{"DefaultHTTPMaxIdleConns", &DefaultHTTPMaxIdleConns},
+		{"DefaultHTTPMaxIdleConnsPerHost", &DefaultHTTPMaxIdleConnsPerHost},
+		{"DefaultUnixMaxConnections", &DefaultUnixMaxConnections},
+		{"DefaultUnixOverflowConnections", &DefaultUnixOverflowConnections},
+	} {
+		if *pool.size > budget {
+			if debug {
+				fmt.Printf("kcc-go: capping %s from %d to %d to stay within the file descriptor budget (RLIMIT_NOFILE)\n", pool.name, *pool.size, budget)
+			}
+			*pool.size = budget
+		}
+	}
+
+	return budget
+}
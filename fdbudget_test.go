@@ -0,0 +1,56 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"testing"
+)
+
+func TestApplyFDBudget(t *testing.T) {
+	limit, err := fileDescriptorLimit()
+	if err != nil || limit == 0 {
+		t.Skipf("file descriptor limit not available: %v", err)
+	}
+
+	defer func(ratio float64, maxIdleConns, maxIdleConnsPerHost, unixMaxConnections int) {
+		DefaultFDBudgetRatio = ratio
+		DefaultHTTPMaxIdleConns = maxIdleConns
+		DefaultHTTPMaxIdleConnsPerHost = maxIdleConnsPerHost
+		DefaultUnixMaxConnections = unixMaxConnections
+	}(DefaultFDBudgetRatio, DefaultHTTPMaxIdleConns, DefaultHTTPMaxIdleConnsPerHost, DefaultUnixMaxConnections)
+
+	DefaultFDBudgetRatio = 0
+	if budget := ApplyFDBudget(); budget != 0 {
+		t.Errorf("expected no budget when disabled, got %d", budget)
+	}
+
+	DefaultFDBudgetRatio = 0.5
+	budget := int(float64(limit) * DefaultFDBudgetRatio)
+	DefaultHTTPMaxIdleConns = budget + 10
+	DefaultHTTPMaxIdleConnsPerHost = budget - 1
+	DefaultUnixMaxConnections = budget * 2
+
+	if applied := ApplyFDBudget(); applied != budget {
+		t.Fatalf("unexpected budget: %d, expected %d", applied, budget)
+	}
+	if DefaultHTTPMaxIdleConns != budget || DefaultUnixMaxConnections != budget {
+		t.Errorf("pool sizes not capped: %d %d", DefaultHTTPMaxIdleConns, DefaultUnixMaxConnections)
+	}
+	if DefaultHTTPMaxIdleConnsPerHost != budget-1 {
+		t.Errorf("pool size within budget changed: %d", DefaultHTTPMaxIdleConnsPerHost)
+	}
+}
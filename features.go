@@ -0,0 +1,187 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A FeatureFlag controls an experimental behavior. Feature flags are
+// registered once and can be switched at runtime, so features can be rolled
+// out gradually. A FeatureFlag is safe for concurrent use.
+type FeatureFlag struct {
+	Name        string
+	Description string
+	Default     bool
+
+	enabled int32
+	source  atomic.Value
+}
+
+// Sources of the state of feature flags.
+const (
+	FeatureSourceDefault = "default"
+	FeatureSourceEnv     = "env"
+	FeatureSourceConfig  = "config"
+)
+
+// Feature flags of experimental behaviors.
+var (
+	// FeatureAdaptiveLimiter enables adaptive concurrency control with
+	// DefaultAdaptiveMaxLimit for all newly constructed KCC instances.
+	FeatureAdaptiveLimiter = RegisterFeature("adaptive-limiter", "Enable adaptive concurrency control for new clients", false)
+	// FeatureStrictXML makes SOAP response parsing fail on malformed XML
+	// instead of ignoring everything after the first syntax error.
+	FeatureStrictXML = RegisterFeature("strict-xml", "Fail on malformed XML in SOAP responses", false)
+)
+
+// DefaultAdaptiveMaxLimit is the maximum concurrency limit used when adaptive
+// concurrency control is enabled by FeatureAdaptiveLimiter.
+var DefaultAdaptiveMaxLimit = 32
+
+var features = struct {
+	sync.RWMutex
+	flags map[string]*FeatureFlag
+}{
+	flags: make(map[string]*FeatureFlag),
+}
+
+func init() {
+	if s := os.Getenv("KCC_GO_FEATURES"); s != "" {
+		if err := SetFeatures(s, FeatureSourceEnv); err != nil {
+			fmt.Fprintf(os.Stderr, "kcc-go: invalid KCC_GO_FEATURES: %v\n", err)
+		}
+	}
+}
+
+// RegisterFeature registers a new feature flag with the provided name,
+// description and default state. Registering the same name twice panics.
+func RegisterFeature(name, description string, enabled bool) *FeatureFlag {
+	f := &FeatureFlag{
+		Name:        name,
+		Description: description,
+		Default:     enabled,
+	}
+	f.set(enabled, FeatureSourceDefault)
+
+	features.Lock()
+	defer features.Unlock()
+	if _, exists := features.flags[name]; exists {
+		panic("kcc: feature flag registered twice: " + name)
+	}
+	features.flags[name] = f
+
+	return f
+}
+
+// LookupFeature returns the registered feature flag with the provided name or
+// nil if there is none.
+func LookupFeature(name string) *FeatureFlag {
+	features.RLock()
+	defer features.RUnlock()
+
+	return features.flags[name]
+}
+
+// Enabled returns true if the accociated FeatureFlag is enabled.
+func (f *FeatureFlag) Enabled() bool {
+	return atomic.LoadInt32(&f.enabled) == 1
+}
+
+// Source returns where the current state of the accociated FeatureFlag was set.
+func (f *FeatureFlag) Source() string {
+	return f.source.Load().(string)
+}
+
+// Set enables or disables the accociated FeatureFlag, recording the provided
+// source of the change.
+func (f *FeatureFlag) Set(enabled bool, source string) {
+	f.set(enabled, source)
+}
+
+func (f *FeatureFlag) set(enabled bool, source string) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	f.source.Store(source)
+	atomic.StoreInt32(&f.enabled, v)
+}
+
+// SetFeatures switches the feature flags named in the provided comma separated
+// list. Names prefixed with "-" are disabled, all others are enabled. Unknown
+// names are reported as error after all known names have been applied.
+func SetFeatures(spec, source string) error {
+	var unknown []string
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		enabled := true
+		if strings.HasPrefix(name, "-") {
+			enabled = false
+			name = name[1:]
+		}
+		f := LookupFeature(name)
+		if f == nil {
+			unknown = append(unknown, name)
+			continue
+		}
+		f.Set(enabled, source)
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown feature flags: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// FeatureStatus holds the state of a feature flag.
+type FeatureStatus struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+	Default     bool   `json:"default"`
+	Source      string `json:"source"`
+}
+
+// Features returns the state of all registered feature flags, sorted by name.
+func Features() []*FeatureStatus {
+	features.RLock()
+	result := make([]*FeatureStatus, 0, len(features.flags))
+	for _, f := range features.flags {
+		result = append(result, &FeatureStatus{
+			Name:        f.Name,
+			Description: f.Description,
+			Enabled:     f.Enabled(),
+			Default:     f.Default,
+			Source:      f.Source(),
+		})
+	}
+	features.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSetFeatures(t *testing.T) {
+	f := RegisterFeature("test-set-features", "Test feature", false)
+	defer f.Set(false, FeatureSourceDefault)
+
+	if f.Enabled() || f.Source() != FeatureSourceDefault {
+		t.Fatalf("unexpected initial state: %v %v", f.Enabled(), f.Source())
+	}
+
+	if err := SetFeatures("test-set-features", FeatureSourceConfig); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Enabled() || f.Source() != FeatureSourceConfig {
+		t.Errorf("feature not enabled: %v %v", f.Enabled(), f.Source())
+	}
+
+	err := SetFeatures(" -test-set-features, test-unknown ", FeatureSourceEnv)
+	if err == nil || !strings.Contains(err.Error(), "test-unknown") {
+		t.Errorf("expected unknown feature error, got %v", err)
+	}
+	if f.Enabled() || f.Source() != FeatureSourceEnv {
+		t.Errorf("feature not disabled: %v %v", f.Enabled(), f.Source())
+	}
+
+	var found bool
+	for _, status := range Features() {
+		if status.Name == f.Name {
+			found = true
+			if status.Enabled || status.Default || status.Source != FeatureSourceEnv {
+				t.Errorf("unexpected feature status: %+v", status)
+			}
+		}
+	}
+	if !found {
+		t.Error("feature not listed")
+	}
+}
+
+func TestRegisterFeatureTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic")
+		}
+	}()
+	RegisterFeature(FeatureStrictXML.Name, "", false)
+}
+
+func TestStrictXMLFeature(t *testing.T) {
+	defer FeatureStrictXML.Set(FeatureStrictXML.Default, FeatureSourceDefault)
+
+	malformed := `<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/"><SOAP-ENV:Header><a></b></SOAP-ENV:Header></SOAP-ENV:Envelope>`
+
+	FeatureStrictXML.Set(false, FeatureSourceConfig)
+	var response LogoffResponse
+	if err := parseSOAPResponse(http.StatusOK, strings.NewReader(malformed), &response); err == nil || err.Error() != "failed to unmarshal SOAP response body" {
+		t.Errorf("expected generic error without strict XML, got %v", err)
+	}
+
+	FeatureStrictXML.Set(true, FeatureSourceConfig)
+	if err := parseSOAPResponse(http.StatusOK, strings.NewReader(malformed), &response); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+		t.Errorf("expected parse error with strict XML, got %v", err)
+	}
+}
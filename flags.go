@@ -63,3 +63,67 @@ const (
 	MAPI_AMBIGUOUS  ABFlag = 0x00000001
 	MAPI_RESOLVED   ABFlag = 0x00000002
 )
+
+// Kopano named property flags as defined in mapi4linux/include/mapidefs.h. This
+// only defines the flags actually used or understood by kcc-go.
+const (
+	MAPI_CREATE KCFlag = 0x00000002
+)
+
+// Message flags as defined in mapi4linux/include/mapidefs.h. This only defines
+// the flags actually used or understood by kcc-go.
+const (
+	MSGFLAG_READ       KCFlag = 0x00000001
+	MSGFLAG_UNMODIFIED KCFlag = 0x00000002
+	MSGFLAG_SUBMIT     KCFlag = 0x00000004
+	MSGFLAG_UNSENT     KCFlag = 0x00000008
+	MSGFLAG_HASATTACH  KCFlag = 0x00000010
+	MSGFLAG_FROMME     KCFlag = 0x00000020
+)
+
+// Kopano store type mask flags as defined in common/include/kopano/ECDefs.h.
+// This only defines the flags actually used or understood by kcc-go.
+const (
+	ECSTORE_TYPE_MASK_PRIVATE KCFlag = 0x00000001
+)
+
+// Kopano cache purge flags as defined in common/include/kopano/ECDefs.h.
+const (
+	PURGE_CACHE_QUOTA             KCFlag = 0x00000001
+	PURGE_CACHE_QUOTADEFAULT      KCFlag = 0x00000002
+	PURGE_CACHE_OBJECTS           KCFlag = 0x00000004
+	PURGE_CACHE_STORES            KCFlag = 0x00000008
+	PURGE_CACHE_ACL               KCFlag = 0x00000010
+	PURGE_CACHE_CELL              KCFlag = 0x00000020
+	PURGE_CACHE_INDEX1            KCFlag = 0x00000040
+	PURGE_CACHE_INDEX2            KCFlag = 0x00000080
+	PURGE_CACHE_INDEXEDPROPERTIES KCFlag = 0x00000100
+	PURGE_CACHE_USEROBJECT        KCFlag = 0x00000200
+	PURGE_CACHE_EXTERNID          KCFlag = 0x00000400
+	PURGE_CACHE_USERDETAILS       KCFlag = 0x00000800
+	PURGE_CACHE_SERVER            KCFlag = 0x00001000
+	PURGE_CACHE_ALL               KCFlag = 0xFFFFFFFF
+)
+
+// Kopano ICS sync types and change types as defined in
+// common/include/kopano/kcodes.h. This only defines the values actually used
+// or understood by kcc-go.
+const (
+	ICS_SYNC_CONTENTS  KCFlag = 1
+	ICS_SYNC_HIERARCHY KCFlag = 2
+
+	ICS_NEW         KCFlag = 0x0001
+	ICS_CHANGE      KCFlag = 0x0002
+	ICS_FLAG        KCFlag = 0x0004
+	ICS_HARD_DELETE KCFlag = 0x0008
+	ICS_SOFT_DELETE KCFlag = 0x0010
+	ICS_MOVED       KCFlag = 0x0020
+	ICS_MESSAGE     KCFlag = 0x1000
+	ICS_FOLDER      KCFlag = 0x2000
+)
+
+// Kopano user object classes as defined in common/include/kopano/ECDefs.h.
+const (
+	ACTIVE_USER    KCFlag = 0x00010001
+	NONACTIVE_USER KCFlag = 0x00010002
+)
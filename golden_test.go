@@ -0,0 +1,283 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Golden files live in a directory per SOAP client version, so a protocol
+// bump starts with a copy of the previous version's files and every wire
+// format change shows up as a diff of the new directory. Run the tests with
+// -update-golden to rewrite the request and decoded files after intended
+// changes. The response fixtures are recorded server responses and are never
+// written by the tests.
+var updateGolden = flag.Bool("update-golden", false, "update golden files of SOAP payloads")
+
+func goldenDir() string {
+	return filepath.Join("testdata", "golden", "v"+strconv.Itoa(ClientVersion))
+}
+
+// A goldenSOAPClient records the request envelopes it is asked to send and
+// responds with the recorded response fixture of the current golden case.
+type goldenSOAPClient struct {
+	response []byte
+	requests [][]byte
+}
+
+func (gc *goldenSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	gc.requests = append(gc.requests, soapEnvelope(payload, nil).Bytes())
+	return parseSOAPResponse(http.StatusOK, bytes.NewReader(append(append([]byte(soapHeader), gc.response...), soapFooter...)), v)
+}
+
+// A goldenCase calls a single SOAP API and returns the decoded response.
+type goldenCase struct {
+	name string
+	call func(ctx context.Context, c *KCC) (interface{}, error)
+}
+
+var goldenCases = []goldenCase{
+	{"logon", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.Logon(ctx, "user1", "pass&word", KOPANO_LOGON_NO_REGISTER_SESSION)
+	}},
+	{"ssoLogon", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.SSOLogon(ctx, KOPANO_SSO_TYPE_KCOIDC, "user1", []byte("token"), 0, 0)
+	}},
+	{"logoff", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.Logoff(ctx, 7)
+	}},
+	{"resolveUsername", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.ResolveUsername(ctx, "user1", 7)
+	}},
+	{"getUser", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.GetUser(ctx, "AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAMAAAAAAAAA", 7)
+	}},
+	{"getCompany", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.GetCompany(ctx, "", 7)
+	}},
+	{"abResolveNames", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.ABResolveNames(ctx, []PT{PR_ENTRYID, PR_DISPLAY_NAME}, map[PT]interface{}{
+			PR_DISPLAY_NAME: "user1",
+		}, MAPI_UNRESOLVED, 7, 0)
+	}},
+	{"createUser", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.CreateUser(ctx, &User{
+			Username:    "user3",
+			FullName:    "User <Three>",
+			MailAddress: "user3@example.org",
+		}, "pass&word", 7)
+	}},
+	{"setUser", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.SetUser(ctx, &User{
+			ID:          3,
+			Username:    "user1",
+			FullName:    "User One",
+			MailAddress: "user1@example.org",
+			ObjClass:    ACTIVE_USER,
+			UserEntryID: "AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAMAAAAAAAAA",
+			Props: &PropMap{
+				{ID: 973013023, StringValue: "ou=people"},
+			},
+			MVProps: &MVPropMap{
+				{ID: 2148470814, StringValues: []string{"alias1@example.org"}},
+			},
+		}, "", 7)
+	}},
+	{"deleteUser", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.DeleteUser(ctx, "AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAMAAAAAAAAA", 7)
+	}},
+	{"setQuota", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.SetQuota(ctx, "AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAMAAAAAAAAA", &Quota{
+			WarnSize: 900 << 20,
+			SoftSize: 950 << 20,
+			HardSize: 1000 << 20,
+		}, 7)
+	}},
+	{"purgeSoftDelete", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.PurgeSoftDelete(ctx, 30, 7)
+	}},
+	{"purgeDeferredUpdates", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.PurgeDeferredUpdates(ctx, 7)
+	}},
+	{"purgeCache", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.PurgeCache(ctx, 0, 7)
+	}},
+	{"setSyncStatus", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.SetSyncStatus(ctx, "3E8C4C9A9FE64F4B9E6D7C5AB3B7E0A10100000000000000", 0, 0, ICS_SYNC_CONTENTS, 0, 7)
+	}},
+	{"getChanges", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.GetChanges(ctx, "3E8C4C9A9FE64F4B9E6D7C5AB3B7E0A10100000000000000", 12, 40, ICS_SYNC_CONTENTS, 0, 7)
+	}},
+	{"getEntryIDFromSourceKey", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.GetEntryIDFromSourceKey(ctx, "AAAAADhxUgoDAAAAAQAAAAAAAAA=", "3E8C4C9A9FE64F4B9E6D7C5AB3B7E0A10100000000000000", "3E8C4C9A9FE64F4B9E6D7C5AB3B7E0A12A0000000000000", 7)
+	}},
+	{"getIDsFromNames", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.GetIDsFromNames(ctx, []*NamedProp{PidLidLocation, PidLidTaskStatus}, MAPI_CREATE, 7)
+	}},
+	{"getStore", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.GetStore(ctx, "", 7)
+	}},
+	{"resolveUserStore", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.ResolveUserStore(ctx, "user1", 0, 7)
+	}},
+	{"loadObject", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.LoadObject(ctx, "AAAAADhxUgoDAAAAAQAAAAAAAAA=", 0, 7)
+	}},
+	{"saveObject", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.SaveObject(ctx, "AAAAADhxUgoDAAAAAQAAAAAAAAA=", "", &SaveObject{
+			ModProps: []*PropTagRowSetValue{
+				{PropTag: PR_MESSAGE_CLASS, AStringValue: "IPM.Note"},
+				{PropTag: PR_SUBJECT, AStringValue: "Golden <subject>"},
+			},
+			ObjType: MAPI_MESSAGE,
+		}, 0, 7)
+	}},
+	{"submitMessage", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.SubmitMessage(ctx, "AAAAADhxUgoDAAAAAQAAAAAAAAA=", 0, 7)
+	}},
+	{"deleteObjects", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.DeleteObjects(ctx, []string{"AAAAADhxUgoDAAAAAQAAAAAAAAA=", "AAAAADhxUgoDAAAAAgAAAAAAAAA="}, 0, 7)
+	}},
+	{"tableOpen", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.TableOpen(ctx, "AAAAADhxUgoDAAAAAQAAAAAAAAA=", TABLETYPE_MS, MAPI_MESSAGE, 0, 7)
+	}},
+	{"tableSetColumns", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.TableSetColumns(ctx, 3, []PT{PR_ENTRYID, PR_SUBJECT}, 7)
+	}},
+	{"tableQueryRows", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.TableQueryRows(ctx, 3, 100, 0, 7)
+	}},
+	{"tableClose", func(ctx context.Context, c *KCC) (interface{}, error) {
+		return c.TableClose(ctx, 3, 7)
+	}},
+	{"getUserList", func(ctx context.Context, c *KCC) (interface{}, error) {
+		var users []*User
+		err := c.ListUsers(ctx, "", 7, func(user *User) error {
+			users = append(users, user)
+			return nil
+		})
+		return users, err
+	}},
+}
+
+// checkGolden compares the provided data with the golden file of the provided
+// name, or writes the golden file when running with -update-golden.
+func checkGolden(t *testing.T, name string, data []byte) {
+	fn := filepath.Join(goldenDir(), name)
+	if *updateGolden {
+		if err := ioutil.WriteFile(fn, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	expected, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update-golden to create): %v", err)
+	}
+	if !bytes.Equal(expected, data) {
+		t.Errorf("wire format drift in %s (run with -update-golden if intended)\nexpected:\n%s\ngot:\n%s", fn, expected, data)
+	}
+}
+
+func TestGoldenSOAPPayloads(t *testing.T) {
+	for _, gc := range goldenCases {
+		gc := gc
+		t.Run(gc.name, func(t *testing.T) {
+			response, err := ioutil.ReadFile(filepath.Join(goldenDir(), gc.name+".response.xml"))
+			if err != nil {
+				t.Fatalf("failed to read response fixture: %v", err)
+			}
+			client := &goldenSOAPClient{
+				response: bytes.TrimSpace(response),
+			}
+			c := NewKCCWithClient(client)
+			c.SetClientApp("kcc-go-golden", "1.0")
+
+			result, err := gc.call(context.Background(), c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(client.requests) != 1 {
+				t.Fatalf("unexpected number of requests: %d", len(client.requests))
+			}
+			checkGolden(t, gc.name+".request.xml", append(client.requests[0], '\n'))
+
+			decoded, err := json.MarshalIndent(map[string]interface{}{
+				"er":       responseKCError(result),
+				"response": result,
+			}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, gc.name+".decoded.json", append(decoded, '\n'))
+		})
+	}
+}
+
+func TestSOAPPayloadsEscapeEntryIDs(t *testing.T) {
+	const entryID = "a<b&c"
+	calls := map[string]func(ctx context.Context, c *KCC){
+		"getUser":    func(ctx context.Context, c *KCC) { c.GetUser(ctx, entryID, 7) },
+		"getCompany": func(ctx context.Context, c *KCC) { c.GetCompany(ctx, entryID, 7) },
+		"setUser": func(ctx context.Context, c *KCC) {
+			c.SetUser(ctx, &User{Username: "user1", UserEntryID: entryID}, "", 7)
+		},
+		"deleteUser":   func(ctx context.Context, c *KCC) { c.DeleteUser(ctx, entryID, 7) },
+		"setQuota":     func(ctx context.Context, c *KCC) { c.SetQuota(ctx, entryID, &Quota{}, 7) },
+		"getUserList":  func(ctx context.Context, c *KCC) { c.ListUsers(ctx, entryID, 7, func(*User) error { return nil }) },
+		"getGroupList": func(ctx context.Context, c *KCC) { c.ListGroups(ctx, entryID, 7) },
+		"setGroup": func(ctx context.Context, c *KCC) {
+			c.SetGroup(ctx, &Group{Groupname: "group1", GroupEntryID: entryID}, 7)
+		},
+		"deleteGroup":             func(ctx context.Context, c *KCC) { c.DeleteGroup(ctx, entryID, 7) },
+		"getUserListOfGroup":      func(ctx context.Context, c *KCC) { c.ListGroupUsers(ctx, entryID, 7) },
+		"addGroupUser":            func(ctx context.Context, c *KCC) { c.AddGroupUser(ctx, entryID, entryID, 7) },
+		"getStore":                func(ctx context.Context, c *KCC) { c.GetStore(ctx, entryID, 7) },
+		"getReceiveFolder":        func(ctx context.Context, c *KCC) { c.GetReceiveFolder(ctx, entryID, "IPM", 7) },
+		"loadObject":              func(ctx context.Context, c *KCC) { c.LoadObject(ctx, entryID, 0, 7) },
+		"saveObject":              func(ctx context.Context, c *KCC) { c.SaveObject(ctx, entryID, entryID, &SaveObject{}, 0, 7) },
+		"submitMessage":           func(ctx context.Context, c *KCC) { c.SubmitMessage(ctx, entryID, 0, 7) },
+		"deleteObjects":           func(ctx context.Context, c *KCC) { c.DeleteObjects(ctx, []string{entryID}, 0, 7) },
+		"tableOpen":               func(ctx context.Context, c *KCC) { c.TableOpen(ctx, entryID, TABLETYPE_MS, MAPI_MESSAGE, 0, 7) },
+		"setSyncStatus":           func(ctx context.Context, c *KCC) { c.SetSyncStatus(ctx, entryID, 0, 0, ICS_SYNC_CONTENTS, 0, 7) },
+		"getChanges":              func(ctx context.Context, c *KCC) { c.GetChanges(ctx, entryID, 0, 0, ICS_SYNC_CONTENTS, 0, 7) },
+		"getEntryIDFromSourceKey": func(ctx context.Context, c *KCC) { c.GetEntryIDFromSourceKey(ctx, entryID, entryID, entryID, 7) },
+	}
+
+	for name, call := range calls {
+		client := &actionSOAPClient{}
+		call(context.Background(), NewKCCWithClient(client))
+		if len(client.payloads) == 0 {
+			t.Errorf("%s sent no request", name)
+			continue
+		}
+		payload := client.payloads[0]
+		if strings.Contains(payload, entryID) || !strings.Contains(payload, "a&lt;b&amp;c") {
+			t.Errorf("%s payload does not escape the entry ID: %s", name, payload)
+		}
+	}
+}
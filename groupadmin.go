@@ -0,0 +1,171 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// writeGroup writes the provided group as SOAP group struct with the provided
+// name. Empty strings are left out, so the server keeps their current values
+// when updating.
+func writeGroup(b *strings.Builder, name string, group *Group) {
+	b.WriteString("<")
+	b.WriteString(name)
+	b.WriteString("><ulGroupId>")
+	b.WriteString(strconv.FormatUint(group.ID, 10))
+	b.WriteString("</ulGroupId><sGroupId>")
+	b.WriteString(xmlCharData(group.GroupEntryID).Escape())
+	b.WriteString("</sGroupId>")
+	writeOptionalString(b, "lpszGroupname", group.Groupname)
+	writeOptionalString(b, "lpszFullname", group.FullName)
+	writeOptionalString(b, "lpszFullEmail", group.MailAddress)
+	b.WriteString("<ulIsABHidden>")
+	b.WriteString(strconv.FormatUint(group.IsABHidden, 10))
+	b.WriteString("</ulIsABHidden>")
+	writePropMaps(b, group.Props, group.MVProps)
+	b.WriteString("</")
+	b.WriteString(name)
+	b.WriteString(">")
+}
+
+// ListGroups lists all groups of the company with the provided Entry ID
+// using the provided session. An empty company Entry ID lists the groups of
+// the default company.
+func (c *KCC) ListGroups(ctx context.Context, companyEntryID string, sessionID KCSessionID) (*GetGroupListResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:getGroupList><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><ulCompanyId>0</ulCompanyId><sCompanyId>")
+	b.WriteString(xmlCharData(companyEntryID).Escape())
+	b.WriteString("</sCompanyId></ns:getGroupList>")
+	payload := b.String()
+
+	var groupListResponse GetGroupListResponse
+	err := c.Client.DoRequest(ctx, &payload, &groupListResponse)
+
+	return &groupListResponse, err
+}
+
+// CreateGroup creates a new group with the details of the provided group
+// using the provided session. The ID and Entry ID of the provided group are
+// ignored.
+func (c *KCC) CreateGroup(ctx context.Context, group *Group, sessionID KCSessionID) (*CreateGroupResponse, error) {
+	create := *group
+	create.ID = 0
+	create.GroupEntryID = ""
+
+	var b strings.Builder
+	b.WriteString("<ns:createGroup><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId>")
+	writeGroup(&b, "lpsGroup", &create)
+	b.WriteString("</ns:createGroup>")
+	payload := b.String()
+
+	var createGroupResponse CreateGroupResponse
+	err := c.Client.DoRequest(ctx, &payload, &createGroupResponse)
+
+	return &createGroupResponse, err
+}
+
+// SetGroup updates the group identified by the provided group's Entry ID
+// with the details of the provided group using the provided session. Update
+// a group as listed with ListGroups, as all other values are set as given.
+func (c *KCC) SetGroup(ctx context.Context, group *Group, sessionID KCSessionID) (*UserAdminResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:setGroup><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId>")
+	writeGroup(&b, "lpsGroup", group)
+	b.WriteString("</ns:setGroup>")
+	payload := b.String()
+
+	var setGroupResponse UserAdminResponse
+	err := c.Client.DoRequest(ctx, &payload, &setGroupResponse)
+
+	return &setGroupResponse, err
+}
+
+// DeleteGroup deletes the group with the provided Entry ID using the
+// provided session.
+func (c *KCC) DeleteGroup(ctx context.Context, groupEntryID string, sessionID KCSessionID) (*UserAdminResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:deleteGroup><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><ulGroupId>0</ulGroupId><sGroupId>")
+	b.WriteString(xmlCharData(groupEntryID).Escape())
+	b.WriteString("</sGroupId></ns:deleteGroup>")
+	payload := b.String()
+
+	var deleteGroupResponse UserAdminResponse
+	err := c.Client.DoRequest(ctx, &payload, &deleteGroupResponse)
+
+	return &deleteGroupResponse, err
+}
+
+// ListGroupUsers lists the members of the group with the provided Entry ID
+// using the provided session.
+func (c *KCC) ListGroupUsers(ctx context.Context, groupEntryID string, sessionID KCSessionID) (*GetUserListResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:getUserListOfGroup><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><ulGroupId>0</ulGroupId><sGroupId>")
+	b.WriteString(xmlCharData(groupEntryID).Escape())
+	b.WriteString("</sGroupId></ns:getUserListOfGroup>")
+	payload := b.String()
+
+	var userListResponse GetUserListResponse
+	err := c.Client.DoRequest(ctx, &payload, &userListResponse)
+
+	return &userListResponse, err
+}
+
+// AddGroupUser adds the user with the provided Entry ID to the group with the
+// provided Entry ID using the provided session.
+func (c *KCC) AddGroupUser(ctx context.Context, groupEntryID, userEntryID string, sessionID KCSessionID) (*UserAdminResponse, error) {
+	return c.modifyGroupUser(ctx, "addGroupUser", groupEntryID, userEntryID, sessionID)
+}
+
+// DeleteGroupUser removes the user with the provided Entry ID from the group
+// with the provided Entry ID using the provided session.
+func (c *KCC) DeleteGroupUser(ctx context.Context, groupEntryID, userEntryID string, sessionID KCSessionID) (*UserAdminResponse, error) {
+	return c.modifyGroupUser(ctx, "deleteGroupUser", groupEntryID, userEntryID, sessionID)
+}
+
+func (c *KCC) modifyGroupUser(ctx context.Context, action, groupEntryID, userEntryID string, sessionID KCSessionID) (*UserAdminResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:")
+	b.WriteString(action)
+	b.WriteString("><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><ulGroupId>0</ulGroupId><sGroupId>")
+	b.WriteString(xmlCharData(groupEntryID).Escape())
+	b.WriteString("</sGroupId><ulUserId>0</ulUserId><sUserId>")
+	b.WriteString(xmlCharData(userEntryID).Escape())
+	b.WriteString("</sUserId></ns:")
+	b.WriteString(action)
+	b.WriteString(">")
+	payload := b.String()
+
+	var modifyResponse UserAdminResponse
+	err := c.Client.DoRequest(ctx, &payload, &modifyResponse)
+
+	return &modifyResponse, err
+}
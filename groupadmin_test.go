@@ -0,0 +1,91 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestGroupAdmin(t *testing.T) {
+	client := &actionSOAPClient{
+		responses: map[string]string{
+			"getGroupList": "<ns:getGroupListResponse><sGroupArray>" +
+				"<item><ulGroupId>3</ulGroupId><sGroupId>AAAA03</sGroupId><lpszGroupname>group1</lpszGroupname><lpszFullname>Group 1</lpszFullname><lpszFullEmail>group1@example.org</lpszFullEmail><ulIsABHidden>0</ulIsABHidden></item>" +
+				"</sGroupArray><er>0</er></ns:getGroupListResponse>",
+			"createGroup":        "<ns:createGroupResponse><ulGroupId>4</ulGroupId><sGroupId>AAAA04</sGroupId><er>0</er></ns:createGroupResponse>",
+			"setGroup":           "<ns:setGroupResponse><result>0</result></ns:setGroupResponse>",
+			"deleteGroup":        "<ns:deleteGroupResponse><result>0</result></ns:deleteGroupResponse>",
+			"getUserListOfGroup": "<ns:getUserListOfGroupResponse><sUserArray><item><ulUserId>5</ulUserId><lpszUsername>user1</lpszUsername><sUserId>AAAA05</sUserId></item></sUserArray><er>0</er></ns:getUserListOfGroupResponse>",
+			"addGroupUser":       "<ns:addGroupUserResponse><result>0</result></ns:addGroupUserResponse>",
+			"deleteGroupUser":    "<ns:deleteGroupUserResponse><result>2147483650</result></ns:deleteGroupUserResponse>",
+		},
+	}
+	c := NewKCCWithClient(client)
+	ctx := context.Background()
+
+	groups, err := c.ListGroups(ctx, "", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups.Groups) != 1 || groups.Groups[0].Groupname != "group1" || groups.Groups[0].MailAddress != "group1@example.org" || groups.Groups[0].GroupEntryID != "AAAA03" {
+		t.Errorf("unexpected groups: %+v", groups.Groups)
+	}
+
+	created, err := c.CreateGroup(ctx, &Group{ID: 3, GroupEntryID: "AAAA03", Groupname: "group2", FullName: "Group & 2"}, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.GroupEntryID != "AAAA04" {
+		t.Errorf("unexpected created group: %+v", created)
+	}
+	if payload := client.payloads[1]; !strings.Contains(payload, "<lpsGroup><ulGroupId>0</ulGroupId><sGroupId></sGroupId><lpszGroupname>group2</lpszGroupname><lpszFullname>Group &amp; 2</lpszFullname><ulIsABHidden>0</ulIsABHidden></lpsGroup>") {
+		t.Errorf("unexpected create group payload: %s", payload)
+	}
+
+	group := groups.Groups[0]
+	group.FullName = "First group"
+	if resp, err := c.SetGroup(ctx, group, 7); err != nil || resp.Er != KCSuccess {
+		t.Fatalf("set group failed: %v %v", err, resp)
+	}
+	if payload := client.payloads[2]; !strings.Contains(payload, "<ulGroupId>3</ulGroupId><sGroupId>AAAA03</sGroupId><lpszGroupname>group1</lpszGroupname><lpszFullname>First group</lpszFullname>") {
+		t.Errorf("unexpected set group payload: %s", payload)
+	}
+
+	if resp, err := c.DeleteGroup(ctx, "AAAA04", 7); err != nil || resp.Er != KCSuccess {
+		t.Fatalf("delete group failed: %v %v", err, resp)
+	}
+
+	members, err := c.ListGroupUsers(ctx, "AAAA03", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members.Users) != 1 || members.Users[0].UserEntryID != "AAAA05" {
+		t.Errorf("unexpected members: %+v", members.Users)
+	}
+
+	if resp, err := c.AddGroupUser(ctx, "AAAA03", "AAAA06", 7); err != nil || resp.Er != KCSuccess {
+		t.Fatalf("add group user failed: %v %v", err, resp)
+	}
+	if payload := client.payloads[5]; payload != "<ns:addGroupUser><ulSessionId>7</ulSessionId><ulGroupId>0</ulGroupId><sGroupId>AAAA03</sGroupId><ulUserId>0</ulUserId><sUserId>AAAA06</sUserId></ns:addGroupUser>" {
+		t.Errorf("unexpected add group user payload: %s", payload)
+	}
+	if resp, err := c.DeleteGroupUser(ctx, "AAAA03", "AAAA05", 7); err != nil || resp.Er != KCERR_NOT_FOUND {
+		t.Errorf("expected not found deleting group user, got %v %v", err, resp)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// NewH2CTransport creates a new http2.Transport which sends requests of
+// http:// URLs with HTTP/2 over connections without TLS (h2c with prior
+// knowledge), so concurrent requests share one connection. If path is not
+// empty, all requests are sent over connections to the Unix socket at path
+// regardless of their host, and if owner is not nil, the owner of the process
+// serving the socket is checked on every new connection. The server, usually
+// a reverse proxy in front of Kopano server, must support h2c with prior
+// knowledge, there is no upgrade from HTTP/1.1.
+func NewH2CTransport(path string, owner *SocketPeerOwner) *http2.Transport {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(DefaultHTTPDialTimeoutSeconds) * time.Second,
+		KeepAlive: time.Duration(DefaultHTTPKeepAliveSeconds) * time.Second,
+		DualStack: DefaultHTTPDualStack,
+	}
+
+	return &http2.Transport{
+		AllowHTTP: true,
+		// NOTE(longsleep): The transport asks for a TLS connection, since
+		// AllowHTTP permits http:// URLs a plain connection is returned.
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			if path == "" {
+				return dialer.DialContext(ctx, network, addr)
+			}
+			conn, err := dialer.DialContext(ctx, "unix", path)
+			if err != nil {
+				return nil, err
+			}
+			if owner != nil {
+				if err = checkSocketPeer(conn, path, owner); err != nil {
+					conn.Close()
+					return nil, err
+				}
+			}
+			return conn, nil
+		},
+	}
+}
+
+// NewH2CHTTPClient creates a new http.Client with the default settings, using
+// a new http2.Transport sending requests with HTTP/2 without TLS. See
+// NewH2CTransport for details.
+func NewH2CHTTPClient(path string, owner *SocketPeerOwner) *http.Client {
+	return &http.Client{
+		Timeout:   time.Duration(DefaultHTTPTimeoutSeconds) * time.Second,
+		Transport: NewH2CTransport(path, owner),
+	}
+}
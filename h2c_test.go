@@ -0,0 +1,135 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// protoHandler responds to resolveUser requests with the HTTP protocol
+// version of the request as user entry ID.
+var protoHandler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+	rw.Write([]byte(soapHeader + "<ns:resolveUserResponse><er>0</er><sUserId>" + req.Proto + "</sUserId></ns:resolveUserResponse>" + soapFooter))
+})
+
+func resolveProto(t *testing.T, client SOAPClient) string {
+	resp, err := NewKCCWithClient(client).ResolveUsername(context.Background(), "user1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.UserEntryID
+}
+
+func TestSOAPHTTPClientHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(protoHandler)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	tlsConfig := SetTLSSessionCacheToTLSConfig(0, nil)
+	tlsConfig.RootCAs = pool
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		TLSConfig: tlsConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proto := resolveProto(t, client); proto != "HTTP/1.1" {
+		t.Errorf("expected HTTP/1.1 by default, got %s", proto)
+	}
+
+	defer func(http2 bool) {
+		DefaultHTTP2 = http2
+	}(DefaultHTTP2)
+	DefaultHTTP2 = true
+
+	client, err = NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		TLSConfig: tlsConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proto := resolveProto(t, client); proto != "HTTP/2.0" {
+		t.Errorf("expected HTTP/2 with TLS, got %s", proto)
+	}
+}
+
+func TestSOAPHTTPClientH2C(t *testing.T) {
+	handler := h2c.NewHandler(protoHandler, &http2.Server{})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	for _, h2c := range []bool{false, true} {
+		client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+			HTTPH2C: h2c,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := "HTTP/1.1"
+		if h2c {
+			expected = "HTTP/2.0"
+		}
+		if proto := resolveProto(t, client); proto != expected {
+			t.Errorf("expected %s with h2c %v, got %s", expected, h2c, proto)
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "kcc-go-h2c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "server.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unixSrv := &http.Server{
+		Handler: handler,
+	}
+	go unixSrv.Serve(listener)
+	defer unixSrv.Close()
+
+	client, err := NewSOAPClientWithConfig(&url.URL{Scheme: "http+unix", Path: path}, &SOAPClientConfig{
+		HTTPH2C: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proto := resolveProto(t, client); proto != "HTTP/2.0" {
+		t.Errorf("expected HTTP/2 over unix socket with h2c, got %s", proto)
+	}
+}
@@ -17,6 +17,8 @@
 package kcc
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -34,6 +36,18 @@ var (
 	DefaultHTTPDialTimeoutSeconds     int64 = 30
 	DefaultHTTPKeepAliveSeconds       int64 = 120
 	DefaultHTTPDualStack                    = true
+	// DefaultTLSSessionCacheSize is the number of TLS sessions kept for
+	// resumption by HTTP clients. A size of 0 disables resumption.
+	DefaultTLSSessionCacheSize = 64
+	// DefaultHTTPGzip enables gzip compression of requests and responses of
+	// new SOAP HTTP clients.
+	DefaultHTTPGzip = false
+	// DefaultHTTP2 enables HTTP/2 for https:// connections of new HTTP
+	// transports when the server supports it.
+	DefaultHTTP2 = false
+	// DefaultHTTPH2C makes new SOAP HTTP clients send requests of http:// and
+	// http+unix:// URIs with HTTP/2 without TLS, see NewH2CTransport.
+	DefaultHTTPH2C = false
 )
 
 // DefaultHTTPClient is the default Client as used by KCC for HTTP SOAP requests.
@@ -75,6 +89,35 @@ func init() {
 			DefaultHTTPKeepAliveSeconds = n
 		}
 	}
+	if s := os.Getenv("KCC_GO_TLS_SESSION_CACHE_SIZE"); s != "" {
+		if n, err := strconv.ParseInt(s, 10, 0); err == nil {
+			DefaultTLSSessionCacheSize = int(n)
+		}
+	}
+	if s := os.Getenv("KCC_GO_HTTP_GZIP"); s != "" {
+		switch s {
+		case "off", "false", "no":
+			DefaultHTTPGzip = false
+		case "on", "true", "yes":
+			DefaultHTTPGzip = true
+		}
+	}
+	if s := os.Getenv("KCC_GO_HTTP2"); s != "" {
+		switch s {
+		case "off", "false", "no":
+			DefaultHTTP2 = false
+		case "on", "true", "yes":
+			DefaultHTTP2 = true
+		}
+	}
+	if s := os.Getenv("KCC_GO_HTTP_H2C"); s != "" {
+		switch s {
+		case "off", "false", "no":
+			DefaultHTTPH2C = false
+		case "on", "true", "yes":
+			DefaultHTTPH2C = true
+		}
+	}
 	if s := os.Getenv("KCC_GO_HTTP_DUALSTACK"); s != "" {
 		switch s {
 		case "off", "false", "no":
@@ -84,30 +127,97 @@ func init() {
 		}
 	}
 
+	// Cap pool sizes before creating the default transport with them.
+	ApplyFDBudget()
+
+	DefaultHTTPTransport = NewHTTPTransport(nil)
+	DefaultHTTPClient = &http.Client{
+		Timeout:   time.Duration(DefaultHTTPTimeoutSeconds) * time.Second,
+		Transport: DefaultHTTPTransport,
+	}
+
+	if debug {
+		fmt.Printf("HTTP client: %+v\n", DefaultHTTPClient)
+		fmt.Printf("HTTP client transport: %+v\n", DefaultHTTPTransport)
+	}
+}
+
+// NewHTTPTransport creates a new http.Transport with the default settings and
+// the provided TLS config. If the TLS config is nil, a new one is created with
+// a session cache of DefaultTLSSessionCacheSize. Use it to create clients with
+// their own connections and TLS settings, for example with their own TLS
+// session cache. HTTP/2 is used for TLS connections if DefaultHTTP2 is set
+// and the server supports it, so concurrent requests share one connection.
+func NewHTTPTransport(tlsConfig *tls.Config) *http.Transport {
+	if tlsConfig == nil {
+		tlsConfig = SetTLSSessionCacheToTLSConfig(DefaultTLSSessionCacheSize, nil)
+	}
+
 	dialer := &net.Dialer{
 		Timeout:   time.Duration(DefaultHTTPDialTimeoutSeconds) * time.Second,
 		KeepAlive: time.Duration(DefaultHTTPKeepAliveSeconds) * time.Second,
 		DualStack: DefaultHTTPDualStack,
 	}
 
-	DefaultHTTPTransport = &http.Transport{
+	return &http.Transport{
 		Proxy:                 http.ProxyFromEnvironment,
 		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
 		MaxIdleConns:          DefaultHTTPMaxIdleConns,
 		MaxIdleConnsPerHost:   DefaultHTTPMaxIdleConnsPerHost,
 		IdleConnTimeout:       time.Duration(DefaultHTTPIdleConnTimeoutSeconds) * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
+		// NOTE(longsleep): Setting DialContext or TLSClientConfig disables
+		// HTTP/2 unless it is forced.
+		ForceAttemptHTTP2: DefaultHTTP2,
 	}
+}
 
-	DefaultHTTPClient = &http.Client{
+// NewHTTPClient creates a new http.Client with the default settings, using a
+// new http.Transport with the provided TLS config. See NewHTTPTransport for
+// details.
+func NewHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
 		Timeout:   time.Duration(DefaultHTTPTimeoutSeconds) * time.Second,
-		Transport: DefaultHTTPTransport,
+		Transport: NewHTTPTransport(tlsConfig),
 	}
+}
 
-	if debug {
-		fmt.Printf("HTTP client: %+v\n", DefaultHTTPClient)
-		fmt.Printf("HTTP client transport: %+v\n", DefaultHTTPTransport)
-		fmt.Printf("HTTP client transport dial: %+v\n", dialer)
+// NewUnixHTTPTransport creates a new http.Transport with the default settings,
+// which sends all requests over connections to the Unix socket at the provided
+// path regardless of their host. If owner is not nil, the owner of the process
+// serving the socket is checked on every new connection.
+func NewUnixHTTPTransport(path string, owner *SocketPeerOwner) *http.Transport {
+	transport := NewHTTPTransport(nil)
+	transport.Proxy = nil
+
+	dialer := &net.Dialer{
+		Timeout: time.Duration(DefaultHTTPDialTimeoutSeconds) * time.Second,
+	}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, "unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if owner != nil {
+			if err = checkSocketPeer(conn, path, owner); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		return conn, nil
+	}
+
+	return transport
+}
+
+// NewUnixHTTPClient creates a new http.Client with the default settings, using
+// a new http.Transport connecting to the Unix socket at the provided path. See
+// NewUnixHTTPTransport for details.
+func NewUnixHTTPClient(path string, owner *SocketPeerOwner) *http.Client {
+	return &http.Client{
+		Timeout:   time.Duration(DefaultHTTPTimeoutSeconds) * time.Second,
+		Transport: NewUnixHTTPTransport(path, owner),
 	}
 }
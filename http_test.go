@@ -17,9 +17,19 @@
 package kcc
 
 import (
+	"compress/gzip"
+	"context"
 	"crypto/tls"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"testing"
 )
 
 var defaultHTTPInsecureSkipVerify = false
@@ -48,3 +58,92 @@ func init() {
 		fmt.Printf("Warning: kcc-go default HTTP client transport has disabled TLS verification\n")
 	}
 }
+
+func TestSOAPHTTPClientGzip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Content-Encoding") != "gzip" || req.Header.Get("Accept-Encoding") != "gzip" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(zr)
+		if !strings.Contains(string(body), "<lpszUsername>user1</lpszUsername>") {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		rw.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(rw)
+		zw.Write([]byte(soapHeader + "<ns:resolveUserResponse><er>0</er><sUserId>user1-id</sUserId></ns:resolveUserResponse>" + soapFooter))
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		HTTPClient: srv.Client(),
+		HTTPGzip:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := NewKCCWithClient(client).ResolveUsername(context.Background(), "user1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.UserEntryID != "user1-id" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+func TestSOAPHTTPClientUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kcc-go-http-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "server.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			rw.Write([]byte(soapHeader + "<ns:resolveUserResponse><er>0</er><sUserId>user1-id</sUserId></ns:resolveUserResponse>" + soapFooter))
+		}),
+	}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	uri := &url.URL{Scheme: "http+unix", Path: path}
+	for _, newClient := range []func() (SOAPClient, error){
+		func() (SOAPClient, error) { return NewSOAPClient(uri) },
+		func() (SOAPClient, error) {
+			return NewSOAPClientWithConfig(uri, &SOAPClientConfig{RetryPolicy: &RetryPolicy{MaxAttempts: 1}})
+		},
+	} {
+		client, err := newClient()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := client.(*SOAPHTTPClient).String(); s != "<http+unix:"+path+">" {
+			t.Errorf("unexpected client string: %s", s)
+		}
+		resp, err := NewKCCWithClient(client).ResolveUsername(context.Background(), "user1", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.UserEntryID != "user1-id" {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	}
+
+	if _, err := NewSOAPClient(&url.URL{Scheme: "http+unix"}); err == nil {
+		t.Errorf("expected error without socket path")
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"net/http"
+	"net/textproto"
+)
+
+// reservedHTTPHeaders are set by SOAP HTTP clients to transport the request
+// and can not be set with WithHTTPHeaders.
+var reservedHTTPHeaders = map[string]bool{
+	"Accept-Encoding":   true,
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Content-Type":      true,
+	"Host":              true,
+	"Transfer-Encoding": true,
+}
+
+type httpHeadersKey struct{}
+
+// WithHTTPHeaders returns a copy of the provided context with the provided
+// HTTP headers added to the HTTP headers of the context. SOAP HTTP clients send
+// them with requests using the returned context, for example X-Request-Id or
+// X-Forwarded-For for proxies in front of the Kopano server. They replace
+// headers of the same name set by the client, like the User-Agent or the
+// X-Forwarded-For of the ClientInfo, and headers of the same name added to the
+// context before. Headers which transport the request, like Content-Type, are
+// ignored. Socket clients ignore HTTP headers.
+func WithHTTPHeaders(ctx context.Context, headers http.Header) context.Context {
+	merged := make(http.Header)
+	for key, values := range HTTPHeadersFromContext(ctx) {
+		merged[key] = values
+	}
+	for key, values := range headers {
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		if reservedHTTPHeaders[key] {
+			continue
+		}
+		merged[key] = append([]string(nil), values...)
+	}
+
+	return context.WithValue(ctx, httpHeadersKey{}, merged)
+}
+
+// HTTPHeadersFromContext returns the HTTP headers of the provided context,
+// added with WithHTTPHeaders. The returned headers must not be modified.
+func HTTPHeadersFromContext(ctx context.Context) http.Header {
+	if ctx == nil {
+		return nil
+	}
+	headers, _ := ctx.Value(httpHeadersKey{}).(http.Header)
+
+	return headers
+}
+
+// setHTTPHeaders sets the HTTP headers of the provided context on the provided
+// request.
+func setHTTPHeaders(ctx context.Context, req *http.Request) {
+	for key, values := range HTTPHeadersFromContext(ctx) {
+		req.Header[key] = append([]string(nil), values...)
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestSOAPHTTPClientHTTPHeaders(t *testing.T) {
+	var headers http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		headers = req.Header
+		rw.Write([]byte(soapHeader + "<ns:logoffResponse><er>0</er></ns:logoffResponse>" + soapFooter))
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewKCCWithClient(client)
+
+	ctx := WithClientInfo(context.Background(), &ClientInfo{
+		RemoteAddr: "192.0.2.1",
+	})
+	ctx = WithHTTPHeaders(ctx, http.Header{
+		"x-request-id": {"req-1"},
+		"X-Tenant":     {"example"},
+		"Content-Type": {"text/plain"},
+	})
+	ctx = WithHTTPHeaders(ctx, http.Header{
+		"X-Request-Id":    {"req-2"},
+		"X-Forwarded-For": {"192.0.2.1, 198.51.100.1"},
+	})
+	if _, err = c.Logoff(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]string{
+		"X-Request-Id":    "req-2",
+		"X-Tenant":        "example",
+		"X-Forwarded-For": "192.0.2.1, 198.51.100.1",
+		"Content-Type":    "text/xml; charset=utf-8",
+	} {
+		if values := headers[key]; len(values) != 1 || values[0] != expected {
+			t.Errorf("expected %s %q, got %v", key, expected, values)
+		}
+	}
+
+	if _, err = c.Logoff(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if value := headers.Get("X-Tenant"); value != "" {
+		t.Errorf("expected no headers without context, got %q", value)
+	}
+}
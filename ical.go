@@ -0,0 +1,222 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	icalDateLayout      = "20060102"
+	icalLocalTimeLayout = "20060102T150405"
+	icalUTCTimeLayout   = "20060102T150405Z"
+)
+
+// ICalendar returns the iCalendar representation of the provided events with
+// the provided calendar name. Times are expressed in the provided location,
+// which is included as VTIMEZONE. A nil location or time.UTC uses UTC times
+// without VTIMEZONE. Recurrence patterns are not exported, recurring events
+// are represented by their first occurrence only.
+func ICalendar(name string, events []*Event, loc *time.Location) []byte {
+	if loc == time.UTC {
+		loc = nil
+	}
+
+	var b bytes.Buffer
+	writeContentLine(&b, "BEGIN", nil, "VCALENDAR")
+	writeContentLine(&b, "VERSION", nil, "2.0")
+	writeContentLine(&b, "PRODID", nil, "-//Kopano//kcc-go "+Version+"//EN")
+	writeContentLine(&b, "CALSCALE", nil, "GREGORIAN")
+	if name != "" {
+		writeContentLine(&b, "X-WR-CALNAME", nil, escapeContentText(name))
+	}
+
+	if loc != nil {
+		writeContentLine(&b, "X-WR-TIMEZONE", nil, loc.String())
+		from, to := time.Now(), time.Now()
+		for _, event := range events {
+			if event.Start.Before(from) {
+				from = event.Start
+			}
+			if event.End.After(to) {
+				to = event.End
+			}
+		}
+		writeVTimezone(&b, loc, from, to)
+	}
+
+	now := time.Now()
+	for _, event := range events {
+		writeVEvent(&b, event, loc, now)
+	}
+
+	writeContentLine(&b, "END", nil, "VCALENDAR")
+
+	return b.Bytes()
+}
+
+func writeVEvent(b *bytes.Buffer, event *Event, loc *time.Location, now time.Time) {
+	writeContentLine(b, "BEGIN", nil, "VEVENT")
+	writeContentLine(b, "UID", nil, escapeContentText(event.UID))
+
+	stamp := event.LastModified
+	if stamp.IsZero() {
+		stamp = now
+	}
+	writeContentLine(b, "DTSTAMP", nil, stamp.UTC().Format(icalUTCTimeLayout))
+	if !event.LastModified.IsZero() {
+		writeContentLine(b, "LAST-MODIFIED", nil, event.LastModified.UTC().Format(icalUTCTimeLayout))
+	}
+
+	for _, dt := range []struct {
+		name string
+		t    time.Time
+	}{
+		{"DTSTART", event.Start},
+		{"DTEND", event.End},
+	} {
+		switch {
+		case event.AllDay:
+			t := dt.t
+			if loc != nil {
+				t = t.In(loc)
+			}
+			writeContentLine(b, dt.name, []string{"VALUE=DATE"}, t.Format(icalDateLayout))
+		case loc != nil:
+			writeContentLine(b, dt.name, []string{"TZID=" + loc.String()}, dt.t.In(loc).Format(icalLocalTimeLayout))
+		default:
+			writeContentLine(b, dt.name, nil, dt.t.UTC().Format(icalUTCTimeLayout))
+		}
+	}
+
+	writeContentLine(b, "SUMMARY", nil, escapeContentText(event.Subject))
+	if event.Location != "" {
+		writeContentLine(b, "LOCATION", nil, escapeContentText(event.Location))
+	}
+	if event.Sequence > 0 {
+		writeContentLine(b, "SEQUENCE", nil, strconv.FormatUint(event.Sequence, 10))
+	}
+
+	transp := "OPAQUE"
+	if event.BusyStatus == BusyStatusFree {
+		transp = "TRANSPARENT"
+	}
+	writeContentLine(b, "TRANSP", nil, transp)
+	if event.BusyStatus == BusyStatusTentative {
+		writeContentLine(b, "STATUS", nil, "TENTATIVE")
+	}
+	writeContentLine(b, "X-MICROSOFT-CDO-BUSYSTATUS", nil, icalBusyStatus(event.BusyStatus))
+
+	writeContentLine(b, "END", nil, "VEVENT")
+}
+
+func icalBusyStatus(bs BusyStatus) string {
+	switch bs {
+	case BusyStatusFree:
+		return "FREE"
+	case BusyStatusTentative:
+		return "TENTATIVE"
+	case BusyStatusOutOfOffice:
+		return "OOF"
+	case BusyStatusWorkingElsewhere:
+		return "WORKINGELSEWHERE"
+	default:
+		return "BUSY"
+	}
+}
+
+// writeVTimezone writes a VTIMEZONE for the provided location which covers the
+// provided time range. Go does not expose the rules of a location, so each
+// offset transition in the range is written as its own observance.
+func writeVTimezone(b *bytes.Buffer, loc *time.Location, from, to time.Time) {
+	from = time.Date(from.In(loc).Year(), 1, 1, 0, 0, 0, 0, loc)
+
+	writeContentLine(b, "BEGIN", nil, "VTIMEZONE")
+	writeContentLine(b, "TZID", nil, loc.String())
+
+	name, offset := from.Zone()
+	writeObservance(b, from, name, offset, offset)
+
+	for t := from; t.Before(to); {
+		next := t.Add(24 * time.Hour)
+		if _, nextOffset := next.Zone(); nextOffset != offset {
+			transition := findZoneTransition(t, next)
+			name, nextOffset = transition.Zone()
+			writeObservance(b, transition, name, offset, nextOffset)
+			offset = nextOffset
+			t = transition
+			continue
+		}
+		t = next
+	}
+
+	writeContentLine(b, "END", nil, "VTIMEZONE")
+}
+
+// findZoneTransition returns the first second at or after from at which the
+// zone offset differs from the offset at from, which must happen before to.
+func findZoneTransition(from, to time.Time) time.Time {
+	_, offset := from.Zone()
+	lo, hi := from.Unix(), to.Unix()
+	for hi-lo > 1 {
+		mid := lo + (hi-lo)/2
+		if _, midOffset := time.Unix(mid, 0).In(from.Location()).Zone(); midOffset == offset {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return time.Unix(hi, 0).In(from.Location())
+}
+
+func writeObservance(b *bytes.Buffer, start time.Time, name string, offsetFrom, offsetTo int) {
+	// Observances with an offset larger than the smallest offset of the year
+	// are daylight saving time.
+	year := start.Year()
+	_, january := time.Date(year, 1, 1, 0, 0, 0, 0, start.Location()).Zone()
+	_, july := time.Date(year, 7, 1, 0, 0, 0, 0, start.Location()).Zone()
+	standard := january
+	if july < standard {
+		standard = july
+	}
+	kind := "STANDARD"
+	if offsetTo > standard {
+		kind = "DAYLIGHT"
+	}
+
+	writeContentLine(b, "BEGIN", nil, kind)
+	// The start is expressed as local time of the previous observance.
+	writeContentLine(b, "DTSTART", nil, start.UTC().Add(time.Duration(offsetFrom)*time.Second).Format(icalLocalTimeLayout))
+	writeContentLine(b, "TZOFFSETFROM", nil, icalOffset(offsetFrom))
+	writeContentLine(b, "TZOFFSETTO", nil, icalOffset(offsetTo))
+	writeContentLine(b, "TZNAME", nil, escapeContentText(name))
+	writeContentLine(b, "END", nil, kind)
+}
+
+func icalOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+
+	return fmt.Sprintf("%s%02d%02d", sign, offset/3600, (offset%3600)/60)
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestICalendar(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+
+	events := []*Event{
+		{
+			UID:        "040000008200E00074C5B7101A82E008",
+			Subject:    "Planning, Q3",
+			Location:   "Room 1",
+			Start:      time.Date(2019, 7, 1, 8, 0, 0, 0, time.UTC),
+			End:        time.Date(2019, 7, 1, 9, 0, 0, 0, time.UTC),
+			BusyStatus: BusyStatusBusy,
+		},
+		{
+			UID:        "allday",
+			Subject:    "Holiday",
+			Start:      time.Date(2019, 12, 24, 23, 0, 0, 0, time.UTC),
+			End:        time.Date(2019, 12, 25, 23, 0, 0, 0, time.UTC),
+			AllDay:     true,
+			BusyStatus: BusyStatusFree,
+		},
+	}
+
+	data := string(ICalendar("Calendar", events, loc))
+	for _, expected := range []string{
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin\r\n",
+		"BEGIN:DAYLIGHT\r\nDTSTART:20190331T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nTZNAME:CEST\r\n",
+		"BEGIN:STANDARD\r\nDTSTART:20191027T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\n",
+		"DTSTART;TZID=Europe/Berlin:20190701T100000\r\n",
+		"SUMMARY:Planning\\, Q3\r\n",
+		"DTSTART;VALUE=DATE:20191225\r\nDTEND;VALUE=DATE:20191226\r\n",
+		"TRANSP:TRANSPARENT\r\n",
+	} {
+		if !strings.Contains(data, expected) {
+			t.Errorf("missing %q in:\n%s", expected, data)
+		}
+	}
+}
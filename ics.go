@@ -0,0 +1,141 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SetSyncStatus registers the provided ICS sync status of the folder with the
+// provided source key using the provided session. A sync ID of 0 registers a
+// new sync, the resulting sync ID is returned with the response.
+func (c *KCC) SetSyncStatus(ctx context.Context, folderSourceKey string, syncID, changeID uint64, syncType KCFlag, flags KCFlag, sessionID KCSessionID) (*SetSyncStatusResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:setSyncStatus><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><sSourceKeyFolder>")
+	b.WriteString(xmlCharData(folderSourceKey).Escape())
+	b.WriteString("</sSourceKeyFolder><ulSyncId>")
+	b.WriteString(strconv.FormatUint(syncID, 10))
+	b.WriteString("</ulSyncId><ulChangeId>")
+	b.WriteString(strconv.FormatUint(changeID, 10))
+	b.WriteString("</ulChangeId><ulSyncType>")
+	b.WriteString(syncType.String())
+	b.WriteString("</ulSyncType><ulFlags>")
+	b.WriteString(flags.String())
+	b.WriteString("</ulFlags></ns:setSyncStatus>")
+	payload := b.String()
+
+	var setSyncStatusResponse SetSyncStatusResponse
+	err := c.Client.DoRequest(ctx, &payload, &setSyncStatusResponse)
+
+	return &setSyncStatusResponse, err
+}
+
+// GetChanges fetches the ICS changes of the folder with the provided source
+// key which happened after the provided change ID using the provided session.
+func (c *KCC) GetChanges(ctx context.Context, folderSourceKey string, syncID, changeID uint64, syncType KCFlag, flags KCFlag, sessionID KCSessionID) (*GetChangesResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:getChanges><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><sSourceKeyFolder>")
+	b.WriteString(xmlCharData(folderSourceKey).Escape())
+	b.WriteString("</sSourceKeyFolder><ulSyncId>")
+	b.WriteString(strconv.FormatUint(syncID, 10))
+	b.WriteString("</ulSyncId><ulChangeId>")
+	b.WriteString(strconv.FormatUint(changeID, 10))
+	b.WriteString("</ulChangeId><ulChangeType>")
+	b.WriteString(syncType.String())
+	b.WriteString("</ulChangeType><ulFlags>")
+	b.WriteString(flags.String())
+	b.WriteString("</ulFlags></ns:getChanges>")
+	payload := b.String()
+
+	var getChangesResponse GetChangesResponse
+	err := c.Client.DoRequest(ctx, &payload, &getChangesResponse)
+
+	return &getChangesResponse, err
+}
+
+// GetEntryIDFromSourceKey resolves the Entry ID of the object with the
+// provided source keys in the store with the provided store Entry ID using the
+// provided session. Leave the message source key empty to resolve a folder.
+func (c *KCC) GetEntryIDFromSourceKey(ctx context.Context, storeEntryID string, folderSourceKey string, messageSourceKey string, sessionID KCSessionID) (*GetEntryIDFromSourceKeyResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:getEntryIDFromSourceKey><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><sEntryId>")
+	b.WriteString(xmlCharData(storeEntryID).Escape())
+	b.WriteString("</sEntryId><folderSourceKey>")
+	b.WriteString(xmlCharData(folderSourceKey).Escape())
+	b.WriteString("</folderSourceKey><messageSourceKey>")
+	b.WriteString(xmlCharData(messageSourceKey).Escape())
+	b.WriteString("</messageSourceKey></ns:getEntryIDFromSourceKey>")
+	payload := b.String()
+
+	var getEntryIDFromSourceKeyResponse GetEntryIDFromSourceKeyResponse
+	err := c.Client.DoRequest(ctx, &payload, &getEntryIDFromSourceKeyResponse)
+
+	return &getEntryIDFromSourceKeyResponse, err
+}
+
+// An ICSState is the state of an incremental content synchronization of a
+// single folder.
+type ICSState struct {
+	SyncID   uint64 `json:"syncID"`
+	ChangeID uint64 `json:"changeID"`
+}
+
+// SyncContents fetches the content changes of the folder with the provided
+// source key since the provided state using the provided session. A zero state
+// returns all messages of the folder as new. The returned state must be used
+// for the next call. When state is nil, a new sync is registered.
+func (c *KCC) SyncContents(ctx context.Context, folderSourceKey string, state *ICSState, sessionID KCSessionID) ([]*ICSChange, *ICSState, error) {
+	if state == nil {
+		state = &ICSState{}
+	}
+
+	if state.SyncID == 0 {
+		registered, err := c.SetSyncStatus(ctx, folderSourceKey, 0, state.ChangeID, ICS_SYNC_CONTENTS, 0, sessionID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("sync contents setSyncStatus failed: %v", err)
+		}
+		if registered.Er != KCSuccess {
+			return nil, nil, registered.Er
+		}
+		state = &ICSState{
+			SyncID:   registered.SyncID,
+			ChangeID: state.ChangeID,
+		}
+	}
+
+	changes, err := c.GetChanges(ctx, folderSourceKey, state.SyncID, state.ChangeID, ICS_SYNC_CONTENTS, 0, sessionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("sync contents getChanges failed: %v", err)
+	}
+	if changes.Er != KCSuccess {
+		return nil, nil, changes.Er
+	}
+
+	return changes.Changes, &ICSState{
+		SyncID:   state.SyncID,
+		ChangeID: changes.MaxChangeID,
+	}, nil
+}
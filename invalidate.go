@@ -0,0 +1,105 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"sync"
+)
+
+// An Invalidation identifies cached data which is no longer valid. An empty
+// ServerGUID matches all servers, an empty EntryID matches all objects of the
+// matched servers.
+type Invalidation struct {
+	ServerGUID string
+	EntryID    string
+}
+
+// Matches returns true if the accociated Invalidation covers the object with
+// the provided server GUID and Entry ID.
+func (inv *Invalidation) Matches(serverGUID, entryID string) bool {
+	if inv.ServerGUID != "" && inv.ServerGUID != serverGUID {
+		return false
+	}
+	return inv.EntryID == "" || inv.EntryID == entryID
+}
+
+// An InvalidationBus distributes invalidations to all cache layers which
+// subscribed to it. Invalidations are published by the KCC for objects it
+// changes and can be published by anything else which learns about changes,
+// for example when receiving server notifications.
+type InvalidationBus struct {
+	mutex       sync.RWMutex
+	subscribers map[uint64]func(*Invalidation)
+	next        uint64
+}
+
+// DefaultInvalidationBus is the InvalidationBus used by KCC instances unless
+// set otherwise.
+var DefaultInvalidationBus = NewInvalidationBus()
+
+// NewInvalidationBus creates a new InvalidationBus without subscribers.
+func NewInvalidationBus() *InvalidationBus {
+	return &InvalidationBus{
+		subscribers: make(map[uint64]func(*Invalidation)),
+	}
+}
+
+// Subscribe registers the provided function to be called for every
+// invalidation published on the accociated bus. The returned function removes
+// the subscription again.
+func (bus *InvalidationBus) Subscribe(f func(*Invalidation)) func() {
+	bus.mutex.Lock()
+	id := bus.next
+	bus.next++
+	bus.subscribers[id] = f
+	bus.mutex.Unlock()
+
+	return func() {
+		bus.mutex.Lock()
+		delete(bus.subscribers, id)
+		bus.mutex.Unlock()
+	}
+}
+
+// Publish calls all subscribers of the accociated bus with the provided
+// invalidation and returns once all of them have returned. Subscribers must
+// not publish themselves. Panics of subscribers are reported with ReportPanic
+// and do not keep other subscribers from being called.
+func (bus *InvalidationBus) Publish(inv *Invalidation) {
+	bus.mutex.RLock()
+	defer bus.mutex.RUnlock()
+
+	for _, f := range bus.subscribers {
+		f := f
+		runSafely(func() {
+			f(inv)
+		})
+	}
+}
+
+// invalidate publishes an invalidation of the provided Entry ID on the
+// accociated KCC's bus. The KCC does not know the GUID of the server it is
+// connected to, so the invalidation matches all servers. Entry IDs contain
+// the store GUID, so this only drops more than needed in theory.
+func (c *KCC) invalidate(entryID string) {
+	if c.invalidations == nil {
+		return
+	}
+	c.invalidations.Publish(&Invalidation{
+		EntryID: entryID,
+	})
+}
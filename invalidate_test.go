@@ -0,0 +1,66 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInvalidationMatches(t *testing.T) {
+	for _, tc := range []struct {
+		inv      Invalidation
+		expected bool
+	}{
+		{Invalidation{}, true},
+		{Invalidation{ServerGUID: "guid1"}, true},
+		{Invalidation{ServerGUID: "guid2"}, false},
+		{Invalidation{ServerGUID: "guid1", EntryID: "eid1"}, true},
+		{Invalidation{ServerGUID: "guid1", EntryID: "eid2"}, false},
+		{Invalidation{EntryID: "eid1"}, true},
+	} {
+		if matches := tc.inv.Matches("guid1", "eid1"); matches != tc.expected {
+			t.Errorf("unexpected match result for %+v: %v", tc.inv, matches)
+		}
+	}
+}
+
+func TestInvalidationBus(t *testing.T) {
+	bus := NewInvalidationBus()
+
+	var received []*Invalidation
+	unsubscribe := bus.Subscribe(func(inv *Invalidation) {
+		received = append(received, inv)
+	})
+
+	c := NewKCCWithClient(&cannedSOAPClient{
+		response: "<ns:deleteObjectsResponse><er>0</er></ns:deleteObjectsResponse>",
+	})
+	c.SetInvalidationBus(bus)
+	if _, err := c.DeleteObjects(context.Background(), []string{"eid1", "eid2"}, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[0].EntryID != "eid1" || received[1].EntryID != "eid2" {
+		t.Errorf("unexpected invalidations: %v", received)
+	}
+
+	unsubscribe()
+	bus.Publish(&Invalidation{})
+	if len(received) != 2 {
+		t.Errorf("unexpected invalidation after unsubscribe")
+	}
+}
@@ -0,0 +1,208 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// ItemType is the type representing the kind of a listed item as derived from
+// its message class.
+type ItemType string
+
+// Known item types.
+const (
+	ItemTypeMessage             ItemType = "message"
+	ItemTypeMeetingRequest      ItemType = "meetingrequest"
+	ItemTypeMeetingResponse     ItemType = "meetingresponse"
+	ItemTypeMeetingCancellation ItemType = "meetingcancellation"
+	ItemTypeTask                ItemType = "task"
+	ItemTypeNote                ItemType = "note"
+	ItemTypeContact             ItemType = "contact"
+	ItemTypeAppointment         ItemType = "appointment"
+)
+
+// itemTypeMessageClassPrefixes maps message class prefixes to item types. More
+// specific prefixes must come first.
+var itemTypeMessageClassPrefixes = []struct {
+	prefix   string
+	itemType ItemType
+}{
+	{"IPM.Schedule.Meeting.Request", ItemTypeMeetingRequest},
+	{"IPM.Schedule.Meeting.Resp.", ItemTypeMeetingResponse},
+	{"IPM.Schedule.Meeting.Canceled", ItemTypeMeetingCancellation},
+	{"IPM.Task", ItemTypeTask},
+	{"IPM.StickyNote", ItemTypeNote},
+	{"IPM.Contact", ItemTypeContact},
+	{"IPM.Appointment", ItemTypeAppointment},
+}
+
+// ItemTypeFromMessageClass returns the ItemType for the provided message class.
+// Unknown message classes are mapped to ItemTypeMessage.
+func ItemTypeFromMessageClass(messageClass string) ItemType {
+	for _, entry := range itemTypeMessageClassPrefixes {
+		if strings.HasPrefix(messageClass, entry.prefix) {
+			return entry.itemType
+		}
+	}
+
+	return ItemTypeMessage
+}
+
+// TaskStatus is the type representing the status of a task.
+type TaskStatus uint64
+
+// Task status values as defined in [MS-OXOTASK].
+const (
+	TaskStatusNotStarted TaskStatus = 0
+	TaskStatusInProgress TaskStatus = 1
+	TaskStatusComplete   TaskStatus = 2
+	TaskStatusWaiting    TaskStatus = 3
+	TaskStatusDeferred   TaskStatus = 4
+)
+
+// An Item represents the common data of an entry as listed from a folder
+// contents table. Type specific data is available in the accociated type
+// field.
+type Item struct {
+	Type         ItemType  `json:"type"`
+	EntryID      string    `json:"entryID"`
+	MessageClass string    `json:"messageClass"`
+	Subject      string    `json:"subject"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+	Size         uint64    `json:"size"`
+	Flags        KCFlag    `json:"flags"`
+
+	Task *Task `json:"task,omitempty"`
+	Note *Note `json:"note,omitempty"`
+}
+
+// A Task holds the task specific data of an Item.
+type Task struct {
+	Status          TaskStatus `json:"status"`
+	StartDate       time.Time  `json:"startDate"`
+	DueDate         time.Time  `json:"dueDate"`
+	DateCompleted   time.Time  `json:"dateCompleted"`
+	PercentComplete float64    `json:"percentComplete"`
+	Complete        bool       `json:"complete"`
+}
+
+// A Note holds the note specific data of an Item.
+type Note struct {
+	Color  uint64 `json:"color"`
+	Width  uint64 `json:"width"`
+	Height uint64 `json:"height"`
+}
+
+var itemProps = []PT{
+	PR_ENTRYID,
+	PR_MESSAGE_CLASS,
+	PR_SUBJECT,
+	PR_CREATION_TIME,
+	PR_LAST_MODIFICATION_TIME,
+	PR_MESSAGE_SIZE,
+	PR_MESSAGE_FLAGS,
+}
+
+var itemNamedProps = []*NamedProp{
+	PidLidTaskStatus,
+	PidLidPercentComplete,
+	PidLidTaskStartDate,
+	PidLidTaskDueDate,
+	PidLidTaskDateCompleted,
+	PidLidTaskComplete,
+	PidLidNoteColor,
+	PidLidNoteWidth,
+	PidLidNoteHeight,
+}
+
+// ListItems lists the contents of the folder with the provided Entry ID using
+// the provided session, mapping each row to a typed Item.
+func (c *KCC) ListItems(ctx context.Context, folderEntryID string, sessionID KCSessionID) ([]*Item, error) {
+	tags, err := c.NamedPropTags(ctx, sessionID, itemNamedProps...)
+	if err != nil {
+		return nil, err
+	}
+
+	props := append(append([]PT{}, itemProps...), tags...)
+
+	var items []*Item
+	err = c.QueryTableRows(ctx, folderEntryID, TABLETYPE_MS, MAPI_MESSAGE, 0, props, sessionID, func(rows []*PropTagRowSet) error {
+		for _, row := range rows {
+			items = append(items, newItemFromRow(row, tags))
+		}
+		return nil
+	})
+
+	return items, err
+}
+
+// newItemFromRow maps the provided table row to an Item. The tags must be the
+// resolved itemNamedProps.
+func newItemFromRow(row *PropTagRowSet, tags []PT) *Item {
+	item := &Item{
+		MessageClass: row.GetString(PR_MESSAGE_CLASS),
+		Subject:      row.GetString(PR_SUBJECT),
+		Created:      row.GetTime(PR_CREATION_TIME),
+		LastModified: row.GetTime(PR_LAST_MODIFICATION_TIME),
+	}
+	item.Type = ItemTypeFromMessageClass(item.MessageClass)
+	if value, ok := row.Get(PR_ENTRYID); ok {
+		item.EntryID = string(value.BinValue)
+	}
+	if value, ok := row.Get(PR_MESSAGE_SIZE); ok {
+		item.Size = value.ULValue
+	}
+	if value, ok := row.Get(PR_MESSAGE_FLAGS); ok {
+		item.Flags = KCFlag(value.ULValue)
+	}
+
+	switch item.Type {
+	case ItemTypeTask:
+		item.Task = &Task{
+			StartDate:     row.GetTime(tags[2]),
+			DueDate:       row.GetTime(tags[3]),
+			DateCompleted: row.GetTime(tags[4]),
+		}
+		if value, ok := row.Get(tags[0]); ok {
+			item.Task.Status = TaskStatus(value.ULValue)
+		}
+		if value, ok := row.Get(tags[1]); ok {
+			item.Task.PercentComplete = value.DblValue
+		}
+		if value, ok := row.Get(tags[5]); ok {
+			item.Task.Complete = value.BoolValue
+		}
+
+	case ItemTypeNote:
+		item.Note = &Note{}
+		if value, ok := row.Get(tags[6]); ok {
+			item.Note.Color = value.ULValue
+		}
+		if value, ok := row.Get(tags[7]); ok {
+			item.Note.Width = value.ULValue
+		}
+		if value, ok := row.Get(tags[8]); ok {
+			item.Note.Height = value.ULValue
+		}
+	}
+
+	return item
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestItemTypeFromMessageClass(t *testing.T) {
+	values := map[string]ItemType{
+		"IPM.Note":                       ItemTypeMessage,
+		"IPM.Note.SMIME":                 ItemTypeMessage,
+		"IPM.Schedule.Meeting.Request":   ItemTypeMeetingRequest,
+		"IPM.Schedule.Meeting.Resp.Pos":  ItemTypeMeetingResponse,
+		"IPM.Schedule.Meeting.Resp.Tent": ItemTypeMeetingResponse,
+		"IPM.Schedule.Meeting.Resp.Neg":  ItemTypeMeetingResponse,
+		"IPM.Schedule.Meeting.Canceled":  ItemTypeMeetingCancellation,
+		"IPM.Schedule.Meeting.Unknown":   ItemTypeMessage,
+		"IPM.Task":                       ItemTypeTask,
+		"IPM.StickyNote":                 ItemTypeNote,
+		"":                               ItemTypeMessage,
+	}
+
+	for messageClass, expected := range values {
+		if got := ItemTypeFromMessageClass(messageClass); got != expected {
+			t.Errorf("ItemTypeFromMessageClass(%s) mismatch: got %v want %v", messageClass, got, expected)
+		}
+	}
+}
+
+func TestNewItemFromRow(t *testing.T) {
+	tags := make([]PT, len(itemNamedProps))
+	for idx, name := range itemNamedProps {
+		tags[idx] = propTag(name.Type, uint64(0x8500+idx))
+	}
+	due := time.Date(2019, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	task := newItemFromRow(&PropTagRowSet{PropTagValues: []*PropTagRowSetValue{
+		StringPropValue(PR_MESSAGE_CLASS, "IPM.Task"),
+		StringPropValue(PR_SUBJECT, "Do it"),
+		ULPropValue(tags[0], uint64(TaskStatusInProgress)),
+		{PropTag: tags[1], DblValue: 0.5},
+		TimePropValue(tags[3], due),
+	}}, tags)
+	if task.Type != ItemTypeTask || task.Task == nil || task.Note != nil {
+		t.Fatalf("task item has unexpected type data: %+v", task)
+	}
+	if task.Task.Status != TaskStatusInProgress || task.Task.PercentComplete != 0.5 || !task.Task.DueDate.Equal(due) {
+		t.Errorf("task item has unexpected task data: %+v", task.Task)
+	}
+
+	note := newItemFromRow(&PropTagRowSet{PropTagValues: []*PropTagRowSetValue{
+		StringPropValue(PR_MESSAGE_CLASS, "IPM.StickyNote"),
+		ULPropValue(tags[6], 3),
+	}}, tags)
+	if note.Type != ItemTypeNote || note.Note == nil || note.Note.Color != 3 {
+		t.Errorf("note item has unexpected note data: %+v", note)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -54,7 +55,19 @@ type KCC struct {
 	Client       SOAPClient
 	Capabilities KCFlag
 
-	app [2]string
+	app        [2]string
+	namedProps namedPropCache
+	limiter    *RateLimiter
+	adaptive   *AdaptiveLimiter
+	breaker    *CircuitBreaker
+	slowCalls  *SlowCallSOAPClient
+	retries    *retryPolicySOAPClient
+	http       *SOAPHTTPClient
+
+	sessionEvents func(*SessionEvent)
+
+	decodeWorkers int
+	invalidations *InvalidationBus
 }
 
 // NewKCC constructs a KCC instance with the provided URI. If no URI is passed,
@@ -70,6 +83,19 @@ func NewKCC(uri *url.URL) *KCC {
 
 		Client:       soap,
 		Capabilities: DefaultClientCapabilities,
+
+		decodeWorkers: DefaultDecodeWorkers,
+		invalidations: DefaultInvalidationBus,
+	}
+	c.http, _ = c.Client.(*SOAPHTTPClient)
+	if DefaultRateLimit > 0 {
+		c.SetRateLimit(DefaultRateLimit, DefaultRateBurst)
+	}
+	if FeatureAdaptiveLimiter.Enabled() {
+		c.SetAdaptiveConcurrency(DefaultAdaptiveMaxLimit, DefaultAdaptiveLatencyTarget)
+	}
+	if DefaultSlowCallThreshold > 0 {
+		c.SetSlowCallLog(DefaultSlowCallThreshold, nil)
 	}
 
 	return c
@@ -83,6 +109,19 @@ func NewKCCWithClient(client SOAPClient) *KCC {
 
 		Client:       client,
 		Capabilities: DefaultClientCapabilities,
+
+		decodeWorkers: DefaultDecodeWorkers,
+		invalidations: DefaultInvalidationBus,
+	}
+	c.http, _ = c.Client.(*SOAPHTTPClient)
+	if DefaultRateLimit > 0 {
+		c.SetRateLimit(DefaultRateLimit, DefaultRateBurst)
+	}
+	if FeatureAdaptiveLimiter.Enabled() {
+		c.SetAdaptiveConcurrency(DefaultAdaptiveMaxLimit, DefaultAdaptiveLatencyTarget)
+	}
+	if DefaultSlowCallThreshold > 0 {
+		c.SetSlowCallLog(DefaultSlowCallThreshold, nil)
 	}
 
 	return c
@@ -99,7 +138,104 @@ func (c *KCC) SetClientApp(name, version string) error {
 	return nil
 }
 
+// SetRateLimit limits the requests of the accociated KCC to limit requests per
+// second with bursts of up to burst requests. The limit applies to all requests
+// of the accociated KCC, regardless of the session. A limit of 0 removes the
+// limit. The RateLimiter in use is returned.
+func (c *KCC) SetRateLimit(limit float64, burst int) *RateLimiter {
+	if c.limiter == nil {
+		c.limiter = NewRateLimiter(limit, burst)
+		c.Client = NewRateLimitedSOAPClient(c.Client, c.limiter)
+	} else {
+		c.limiter.SetLimit(limit, burst)
+	}
+
+	return c.limiter
+}
+
+// SetAdaptiveConcurrency limits the concurrent requests of the accociated KCC
+// with an AdaptiveLimiter allowing up to maxLimit requests, which are expected
+// to complete within latencyTarget. The AdaptiveLimiter in use is returned.
+func (c *KCC) SetAdaptiveConcurrency(maxLimit int, latencyTarget time.Duration) *AdaptiveLimiter {
+	if c.adaptive == nil {
+		c.adaptive = NewAdaptiveLimiter(maxLimit, latencyTarget)
+		c.Client = NewAdaptiveSOAPClient(c.Client, c.adaptive)
+	} else {
+		c.adaptive.SetLimit(maxLimit, latencyTarget)
+	}
+
+	return c.adaptive
+}
+
+// SetCircuitBreaker fails requests of the accociated KCC fast with
+// CircuitOpenError for cooldown after threshold consecutive transport failures,
+// using a CircuitBreaker. Values of 0 select the defaults. The CircuitBreaker in
+// use is returned.
+func (c *KCC) SetCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if c.breaker == nil {
+		c.breaker = NewCircuitBreaker(threshold, cooldown)
+		c.Client = NewCircuitBreakerSOAPClient(c.Client, c.breaker)
+	} else {
+		c.breaker.SetLimit(threshold, cooldown)
+	}
+
+	return c.breaker
+}
+
+// CircuitBreaker returns the CircuitBreaker of the accociated KCC set with
+// SetCircuitBreaker, or nil if there is none.
+func (c *KCC) CircuitBreaker() *CircuitBreaker {
+	return c.breaker
+}
+
+// SetSlowCallLog reports SOAP calls of the accociated KCC which take longer
+// than threshold to the provided handler. If handler is nil, calls are logged
+// with DefaultSlowCallHandler. A threshold of 0 disables the report.
+func (c *KCC) SetSlowCallLog(threshold time.Duration, handler func(*SlowCall)) {
+	if c.slowCalls == nil {
+		c.slowCalls = NewSlowCallSOAPClient(c.Client, threshold, handler)
+		c.Client = c.slowCalls
+		return
+	}
+	if handler == nil {
+		handler = DefaultSlowCallHandler
+	}
+	c.slowCalls.Threshold = threshold
+	c.slowCalls.Handler = handler
+}
+
+// SetRetryPolicy sets the RetryPolicy of the requests of the accociated KCC,
+// overriding the RetryPolicy of its SOAP client. Requests with a RetryPolicy
+// set with WithRetryPolicy keep theirs. A nil policy restores the RetryPolicy
+// of the SOAP client.
+func (c *KCC) SetRetryPolicy(policy *RetryPolicy) {
+	if c.retries == nil {
+		if policy == nil {
+			return
+		}
+		c.retries = &retryPolicySOAPClient{
+			client: c.Client,
+		}
+		c.Client = c.retries
+	}
+	c.retries.policy = policy
+}
+
+// SetDecodeWorkers sets the number of workers used by the accociated KCC to
+// decode items of streamed list responses in parallel. With 1 or less, items
+// are decoded sequentially.
+func (c *KCC) SetDecodeWorkers(workers int) {
+	c.decodeWorkers = workers
+}
+
+// SetInvalidationBus sets the InvalidationBus on which the accociated KCC
+// publishes invalidations for the objects it changes or deletes.
+func (c *KCC) SetInvalidationBus(bus *InvalidationBus) {
+	c.invalidations = bus
+}
+
 // Logon creates a session with the Kopano server using the provided credentials.
+// The ClientInfo of the provided context, if any, is forwarded to the server.
 func (c *KCC) Logon(ctx context.Context, username, password string, logonFlags KCFlag) (*LogonResponse, error) {
 	var b strings.Builder
 	b.WriteString("<ns:logon><szUsername>")
@@ -114,7 +250,9 @@ func (c *KCC) Logon(ctx context.Context, username, password string, logonFlags K
 	b.WriteString(xmlCharData(c.app[0]).Escape())
 	b.WriteString("</szClientApp><szClientAppVersion>")
 	b.WriteString(xmlCharData(c.app[1]).Escape())
-	b.WriteString("</szClientAppVersion><clientVersion>")
+	b.WriteString("</szClientAppVersion>")
+	writeClientAppMisc(ctx, &b)
+	b.WriteString("<clientVersion>")
 	b.WriteString(strconv.FormatInt(int64(ClientVersion), 10))
 	b.WriteString("</clientVersion></ns:logon>")
 	payload := b.String()
@@ -126,6 +264,7 @@ func (c *KCC) Logon(ctx context.Context, username, password string, logonFlags K
 }
 
 // SSOLogon creates a session with the Kopano server using the provided credentials.
+// The ClientInfo of the provided context, if any, is forwarded to the server.
 func (c *KCC) SSOLogon(ctx context.Context, prefix SSOType, username string, input []byte, sessionID KCSessionID, logonFlags KCFlag) (*LogonResponse, error) {
 	if logonFlags != 0 {
 		return nil, fmt.Errorf("logon flags are not support by sso logon")
@@ -150,7 +289,9 @@ func (c *KCC) SSOLogon(ctx context.Context, prefix SSOType, username string, inp
 	b.WriteString(xmlCharData(c.app[0]).Escape())
 	b.WriteString("</szClientApp><szClientAppVersion>")
 	b.WriteString(xmlCharData(c.app[1]).Escape())
-	b.WriteString("</szClientAppVersion><clientVersion>")
+	b.WriteString("</szClientAppVersion>")
+	writeClientAppMisc(ctx, &b)
+	b.WriteString("<clientVersion>")
 	b.WriteString(strconv.FormatInt(int64(ClientVersion), 10))
 	b.WriteString("</clientVersion><ulSessionId>")
 	b.WriteString(sessionID.String())
@@ -197,7 +338,7 @@ func (c *KCC) ResolveUsername(ctx context.Context, username string, sessionID KC
 func (c *KCC) GetUser(ctx context.Context, userEntryID string, sessionID KCSessionID) (*GetUserResponse, error) {
 	var b strings.Builder
 	b.WriteString("<ns:getUser><sUserId>")
-	b.WriteString(userEntryID)
+	b.WriteString(xmlCharData(userEntryID).Escape())
 	b.WriteString("</sUserId><ulSessionId>")
 	b.WriteString(sessionID.String())
 	b.WriteString("</ulSessionId></ns:getUser>")
@@ -212,13 +353,25 @@ func (c *KCC) GetUser(ctx context.Context, userEntryID string, sessionID KCSessi
 // ABResolveNames searches the AB for the provided props using the provided
 // request data and flags.
 func (c *KCC) ABResolveNames(ctx context.Context, props []PT, request map[PT]interface{}, requestFlags ABFlag, sessionID KCSessionID, resolveNamesFlags KCFlag) (*ABResolveNamesResponse, error) {
+	return c.ABResolveNamesRows(ctx, props, []map[PT]interface{}{request}, []ABFlag{requestFlags}, sessionID, resolveNamesFlags)
+}
+
+// ABResolveNamesRows searches the AB for the provided props using the provided
+// request rows and flags, resolving all rows with a single request. The
+// response holds a row and a flag for each of the request rows in the same
+// order.
+func (c *KCC) ABResolveNamesRows(ctx context.Context, props []PT, rows []map[PT]interface{}, requestFlags []ABFlag, sessionID KCSessionID, resolveNamesFlags KCFlag) (*ABResolveNamesResponse, error) {
+	if len(rows) != len(requestFlags) {
+		return nil, fmt.Errorf("number of request rows and flags do not match")
+	}
+
 	var b strings.Builder
 	b.WriteString("<ns:abResolveNames>")
 	b.WriteString("<ulSessionId>")
 	b.WriteString(sessionID.String())
 	b.WriteString("</ulSessionId>")
 	b.WriteString("<lpaPropTag SOAP-ENC:arrayType=\"xsd:unsignedInt[")
-	b.WriteString(strconv.FormatUint(uint64(len(props)), 64))
+	b.WriteString(strconv.FormatUint(uint64(len(props)), 10))
 	b.WriteString("]\">")
 	for _, prop := range props {
 		b.WriteString("<item>")
@@ -227,30 +380,36 @@ func (c *KCC) ABResolveNames(ctx context.Context, props []PT, request map[PT]int
 	}
 	b.WriteString("</lpaPropTag>")
 	b.WriteString("<lpsRowSet SOAP-ENC:arrayType=\"propVal[][")
-	b.WriteString(strconv.FormatUint(uint64(len(request)), 64))
+	b.WriteString(strconv.FormatUint(uint64(len(rows)), 10))
 	b.WriteString("]\">")
-	for prop, value := range request {
-		b.WriteString("<item SOAP-ENC:arrayType=\"propVal[1]\">")
-		b.WriteString("<item>")
-		b.WriteString("<ulPropTag>")
-		b.WriteString(prop.String())
-		b.WriteString("</ulPropTag>")
-		switch tv := value.(type) {
-		case string:
-			b.WriteString("<lpszA>")
-			b.WriteString(xmlCharData(tv).Escape())
-			b.WriteString("</lpszA>")
-		default:
-			return nil, fmt.Errorf("unsupported type in request map value: %v", value)
+	for _, request := range rows {
+		b.WriteString("<item SOAP-ENC:arrayType=\"propVal[")
+		b.WriteString(strconv.FormatUint(uint64(len(request)), 10))
+		b.WriteString("]\">")
+		for prop, value := range request {
+			b.WriteString("<item>")
+			b.WriteString("<ulPropTag>")
+			b.WriteString(prop.String())
+			b.WriteString("</ulPropTag>")
+			switch tv := value.(type) {
+			case string:
+				b.WriteString("<lpszA>")
+				b.WriteString(xmlCharData(tv).Escape())
+				b.WriteString("</lpszA>")
+			default:
+				return nil, fmt.Errorf("unsupported type in request map value: %v", value)
+			}
+			b.WriteString("</item>")
 		}
 		b.WriteString("</item>")
-		b.WriteString("</item>")
 	}
 	b.WriteString("</lpsRowSet>")
 	b.WriteString("<lpaFlags>")
-	b.WriteString("<item>")
-	b.WriteString(requestFlags.String())
-	b.WriteString("</item>")
+	for _, flag := range requestFlags {
+		b.WriteString("<item>")
+		b.WriteString(flag.String())
+		b.WriteString("</item>")
+	}
 	b.WriteString("</lpaFlags>")
 	b.WriteString("<ulFlags>")
 	b.WriteString(resolveNamesFlags.String())
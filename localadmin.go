@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+)
+
+// LocalAdminUsername is the username of the local admin logon. The Kopano
+// server logs on processes connecting to its unix socket as this user without
+// password, if their peer credentials are trusted by its local_admin_users
+// setting.
+const LocalAdminUsername = "SYSTEM"
+
+// ErrLocalAdminLogonNotAllowed is returned for local admin logon requests
+// sent with a SOAP client which does not allow them.
+var ErrLocalAdminLogonNotAllowed = errors.New("local admin logon is not allowed by the SOAP client")
+
+type localAdminLogonKey struct{}
+
+// isLocalAdminLogon returns true if the provided context is of a local admin
+// logon request.
+func isLocalAdminLogon(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	ok, _ := ctx.Value(localAdminLogonKey{}).(bool)
+	return ok
+}
+
+// checkLocalAdminLogon returns ErrLocalAdminLogonNotAllowed if the provided
+// context is of a local admin logon request and the provided allow value is
+// false.
+func checkLocalAdminLogon(ctx context.Context, allow bool) error {
+	if !allow && isLocalAdminLogon(ctx) {
+		return ErrLocalAdminLogonNotAllowed
+	}
+	return nil
+}
+
+// LocalAdminLogon creates a session with the Kopano server as
+// LocalAdminUsername without password, trusting the peer credentials of the
+// calling process. The request is only sent by a SOAPSocketClient connecting
+// to a unix socket with AllowLocalAdminLogon set, other SOAPSocketClients and
+// SOAPHTTPClients fail it with ErrLocalAdminLogonNotAllowed, so a password
+// less logon is never attempted by accident.
+func (c *KCC) LocalAdminLogon(ctx context.Context, logonFlags KCFlag) (*LogonResponse, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return c.Logon(context.WithValue(ctx, localAdminLogonKey{}, true), LocalAdminUsername, "", logonFlags)
+}
+
+// NewLocalAdminSession connects to the provided server with a local admin
+// logon, creates a new Session which will be automatically refreshed until
+// detroyed. See KCC.LocalAdminLogon.
+func NewLocalAdminSession(ctx context.Context, c *KCC) (*Session, error) {
+	return newSession(ctx, c, "local admin logon", func(ctx context.Context, c *KCC) (*LogonResponse, error) {
+		return c.LocalAdminLogon(ctx, 0)
+	})
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// localAdminServer serves logon requests on the provided listener and
+// returns a function returning the received requests.
+func localAdminServer(listener net.Listener) func() []string {
+	var mutex sync.Mutex
+	var requests []string
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					request, err := r.ReadString('>')
+					for err == nil && !strings.HasSuffix(request, soapFooter) {
+						var more string
+						more, err = r.ReadString('>')
+						request += more
+					}
+					if err != nil {
+						return
+					}
+					mutex.Lock()
+					requests = append(requests, request)
+					mutex.Unlock()
+					body := soapHeader + "<ns:logonResponse><er>0</er><ulSessionId>4711</ulSessionId><sServerGuid>guid</sServerGuid></ns:logonResponse>" + soapFooter
+					fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nConnection: keep-alive\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+				}
+			}()
+		}
+	}()
+
+	return func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), requests...)
+	}
+}
+
+func TestLocalAdminLogon(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kcc-go-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "server.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	requests := localAdminServer(listener)
+	uri := &url.URL{Scheme: "file", Path: path}
+
+	// Not allowed by default.
+	client, err := NewSOAPClientWithConfig(uri, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewKCCWithClient(client).LocalAdminLogon(context.Background(), 0); err != ErrLocalAdminLogonNotAllowed {
+		t.Errorf("expected local admin logon not to be allowed, got %v", err)
+	}
+	if n := len(requests()); n != 0 {
+		t.Errorf("expected no request to be sent, got %d", n)
+	}
+
+	client, err = NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		AllowLocalAdminLogon: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := NewLocalAdminSession(context.Background(), NewKCCWithClient(client))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Destroy(context.Background(), false)
+	if session.ID() != 4711 {
+		t.Errorf("unexpected session ID: %v", session.ID())
+	}
+	received := requests()
+	if len(received) != 1 || !strings.Contains(received[0], "<szUsername>SYSTEM</szUsername><szPassword></szPassword>") {
+		t.Errorf("unexpected logon requests: %v", received)
+	}
+}
+
+func TestLocalAdminLogonNotUnix(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	requests := localAdminServer(listener)
+
+	// Only allowed on unix sockets.
+	uri, _ := url.Parse("tcp://" + listener.Addr().String())
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		AllowLocalAdminLogon: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewLocalAdminSession(context.Background(), NewKCCWithClient(client)); err == nil || !strings.Contains(err.Error(), ErrLocalAdminLogonNotAllowed.Error()) {
+		t.Errorf("expected local admin logon not to be allowed over tcp, got %v", err)
+	}
+	if n := len(requests()); n != 0 {
+		t.Errorf("expected no request to be sent, got %d", n)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		t.Error("unexpected request")
+	}))
+	defer srv.Close()
+	uri, _ = url.Parse(srv.URL)
+	client, err = NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		AllowLocalAdminLogon: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewKCCWithClient(client).LocalAdminLogon(context.Background(), 0); err != ErrLocalAdminLogonNotAllowed {
+		t.Errorf("expected local admin logon not to be allowed over http, got %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message class of meeting requests and the prefix of meeting responses.
+const (
+	MeetingRequestMessageClass        = "IPM.Schedule.Meeting.Request"
+	meetingResponseMessageClassPrefix = "IPM.Schedule.Meeting.Resp."
+)
+
+// MeetingResponse is the type representing responses to meeting requests. The
+// values match the MAPI response status values.
+type MeetingResponse uint64
+
+// Supported meeting responses.
+const (
+	MeetingResponseTentative MeetingResponse = 2
+	MeetingResponseAccepted  MeetingResponse = 3
+	MeetingResponseDeclined  MeetingResponse = 4
+)
+
+func (mr MeetingResponse) String() string {
+	switch mr {
+	case MeetingResponseTentative:
+		return "Tentative"
+	case MeetingResponseAccepted:
+		return "Accepted"
+	case MeetingResponseDeclined:
+		return "Declined"
+	default:
+		return fmt.Sprintf("MeetingResponse(%d)", uint64(mr))
+	}
+}
+
+func (mr MeetingResponse) messageClass() (string, error) {
+	switch mr {
+	case MeetingResponseTentative:
+		return meetingResponseMessageClassPrefix + "Tent", nil
+	case MeetingResponseAccepted:
+		return meetingResponseMessageClassPrefix + "Pos", nil
+	case MeetingResponseDeclined:
+		return meetingResponseMessageClassPrefix + "Neg", nil
+	default:
+		return "", fmt.Errorf("unsupported meeting response: %v", mr)
+	}
+}
+
+// A MeetingRequest holds the data of a meeting request message which is
+// needed to respond to it.
+type MeetingRequest struct {
+	EntryID             string     `json:"entryID"`
+	Subject             string     `json:"subject"`
+	Location            string     `json:"location"`
+	Start               time.Time  `json:"start"`
+	End                 time.Time  `json:"end"`
+	Sequence            uint64     `json:"sequence"`
+	OwnerCriticalChange time.Time  `json:"ownerCriticalChange"`
+	Organizer           *Recipient `json:"organizer"`
+
+	globalObjectID      []byte
+	cleanGlobalObjectID []byte
+}
+
+var meetingRequestNamedProps = []*NamedProp{
+	PidLidGlobalObjectID,
+	PidLidCleanGlobalObjectID,
+	PidLidAppointmentStartWhole,
+	PidLidAppointmentEndWhole,
+	PidLidLocation,
+	PidLidAppointmentSequence,
+	PidLidOwnerCriticalChange,
+	PidLidResponseStatus,
+}
+
+// GetMeetingRequest loads the meeting request message with the provided Entry
+// ID using the provided session. An error is returned if the message is not a
+// meeting request.
+func (c *KCC) GetMeetingRequest(ctx context.Context, entryID string, sessionID KCSessionID) (*MeetingRequest, error) {
+	tags, err := c.NamedPropTags(ctx, sessionID, meetingRequestNamedProps...)
+	if err != nil {
+		return nil, fmt.Errorf("get meeting request named props failed: %v", err)
+	}
+
+	resp, err := c.LoadObject(ctx, entryID, 0, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("get meeting request loadObject failed: %v", err)
+	}
+	if resp.Er != KCSuccess {
+		return nil, resp.Er
+	}
+	if resp.Object == nil {
+		return nil, fmt.Errorf("get meeting request loadObject returned no object")
+	}
+
+	props := resp.Object.Props()
+	if !strings.HasPrefix(props.GetString(PR_MESSAGE_CLASS), MeetingRequestMessageClass) {
+		return nil, fmt.Errorf("message is not a meeting request: %v", props.GetString(PR_MESSAGE_CLASS))
+	}
+
+	request := &MeetingRequest{
+		EntryID:             entryID,
+		Subject:             props.GetString(PR_SUBJECT),
+		Location:            props.GetString(tags[4]),
+		Start:               props.GetTime(tags[2]),
+		End:                 props.GetTime(tags[3]),
+		OwnerCriticalChange: props.GetTime(tags[6]),
+		Organizer: &Recipient{
+			Type:        MAPI_TO,
+			DisplayName: props.GetString(PR_SENT_REPRESENTING_NAME),
+			Email:       props.GetString(PR_SENT_REPRESENTING_EMAIL_ADDRESS),
+			AddrType:    props.GetString(PR_SENT_REPRESENTING_ADDRTYPE),
+		},
+	}
+	if value, ok := props.Get(tags[0]); ok {
+		request.globalObjectID = value.BinValue
+	}
+	if value, ok := props.Get(tags[1]); ok {
+		request.cleanGlobalObjectID = value.BinValue
+	}
+	if value, ok := props.Get(tags[5]); ok {
+		request.Sequence = value.ULValue
+	}
+	if value, ok := props.Get(PR_SENT_REPRESENTING_ENTRYID); ok {
+		request.Organizer.EntryID = string(value.BinValue)
+	}
+	if request.Organizer.Email == "" {
+		// Fall back to sender, if there is no representing sender.
+		request.Organizer.DisplayName = props.GetString(PR_SENDER_NAME)
+		request.Organizer.Email = props.GetString(PR_SENDER_EMAIL_ADDRESS)
+		request.Organizer.AddrType = props.GetString(PR_SENDER_ADDRTYPE)
+		if value, ok := props.Get(PR_SENDER_ENTRYID); ok {
+			request.Organizer.EntryID = string(value.BinValue)
+		}
+	}
+	if request.Organizer.Email == "" {
+		return nil, fmt.Errorf("meeting request has no organizer")
+	}
+
+	return request, nil
+}
+
+// RespondToMeetingRequest generates the provided response for the provided
+// meeting request and sends it to the organizer using the provided session.
+// The provided body is used as the response message text.
+func (c *KCC) RespondToMeetingRequest(ctx context.Context, request *MeetingRequest, response MeetingResponse, body string, sessionID KCSessionID) error {
+	tags, err := c.NamedPropTags(ctx, sessionID, meetingRequestNamedProps...)
+	if err != nil {
+		return fmt.Errorf("respond to meeting request named props failed: %v", err)
+	}
+
+	props, err := meetingResponseProps(request, response, body, tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.SendMessage(ctx, props, []*Recipient{request.Organizer}, sessionID)
+	return err
+}
+
+// AcceptMeetingRequest accepts the meeting request with the provided Entry ID
+// using the provided session.
+func (c *KCC) AcceptMeetingRequest(ctx context.Context, entryID string, body string, sessionID KCSessionID) error {
+	return c.respondToMeetingRequestEntryID(ctx, entryID, MeetingResponseAccepted, body, sessionID)
+}
+
+// TentativelyAcceptMeetingRequest tentatively accepts the meeting request with
+// the provided Entry ID using the provided session.
+func (c *KCC) TentativelyAcceptMeetingRequest(ctx context.Context, entryID string, body string, sessionID KCSessionID) error {
+	return c.respondToMeetingRequestEntryID(ctx, entryID, MeetingResponseTentative, body, sessionID)
+}
+
+// DeclineMeetingRequest declines the meeting request with the provided Entry ID
+// using the provided session.
+func (c *KCC) DeclineMeetingRequest(ctx context.Context, entryID string, body string, sessionID KCSessionID) error {
+	return c.respondToMeetingRequestEntryID(ctx, entryID, MeetingResponseDeclined, body, sessionID)
+}
+
+func (c *KCC) respondToMeetingRequestEntryID(ctx context.Context, entryID string, response MeetingResponse, body string, sessionID KCSessionID) error {
+	request, err := c.GetMeetingRequest(ctx, entryID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return c.RespondToMeetingRequest(ctx, request, response, body, sessionID)
+}
+
+// meetingResponseProps builds the properties of a response message for the
+// provided request. The tags must be the resolved meetingRequestNamedProps.
+func meetingResponseProps(request *MeetingRequest, response MeetingResponse, body string, tags []PT) ([]*PropTagRowSetValue, error) {
+	messageClass, err := response.messageClass()
+	if err != nil {
+		return nil, err
+	}
+
+	subject := response.String() + ": " + request.Subject
+	props := []*PropTagRowSetValue{
+		StringPropValue(PR_MESSAGE_CLASS, messageClass),
+		StringPropValue(PR_SUBJECT, subject),
+		StringPropValue(PR_CONVERSATION_TOPIC, request.Subject),
+		StringPropValue(PR_BODY, body),
+		TimePropValue(tags[2], request.Start),
+		TimePropValue(tags[3], request.End),
+		StringPropValue(tags[4], request.Location),
+		ULPropValue(tags[5], request.Sequence),
+		ULPropValue(tags[7], uint64(response)),
+	}
+	if len(request.globalObjectID) > 0 {
+		props = append(props, &PropTagRowSetValue{PropTag: tags[0], BinValue: request.globalObjectID})
+	}
+	if len(request.cleanGlobalObjectID) > 0 {
+		props = append(props, &PropTagRowSetValue{PropTag: tags[1], BinValue: request.cleanGlobalObjectID})
+	}
+	if !request.OwnerCriticalChange.IsZero() {
+		props = append(props, TimePropValue(tags[6], request.OwnerCriticalChange))
+	}
+
+	return props, nil
+}
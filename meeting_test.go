@@ -0,0 +1,85 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMeetingResponseProps(t *testing.T) {
+	tags := make([]PT, len(meetingRequestNamedProps))
+	for idx, name := range meetingRequestNamedProps {
+		tags[idx] = propTag(name.Type, uint64(0x8500+idx))
+	}
+	start := time.Date(2019, 8, 1, 12, 0, 0, 0, time.UTC)
+	request := &MeetingRequest{
+		Subject:  "Planning",
+		Location: "Room 1",
+		Start:    start,
+		End:      start.Add(time.Hour),
+		Sequence: 2,
+
+		globalObjectID: []byte{1, 2, 3},
+	}
+
+	values := []struct {
+		response     MeetingResponse
+		messageClass string
+		subject      string
+	}{
+		{MeetingResponseAccepted, "IPM.Schedule.Meeting.Resp.Pos", "Accepted: Planning"},
+		{MeetingResponseTentative, "IPM.Schedule.Meeting.Resp.Tent", "Tentative: Planning"},
+		{MeetingResponseDeclined, "IPM.Schedule.Meeting.Resp.Neg", "Declined: Planning"},
+	}
+
+	for _, value := range values {
+		rows, err := meetingResponseProps(request, value.response, "See you", tags)
+		if err != nil {
+			t.Fatalf("meetingResponseProps(%v) failed: %v", value.response, err)
+		}
+		props := &PropTagRowSet{PropTagValues: rows}
+		if got := props.GetString(PR_MESSAGE_CLASS); got != value.messageClass {
+			t.Errorf("meetingResponseProps(%v) message class mismatch: got %v want %v", value.response, got, value.messageClass)
+		}
+		if got := props.GetString(PR_SUBJECT); got != value.subject {
+			t.Errorf("meetingResponseProps(%v) subject mismatch: got %v want %v", value.response, got, value.subject)
+		}
+		if got := props.GetString(PR_CONVERSATION_TOPIC); got != request.Subject {
+			t.Errorf("meetingResponseProps(%v) conversation topic mismatch: got %v", value.response, got)
+		}
+		if got, ok := props.Get(tags[7]); !ok || got.ULValue != uint64(value.response) {
+			t.Errorf("meetingResponseProps(%v) response status mismatch: got %+v", value.response, got)
+		}
+		if got, ok := props.Get(tags[5]); !ok || got.ULValue != request.Sequence {
+			t.Errorf("meetingResponseProps(%v) sequence mismatch: got %+v", value.response, got)
+		}
+		if !props.GetTime(tags[2]).Equal(request.Start) {
+			t.Errorf("meetingResponseProps(%v) start mismatch: got %v", value.response, props.GetTime(tags[2]))
+		}
+		if got, ok := props.Get(tags[0]); !ok || string(got.BinValue) != string(request.globalObjectID) {
+			t.Errorf("meetingResponseProps(%v) global object ID mismatch: got %+v", value.response, got)
+		}
+		if _, ok := props.Get(tags[1]); ok {
+			t.Errorf("meetingResponseProps(%v) has unexpected clean global object ID", value.response)
+		}
+	}
+
+	if _, err := meetingResponseProps(request, MeetingResponse(5), "", tags); err == nil {
+		t.Errorf("meetingResponseProps with unsupported response succeeded")
+	}
+}
@@ -0,0 +1,231 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// A Recipient represents a recipient of a message.
+type Recipient struct {
+	Type        RecipientType `json:"type"`
+	DisplayName string        `json:"displayName"`
+	Email       string        `json:"email"`
+	AddrType    string        `json:"addrType"`
+	EntryID     string        `json:"entryID,omitempty"`
+}
+
+func (r *Recipient) saveObject(clientID uint64) *SaveObject {
+	addrType := r.AddrType
+	if addrType == "" {
+		addrType = "SMTP"
+	}
+
+	props := []*PropTagRowSetValue{
+		ULPropValue(PR_ROWID, clientID),
+		ULPropValue(PR_RECIPIENT_TYPE, uint64(r.Type)),
+		ULPropValue(PR_OBJECT_TYPE, uint64(MAPI_MAILUSER)),
+		StringPropValue(PR_DISPLAY_NAME, r.DisplayName),
+		StringPropValue(PR_EMAIL_ADDRESS, r.Email),
+		StringPropValue(PR_ADDRTYPE, addrType),
+	}
+	if addrType == "SMTP" {
+		props = append(props, StringPropValue(PR_SMTP_ADDRESS, r.Email))
+	}
+	if r.EntryID != "" {
+		props = append(props, &PropTagRowSetValue{
+			PropTag:  PR_ENTRYID,
+			BinValue: []byte(r.EntryID),
+		})
+	}
+
+	return &SaveObject{
+		ModProps: props,
+		ClientID: clientID,
+		ObjType:  MAPI_MAILUSER,
+	}
+}
+
+// SendMessage creates a new message with the provided properties and
+// recipients in the Outbox of the default store of the session's user and
+// submits it for sending. A copy of the sent message is moved to the sent
+// items folder by the server. The Entry ID of the submitted message is
+// returned.
+func (c *KCC) SendMessage(ctx context.Context, props []*PropTagRowSetValue, recipients []*Recipient, sessionID KCSessionID) (string, error) {
+	if len(recipients) == 0 {
+		return "", fmt.Errorf("send message without recipients")
+	}
+
+	store, err := c.OpenStore(ctx, "", sessionID)
+	if err != nil {
+		return "", err
+	}
+	outboxEntryID, ok := store.FolderEntryID(PR_IPM_OUTBOX_ENTRYID)
+	if !ok {
+		return "", fmt.Errorf("send message store has no outbox")
+	}
+
+	eid, err := NewEIDV1(store.GUID, MAPI_MESSAGE)
+	if err != nil {
+		return "", fmt.Errorf("send message failed to create entry ID: %v", err)
+	}
+	entryID := eid.String()
+
+	object := &SaveObject{
+		ModProps: append([]*PropTagRowSetValue{
+			ULPropValue(PR_MESSAGE_FLAGS, uint64(MSGFLAG_UNSENT|MSGFLAG_FROMME)),
+		}, props...),
+		ObjType: MAPI_MESSAGE,
+	}
+	if sentEntryID, ok := store.FolderEntryID(PR_IPM_SENTMAIL_ENTRYID); ok {
+		object.ModProps = append(object.ModProps, &PropTagRowSetValue{
+			PropTag:  PR_SENTMAIL_ENTRYID,
+			BinValue: []byte(sentEntryID),
+		})
+	} else {
+		object.ModProps = append(object.ModProps, BoolPropValue(PR_DELETE_AFTER_SUBMIT, true))
+	}
+	for idx, recipient := range recipients {
+		object.Children = append(object.Children, recipient.saveObject(uint64(idx+1)))
+	}
+
+	saved, err := c.SaveObject(ctx, outboxEntryID, entryID, object, 0, sessionID)
+	if err != nil {
+		return "", fmt.Errorf("send message saveObject failed: %v", err)
+	}
+	if saved.Er != KCSuccess {
+		return "", saved.Er
+	}
+
+	submitted, err := c.SubmitMessage(ctx, entryID, 0, sessionID)
+	if err != nil {
+		return "", fmt.Errorf("send message submitMessage failed: %v", err)
+	}
+	if submitted.Er != KCSuccess {
+		return "", submitted.Er
+	}
+
+	return entryID, nil
+}
+
+// CreateMessage creates a new message with the provided properties and
+// recipients in the folder with the provided Entry ID using the provided
+// session. The message is only saved, not submitted. The Entry ID of the new
+// message is returned.
+func (c *KCC) CreateMessage(ctx context.Context, folderEntryID string, props []*PropTagRowSetValue, recipients []*Recipient, sessionID KCSessionID) (string, error) {
+	// NOTE(longsleep): Entry IDs of folders contain the GUID of their store,
+	// which is needed to create new Entry IDs.
+	folderEID, err := NewEIDFromBase64([]byte(folderEntryID))
+	if err != nil {
+		return "", fmt.Errorf("create message invalid folder entry ID: %v", err)
+	}
+	eid, err := NewEIDV1(folderEID.GUID, MAPI_MESSAGE)
+	if err != nil {
+		return "", fmt.Errorf("create message failed to create entry ID: %v", err)
+	}
+	entryID := eid.String()
+
+	object := &SaveObject{
+		ModProps: props,
+		ObjType:  MAPI_MESSAGE,
+	}
+	for idx, recipient := range recipients {
+		object.Children = append(object.Children, recipient.saveObject(uint64(idx+1)))
+	}
+
+	saved, err := c.SaveObject(ctx, folderEntryID, entryID, object, 0, sessionID)
+	if err != nil {
+		return "", fmt.Errorf("create message saveObject failed: %v", err)
+	}
+	if saved.Er != KCSuccess {
+		return "", saved.Er
+	}
+
+	return entryID, nil
+}
+
+// An ImportMessage holds a message which is imported with its original
+// delivery properties, for example when migrating data from other systems.
+type ImportMessage struct {
+	Props      []*PropTagRowSetValue
+	Recipients []*Recipient
+
+	// Sender is the sender of the message. It is also used as representing
+	// sender, unless Props contain representing sender properties.
+	Sender       *Recipient
+	DeliveryTime time.Time
+	SubmitTime   time.Time
+	Flags        KCFlag
+}
+
+// saveProps returns the properties to save for the accociated ImportMessage.
+// Explicitly provided Props take precedence as they are set last.
+func (message *ImportMessage) saveProps() []*PropTagRowSetValue {
+	props := []*PropTagRowSetValue{
+		ULPropValue(PR_MESSAGE_FLAGS, uint64(message.Flags&^(MSGFLAG_UNSENT|MSGFLAG_SUBMIT))),
+	}
+	if !message.DeliveryTime.IsZero() {
+		props = append(props, TimePropValue(PR_MESSAGE_DELIVERY_TIME, message.DeliveryTime))
+	}
+	if !message.SubmitTime.IsZero() {
+		props = append(props, TimePropValue(PR_CLIENT_SUBMIT_TIME, message.SubmitTime))
+	}
+	if sender := message.Sender; sender != nil {
+		addrType := sender.AddrType
+		if addrType == "" {
+			addrType = "SMTP"
+		}
+		props = append(props,
+			StringPropValue(PR_SENDER_NAME, sender.DisplayName),
+			StringPropValue(PR_SENDER_EMAIL_ADDRESS, sender.Email),
+			StringPropValue(PR_SENDER_ADDRTYPE, addrType),
+		)
+		if sender.EntryID != "" {
+			props = append(props, BinPropValue(PR_SENDER_ENTRYID, []byte(sender.EntryID)))
+		}
+
+		representing := false
+		for _, prop := range message.Props {
+			if prop.PropTag == PR_SENT_REPRESENTING_EMAIL_ADDRESS {
+				representing = true
+				break
+			}
+		}
+		if !representing {
+			props = append(props,
+				StringPropValue(PR_SENT_REPRESENTING_NAME, sender.DisplayName),
+				StringPropValue(PR_SENT_REPRESENTING_EMAIL_ADDRESS, sender.Email),
+				StringPropValue(PR_SENT_REPRESENTING_ADDRTYPE, addrType),
+			)
+			if sender.EntryID != "" {
+				props = append(props, BinPropValue(PR_SENT_REPRESENTING_ENTRYID, []byte(sender.EntryID)))
+			}
+		}
+	}
+
+	return append(props, message.Props...)
+}
+
+// ImportMessage creates the provided message in the folder with the provided
+// Entry ID using the provided session. Other than SendMessage, the message is
+// not submitted and keeps its sender, delivery times and flags. The Entry ID
+// of the new message is returned.
+func (c *KCC) ImportMessage(ctx context.Context, folderEntryID string, message *ImportMessage, sessionID KCSessionID) (string, error) {
+	return c.CreateMessage(ctx, folderEntryID, message.saveProps(), message.Recipients, sessionID)
+}
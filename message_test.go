@@ -0,0 +1,60 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestImportMessageSaveProps(t *testing.T) {
+	delivered := time.Date(2018, 3, 4, 10, 20, 0, 0, time.UTC)
+	message := &ImportMessage{
+		Props: []*PropTagRowSetValue{
+			StringPropValue(PR_SENT_REPRESENTING_EMAIL_ADDRESS, "boss@example.com"),
+		},
+		Sender: &Recipient{
+			DisplayName: "Assistant",
+			Email:       "assistant@example.com",
+		},
+		DeliveryTime: delivered,
+		Flags:        MSGFLAG_READ | MSGFLAG_UNSENT,
+	}
+
+	props := &PropTagRowSet{
+		PropTagValues: message.saveProps(),
+	}
+
+	if value, ok := props.Get(PR_MESSAGE_FLAGS); !ok || value.ULValue != uint64(MSGFLAG_READ) {
+		t.Errorf("unexpected message flags: %v", value)
+	}
+	if value := props.GetTime(PR_MESSAGE_DELIVERY_TIME); !value.Equal(delivered) {
+		t.Errorf("unexpected delivery time: %v", value)
+	}
+	if _, ok := props.Get(PR_CLIENT_SUBMIT_TIME); ok {
+		t.Errorf("unexpected submit time")
+	}
+	if value := props.GetString(PR_SENDER_ADDRTYPE); value != "SMTP" {
+		t.Errorf("unexpected sender address type: %v", value)
+	}
+	if value := props.GetString(PR_SENT_REPRESENTING_EMAIL_ADDRESS); value != "boss@example.com" {
+		t.Errorf("unexpected representing sender: %v", value)
+	}
+	if _, ok := props.Get(PR_SENT_REPRESENTING_NAME); ok {
+		t.Errorf("unexpected representing sender name")
+	}
+}
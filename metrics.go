@@ -0,0 +1,271 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMetricsBuckets are the default upper bounds in seconds of the
+// latency histogram buckets of SOAPMetrics.
+var DefaultMetricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// A MetricsRegistry receives the metrics of SOAP clients, so applications can
+// expose them, for example with Prometheus collectors. SOAPMetrics is a
+// ready to use implementation. Implementations must be safe for concurrent use
+// and must not block, ObservePool is called while the pool is locked.
+type MetricsRegistry interface {
+	// ObserveRequest is called for every request sent to the server,
+	// including retries.
+	ObserveRequest(metric *RequestMetric)
+	// ObservePool is called with the utilization of the connection pool of
+	// the SOAP socket client for the socket at the provided path whenever it
+	// changes.
+	ObservePool(path string, stats SocketPoolStats)
+}
+
+// A RequestMetric describes a finished request of a SOAP client.
+type RequestMetric struct {
+	// Action is the SOAP action of the request.
+	Action string
+	// Duration is the time it took to send the request and to decode its
+	// response.
+	Duration time.Duration
+	// Err is the error of the failed request, or the KC error returned by the
+	// server. It is nil if the request succeeded.
+	Err error
+	// Canceled is true if the request failed because its context was done.
+	// Canceled requests have no Class.
+	Canceled bool
+	// Class and Code are the result of ClassifyBackendError for Err.
+	Class BackendErrorClass
+	Code  string
+}
+
+// SocketPoolStats holds a snapshot of the utilization of the connection pool
+// of a SOAP socket client.
+type SocketPoolStats struct {
+	// Open is the number of open connections, both in use and idle.
+	Open int
+	// Idle is the number of idle connections.
+	Idle int
+	// Waiting is the number of requests waiting for a connection.
+	Waiting int
+	// Max is the maximum number of connections including the overflow.
+	Max int
+}
+
+// observeRequest passes the request with the provided action which failed with
+// the provided error, if not nil, or returned the provided response to the
+// provided registry, if not nil.
+func observeRequest(ctx context.Context, registry MetricsRegistry, action string, started time.Time, err error, v interface{}) {
+	if registry == nil {
+		return
+	}
+
+	metric := &RequestMetric{
+		Action:   action,
+		Duration: time.Since(started),
+		Err:      err,
+	}
+	if err != nil && ctx != nil && ctx.Err() != nil {
+		metric.Canceled = true
+	} else {
+		if err == nil {
+			metric.Err = responseKCError(v)
+		}
+		if metric.Err != nil {
+			metric.Class, metric.Code = ClassifyBackendError(metric.Err)
+		}
+	}
+
+	runSafely(func() {
+		registry.ObserveRequest(metric)
+	})
+}
+
+// SOAPMetrics is a MetricsRegistry which counts requests by action, errors by
+// class and records latency histograms by action, together with the pool
+// utilization of socket clients. Write them in the Prometheus text exposition
+// format with WritePrometheus.
+type SOAPMetrics struct {
+	buckets []float64
+
+	mutex    sync.Mutex
+	requests map[string]*soapMetricsAction
+	errors   map[BackendErrorClass]uint64
+	canceled uint64
+	pools    map[string]SocketPoolStats
+}
+
+type soapMetricsAction struct {
+	count   uint64
+	sum     float64
+	buckets []uint64
+}
+
+// NewSOAPMetrics creates a new SOAPMetrics with the provided latency histogram
+// bucket upper bounds in seconds. If none are provided, DefaultMetricsBuckets
+// are used.
+func NewSOAPMetrics(buckets ...float64) *SOAPMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &SOAPMetrics{
+		buckets:  buckets,
+		requests: make(map[string]*soapMetricsAction),
+		errors:   make(map[BackendErrorClass]uint64),
+		pools:    make(map[string]SocketPoolStats),
+	}
+}
+
+// ObserveRequest implements MetricsRegistry.
+func (m *SOAPMetrics) ObserveRequest(metric *RequestMetric) {
+	seconds := metric.Duration.Seconds()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	action := m.requests[metric.Action]
+	if action == nil {
+		action = &soapMetricsAction{
+			buckets: make([]uint64, len(m.buckets)),
+		}
+		m.requests[metric.Action] = action
+	}
+	action.count++
+	action.sum += seconds
+	for idx, bound := range m.buckets {
+		if seconds <= bound {
+			action.buckets[idx]++
+		}
+	}
+
+	switch {
+	case metric.Canceled:
+		m.canceled++
+	case metric.Err != nil:
+		m.errors[metric.Class]++
+	}
+}
+
+// ObservePool implements MetricsRegistry.
+func (m *SOAPMetrics) ObservePool(path string, stats SocketPoolStats) {
+	m.mutex.Lock()
+	m.pools[path] = stats
+	m.mutex.Unlock()
+}
+
+// Pools returns a snapshot of the last observed utilization of the connection
+// pools of socket clients by socket path.
+func (m *SOAPMetrics) Pools() map[string]SocketPoolStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	pools := make(map[string]SocketPoolStats, len(m.pools))
+	for path, stats := range m.pools {
+		pools[path] = stats
+	}
+
+	return pools
+}
+
+// WritePrometheus writes the accociated metrics to the provided writer in the
+// Prometheus text exposition format.
+func (m *SOAPMetrics) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	actions := make([]string, 0, len(m.requests))
+	for action := range m.requests {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+
+	fmt.Fprintf(bw, "# HELP kcc_soap_requests_total Total number of SOAP requests by action.\n# TYPE kcc_soap_requests_total counter\n")
+	for _, action := range actions {
+		fmt.Fprintf(bw, "kcc_soap_requests_total{action=\"%s\"} %d\n", promLabelValue(action), m.requests[action].count)
+	}
+
+	fmt.Fprintf(bw, "# HELP kcc_soap_request_errors_total Total number of failed SOAP requests by class.\n# TYPE kcc_soap_request_errors_total counter\n")
+	classes := make([]string, 0, len(m.errors))
+	for class := range m.errors {
+		classes = append(classes, string(class))
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		fmt.Fprintf(bw, "kcc_soap_request_errors_total{class=\"%s\"} %d\n", promLabelValue(class), m.errors[BackendErrorClass(class)])
+	}
+	fmt.Fprintf(bw, "# HELP kcc_soap_requests_canceled_total Total number of SOAP requests aborted because their context was done.\n# TYPE kcc_soap_requests_canceled_total counter\n")
+	fmt.Fprintf(bw, "kcc_soap_requests_canceled_total %d\n", m.canceled)
+
+	fmt.Fprintf(bw, "# HELP kcc_soap_request_duration_seconds Latency of SOAP requests by action.\n# TYPE kcc_soap_request_duration_seconds histogram\n")
+	for _, action := range actions {
+		a := m.requests[action]
+		for idx, bound := range m.buckets {
+			fmt.Fprintf(bw, "kcc_soap_request_duration_seconds_bucket{action=\"%s\",le=\"%v\"} %d\n", promLabelValue(action), bound, a.buckets[idx])
+		}
+		fmt.Fprintf(bw, "kcc_soap_request_duration_seconds_bucket{action=\"%s\",le=\"+Inf\"} %d\n", promLabelValue(action), a.count)
+		fmt.Fprintf(bw, "kcc_soap_request_duration_seconds_sum{action=\"%s\"} %v\n", promLabelValue(action), a.sum)
+		fmt.Fprintf(bw, "kcc_soap_request_duration_seconds_count{action=\"%s\"} %d\n", promLabelValue(action), a.count)
+	}
+
+	if len(m.pools) > 0 {
+		paths := make([]string, 0, len(m.pools))
+		for path := range m.pools {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		fmt.Fprintf(bw, "# HELP kcc_soap_pool_connections Number of open connections of SOAP socket client pools by state.\n# TYPE kcc_soap_pool_connections gauge\n")
+		for _, path := range paths {
+			stats := m.pools[path]
+			fmt.Fprintf(bw, "kcc_soap_pool_connections{path=\"%s\",state=\"idle\"} %d\n", promLabelValue(path), stats.Idle)
+			fmt.Fprintf(bw, "kcc_soap_pool_connections{path=\"%s\",state=\"in_use\"} %d\n", promLabelValue(path), stats.Open-stats.Idle)
+		}
+		fmt.Fprintf(bw, "# HELP kcc_soap_pool_max_connections Maximum number of connections of SOAP socket client pools including overflow.\n# TYPE kcc_soap_pool_max_connections gauge\n")
+		for _, path := range paths {
+			fmt.Fprintf(bw, "kcc_soap_pool_max_connections{path=\"%s\"} %d\n", promLabelValue(path), m.pools[path].Max)
+		}
+		fmt.Fprintf(bw, "# HELP kcc_soap_pool_waiting Number of requests waiting for a connection of SOAP socket client pools.\n# TYPE kcc_soap_pool_waiting gauge\n")
+		for _, path := range paths {
+			fmt.Fprintf(bw, "kcc_soap_pool_waiting{path=\"%s\"} %d\n", promLabelValue(path), m.pools[path].Waiting)
+		}
+	}
+
+	return bw.Flush()
+}
+
+var promLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// promLabelValue escapes the provided label value for the Prometheus text
+// exposition format.
+func promLabelValue(value string) string {
+	return promLabelValueReplacer.Replace(value)
+}
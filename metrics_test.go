@@ -0,0 +1,105 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSOAPMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/down" {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rw.Write([]byte(soapHeader + "<ns:logonResponse><er>" + strconv.FormatUint(uint64(KCERR_LOGON_FAILED), 10) + "</er></ns:logonResponse>" + soapFooter))
+	}))
+	defer srv.Close()
+
+	metrics := NewSOAPMetrics(0.5, 30)
+	for _, path := range []string{"/", "/down"} {
+		uri, _ := url.Parse(srv.URL + path)
+		client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+			HTTPClient:  srv.Client(),
+			RetryPolicy: &RetryPolicy{MaxAttempts: 1},
+			Metrics:     metrics,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		NewKCCWithClient(client).Logon(context.Background(), "user1", "wrong", 0)
+	}
+	metrics.ObservePool("/run/kopano/server.sock", SocketPoolStats{Open: 3, Idle: 1, Waiting: 2, Max: 4})
+	if pools := metrics.Pools(); pools["/run/kopano/server.sock"].Open != 3 {
+		t.Errorf("unexpected pools: %+v", pools)
+	}
+
+	var buf bytes.Buffer
+	if err := metrics.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+	for _, line := range []string{
+		`kcc_soap_requests_total{action="logon"} 2`,
+		`kcc_soap_request_errors_total{class="auth"} 1`,
+		`kcc_soap_request_errors_total{class="busy"} 1`,
+		`kcc_soap_request_duration_seconds_bucket{action="logon",le="30"} 2`,
+		`kcc_soap_request_duration_seconds_bucket{action="logon",le="+Inf"} 2`,
+		`kcc_soap_request_duration_seconds_count{action="logon"} 2`,
+		`kcc_soap_pool_connections{path="/run/kopano/server.sock",state="in_use"} 2`,
+		`kcc_soap_pool_waiting{path="/run/kopano/server.sock"} 2`,
+	} {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("expected %s in output:\n%s", line, output)
+		}
+	}
+}
+
+func TestSocketPoolObserve(t *testing.T) {
+	var observed []SocketPoolStats
+	pool, err := newSocketPool(&SocketPoolConfig{
+		MaxConnections: 1,
+	}, func() (net.Conn, error) {
+		c1, c2 := net.Pipe()
+		c2.Close()
+		return c1, nil
+	}, func(stats SocketPoolStats) {
+		observed = append(observed, stats)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	c, _ := pool.GetWithTimeout(time.Second)
+	if last := observed[len(observed)-1]; last.Open != 1 || last.Idle != 0 || last.Max != 1 {
+		t.Errorf("unexpected stats with connection in use: %+v", last)
+	}
+	c.Close()
+	if last := observed[len(observed)-1]; last.Open != 1 || last.Idle != 1 {
+		t.Errorf("unexpected stats with idle connection: %+v", last)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+)
+
+// A SOAPRoundTrip sends a SOAP request with the provided payload and decodes
+// its response into v.
+type SOAPRoundTrip func(ctx context.Context, payload *string, v interface{}) error
+
+// A SOAPMiddleware wraps a SOAPRoundTrip, so requests and responses can be
+// inspected or changed before and after calling next, for example to log or
+// meter requests, to add context values or to inspect faults. Middleware must
+// call next at most once and return its error unless it handles it.
+type SOAPMiddleware func(next SOAPRoundTrip) SOAPRoundTrip
+
+// chainSOAPMiddleware returns the provided round trip wrapped with the
+// provided middleware, the first middleware being the outermost.
+func chainSOAPMiddleware(rt SOAPRoundTrip, middleware []SOAPMiddleware) SOAPRoundTrip {
+	for idx := len(middleware) - 1; idx >= 0; idx-- {
+		rt = middleware[idx](rt)
+	}
+
+	return rt
+}
+
+// doRequestWithMiddleware sends the request with the provided round trip
+// wrapped with the provided middleware. Panics of middleware are returned as
+// *PanicError.
+func doRequestWithMiddleware(ctx context.Context, payload *string, v interface{}, rt SOAPRoundTrip, middleware []SOAPMiddleware) error {
+	if len(middleware) == 0 {
+		return rt(ctx, payload, v)
+	}
+
+	return callSafely(func() error {
+		return chainSOAPMiddleware(rt, middleware)(ctx, payload, v)
+	})
+}
+
+// A MiddlewareSOAPClient wraps a SOAPClient, sending all its requests through
+// the accociated middleware. Use it for SOAPClient implementations which have
+// no Middleware field.
+type MiddlewareSOAPClient struct {
+	Client     SOAPClient
+	Middleware []SOAPMiddleware
+}
+
+// NewMiddlewareSOAPClient creates a new MiddlewareSOAPClient wrapping the
+// provided client with the provided middleware, the first middleware being
+// the outermost.
+func NewMiddlewareSOAPClient(client SOAPClient, middleware ...SOAPMiddleware) *MiddlewareSOAPClient {
+	return &MiddlewareSOAPClient{
+		Client:     client,
+		Middleware: middleware,
+	}
+}
+
+// DoRequest sends the provided payload data as SOAP through the means of the
+// accociated client, wrapped with the accociated middleware.
+func (mc *MiddlewareSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	return doRequestWithMiddleware(ctx, payload, v, mc.Client.DoRequest, mc.Middleware)
+}
+
+func (mc *MiddlewareSOAPClient) String() string {
+	return fmt.Sprintf("%s", mc.Client)
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSOAPHTTPClientMiddleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(soapHeader + `<SOAP-ENV:Fault><faultcode>SOAP-ENV:Server</faultcode><faultstring>Out of memory</faultstring></SOAP-ENV:Fault>` + soapFooter))
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	var fault *ProtocolError
+	named := func(name string) SOAPMiddleware {
+		return func(next SOAPRoundTrip) SOAPRoundTrip {
+			return func(ctx context.Context, payload *string, v interface{}) error {
+				calls = append(calls, name+":"+soapAction(*payload))
+				err := next(ctx, payload, v)
+				calls = append(calls, name+":done")
+				return err
+			}
+		}
+	}
+	client.Middleware = []SOAPMiddleware{named("outer"), named("inner"), func(next SOAPRoundTrip) SOAPRoundTrip {
+		return func(ctx context.Context, payload *string, v interface{}) error {
+			err := next(ctx, payload, v)
+			fault, _ = err.(*ProtocolError)
+			return err
+		}
+	}}
+
+	var response struct{}
+	payload := "<ns:resolveUsername><sUsername>user1</sUsername></ns:resolveUsername>"
+	if err = client.DoRequest(context.Background(), &payload, &response); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if strings.Join(calls, ",") != "outer:resolveUsername,inner:resolveUsername,inner:done,outer:done" {
+		t.Errorf("unexpected middleware calls: %v", calls)
+	}
+	if fault == nil || fault.Kind != ProtocolErrorFault {
+		t.Errorf("expected fault to be inspected, got %v", fault)
+	}
+}
+
+func TestMiddlewareSOAPClientPanic(t *testing.T) {
+	client := NewMiddlewareSOAPClient(&goldenSOAPClient{}, func(next SOAPRoundTrip) SOAPRoundTrip {
+		return func(ctx context.Context, payload *string, v interface{}) error {
+			panic("middleware panic")
+		}
+	})
+
+	var response struct{}
+	payload := "<ns:logoff/>"
+	err := client.DoRequest(context.Background(), &payload, &response)
+	if _, ok := err.(*PanicError); !ok {
+		t.Errorf("expected *PanicError, got %v", err)
+	}
+}
@@ -0,0 +1,795 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mock
+
+import (
+	"context"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// KopanoClient is a mock implementation of kcc.KopanoClient. Every method
+// calls the function field of the same name with Func suffix. Methods without
+// function return zero values and a NotMockedError. All calls are recorded
+// and can be inspected with Calls.
+type KopanoClient struct {
+	callRecorder
+
+	LogonFunc                           func(ctx context.Context, username string, password string, logonFlags kcc.KCFlag) (*kcc.LogonResponse, error)
+	SSOLogonFunc                        func(ctx context.Context, prefix kcc.SSOType, username string, input []byte, sessionID kcc.KCSessionID, logonFlags kcc.KCFlag) (*kcc.LogonResponse, error)
+	LocalAdminLogonFunc                 func(ctx context.Context, logonFlags kcc.KCFlag) (*kcc.LogonResponse, error)
+	LogoffFunc                          func(ctx context.Context, sessionID kcc.KCSessionID) (*kcc.LogoffResponse, error)
+	ResolveUsernameFunc                 func(ctx context.Context, username string, sessionID kcc.KCSessionID) (*kcc.ResolveUserResponse, error)
+	GetUserFunc                         func(ctx context.Context, userEntryID string, sessionID kcc.KCSessionID) (*kcc.GetUserResponse, error)
+	GetUsersByNameFunc                  func(ctx context.Context, usernames []string, sessionID kcc.KCSessionID) ([]*kcc.UserResult, error)
+	ListUsersFunc                       func(ctx context.Context, companyEntryID string, sessionID kcc.KCSessionID, cb func(*kcc.User) error) error
+	ABResolveNamesFunc                  func(ctx context.Context, props []kcc.PT, request map[kcc.PT]interface{}, requestFlags kcc.ABFlag, sessionID kcc.KCSessionID, resolveNamesFlags kcc.KCFlag) (*kcc.ABResolveNamesResponse, error)
+	ABResolveNamesRowsFunc              func(ctx context.Context, props []kcc.PT, rows []map[kcc.PT]interface{}, requestFlags []kcc.ABFlag, sessionID kcc.KCSessionID, resolveNamesFlags kcc.KCFlag) (*kcc.ABResolveNamesResponse, error)
+	ResolveNamesFunc                    func(ctx context.Context, names []string, props []kcc.PT, sessionID kcc.KCSessionID) ([]*kcc.ResolveNameResult, error)
+	ResolveNameCandidatesFunc           func(ctx context.Context, results []*kcc.ResolveNameResult, limit int, sessionID kcc.KCSessionID) error
+	GetCompanyFunc                      func(ctx context.Context, companyEntryID string, sessionID kcc.KCSessionID) (*kcc.GetCompanyResponse, error)
+	GetUserAliasesFunc                  func(ctx context.Context, userEntryID string, sessionID kcc.KCSessionID) ([]string, error)
+	ResolveAliasFunc                    func(ctx context.Context, address string, sessionID kcc.KCSessionID) (*kcc.User, error)
+	CheckSendAsFunc                     func(ctx context.Context, username string, address string, sessionID kcc.KCSessionID) (*kcc.SendAsPermission, error)
+	ResolveRecipientsFunc               func(ctx context.Context, addresses []string, sessionID kcc.KCSessionID) ([]*kcc.RecipientResult, error)
+	CreateUserFunc                      func(ctx context.Context, user *kcc.User, password string, sessionID kcc.KCSessionID) (*kcc.CreateUserResponse, error)
+	SetUserFunc                         func(ctx context.Context, user *kcc.User, password string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error)
+	DeleteUserFunc                      func(ctx context.Context, userEntryID string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error)
+	SetQuotaFunc                        func(ctx context.Context, userEntryID string, quota *kcc.Quota, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error)
+	ListGroupsFunc                      func(ctx context.Context, companyEntryID string, sessionID kcc.KCSessionID) (*kcc.GetGroupListResponse, error)
+	CreateGroupFunc                     func(ctx context.Context, group *kcc.Group, sessionID kcc.KCSessionID) (*kcc.CreateGroupResponse, error)
+	SetGroupFunc                        func(ctx context.Context, group *kcc.Group, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error)
+	DeleteGroupFunc                     func(ctx context.Context, groupEntryID string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error)
+	ListGroupUsersFunc                  func(ctx context.Context, groupEntryID string, sessionID kcc.KCSessionID) (*kcc.GetUserListResponse, error)
+	AddGroupUserFunc                    func(ctx context.Context, groupEntryID string, userEntryID string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error)
+	DeleteGroupUserFunc                 func(ctx context.Context, groupEntryID string, userEntryID string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error)
+	SetUserAliasesFunc                  func(ctx context.Context, userEntryID string, aliases []string, sessionID kcc.KCSessionID) error
+	AddUserAliasesFunc                  func(ctx context.Context, userEntryID string, aliases []string, sessionID kcc.KCSessionID) error
+	RemoveUserAliasesFunc               func(ctx context.Context, userEntryID string, aliases []string, sessionID kcc.KCSessionID) error
+	PurgeSoftDeleteFunc                 func(ctx context.Context, days uint64, sessionID kcc.KCSessionID) (*kcc.PurgeResponse, error)
+	PurgeDeferredUpdatesFunc            func(ctx context.Context, sessionID kcc.KCSessionID) (*kcc.PurgeDeferredUpdatesResponse, error)
+	PurgeCacheFunc                      func(ctx context.Context, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.PurgeResponse, error)
+	GetStoreFunc                        func(ctx context.Context, storeEntryID string, sessionID kcc.KCSessionID) (*kcc.GetStoreResponse, error)
+	ResolveUserStoreFunc                func(ctx context.Context, username string, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.ResolveUserStoreResponse, error)
+	OpenStoreFunc                       func(ctx context.Context, storeEntryID string, sessionID kcc.KCSessionID) (*kcc.Store, error)
+	GetReceiveFolderFunc                func(ctx context.Context, storeEntryID string, messageClass string, sessionID kcc.KCSessionID) (*kcc.GetReceiveFolderResponse, error)
+	OpenUserStoreFunc                   func(ctx context.Context, username string, sessionID kcc.KCSessionID) (*kcc.Store, error)
+	DefaultFolderEntryIDFunc            func(ctx context.Context, pt kcc.PT, sessionID kcc.KCSessionID) (string, error)
+	ListFoldersFunc                     func(ctx context.Context, folderEntryID string, sessionID kcc.KCSessionID) ([]*kcc.Folder, error)
+	GetFolderStatsFunc                  func(ctx context.Context, folderEntryID string, sessionID kcc.KCSessionID) (*kcc.FolderStats, error)
+	GetStoreStatsFunc                   func(ctx context.Context, store *kcc.Store, sessionID kcc.KCSessionID) (*kcc.StoreStats, error)
+	LoadObjectFunc                      func(ctx context.Context, entryID string, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.LoadObjectResponse, error)
+	GetPropsFunc                        func(ctx context.Context, entryID string, props []kcc.PT, sessionID kcc.KCSessionID) ([]*kcc.PropTagRowSetValue, error)
+	SaveObjectFunc                      func(ctx context.Context, parentEntryID string, entryID string, object *kcc.SaveObject, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.LoadObjectResponse, error)
+	SubmitMessageFunc                   func(ctx context.Context, entryID string, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.SubmitMessageResponse, error)
+	DeleteObjectsFunc                   func(ctx context.Context, entryIDs []string, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.DeleteObjectsResponse, error)
+	GetIDsFromNamesFunc                 func(ctx context.Context, names []*kcc.NamedProp, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.GetIDsFromNamesResponse, error)
+	NamedPropTagsFunc                   func(ctx context.Context, sessionID kcc.KCSessionID, names ...*kcc.NamedProp) ([]kcc.PT, error)
+	TableOpenFunc                       func(ctx context.Context, entryID string, tableType kcc.TableType, objType kcc.MAPIType, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.TableOpenResponse, error)
+	TableSetColumnsFunc                 func(ctx context.Context, tableID uint64, props []kcc.PT, sessionID kcc.KCSessionID) (*kcc.TableResponse, error)
+	TableQueryRowsFunc                  func(ctx context.Context, tableID uint64, rowCount uint64, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.TableQueryRowsResponse, error)
+	TableQueryRowsStreamFunc            func(ctx context.Context, tableID uint64, rowCount uint64, flags kcc.KCFlag, sessionID kcc.KCSessionID, cb func(*kcc.PropTagRowSet) error) (*kcc.TableQueryRowsStreamResponse, error)
+	TableCloseFunc                      func(ctx context.Context, tableID uint64, sessionID kcc.KCSessionID) (*kcc.TableResponse, error)
+	QueryTableRowsFunc                  func(ctx context.Context, entryID string, tableType kcc.TableType, objType kcc.MAPIType, flags kcc.KCFlag, props []kcc.PT, sessionID kcc.KCSessionID, cb func([]*kcc.PropTagRowSet) error) error
+	QueryTableRowsStreamFunc            func(ctx context.Context, entryID string, tableType kcc.TableType, objType kcc.MAPIType, flags kcc.KCFlag, props []kcc.PT, sessionID kcc.KCSessionID, cb func(*kcc.PropTagRowSet) error) error
+	SetSyncStatusFunc                   func(ctx context.Context, folderSourceKey string, syncID uint64, changeID uint64, syncType kcc.KCFlag, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.SetSyncStatusResponse, error)
+	GetChangesFunc                      func(ctx context.Context, folderSourceKey string, syncID uint64, changeID uint64, syncType kcc.KCFlag, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.GetChangesResponse, error)
+	GetEntryIDFromSourceKeyFunc         func(ctx context.Context, storeEntryID string, folderSourceKey string, messageSourceKey string, sessionID kcc.KCSessionID) (*kcc.GetEntryIDFromSourceKeyResponse, error)
+	SyncContentsFunc                    func(ctx context.Context, folderSourceKey string, state *kcc.ICSState, sessionID kcc.KCSessionID) ([]*kcc.ICSChange, *kcc.ICSState, error)
+	ListItemsFunc                       func(ctx context.Context, folderEntryID string, sessionID kcc.KCSessionID) ([]*kcc.Item, error)
+	SendMessageFunc                     func(ctx context.Context, props []*kcc.PropTagRowSetValue, recipients []*kcc.Recipient, sessionID kcc.KCSessionID) (string, error)
+	CreateMessageFunc                   func(ctx context.Context, folderEntryID string, props []*kcc.PropTagRowSetValue, recipients []*kcc.Recipient, sessionID kcc.KCSessionID) (string, error)
+	ImportMessageFunc                   func(ctx context.Context, folderEntryID string, message *kcc.ImportMessage, sessionID kcc.KCSessionID) (string, error)
+	ListContactsFunc                    func(ctx context.Context, folderEntryID string, sessionID kcc.KCSessionID) ([]*kcc.Contact, error)
+	GetContactFunc                      func(ctx context.Context, entryID string, sessionID kcc.KCSessionID) (*kcc.Contact, error)
+	CreateContactFunc                   func(ctx context.Context, folderEntryID string, contact *kcc.Contact, sessionID kcc.KCSessionID) (string, error)
+	UpdateContactFunc                   func(ctx context.Context, contact *kcc.Contact, sessionID kcc.KCSessionID) error
+	DeleteContactFunc                   func(ctx context.Context, entryID string, sessionID kcc.KCSessionID) error
+	ListEventsFunc                      func(ctx context.Context, folderEntryID string, sessionID kcc.KCSessionID) ([]*kcc.Event, error)
+	GetMeetingRequestFunc               func(ctx context.Context, entryID string, sessionID kcc.KCSessionID) (*kcc.MeetingRequest, error)
+	RespondToMeetingRequestFunc         func(ctx context.Context, request *kcc.MeetingRequest, response kcc.MeetingResponse, body string, sessionID kcc.KCSessionID) error
+	AcceptMeetingRequestFunc            func(ctx context.Context, entryID string, body string, sessionID kcc.KCSessionID) error
+	TentativelyAcceptMeetingRequestFunc func(ctx context.Context, entryID string, body string, sessionID kcc.KCSessionID) error
+	DeclineMeetingRequestFunc           func(ctx context.Context, entryID string, body string, sessionID kcc.KCSessionID) error
+}
+
+// Make sure KopanoClient implements kcc.KopanoClient.
+var _ kcc.KopanoClient = (*KopanoClient)(nil)
+
+// Logon implements kcc.KopanoClient.
+func (m *KopanoClient) Logon(ctx context.Context, username string, password string, logonFlags kcc.KCFlag) (*kcc.LogonResponse, error) {
+	m.record("Logon")
+	if m.LogonFunc != nil {
+		return m.LogonFunc(ctx, username, password, logonFlags)
+	}
+	return nil, m.notMocked("Logon")
+}
+
+// SSOLogon implements kcc.KopanoClient.
+func (m *KopanoClient) SSOLogon(ctx context.Context, prefix kcc.SSOType, username string, input []byte, sessionID kcc.KCSessionID, logonFlags kcc.KCFlag) (*kcc.LogonResponse, error) {
+	m.record("SSOLogon")
+	if m.SSOLogonFunc != nil {
+		return m.SSOLogonFunc(ctx, prefix, username, input, sessionID, logonFlags)
+	}
+	return nil, m.notMocked("SSOLogon")
+}
+
+// LocalAdminLogon implements kcc.KopanoClient.
+func (m *KopanoClient) LocalAdminLogon(ctx context.Context, logonFlags kcc.KCFlag) (*kcc.LogonResponse, error) {
+	m.record("LocalAdminLogon")
+	if m.LocalAdminLogonFunc != nil {
+		return m.LocalAdminLogonFunc(ctx, logonFlags)
+	}
+	return nil, m.notMocked("LocalAdminLogon")
+}
+
+// Logoff implements kcc.KopanoClient.
+func (m *KopanoClient) Logoff(ctx context.Context, sessionID kcc.KCSessionID) (*kcc.LogoffResponse, error) {
+	m.record("Logoff")
+	if m.LogoffFunc != nil {
+		return m.LogoffFunc(ctx, sessionID)
+	}
+	return nil, m.notMocked("Logoff")
+}
+
+// ResolveUsername implements kcc.KopanoClient.
+func (m *KopanoClient) ResolveUsername(ctx context.Context, username string, sessionID kcc.KCSessionID) (*kcc.ResolveUserResponse, error) {
+	m.record("ResolveUsername")
+	if m.ResolveUsernameFunc != nil {
+		return m.ResolveUsernameFunc(ctx, username, sessionID)
+	}
+	return nil, m.notMocked("ResolveUsername")
+}
+
+// GetUser implements kcc.KopanoClient.
+func (m *KopanoClient) GetUser(ctx context.Context, userEntryID string, sessionID kcc.KCSessionID) (*kcc.GetUserResponse, error) {
+	m.record("GetUser")
+	if m.GetUserFunc != nil {
+		return m.GetUserFunc(ctx, userEntryID, sessionID)
+	}
+	return nil, m.notMocked("GetUser")
+}
+
+// GetUsersByName implements kcc.KopanoClient.
+func (m *KopanoClient) GetUsersByName(ctx context.Context, usernames []string, sessionID kcc.KCSessionID) ([]*kcc.UserResult, error) {
+	m.record("GetUsersByName")
+	if m.GetUsersByNameFunc != nil {
+		return m.GetUsersByNameFunc(ctx, usernames, sessionID)
+	}
+	return nil, m.notMocked("GetUsersByName")
+}
+
+// ListUsers implements kcc.KopanoClient.
+func (m *KopanoClient) ListUsers(ctx context.Context, companyEntryID string, sessionID kcc.KCSessionID, cb func(*kcc.User) error) error {
+	m.record("ListUsers")
+	if m.ListUsersFunc != nil {
+		return m.ListUsersFunc(ctx, companyEntryID, sessionID, cb)
+	}
+	return m.notMocked("ListUsers")
+}
+
+// ABResolveNames implements kcc.KopanoClient.
+func (m *KopanoClient) ABResolveNames(ctx context.Context, props []kcc.PT, request map[kcc.PT]interface{}, requestFlags kcc.ABFlag, sessionID kcc.KCSessionID, resolveNamesFlags kcc.KCFlag) (*kcc.ABResolveNamesResponse, error) {
+	m.record("ABResolveNames")
+	if m.ABResolveNamesFunc != nil {
+		return m.ABResolveNamesFunc(ctx, props, request, requestFlags, sessionID, resolveNamesFlags)
+	}
+	return nil, m.notMocked("ABResolveNames")
+}
+
+// ABResolveNamesRows implements kcc.KopanoClient.
+func (m *KopanoClient) ABResolveNamesRows(ctx context.Context, props []kcc.PT, rows []map[kcc.PT]interface{}, requestFlags []kcc.ABFlag, sessionID kcc.KCSessionID, resolveNamesFlags kcc.KCFlag) (*kcc.ABResolveNamesResponse, error) {
+	m.record("ABResolveNamesRows")
+	if m.ABResolveNamesRowsFunc != nil {
+		return m.ABResolveNamesRowsFunc(ctx, props, rows, requestFlags, sessionID, resolveNamesFlags)
+	}
+	return nil, m.notMocked("ABResolveNamesRows")
+}
+
+// ResolveNames implements kcc.KopanoClient.
+func (m *KopanoClient) ResolveNames(ctx context.Context, names []string, props []kcc.PT, sessionID kcc.KCSessionID) ([]*kcc.ResolveNameResult, error) {
+	m.record("ResolveNames")
+	if m.ResolveNamesFunc != nil {
+		return m.ResolveNamesFunc(ctx, names, props, sessionID)
+	}
+	return nil, m.notMocked("ResolveNames")
+}
+
+// ResolveNameCandidates implements kcc.KopanoClient.
+func (m *KopanoClient) ResolveNameCandidates(ctx context.Context, results []*kcc.ResolveNameResult, limit int, sessionID kcc.KCSessionID) error {
+	m.record("ResolveNameCandidates")
+	if m.ResolveNameCandidatesFunc != nil {
+		return m.ResolveNameCandidatesFunc(ctx, results, limit, sessionID)
+	}
+	return m.notMocked("ResolveNameCandidates")
+}
+
+// GetCompany implements kcc.KopanoClient.
+func (m *KopanoClient) GetCompany(ctx context.Context, companyEntryID string, sessionID kcc.KCSessionID) (*kcc.GetCompanyResponse, error) {
+	m.record("GetCompany")
+	if m.GetCompanyFunc != nil {
+		return m.GetCompanyFunc(ctx, companyEntryID, sessionID)
+	}
+	return nil, m.notMocked("GetCompany")
+}
+
+// GetUserAliases implements kcc.KopanoClient.
+func (m *KopanoClient) GetUserAliases(ctx context.Context, userEntryID string, sessionID kcc.KCSessionID) ([]string, error) {
+	m.record("GetUserAliases")
+	if m.GetUserAliasesFunc != nil {
+		return m.GetUserAliasesFunc(ctx, userEntryID, sessionID)
+	}
+	return nil, m.notMocked("GetUserAliases")
+}
+
+// ResolveAlias implements kcc.KopanoClient.
+func (m *KopanoClient) ResolveAlias(ctx context.Context, address string, sessionID kcc.KCSessionID) (*kcc.User, error) {
+	m.record("ResolveAlias")
+	if m.ResolveAliasFunc != nil {
+		return m.ResolveAliasFunc(ctx, address, sessionID)
+	}
+	return nil, m.notMocked("ResolveAlias")
+}
+
+// CheckSendAs implements kcc.KopanoClient.
+func (m *KopanoClient) CheckSendAs(ctx context.Context, username string, address string, sessionID kcc.KCSessionID) (*kcc.SendAsPermission, error) {
+	m.record("CheckSendAs")
+	if m.CheckSendAsFunc != nil {
+		return m.CheckSendAsFunc(ctx, username, address, sessionID)
+	}
+	return nil, m.notMocked("CheckSendAs")
+}
+
+// ResolveRecipients implements kcc.KopanoClient.
+func (m *KopanoClient) ResolveRecipients(ctx context.Context, addresses []string, sessionID kcc.KCSessionID) ([]*kcc.RecipientResult, error) {
+	m.record("ResolveRecipients")
+	if m.ResolveRecipientsFunc != nil {
+		return m.ResolveRecipientsFunc(ctx, addresses, sessionID)
+	}
+	return nil, m.notMocked("ResolveRecipients")
+}
+
+// CreateUser implements kcc.KopanoClient.
+func (m *KopanoClient) CreateUser(ctx context.Context, user *kcc.User, password string, sessionID kcc.KCSessionID) (*kcc.CreateUserResponse, error) {
+	m.record("CreateUser")
+	if m.CreateUserFunc != nil {
+		return m.CreateUserFunc(ctx, user, password, sessionID)
+	}
+	return nil, m.notMocked("CreateUser")
+}
+
+// SetUser implements kcc.KopanoClient.
+func (m *KopanoClient) SetUser(ctx context.Context, user *kcc.User, password string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error) {
+	m.record("SetUser")
+	if m.SetUserFunc != nil {
+		return m.SetUserFunc(ctx, user, password, sessionID)
+	}
+	return nil, m.notMocked("SetUser")
+}
+
+// DeleteUser implements kcc.KopanoClient.
+func (m *KopanoClient) DeleteUser(ctx context.Context, userEntryID string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error) {
+	m.record("DeleteUser")
+	if m.DeleteUserFunc != nil {
+		return m.DeleteUserFunc(ctx, userEntryID, sessionID)
+	}
+	return nil, m.notMocked("DeleteUser")
+}
+
+// SetQuota implements kcc.KopanoClient.
+func (m *KopanoClient) SetQuota(ctx context.Context, userEntryID string, quota *kcc.Quota, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error) {
+	m.record("SetQuota")
+	if m.SetQuotaFunc != nil {
+		return m.SetQuotaFunc(ctx, userEntryID, quota, sessionID)
+	}
+	return nil, m.notMocked("SetQuota")
+}
+
+// ListGroups implements kcc.KopanoClient.
+func (m *KopanoClient) ListGroups(ctx context.Context, companyEntryID string, sessionID kcc.KCSessionID) (*kcc.GetGroupListResponse, error) {
+	m.record("ListGroups")
+	if m.ListGroupsFunc != nil {
+		return m.ListGroupsFunc(ctx, companyEntryID, sessionID)
+	}
+	return nil, m.notMocked("ListGroups")
+}
+
+// CreateGroup implements kcc.KopanoClient.
+func (m *KopanoClient) CreateGroup(ctx context.Context, group *kcc.Group, sessionID kcc.KCSessionID) (*kcc.CreateGroupResponse, error) {
+	m.record("CreateGroup")
+	if m.CreateGroupFunc != nil {
+		return m.CreateGroupFunc(ctx, group, sessionID)
+	}
+	return nil, m.notMocked("CreateGroup")
+}
+
+// SetGroup implements kcc.KopanoClient.
+func (m *KopanoClient) SetGroup(ctx context.Context, group *kcc.Group, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error) {
+	m.record("SetGroup")
+	if m.SetGroupFunc != nil {
+		return m.SetGroupFunc(ctx, group, sessionID)
+	}
+	return nil, m.notMocked("SetGroup")
+}
+
+// DeleteGroup implements kcc.KopanoClient.
+func (m *KopanoClient) DeleteGroup(ctx context.Context, groupEntryID string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error) {
+	m.record("DeleteGroup")
+	if m.DeleteGroupFunc != nil {
+		return m.DeleteGroupFunc(ctx, groupEntryID, sessionID)
+	}
+	return nil, m.notMocked("DeleteGroup")
+}
+
+// ListGroupUsers implements kcc.KopanoClient.
+func (m *KopanoClient) ListGroupUsers(ctx context.Context, groupEntryID string, sessionID kcc.KCSessionID) (*kcc.GetUserListResponse, error) {
+	m.record("ListGroupUsers")
+	if m.ListGroupUsersFunc != nil {
+		return m.ListGroupUsersFunc(ctx, groupEntryID, sessionID)
+	}
+	return nil, m.notMocked("ListGroupUsers")
+}
+
+// AddGroupUser implements kcc.KopanoClient.
+func (m *KopanoClient) AddGroupUser(ctx context.Context, groupEntryID string, userEntryID string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error) {
+	m.record("AddGroupUser")
+	if m.AddGroupUserFunc != nil {
+		return m.AddGroupUserFunc(ctx, groupEntryID, userEntryID, sessionID)
+	}
+	return nil, m.notMocked("AddGroupUser")
+}
+
+// DeleteGroupUser implements kcc.KopanoClient.
+func (m *KopanoClient) DeleteGroupUser(ctx context.Context, groupEntryID string, userEntryID string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error) {
+	m.record("DeleteGroupUser")
+	if m.DeleteGroupUserFunc != nil {
+		return m.DeleteGroupUserFunc(ctx, groupEntryID, userEntryID, sessionID)
+	}
+	return nil, m.notMocked("DeleteGroupUser")
+}
+
+// SetUserAliases implements kcc.KopanoClient.
+func (m *KopanoClient) SetUserAliases(ctx context.Context, userEntryID string, aliases []string, sessionID kcc.KCSessionID) error {
+	m.record("SetUserAliases")
+	if m.SetUserAliasesFunc != nil {
+		return m.SetUserAliasesFunc(ctx, userEntryID, aliases, sessionID)
+	}
+	return m.notMocked("SetUserAliases")
+}
+
+// AddUserAliases implements kcc.KopanoClient.
+func (m *KopanoClient) AddUserAliases(ctx context.Context, userEntryID string, aliases []string, sessionID kcc.KCSessionID) error {
+	m.record("AddUserAliases")
+	if m.AddUserAliasesFunc != nil {
+		return m.AddUserAliasesFunc(ctx, userEntryID, aliases, sessionID)
+	}
+	return m.notMocked("AddUserAliases")
+}
+
+// RemoveUserAliases implements kcc.KopanoClient.
+func (m *KopanoClient) RemoveUserAliases(ctx context.Context, userEntryID string, aliases []string, sessionID kcc.KCSessionID) error {
+	m.record("RemoveUserAliases")
+	if m.RemoveUserAliasesFunc != nil {
+		return m.RemoveUserAliasesFunc(ctx, userEntryID, aliases, sessionID)
+	}
+	return m.notMocked("RemoveUserAliases")
+}
+
+// PurgeSoftDelete implements kcc.KopanoClient.
+func (m *KopanoClient) PurgeSoftDelete(ctx context.Context, days uint64, sessionID kcc.KCSessionID) (*kcc.PurgeResponse, error) {
+	m.record("PurgeSoftDelete")
+	if m.PurgeSoftDeleteFunc != nil {
+		return m.PurgeSoftDeleteFunc(ctx, days, sessionID)
+	}
+	return nil, m.notMocked("PurgeSoftDelete")
+}
+
+// PurgeDeferredUpdates implements kcc.KopanoClient.
+func (m *KopanoClient) PurgeDeferredUpdates(ctx context.Context, sessionID kcc.KCSessionID) (*kcc.PurgeDeferredUpdatesResponse, error) {
+	m.record("PurgeDeferredUpdates")
+	if m.PurgeDeferredUpdatesFunc != nil {
+		return m.PurgeDeferredUpdatesFunc(ctx, sessionID)
+	}
+	return nil, m.notMocked("PurgeDeferredUpdates")
+}
+
+// PurgeCache implements kcc.KopanoClient.
+func (m *KopanoClient) PurgeCache(ctx context.Context, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.PurgeResponse, error) {
+	m.record("PurgeCache")
+	if m.PurgeCacheFunc != nil {
+		return m.PurgeCacheFunc(ctx, flags, sessionID)
+	}
+	return nil, m.notMocked("PurgeCache")
+}
+
+// GetStore implements kcc.KopanoClient.
+func (m *KopanoClient) GetStore(ctx context.Context, storeEntryID string, sessionID kcc.KCSessionID) (*kcc.GetStoreResponse, error) {
+	m.record("GetStore")
+	if m.GetStoreFunc != nil {
+		return m.GetStoreFunc(ctx, storeEntryID, sessionID)
+	}
+	return nil, m.notMocked("GetStore")
+}
+
+// ResolveUserStore implements kcc.KopanoClient.
+func (m *KopanoClient) ResolveUserStore(ctx context.Context, username string, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.ResolveUserStoreResponse, error) {
+	m.record("ResolveUserStore")
+	if m.ResolveUserStoreFunc != nil {
+		return m.ResolveUserStoreFunc(ctx, username, flags, sessionID)
+	}
+	return nil, m.notMocked("ResolveUserStore")
+}
+
+// OpenStore implements kcc.KopanoClient.
+func (m *KopanoClient) OpenStore(ctx context.Context, storeEntryID string, sessionID kcc.KCSessionID) (*kcc.Store, error) {
+	m.record("OpenStore")
+	if m.OpenStoreFunc != nil {
+		return m.OpenStoreFunc(ctx, storeEntryID, sessionID)
+	}
+	return nil, m.notMocked("OpenStore")
+}
+
+// GetReceiveFolder implements kcc.KopanoClient.
+func (m *KopanoClient) GetReceiveFolder(ctx context.Context, storeEntryID string, messageClass string, sessionID kcc.KCSessionID) (*kcc.GetReceiveFolderResponse, error) {
+	m.record("GetReceiveFolder")
+	if m.GetReceiveFolderFunc != nil {
+		return m.GetReceiveFolderFunc(ctx, storeEntryID, messageClass, sessionID)
+	}
+	return nil, m.notMocked("GetReceiveFolder")
+}
+
+// OpenUserStore implements kcc.KopanoClient.
+func (m *KopanoClient) OpenUserStore(ctx context.Context, username string, sessionID kcc.KCSessionID) (*kcc.Store, error) {
+	m.record("OpenUserStore")
+	if m.OpenUserStoreFunc != nil {
+		return m.OpenUserStoreFunc(ctx, username, sessionID)
+	}
+	return nil, m.notMocked("OpenUserStore")
+}
+
+// DefaultFolderEntryID implements kcc.KopanoClient.
+func (m *KopanoClient) DefaultFolderEntryID(ctx context.Context, pt kcc.PT, sessionID kcc.KCSessionID) (string, error) {
+	m.record("DefaultFolderEntryID")
+	if m.DefaultFolderEntryIDFunc != nil {
+		return m.DefaultFolderEntryIDFunc(ctx, pt, sessionID)
+	}
+	return "", m.notMocked("DefaultFolderEntryID")
+}
+
+// ListFolders implements kcc.KopanoClient.
+func (m *KopanoClient) ListFolders(ctx context.Context, folderEntryID string, sessionID kcc.KCSessionID) ([]*kcc.Folder, error) {
+	m.record("ListFolders")
+	if m.ListFoldersFunc != nil {
+		return m.ListFoldersFunc(ctx, folderEntryID, sessionID)
+	}
+	return nil, m.notMocked("ListFolders")
+}
+
+// GetFolderStats implements kcc.KopanoClient.
+func (m *KopanoClient) GetFolderStats(ctx context.Context, folderEntryID string, sessionID kcc.KCSessionID) (*kcc.FolderStats, error) {
+	m.record("GetFolderStats")
+	if m.GetFolderStatsFunc != nil {
+		return m.GetFolderStatsFunc(ctx, folderEntryID, sessionID)
+	}
+	return nil, m.notMocked("GetFolderStats")
+}
+
+// GetStoreStats implements kcc.KopanoClient.
+func (m *KopanoClient) GetStoreStats(ctx context.Context, store *kcc.Store, sessionID kcc.KCSessionID) (*kcc.StoreStats, error) {
+	m.record("GetStoreStats")
+	if m.GetStoreStatsFunc != nil {
+		return m.GetStoreStatsFunc(ctx, store, sessionID)
+	}
+	return nil, m.notMocked("GetStoreStats")
+}
+
+// LoadObject implements kcc.KopanoClient.
+func (m *KopanoClient) LoadObject(ctx context.Context, entryID string, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.LoadObjectResponse, error) {
+	m.record("LoadObject")
+	if m.LoadObjectFunc != nil {
+		return m.LoadObjectFunc(ctx, entryID, flags, sessionID)
+	}
+	return nil, m.notMocked("LoadObject")
+}
+
+// GetProps implements kcc.KopanoClient.
+func (m *KopanoClient) GetProps(ctx context.Context, entryID string, props []kcc.PT, sessionID kcc.KCSessionID) ([]*kcc.PropTagRowSetValue, error) {
+	m.record("GetProps")
+	if m.GetPropsFunc != nil {
+		return m.GetPropsFunc(ctx, entryID, props, sessionID)
+	}
+	return nil, m.notMocked("GetProps")
+}
+
+// SaveObject implements kcc.KopanoClient.
+func (m *KopanoClient) SaveObject(ctx context.Context, parentEntryID string, entryID string, object *kcc.SaveObject, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.LoadObjectResponse, error) {
+	m.record("SaveObject")
+	if m.SaveObjectFunc != nil {
+		return m.SaveObjectFunc(ctx, parentEntryID, entryID, object, flags, sessionID)
+	}
+	return nil, m.notMocked("SaveObject")
+}
+
+// SubmitMessage implements kcc.KopanoClient.
+func (m *KopanoClient) SubmitMessage(ctx context.Context, entryID string, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.SubmitMessageResponse, error) {
+	m.record("SubmitMessage")
+	if m.SubmitMessageFunc != nil {
+		return m.SubmitMessageFunc(ctx, entryID, flags, sessionID)
+	}
+	return nil, m.notMocked("SubmitMessage")
+}
+
+// DeleteObjects implements kcc.KopanoClient.
+func (m *KopanoClient) DeleteObjects(ctx context.Context, entryIDs []string, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.DeleteObjectsResponse, error) {
+	m.record("DeleteObjects")
+	if m.DeleteObjectsFunc != nil {
+		return m.DeleteObjectsFunc(ctx, entryIDs, flags, sessionID)
+	}
+	return nil, m.notMocked("DeleteObjects")
+}
+
+// GetIDsFromNames implements kcc.KopanoClient.
+func (m *KopanoClient) GetIDsFromNames(ctx context.Context, names []*kcc.NamedProp, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.GetIDsFromNamesResponse, error) {
+	m.record("GetIDsFromNames")
+	if m.GetIDsFromNamesFunc != nil {
+		return m.GetIDsFromNamesFunc(ctx, names, flags, sessionID)
+	}
+	return nil, m.notMocked("GetIDsFromNames")
+}
+
+// NamedPropTags implements kcc.KopanoClient.
+func (m *KopanoClient) NamedPropTags(ctx context.Context, sessionID kcc.KCSessionID, names ...*kcc.NamedProp) ([]kcc.PT, error) {
+	m.record("NamedPropTags")
+	if m.NamedPropTagsFunc != nil {
+		return m.NamedPropTagsFunc(ctx, sessionID, names...)
+	}
+	return nil, m.notMocked("NamedPropTags")
+}
+
+// TableOpen implements kcc.KopanoClient.
+func (m *KopanoClient) TableOpen(ctx context.Context, entryID string, tableType kcc.TableType, objType kcc.MAPIType, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.TableOpenResponse, error) {
+	m.record("TableOpen")
+	if m.TableOpenFunc != nil {
+		return m.TableOpenFunc(ctx, entryID, tableType, objType, flags, sessionID)
+	}
+	return nil, m.notMocked("TableOpen")
+}
+
+// TableSetColumns implements kcc.KopanoClient.
+func (m *KopanoClient) TableSetColumns(ctx context.Context, tableID uint64, props []kcc.PT, sessionID kcc.KCSessionID) (*kcc.TableResponse, error) {
+	m.record("TableSetColumns")
+	if m.TableSetColumnsFunc != nil {
+		return m.TableSetColumnsFunc(ctx, tableID, props, sessionID)
+	}
+	return nil, m.notMocked("TableSetColumns")
+}
+
+// TableQueryRows implements kcc.KopanoClient.
+func (m *KopanoClient) TableQueryRows(ctx context.Context, tableID uint64, rowCount uint64, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.TableQueryRowsResponse, error) {
+	m.record("TableQueryRows")
+	if m.TableQueryRowsFunc != nil {
+		return m.TableQueryRowsFunc(ctx, tableID, rowCount, flags, sessionID)
+	}
+	return nil, m.notMocked("TableQueryRows")
+}
+
+// TableQueryRowsStream implements kcc.KopanoClient.
+func (m *KopanoClient) TableQueryRowsStream(ctx context.Context, tableID uint64, rowCount uint64, flags kcc.KCFlag, sessionID kcc.KCSessionID, cb func(*kcc.PropTagRowSet) error) (*kcc.TableQueryRowsStreamResponse, error) {
+	m.record("TableQueryRowsStream")
+	if m.TableQueryRowsStreamFunc != nil {
+		return m.TableQueryRowsStreamFunc(ctx, tableID, rowCount, flags, sessionID, cb)
+	}
+	return nil, m.notMocked("TableQueryRowsStream")
+}
+
+// TableClose implements kcc.KopanoClient.
+func (m *KopanoClient) TableClose(ctx context.Context, tableID uint64, sessionID kcc.KCSessionID) (*kcc.TableResponse, error) {
+	m.record("TableClose")
+	if m.TableCloseFunc != nil {
+		return m.TableCloseFunc(ctx, tableID, sessionID)
+	}
+	return nil, m.notMocked("TableClose")
+}
+
+// QueryTableRows implements kcc.KopanoClient.
+func (m *KopanoClient) QueryTableRows(ctx context.Context, entryID string, tableType kcc.TableType, objType kcc.MAPIType, flags kcc.KCFlag, props []kcc.PT, sessionID kcc.KCSessionID, cb func([]*kcc.PropTagRowSet) error) error {
+	m.record("QueryTableRows")
+	if m.QueryTableRowsFunc != nil {
+		return m.QueryTableRowsFunc(ctx, entryID, tableType, objType, flags, props, sessionID, cb)
+	}
+	return m.notMocked("QueryTableRows")
+}
+
+// QueryTableRowsStream implements kcc.KopanoClient.
+func (m *KopanoClient) QueryTableRowsStream(ctx context.Context, entryID string, tableType kcc.TableType, objType kcc.MAPIType, flags kcc.KCFlag, props []kcc.PT, sessionID kcc.KCSessionID, cb func(*kcc.PropTagRowSet) error) error {
+	m.record("QueryTableRowsStream")
+	if m.QueryTableRowsStreamFunc != nil {
+		return m.QueryTableRowsStreamFunc(ctx, entryID, tableType, objType, flags, props, sessionID, cb)
+	}
+	return m.notMocked("QueryTableRowsStream")
+}
+
+// SetSyncStatus implements kcc.KopanoClient.
+func (m *KopanoClient) SetSyncStatus(ctx context.Context, folderSourceKey string, syncID uint64, changeID uint64, syncType kcc.KCFlag, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.SetSyncStatusResponse, error) {
+	m.record("SetSyncStatus")
+	if m.SetSyncStatusFunc != nil {
+		return m.SetSyncStatusFunc(ctx, folderSourceKey, syncID, changeID, syncType, flags, sessionID)
+	}
+	return nil, m.notMocked("SetSyncStatus")
+}
+
+// GetChanges implements kcc.KopanoClient.
+func (m *KopanoClient) GetChanges(ctx context.Context, folderSourceKey string, syncID uint64, changeID uint64, syncType kcc.KCFlag, flags kcc.KCFlag, sessionID kcc.KCSessionID) (*kcc.GetChangesResponse, error) {
+	m.record("GetChanges")
+	if m.GetChangesFunc != nil {
+		return m.GetChangesFunc(ctx, folderSourceKey, syncID, changeID, syncType, flags, sessionID)
+	}
+	return nil, m.notMocked("GetChanges")
+}
+
+// GetEntryIDFromSourceKey implements kcc.KopanoClient.
+func (m *KopanoClient) GetEntryIDFromSourceKey(ctx context.Context, storeEntryID string, folderSourceKey string, messageSourceKey string, sessionID kcc.KCSessionID) (*kcc.GetEntryIDFromSourceKeyResponse, error) {
+	m.record("GetEntryIDFromSourceKey")
+	if m.GetEntryIDFromSourceKeyFunc != nil {
+		return m.GetEntryIDFromSourceKeyFunc(ctx, storeEntryID, folderSourceKey, messageSourceKey, sessionID)
+	}
+	return nil, m.notMocked("GetEntryIDFromSourceKey")
+}
+
+// SyncContents implements kcc.KopanoClient.
+func (m *KopanoClient) SyncContents(ctx context.Context, folderSourceKey string, state *kcc.ICSState, sessionID kcc.KCSessionID) ([]*kcc.ICSChange, *kcc.ICSState, error) {
+	m.record("SyncContents")
+	if m.SyncContentsFunc != nil {
+		return m.SyncContentsFunc(ctx, folderSourceKey, state, sessionID)
+	}
+	return nil, nil, m.notMocked("SyncContents")
+}
+
+// ListItems implements kcc.KopanoClient.
+func (m *KopanoClient) ListItems(ctx context.Context, folderEntryID string, sessionID kcc.KCSessionID) ([]*kcc.Item, error) {
+	m.record("ListItems")
+	if m.ListItemsFunc != nil {
+		return m.ListItemsFunc(ctx, folderEntryID, sessionID)
+	}
+	return nil, m.notMocked("ListItems")
+}
+
+// SendMessage implements kcc.KopanoClient.
+func (m *KopanoClient) SendMessage(ctx context.Context, props []*kcc.PropTagRowSetValue, recipients []*kcc.Recipient, sessionID kcc.KCSessionID) (string, error) {
+	m.record("SendMessage")
+	if m.SendMessageFunc != nil {
+		return m.SendMessageFunc(ctx, props, recipients, sessionID)
+	}
+	return "", m.notMocked("SendMessage")
+}
+
+// CreateMessage implements kcc.KopanoClient.
+func (m *KopanoClient) CreateMessage(ctx context.Context, folderEntryID string, props []*kcc.PropTagRowSetValue, recipients []*kcc.Recipient, sessionID kcc.KCSessionID) (string, error) {
+	m.record("CreateMessage")
+	if m.CreateMessageFunc != nil {
+		return m.CreateMessageFunc(ctx, folderEntryID, props, recipients, sessionID)
+	}
+	return "", m.notMocked("CreateMessage")
+}
+
+// ImportMessage implements kcc.KopanoClient.
+func (m *KopanoClient) ImportMessage(ctx context.Context, folderEntryID string, message *kcc.ImportMessage, sessionID kcc.KCSessionID) (string, error) {
+	m.record("ImportMessage")
+	if m.ImportMessageFunc != nil {
+		return m.ImportMessageFunc(ctx, folderEntryID, message, sessionID)
+	}
+	return "", m.notMocked("ImportMessage")
+}
+
+// ListContacts implements kcc.KopanoClient.
+func (m *KopanoClient) ListContacts(ctx context.Context, folderEntryID string, sessionID kcc.KCSessionID) ([]*kcc.Contact, error) {
+	m.record("ListContacts")
+	if m.ListContactsFunc != nil {
+		return m.ListContactsFunc(ctx, folderEntryID, sessionID)
+	}
+	return nil, m.notMocked("ListContacts")
+}
+
+// GetContact implements kcc.KopanoClient.
+func (m *KopanoClient) GetContact(ctx context.Context, entryID string, sessionID kcc.KCSessionID) (*kcc.Contact, error) {
+	m.record("GetContact")
+	if m.GetContactFunc != nil {
+		return m.GetContactFunc(ctx, entryID, sessionID)
+	}
+	return nil, m.notMocked("GetContact")
+}
+
+// CreateContact implements kcc.KopanoClient.
+func (m *KopanoClient) CreateContact(ctx context.Context, folderEntryID string, contact *kcc.Contact, sessionID kcc.KCSessionID) (string, error) {
+	m.record("CreateContact")
+	if m.CreateContactFunc != nil {
+		return m.CreateContactFunc(ctx, folderEntryID, contact, sessionID)
+	}
+	return "", m.notMocked("CreateContact")
+}
+
+// UpdateContact implements kcc.KopanoClient.
+func (m *KopanoClient) UpdateContact(ctx context.Context, contact *kcc.Contact, sessionID kcc.KCSessionID) error {
+	m.record("UpdateContact")
+	if m.UpdateContactFunc != nil {
+		return m.UpdateContactFunc(ctx, contact, sessionID)
+	}
+	return m.notMocked("UpdateContact")
+}
+
+// DeleteContact implements kcc.KopanoClient.
+func (m *KopanoClient) DeleteContact(ctx context.Context, entryID string, sessionID kcc.KCSessionID) error {
+	m.record("DeleteContact")
+	if m.DeleteContactFunc != nil {
+		return m.DeleteContactFunc(ctx, entryID, sessionID)
+	}
+	return m.notMocked("DeleteContact")
+}
+
+// ListEvents implements kcc.KopanoClient.
+func (m *KopanoClient) ListEvents(ctx context.Context, folderEntryID string, sessionID kcc.KCSessionID) ([]*kcc.Event, error) {
+	m.record("ListEvents")
+	if m.ListEventsFunc != nil {
+		return m.ListEventsFunc(ctx, folderEntryID, sessionID)
+	}
+	return nil, m.notMocked("ListEvents")
+}
+
+// GetMeetingRequest implements kcc.KopanoClient.
+func (m *KopanoClient) GetMeetingRequest(ctx context.Context, entryID string, sessionID kcc.KCSessionID) (*kcc.MeetingRequest, error) {
+	m.record("GetMeetingRequest")
+	if m.GetMeetingRequestFunc != nil {
+		return m.GetMeetingRequestFunc(ctx, entryID, sessionID)
+	}
+	return nil, m.notMocked("GetMeetingRequest")
+}
+
+// RespondToMeetingRequest implements kcc.KopanoClient.
+func (m *KopanoClient) RespondToMeetingRequest(ctx context.Context, request *kcc.MeetingRequest, response kcc.MeetingResponse, body string, sessionID kcc.KCSessionID) error {
+	m.record("RespondToMeetingRequest")
+	if m.RespondToMeetingRequestFunc != nil {
+		return m.RespondToMeetingRequestFunc(ctx, request, response, body, sessionID)
+	}
+	return m.notMocked("RespondToMeetingRequest")
+}
+
+// AcceptMeetingRequest implements kcc.KopanoClient.
+func (m *KopanoClient) AcceptMeetingRequest(ctx context.Context, entryID string, body string, sessionID kcc.KCSessionID) error {
+	m.record("AcceptMeetingRequest")
+	if m.AcceptMeetingRequestFunc != nil {
+		return m.AcceptMeetingRequestFunc(ctx, entryID, body, sessionID)
+	}
+	return m.notMocked("AcceptMeetingRequest")
+}
+
+// TentativelyAcceptMeetingRequest implements kcc.KopanoClient.
+func (m *KopanoClient) TentativelyAcceptMeetingRequest(ctx context.Context, entryID string, body string, sessionID kcc.KCSessionID) error {
+	m.record("TentativelyAcceptMeetingRequest")
+	if m.TentativelyAcceptMeetingRequestFunc != nil {
+		return m.TentativelyAcceptMeetingRequestFunc(ctx, entryID, body, sessionID)
+	}
+	return m.notMocked("TentativelyAcceptMeetingRequest")
+}
+
+// DeclineMeetingRequest implements kcc.KopanoClient.
+func (m *KopanoClient) DeclineMeetingRequest(ctx context.Context, entryID string, body string, sessionID kcc.KCSessionID) error {
+	m.record("DeclineMeetingRequest")
+	if m.DeclineMeetingRequestFunc != nil {
+		return m.DeclineMeetingRequestFunc(ctx, entryID, body, sessionID)
+	}
+	return m.notMocked("DeclineMeetingRequest")
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mock
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+func TestKopanoClient(t *testing.T) {
+	m := &KopanoClient{
+		LogonFunc: func(ctx context.Context, username, password string, logonFlags kcc.KCFlag) (*kcc.LogonResponse, error) {
+			return &kcc.LogonResponse{
+				SessionID: 1,
+			}, nil
+		},
+	}
+
+	var c kcc.KopanoClient = m
+	resp, err := c.Logon(context.Background(), "user1", "pass", 0)
+	if err != nil || resp.SessionID != 1 {
+		t.Errorf("unexpected logon result: %v, %v", resp, err)
+	}
+
+	_, err = c.Logoff(context.Background(), 1)
+	if nmErr, ok := err.(*NotMockedError); !ok || nmErr.Method != "Logoff" {
+		t.Errorf("unexpected logoff error: %v", err)
+	}
+
+	if calls := strings.Join(m.Calls(), ","); calls != "Logon,Logoff" {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+	m.ResetCalls()
+	if len(m.Calls()) != 0 {
+		t.Errorf("calls not reset")
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mock
+
+import (
+	"sync"
+)
+
+// A NotMockedError is returned by mock methods which have no function set.
+type NotMockedError struct {
+	Method string
+}
+
+func (err *NotMockedError) Error() string {
+	return "mock: " + err.Method + " not mocked"
+}
+
+// A callRecorder records the names of called methods in order. It is safe
+// for concurrent use.
+type callRecorder struct {
+	mutex sync.Mutex
+	calls []string
+}
+
+func (cr *callRecorder) record(method string) {
+	cr.mutex.Lock()
+	cr.calls = append(cr.calls, method)
+	cr.mutex.Unlock()
+}
+
+func (cr *callRecorder) notMocked(method string) error {
+	return &NotMockedError{
+		Method: method,
+	}
+}
+
+// Calls returns the names of all methods called so far in order.
+func (cr *callRecorder) Calls() []string {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	return append([]string(nil), cr.calls...)
+}
+
+// ResetCalls forgets all recorded calls.
+func (cr *callRecorder) ResetCalls() {
+	cr.mutex.Lock()
+	cr.calls = nil
+	cr.mutex.Unlock()
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mock
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+const (
+	soapEnvelopeStart = `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/" xmlns:SOAP-ENC="http://schemas.xmlsoap.org/soap/encoding/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:ns="urn:zarafa"><SOAP-ENV:Body>`
+	soapEnvelopeEnd = `</SOAP-ENV:Body></SOAP-ENV:Envelope>`
+)
+
+// A SOAPRequest is a request recorded by SOAPClient.
+type SOAPRequest struct {
+	// Action is the SOAP action of the request, for example "logon".
+	Action string
+	// Payload is the SOAP body of the request as passed to DoRequest.
+	Payload string
+}
+
+type soapResponse struct {
+	body string
+	err  error
+}
+
+// SOAPClient is a mock implementation of kcc.SOAPClient, so code using
+// kcc.KCC can be tested without a Kopano server. Requests are answered with
+// the responses set for their SOAP action with Respond and RespondError.
+// Multiple responses of the same action are returned in order, the last one
+// is repeated. Requests of actions without response fail with a
+// NotMockedError. Requests sent with kcc.DoRequestRaw get the response
+// envelope as body. All requests are recorded and can be inspected with
+// Requests. A SOAPClient is safe for concurrent use.
+type SOAPClient struct {
+	mutex     sync.Mutex
+	responses map[string][]*soapResponse
+	requests  []*SOAPRequest
+}
+
+// Make sure SOAPClient implements kcc.SOAPClient.
+var _ kcc.SOAPClient = (*SOAPClient)(nil)
+
+// NewSOAPClient creates a new SOAPClient without responses.
+func NewSOAPClient() *SOAPClient {
+	return &SOAPClient{
+		responses: make(map[string][]*soapResponse),
+	}
+}
+
+// Respond adds the provided SOAP body as response to requests with the
+// provided SOAP action. The body is the response element, for example
+// "<ns:logonResponse><er>0</er></ns:logonResponse>", or a full SOAP envelope.
+func (m *SOAPClient) Respond(action string, body string) *SOAPClient {
+	return m.add(action, &soapResponse{body: body})
+}
+
+// RespondError adds the provided error as response to requests with the
+// provided SOAP action, to simulate network failures or unexpected HTTP
+// status for example with a *kcc.HTTPStatusError.
+func (m *SOAPClient) RespondError(action string, err error) *SOAPClient {
+	return m.add(action, &soapResponse{err: err})
+}
+
+func (m *SOAPClient) add(action string, response *soapResponse) *SOAPClient {
+	m.mutex.Lock()
+	m.responses[action] = append(m.responses[action], response)
+	m.mutex.Unlock()
+
+	return m
+}
+
+// DoRequest implements kcc.SOAPClient.
+func (m *SOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	action := kcc.SOAPAction(*payload)
+
+	m.mutex.Lock()
+	m.requests = append(m.requests, &SOAPRequest{
+		Action:  action,
+		Payload: *payload,
+	})
+	var response *soapResponse
+	if responses := m.responses[action]; len(responses) > 0 {
+		response = responses[0]
+		if len(responses) > 1 {
+			m.responses[action] = responses[1:]
+		}
+	}
+	m.mutex.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if response == nil {
+		return &NotMockedError{
+			Method: action,
+		}
+	}
+	if response.err != nil {
+		return response.err
+	}
+
+	body := response.body
+	if !strings.HasPrefix(strings.TrimSpace(body), "<?xml") && !strings.Contains(body, "Envelope") {
+		body = soapEnvelopeStart + body + soapEnvelopeEnd
+	}
+	if raw, ok := v.(*kcc.RawResponse); ok {
+		raw.StatusCode = http.StatusOK
+		raw.Header = http.Header{"Content-Type": []string{"text/xml; charset=utf-8"}}
+		raw.Body = ioutil.NopCloser(strings.NewReader(body))
+		return nil
+	}
+	return kcc.DecodeSOAPResponse(strings.NewReader(body), v)
+}
+
+// Requests returns all requests made so far in order.
+func (m *SOAPClient) Requests() []*SOAPRequest {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]*SOAPRequest(nil), m.requests...)
+}
+
+// ResetRequests forgets all recorded requests.
+func (m *SOAPClient) ResetRequests() {
+	m.mutex.Lock()
+	m.requests = nil
+	m.mutex.Unlock()
+}
+
+func (m *SOAPClient) String() string {
+	return "<mock>"
+}
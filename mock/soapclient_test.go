@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mock
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+func TestSOAPClient(t *testing.T) {
+	failure := errors.New("connection reset")
+	m := NewSOAPClient().
+		RespondError("logon", failure).
+		Respond("logon", "<ns:logonResponse><er>0</er><ulSessionId>42</ulSessionId></ns:logonResponse>").
+		Respond("getUserList", "<ns:getUserListResponse><sUserArray>"+
+			"<item><lpszUsername>user1</lpszUsername></item>"+
+			"<item><lpszUsername>user2</lpszUsername></item>"+
+			"</sUserArray><er>0</er></ns:getUserListResponse>")
+	c := kcc.NewKCCWithClient(m)
+
+	if _, err := c.Logon(context.Background(), "user1", "pass", 0); err != failure {
+		t.Errorf("expected injected error, got: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := c.Logon(context.Background(), "user1", "pass", 0)
+		if err != nil || resp.SessionID != 42 {
+			t.Errorf("unexpected logon result: %v, %v", resp, err)
+		}
+	}
+
+	var usernames []string
+	err := c.ListUsers(context.Background(), "", 42, func(user *kcc.User) error {
+		usernames = append(usernames, user.Username)
+		return nil
+	})
+	if err != nil || strings.Join(usernames, ",") != "user1,user2" {
+		t.Errorf("unexpected users: %v, %v", usernames, err)
+	}
+
+	_, err = c.Logoff(context.Background(), 42)
+	if nmErr, ok := err.(*NotMockedError); !ok || nmErr.Method != "logoff" {
+		t.Errorf("unexpected logoff error: %v", err)
+	}
+
+	requests := m.Requests()
+	actions := make([]string, len(requests))
+	for idx, request := range requests {
+		actions[idx] = request.Action
+	}
+	if strings.Join(actions, ",") != "logon,logon,logon,getUserList,logoff" {
+		t.Errorf("unexpected requests: %v", actions)
+	}
+	if !strings.Contains(requests[0].Payload, "<szUsername>user1</szUsername>") {
+		t.Errorf("unexpected payload: %s", requests[0].Payload)
+	}
+	m.ResetRequests()
+	if len(m.Requests()) != 0 {
+		t.Errorf("requests not reset")
+	}
+}
+
+func TestSOAPClientRaw(t *testing.T) {
+	m := NewSOAPClient().
+		Respond("logon", "<ns:logonResponse><er>0</er><ulSessionId>42</ulSessionId></ns:logonResponse>")
+
+	payload := "<ns:logon></ns:logon>"
+	raw, err := kcc.DoRequestRaw(context.Background(), m, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Body.Close()
+	var resp kcc.LogonResponse
+	if err := kcc.DecodeSOAPResponse(raw.Body, &resp); err != nil || resp.SessionID != 42 {
+		t.Errorf("unexpected raw logon result: %v, %v", resp, err)
+	}
+}
@@ -51,6 +51,166 @@ type ABResolveNamesResponse struct {
 	Flags  []ABFlag         `xml:"aFlags>item"`
 }
 
+// A GetCompanyResponse holds the returned data of a SOAP request which fetches
+// company detail meta data.
+type GetCompanyResponse struct {
+	Er      KCError  `xml:"er"`
+	Company *Company `xml:"lpsCompany"`
+}
+
+// A CreateUserResponse holds the returned data of a SOAP request which
+// creates a user.
+type CreateUserResponse struct {
+	Er          KCError `xml:"er"`
+	ID          uint64  `xml:"ulUserId"`
+	UserEntryID string  `xml:"sUserId"`
+}
+
+// A UserAdminResponse holds the returned data of SOAP requests which change
+// users or their quota. These requests return their error code as result.
+type UserAdminResponse struct {
+	Er KCError `xml:"result"`
+}
+
+// A GetIDsFromNamesResponse holds the returned data of a SOAP request which
+// resolves named properties to property IDs.
+type GetIDsFromNamesResponse struct {
+	Er      KCError  `xml:"er"`
+	PropIDs []uint64 `xml:"lpsPropTags>item"`
+}
+
+// A GetStoreResponse holds the returned data of a SOAP request which opens a
+// store.
+type GetStoreResponse struct {
+	Er           KCError `xml:"er"`
+	StoreEntryID string  `xml:"sStoreId"`
+	RootEntryID  string  `xml:"sRootId"`
+	GUID         string  `xml:"guid"`
+	ServerPath   string  `xml:"lpszServerPath"`
+}
+
+// A LoadObjectResponse holds the returned data of a SOAP request which loads
+// or saves an object including its properties and child objects.
+type LoadObjectResponse struct {
+	Er     KCError     `xml:"er"`
+	Object *SaveObject `xml:"sSaveObject"`
+}
+
+// A SubmitMessageResponse holds the returned data of a SOAP request which
+// submits a message for sending.
+type SubmitMessageResponse struct {
+	Er KCError `xml:"er"`
+}
+
+// A ResolveUserStoreResponse holds the returned data of a SOAP request which
+// resolves the store of a user.
+type ResolveUserStoreResponse struct {
+	Er           KCError `xml:"er"`
+	StoreEntryID string  `xml:"lpsStoreId"`
+	GUID         string  `xml:"guid"`
+	ServerPath   string  `xml:"lpszServerPath"`
+}
+
+// A GetReceiveFolderResponse holds the returned data of a SOAP request which
+// resolves the receive folder of a store.
+type GetReceiveFolderResponse struct {
+	Er            KCError `xml:"er"`
+	EntryID       string  `xml:"sReceiveFolder>sEntryId"`
+	ExplicitClass string  `xml:"sReceiveFolder>lpszAExplicitClass"`
+}
+
+// A DeleteObjectsResponse holds the returned data of a SOAP request which
+// deletes objects.
+type DeleteObjectsResponse struct {
+	Er KCError `xml:"er"`
+}
+
+// A PurgeResponse holds the returned data of SOAP requests which purge data
+// on the server. These requests return their error code as result.
+type PurgeResponse struct {
+	Er KCError `xml:"result"`
+}
+
+// A PurgeDeferredUpdatesResponse holds the returned data of a SOAP request
+// which purges deferred updates.
+type PurgeDeferredUpdatesResponse struct {
+	Er                KCError `xml:"er"`
+	DeferredRemaining uint64  `xml:"ulDeferredRemaining"`
+}
+
+// A SetSyncStatusResponse holds the returned data of a SOAP request which
+// registers an ICS sync status.
+type SetSyncStatusResponse struct {
+	Er     KCError `xml:"er"`
+	SyncID uint64  `xml:"ulSyncId"`
+}
+
+// A GetChangesResponse holds the returned data of a SOAP request which fetches
+// ICS changes.
+type GetChangesResponse struct {
+	Er          KCError      `xml:"er"`
+	Changes     []*ICSChange `xml:"sChangesArray>item"`
+	MaxChangeID uint64       `xml:"ulMaxChangeId"`
+}
+
+// An ICSChange is a single change as returned by ICS.
+type ICSChange struct {
+	ChangeID        uint64 `xml:"ulChangeId" json:"changeID"`
+	SourceKey       string `xml:"sSourceKey" json:"sourceKey"`
+	ParentSourceKey string `xml:"sParentSourceKey" json:"parentSourceKey"`
+	ChangeType      KCFlag `xml:"ulChangeType" json:"changeType"`
+	Flags           KCFlag `xml:"ulFlags" json:"flags"`
+}
+
+// A GetEntryIDFromSourceKeyResponse holds the returned data of a SOAP request
+// which resolves a source key to an Entry ID.
+type GetEntryIDFromSourceKeyResponse struct {
+	Er      KCError `xml:"er"`
+	EntryID string  `xml:"sEntryId"`
+}
+
+// A TableOpenResponse holds the returned data of a SOAP request which opens
+// a table.
+type TableOpenResponse struct {
+	Er      KCError `xml:"er"`
+	TableID uint64  `xml:"ulTableId"`
+}
+
+// A TableResponse holds the returned data of SOAP table requests which only
+// return an error code.
+type TableResponse struct {
+	Er KCError `xml:"er"`
+}
+
+// A GetGroupListResponse holds the returned data of a SOAP request which lists
+// groups.
+type GetGroupListResponse struct {
+	Er     KCError  `xml:"er"`
+	Groups []*Group `xml:"sGroupArray>item"`
+}
+
+// A CreateGroupResponse holds the returned data of a SOAP createGroup
+// request.
+type CreateGroupResponse struct {
+	Er           KCError `xml:"er"`
+	ID           uint64  `xml:"ulGroupId"`
+	GroupEntryID string  `xml:"sGroupId"`
+}
+
+// A GetUserListResponse holds the returned data of a SOAP request which lists
+// users without streaming them.
+type GetUserListResponse struct {
+	Er    KCError `xml:"er"`
+	Users []*User `xml:"sUserArray>item"`
+}
+
+// A TableQueryRowsResponse holds the returned data of a SOAP request which
+// fetches table rows.
+type TableQueryRowsResponse struct {
+	Er     KCError          `xml:"er"`
+	RowSet []*PropTagRowSet `xml:"sRowSet>item"`
+}
+
 // A User represents the meta data of a user as stored by Kopano server.
 type User struct {
 	ID          uint64     `xml:"ulUserId" json:"ulUserID"`
@@ -62,6 +222,36 @@ type User struct {
 	UserEntryID string     `xml:"sUserId" json:"sUserId"`
 	Props       *PropMap   `xml:"lpsPropmap>item" json:"lpsPropmap"`
 	MVProps     *MVPropMap `xml:"lpsMVPropmap>item" json:"lpsMVPropmap"`
+
+	// Fields not exposed as JSON, kept so SetUser does not reset them.
+	IsABHidden uint64 `xml:"ulIsABHidden" json:"-"`
+	Capacity   uint64 `xml:"ulCapacity" json:"-"`
+	ObjClass   KCFlag `xml:"ulObjClass" json:"-"`
+}
+
+// A Group represents the meta data of a group as stored by Kopano server.
+type Group struct {
+	ID           uint64     `xml:"ulGroupId" json:"ulGroupID"`
+	Groupname    string     `xml:"lpszGroupname" json:"lpszGroupname"`
+	FullName     string     `xml:"lpszFullname" json:"lpszFullname"`
+	MailAddress  string     `xml:"lpszFullEmail" json:"lpszFullEmail"`
+	IsABHidden   uint64     `xml:"ulIsABHidden" json:"ulIsABHidden"`
+	GroupEntryID string     `xml:"sGroupId" json:"sGroupId"`
+	Props        *PropMap   `xml:"lpsPropmap>item" json:"lpsPropmap"`
+	MVProps      *MVPropMap `xml:"lpsMVPropmap>item" json:"lpsMVPropmap"`
+}
+
+// A Company represents the meta data of a company as stored by Kopano server
+// in multi-tenant setups.
+type Company struct {
+	ID                   uint64     `xml:"ulCompanyId" json:"ulCompanyID"`
+	Name                 string     `xml:"lpszCompanyname" json:"lpszCompanyname"`
+	AdministratorID      uint64     `xml:"ulAdministrator" json:"ulAdministrator"`
+	AdministratorEntryID string     `xml:"sAdministrator" json:"sAdministrator"`
+	IsABHidden           uint64     `xml:"ulIsABHidden" json:"ulIsABHidden"`
+	CompanyEntryID       string     `xml:"sCompanyId" json:"sCompanyId"`
+	Props                *PropMap   `xml:"lpsPropmap>item" json:"lpsPropmap"`
+	MVProps              *MVPropMap `xml:"lpsMVPropmap>item" json:"lpsMVPropmap"`
 }
 
 // A PropMap is a mapping of property IDs to a value.
@@ -118,4 +308,32 @@ type PropTagRowSetValue struct {
 	ULValue      uint64     `xml:"ul" json:"ul,omitempty"`
 	BinValue     []byte     `xml:"bin" json:"bin,omitempty"`
 	BinValues    [][][]byte `xml:"mvbin>item" json:"mvbin,omitempty"`
+
+	I16Value      int16     `xml:"i" json:"i,omitempty"`
+	FltValue      float32   `xml:"flt" json:"flt,omitempty"`
+	DblValue      float64   `xml:"dbl" json:"dbl,omitempty"`
+	BoolValue     bool      `xml:"b" json:"b,omitempty"`
+	LIValue       int64     `xml:"li" json:"li,omitempty"`
+	HiLoValue     *HiLoLong `xml:"hilo" json:"hilo,omitempty"`
+	AStringValues []string  `xml:"mvszA>item" json:"mvszA,omitempty"`
+	ULValues      []uint64  `xml:"mvl>item" json:"mvl,omitempty"`
+}
+
+// A SaveObject represents an object with its properties and child objects as
+// transported when loading and saving objects.
+type SaveObject struct {
+	Children []*SaveObject         `xml:"item" json:"children,omitempty"`
+	DelProps []PT                  `xml:"delProps>item" json:"delProps,omitempty"`
+	ModProps []*PropTagRowSetValue `xml:"modProps>item" json:"modProps"`
+	Delete   bool                  `xml:"bDelete" json:"bDelete"`
+	ClientID uint64                `xml:"ulClientId" json:"ulClientId"`
+	ServerID uint64                `xml:"ulServerId" json:"ulServerId"`
+	ObjType  MAPIType              `xml:"ulObjType" json:"ulObjType"`
+}
+
+// Props returns the accociated SaveObject's properties as PropTagRowSet.
+func (so *SaveObject) Props() *PropTagRowSet {
+	return &PropTagRowSet{
+		PropTagValues: so.ModProps,
+	}
 }
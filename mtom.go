@@ -0,0 +1,270 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// mtomRootContentID is the Content-ID of the SOAP envelope part of MTOM
+// requests.
+const mtomRootContentID = "root.message@kcc-go"
+
+// errMTOMUnsupported is returned by SOAP socket clients for requests with
+// MTOM attachments, since they send the SOAP envelope without HTTP headers.
+var errMTOMUnsupported = errors.New("MTOM attachments are not supported by SOAP socket clients")
+
+// A SOAPAttachment is a binary MTOM attachment of a SOAP message, referenced
+// from the SOAP envelope with xop:Include by its ContentID.
+type SOAPAttachment struct {
+	ContentID   string
+	ContentType string
+	Body        io.Reader
+}
+
+// A SOAPAttachmentFunc is called for every MTOM attachment of a SOAP
+// response. The Body of the attachment is only valid during the call.
+type SOAPAttachmentFunc func(attachment *SOAPAttachment) error
+
+// An mtomRequest holds the attachments of a request sent with DoRequestMTOM
+// and the function its response attachments are passed to.
+type mtomRequest struct {
+	attachments []*SOAPAttachment
+	fn          SOAPAttachmentFunc
+}
+
+type mtomRequestKey struct{}
+
+func mtomRequestFromContext(ctx context.Context) *mtomRequest {
+	if ctx != nil {
+		if r, ok := ctx.Value(mtomRequestKey{}).(*mtomRequest); ok {
+			return r
+		}
+	}
+	return nil
+}
+
+// DoRequestMTOM sends the provided payload data as SOAP through the means of
+// the provided client, with the provided attachments as MTOM multipart message
+// so binaries are streamed instead of being encoded as base64 into the
+// payload. The payload references attachments with XOPInclude. The response is
+// decoded into v and its attachments are passed to the provided function, if
+// not nil, after the envelope was decoded. The error returned by the function
+// is returned. Requests with attachments are not retried, since their bodies
+// can only be read once.
+func DoRequestMTOM(ctx context.Context, client SOAPClient, payload *string, attachments []*SOAPAttachment, v interface{}, fn SOAPAttachmentFunc) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = context.WithValue(ctx, mtomRequestKey{}, &mtomRequest{
+		attachments: attachments,
+		fn:          fn,
+	})
+	if len(attachments) > 0 {
+		ctx = WithRetryPolicy(ctx, &RetryPolicy{
+			MaxAttempts: 1,
+		})
+	}
+
+	return client.DoRequest(ctx, payload, v)
+}
+
+// XOPInclude returns the xop:Include element which references the attachment
+// with the provided Content-ID, to be used in payloads sent with
+// DoRequestMTOM in place of base64 data.
+func XOPInclude(contentID string) string {
+	return `<xop:Include href="cid:` + xmlCharData(url.PathEscape(contentID)).Escape() + `"/>`
+}
+
+// XOPData is binary data of a SOAP response, which is either inline as base64
+// or sent as MTOM attachment referenced with xop:Include. Use it for fields of
+// response types which can hold large binaries.
+type XOPData struct {
+	// Data holds the data if it was sent inline.
+	Data []byte
+	// ContentID is the Content-ID of the attachment holding the data, if it
+	// was sent as attachment. The attachment is passed with this Content-ID
+	// to the SOAPAttachmentFunc of DoRequestMTOM.
+	ContentID string
+}
+
+// UnmarshalXML implements the xml.Unmarshaler interface.
+func (d *XOPData) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	var raw struct {
+		Include *struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.w3.org/2004/08/xop/include Include"`
+		Data string `xml:",chardata"`
+	}
+	if err := decoder.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+
+	if raw.Include != nil {
+		contentID := strings.TrimPrefix(raw.Include.Href, "cid:")
+		if unescaped, err := url.PathUnescape(contentID); err == nil {
+			contentID = unescaped
+		}
+		d.Data = nil
+		d.ContentID = contentID
+		return nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(raw.Data))
+	if err != nil {
+		return err
+	}
+	d.Data = data
+	d.ContentID = ""
+
+	return nil
+}
+
+// newMTOMBody returns a reader of the MTOM multipart message with the provided
+// envelope and attachments together with its content type. The message is
+// written while it is read.
+func newMTOMBody(envelope *bytes.Buffer, attachments []*SOAPAttachment) (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		pw.CloseWithError(writeMTOMParts(mw, envelope, attachments))
+	}()
+
+	contentType := fmt.Sprintf(`multipart/related; type="application/xop+xml"; start="<%s>"; start-info="text/xml"; boundary="%s"`, mtomRootContentID, mw.Boundary())
+	return pr, contentType
+}
+
+func writeMTOMParts(mw *multipart.Writer, envelope *bytes.Buffer, attachments []*SOAPAttachment) error {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Type", `application/xop+xml; charset=utf-8; type="text/xml"`)
+	header.Set("Content-Transfer-Encoding", "8bit")
+	header.Set("Content-ID", "<"+mtomRootContentID+">")
+	w, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err = envelope.WriteTo(w); err != nil {
+		return err
+	}
+
+	for _, attachment := range attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header = make(textproto.MIMEHeader)
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Transfer-Encoding", "binary")
+		header.Set("Content-ID", "<"+attachment.ContentID+">")
+		w, err = mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(w, attachment.Body); err != nil {
+			return fmt.Errorf("failed to write MTOM attachment %s: %v", attachment.ContentID, err)
+		}
+	}
+
+	return mw.Close()
+}
+
+// parseSOAPHTTPResponse decodes the SOAP response of the provided HTTP
+// response, read from the provided reader, into v. MTOM multipart responses
+// are decoded with their attachments.
+func parseSOAPHTTPResponse(ctx context.Context, resp *http.Response, data io.Reader, v interface{}) error {
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err == nil && mediaType == "multipart/related" {
+		return parseMTOMResponse(ctx, resp.StatusCode, params, data, v)
+	}
+
+	return parseSOAPResponse(resp.StatusCode, data, v)
+}
+
+// parseMTOMResponse decodes the SOAP envelope part of the MTOM multipart
+// response read from the provided reader into v and passes the following
+// attachments to the SOAPAttachmentFunc of the provided context. Without
+// function, attachments are skipped.
+func parseMTOMResponse(ctx context.Context, code int, params map[string]string, data io.Reader, v interface{}) error {
+	boundary := params["boundary"]
+	if boundary == "" {
+		return fmt.Errorf("failed to read MTOM response: no boundary")
+	}
+	start := strings.Trim(params["start"], "<>")
+
+	var fn SOAPAttachmentFunc
+	if r := mtomRequestFromContext(ctx); r != nil {
+		fn = r.fn
+	}
+
+	mr := multipart.NewReader(data, boundary)
+	root := false
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read MTOM response: %v", err)
+		}
+
+		contentID := strings.Trim(part.Header.Get("Content-ID"), "<>")
+		if !root {
+			if start != "" && contentID != start {
+				// NOTE(longsleep): The envelope is decoded before the
+				// attachments it references, which is the order of all
+				// known servers.
+				return fmt.Errorf("failed to read MTOM response: attachment %s before the root part", contentID)
+			}
+			root = true
+			if err = parseSOAPResponse(code, part, v); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if fn != nil {
+			attachment := &SOAPAttachment{
+				ContentID:   contentID,
+				ContentType: part.Header.Get("Content-Type"),
+				Body:        part,
+			}
+			if err = callSafely(func() error {
+				return fn(attachment)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !root {
+		return fmt.Errorf("failed to read MTOM response: no root part")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type mtomTestResponse struct {
+	Er   KCError `xml:"er"`
+	Data XOPData `xml:"data"`
+}
+
+func TestDoRequestMTOM(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if err != nil || mediaType != "multipart/related" {
+			t.Errorf("expected multipart/related request, got %v", req.Header.Get("Content-Type"))
+			return
+		}
+		mr := multipart.NewReader(req.Body, params["boundary"])
+		root, _ := mr.NextPart()
+		envelope, _ := ioutil.ReadAll(root)
+		if !strings.Contains(string(envelope), `<data><xop:Include href="cid:in@test"/></data>`) {
+			t.Errorf("expected envelope with xop:Include, got %s", envelope)
+		}
+		part, _ := mr.NextPart()
+		data, _ := ioutil.ReadAll(part)
+		if part.Header.Get("Content-ID") != "<in@test>" || string(data) != "request binary" {
+			t.Errorf("unexpected request attachment %v: %q", part.Header, data)
+		}
+
+		var b bytes.Buffer
+		mw := multipart.NewWriter(&b)
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Type", `application/xop+xml; charset=utf-8; type="text/xml"`)
+		header.Set("Content-ID", "<root@test>")
+		w, _ := mw.CreatePart(header)
+		w.Write([]byte(soapHeader + `<ns:putResponse><er>0</er><data><xop:Include href="cid:out@test"/></data></ns:putResponse>` + soapFooter))
+		header = make(textproto.MIMEHeader)
+		header.Set("Content-Type", "application/octet-stream")
+		header.Set("Content-ID", "<out@test>")
+		w, _ = mw.CreatePart(header)
+		w.Write([]byte("response binary"))
+		mw.Close()
+
+		rw.Header().Set("Content-Type", `multipart/related; type="application/xop+xml"; start="<root@test>"; boundary="`+mw.Boundary()+`"`)
+		b.WriteTo(rw)
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := "<ns:put><data>" + XOPInclude("in@test") + "</data></ns:put>"
+	attachments := []*SOAPAttachment{{
+		ContentID: "in@test",
+		Body:      strings.NewReader("request binary"),
+	}}
+	received := make(map[string]string)
+	var response mtomTestResponse
+	err = DoRequestMTOM(context.Background(), client, &payload, attachments, &response, func(attachment *SOAPAttachment) error {
+		data, readErr := ioutil.ReadAll(attachment.Body)
+		received[attachment.ContentID] = string(data)
+		return readErr
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Er != KCSuccess {
+		t.Errorf("unexpected er: %v", response.Er)
+	}
+	if response.Data.ContentID != "out@test" {
+		t.Errorf("expected data content ID out@test, got %q", response.Data.ContentID)
+	}
+	if received["out@test"] != "response binary" {
+		t.Errorf("unexpected response attachments: %v", received)
+	}
+}
+
+func TestXOPDataInline(t *testing.T) {
+	var response mtomTestResponse
+	err := parseSOAPResponse(http.StatusOK, strings.NewReader(soapHeader+`<ns:getResponse><er>0</er><data>aW5saW5lIGJpbmFyeQ==</data></ns:getResponse>`+soapFooter), &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Data.ContentID != "" || string(response.Data.Data) != "inline binary" {
+		t.Errorf("unexpected inline data: %+v", response.Data)
+	}
+}
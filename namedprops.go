@@ -0,0 +1,183 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Property set GUIDs as defined in mapi4linux/include/mapiguid.h. This only
+// defines the property sets actually used or understood by kcc-go.
+var (
+	PSETID_Appointment = DEFINE_GUID(0x00062002, 0x0000, 0x0000, [8]byte{0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46})
+	PSETID_Task        = DEFINE_GUID(0x00062003, 0x0000, 0x0000, [8]byte{0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46})
+	PSETID_Address     = DEFINE_GUID(0x00062004, 0x0000, 0x0000, [8]byte{0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46})
+	PSETID_Common      = DEFINE_GUID(0x00062008, 0x0000, 0x0000, [8]byte{0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46})
+	PSETID_Note        = DEFINE_GUID(0x0006200E, 0x0000, 0x0000, [8]byte{0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46})
+	PSETID_Meeting     = DEFINE_GUID(0x6ED8DA90, 0x450B, 0x101B, [8]byte{0x98, 0xDA, 0x00, 0xAA, 0x00, 0x3F, 0x13, 0x05})
+)
+
+// A NamedProp identifies a named property by its property set GUID and either
+// its numeric ID or its string name, together with the property type to use
+// when building the prop tag.
+type NamedProp struct {
+	GUID [16]byte
+	ID   uint32
+	Name string
+	Type uint64
+}
+
+// Named properties as defined in [MS-OXPROPS]. This only defines the named
+// properties actually used or understood by kcc-go.
+var (
+	PidLidAppointmentSequence   = &NamedProp{GUID: PSETID_Appointment, ID: 0x8201, Type: PT_LONG}
+	PidLidBusyStatus            = &NamedProp{GUID: PSETID_Appointment, ID: 0x8205, Type: PT_LONG}
+	PidLidLocation              = &NamedProp{GUID: PSETID_Appointment, ID: 0x8208, Type: PT_UNICODE}
+	PidLidAppointmentStartWhole = &NamedProp{GUID: PSETID_Appointment, ID: 0x820D, Type: PT_SYSTIME}
+	PidLidAppointmentEndWhole   = &NamedProp{GUID: PSETID_Appointment, ID: 0x820E, Type: PT_SYSTIME}
+	PidLidAppointmentSubType    = &NamedProp{GUID: PSETID_Appointment, ID: 0x8215, Type: PT_BOOLEAN}
+	PidLidResponseStatus        = &NamedProp{GUID: PSETID_Appointment, ID: 0x8218, Type: PT_LONG}
+	PidLidAppointmentReplyTime  = &NamedProp{GUID: PSETID_Appointment, ID: 0x8220, Type: PT_SYSTIME}
+	PidLidRecurring             = &NamedProp{GUID: PSETID_Appointment, ID: 0x8223, Type: PT_BOOLEAN}
+	PidLidIntendedBusyStatus    = &NamedProp{GUID: PSETID_Appointment, ID: 0x8224, Type: PT_LONG}
+	PidLidGlobalObjectID        = &NamedProp{GUID: PSETID_Meeting, ID: 0x0003, Type: PT_BINARY}
+	PidLidOwnerCriticalChange   = &NamedProp{GUID: PSETID_Meeting, ID: 0x001A, Type: PT_SYSTIME}
+	PidLidCleanGlobalObjectID   = &NamedProp{GUID: PSETID_Meeting, ID: 0x0023, Type: PT_BINARY}
+	PidLidTaskStatus            = &NamedProp{GUID: PSETID_Task, ID: 0x8101, Type: PT_LONG}
+	PidLidPercentComplete       = &NamedProp{GUID: PSETID_Task, ID: 0x8102, Type: PT_DOUBLE}
+	PidLidTaskStartDate         = &NamedProp{GUID: PSETID_Task, ID: 0x8104, Type: PT_SYSTIME}
+	PidLidTaskDueDate           = &NamedProp{GUID: PSETID_Task, ID: 0x8105, Type: PT_SYSTIME}
+	PidLidTaskDateCompleted     = &NamedProp{GUID: PSETID_Task, ID: 0x810F, Type: PT_SYSTIME}
+	PidLidTaskComplete          = &NamedProp{GUID: PSETID_Task, ID: 0x811C, Type: PT_BOOLEAN}
+	PidLidNoteColor             = &NamedProp{GUID: PSETID_Note, ID: 0x8B00, Type: PT_LONG}
+	PidLidNoteWidth             = &NamedProp{GUID: PSETID_Note, ID: 0x8B02, Type: PT_LONG}
+	PidLidNoteHeight            = &NamedProp{GUID: PSETID_Note, ID: 0x8B03, Type: PT_LONG}
+	PidLidEmail1DisplayName     = &NamedProp{GUID: PSETID_Address, ID: 0x8080, Type: PT_UNICODE}
+	PidLidEmail1AddressType     = &NamedProp{GUID: PSETID_Address, ID: 0x8082, Type: PT_UNICODE}
+	PidLidEmail1EmailAddress    = &NamedProp{GUID: PSETID_Address, ID: 0x8083, Type: PT_UNICODE}
+	PidLidEmail2DisplayName     = &NamedProp{GUID: PSETID_Address, ID: 0x8090, Type: PT_UNICODE}
+	PidLidEmail2AddressType     = &NamedProp{GUID: PSETID_Address, ID: 0x8092, Type: PT_UNICODE}
+	PidLidEmail2EmailAddress    = &NamedProp{GUID: PSETID_Address, ID: 0x8093, Type: PT_UNICODE}
+	PidLidEmail3DisplayName     = &NamedProp{GUID: PSETID_Address, ID: 0x80A0, Type: PT_UNICODE}
+	PidLidEmail3AddressType     = &NamedProp{GUID: PSETID_Address, ID: 0x80A2, Type: PT_UNICODE}
+	PidLidEmail3EmailAddress    = &NamedProp{GUID: PSETID_Address, ID: 0x80A3, Type: PT_UNICODE}
+	PidLidFileUnder             = &NamedProp{GUID: PSETID_Address, ID: 0x8005, Type: PT_UNICODE}
+	PidLidCommonStart           = &NamedProp{GUID: PSETID_Common, ID: 0x8516, Type: PT_SYSTIME}
+	PidLidCommonEnd             = &NamedProp{GUID: PSETID_Common, ID: 0x8517, Type: PT_SYSTIME}
+)
+
+// GetIDsFromNames resolves the provided named properties to their property IDs
+// using the provided session. Pass MAPI_CREATE as flags to let the server
+// create missing mappings.
+func (c *KCC) GetIDsFromNames(ctx context.Context, names []*NamedProp, flags KCFlag, sessionID KCSessionID) (*GetIDsFromNamesResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:getIDsFromNames><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><lpsNamedProps SOAP-ENC:arrayType=\"namedProp[")
+	b.WriteString(strconv.FormatInt(int64(len(names)), 10))
+	b.WriteString("]\">")
+	for _, name := range names {
+		b.WriteString("<item>")
+		if name.Name != "" {
+			b.WriteString("<lpString>")
+			b.WriteString(xmlCharData(name.Name).Escape())
+			b.WriteString("</lpString>")
+		} else {
+			b.WriteString("<lpId>")
+			b.WriteString(strconv.FormatUint(uint64(name.ID), 10))
+			b.WriteString("</lpId>")
+		}
+		b.WriteString("<lpguid>")
+		b.WriteString(base64.StdEncoding.EncodeToString(name.GUID[:]))
+		b.WriteString("</lpguid>")
+		b.WriteString("</item>")
+	}
+	b.WriteString("</lpsNamedProps><ulFlags>")
+	b.WriteString(flags.String())
+	b.WriteString("</ulFlags></ns:getIDsFromNames>")
+	payload := b.String()
+
+	var getIDsFromNamesResponse GetIDsFromNamesResponse
+	err := c.Client.DoRequest(ctx, &payload, &getIDsFromNamesResponse)
+
+	return &getIDsFromNamesResponse, err
+}
+
+// namedPropCache caches resolved named property IDs. Kopano server keeps the
+// named property mapping server wide, so it is safe to share the cache for all
+// sessions of a KCC.
+type namedPropCache struct {
+	sync.RWMutex
+	ids map[NamedProp]uint64
+}
+
+// NamedPropTags returns the prop tags for the provided named properties, in
+// the same order. Already known mappings are served from cache, unknown ones
+// are resolved (and created when missing) using the provided session.
+func (c *KCC) NamedPropTags(ctx context.Context, sessionID KCSessionID, names ...*NamedProp) ([]PT, error) {
+	tags := make([]PT, len(names))
+	var missing []*NamedProp
+	var missingIdx []int
+
+	c.namedProps.RLock()
+	for idx, name := range names {
+		key := *name
+		key.Type = 0
+		if id, ok := c.namedProps.ids[key]; ok {
+			tags[idx] = propTag(name.Type, id)
+		} else {
+			missing = append(missing, name)
+			missingIdx = append(missingIdx, idx)
+		}
+	}
+	c.namedProps.RUnlock()
+
+	if len(missing) == 0 {
+		return tags, nil
+	}
+
+	resp, err := c.GetIDsFromNames(ctx, missing, MAPI_CREATE, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Er != KCSuccess {
+		return nil, resp.Er
+	}
+	if len(resp.PropIDs) != len(missing) {
+		return nil, fmt.Errorf("getIDsFromNames returned %d IDs for %d names", len(resp.PropIDs), len(missing))
+	}
+
+	c.namedProps.Lock()
+	if c.namedProps.ids == nil {
+		c.namedProps.ids = make(map[NamedProp]uint64)
+	}
+	for idx, name := range missing {
+		id := resp.PropIDs[idx]
+		key := *name
+		key.Type = 0
+		c.namedProps.ids[key] = id
+		tags[missingIdx[idx]] = propTag(name.Type, id)
+	}
+	c.namedProps.Unlock()
+
+	return tags, nil
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// A NameMatchType is the field which matched a name resolved against the AB.
+type NameMatchType string
+
+// Name match types, ordered by their relevance.
+const (
+	NameMatchLogin       NameMatchType = "login"
+	NameMatchEmail       NameMatchType = "email"
+	NameMatchDisplayName NameMatchType = "displayName"
+	NameMatchAlias       NameMatchType = "alias"
+)
+
+// Weights of the name match types, a match of a single word of the display
+// name ranks below a match of the whole display name.
+const (
+	nameMatchWeightLogin           = 1.0
+	nameMatchWeightEmail           = 0.9
+	nameMatchWeightDisplayName     = 0.8
+	nameMatchWeightDisplayNameWord = 0.7
+	nameMatchWeightAlias           = 0.6
+)
+
+// A nameMatch finds the most relevant field matching a name. The score of a
+// field is its weight for an exact match and decreases with the share of the
+// field value the name is a prefix of, down to half of its weight. Case is
+// ignored.
+type nameMatch struct {
+	name      string
+	matchType NameMatchType
+	score     float64
+}
+
+func newNameMatch(name string) *nameMatch {
+	return &nameMatch{
+		name: strings.ToLower(name),
+	}
+}
+
+// add scores the provided field value and keeps it if it is more relevant
+// than the previous ones.
+func (m *nameMatch) add(matchType NameMatchType, weight float64, value string) {
+	value = strings.ToLower(value)
+	if m.name == "" || !strings.HasPrefix(value, m.name) {
+		return
+	}
+	score := weight * (0.5 + 0.5*float64(len(m.name))/float64(len(value)))
+	// NOTE(longsleep): Round, so scores are stable and presentable as JSON.
+	score = math.Round(score*1000) / 1000
+	if score > m.score {
+		m.matchType = matchType
+		m.score = score
+	}
+}
+
+// addDisplayName scores the provided display name and each of its words.
+func (m *nameMatch) addDisplayName(value string) {
+	m.add(NameMatchDisplayName, nameMatchWeightDisplayName, value)
+	for _, word := range strings.Fields(value) {
+		m.add(NameMatchDisplayName, nameMatchWeightDisplayNameWord, word)
+	}
+}
+
+// matched returns true if any field matched.
+func (m *nameMatch) matched() bool {
+	return m.matchType != ""
+}
+
+// matchUser matches the provided name against the username, mail address,
+// full name and aliases of the provided user.
+func matchUser(user *User, name string) *nameMatch {
+	m := newNameMatch(name)
+	m.add(NameMatchLogin, nameMatchWeightLogin, user.Username)
+	m.add(NameMatchEmail, nameMatchWeightEmail, user.MailAddress)
+	m.addDisplayName(user.FullName)
+	for _, alias := range user.Aliases() {
+		m.add(NameMatchAlias, nameMatchWeightAlias, alias)
+	}
+	return m
+}
+
+// matchProps matches the provided name against the account, SMTP address and
+// display name in the provided props, if present.
+func matchProps(props *PropTagRowSet, name string) *nameMatch {
+	m := newNameMatch(name)
+	m.add(NameMatchLogin, nameMatchWeightLogin, propsString(props, PR_ACCOUNT_W, PR_ACCOUNT_A))
+	m.add(NameMatchEmail, nameMatchWeightEmail, propsString(props, PR_SMTP_ADDRESS_W, PR_SMTP_ADDRESS_A))
+	m.addDisplayName(propsString(props, PR_DISPLAY_NAME_W, PR_DISPLAY_NAME_A))
+	return m
+}
+
+// propsString returns the first non empty string value of the provided prop
+// tags in the provided props.
+func propsString(props *PropTagRowSet, pts ...PT) string {
+	for _, pt := range pts {
+		if value := props.GetString(pt); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// sortNameCandidates sorts the provided candidates by descending score,
+// keeping the order of candidates with equal score.
+func sortNameCandidates(candidates []*NameCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+}
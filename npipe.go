@@ -0,0 +1,44 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"net/url"
+	"strings"
+)
+
+// pipeAddr is the address of connections to a named pipe.
+type pipeAddr string
+
+func (addr pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (addr pipeAddr) String() string {
+	return string(addr)
+}
+
+// pipePath returns the Windows path of the named pipe of the provided npipe
+// URL, for example \\.\pipe\kopano for npipe:////./pipe/kopano,
+// npipe:///./pipe/kopano or npipe://./pipe/kopano.
+func pipePath(uri *url.URL) string {
+	path := strings.TrimLeft(strings.Replace(uri.Host+uri.Path, "/", `\`, -1), `\`)
+	if path == "" {
+		return ""
+	}
+	return `\\` + path
+}
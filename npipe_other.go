@@ -0,0 +1,31 @@
+//go:build !windows
+// +build !windows
+
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// dialPipe is not supported on this platform.
+func dialPipe(path string, timeout time.Duration) (net.Conn, error) {
+	return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: pipeAddr(path), Err: errors.New("named pipes are only supported on Windows")}
+}
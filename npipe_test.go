@@ -0,0 +1,56 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestPipePath(t *testing.T) {
+	for _, test := range []struct {
+		uri  string
+		path string
+	}{
+		{"npipe:////./pipe/kopano", `\\.\pipe\kopano`},
+		{"npipe:///./pipe/kopano", `\\.\pipe\kopano`},
+		{"npipe://./pipe/kopano", `\\.\pipe\kopano`},
+		{"npipe://server/pipe/kopano", `\\server\pipe\kopano`},
+		{"npipe://", ""},
+	} {
+		uri, _ := url.Parse(test.uri)
+		if path := pipePath(uri); path != test.path {
+			t.Errorf("unexpected path for %s: %s", test.uri, path)
+		}
+	}
+}
+
+func TestSOAPSocketClientPipe(t *testing.T) {
+	uri, _ := url.Parse("npipe:////./pipe/kopano")
+	client, err := NewSOAPClient(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := client.(*SOAPSocketClient).String(); s != `<pipe:\\.\pipe\kopano>` {
+		t.Errorf("unexpected client string: %s", s)
+	}
+
+	uri, _ = url.Parse("npipe://")
+	if _, err = NewSOAPClient(uri); err == nil {
+		t.Errorf("expected error without pipe path")
+	}
+}
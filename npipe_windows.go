@@ -0,0 +1,224 @@
+//go:build windows
+// +build windows
+
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// errorPipeBusy is returned when all instances of a named pipe are busy.
+const errorPipeBusy syscall.Errno = 231
+
+// pipeBusyRetryInterval is the duration to wait before opening a named pipe
+// again when all its instances were busy.
+const pipeBusyRetryInterval = 10 * time.Millisecond
+
+// dialPipe opens a client connection to the named pipe at the provided path,
+// waiting at most the provided timeout for a free instance of the pipe.
+func dialPipe(path string, timeout time.Duration) (net.Conn, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	for {
+		handle, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_EXISTING, 0, 0)
+		if err == nil {
+			return &pipeConn{
+				handle: handle,
+				path:   path,
+			}, nil
+		}
+		if err != errorPipeBusy || (!deadline.IsZero() && time.Now().After(deadline)) {
+			return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: pipeAddr(path), Err: err}
+		}
+		time.Sleep(pipeBusyRetryInterval)
+	}
+}
+
+// A pipeConn is a net.Conn of a client connection to a named pipe. The handle
+// is opened for synchronous I/O, pending reads and writes are canceled when
+// their deadline passes. Synchronous I/O is serialized, so reads and writes
+// must not be used concurrently.
+type pipeConn struct {
+	handle syscall.Handle
+	path   string
+
+	readDeadline  pipeDeadline
+	writeDeadline pipeDeadline
+
+	closeOnce sync.Once
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	var n uint32
+	err := c.do(&c.readDeadline, func() error {
+		return syscall.ReadFile(c.handle, b, &n, nil)
+	})
+	if err == syscall.ERROR_BROKEN_PIPE || (err == nil && n == 0 && len(b) > 0) {
+		return 0, io.EOF
+	}
+	return int(n), err
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	var n uint32
+	err := c.do(&c.writeDeadline, func() error {
+		return syscall.WriteFile(c.handle, b, &n, nil)
+	})
+	return int(n), err
+}
+
+// do runs the provided I/O operation with the provided deadline.
+func (c *pipeConn) do(d *pipeDeadline, f func() error) error {
+	if !d.begin(c.handle) {
+		return pipeTimeoutError{}
+	}
+	err := f()
+	if d.end() && err == syscall.ERROR_OPERATION_ABORTED {
+		return pipeTimeoutError{}
+	}
+	return err
+}
+
+func (c *pipeConn) Close() error {
+	var err error = syscall.EINVAL
+	c.closeOnce.Do(func() {
+		syscall.CancelIoEx(c.handle, nil)
+		err = syscall.CloseHandle(c.handle)
+	})
+	return err
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return pipeAddr(c.path)
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return pipeAddr(c.path)
+}
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(c.handle, t)
+	c.writeDeadline.set(c.handle, t)
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(c.handle, t)
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(c.handle, t)
+	return nil
+}
+
+// A pipeDeadline cancels the pending I/O operation of a pipeConn when its
+// deadline passes.
+type pipeDeadline struct {
+	mutex      sync.Mutex
+	deadline   time.Time
+	timer      *time.Timer
+	generation uint64
+	pending    bool
+	expired    bool
+}
+
+// begin marks an operation as pending and arms the timer of the accociated
+// deadline. It returns false if the deadline has passed already.
+func (d *pipeDeadline) begin(handle syscall.Handle) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !d.deadline.IsZero() && !time.Now().Before(d.deadline) {
+		return false
+	}
+	d.pending = true
+	d.expired = false
+	d.armLocked(handle)
+	return true
+}
+
+// end marks the pending operation as done and returns true if it was canceled
+// because the accociated deadline passed.
+func (d *pipeDeadline) end() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.pending = false
+	d.stopLocked()
+	return d.expired
+}
+
+// set sets the accociated deadline, a pending operation is canceled at once if
+// the provided deadline has passed.
+func (d *pipeDeadline) set(handle syscall.Handle, deadline time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.deadline = deadline
+	if d.pending {
+		d.armLocked(handle)
+	}
+}
+
+func (d *pipeDeadline) armLocked(handle syscall.Handle) {
+	d.stopLocked()
+	if d.deadline.IsZero() {
+		return
+	}
+
+	generation := d.generation
+	d.timer = time.AfterFunc(time.Until(d.deadline), func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		// NOTE(longsleep): The generation check ignores timers which fired
+		// while being stopped for another operation or deadline.
+		if d.pending && d.generation == generation {
+			d.expired = true
+			syscall.CancelIoEx(handle, nil)
+		}
+	})
+}
+
+func (d *pipeDeadline) stopLocked() {
+	d.generation++
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
+
+// pipeTimeoutError is returned by reads and writes of a pipeConn when their
+// deadline passed.
+type pipeTimeoutError struct{}
+
+func (pipeTimeoutError) Error() string   { return "i/o timeout" }
+func (pipeTimeoutError) Timeout() bool   { return true }
+func (pipeTimeoutError) Temporary() bool { return true }
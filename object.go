@@ -0,0 +1,241 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GetStore opens the store with the provided store Entry ID using the provided
+// session. An empty Entry ID opens the default store of the session's user.
+func (c *KCC) GetStore(ctx context.Context, storeEntryID string, sessionID KCSessionID) (*GetStoreResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:getStore><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId>")
+	if storeEntryID != "" {
+		b.WriteString("<lpsEntryId>")
+		b.WriteString(xmlCharData(storeEntryID).Escape())
+		b.WriteString("</lpsEntryId>")
+	}
+	b.WriteString("</ns:getStore>")
+	payload := b.String()
+
+	var getStoreResponse GetStoreResponse
+	err := c.Client.DoRequest(ctx, &payload, &getStoreResponse)
+
+	return &getStoreResponse, err
+}
+
+// ResolveUserStore resolves the private store of the user with the provided
+// username using the provided session.
+func (c *KCC) ResolveUserStore(ctx context.Context, username string, flags KCFlag, sessionID KCSessionID) (*ResolveUserStoreResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:resolveUserStore><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><szUserName>")
+	b.WriteString(xmlCharData(username).Escape())
+	b.WriteString("</szUserName><ulStoreTypeMask>")
+	b.WriteString(ECSTORE_TYPE_MASK_PRIVATE.String())
+	b.WriteString("</ulStoreTypeMask><ulFlags>")
+	b.WriteString(flags.String())
+	b.WriteString("</ulFlags></ns:resolveUserStore>")
+	payload := b.String()
+
+	var resolveUserStoreResponse ResolveUserStoreResponse
+	err := c.Client.DoRequest(ctx, &payload, &resolveUserStoreResponse)
+
+	return &resolveUserStoreResponse, err
+}
+
+// GetReceiveFolder resolves the folder which receives messages of the
+// provided message class in the store with the provided store Entry ID using
+// the provided session. An empty message class resolves the default receive
+// folder, which is the Inbox of private stores.
+func (c *KCC) GetReceiveFolder(ctx context.Context, storeEntryID string, messageClass string, sessionID KCSessionID) (*GetReceiveFolderResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:getReceiveFolder><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><sStoreId>")
+	b.WriteString(xmlCharData(storeEntryID).Escape())
+	b.WriteString("</sStoreId><lpszMessageClass>")
+	b.WriteString(xmlCharData(messageClass).Escape())
+	b.WriteString("</lpszMessageClass></ns:getReceiveFolder>")
+	payload := b.String()
+
+	var getReceiveFolderResponse GetReceiveFolderResponse
+	err := c.Client.DoRequest(ctx, &payload, &getReceiveFolderResponse)
+
+	return &getReceiveFolderResponse, err
+}
+
+// LoadObject fetches the object with the provided Entry ID including its
+// properties and child objects using the provided session.
+func (c *KCC) LoadObject(ctx context.Context, entryID string, flags KCFlag, sessionID KCSessionID) (*LoadObjectResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:loadObject><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><sEntryId>")
+	b.WriteString(xmlCharData(entryID).Escape())
+	b.WriteString("</sEntryId><ulFlags>")
+	b.WriteString(flags.String())
+	b.WriteString("</ulFlags></ns:loadObject>")
+	payload := b.String()
+
+	var loadObjectResponse LoadObjectResponse
+	err := c.Client.DoRequest(ctx, &payload, &loadObjectResponse)
+
+	return &loadObjectResponse, err
+}
+
+// GetProps loads the object with the provided Entry ID using the provided
+// session and returns the values of the provided prop tags in the same order.
+// Properties which are not set on the object are returned as nil.
+func (c *KCC) GetProps(ctx context.Context, entryID string, props []PT, sessionID KCSessionID) ([]*PropTagRowSetValue, error) {
+	resp, err := c.LoadObject(ctx, entryID, 0, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("get props loadObject failed: %v", err)
+	}
+	if resp.Er != KCSuccess {
+		return nil, resp.Er
+	}
+	if resp.Object == nil {
+		return nil, fmt.Errorf("get props loadObject returned no object")
+	}
+
+	loaded := resp.Object.Props()
+	values := make([]*PropTagRowSetValue, len(props))
+	for idx, pt := range props {
+		if value, ok := loaded.Get(pt); ok {
+			values[idx] = value
+		}
+	}
+
+	return values, nil
+}
+
+// SaveObject creates or updates the object with the provided Entry ID in the
+// folder with the provided parent Entry ID using the provided session. The
+// saved object is returned as the server sees it after saving.
+func (c *KCC) SaveObject(ctx context.Context, parentEntryID string, entryID string, object *SaveObject, flags KCFlag, sessionID KCSessionID) (*LoadObjectResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:saveObject><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><sParentEntryId>")
+	b.WriteString(xmlCharData(parentEntryID).Escape())
+	b.WriteString("</sParentEntryId><sEntryId>")
+	b.WriteString(xmlCharData(entryID).Escape())
+	b.WriteString("</sEntryId>")
+	if err := writeSaveObject(&b, "lpsSaveObj", object); err != nil {
+		return nil, err
+	}
+	b.WriteString("<ulFlags>")
+	b.WriteString(flags.String())
+	b.WriteString("</ulFlags><ulSyncId>0</ulSyncId></ns:saveObject>")
+	payload := b.String()
+
+	var loadObjectResponse LoadObjectResponse
+	err := c.Client.DoRequest(ctx, &payload, &loadObjectResponse)
+	if err == nil && loadObjectResponse.Er == KCSuccess {
+		if entryID != "" {
+			c.invalidate(entryID)
+		}
+		c.invalidate(parentEntryID)
+	}
+
+	return &loadObjectResponse, err
+}
+
+// SubmitMessage submits the message with the provided Entry ID for sending
+// using the provided session.
+func (c *KCC) SubmitMessage(ctx context.Context, entryID string, flags KCFlag, sessionID KCSessionID) (*SubmitMessageResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:submitMessage><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><sEntryId>")
+	b.WriteString(xmlCharData(entryID).Escape())
+	b.WriteString("</sEntryId><ulFlags>")
+	b.WriteString(flags.String())
+	b.WriteString("</ulFlags></ns:submitMessage>")
+	payload := b.String()
+
+	var submitMessageResponse SubmitMessageResponse
+	err := c.Client.DoRequest(ctx, &payload, &submitMessageResponse)
+
+	return &submitMessageResponse, err
+}
+
+// DeleteObjects deletes the objects with the provided Entry IDs using the
+// provided session.
+func (c *KCC) DeleteObjects(ctx context.Context, entryIDs []string, flags KCFlag, sessionID KCSessionID) (*DeleteObjectsResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:deleteObjects><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><ulFlags>")
+	b.WriteString(flags.String())
+	b.WriteString("</ulFlags><aMessages SOAP-ENC:arrayType=\"entryId[")
+	b.WriteString(strconv.FormatInt(int64(len(entryIDs)), 10))
+	b.WriteString("]\">")
+	for _, entryID := range entryIDs {
+		b.WriteString("<item>")
+		b.WriteString(xmlCharData(entryID).Escape())
+		b.WriteString("</item>")
+	}
+	b.WriteString("</aMessages><ulSyncId>0</ulSyncId></ns:deleteObjects>")
+	payload := b.String()
+
+	var deleteObjectsResponse DeleteObjectsResponse
+	err := c.Client.DoRequest(ctx, &payload, &deleteObjectsResponse)
+	if err == nil && deleteObjectsResponse.Er == KCSuccess {
+		for _, entryID := range entryIDs {
+			c.invalidate(entryID)
+		}
+	}
+
+	return &deleteObjectsResponse, err
+}
+
+func writeSaveObject(b *strings.Builder, name string, object *SaveObject) error {
+	b.WriteString("<")
+	b.WriteString(name)
+	b.WriteString(">")
+	for _, child := range object.Children {
+		if err := writeSaveObject(b, "item", child); err != nil {
+			return err
+		}
+	}
+	writePropTagArray(b, "delProps", object.DelProps)
+	if err := writePropValArray(b, "modProps", object.ModProps); err != nil {
+		return err
+	}
+	b.WriteString("<bDelete>")
+	b.WriteString(strconv.FormatBool(object.Delete))
+	b.WriteString("</bDelete><ulClientId>")
+	b.WriteString(strconv.FormatUint(object.ClientID, 10))
+	b.WriteString("</ulClientId><ulServerId>")
+	b.WriteString(strconv.FormatUint(object.ServerID, 10))
+	b.WriteString("</ulServerId><ulObjType>")
+	b.WriteString(object.ObjType.String())
+	b.WriteString("</ulObjType></")
+	b.WriteString(name)
+	b.WriteString(">")
+
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"sync/atomic"
+)
+
+// A PanicError is returned in place of a panic of a callback provided by the
+// application. It holds the value passed to panic and the stack trace of the
+// panicking goroutine.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", err.Value)
+}
+
+// panicStackSize is the maximum size of stack traces of recovered panics.
+const panicStackSize = 64 << 10
+
+var panicHandler atomic.Value
+
+// SetPanicHandler sets the handler which is called with every recovered
+// panic, for example to send crash reports to Sentry. A nil handler restores
+// the default, which logs the panic with its stack trace. The handler must be
+// safe for concurrent use.
+func SetPanicHandler(handler func(*PanicError)) {
+	panicHandler.Store(handler)
+}
+
+// DefaultPanicHandler logs the provided recovered panic with its stack trace
+// using the standard logger.
+func DefaultPanicHandler(err *PanicError) {
+	log.Printf("kcc-go: recovered %v\n%s", err, err.Stack)
+}
+
+// ReportPanic passes the provided recovered panic to the panic handler. Use
+// it to report panics recovered by the application the same way as panics
+// recovered by this package.
+func ReportPanic(err *PanicError) {
+	if handler, _ := panicHandler.Load().(func(*PanicError)); handler != nil {
+		handler(err)
+		return
+	}
+	DefaultPanicHandler(err)
+}
+
+// NewPanicError creates a PanicError of the provided value returned by
+// recover, capturing the stack trace of the calling goroutine.
+func NewPanicError(value interface{}) *PanicError {
+	stack := make([]byte, panicStackSize)
+	return &PanicError{
+		Value: value,
+		Stack: stack[:runtime.Stack(stack, false)],
+	}
+}
+
+// callSafely calls the provided callback, returning a reported PanicError if
+// the callback panics.
+func callSafely(f func() error) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			panicErr := NewPanicError(value)
+			ReportPanic(panicErr)
+			err = panicErr
+		}
+	}()
+
+	return f()
+}
+
+// runSafely calls the provided function, reporting a panic instead of
+// crashing. Use it for callbacks which have no way to return an error.
+func runSafely(f func()) {
+	callSafely(func() error {
+		f()
+		return nil
+	})
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestListUsersCallbackPanic(t *testing.T) {
+	var reported []*PanicError
+	SetPanicHandler(func(err *PanicError) {
+		reported = append(reported, err)
+	})
+	defer SetPanicHandler(nil)
+
+	client := &cannedSOAPClient{
+		response: "<ns:getUserListResponse><sUserArray>" +
+			"<item><ulUserId>3</ulUserId><lpszUsername>user1</lpszUsername></item>" +
+			"</sUserArray><er>0</er></ns:getUserListResponse>",
+	}
+	c := NewKCCWithClient(client)
+
+	err := c.ListUsers(context.Background(), "", 1, func(user *User) error {
+		panic("broken callback")
+	})
+	panicErr, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("expected panic error, got %v", err)
+	}
+	if panicErr.Value != "broken callback" || !strings.Contains(string(panicErr.Stack), "panic_test.go") {
+		t.Errorf("unexpected panic error: %v\n%s", panicErr.Value, panicErr.Stack)
+	}
+	if len(reported) != 1 || reported[0] != panicErr {
+		t.Errorf("panic not reported: %v", reported)
+	}
+}
+
+func TestInvalidationBusSubscriberPanic(t *testing.T) {
+	var reported int
+	SetPanicHandler(func(err *PanicError) {
+		reported++
+	})
+	defer SetPanicHandler(nil)
+
+	bus := NewInvalidationBus()
+	var called int
+	bus.Subscribe(func(inv *Invalidation) {
+		panic("broken subscriber")
+	})
+	bus.Subscribe(func(inv *Invalidation) {
+		called++
+	})
+
+	bus.Publish(&Invalidation{EntryID: "AAAAADhxUgoDAAAAAQAAAAAAAAA="})
+	if called != 1 {
+		t.Errorf("other subscriber not called: %d", called)
+	}
+	if reported != 1 {
+		t.Errorf("panic not reported: %d", reported)
+	}
+}
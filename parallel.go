@@ -0,0 +1,138 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"encoding/xml"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// DefaultDecodeWorkers is the default number of workers used by new KCC
+// instances to decode items of streamed list responses. With 1 or less, items
+// are decoded sequentially while reading the response.
+var DefaultDecodeWorkers = 1
+
+// parallelDecodeChunkSize is the number of items which are collected before
+// they are decoded in parallel. It bounds the memory used for raw items.
+const parallelDecodeChunkSize = 256
+
+func init() {
+	if s := os.Getenv("KCC_GO_DECODE_WORKERS"); s != "" {
+		if n, err := strconv.ParseInt(s, 10, 0); err == nil {
+			DefaultDecodeWorkers = int(n)
+		}
+	}
+}
+
+// rawItem holds the undecoded XML of a list item.
+type rawItem struct {
+	Data []byte `xml:",innerxml"`
+}
+
+// A parallelDecoder decodes list items on a bounded pool of workers. Items are
+// collected in chunks, decoded in parallel and then passed to deliver in the
+// order they were added.
+type parallelDecoder struct {
+	workers int
+	decode  func(data []byte) (interface{}, error)
+	deliver func(v interface{}) error
+
+	chunk [][]byte
+}
+
+func newParallelDecoder(workers int, decode func(data []byte) (interface{}, error), deliver func(v interface{}) error) *parallelDecoder {
+	return &parallelDecoder{
+		workers: workers,
+		decode:  decode,
+		deliver: deliver,
+
+		chunk: make([][]byte, 0, parallelDecodeChunkSize),
+	}
+}
+
+// add reads the item started with the provided start element from the
+// provided decoder without decoding it, flushing when the chunk is full.
+func (pd *parallelDecoder) add(decoder *xml.Decoder, start *xml.StartElement) error {
+	var item rawItem
+	if err := decoder.DecodeElement(&item, start); err != nil {
+		return err
+	}
+	pd.chunk = append(pd.chunk, item.Data)
+	if len(pd.chunk) < parallelDecodeChunkSize {
+		return nil
+	}
+
+	return pd.flush()
+}
+
+// flush decodes all collected items and delivers them in order. Delivery stops
+// at the first error.
+func (pd *parallelDecoder) flush() error {
+	chunk := pd.chunk
+	pd.chunk = pd.chunk[:0]
+	if len(chunk) == 0 {
+		return nil
+	}
+
+	values := make([]interface{}, len(chunk))
+	errs := make([]error, len(chunk))
+
+	workers := pd.workers
+	if workers > len(chunk) {
+		workers = len(chunk)
+	}
+	indexes := make(chan int, len(chunk))
+	for idx := range chunk {
+		indexes <- idx
+	}
+	close(indexes)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				values[idx], errs[idx] = pd.decode(chunk[idx])
+			}
+		}()
+	}
+	wg.Wait()
+
+	for idx, v := range values {
+		if errs[idx] != nil {
+			return errs[idx]
+		}
+		if err := pd.deliver(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unmarshalItem decodes the provided raw item XML into the provided value.
+func unmarshalItem(data []byte, v interface{}) error {
+	b := make([]byte, 0, len(data)+13)
+	b = append(b, "<item>"...)
+	b = append(b, data...)
+	b = append(b, "</item>"...)
+
+	return xml.Unmarshal(b, v)
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// PayloadRedactedElements are the local names of the XML elements whose
+// content is redacted in logged SOAP payloads, as they hold passwords, tokens
+// or session IDs. Changes apply to SOAP payloads logged afterwards.
+var PayloadRedactedElements = []string{"szPassword", "lpszPassword", "lpInput", "Password", "ulSessionId"}
+
+// payloadRedacted replaces the content of redacted elements.
+const payloadRedacted = "[REDACTED]"
+
+func init() {
+	if os.Getenv("KCC_GO_DEBUG_PAYLOADS") != "" {
+		SetPayloadLogger(DefaultPayloadLogger)
+	}
+}
+
+// Directions of a PayloadLog.
+const (
+	PayloadRequest  = "request"
+	PayloadResponse = "response"
+)
+
+// A PayloadLog holds a SOAP payload sent to or received from a server, with
+// the content of PayloadRedactedElements redacted.
+type PayloadLog struct {
+	// Direction is PayloadRequest or PayloadResponse.
+	Direction string
+	// Status is the HTTP status of responses.
+	Status int
+	// Payload is the redacted SOAP envelope.
+	Payload string
+}
+
+var payloadLogger atomic.Value
+
+// SetPayloadLogger sets the logger which is called with all SOAP payloads
+// sent and received by the SOAP clients, with credentials redacted. A nil
+// logger disables payload logging, which is the default unless
+// KCC_GO_DEBUG_PAYLOADS is set. The logger must be safe for concurrent use.
+// Payload logging reads responses into memory before decoding them, so only
+// enable it for troubleshooting.
+func SetPayloadLogger(logger func(*PayloadLog)) {
+	payloadLogger.Store(logger)
+}
+
+// DefaultPayloadLogger logs the provided SOAP payload using the standard
+// logger.
+func DefaultPayloadLogger(entry *PayloadLog) {
+	if entry.Direction == PayloadResponse {
+		log.Printf("kcc SOAP response payload: status=%d %s\n", entry.Status, entry.Payload)
+		return
+	}
+	log.Printf("kcc SOAP request payload: %s\n", entry.Payload)
+}
+
+// logPayload passes the provided raw SOAP payload redacted to the payload
+// logger, if any.
+func logPayload(direction string, status int, raw []byte) {
+	logger, _ := payloadLogger.Load().(func(*PayloadLog))
+	if logger == nil {
+		return
+	}
+
+	entry := &PayloadLog{
+		Direction: direction,
+		Status:    status,
+		Payload:   RedactSOAPPayload(string(raw)),
+	}
+	runSafely(func() {
+		logger(entry)
+	})
+}
+
+// logPayloads returns true if SOAP payloads are logged or dumped.
+func logPayloads() bool {
+	logger, _ := payloadLogger.Load().(func(*PayloadLog))
+	return debug || logger != nil
+}
+
+var payloadRedactPattern struct {
+	sync.Mutex
+	elements string
+	pattern  *regexp.Regexp
+}
+
+// RedactSOAPPayload returns the provided SOAP payload with the content of the
+// PayloadRedactedElements replaced.
+func RedactSOAPPayload(payload string) string {
+	names := make([]string, len(PayloadRedactedElements))
+	for idx, name := range PayloadRedactedElements {
+		names[idx] = regexp.QuoteMeta(name)
+	}
+	elements := strings.Join(names, "|")
+
+	payloadRedactPattern.Lock()
+	if payloadRedactPattern.pattern == nil || payloadRedactPattern.elements != elements {
+		// NOTE(longsleep): Redacted elements hold text only, so their content
+		// ends with the next tag unless it is CDATA.
+		payloadRedactPattern.pattern = regexp.MustCompile(`(<(?:[\w.-]+:)?(?:` + elements + `)(?:\s[^>]*)?>)(?:<!\[CDATA\[(?s:.*?)\]\]>|[^<])+`)
+		payloadRedactPattern.elements = elements
+	}
+	pattern := payloadRedactPattern.pattern
+	payloadRedactPattern.Unlock()
+
+	return pattern.ReplaceAllString(payload, "${1}"+payloadRedacted)
+}
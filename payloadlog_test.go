@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRedactSOAPPayload(t *testing.T) {
+	for _, test := range []struct {
+		payload  string
+		redacted string
+	}{
+		{"<ns:logon><szUsername>user1</szUsername><szPassword>secret</szPassword></ns:logon>", "<ns:logon><szUsername>user1</szUsername><szPassword>[REDACTED]</szPassword></ns:logon>"},
+		{"<lpszPassword xsi:type=\"xsd:string\">p&amp;w</lpszPassword>", "<lpszPassword xsi:type=\"xsd:string\">[REDACTED]</lpszPassword>"},
+		{"<wsse:Password Type=\"PasswordText\">secret</wsse:Password>", "<wsse:Password Type=\"PasswordText\">[REDACTED]</wsse:Password>"},
+		{"<lpInput><![CDATA[to<ken]]></lpInput>", "<lpInput>[REDACTED]</lpInput>"},
+		{"<ulSessionId>123</ulSessionId><er>0</er>", "<ulSessionId>[REDACTED]</ulSessionId><er>0</er>"},
+		{"<szPassword/><szPasswordHint>hint</szPasswordHint>", "<szPassword/><szPasswordHint>hint</szPasswordHint>"},
+	} {
+		if redacted := RedactSOAPPayload(test.payload); redacted != test.redacted {
+			t.Errorf("unexpected redaction of %s: %s", test.payload, redacted)
+		}
+	}
+}
+
+func TestPayloadLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(soapHeader + "<ns:logonResponse><er>0</er><ulSessionId>4711</ulSessionId></ns:logonResponse>" + soapFooter))
+	}))
+	defer srv.Close()
+
+	var mutex sync.Mutex
+	var entries []*PayloadLog
+	SetPayloadLogger(func(entry *PayloadLog) {
+		mutex.Lock()
+		entries = append(entries, entry)
+		mutex.Unlock()
+	})
+	defer SetPayloadLogger(nil)
+
+	uri, _ := url.Parse(srv.URL)
+	client, _ := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		HTTPClient: srv.Client(),
+	})
+	response, err := NewKCCWithClient(client).Logon(context.Background(), "user1", "secret", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.SessionID != 4711 {
+		t.Errorf("unexpected session id: %v", response.SessionID)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(entries) != 2 || entries[0].Direction != PayloadRequest || entries[1].Direction != PayloadResponse || entries[1].Status != http.StatusOK {
+		t.Fatalf("unexpected payload log entries: %+v", entries)
+	}
+	for _, entry := range entries {
+		if strings.Contains(entry.Payload, "secret") || strings.Contains(entry.Payload, "4711") {
+			t.Errorf("payload not redacted: %s", entry.Payload)
+		}
+	}
+	if !strings.Contains(entries[0].Payload, "<szUsername>user1</szUsername>") {
+		t.Errorf("unexpected request payload: %s", entries[0].Payload)
+	}
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSOAPSocketClientPeerOwner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kcc-go-peercred")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "server.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	sc, err := NewSOAPSocketClient(&url.URL{Scheme: "file", Path: path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc.PeerOwner = &SocketPeerOwner{UID: os.Getuid(), GID: -1}
+	conn, err := sc.connect()
+	if err != nil {
+		t.Fatalf("expected connection with matching owner, got %v", err)
+	}
+	conn.Close()
+
+	sc.PeerOwner = &SocketPeerOwner{UID: os.Getuid() + 1, GID: -1}
+	_, err = sc.connect()
+	peerErr, ok := err.(*SocketPeerError)
+	if !ok {
+		t.Fatalf("expected peer error, got %v", err)
+	}
+	if peerErr.Peer.UID != os.Getuid() || peerErr.Peer.PID != os.Getpid() {
+		t.Errorf("unexpected peer credentials: %+v", peerErr.Peer)
+	}
+}
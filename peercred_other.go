@@ -0,0 +1,35 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// SocketPeerCredentialsSupported is true if the peer credentials of Unix socket
+// connections can be checked with a SocketPeerOwner on this platform.
+const SocketPeerCredentialsSupported = false
+
+// socketPeerCredentials is not supported on this platform.
+func socketPeerCredentials(conn net.Conn) (*SocketPeerCredentials, error) {
+	return nil, fmt.Errorf("peer credentials are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,391 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errSocketPipelineBroken is returned for pipelined requests whose connection
+// was closed because another request on it failed. Requests which were sent
+// already are not retried, as the server might have processed them.
+var errSocketPipelineBroken = errors.New("pipelined socket connection closed")
+
+// A socketPipeline sends multiple requests over the connections of a
+// ConnPool without waiting for the response of the previous request, up to
+// depth requests per connection. Requests are written in the order they are
+// queued on a connection and their responses are read in the same order, each
+// request reading its own response when it is its turn.
+type socketPipeline struct {
+	pool  ConnPool
+	depth int
+
+	mutex sync.Mutex
+	conns []*pipelineConn
+}
+
+// A pipelineConn is a connection of a socketPipeline with the requests
+// waiting for their responses on it. The connection is set when ready is
+// closed, unless err is set.
+type pipelineConn struct {
+	net.Conn
+	r     *bufio.Reader
+	ready chan struct{}
+	err   error
+
+	// writeMutex serializes writes, so the queue is in write order.
+	writeMutex sync.Mutex
+
+	// The following fields are guarded by the mutex of the pipeline.
+	inflight int
+	queue    []chan struct{}
+	broken   bool
+}
+
+func newSocketPipeline(pool ConnPool, depth int) *socketPipeline {
+	return &socketPipeline{
+		pool:  pool,
+		depth: depth,
+	}
+}
+
+// get returns the least busy connection with less than depth requests in
+// flight, or a connection of the pool waiting up to the provided timeout if
+// all connections in use are busy. Connections are used as soon as they are
+// requested from the pool, so concurrent requests do not wait for the pool
+// instead. The returned connection counts the request as in flight until
+// release is called.
+func (p *socketPipeline) get(timeout time.Duration) (*pipelineConn, error) {
+	p.mutex.Lock()
+	var pc *pipelineConn
+	for _, c := range p.conns {
+		if c.inflight < p.depth && (pc == nil || c.inflight < pc.inflight) {
+			pc = c
+		}
+	}
+	if pc != nil {
+		pc.inflight++
+		p.mutex.Unlock()
+		<-pc.ready
+		if pc.err != nil {
+			return nil, pc.err
+		}
+		return pc, nil
+	}
+	pc = &pipelineConn{
+		ready:    make(chan struct{}),
+		inflight: 1,
+	}
+	p.conns = append(p.conns, pc)
+	p.mutex.Unlock()
+
+	c, err := p.pool.GetWithTimeout(timeout)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err != nil {
+		pc.err = err
+		pc.broken = true
+		p.removeLocked(pc)
+		close(pc.ready)
+		return nil, err
+	}
+	pc.Conn = c
+	pc.r = bufio.NewReader(c)
+	close(pc.ready)
+
+	return pc, nil
+}
+
+// send writes the provided request data to the provided connection and
+// queues the request for its response. The returned channel receives when it
+// is the turn of the request to read its response, or is closed when the
+// connection broke.
+func (p *socketPipeline) send(ctx context.Context, pc *pipelineConn, data func(net.Conn) error, timeout time.Duration) (<-chan struct{}, error) {
+	pc.writeMutex.Lock()
+	defer pc.writeMutex.Unlock()
+
+	turn := make(chan struct{}, 1)
+	p.mutex.Lock()
+	if pc.broken {
+		p.mutex.Unlock()
+		return nil, errSocketPipelineBroken
+	}
+	if len(pc.queue) == 0 {
+		turn <- struct{}{}
+	}
+	pc.queue = append(pc.queue, turn)
+	p.mutex.Unlock()
+
+	pc.SetWriteDeadline(socketDeadline(ctx, timeout))
+	if err := data(pc); err != nil {
+		p.mutex.Lock()
+		p.breakLocked(pc)
+		p.mutex.Unlock()
+		return nil, err
+	}
+
+	return turn, nil
+}
+
+// wait waits for the provided turn of a request sent on the provided
+// connection. If the provided context is done before, the response of the
+// request is drained in the background and the request is released when done,
+// so the other requests on the connection are not affected.
+func (p *socketPipeline) wait(ctx context.Context, pc *pipelineConn, turn <-chan struct{}, timeout time.Duration) error {
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
+
+	select {
+	case _, ok := <-turn:
+		if !ok {
+			return errSocketPipelineBroken
+		}
+		return nil
+	case <-done:
+		go p.drain(pc, turn, timeout)
+		return ctx.Err()
+	}
+}
+
+// drain reads and discards the response of a request sent on the provided
+// connection when it is its turn, then releases the request. If turn is nil,
+// it is the turn of the request already. The connection is closed if the
+// response can not be read within the provided timeout.
+func (p *socketPipeline) drain(pc *pipelineConn, turn <-chan struct{}, timeout time.Duration) {
+	if turn != nil {
+		if _, ok := <-turn; !ok {
+			p.release(pc, false)
+			return
+		}
+	}
+
+	pc.SetReadDeadline(socketDeadline(context.Background(), timeout))
+	resp, err := http.ReadResponse(pc.r, nil)
+	if err != nil {
+		p.release(pc, false)
+		return
+	}
+	p.drainBody(pc, resp.Body, isKeepAlive(resp), timeout)
+}
+
+// drainBody reads and discards the rest of the provided response body of a
+// request sent on the provided connection, then releases the request. The
+// connection is only reused if the body was read completely.
+func (p *socketPipeline) drainBody(pc *pipelineConn, body io.ReadCloser, keepAlive bool, timeout time.Duration) {
+	// Clear the deadline of an interrupted read.
+	pc.SetReadDeadline(socketDeadline(context.Background(), timeout))
+	_, err := io.Copy(ioutil.Discard, body)
+	if closeErr := body.Close(); err == nil {
+		err = closeErr
+	}
+	p.release(pc, err == nil && keepAlive)
+}
+
+// A pipelineBody is the body of a pipelined response. When it is closed after
+// the context of its request is done, the rest of the body is left to be
+// drained as reading it might have been interrupted.
+type pipelineBody struct {
+	io.ReadCloser
+	ctx context.Context
+
+	abandoned bool
+	complete  bool
+}
+
+func (b *pipelineBody) Close() error {
+	if socketContextErr(b.ctx) == nil {
+		_, err := io.Copy(ioutil.Discard, b.ReadCloser)
+		if err == nil {
+			err = b.ReadCloser.Close()
+			b.complete = err == nil
+			return err
+		}
+		if socketContextErr(b.ctx) == nil {
+			b.ReadCloser.Close()
+			return err
+		}
+	}
+
+	b.abandoned = true
+	return nil
+}
+
+// isKeepAlive returns true if the connection of the provided response can be
+// used for further requests.
+func isKeepAlive(resp *http.Response) bool {
+	return resp.Header.Get("Connection") == "keep-alive"
+}
+
+// release ends a request on the provided connection, passing the turn to the
+// next queued request. If reuse is false, the connection is closed and all
+// other requests queued on it fail. The connection is returned to the pool
+// when it has no more requests in flight.
+func (p *socketPipeline) release(pc *pipelineConn, reuse bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pc.inflight--
+	switch {
+	case pc.broken:
+		return
+	case !reuse:
+		p.breakLocked(pc)
+		return
+	}
+
+	pc.queue = pc.queue[1:]
+	if len(pc.queue) > 0 {
+		pc.queue[0] <- struct{}{}
+	}
+	if pc.inflight == 0 {
+		p.removeLocked(pc)
+		// Close makes the connection available to the pool again.
+		pc.Conn.Close()
+	}
+}
+
+// breakLocked removes the provided connection from the pool and fails all
+// requests queued on it.
+func (p *socketPipeline) breakLocked(pc *pipelineConn) {
+	if pc.broken {
+		return
+	}
+	pc.broken = true
+	for _, turn := range pc.queue {
+		close(turn)
+	}
+	pc.queue = nil
+	p.removeLocked(pc)
+	p.pool.Remove(pc.Conn)
+}
+
+// removeLocked removes the provided connection from the connections of the
+// pipeline, so no more requests are sent on it.
+func (p *socketPipeline) removeLocked(pc *pipelineConn) {
+	for idx, c := range p.conns {
+		if c == pc {
+			p.conns = append(p.conns[:idx], p.conns[idx+1:]...)
+			return
+		}
+	}
+}
+
+// doPipelinedRequest sends the provided payload data once over a pipelined
+// connection. The returned retry value is true if the request failed with a
+// transient error before the response was decoded.
+func (sc *SOAPSocketClient) doPipelinedRequest(ctx context.Context, action string, payload *string, v interface{}) (retry bool, err error) {
+	for {
+		if ctxErr := socketContextErr(ctx); ctxErr != nil {
+			return false, ctxErr
+		}
+
+		pc, err := sc.pipeline.get(sc.dialTimeout())
+		if err != nil {
+			return IsRetryable(err), fmt.Errorf("failed to open %s socket: %v", sc.network(), err)
+		}
+
+		var body *bytes.Buffer
+		profileRegion(ctx, action, profilePhaseEnvelope, func(context.Context) {
+			body = soapEnvelope(payload, soapHeaders(ctx, sc.Headers))
+		})
+
+		turn, err := sc.pipeline.send(ctx, pc, func(c net.Conn) error {
+			_, writeErr := body.WriteTo(c)
+			return writeErr
+		}, sc.writeTimeout())
+		if err != nil {
+			// Retry on any write error like unpipelined requests do, the
+			// request was not sent completely.
+			sc.pipeline.release(pc, false)
+			if ctxErr := socketContextErr(ctx); ctxErr != nil {
+				return false, ctxErr
+			}
+			continue
+		}
+
+		if err = sc.pipeline.wait(ctx, pc, turn, sc.readTimeout()); err != nil {
+			if err != errSocketPipelineBroken {
+				// The request is released once its response was drained.
+				return false, err
+			}
+			sc.pipeline.release(pc, false)
+			if ctxErr := socketContextErr(ctx); ctxErr != nil {
+				return false, ctxErr
+			}
+			// Do not retry, the request was sent already.
+			return false, fmt.Errorf("failed to read from %s socket: %v", sc.network(), err)
+		}
+
+		// NOTE(longsleep): Only reads are interrupted when the context is
+		// done, as others might be writing to the connection. Nothing is
+		// consumed while waiting for the response to start, so all of it can
+		// be drained after an interrupt.
+		stop := interruptReadOnDone(ctx, pc)
+		pc.SetReadDeadline(socketDeadline(ctx, sc.readTimeout()))
+		_, err = pc.r.Peek(1)
+		stop()
+		if err != nil {
+			if ctxErr := socketContextErr(ctx); ctxErr != nil {
+				go sc.pipeline.drain(pc, nil, sc.readTimeout())
+				return false, ctxErr
+			}
+			sc.pipeline.release(pc, false)
+			return false, fmt.Errorf("failed to read from %s socket: %v", sc.network(), err)
+		}
+
+		// The response headers are read without interrupts, as reading them
+		// can not be resumed.
+		pc.SetReadDeadline(socketDeadline(context.Background(), sc.readTimeout()))
+		resp, err := http.ReadResponse(pc.r, nil)
+		if err != nil {
+			sc.pipeline.release(pc, false)
+			// Do not retry, the request was sent already.
+			return false, fmt.Errorf("failed to read from %s socket: %v", sc.network(), err)
+		}
+
+		// Reads of the body are resumed when draining it.
+		respBody := &pipelineBody{
+			ReadCloser: resp.Body,
+			ctx:        ctx,
+		}
+		resp.Body = respBody
+		keepAlive := isKeepAlive(resp)
+		stop = interruptReadOnDone(ctx, pc)
+		pc.SetReadDeadline(socketDeadline(ctx, sc.readTimeout()))
+
+		return sc.decodeResponse(ctx, action, resp, v, stop, func(bool) {
+			if respBody.abandoned {
+				go sc.pipeline.drainBody(pc, respBody.ReadCloser, keepAlive, sc.readTimeout())
+				return
+			}
+			sc.pipeline.release(pc, respBody.complete && keepAlive)
+		})
+	}
+}
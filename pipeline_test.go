@@ -0,0 +1,347 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var pipelineUsernameRe = regexp.MustCompile("<lpszUsername>([^<]*)</lpszUsername>")
+
+// pipelineServer serves resolveUsername requests on a TCP listener, echoing
+// the username. Requests are collected until batch requests arrived on a
+// connection or no more arrive for a while, then all are answered in order.
+// The first connection is closed after reading drop requests, if not 0.
+// Returns the URI of the server, a function returning the number of accepted
+// connections and the largest batch answered at once, and the listener.
+func pipelineServer(t *testing.T, batch, drop int) (*url.URL, func() (int, int), net.Listener) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mutex sync.Mutex
+	accepted, largest := 0, 0
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mutex.Lock()
+			accepted++
+			first := accepted == 1
+			mutex.Unlock()
+			go func() {
+				defer conn.Close()
+				requests := make(chan string)
+				go func() {
+					defer close(requests)
+					r := bufio.NewReader(conn)
+					for {
+						request, err := r.ReadString('>')
+						for err == nil && !strings.HasSuffix(request, soapFooter) {
+							var more string
+							more, err = r.ReadString('>')
+							request += more
+						}
+						if err != nil {
+							return
+						}
+						requests <- pipelineUsernameRe.FindStringSubmatch(request)[1]
+					}
+				}()
+
+				received := 0
+				for username := range requests {
+					pending := []string{username}
+					received++
+					timeout := time.After(200 * time.Millisecond)
+				collect:
+					for len(pending) < batch && (!first || received != drop) {
+						select {
+						case username, ok := <-requests:
+							if !ok {
+								return
+							}
+							pending = append(pending, username)
+							received++
+						case <-timeout:
+							break collect
+						}
+					}
+					if first && received == drop {
+						return
+					}
+
+					mutex.Lock()
+					if len(pending) > largest {
+						largest = len(pending)
+					}
+					mutex.Unlock()
+					for _, username := range pending {
+						body := soapHeader + "<ns:resolveUserResponse><er>0</er><sUserId>" + username + "-id</sUserId></ns:resolveUserResponse>" + soapFooter
+						fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nConnection: keep-alive\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+					}
+				}
+			}()
+		}
+	}()
+
+	uri, _ := url.Parse("tcp://" + listener.Addr().String())
+	return uri, func() (int, int) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return accepted, largest
+	}, listener
+}
+
+// resolveConcurrently resolves n usernames concurrently with the provided
+// client and checks the responses.
+func resolveConcurrently(t *testing.T, client SOAPClient, n int) {
+	c := NewKCCWithClient(client)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(username string) {
+			defer wg.Done()
+			resp, err := c.ResolveUsername(context.Background(), username, 1)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if resp.UserEntryID != username+"-id" {
+				t.Errorf("expected response of %s, got %s", username, resp.UserEntryID)
+			}
+		}(fmt.Sprintf("user%d", i))
+	}
+	wg.Wait()
+}
+
+func TestSOAPSocketClientPipeline(t *testing.T) {
+	uri, stats, listener := pipelineServer(t, 3, 0)
+	defer listener.Close()
+	poolConfig := NewSocketPoolConfig()
+	poolConfig.MaxConnections = 1
+	poolConfig.PipelineDepth = 3
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		SocketPool: poolConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolveConcurrently(t, client, 3)
+	accepted, largest := stats()
+	if accepted != 1 {
+		t.Errorf("expected 1 connection, got %d", accepted)
+	}
+	if largest != 3 {
+		t.Errorf("expected 3 requests in flight, got %d", largest)
+	}
+
+	// Sequential requests reuse the connection.
+	resolveConcurrently(t, client, 1)
+	resolveConcurrently(t, client, 1)
+	if accepted, _ := stats(); accepted != 1 {
+		t.Errorf("expected connection to be reused, got %d connections", accepted)
+	}
+}
+
+func TestSOAPSocketClientPipelineBroken(t *testing.T) {
+	uri, stats, listener := pipelineServer(t, 3, 3)
+	defer listener.Close()
+	poolConfig := NewSocketPoolConfig()
+	poolConfig.MaxConnections = 1
+	poolConfig.PipelineDepth = 3
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		SocketPool:  poolConfig,
+		RetryPolicy: &RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests sent on the dropped connection are not retried, the server
+	// might have processed them.
+	c := NewKCCWithClient(client)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(username string) {
+			defer wg.Done()
+			if _, err := c.ResolveUsername(context.Background(), username, 1); err == nil {
+				t.Errorf("expected request of %s to fail", username)
+			}
+		}(fmt.Sprintf("user%d", i))
+	}
+	wg.Wait()
+
+	// Later requests use a new connection.
+	resolveConcurrently(t, client, 1)
+	if accepted, _ := stats(); accepted != 2 {
+		t.Errorf("expected 2 connections, got %d", accepted)
+	}
+}
+
+func TestSOAPSocketClientPipelineCanceled(t *testing.T) {
+	uri, stats, listener := pipelineServer(t, 4, 0)
+	defer listener.Close()
+	poolConfig := NewSocketPoolConfig()
+	poolConfig.MaxConnections = 1
+	poolConfig.PipelineDepth = 3
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		SocketPool: poolConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The canceled request is queued behind the first one, the server only
+	// answers after it was canceled.
+	c := NewKCCWithClient(client)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		resolveConcurrently(t, client, 1)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if _, err := c.ResolveUsername(ctx, "canceled", 1); err == nil {
+			t.Error("expected canceled request to fail")
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	resolveConcurrently(t, client, 1)
+	wg.Wait()
+
+	// The response of the canceled request was drained, so the connection
+	// is reused.
+	resolveConcurrently(t, client, 1)
+	if accepted, _ := stats(); accepted != 1 {
+		t.Errorf("expected connection to be reused, got %d connections", accepted)
+	}
+}
+
+func TestSOAPSocketClientPipelineCanceledReading(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// The response of the slow user is sent in two parts, the connection is
+	// only accepted once.
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			request, err := r.ReadString('>')
+			for err == nil && !strings.HasSuffix(request, soapFooter) {
+				var more string
+				more, err = r.ReadString('>')
+				request += more
+			}
+			if err != nil {
+				return
+			}
+			username := pipelineUsernameRe.FindStringSubmatch(request)[1]
+			body := soapHeader + "<ns:resolveUserResponse><er>0</er><sUserId>" + username + "-id</sUserId></ns:resolveUserResponse>" + soapFooter
+			response := fmt.Sprintf("HTTP/1.1 200 OK\r\nConnection: keep-alive\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+			if username == "slow" {
+				split := len(response) - len(body)/2
+				conn.Write([]byte(response[:split]))
+				time.Sleep(200 * time.Millisecond)
+				response = response[split:]
+			}
+			conn.Write([]byte(response))
+		}
+	}()
+
+	uri, _ := url.Parse("tcp://" + listener.Addr().String())
+	poolConfig := NewSocketPoolConfig()
+	poolConfig.MaxConnections = 1
+	poolConfig.PipelineDepth = 2
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		SocketPool: poolConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The slow request is canceled while reading its response, the request
+	// queued behind it on the same connection still succeeds.
+	c := NewKCCWithClient(client)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		started := time.Now()
+		if _, err := c.ResolveUsername(ctx, "slow", 1); err == nil {
+			t.Error("expected canceled request to fail")
+		}
+		if elapsed := time.Since(started); elapsed > 150*time.Millisecond {
+			t.Errorf("expected canceled request to return early, took %v", elapsed)
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	resolveConcurrently(t, client, 1)
+	wg.Wait()
+
+	// The connection is reused, the server only accepts one.
+	resolveConcurrently(t, client, 1)
+}
+
+func TestSOAPSocketClientPipelineDisabled(t *testing.T) {
+	uri, stats, listener := pipelineServer(t, 1, 0)
+	defer listener.Close()
+	poolConfig := NewSocketPoolConfig()
+	poolConfig.MaxConnections = 2
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		SocketPool: poolConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.(*SOAPSocketClient).pipeline != nil {
+		t.Fatal("expected pipelining to be disabled by default")
+	}
+
+	resolveConcurrently(t, client, 4)
+	if _, largest := stats(); largest != 1 {
+		t.Errorf("expected 1 request in flight per connection, got %d", largest)
+	}
+}
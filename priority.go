@@ -0,0 +1,203 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"sync"
+)
+
+// A Priority is the scheduling class of requests. Requests with higher
+// priority are served first when waiting for rate limiter tokens or pooled
+// connections.
+type Priority int
+
+// Priority values, highest first.
+const (
+	// PriorityInteractive is for requests a user waits for, like logon or
+	// fetching user details. It is the default.
+	PriorityInteractive Priority = iota
+	// PriorityBatch is for bulk requests like exports and syncs.
+	PriorityBatch
+
+	numPriorities = iota
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityInteractive:
+		return "interactive"
+	case PriorityBatch:
+		return "batch"
+	default:
+		return "unknown"
+	}
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of the provided context with the provided
+// Priority. Requests using the returned context are scheduled accordingly.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the Priority of the provided context. Contexts
+// without Priority are PriorityInteractive.
+func PriorityFromContext(ctx context.Context) Priority {
+	if ctx != nil {
+		if p, ok := ctx.Value(priorityKey{}).(Priority); ok && p >= 0 && p < numPriorities {
+			return p
+		}
+	}
+
+	return PriorityInteractive
+}
+
+// A priorityWaiter is a request waiting in a priorityQueue. Its ready channel
+// is closed when the request is granted.
+type priorityWaiter struct {
+	ready chan struct{}
+}
+
+// A priorityQueue holds waiting requests in FIFO order per priority. It is not
+// safe for concurrent use.
+type priorityQueue [numPriorities][]*priorityWaiter
+
+// push adds a new waiter with the provided priority.
+func (q *priorityQueue) push(p Priority) *priorityWaiter {
+	w := &priorityWaiter{
+		ready: make(chan struct{}),
+	}
+	q[p] = append(q[p], w)
+
+	return w
+}
+
+// pop removes and returns the first waiter with the highest priority, or nil
+// if there are no waiters.
+func (q *priorityQueue) pop() *priorityWaiter {
+	for p := range q {
+		if len(q[p]) > 0 {
+			w := q[p][0]
+			q[p][0] = nil
+			q[p] = q[p][1:]
+			return w
+		}
+	}
+
+	return nil
+}
+
+// remove removes the provided waiter. It returns false if the waiter was not
+// found, which means it was already granted.
+func (q *priorityQueue) remove(w *priorityWaiter) bool {
+	for p := range q {
+		for idx, entry := range q[p] {
+			if entry == w {
+				q[p] = append(q[p][:idx], q[p][idx+1:]...)
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// waiting returns true if there are waiters with the provided or a higher
+// priority.
+func (q *priorityQueue) waiting(p Priority) bool {
+	for idx := Priority(0); idx <= p; idx++ {
+		if len(q[idx]) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// len returns the number of waiters.
+func (q *priorityQueue) len() int {
+	n := 0
+	for p := range q {
+		n += len(q[p])
+	}
+
+	return n
+}
+
+// A prioritySemaphore limits the number of concurrent requests, handing out
+// free slots to waiting requests by priority.
+type prioritySemaphore struct {
+	mutex sync.Mutex
+	size  int
+	used  int
+	queue priorityQueue
+}
+
+func newPrioritySemaphore(size int) *prioritySemaphore {
+	return &prioritySemaphore{
+		size: size,
+	}
+}
+
+// acquire blocks until a slot is available for the Priority of the provided
+// context or until the provided context is done.
+func (s *prioritySemaphore) acquire(ctx context.Context) error {
+	p := PriorityFromContext(ctx)
+
+	s.mutex.Lock()
+	if s.used < s.size && !s.queue.waiting(p) {
+		s.used++
+		s.mutex.Unlock()
+		return nil
+	}
+	w := s.queue.push(p)
+	s.mutex.Unlock()
+
+	beginBackendWait()
+	select {
+	case <-w.ready:
+		endBackendWait(ctx, nil)
+		return nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		if !s.queue.remove(w) {
+			// Was granted meanwhile, give it back.
+			s.releaseLocked()
+		}
+		s.mutex.Unlock()
+		endBackendWait(ctx, ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// release returns a slot acquired with acquire.
+func (s *prioritySemaphore) release() {
+	s.mutex.Lock()
+	s.releaseLocked()
+	s.mutex.Unlock()
+}
+
+func (s *prioritySemaphore) releaseLocked() {
+	if w := s.queue.pop(); w != nil {
+		// Hand over the slot directly.
+		close(w.ready)
+		return
+	}
+	s.used--
+}
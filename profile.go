@@ -0,0 +1,51 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// Profiling phases of SOAP requests.
+const (
+	profilePhaseEnvelope = "envelope"
+	profilePhaseDecode   = "decode"
+)
+
+// Labels set on goroutines while they are in a profiled phase of a SOAP
+// request, so CPU and allocation profiles can be filtered by SOAP action with
+// for example `go tool pprof -tagfocus kcc.action=getUser`.
+const (
+	profileLabelAction = "kcc.action"
+	profileLabelPhase  = "kcc.phase"
+)
+
+// profileRegion runs the provided function in a runtime/trace region named
+// after the provided phase and SOAP action, with pprof labels for both. The
+// context passed to the function carries the labels.
+func profileRegion(ctx context.Context, action, phase string, f func(context.Context)) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	pprof.Do(ctx, pprof.Labels(profileLabelAction, action, profileLabelPhase, phase), func(ctx context.Context) {
+		defer trace.StartRegion(ctx, "kcc."+phase+":"+action).End()
+		f(ctx)
+	})
+}
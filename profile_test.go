@@ -0,0 +1,44 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+)
+
+func TestProfileRegion(t *testing.T) {
+	action := soapAction("<ns:getUser><sUserId>x</sUserId></ns:getUser>")
+	if action != "getUser" {
+		t.Fatalf("unexpected action: %v", action)
+	}
+
+	called := false
+	profileRegion(nil, action, profilePhaseDecode, func(ctx context.Context) {
+		called = true
+		if value, _ := pprof.Label(ctx, profileLabelAction); value != "getUser" {
+			t.Errorf("unexpected action label: %v", value)
+		}
+		if value, _ := pprof.Label(ctx, profileLabelPhase); value != profilePhaseDecode {
+			t.Errorf("unexpected phase label: %v", value)
+		}
+	})
+	if !called {
+		t.Error("function was not called")
+	}
+}
@@ -370,6 +370,7 @@ var (
 	PR_MESSAGE_DELIVERY_TIME                      = propTag(PT_SYSTIME, 0x0E06)
 	PR_MESSAGE_FLAGS                              = propTag(PT_LONG, 0x0E07)
 	PR_MESSAGE_SIZE                               = propTag(PT_LONG, 0x0E08)
+	PR_MESSAGE_SIZE_EXTENDED                      = propTag(PT_LONGLONG, 0x0E08)
 	PR_PARENT_ENTRYID                             = propTag(PT_BINARY, 0x0E09)
 	PR_SENTMAIL_ENTRYID                           = propTag(PT_BINARY, 0x0E0A)
 	PR_CORRELATE                                  = propTag(PT_BOOLEAN, 0x0E0C)
@@ -837,6 +838,13 @@ var (
 	PR_ATTACH_CONTENT_LOCATION_W            = (propTag(PT_UNICODE, 0x3713))
 	PR_USER_X509_CERTIFICATE                = (propTag(PT_MV_BINARY, 0x3a70))
 	PR_EMS_AB_X509_CERT                     = propTag(PT_MV_BINARY, 0x8c6a)
+	PR_EMS_AB_PROXY_ADDRESSES               = propTag(PT_MV_TSTRING, 0x800F)
+	PR_EMS_AB_PROXY_ADDRESSES_A             = propTag(PT_MV_STRING8, 0x800F)
+	PR_EMS_AB_PROXY_ADDRESSES_W             = propTag(PT_MV_UNICODE, 0x800F)
+	PR_EMS_AB_TARGET_ADDRESS                = propTag(PT_TSTRING, 0x8011)
+	PR_EMS_AB_TARGET_ADDRESS_A              = propTag(PT_STRING8, 0x8011)
+	PR_EMS_AB_TARGET_ADDRESS_W              = propTag(PT_UNICODE, 0x8011)
+	PR_PROHIBIT_RECEIVE_QUOTA               = propTag(PT_LONG, 0x666A)
 	PR_NT_SECURITY_DESCRIPTOR               = (propTag(PT_BINARY, 0x0E27))
 	PR_BODY_HTML                            = (propTag(PT_TSTRING, 0x1013))
 	PR_INTERNET_MESSAGE_ID                  = propTag(PT_TSTRING, 0x1035)
@@ -1009,6 +1017,9 @@ var (
 	PR_SCHDINFO_BOSS_WANTS_INFO             = propTag(PT_BOOLEAN, 0x684B)
 	PR_PROFILE_MDB_DN                       = propTag(PT_STRING8, 0x7CFF)
 	PR_FORCE_USE_ENTRYID_SERVER             = propTag(PT_BOOLEAN, 0x7CFE)
+	PR_SOURCE_KEY                           = propTag(PT_BINARY, 0x65E0)
+	PR_PARENT_SOURCE_KEY                    = propTag(PT_BINARY, 0x65E1)
+	PR_CHANGE_KEY                           = propTag(PT_BINARY, 0x65E2)
 )
 
 // Property names as defined in m4lcommon/include/kopano/ECTags.h. This defines
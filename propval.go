@@ -0,0 +1,345 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileTimeUnixOffset is the number of 100-nanosecond intervals between the
+// FILETIME epoch (1601-01-01) and the Unix epoch (1970-01-01).
+const fileTimeUnixOffset = 116444736000000000
+
+// Type returns the property type part of the accociated PT.
+func (pt PT) Type() uint64 {
+	return uint64(pt) & PROP_TYPE_MASK
+}
+
+// ID returns the property ID part of the accociated PT.
+func (pt PT) ID() uint64 {
+	return uint64(pt) >> 16
+}
+
+// A HiLoLong represents a 64 bit value split into two 32 bit parts as used by
+// Kopano SOAP for PT_SYSTIME and PT_CURRENCY values.
+type HiLoLong struct {
+	Hi int32  `xml:"hi" json:"hi"`
+	Lo uint32 `xml:"lo" json:"lo"`
+}
+
+// NewHiLoLongFromTime returns the FILETIME representation of the provided
+// time as HiLoLong.
+func NewHiLoLongFromTime(t time.Time) *HiLoLong {
+	ft := uint64(t.Unix()*10000000 + int64(t.Nanosecond()/100) + fileTimeUnixOffset)
+	return &HiLoLong{
+		Hi: int32(ft >> 32),
+		Lo: uint32(ft),
+	}
+}
+
+// Time returns the accociated HiLoLong FILETIME value as time.Time.
+func (hl *HiLoLong) Time() time.Time {
+	ft := int64(uint64(uint32(hl.Hi))<<32|uint64(hl.Lo)) - fileTimeUnixOffset
+	return time.Unix(ft/10000000, (ft%10000000)*100).UTC()
+}
+
+// Get returns the accociated PropTagRowSet's value for the provided prop tag.
+// When the property is not found, nil and false is returned.
+func (rs *PropTagRowSet) Get(pt PT) (*PropTagRowSetValue, bool) {
+	if rs == nil {
+		return nil, false
+	}
+	for _, value := range rs.PropTagValues {
+		if value.PropTag == pt {
+			return value, true
+		}
+	}
+
+	return nil, false
+}
+
+// GetString is a helper to return the string value of the provided prop tag.
+// The empty string is returned if the property is not found.
+func (rs *PropTagRowSet) GetString(pt PT) string {
+	if value, ok := rs.Get(pt); ok {
+		return value.AStringValue
+	}
+	return ""
+}
+
+// GetTime is a helper to return the time value of the provided prop tag. The
+// zero time is returned if the property is not found.
+func (rs *PropTagRowSet) GetTime(pt PT) time.Time {
+	if value, ok := rs.Get(pt); ok && value.HiLoValue != nil {
+		return value.HiLoValue.Time()
+	}
+	return time.Time{}
+}
+
+// StringPropValue creates a new string value for the provided prop tag.
+func StringPropValue(pt PT, value string) *PropTagRowSetValue {
+	return &PropTagRowSetValue{
+		PropTag:      pt,
+		AStringValue: value,
+	}
+}
+
+// ULPropValue creates a new unsigned long value for the provided prop tag.
+func ULPropValue(pt PT, value uint64) *PropTagRowSetValue {
+	return &PropTagRowSetValue{
+		PropTag: pt,
+		ULValue: value,
+	}
+}
+
+// BoolPropValue creates a new boolean value for the provided prop tag.
+func BoolPropValue(pt PT, value bool) *PropTagRowSetValue {
+	return &PropTagRowSetValue{
+		PropTag:   pt,
+		BoolValue: value,
+	}
+}
+
+// TimePropValue creates a new systime value for the provided prop tag.
+func TimePropValue(pt PT, value time.Time) *PropTagRowSetValue {
+	return &PropTagRowSetValue{
+		PropTag:   pt,
+		HiLoValue: NewHiLoLongFromTime(value),
+	}
+}
+
+// BinPropValue creates a new binary value for the provided prop tag. The
+// provided value is base64Std encoded as Kopano SOAP transports binary
+// values that way.
+func BinPropValue(pt PT, value []byte) *PropTagRowSetValue {
+	return &PropTagRowSetValue{
+		PropTag:  pt,
+		BinValue: []byte(base64.StdEncoding.EncodeToString(value)),
+	}
+}
+
+// Bytes returns the base64Std decoded binary value of the accociated
+// PropTagRowSetValue.
+func (v *PropTagRowSetValue) Bytes() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(string(v.BinValue))
+}
+
+// propTypeNames maps property types to their MAPI names.
+var propTypeNames = map[uint64]string{
+	PT_UNSPECIFIED: "PT_UNSPECIFIED",
+	PT_NULL:        "PT_NULL",
+	PT_SHORT:       "PT_SHORT",
+	PT_LONG:        "PT_LONG",
+	PT_FLOAT:       "PT_FLOAT",
+	PT_DOUBLE:      "PT_DOUBLE",
+	PT_CURRENCY:    "PT_CURRENCY",
+	PT_APPTIME:     "PT_APPTIME",
+	PT_ERROR:       "PT_ERROR",
+	PT_BOOLEAN:     "PT_BOOLEAN",
+	PT_OBJECT:      "PT_OBJECT",
+	PT_LONGLONG:    "PT_LONGLONG",
+	PT_STRING8:     "PT_STRING8",
+	PT_UNICODE:     "PT_UNICODE",
+	PT_SYSTIME:     "PT_SYSTIME",
+	PT_CLSID:       "PT_CLSID",
+	PT_BINARY:      "PT_BINARY",
+	PT_MV_SHORT:    "PT_MV_SHORT",
+	PT_MV_LONG:     "PT_MV_LONG",
+	PT_MV_FLOAT:    "PT_MV_FLOAT",
+	PT_MV_DOUBLE:   "PT_MV_DOUBLE",
+	PT_MV_CURRENCY: "PT_MV_CURRENCY",
+	PT_MV_APPTIME:  "PT_MV_APPTIME",
+	PT_MV_SYSTIME:  "PT_MV_SYSTIME",
+	PT_MV_STRING8:  "PT_MV_STRING8",
+	PT_MV_BINARY:   "PT_MV_BINARY",
+	PT_MV_UNICODE:  "PT_MV_UNICODE",
+	PT_MV_CLSID:    "PT_MV_CLSID",
+	PT_MV_LONGLONG: "PT_MV_LONGLONG",
+}
+
+// TypeName returns the MAPI name of the property type of the accociated PT.
+func (pt PT) TypeName() string {
+	if name, ok := propTypeNames[pt.Type()]; ok {
+		return name
+	}
+	return fmt.Sprintf("PT(0x%04x)", pt.Type())
+}
+
+// Value returns the value of the accociated PropTagRowSetValue as Go value
+// of the type matching the type of its prop tag. Binary values are returned
+// decoded. Nil is returned for unsupported types.
+func (v *PropTagRowSetValue) Value() interface{} {
+	switch v.PropTag.Type() {
+	case PT_SHORT:
+		return v.I16Value
+	case PT_LONG, PT_ERROR:
+		return v.ULValue
+	case PT_FLOAT:
+		return v.FltValue
+	case PT_DOUBLE, PT_APPTIME:
+		return v.DblValue
+	case PT_BOOLEAN:
+		return v.BoolValue
+	case PT_LONGLONG:
+		return v.LIValue
+	case PT_SYSTIME:
+		if v.HiLoValue == nil {
+			return nil
+		}
+		return v.HiLoValue.Time()
+	case PT_CURRENCY:
+		if v.HiLoValue == nil {
+			return nil
+		}
+		return int64(v.HiLoValue.Hi)<<32 | int64(v.HiLoValue.Lo)
+	case PT_STRING8, PT_UNICODE:
+		return v.AStringValue
+	case PT_BINARY:
+		value, err := v.Bytes()
+		if err != nil {
+			return nil
+		}
+		return value
+	case PT_MV_STRING8, PT_MV_UNICODE:
+		return v.AStringValues
+	case PT_MV_LONG:
+		return v.ULValues
+	default:
+		return nil
+	}
+}
+
+// writePropVal writes the SOAP representation of the provided value to the
+// provided builder, selecting the value field by the type of the prop tag.
+func writePropVal(b *strings.Builder, v *PropTagRowSetValue) error {
+	b.WriteString("<ulPropTag>")
+	b.WriteString(v.PropTag.String())
+	b.WriteString("</ulPropTag>")
+
+	switch v.PropTag.Type() {
+	case PT_SHORT:
+		b.WriteString("<i>")
+		b.WriteString(strconv.FormatInt(int64(v.I16Value), 10))
+		b.WriteString("</i>")
+	case PT_LONG, PT_ERROR:
+		b.WriteString("<ul>")
+		b.WriteString(strconv.FormatUint(v.ULValue, 10))
+		b.WriteString("</ul>")
+	case PT_FLOAT:
+		b.WriteString("<flt>")
+		b.WriteString(strconv.FormatFloat(float64(v.FltValue), 'g', -1, 32))
+		b.WriteString("</flt>")
+	case PT_DOUBLE, PT_APPTIME:
+		b.WriteString("<dbl>")
+		b.WriteString(strconv.FormatFloat(v.DblValue, 'g', -1, 64))
+		b.WriteString("</dbl>")
+	case PT_BOOLEAN:
+		b.WriteString("<b>")
+		b.WriteString(strconv.FormatBool(v.BoolValue))
+		b.WriteString("</b>")
+	case PT_LONGLONG:
+		b.WriteString("<li>")
+		b.WriteString(strconv.FormatInt(v.LIValue, 10))
+		b.WriteString("</li>")
+	case PT_SYSTIME, PT_CURRENCY:
+		hilo := v.HiLoValue
+		if hilo == nil {
+			hilo = &HiLoLong{}
+		}
+		b.WriteString("<hilo><hi>")
+		b.WriteString(strconv.FormatInt(int64(hilo.Hi), 10))
+		b.WriteString("</hi><lo>")
+		b.WriteString(strconv.FormatUint(uint64(hilo.Lo), 10))
+		b.WriteString("</lo></hilo>")
+	case PT_STRING8, PT_UNICODE:
+		b.WriteString("<lpszA>")
+		b.WriteString(xmlCharData(v.AStringValue).Escape())
+		b.WriteString("</lpszA>")
+	case PT_BINARY:
+		b.WriteString("<bin>")
+		b.Write(v.BinValue)
+		b.WriteString("</bin>")
+	case PT_MV_STRING8, PT_MV_UNICODE:
+		b.WriteString("<mvszA SOAP-ENC:arrayType=\"xsd:string[")
+		b.WriteString(strconv.FormatInt(int64(len(v.AStringValues)), 10))
+		b.WriteString("]\">")
+		for _, s := range v.AStringValues {
+			b.WriteString("<item>")
+			b.WriteString(xmlCharData(s).Escape())
+			b.WriteString("</item>")
+		}
+		b.WriteString("</mvszA>")
+	case PT_MV_LONG:
+		b.WriteString("<mvl SOAP-ENC:arrayType=\"xsd:unsignedInt[")
+		b.WriteString(strconv.FormatInt(int64(len(v.ULValues)), 10))
+		b.WriteString("]\">")
+		for _, ul := range v.ULValues {
+			b.WriteString("<item>")
+			b.WriteString(strconv.FormatUint(ul, 10))
+			b.WriteString("</item>")
+		}
+		b.WriteString("</mvl>")
+	default:
+		return fmt.Errorf("unsupported prop type 0x%x for prop tag 0x%x", v.PropTag.Type(), uint64(v.PropTag))
+	}
+
+	return nil
+}
+
+// writePropValArray writes the provided values as SOAP propVal array with the
+// provided element name to the provided builder.
+func writePropValArray(b *strings.Builder, name string, values []*PropTagRowSetValue) error {
+	b.WriteString("<")
+	b.WriteString(name)
+	b.WriteString(" SOAP-ENC:arrayType=\"propVal[")
+	b.WriteString(strconv.FormatInt(int64(len(values)), 10))
+	b.WriteString("]\">")
+	for _, value := range values {
+		b.WriteString("<item>")
+		if err := writePropVal(b, value); err != nil {
+			return err
+		}
+		b.WriteString("</item>")
+	}
+	b.WriteString("</")
+	b.WriteString(name)
+	b.WriteString(">")
+
+	return nil
+}
+
+// writePropTagArray writes the provided prop tags as SOAP propTag array with
+// the provided element name to the provided builder.
+func writePropTagArray(b *strings.Builder, name string, props []PT) {
+	b.WriteString("<")
+	b.WriteString(name)
+	b.WriteString(" SOAP-ENC:arrayType=\"xsd:unsignedInt[")
+	b.WriteString(strconv.FormatInt(int64(len(props)), 10))
+	b.WriteString("]\">")
+	for _, prop := range props {
+		b.WriteString("<item>")
+		b.WriteString(prop.String())
+		b.WriteString("</item>")
+	}
+	b.WriteString("</")
+	b.WriteString(name)
+	b.WriteString(">")
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHiLoLongTime(t *testing.T) {
+	values := []time.Time{
+		time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2019, 7, 9, 12, 30, 15, 0, time.UTC),
+		time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	for idx, value := range values {
+		hilo := NewHiLoLongFromTime(value)
+		if got := hilo.Time(); !got.Equal(value) {
+			t.Errorf("HiLoLong(%d) time mismatch: got %v want %v", idx, got, value)
+		}
+	}
+
+	// 2019-01-01T00:00:00Z as FILETIME is 0x01D4A164_F03E4000.
+	hilo := NewHiLoLongFromTime(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	if hilo.Hi != 0x01D4A164 || hilo.Lo != 0xF03E4000 {
+		t.Errorf("HiLoLong unexpected value: got 0x%x 0x%x", hilo.Hi, hilo.Lo)
+	}
+}
+
+func TestWritePropVal(t *testing.T) {
+	values := []*PropTagRowSetValue{
+		StringPropValue(PR_SUBJECT, "<hello>"),
+		ULPropValue(PR_MESSAGE_FLAGS, 9),
+		BoolPropValue(PR_DELETE_AFTER_SUBMIT, true),
+		BinPropValue(PR_ENTRYID, []byte{1, 2, 3}),
+		{PropTag: PR_DISPLAY_NAME, AStringValue: "a&b"},
+	}
+	expected := []string{
+		"<ulPropTag>3604511</ulPropTag><lpszA>&lt;hello&gt;</lpszA>",
+		"<ulPropTag>235339779</ulPropTag><ul>9</ul>",
+		"<ulPropTag>234946571</ulPropTag><b>true</b>",
+		"<ulPropTag>268370178</ulPropTag><bin>AQID</bin>",
+		"<ulPropTag>805371935</ulPropTag><lpszA>a&amp;b</lpszA>",
+	}
+
+	for idx, value := range values {
+		var b strings.Builder
+		if err := writePropVal(&b, value); err != nil {
+			t.Fatalf("writePropVal(%d) failed: %v", idx, err)
+		}
+		if b.String() != expected[idx] {
+			t.Errorf("writePropVal(%d) mismatch: got %v want %v", idx, b.String(), expected[idx])
+		}
+	}
+
+	var b strings.Builder
+	if err := writePropVal(&b, &PropTagRowSetValue{PropTag: PR_EC_STATSTABLE_SYSTEM}); err == nil {
+		t.Errorf("writePropVal with object type did not fail")
+	}
+}
+
+func TestPropTagRowSetValueValue(t *testing.T) {
+	ts := time.Date(2019, 7, 9, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		value    *PropTagRowSetValue
+		expected interface{}
+	}{
+		{StringPropValue(PR_SUBJECT, "subject"), "subject"},
+		{ULPropValue(PR_MESSAGE_FLAGS, 5), uint64(5)},
+		{BoolPropValue(PR_DELETE_AFTER_SUBMIT, true), true},
+		{TimePropValue(PR_LAST_MODIFICATION_TIME, ts), ts},
+		{BinPropValue(PR_ENTRYID, []byte{1, 2, 3}), []byte{1, 2, 3}},
+	} {
+		if value := test.value.Value(); !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("%s: got %#v, expected %#v", test.value.PropTag.TypeName(), value, test.expected)
+		}
+	}
+}
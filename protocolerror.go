@@ -0,0 +1,202 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A ProtocolErrorKind classifies responses which are not the SOAP responses
+// expected from a Kopano server.
+type ProtocolErrorKind string
+
+// Kinds of protocol errors.
+const (
+	ProtocolErrorEmpty           ProtocolErrorKind = "empty"
+	ProtocolErrorHTML            ProtocolErrorKind = "html"
+	ProtocolErrorNotXML          ProtocolErrorKind = "not-xml"
+	ProtocolErrorNotSOAP         ProtocolErrorKind = "not-soap"
+	ProtocolErrorFault           ProtocolErrorKind = "soap-fault"
+	ProtocolErrorVersionMismatch ProtocolErrorKind = "version-mismatch"
+)
+
+// Hints of protocol errors, pointing to the usual cause.
+const (
+	protocolHintEmpty           = "the server sent no content, check that the server URI points to a Kopano server"
+	protocolHintHTML            = "the server URI points to a web page (for example the webapp), expected the Kopano server SOAP endpoint like http://127.0.0.1:236 or the /soap path of a reverse proxy"
+	protocolHintNotXML          = "the server URI does not point to a Kopano server, expected the SOAP endpoint like http://127.0.0.1:236"
+	protocolHintNotSOAP         = "the server URI points to a service which is not a Kopano server, expected the SOAP endpoint like http://127.0.0.1:236"
+	protocolHintFault           = "the Kopano server rejected the request, see the server log for details"
+	protocolHintVersionMismatch = "the Kopano server does not understand the requests of this client (client version %d), check that the kcc-go and Kopano server versions are compatible"
+)
+
+// A ProtocolError is returned when the backend answers with something else
+// than the expected SOAP response, usually caused by a misconfigured server
+// URI or incompatible versions. Hint describes the likely cause.
+type ProtocolError struct {
+	Kind       ProtocolErrorKind
+	StatusCode int
+	Detail     string
+	Hint       string
+}
+
+func newProtocolError(kind ProtocolErrorKind, detail string) *ProtocolError {
+	err := &ProtocolError{
+		Kind:       kind,
+		StatusCode: http.StatusOK,
+		Detail:     detail,
+	}
+	switch kind {
+	case ProtocolErrorEmpty:
+		err.Hint = protocolHintEmpty
+	case ProtocolErrorHTML:
+		err.Hint = protocolHintHTML
+	case ProtocolErrorNotXML:
+		err.Hint = protocolHintNotXML
+	case ProtocolErrorNotSOAP:
+		err.Hint = protocolHintNotSOAP
+	case ProtocolErrorFault:
+		err.Hint = protocolHintFault
+	case ProtocolErrorVersionMismatch:
+		err.Hint = fmt.Sprintf(protocolHintVersionMismatch, ClientVersion)
+	}
+
+	return err
+}
+
+func (err *ProtocolError) Error() string {
+	msg := "unexpected backend response (" + string(err.Kind) + ")"
+	if err.Detail != "" {
+		msg += ": " + err.Detail
+	}
+	if err.Hint != "" {
+		msg += " - " + err.Hint
+	}
+	return msg
+}
+
+// A soapFault holds the SOAP 1.1 fault as sent by the Kopano server.
+type soapFault struct {
+	Code   string `xml:"faultcode"`
+	String string `xml:"faultstring"`
+	Detail string `xml:"detail"`
+}
+
+// soapVersionMismatchFaults are fault strings of gSOAP which are sent when
+// the server does not know the requested call or its elements.
+var soapVersionMismatchFaults = []string{
+	"namespace mismatch",
+	"not implemented",
+	"Validation constraint violation",
+}
+
+// faultProtocolError returns the ProtocolError of the provided SOAP fault.
+func faultProtocolError(fault *soapFault) *ProtocolError {
+	detail := strings.TrimSpace(fault.Code + " " + fault.String)
+	if strings.HasSuffix(fault.Code, "VersionMismatch") {
+		return newProtocolError(ProtocolErrorVersionMismatch, detail)
+	}
+	for _, s := range soapVersionMismatchFaults {
+		if strings.Contains(fault.String, s) {
+			return newProtocolError(ProtocolErrorVersionMismatch, detail)
+		}
+	}
+
+	return newProtocolError(ProtocolErrorFault, detail)
+}
+
+// rootProtocolError returns the ProtocolError for responses with the provided
+// root element, or nil if it is a SOAP envelope.
+func rootProtocolError(se *xml.StartElement) *ProtocolError {
+	switch {
+	case se.Name.Local == "Envelope":
+		return nil
+	case strings.EqualFold(se.Name.Local, "html"):
+		return newProtocolError(ProtocolErrorHTML, "")
+	}
+
+	name := se.Name.Local
+	if se.Name.Space != "" {
+		name = se.Name.Space + " " + name
+	}
+	return newProtocolError(ProtocolErrorNotSOAP, "root element "+strconv.Quote(name))
+}
+
+// tokenProtocolError returns the ProtocolError for responses which ended
+// with the provided error before the root element, text tells if there was
+// text before.
+func tokenProtocolError(err error, text bool) *ProtocolError {
+	switch {
+	case err != io.EOF:
+		return newProtocolError(ProtocolErrorNotXML, err.Error())
+	case text:
+		return newProtocolError(ProtocolErrorNotXML, "text response")
+	default:
+		return newProtocolError(ProtocolErrorEmpty, "")
+	}
+}
+
+// statusProtocolHints are hints for HTTP status responses which are usually
+// caused by a misconfigured server URI.
+var statusProtocolHints = map[int]string{
+	http.StatusNotFound:         "the path of the server URI does not exist, expected the Kopano server SOAP endpoint like http://127.0.0.1:236 or the /soap path of a reverse proxy",
+	http.StatusMethodNotAllowed: "the server URI points to a web server which does not accept SOAP requests, expected the Kopano server SOAP endpoint",
+	http.StatusUnauthorized:     "a proxy in front of the Kopano server requires authentication",
+	http.StatusBadGateway:       "a proxy in front of the Kopano server cannot reach it, check that the Kopano server is running",
+}
+
+// statusResponseBodyLimit is the maximum number of bytes read from the body
+// of responses with unexpected HTTP status.
+const statusResponseBodyLimit = 64 * 1024
+
+// statusResponseError returns the error of the provided response with an
+// unexpected HTTP status. SOAP faults are returned as ProtocolError,
+// everything else as HTTPStatusError with a hint when the cause is known.
+func statusResponseError(resp *http.Response) error {
+	statusErr := newHTTPStatusError(resp)
+
+	var body io.Reader = io.LimitReader(resp.Body, statusResponseBodyLimit)
+	if debug {
+		body, _ = debugRawResponse(resp.StatusCode, body)
+	}
+	if busy, _ := IsServerBusy(statusErr); busy {
+		return statusErr
+	}
+
+	if body != nil {
+		var v struct{}
+		if protocolErr, ok := decodeSOAPResponse(body, &v).(*ProtocolError); ok {
+			protocolErr.StatusCode = resp.StatusCode
+			switch protocolErr.Kind {
+			case ProtocolErrorFault, ProtocolErrorVersionMismatch:
+				return protocolErr
+			case ProtocolErrorHTML:
+				statusErr.Hint = protocolErr.Hint
+			}
+		}
+	}
+	if statusErr.Hint == "" {
+		statusErr.Hint = statusProtocolHints[resp.StatusCode]
+	}
+
+	return statusErr
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseSOAPResponseProtocolErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+		kind ProtocolErrorKind
+	}{
+		{"empty", "", ProtocolErrorEmpty},
+		{"html", "<!DOCTYPE html>\n<html lang=\"en\"><head><meta charset=\"utf-8\"><title>Kopano WebApp</title></head></html>", ProtocolErrorHTML},
+		{"text", "Not Found\n", ProtocolErrorNotXML},
+		{"xml", `<?xml version="1.0"?><rss version="2.0"><channel></channel></rss>`, ProtocolErrorNotSOAP},
+		{"fault", soapHeader + `<SOAP-ENV:Fault><faultcode>SOAP-ENV:Server</faultcode><faultstring>Out of memory</faultstring></SOAP-ENV:Fault>` + soapFooter, ProtocolErrorFault},
+		{"version", soapHeader + `<SOAP-ENV:Fault><faultcode>SOAP-ENV:Client</faultcode><faultstring>Tag name or namespace mismatch</faultstring></SOAP-ENV:Fault>` + soapFooter, ProtocolErrorVersionMismatch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var response LogoffResponse
+			err := parseSOAPResponse(http.StatusOK, strings.NewReader(tc.body), &response)
+			protocolErr, ok := err.(*ProtocolError)
+			if !ok {
+				t.Fatalf("expected protocol error, got %v", err)
+			}
+			if protocolErr.Kind != tc.kind || protocolErr.Hint == "" {
+				t.Errorf("unexpected protocol error: %+v", protocolErr)
+			}
+		})
+	}
+}
+
+func TestSOAPHTTPClientProtocolErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		body   string
+		check  func(t *testing.T, err error)
+	}{
+		{"html", http.StatusOK, "<html><body>Kopano WebApp</body></html>", func(t *testing.T, err error) {
+			if protocolErr, ok := err.(*ProtocolError); !ok || protocolErr.Kind != ProtocolErrorHTML {
+				t.Errorf("expected html protocol error, got %v", err)
+			}
+		}},
+		{"not found", http.StatusNotFound, "<html><body>Not Found</body></html>", func(t *testing.T, err error) {
+			statusErr, ok := err.(*HTTPStatusError)
+			if !ok || statusErr.StatusCode != http.StatusNotFound || statusErr.Hint == "" {
+				t.Errorf("expected status error with hint, got %v", err)
+			}
+		}},
+		{"fault", http.StatusInternalServerError, soapHeader + `<SOAP-ENV:Fault><faultcode>SOAP-ENV:VersionMismatch</faultcode><faultstring>SOAP version mismatch</faultstring></SOAP-ENV:Fault>` + soapFooter, func(t *testing.T, err error) {
+			protocolErr, ok := err.(*ProtocolError)
+			if !ok || protocolErr.Kind != ProtocolErrorVersionMismatch || protocolErr.StatusCode != http.StatusInternalServerError {
+				t.Errorf("expected version mismatch protocol error, got %v", err)
+			}
+		}},
+		{"busy", http.StatusServiceUnavailable, "<html><body>Busy</body></html>", func(t *testing.T, err error) {
+			if busy, _ := IsServerBusy(err); !busy {
+				t.Errorf("expected busy error, got %v", err)
+			}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				rw.WriteHeader(tc.status)
+				rw.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			sc := &SOAPHTTPClient{
+				Client: srv.Client(),
+				URI:    srv.URL,
+			}
+			payload := "<ns:logoff><ulSessionId>1</ulSessionId></ns:logoff>"
+			var response LogoffResponse
+			tc.check(t, sc.DoRequest(context.Background(), &payload, &response))
+		})
+	}
+}
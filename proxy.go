@@ -0,0 +1,123 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// A ProxyFunc returns the URL of the proxy to use for a request, like
+// http.ProxyFromEnvironment. A nil URL means no proxy is used.
+type ProxyFunc func(*http.Request) (*url.URL, error)
+
+// NoProxy is a ProxyFunc which connects directly, ignoring the proxies of the
+// environment.
+func NoProxy(req *http.Request) (*url.URL, error) {
+	return nil, nil
+}
+
+// ParseProxy returns the ProxyFunc for the provided string. An empty string
+// uses the proxies of the environment, "direct" or "none" connect directly and
+// everything else is parsed as the URL of the proxy to use for all requests,
+// with one of the schemes http, https or socks5.
+func ParseProxy(s string) (ProxyFunc, error) {
+	switch strings.TrimSpace(s) {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case "direct", "none":
+		return NoProxy, nil
+	}
+
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid scheme '%v' for proxy", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing host in proxy URL")
+	}
+	return http.ProxyURL(u), nil
+}
+
+// NewHTTPClientWithProxy creates a new http.Client like NewHTTPClient, which
+// connects through the proxy returned by the provided ProxyFunc. If proxy is
+// nil, the proxies of the environment are used.
+func NewHTTPClientWithProxy(tlsConfig *tls.Config, proxy ProxyFunc) *http.Client {
+	client := NewHTTPClient(tlsConfig)
+	if proxy != nil {
+		client.Transport.(*http.Transport).Proxy = proxy
+	}
+	return client
+}
+
+// SetProxy makes the accociated client connect through the proxy returned by
+// the provided ProxyFunc, without changing the proxy of other clients which
+// share its http.Client or transport. A nil proxy restores the proxies of the
+// environment. It returns an error if the transport of the client does not
+// support proxies, like the transports of http+unix URIs or h2c. SetProxy
+// must be called before the client is used.
+func (sc *SOAPHTTPClient) SetProxy(proxy ProxyFunc) error {
+	if sc.socketPath != "" {
+		return fmt.Errorf("proxy not supported for http+unix SOAP clients")
+	}
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+
+	client := sc.Client
+	if client == nil {
+		client = DefaultHTTPClient
+	}
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport)
+	case *http.Transport:
+		transport = t
+	default:
+		return fmt.Errorf("proxy not supported for transport %T", t)
+	}
+
+	// NOTE(longsleep): Clone the transport and the client, as they might be
+	// shared with other clients, like DefaultHTTPClient is.
+	transport = transport.Clone()
+	transport.Proxy = proxy
+	clone := *client
+	clone.Transport = transport
+	sc.Client = &clone
+
+	return nil
+}
+
+// SetHTTPProxy makes the SOAP HTTP client of the accociated KCC connect
+// through the proxy returned by the provided ProxyFunc, see
+// SOAPHTTPClient.SetProxy. It returns an error if the KCC was not created with
+// a SOAP HTTP client.
+func (c *KCC) SetHTTPProxy(proxy ProxyFunc) error {
+	if c.http == nil {
+		return fmt.Errorf("proxy not supported for SOAP client %v", c.Client)
+	}
+	return c.http.SetProxy(proxy)
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// proxyHandler responds to resolveUser requests with the host of the request
+// URL as user entry ID, which is only set for requests sent to a proxy.
+var proxyHandler = http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+	rw.Write([]byte(soapHeader + "<ns:resolveUserResponse><er>0</er><sUserId>" + req.URL.Host + "</sUserId></ns:resolveUserResponse>" + soapFooter))
+})
+
+func resolveProxyHost(t *testing.T, c *KCC) string {
+	resp, err := c.ResolveUsername(context.Background(), "user1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.UserEntryID
+}
+
+func TestSOAPClientConfigProxy(t *testing.T) {
+	proxy := httptest.NewServer(proxyHandler)
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	uri, _ := url.Parse("http://kopano.invalid:236/")
+	for _, config := range []*SOAPClientConfig{
+		{HTTPProxyURL: proxyURL},
+		{HTTPProxy: http.ProxyURL(proxyURL)},
+	} {
+		client, err := NewSOAPClientWithConfig(uri, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if host := resolveProxyHost(t, NewKCCWithClient(client)); host != "kopano.invalid:236" {
+			t.Errorf("expected request through proxy, got host %q", host)
+		}
+	}
+}
+
+func TestKCCSetHTTPProxy(t *testing.T) {
+	proxy := httptest.NewServer(proxyHandler)
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	transport := DefaultHTTPClient.Transport
+	uri, _ := url.Parse("http://kopano.invalid:236/")
+	c := NewKCC(uri)
+	if err := c.SetHTTPProxy(http.ProxyURL(proxyURL)); err != nil {
+		t.Fatal(err)
+	}
+	if host := resolveProxyHost(t, c); host != "kopano.invalid:236" {
+		t.Errorf("expected request through proxy, got host %q", host)
+	}
+	if DefaultHTTPClient.Transport != transport {
+		t.Errorf("expected DefaultHTTPClient to keep its transport")
+	}
+
+	uri, _ = url.Parse("http+unix:///run/kopano/server.sock")
+	if err := NewKCC(uri).SetHTTPProxy(NoProxy); err == nil {
+		t.Errorf("expected error for http+unix client")
+	}
+	if err := NewKCCWithClient(&cannedSOAPClient{}).SetHTTPProxy(NoProxy); err == nil {
+		t.Errorf("expected error for non HTTP client")
+	}
+}
+
+func TestParseProxy(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://kopano.example.com/", nil)
+	for _, test := range []struct {
+		s        string
+		expected string
+		err      bool
+	}{
+		{"none", "", false},
+		{"direct", "", false},
+		{"http://proxy.example.com:3128", "http://proxy.example.com:3128", false},
+		{"socks5://127.0.0.1:1080", "socks5://127.0.0.1:1080", false},
+		{"ftp://proxy.example.com", "", true},
+		{"http://", "", true},
+	} {
+		proxy, err := ParseProxy(test.s)
+		if test.err {
+			if err == nil {
+				t.Errorf("expected error for %q", test.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", test.s, err)
+		}
+		u, _ := proxy(req)
+		if (u == nil && test.expected != "") || (u != nil && u.String() != test.expected) {
+			t.Errorf("unexpected proxy for %q: %v", test.s, u)
+		}
+	}
+}
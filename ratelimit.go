@@ -0,0 +1,211 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default rate limit settings. A limit of 0 disables rate limiting.
+var (
+	DefaultRateLimit float64
+	DefaultRateBurst = 10
+)
+
+func init() {
+	if s := os.Getenv("KCC_GO_RATE_LIMIT"); s != "" {
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			DefaultRateLimit = n
+		}
+	}
+	if s := os.Getenv("KCC_GO_RATE_BURST"); s != "" {
+		if n, err := strconv.ParseInt(s, 10, 0); err == nil {
+			DefaultRateBurst = int(n)
+		}
+	}
+}
+
+// A RateLimiter is a token bucket limiting the rate of requests. The bucket
+// holds up to burst tokens and is refilled with limit tokens per second.
+// Waiting requests get tokens by their Priority, in order of arrival. A
+// RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	mutex  sync.Mutex
+	limit  float64
+	burst  int
+	tokens float64
+	last   time.Time
+	queue  priorityQueue
+	timer  *time.Timer
+}
+
+// NewRateLimiter creates a new RateLimiter allowing limit requests per second
+// with bursts of up to burst requests. A limit of 0 or less allows all
+// requests.
+func NewRateLimiter(limit float64, burst int) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetLimit(limit, burst)
+	l.tokens = float64(l.burst)
+
+	return l
+}
+
+// SetLimit changes the limit and burst of the accociated RateLimiter.
+func (l *RateLimiter) SetLimit(limit float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mutex.Lock()
+	l.advance(time.Now())
+	l.limit = limit
+	l.burst = burst
+	if l.tokens > float64(burst) {
+		l.tokens = float64(burst)
+	}
+	l.dispatch()
+	l.mutex.Unlock()
+}
+
+// Limit returns the limit and burst of the accociated RateLimiter.
+func (l *RateLimiter) Limit() (float64, int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.limit, l.burst
+}
+
+// advance refills the bucket up to the provided time. Must be called with the
+// mutex held.
+func (l *RateLimiter) advance(now time.Time) {
+	if !l.last.IsZero() && l.limit > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.limit
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+}
+
+// dispatch hands out available tokens to waiting requests and schedules the
+// next dispatch if requests remain waiting. Must be called with the mutex
+// held.
+func (l *RateLimiter) dispatch() {
+	if l.limit <= 0 {
+		// Unlimited, release everyone.
+		for w := l.queue.pop(); w != nil; w = l.queue.pop() {
+			close(w.ready)
+		}
+		return
+	}
+
+	l.advance(time.Now())
+	for l.tokens >= 1 {
+		w := l.queue.pop()
+		if w == nil {
+			return
+		}
+		l.tokens--
+		close(w.ready)
+	}
+
+	if l.timer == nil && l.queue.len() > 0 {
+		delay := time.Duration((1 - l.tokens) / l.limit * float64(time.Second))
+		l.timer = time.AfterFunc(delay, func() {
+			l.mutex.Lock()
+			l.timer = nil
+			l.dispatch()
+			l.mutex.Unlock()
+		})
+	}
+}
+
+// Wait blocks until the accociated RateLimiter allows a request with the
+// Priority of the provided context or the provided context is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	p := PriorityFromContext(ctx)
+
+	l.mutex.Lock()
+	if l.limit <= 0 {
+		l.mutex.Unlock()
+		return nil
+	}
+	l.advance(time.Now())
+	if l.tokens >= 1 && !l.queue.waiting(p) {
+		l.tokens--
+		l.mutex.Unlock()
+		return nil
+	}
+	w := l.queue.push(p)
+	l.dispatch()
+	l.mutex.Unlock()
+
+	beginBackendWait()
+	select {
+	case <-w.ready:
+		endBackendWait(ctx, nil)
+		return nil
+	case <-ctx.Done():
+		l.mutex.Lock()
+		if !l.queue.remove(w) {
+			// Was granted meanwhile, give back the token.
+			l.tokens++
+			l.dispatch()
+		}
+		l.mutex.Unlock()
+		endBackendWait(ctx, ctx.Err())
+		return ctx.Err()
+	}
+}
+
+// A RateLimitedSOAPClient wraps a SOAPClient, limiting the rate of requests
+// with a RateLimiter.
+type RateLimitedSOAPClient struct {
+	Client  SOAPClient
+	Limiter *RateLimiter
+}
+
+// NewRateLimitedSOAPClient creates a new RateLimitedSOAPClient for the
+// provided client using the provided limiter.
+func NewRateLimitedSOAPClient(client SOAPClient, limiter *RateLimiter) *RateLimitedSOAPClient {
+	return &RateLimitedSOAPClient{
+		Client:  client,
+		Limiter: limiter,
+	}
+}
+
+// DoRequest sends the provided payload data as SOAP through the means of the
+// accociated client, after waiting for the accociated limiter.
+func (rc *RateLimitedSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := rc.Limiter.Wait(ctx); err != nil {
+		return err
+	}
+
+	return rc.Client.DoRequest(ctx, payload, v)
+}
+
+func (rc *RateLimitedSOAPClient) String() string {
+	return fmt.Sprintf("%s", rc.Client)
+}
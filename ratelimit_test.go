@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(100, 5)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Millisecond {
+		t.Errorf("burst was delayed: %v", elapsed)
+	}
+
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("requests after burst were not limited: %v", elapsed)
+	}
+
+	canceled, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	l.SetLimit(1, 1)
+	if err := l.Wait(canceled); err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRateLimiterPriority(t *testing.T) {
+	l := NewRateLimiter(50, 1)
+	ctx := context.Background()
+	if err := l.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	order := make(chan Priority, 2)
+	batch := WithPriority(ctx, PriorityBatch)
+	go func() {
+		l.Wait(batch)
+		order <- PriorityBatch
+	}()
+	time.Sleep(5 * time.Millisecond)
+	go func() {
+		l.Wait(ctx)
+		order <- PriorityInteractive
+	}()
+
+	if p := <-order; p != PriorityInteractive {
+		t.Errorf("expected interactive request first, got %v", p)
+	}
+	if p := <-order; p != PriorityBatch {
+		t.Errorf("expected batch request second, got %v", p)
+	}
+}
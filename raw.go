@@ -0,0 +1,128 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// A RawResponse holds the undecoded response of a SOAP request sent with
+// DoRequestRaw. Body must be closed by the caller to release the connection.
+type RawResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       io.ReadCloser
+}
+
+// DoRequestRaw sends the provided payload data as SOAP through the means of
+// the provided client like DoRequest, but returns the response body without
+// decoding it, for example to pass it through unchanged or to decode it with
+// DecodeSOAPResponse into other types. Responses with a HTTP status other than
+// 200 are returned without error. Compressed responses are decompressed. The
+// body is read with the provided context, so it must not be done before the
+// body was read. An error is returned if the client does not support raw
+// responses.
+func DoRequestRaw(ctx context.Context, client SOAPClient, payload *string) (*RawResponse, error) {
+	raw := &RawResponse{}
+	if err := client.DoRequest(ctx, payload, raw); err != nil {
+		if raw.Body != nil {
+			raw.Body.Close()
+		}
+		return nil, err
+	}
+	if raw.Body == nil {
+		return nil, fmt.Errorf("SOAP client %v does not support raw responses", client)
+	}
+
+	return raw, nil
+}
+
+// DoRequestRaw sends the provided payload data as SOAP through the SOAP client
+// of the accociated KCC and returns the undecoded response, see DoRequestRaw.
+func (c *KCC) DoRequestRaw(ctx context.Context, payload *string) (*RawResponse, error) {
+	return DoRequestRaw(ctx, c.Client, payload)
+}
+
+// setHTTPResponse sets the provided HTTP response to the accociated
+// RawResponse, decompressing its body if needed. The provided release
+// function, if not nil, is called once when the body is closed, with true if
+// the body was read completely.
+func (raw *RawResponse) setHTTPResponse(resp *http.Response, release func(eof bool)) error {
+	body := &rawBody{
+		Reader:  resp.Body,
+		closers: []io.Closer{resp.Body},
+		release: release,
+	}
+
+	header := resp.Header.Clone()
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			body.Close()
+			return fmt.Errorf("failed to read gzip response: %v", err)
+		}
+		body.Reader = zr
+		body.closers = append([]io.Closer{zr}, body.closers...)
+		header.Del("Content-Encoding")
+		header.Del("Content-Length")
+	}
+
+	raw.StatusCode = resp.StatusCode
+	raw.Header = header
+	raw.Body = body
+
+	return nil
+}
+
+// A rawBody is the body of a RawResponse, which closes the accociated closers
+// and releases its connection when it is closed.
+type rawBody struct {
+	io.Reader
+	closers []io.Closer
+	release func(eof bool)
+
+	eof  bool
+	once sync.Once
+}
+
+func (b *rawBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *rawBody) Close() error {
+	var err error
+	b.once.Do(func() {
+		for _, closer := range b.closers {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if b.release != nil {
+			b.release(b.eof)
+		}
+	})
+	return err
+}
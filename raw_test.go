@@ -0,0 +1,172 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const rawTestResponse = "<ns:resolveUserResponse><er>0</er><sUserId>user1-id</sUserId></ns:resolveUserResponse>"
+
+func TestDoRequestRawHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(zr)
+		if strings.Contains(string(body), "busy") {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			rw.Write([]byte("busy"))
+			return
+		}
+		rw.Header().Set("Content-Type", "text/xml")
+		rw.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(rw)
+		zw.Write([]byte(soapHeader + rawTestResponse + soapFooter))
+		zw.Close()
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		HTTPClient: srv.Client(),
+		HTTPGzip:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewKCCWithClient(client)
+
+	payload := "<ns:resolveUsername><lpszUsername>user1</lpszUsername></ns:resolveUsername>"
+	raw, err := c.DoRequestRaw(context.Background(), &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw.StatusCode != http.StatusOK || raw.Header.Get("Content-Type") != "text/xml" || raw.Header.Get("Content-Encoding") != "" {
+		t.Errorf("unexpected raw response: %+v", raw)
+	}
+	var resp ResolveUserResponse
+	err = DecodeSOAPResponse(raw.Body, &resp)
+	raw.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.UserEntryID != "user1-id" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	payload = "<ns:resolveUsername><lpszUsername>busy</lpszUsername></ns:resolveUsername>"
+	raw, err = c.DoRequestRaw(context.Background(), &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(raw.Body)
+	raw.Body.Close()
+	if raw.StatusCode != http.StatusServiceUnavailable || string(body) != "busy" {
+		t.Errorf("unexpected raw response: %+v %s", raw, body)
+	}
+}
+
+func TestDoRequestRawSocket(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	accepted := make(chan bool, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- true
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					request, err := r.ReadString('>')
+					for err == nil && !strings.HasSuffix(request, soapFooter) {
+						var more string
+						more, err = r.ReadString('>')
+						request += more
+					}
+					if err != nil {
+						return
+					}
+					body := soapHeader + rawTestResponse + soapFooter
+					fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nConnection: keep-alive\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+				}
+			}()
+		}
+	}()
+
+	uri, _ := url.Parse("tcp://" + listener.Addr().String())
+	client, err := NewSOAPClient(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := "<ns:resolveUsername><lpszUsername>user1</lpszUsername></ns:resolveUsername>"
+	for i := 0; i < 3; i++ {
+		raw, err := DoRequestRaw(context.Background(), client, &payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(raw.Body)
+		raw.Body.Close()
+		if !strings.Contains(string(body), rawTestResponse) {
+			t.Errorf("unexpected raw body: %s", body)
+		}
+	}
+	if n := len(accepted); n != 1 {
+		t.Errorf("expected connection to be reused, got %d connections", n)
+	}
+
+	// Bodies which are not read completely release their connection.
+	raw, err := DoRequestRaw(context.Background(), client, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw.Body.Close()
+	raw, err = DoRequestRaw(context.Background(), client, &payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw.Body.Close()
+	if n := len(accepted); n != 2 {
+		t.Errorf("expected partially read connection to be removed, got %d connections", n)
+	}
+}
+
+func TestDoRequestRawUnsupported(t *testing.T) {
+	payload := "<ns:resolveUsername></ns:resolveUsername>"
+	if _, err := DoRequestRaw(context.Background(), &cannedSOAPClient{response: rawTestResponse}, &payload); err == nil {
+		t.Errorf("expected error for client without raw responses")
+	}
+}
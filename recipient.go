@@ -0,0 +1,169 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"strings"
+)
+
+// A RecipientQuota is the quota state of the store of a recipient.
+type RecipientQuota string
+
+// Recipient quota states.
+const (
+	// RecipientQuotaUnknown is the quota state of recipients for which the
+	// server returned no store size or receive quota.
+	RecipientQuotaUnknown  RecipientQuota = ""
+	RecipientQuotaOK       RecipientQuota = "ok"
+	RecipientQuotaExceeded RecipientQuota = "exceeded"
+)
+
+// recipientProps are the props fetched for each recipient by
+// ResolveRecipients.
+var recipientProps = []PT{
+	PR_ACCOUNT,
+	PR_SMTP_ADDRESS,
+	PR_EMS_AB_PROXY_ADDRESSES,
+	PR_OBJECT_TYPE,
+	PR_EC_HOMESERVER_NAME,
+	PR_EMS_AB_TARGET_ADDRESS,
+	PR_MESSAGE_SIZE_EXTENDED,
+	PR_PROHIBIT_RECEIVE_QUOTA,
+}
+
+// A RecipientResult is the result of a single address of a ResolveRecipients
+// batch. Exists is set if the address is the mail address or an alias of a
+// user or group, else Err is set. HomeServer is the name of the server which
+// holds the store of the recipient in multi-server setups. ForwardTo is the
+// address mail to the recipient is redirected to, if any.
+type RecipientResult struct {
+	Index   int    `json:"-"`
+	Address string `json:"address"`
+	Exists  bool   `json:"exists"`
+
+	Username    string         `json:"username,omitempty"`
+	MailAddress string         `json:"mailAddress,omitempty"`
+	Group       bool           `json:"group,omitempty"`
+	HomeServer  string         `json:"homeServer,omitempty"`
+	Quota       RecipientQuota `json:"quota,omitempty"`
+	ForwardTo   string         `json:"forwardTo,omitempty"`
+
+	Err error `json:"-"`
+}
+
+// ResolveRecipients resolves the provided SMTP addresses, like the RCPT
+// addresses of a mail transaction, to Kopano users and groups using the
+// provided session, with a single request for all addresses. Angle brackets
+// around addresses are removed. A result is returned for each address at the
+// same index. Addresses which are not the mail address or an alias of any
+// entry fail individually with KCERR_NOT_FOUND, addresses of more than one
+// entry with ErrAmbiguousAlias and empty addresses with
+// KCERR_INVALID_PARAMETER. An error is only returned if the whole batch
+// failed.
+//
+// The quota state is only known if the server returns the store size and the
+// receive quota of the recipient with its AB entry. A receive quota of 0 means
+// no limit.
+func (c *KCC) ResolveRecipients(ctx context.Context, addresses []string, sessionID KCSessionID) ([]*RecipientResult, error) {
+	names := make([]string, len(addresses))
+	for idx, address := range addresses {
+		names[idx] = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(address), "<"), ">")
+	}
+
+	resolved, err := c.ResolveNames(ctx, names, recipientProps, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*RecipientResult, len(resolved))
+	for idx, r := range resolved {
+		result := &RecipientResult{
+			Index:   idx,
+			Address: r.Name,
+		}
+		results[idx] = result
+		switch {
+		case r.Err == ErrAmbiguousName:
+			result.Err = ErrAmbiguousAlias
+		case r.Err != nil:
+			result.Err = r.Err
+		case !recipientHasAddress(r.Props, r.Name):
+			// NOTE(longsleep): The AB also resolves partial names, which
+			// are no mailbox for the address.
+			result.Err = KCERR_NOT_FOUND
+		default:
+			result.setProps(r.Props)
+		}
+	}
+
+	return results, nil
+}
+
+// setProps sets the details of the accociated result from the provided props
+// of its AB entry.
+func (result *RecipientResult) setProps(props *PropTagRowSet) {
+	result.Exists = true
+	result.Username = propsString(props, PR_ACCOUNT_W, PR_ACCOUNT_A)
+	result.MailAddress = propsString(props, PR_SMTP_ADDRESS_W, PR_SMTP_ADDRESS_A)
+	result.HomeServer = propsString(props, PR_EC_HOMESERVER_NAME_W, PR_EC_HOMESERVER_NAME_A)
+	if value, ok := props.Get(PR_OBJECT_TYPE); ok {
+		result.Group = MAPIType(value.ULValue) == MAPI_DISTLIST
+	}
+	if target := propsString(props, PR_EMS_AB_TARGET_ADDRESS_W, PR_EMS_AB_TARGET_ADDRESS_A); target != "" {
+		result.ForwardTo = stripSMTPPrefix(target)
+	}
+
+	size, sizeOK := props.Get(PR_MESSAGE_SIZE_EXTENDED)
+	quota, quotaOK := props.Get(PR_PROHIBIT_RECEIVE_QUOTA)
+	if sizeOK && quotaOK {
+		// NOTE(longsleep): The receive quota is in KiB.
+		if quota.ULValue > 0 && size.LIValue > int64(quota.ULValue)*1024 {
+			result.Quota = RecipientQuotaExceeded
+		} else {
+			result.Quota = RecipientQuotaOK
+		}
+	}
+}
+
+// recipientHasAddress returns true if the provided address is the SMTP
+// address or one of the SMTP proxy addresses in the provided props, ignoring
+// case.
+func recipientHasAddress(props *PropTagRowSet, address string) bool {
+	if strings.EqualFold(propsString(props, PR_SMTP_ADDRESS_W, PR_SMTP_ADDRESS_A), address) {
+		return true
+	}
+	for _, pt := range []PT{PR_EMS_AB_PROXY_ADDRESSES_W, PR_EMS_AB_PROXY_ADDRESSES_A} {
+		if value, ok := props.Get(pt); ok {
+			for _, proxy := range value.AStringValues {
+				if strings.EqualFold(stripSMTPPrefix(proxy), address) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// stripSMTPPrefix removes the smtp: address type prefix from the provided
+// address, if present.
+func stripSMTPPrefix(address string) string {
+	if len(address) > 5 && strings.EqualFold(address[:5], "smtp:") {
+		return address[5:]
+	}
+	return address
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func propXML(pt PT, value string) string {
+	return "<item><ulPropTag>" + pt.String() + "</ulPropTag>" + value + "</item>"
+}
+
+func TestResolveRecipients(t *testing.T) {
+	user := "<item>" +
+		propXML(PR_ACCOUNT_W, "<lpszA>user1</lpszA>") +
+		propXML(PR_SMTP_ADDRESS_W, "<lpszA>user1@example.com</lpszA>") +
+		propXML(PR_EMS_AB_PROXY_ADDRESSES_W, "<mvszA><item>smtp:u1@example.org</item><item>x500:/o=kopano</item></mvszA>") +
+		propXML(PR_OBJECT_TYPE, "<ul>6</ul>") +
+		propXML(PR_EC_HOMESERVER_NAME_W, "<lpszA>node1</lpszA>") +
+		propXML(PR_MESSAGE_SIZE_EXTENDED, "<li>2048000</li>") +
+		propXML(PR_PROHIBIT_RECEIVE_QUOTA, "<ul>1000</ul>") +
+		"</item>"
+	group := "<item>" +
+		propXML(PR_SMTP_ADDRESS_W, "<lpszA>group@example.com</lpszA>") +
+		propXML(PR_OBJECT_TYPE, "<ul>8</ul>") +
+		propXML(PR_EMS_AB_TARGET_ADDRESS_W, "<lpszA>SMTP:ext@example.net</lpszA>") +
+		"</item>"
+	partial := "<item>" +
+		propXML(PR_SMTP_ADDRESS_W, "<lpszA>partial.match@example.com</lpszA>") +
+		"</item>"
+	client := &cannedSOAPClient{
+		response: "<ns:abResolveNamesResponse><er>0</er><sRowSet>" +
+			user + user + "<item></item>" + group + "<item></item>" + partial +
+			"</sRowSet><aFlags><item>2</item><item>2</item><item>1</item><item>2</item><item>0</item><item>2</item></aFlags></ns:abResolveNamesResponse>",
+	}
+	c := NewKCCWithClient(client)
+
+	results, err := c.ResolveRecipients(context.Background(), []string{
+		"<user1@example.com>",
+		" <U1@example.org>",
+		"",
+		"shared@example.com",
+		"group@example.com",
+		"nobody@example.com",
+		"partial@example.com",
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 7 {
+		t.Fatalf("unexpected number of results: %d", len(results))
+	}
+
+	for _, idx := range []int{0, 1} {
+		result := results[idx]
+		if !result.Exists || result.Err != nil || result.Username != "user1" || result.MailAddress != "user1@example.com" || result.HomeServer != "node1" || result.Group || result.Quota != RecipientQuotaExceeded || result.ForwardTo != "" {
+			t.Errorf("unexpected result %d: %+v", idx, result)
+		}
+	}
+	if results[1].Address != "U1@example.org" {
+		t.Errorf("unexpected address of result 1: %s", results[1].Address)
+	}
+	if results[2].Exists || results[2].Err != KCERR_INVALID_PARAMETER {
+		t.Errorf("unexpected result 2: %+v", results[2])
+	}
+	if results[3].Exists || results[3].Err != ErrAmbiguousAlias {
+		t.Errorf("unexpected result 3: %+v", results[3])
+	}
+	if !results[4].Exists || !results[4].Group || results[4].ForwardTo != "ext@example.net" || results[4].Quota != RecipientQuotaUnknown {
+		t.Errorf("unexpected result 4: %+v", results[4])
+	}
+	for _, idx := range []int{5, 6} {
+		if results[idx].Exists || results[idx].Err != KCERR_NOT_FOUND {
+			t.Errorf("unexpected result %d: %+v", idx, results[idx])
+		}
+	}
+	if len(client.payloads) != 1 || strings.Count(client.payloads[0], "<lpszA>") != 6 {
+		t.Errorf("unexpected requests: %v", client.payloads)
+	}
+}
@@ -0,0 +1,21 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package reconcile brings the users, groups and group memberships of Kopano
+// server into a desired state, as a building block for GitOps style directory
+// management. Changes are computed as a Plan which can be reviewed and then
+// applied in batches.
+package reconcile // import "stash.kopano.io/kgol/kcc-go/reconcile"
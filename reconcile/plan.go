@@ -0,0 +1,263 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reconcile
+
+import (
+	"context"
+	"fmt"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// An Action is the kind of change of an Operation.
+type Action string
+
+// Actions of operations, in the order they are applied.
+const (
+	CreateUser   Action = "create-user"
+	UpdateUser   Action = "update-user"
+	CreateGroup  Action = "create-group"
+	UpdateGroup  Action = "update-group"
+	AddMember    Action = "add-member"
+	RemoveMember Action = "remove-member"
+	DeleteGroup  Action = "delete-group"
+	DeleteUser   Action = "delete-user"
+)
+
+// actionOrder is the order in which the actions of a Plan are applied, so
+// users and groups exist before memberships are changed.
+var actionOrder = []Action{
+	CreateUser,
+	UpdateUser,
+	CreateGroup,
+	UpdateGroup,
+	AddMember,
+	RemoveMember,
+	DeleteGroup,
+	DeleteUser,
+}
+
+// An Operation is a single change of a Plan. Name is the name of the user or
+// group which is changed, Member the username of the member for membership
+// changes. Diffs holds the changed details of creates and updates.
+type Operation struct {
+	Action Action          `json:"action"`
+	Name   string          `json:"name"`
+	Member string          `json:"member,omitempty"`
+	Diffs  []*kcc.UserDiff `json:"diffs,omitempty"`
+
+	user     *kcc.User
+	password string
+	group    *kcc.Group
+}
+
+// String returns the accociated Operation as a single line.
+func (op *Operation) String() string {
+	if op.Member != "" {
+		return fmt.Sprintf("%s %s %s", op.Action, op.Name, op.Member)
+	}
+	return fmt.Sprintf("%s %s", op.Action, op.Name)
+}
+
+// A Plan holds the operations which bring Kopano server into a desired state,
+// ordered as they are applied.
+type Plan struct {
+	Operations []*Operation `json:"operations"`
+
+	users  map[string]string
+	groups map[string]string
+}
+
+// Empty returns true if the accociated Plan has no operations, that is if
+// Kopano server is in the desired state.
+func (p *Plan) Empty() bool {
+	return len(p.Operations) == 0
+}
+
+// Plan computes the operations which bring the users and groups of Kopano
+// server into the provided desired state. Users and groups which are not part
+// of the desired state are only deleted with Prune. Nothing is changed.
+func (r *Reconciler) Plan(ctx context.Context, desired *State) (*Plan, error) {
+	if err := desired.Validate(); err != nil {
+		return nil, err
+	}
+
+	var users []*kcc.User
+	err := r.c.ListUsers(ctx, r.CompanyEntryID, r.sessionID, func(user *kcc.User) error {
+		users = append(users, user)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reconcile list users failed: %v", err)
+	}
+	groupList, err := r.c.ListGroups(ctx, r.CompanyEntryID, r.sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("reconcile list groups failed: %v", err)
+	}
+	if groupList.Er != kcc.KCSuccess {
+		return nil, groupList.Er
+	}
+
+	plan := &Plan{
+		users:  make(map[string]string),
+		groups: make(map[string]string),
+	}
+	actualUsers := make(map[string]*kcc.User)
+	for _, user := range users {
+		actualUsers[nameKey(user.Username)] = user
+		plan.users[nameKey(user.Username)] = user.UserEntryID
+	}
+	actualGroups := make(map[string]*kcc.Group)
+	for _, group := range groupList.Groups {
+		actualGroups[nameKey(group.Groupname)] = group
+		plan.groups[nameKey(group.Groupname)] = group.GroupEntryID
+	}
+
+	operations := make(map[Action][]*Operation)
+	add := func(op *Operation) {
+		operations[op.Action] = append(operations[op.Action], op)
+	}
+
+	desiredUsers := make(map[string]bool)
+	for _, spec := range desired.Users {
+		desiredUsers[nameKey(spec.Username)] = true
+		if actual, ok := actualUsers[nameKey(spec.Username)]; ok {
+			user := *actual
+			spec.apply(&user)
+			if diffs := kcc.DiffUsers(actual, &user); diffs != nil {
+				add(&Operation{Action: UpdateUser, Name: actual.Username, Diffs: diffs, user: &user})
+			}
+			continue
+		}
+		user := &kcc.User{Username: spec.Username}
+		spec.apply(user)
+		add(&Operation{Action: CreateUser, Name: spec.Username, Diffs: kcc.DiffUsers(nil, user), user: user, password: spec.Password})
+	}
+
+	desiredGroups := make(map[string]bool)
+	for _, spec := range desired.Groups {
+		desiredGroups[nameKey(spec.Groupname)] = true
+		actual, exists := actualGroups[nameKey(spec.Groupname)]
+		if exists {
+			group := *actual
+			spec.apply(&group)
+			if diffs := diffGroups(actual, &group); diffs != nil {
+				add(&Operation{Action: UpdateGroup, Name: actual.Groupname, Diffs: diffs, group: &group})
+			}
+		} else {
+			group := &kcc.Group{Groupname: spec.Groupname}
+			spec.apply(group)
+			add(&Operation{Action: CreateGroup, Name: spec.Groupname, Diffs: diffGroups(&kcc.Group{}, group), group: group})
+		}
+
+		if spec.Members == nil {
+			continue
+		}
+		members := make(map[string]bool)
+		for _, member := range spec.Members {
+			key := nameKey(member)
+			if _, ok := actualUsers[key]; !ok && !desiredUsers[key] {
+				return nil, fmt.Errorf("reconcile group %s member %s does not exist", spec.Groupname, member)
+			}
+			if r.Prune && !desiredUsers[key] {
+				return nil, fmt.Errorf("reconcile group %s member %s would be pruned", spec.Groupname, member)
+			}
+			members[key] = true
+		}
+
+		current := make(map[string]bool)
+		if exists {
+			memberList, memberErr := r.c.ListGroupUsers(ctx, actual.GroupEntryID, r.sessionID)
+			if memberErr != nil {
+				return nil, fmt.Errorf("reconcile list members of group %s failed: %v", actual.Groupname, memberErr)
+			}
+			if memberList.Er != kcc.KCSuccess {
+				return nil, memberList.Er
+			}
+			for _, user := range memberList.Users {
+				key := nameKey(user.Username)
+				current[key] = true
+				if members[key] {
+					continue
+				}
+				if r.Prune && !desiredUsers[key] {
+					// NOTE(longsleep): Memberships of pruned users are removed
+					// by Kopano server when the user is deleted.
+					continue
+				}
+				add(&Operation{Action: RemoveMember, Name: actual.Groupname, Member: user.Username})
+			}
+		}
+		for _, member := range spec.Members {
+			if !current[nameKey(member)] {
+				add(&Operation{Action: AddMember, Name: spec.Groupname, Member: member})
+			}
+		}
+	}
+
+	if r.Prune {
+		for _, group := range groupList.Groups {
+			key := nameKey(group.Groupname)
+			if desiredGroups[key] || key == nameKey(EveryoneGroup) {
+				continue
+			}
+			add(&Operation{Action: DeleteGroup, Name: group.Groupname, group: group})
+		}
+		for _, user := range users {
+			key := nameKey(user.Username)
+			if desiredUsers[key] || key == nameKey(SystemUsername) {
+				continue
+			}
+			if user.ObjClass != kcc.ACTIVE_USER && user.ObjClass != kcc.NONACTIVE_USER {
+				// Only prune real users, contacts and resources are left alone.
+				continue
+			}
+			add(&Operation{Action: DeleteUser, Name: user.Username, user: user})
+		}
+	}
+
+	for _, action := range actionOrder {
+		plan.Operations = append(plan.Operations, operations[action]...)
+	}
+
+	return plan, nil
+}
+
+// diffGroups returns the differences of the managed details of the provided
+// groups, going from the first to the second. Returns nil if there are no
+// differences.
+func diffGroups(from, to *kcc.Group) []*kcc.UserDiff {
+	var diffs []*kcc.UserDiff
+	for _, field := range []struct {
+		name     string
+		from, to string
+	}{
+		{"lpszGroupname", from.Groupname, to.Groupname},
+		{"lpszFullname", from.FullName, to.FullName},
+		{"lpszFullEmail", from.MailAddress, to.MailAddress},
+	} {
+		if field.from != field.to {
+			diffs = append(diffs, &kcc.UserDiff{
+				Field: field.name,
+				From:  field.from,
+				To:    field.to,
+			})
+		}
+	}
+
+	return diffs
+}
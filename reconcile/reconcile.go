@@ -0,0 +1,245 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// DefaultBatchSize is the default number of operations which are applied
+// concurrently by new Reconcilers.
+const DefaultBatchSize = 10
+
+// ErrNotCreated is the error of membership operations for users or groups
+// which were not created.
+var ErrNotCreated = errors.New("user or group was not created")
+
+// A Result is the result of a single Operation applied by a Reconciler.
+type Result struct {
+	Operation *Operation
+	Err       error
+}
+
+// A Reconciler brings the users and groups of Kopano server into a desired
+// state using a session which is allowed to administrate users and groups,
+// like a session of the SYSTEM user.
+type Reconciler struct {
+	// CompanyEntryID selects the company in multi-tenant setups. Empty
+	// selects the default company.
+	CompanyEntryID string
+	// Prune makes plans delete users and groups which are not part of the
+	// desired state. The SYSTEM user, the Everyone group as well as contacts
+	// are never deleted.
+	Prune bool
+	// DryRun makes Apply report all operations without changing anything.
+	DryRun bool
+	// BatchSize is the number of operations of the same action which are
+	// applied concurrently. Actions are applied one after the other.
+	BatchSize int
+	// ContinueOnError makes Apply continue with the next batches when an
+	// operation fails.
+	ContinueOnError bool
+	// Progress is called after every applied operation with the number of
+	// done and total operations. Calls are serialized.
+	Progress func(done, total int, result *Result)
+
+	c         kcc.KopanoClient
+	sessionID kcc.KCSessionID
+}
+
+// New creates a new Reconciler using the provided client and session, with
+// DefaultBatchSize.
+func New(c kcc.KopanoClient, sessionID kcc.KCSessionID) *Reconciler {
+	return &Reconciler{
+		BatchSize: DefaultBatchSize,
+
+		c:         c,
+		sessionID: sessionID,
+	}
+}
+
+// entryIDs maps name keys of users and groups to their Entry IDs, including
+// the users and groups created while applying a Plan.
+type entryIDs struct {
+	mutex  sync.RWMutex
+	users  map[string]string
+	groups map[string]string
+}
+
+func (ids *entryIDs) get(m map[string]string, name string) (string, bool) {
+	ids.mutex.RLock()
+	defer ids.mutex.RUnlock()
+	entryID, ok := m[nameKey(name)]
+	return entryID, ok
+}
+
+func (ids *entryIDs) set(m map[string]string, name, entryID string) {
+	ids.mutex.Lock()
+	m[nameKey(name)] = entryID
+	ids.mutex.Unlock()
+}
+
+// Apply applies the operations of the provided Plan. Operations of the same
+// action are applied concurrently in batches of BatchSize, one batch after
+// the other. Returns a Result for each operation which was applied, in the
+// order of the plan. Unless ContinueOnError is set, Apply stops after the
+// batch in which an operation failed and returns the error of the first
+// failed operation. With ContinueOnError an error is returned after all
+// operations were applied if any of them failed. A Plan can be applied
+// multiple times, for example first with DryRun.
+func (r *Reconciler) Apply(ctx context.Context, plan *Plan) ([]*Result, error) {
+	ids := &entryIDs{
+		users:  make(map[string]string, len(plan.users)),
+		groups: make(map[string]string, len(plan.groups)),
+	}
+	for key, entryID := range plan.users {
+		ids.users[key] = entryID
+	}
+	for key, entryID := range plan.groups {
+		ids.groups[key] = entryID
+	}
+
+	batchSize := r.BatchSize
+	if batchSize < 1 {
+		batchSize = 1
+	}
+
+	operations := plan.Operations
+	total := len(operations)
+	results := make([]*Result, total)
+	done := 0
+	failed := 0
+	var mutex sync.Mutex
+
+	for start := 0; start < total; {
+		if err := ctx.Err(); err != nil {
+			return results[:start], err
+		}
+
+		end := start + 1
+		for end < total && end-start < batchSize && operations[end].Action == operations[start].Action {
+			end++
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(end - start)
+		for idx := start; idx < end; idx++ {
+			go func(idx int) {
+				defer wg.Done()
+				result := &Result{
+					Operation: operations[idx],
+				}
+				if !r.DryRun {
+					result.Err = r.apply(ctx, operations[idx], ids)
+				}
+				results[idx] = result
+
+				mutex.Lock()
+				defer mutex.Unlock()
+				done++
+				if r.Progress != nil {
+					r.Progress(done, total, result)
+				}
+			}(idx)
+		}
+		wg.Wait()
+
+		for _, result := range results[start:end] {
+			if result.Err == nil {
+				continue
+			}
+			if !r.ContinueOnError {
+				return results[:end], fmt.Errorf("reconcile %s failed: %v", result.Operation, result.Err)
+			}
+			failed++
+		}
+		start = end
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("reconcile failed: %d of %d operations failed", failed, total)
+	}
+	return results, nil
+}
+
+// apply applies the provided Operation, looking up Entry IDs of members in
+// the provided entryIDs and recording the Entry IDs of created users and
+// groups.
+func (r *Reconciler) apply(ctx context.Context, op *Operation, ids *entryIDs) error {
+	var resp *kcc.UserAdminResponse
+	var err error
+
+	switch op.Action {
+	case CreateUser:
+		created, createErr := r.c.CreateUser(ctx, op.user, op.password, r.sessionID)
+		if createErr != nil {
+			return createErr
+		}
+		if created.Er != kcc.KCSuccess {
+			return created.Er
+		}
+		ids.set(ids.users, op.Name, created.UserEntryID)
+		return nil
+	case CreateGroup:
+		created, createErr := r.c.CreateGroup(ctx, op.group, r.sessionID)
+		if createErr != nil {
+			return createErr
+		}
+		if created.Er != kcc.KCSuccess {
+			return created.Er
+		}
+		ids.set(ids.groups, op.Name, created.GroupEntryID)
+		return nil
+	case UpdateUser:
+		resp, err = r.c.SetUser(ctx, op.user, "", r.sessionID)
+	case UpdateGroup:
+		resp, err = r.c.SetGroup(ctx, op.group, r.sessionID)
+	case DeleteUser:
+		resp, err = r.c.DeleteUser(ctx, op.user.UserEntryID, r.sessionID)
+	case DeleteGroup:
+		resp, err = r.c.DeleteGroup(ctx, op.group.GroupEntryID, r.sessionID)
+	case AddMember, RemoveMember:
+		groupEntryID, ok := ids.get(ids.groups, op.Name)
+		if !ok {
+			return ErrNotCreated
+		}
+		userEntryID, ok := ids.get(ids.users, op.Member)
+		if !ok {
+			return ErrNotCreated
+		}
+		if op.Action == AddMember {
+			resp, err = r.c.AddGroupUser(ctx, groupEntryID, userEntryID, r.sessionID)
+		} else {
+			resp, err = r.c.DeleteGroupUser(ctx, groupEntryID, userEntryID, r.sessionID)
+		}
+	default:
+		return fmt.Errorf("unknown action: %s", op.Action)
+	}
+
+	if err != nil {
+		return err
+	}
+	if resp.Er != kcc.KCSuccess {
+		return resp.Er
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"stash.kopano.io/kgol/kcc-go"
+	"stash.kopano.io/kgol/kcc-go/mock"
+)
+
+const testState = `{
+	"users": [
+		{"username": "user1", "fullName": "User One", "props": {"974651423": "Sales"}},
+		{"username": "user3", "password": "secret", "fullName": "User 3", "mailAddress": "user3@example.com", "nonActive": true}
+	],
+	"groups": [
+		{"groupname": "group1", "members": ["USER1", "user3"]},
+		{"groupname": "group2", "fullName": "Group 2", "members": ["user3"]},
+		{"groupname": "group3"}
+	]
+}`
+
+// testServer is a minimal in memory Kopano server for the admin methods used
+// by the Reconciler.
+type testServer struct {
+	mutex   sync.Mutex
+	users   []*kcc.User
+	groups  []*kcc.Group
+	members map[string][]string
+	changes []string
+	fail    map[string]bool
+}
+
+func newTestServer() *testServer {
+	return &testServer{
+		users: []*kcc.User{
+			{Username: "SYSTEM", UserEntryID: "u0", ObjClass: kcc.ACTIVE_USER},
+			{Username: "user1", FullName: "User 1", UserEntryID: "u1", ObjClass: kcc.ACTIVE_USER},
+			{Username: "user2", UserEntryID: "u2", ObjClass: kcc.ACTIVE_USER},
+			{Username: "contact1", UserEntryID: "c1", ObjClass: 0x00010004},
+		},
+		groups: []*kcc.Group{
+			{Groupname: "Everyone", GroupEntryID: "g0"},
+			{Groupname: "group1", GroupEntryID: "g1"},
+			{Groupname: "group3", GroupEntryID: "g3"},
+			{Groupname: "old", GroupEntryID: "g4"},
+		},
+		members: map[string][]string{
+			"g1": {"u1", "u2"},
+		},
+		fail: make(map[string]bool),
+	}
+}
+
+func (s *testServer) change(format string, args ...interface{}) error {
+	change := fmt.Sprintf(format, args...)
+	if s.fail[change] {
+		return fmt.Errorf("failed %s", change)
+	}
+	s.changes = append(s.changes, change)
+	return nil
+}
+
+func (s *testServer) client() *mock.KopanoClient {
+	return &mock.KopanoClient{
+		ListUsersFunc: func(ctx context.Context, companyEntryID string, sessionID kcc.KCSessionID, cb func(*kcc.User) error) error {
+			for _, user := range s.users {
+				if err := cb(user); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		ListGroupsFunc: func(ctx context.Context, companyEntryID string, sessionID kcc.KCSessionID) (*kcc.GetGroupListResponse, error) {
+			return &kcc.GetGroupListResponse{Groups: s.groups}, nil
+		},
+		ListGroupUsersFunc: func(ctx context.Context, groupEntryID string, sessionID kcc.KCSessionID) (*kcc.GetUserListResponse, error) {
+			resp := &kcc.GetUserListResponse{}
+			for _, entryID := range s.members[groupEntryID] {
+				for _, user := range s.users {
+					if user.UserEntryID == entryID {
+						resp.Users = append(resp.Users, user)
+					}
+				}
+			}
+			return resp, nil
+		},
+		CreateUserFunc: func(ctx context.Context, user *kcc.User, password string, sessionID kcc.KCSessionID) (*kcc.CreateUserResponse, error) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			if err := s.change("createUser %s %s %q %d", user.Username, password, user.FullName, user.IsNonActive); err != nil {
+				return nil, err
+			}
+			return &kcc.CreateUserResponse{UserEntryID: "new-" + user.Username}, nil
+		},
+		SetUserFunc: func(ctx context.Context, user *kcc.User, password string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			department, _ := user.Props.Get(kcc.PR_DEPARTMENT_NAME)
+			return &kcc.UserAdminResponse{}, s.change("setUser %s %q %q", user.UserEntryID, user.FullName, department)
+		},
+		DeleteUserFunc: func(ctx context.Context, userEntryID string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			return &kcc.UserAdminResponse{}, s.change("deleteUser %s", userEntryID)
+		},
+		CreateGroupFunc: func(ctx context.Context, group *kcc.Group, sessionID kcc.KCSessionID) (*kcc.CreateGroupResponse, error) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			if err := s.change("createGroup %s %q", group.Groupname, group.FullName); err != nil {
+				return nil, err
+			}
+			return &kcc.CreateGroupResponse{GroupEntryID: "new-" + group.Groupname}, nil
+		},
+		DeleteGroupFunc: func(ctx context.Context, groupEntryID string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			return &kcc.UserAdminResponse{}, s.change("deleteGroup %s", groupEntryID)
+		},
+		AddGroupUserFunc: func(ctx context.Context, groupEntryID, userEntryID string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			return &kcc.UserAdminResponse{}, s.change("addGroupUser %s %s", groupEntryID, userEntryID)
+		},
+		DeleteGroupUserFunc: func(ctx context.Context, groupEntryID, userEntryID string, sessionID kcc.KCSessionID) (*kcc.UserAdminResponse, error) {
+			s.mutex.Lock()
+			defer s.mutex.Unlock()
+			return &kcc.UserAdminResponse{}, s.change("deleteGroupUser %s %s", groupEntryID, userEntryID)
+		},
+	}
+}
+
+func planOperations(plan *Plan) []string {
+	var operations []string
+	for _, op := range plan.Operations {
+		operations = append(operations, op.String())
+	}
+	return operations
+}
+
+func TestPlan(t *testing.T) {
+	state, err := DecodeState(strings.NewReader(testState))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(newTestServer().client(), 1)
+	plan, err := r.Plan(context.Background(), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"create-user user3",
+		"update-user user1",
+		"create-group group2",
+		"add-member group1 user3",
+		"add-member group2 user3",
+		"remove-member group1 user2",
+	}
+	if operations := planOperations(plan); !reflect.DeepEqual(operations, expected) {
+		t.Errorf("unexpected operations: %v", operations)
+	}
+	var diffs []string
+	for _, diff := range plan.Operations[1].Diffs {
+		diffs = append(diffs, diff.String())
+	}
+	if expectedDiffs := []string{
+		`~ lpszFullName: "User 1" -> "User One"`,
+		`+ lpsPropmap[0x3A18001F]: "Sales"`,
+	}; !reflect.DeepEqual(diffs, expectedDiffs) {
+		t.Errorf("unexpected update diffs: %v", diffs)
+	}
+
+	r.Prune = true
+	plan, err = r.Plan(context.Background(), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"create-user user3",
+		"update-user user1",
+		"create-group group2",
+		"add-member group1 user3",
+		"add-member group2 user3",
+		"delete-group old",
+		"delete-user user2",
+	}
+	if operations := planOperations(plan); !reflect.DeepEqual(operations, expected) {
+		t.Errorf("unexpected pruning operations: %v", operations)
+	}
+}
+
+func TestPlanUnknownMember(t *testing.T) {
+	state := &State{
+		Groups: []*GroupSpec{{Groupname: "group1", Members: []string{"user2", "nobody"}}},
+	}
+
+	r := New(newTestServer().client(), 1)
+	if _, err := r.Plan(context.Background(), state); err == nil || !strings.Contains(err.Error(), "member nobody does not exist") {
+		t.Errorf("expected unknown member error, got %v", err)
+	}
+	state.Groups[0].Members = []string{"user2"}
+	r.Prune = true
+	if _, err := r.Plan(context.Background(), state); err == nil || !strings.Contains(err.Error(), "member user2 would be pruned") {
+		t.Errorf("expected pruned member error, got %v", err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	state, err := DecodeState(strings.NewReader(testState))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestServer()
+	r := New(server.client(), 1)
+	r.Prune = true
+	r.BatchSize = 2
+	plan, err := r.Plan(context.Background(), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []int
+	r.Progress = func(done, total int, result *Result) {
+		if total != len(plan.Operations) {
+			t.Errorf("unexpected progress total: %d", total)
+		}
+		progress = append(progress, done)
+	}
+
+	r.DryRun = true
+	results, err := r.Apply(context.Background(), plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(plan.Operations) || len(server.changes) != 0 {
+		t.Errorf("unexpected dry run: %d results, changes %v", len(results), server.changes)
+	}
+
+	r.DryRun = false
+	progress = nil
+	results, err = r.Apply(context.Background(), plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(plan.Operations) || len(progress) != len(plan.Operations) || progress[len(progress)-1] != len(plan.Operations) {
+		t.Errorf("unexpected results %d and progress %v", len(results), progress)
+	}
+	for idx, result := range results {
+		if result.Err != nil || result.Operation != plan.Operations[idx] {
+			t.Errorf("unexpected result %d: %+v", idx, result)
+		}
+	}
+	// Memberships are applied concurrently, sort them for comparison.
+	sort.Strings(server.changes[3:5])
+	expected := []string{
+		`createUser user3 secret "User 3" 1`,
+		`setUser u1 "User One" "Sales"`,
+		`createGroup group2 "Group 2"`,
+		"addGroupUser g1 new-user3",
+		"addGroupUser new-group2 new-user3",
+		"deleteGroup g4",
+		"deleteUser u2",
+	}
+	if !reflect.DeepEqual(server.changes, expected) {
+		t.Errorf("unexpected changes: %v", server.changes)
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	state, err := DecodeState(strings.NewReader(testState))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := newTestServer()
+	server.fail[`createUser user3 secret "User 3" 1`] = true
+	r := New(server.client(), 1)
+	plan, err := r.Plan(context.Background(), state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := r.Apply(context.Background(), plan)
+	if err == nil || !strings.Contains(err.Error(), "create-user user3 failed") {
+		t.Errorf("expected create error, got %v", err)
+	}
+	if len(results) != 1 || len(server.changes) != 0 {
+		t.Errorf("expected apply to stop after first batch: %d results, changes %v", len(results), server.changes)
+	}
+
+	r.ContinueOnError = true
+	results, err = r.Apply(context.Background(), plan)
+	if err == nil || err.Error() != "reconcile failed: 3 of 6 operations failed" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(results) != 6 || results[3].Err != ErrNotCreated || results[4].Err != ErrNotCreated {
+		t.Errorf("expected memberships of user which was not created to fail: %+v", results)
+	}
+}
+
+func TestDecodeState(t *testing.T) {
+	for _, test := range []struct {
+		state string
+		err   string
+	}{
+		{`{"users": [{"username": "user1", "email": "x"}]}`, "unknown field"},
+		{`{"users": [{"username": "user1"}, {"username": "User1"}]}`, "user User1 is duplicate"},
+		{`{"users": [{"fullName": "x"}]}`, "user 0 has no username"},
+		{`{"users": [{"username": "system"}]}`, "user system is built in"},
+		{`{"groups": [{"groupname": "everyone"}]}`, "group everyone is built in"},
+		{`{"groups": [{"groupname": "group1", "members": ["a", "A"]}]}`, "duplicate member"},
+	} {
+		_, err := DecodeState(strings.NewReader(test.state))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expected error %q for %s, got %v", test.err, test.state, err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package reconcile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// Names of built in users and groups which are never changed or deleted.
+const (
+	SystemUsername = "SYSTEM"
+	EveryoneGroup  = "Everyone"
+)
+
+// A State is the desired state of the users and groups of Kopano server.
+type State struct {
+	Users  []*UserSpec  `json:"users"`
+	Groups []*GroupSpec `json:"groups"`
+}
+
+// A UserSpec holds the desired details of a user, identified by its username.
+// Fields which are nil are not managed and keep their current values, the
+// same applies to properties which are not listed. Password is only used when
+// the user is created.
+type UserSpec struct {
+	Username    string              `json:"username"`
+	Password    string              `json:"password,omitempty"`
+	FullName    *string             `json:"fullName,omitempty"`
+	MailAddress *string             `json:"mailAddress,omitempty"`
+	Admin       *bool               `json:"admin,omitempty"`
+	NonActive   *bool               `json:"nonActive,omitempty"`
+	Props       map[kcc.PT]string   `json:"props,omitempty"`
+	MVProps     map[kcc.PT][]string `json:"mvProps,omitempty"`
+}
+
+// A GroupSpec holds the desired details of a group, identified by its group
+// name. Fields which are nil are not managed and keep their current values.
+// Members lists the usernames of the members of the group, with nil the
+// members are not managed while an empty list removes all members.
+type GroupSpec struct {
+	Groupname   string   `json:"groupname"`
+	FullName    *string  `json:"fullName,omitempty"`
+	MailAddress *string  `json:"mailAddress,omitempty"`
+	Members     []string `json:"members"`
+}
+
+// DecodeState reads a State as JSON from the provided reader and validates
+// it. Unknown fields are rejected to catch typos in hand written states.
+func DecodeState(r io.Reader) (*State, error) {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	var state State
+	if err := decoder.Decode(&state); err != nil {
+		return nil, fmt.Errorf("reconcile state decode failed: %v", err)
+	}
+	if err := state.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// ReadState reads a State as JSON from the file with the provided name, with
+// - reading from stdin.
+func ReadState(filename string) (*State, error) {
+	if filename == "-" {
+		return DecodeState(os.Stdin)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return DecodeState(f)
+}
+
+// Validate checks that all users and groups of the accociated State are named,
+// unique and not built in. Names are compared case insensitive like Kopano
+// server does.
+func (s *State) Validate() error {
+	users := make(map[string]bool)
+	for idx, spec := range s.Users {
+		if spec == nil || spec.Username == "" {
+			return fmt.Errorf("reconcile state user %d has no username", idx)
+		}
+		key := nameKey(spec.Username)
+		if key == nameKey(SystemUsername) {
+			return fmt.Errorf("reconcile state user %s is built in", spec.Username)
+		}
+		if users[key] {
+			return fmt.Errorf("reconcile state user %s is duplicate", spec.Username)
+		}
+		users[key] = true
+	}
+
+	groups := make(map[string]bool)
+	for idx, spec := range s.Groups {
+		if spec == nil || spec.Groupname == "" {
+			return fmt.Errorf("reconcile state group %d has no group name", idx)
+		}
+		key := nameKey(spec.Groupname)
+		if key == nameKey(EveryoneGroup) {
+			return fmt.Errorf("reconcile state group %s is built in", spec.Groupname)
+		}
+		if groups[key] {
+			return fmt.Errorf("reconcile state group %s is duplicate", spec.Groupname)
+		}
+		groups[key] = true
+
+		members := make(map[string]bool)
+		for _, member := range spec.Members {
+			memberKey := nameKey(member)
+			if member == "" || members[memberKey] {
+				return fmt.Errorf("reconcile state group %s has empty or duplicate member %q", spec.Groupname, member)
+			}
+			members[memberKey] = true
+		}
+	}
+
+	return nil
+}
+
+// apply sets the managed details of the accociated UserSpec on the provided
+// user. The username is left alone, as it is used to find the user.
+func (spec *UserSpec) apply(user *kcc.User) {
+	if spec.FullName != nil {
+		user.FullName = *spec.FullName
+	}
+	if spec.MailAddress != nil {
+		user.MailAddress = *spec.MailAddress
+	}
+	if spec.Admin != nil {
+		user.IsAdmin = 0
+		if *spec.Admin {
+			user.IsAdmin = 1
+		}
+	}
+	if spec.NonActive != nil {
+		user.IsNonActive = 0
+		user.ObjClass = kcc.ACTIVE_USER
+		if *spec.NonActive {
+			user.IsNonActive = 1
+			user.ObjClass = kcc.NONACTIVE_USER
+		}
+	}
+
+	if len(spec.Props) > 0 {
+		props := kcc.PropMap{}
+		if user.Props != nil {
+			for _, value := range *user.Props {
+				if _, ok := spec.Props[value.ID]; !ok {
+					props = append(props, value)
+				}
+			}
+		}
+		ids := make([]kcc.PT, 0, len(spec.Props))
+		for id := range spec.Props {
+			ids = append(ids, id)
+		}
+		for _, id := range sortPropIDs(ids) {
+			props = append(props, &kcc.PropMapValue{ID: id, StringValue: spec.Props[id]})
+		}
+		user.Props = &props
+	}
+	if len(spec.MVProps) > 0 {
+		mvProps := kcc.MVPropMap{}
+		if user.MVProps != nil {
+			for _, value := range *user.MVProps {
+				if _, ok := spec.MVProps[value.ID]; !ok {
+					mvProps = append(mvProps, value)
+				}
+			}
+		}
+		ids := make([]kcc.PT, 0, len(spec.MVProps))
+		for id := range spec.MVProps {
+			ids = append(ids, id)
+		}
+		for _, id := range sortPropIDs(ids) {
+			mvProps = append(mvProps, &kcc.MVPropMapValue{ID: id, StringValues: spec.MVProps[id]})
+		}
+		user.MVProps = &mvProps
+	}
+}
+
+// apply sets the managed details of the accociated GroupSpec on the provided
+// group. The group name is left alone, as it is used to find the group.
+func (spec *GroupSpec) apply(group *kcc.Group) {
+	if spec.FullName != nil {
+		group.FullName = *spec.FullName
+	}
+	if spec.MailAddress != nil {
+		group.MailAddress = *spec.MailAddress
+	}
+}
+
+// sortPropIDs sorts the provided property IDs in place and returns them, so
+// properties are written in a stable order.
+func sortPropIDs(ids []kcc.PT) []kcc.PT {
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// nameKey returns the key of the provided user or group name in maps, as
+// Kopano server compares names case insensitive.
+func nameKey(name string) string {
+	return strings.ToLower(name)
+}
@@ -0,0 +1,216 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Default retry settings. With a DefaultRetryMaxAttempts of 1, requests are
+// not retried.
+var (
+	DefaultRetryMaxAttempts = 1
+	DefaultRetryMinBackoff  = 100 * time.Millisecond
+	DefaultRetryMaxBackoff  = 5 * time.Second
+	DefaultRetryJitter      = 0.2
+
+	// DefaultRetryPolicy is used by SOAP clients without RetryPolicy.
+	DefaultRetryPolicy *RetryPolicy
+)
+
+func init() {
+	if s := os.Getenv("KCC_GO_RETRY_MAX_ATTEMPTS"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil {
+			DefaultRetryMaxAttempts = n
+		}
+	}
+	if s := os.Getenv("KCC_GO_RETRY_MIN_BACKOFF"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			DefaultRetryMinBackoff = d
+		}
+	}
+	if s := os.Getenv("KCC_GO_RETRY_MAX_BACKOFF"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			DefaultRetryMaxBackoff = d
+		}
+	}
+	if s := os.Getenv("KCC_GO_RETRY_JITTER"); s != "" {
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			DefaultRetryJitter = n
+		}
+	}
+
+	DefaultRetryPolicy = NewRetryPolicy()
+}
+
+// A RetryPolicy defines how SOAP clients retry requests which failed with a
+// transient error, see IsRetryable. Requests are sent up to MaxAttempts times.
+// Before every retry, the client waits for a backoff which starts with
+// MinBackoff and doubles with every retry up to MaxBackoff. The backoff is
+// varied randomly by up to the Jitter ratio, so clients do not retry in
+// lockstep. Requests are only retried if no part of the response was decoded.
+//
+// NOTE(longsleep): A request which timed out might have been processed by the
+// server. Only enable retries if the requests of the client can safely be sent
+// more than once.
+type RetryPolicy struct {
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+	Jitter      float64
+}
+
+// NewRetryPolicy creates a new RetryPolicy with default settings.
+func NewRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: DefaultRetryMaxAttempts,
+		MinBackoff:  DefaultRetryMinBackoff,
+		MaxBackoff:  DefaultRetryMaxBackoff,
+		Jitter:      DefaultRetryJitter,
+	}
+}
+
+// Backoff returns the delay before the provided retry, starting with 1.
+func (p *RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := p.MinBackoff
+	for i := 1; i < retry && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		backoff += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(backoff))
+	}
+	if backoff < 0 {
+		backoff = 0
+	}
+
+	return backoff
+}
+
+// wait blocks for the backoff of the provided attempt, if the request which
+// failed with the provided error should be retried. Returns false if the
+// request should not be retried or the provided context is done.
+func (p *RetryPolicy) wait(ctx context.Context, attempt int, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if ctx.Err() != nil {
+		return false
+	}
+
+	delay := p.Backoff(attempt)
+	if e, ok := err.(*HTTPStatusError); ok && e.RetryAfter > delay {
+		delay = e.RetryAfter
+	}
+	if debug {
+		fmt.Printf("SOAP request failed (%v), retrying in %v\n", err, delay)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+type retryPolicyKey struct{}
+
+// WithRetryPolicy returns a copy of the provided context with the provided
+// RetryPolicy. Requests using the returned context are retried accordingly,
+// regardless of the RetryPolicy of the client.
+func WithRetryPolicy(ctx context.Context, policy *RetryPolicy) context.Context {
+	return context.WithValue(ctx, retryPolicyKey{}, policy)
+}
+
+// retryPolicyFromContext returns the RetryPolicy of the provided context, or
+// the provided policy if the context has none. If both are nil,
+// DefaultRetryPolicy is returned.
+func retryPolicyFromContext(ctx context.Context, policy *RetryPolicy) *RetryPolicy {
+	if ctx != nil {
+		if p, ok := ctx.Value(retryPolicyKey{}).(*RetryPolicy); ok && p != nil {
+			return p
+		}
+	}
+	if policy == nil {
+		policy = DefaultRetryPolicy
+	}
+
+	return policy
+}
+
+// IsRetryable returns true if the provided error is transient, so the request
+// which failed with it can be retried. Connection resets, refused connections,
+// timeouts, unexpected ends of responses and HTTP server errors are transient.
+func IsRetryable(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *HTTPStatusError:
+		return e.StatusCode >= 500
+	case *url.Error:
+		return e.Timeout() || IsRetryable(e.Err)
+	case *net.OpError:
+		return e.Timeout() || IsRetryable(e.Err)
+	case *os.SyscallError:
+		return IsRetryable(e.Err)
+	case syscall.Errno:
+		return isRetryableErrno(e)
+	case net.Error:
+		return e.Timeout()
+	}
+
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// A retryPolicySOAPClient wraps a SOAPClient, sending all requests with its
+// RetryPolicy unless the request context has one already.
+type retryPolicySOAPClient struct {
+	client SOAPClient
+	policy *RetryPolicy
+}
+
+func (rc *retryPolicySOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if _, ok := ctx.Value(retryPolicyKey{}).(*RetryPolicy); !ok {
+		ctx = WithRetryPolicy(ctx, rc.policy)
+	}
+
+	return rc.client.DoRequest(ctx, payload, v)
+}
+
+func (rc *retryPolicySOAPClient) String() string {
+	return fmt.Sprintf("%s", rc.client)
+}
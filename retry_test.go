@@ -0,0 +1,85 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{io.ErrUnexpectedEOF, true},
+		{&HTTPStatusError{StatusCode: http.StatusBadGateway}, true},
+		{&HTTPStatusError{StatusCode: http.StatusNotFound}, false},
+		{&url.Error{Op: "Post", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{context.Canceled, false},
+		{KCERR_NOT_FOUND, false},
+	} {
+		if retryable := IsRetryable(tc.err); retryable != tc.retryable {
+			t.Errorf("unexpected result for %v: %v", tc.err, retryable)
+		}
+	}
+}
+
+func TestSOAPHTTPClientRetry(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1)%3 != 0 {
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		rw.Write([]byte(soapHeader + "<ns:resolveUserResponse><er>0</er><sUserId>user1-id</sUserId></ns:resolveUserResponse>" + soapFooter))
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		HTTPClient:  srv.Client(),
+		RetryPolicy: &RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewKCCWithClient(client)
+
+	if _, err = c.ResolveUsername(context.Background(), "user1", 1); !IsRetryable(err) {
+		t.Fatalf("expected request without retries to fail: %v", err)
+	}
+
+	// Overriding the policy per KCC retries until the third request succeeds.
+	c.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	resp, err := c.ResolveUsername(context.Background(), "user1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.UserEntryID != "user1-id" || atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("unexpected response after %d requests: %+v", requests, resp)
+	}
+}
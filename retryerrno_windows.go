@@ -0,0 +1,44 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"syscall"
+)
+
+// Windows system errors which are not defined by the syscall package.
+const (
+	errorNoData           syscall.Errno = 232
+	errorPipeNotConnected syscall.Errno = 233
+	wsaeConnRefused       syscall.Errno = 10061
+)
+
+// isRetryableErrno returns true if the provided system error is a connection
+// reset, refused or aborted connection or a broken or closing named pipe.
+func isRetryableErrno(e syscall.Errno) bool {
+	switch e {
+	case syscall.WSAECONNRESET, wsaeConnRefused, syscall.WSAECONNABORTED,
+		syscall.ERROR_BROKEN_PIPE, errorNoData, errorPipeNotConnected:
+		return true
+	case syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.EPIPE:
+		// NOTE(longsleep): Never returned by the Windows network stack, the
+		// syscall package defines them for compatibility only.
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,154 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+)
+
+// A CompanyScope restricts list and resolve calls to the users of a single
+// company, so data of other companies cannot leak in multi-tenant setups by
+// accident. Results outside of the scope fail with KCERR_NOT_FOUND, so the
+// existence of users of other companies is not revealed either.
+type CompanyScope struct {
+	Company *Company
+
+	c KopanoClient
+}
+
+// NewCompanyScope creates a CompanyScope for the company of the user
+// accociated with the provided session. It fails on servers which are not
+// set up for multiple companies.
+func NewCompanyScope(ctx context.Context, c KopanoClient, sessionID KCSessionID) (*CompanyScope, error) {
+	response, err := c.GetCompany(ctx, "", sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("company scope getCompany failed: %v", err)
+	}
+	if response.Er != KCSuccess {
+		return nil, response.Er
+	}
+	if response.Company == nil || response.Company.CompanyEntryID == "" {
+		return nil, fmt.Errorf("company scope getCompany returned no company")
+	}
+
+	return &CompanyScope{
+		Company: response.Company,
+
+		c: c,
+	}, nil
+}
+
+// ListUsers lists the users of the accociated scope's company using the
+// provided session. See KCC.ListUsers for details.
+func (cs *CompanyScope) ListUsers(ctx context.Context, sessionID KCSessionID, cb func(*User) error) error {
+	return cs.c.ListUsers(ctx, cs.Company.CompanyEntryID, sessionID, cb)
+}
+
+// ResolveNames resolves the provided names like KCC.ResolveNames, failing
+// names which resolve to an entry of another company.
+func (cs *CompanyScope) ResolveNames(ctx context.Context, names []string, props []PT, sessionID KCSessionID) ([]*ResolveNameResult, error) {
+	requested := false
+	for _, pt := range props {
+		if pt == PR_EC_COMPANY_NAME {
+			requested = true
+			break
+		}
+	}
+	scopedProps := props
+	if !requested {
+		scopedProps = append(append(make([]PT, 0, len(props)+1), props...), PR_EC_COMPANY_NAME)
+	}
+
+	results, err := cs.c.ResolveNames(ctx, names, scopedProps, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		if result.Props.GetString(PR_EC_COMPANY_NAME) != cs.Company.Name {
+			result.Props = nil
+			result.Err = KCERR_NOT_FOUND
+			continue
+		}
+		if !requested {
+			values := result.Props.PropTagValues[:0]
+			for _, value := range result.Props.PropTagValues {
+				if value.PropTag != PR_EC_COMPANY_NAME {
+					values = append(values, value)
+				}
+			}
+			result.Props.PropTagValues = values
+		}
+	}
+
+	return results, nil
+}
+
+// GetUsersByName fetches users like KCC.GetUsersByName, failing users which
+// are not members of the accociated scope's company.
+func (cs *CompanyScope) GetUsersByName(ctx context.Context, usernames []string, sessionID KCSessionID) ([]*UserResult, error) {
+	results, err := cs.c.GetUsersByName(ctx, usernames, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	var members map[uint64]bool
+	for _, result := range results {
+		if result.User == nil {
+			continue
+		}
+		if members == nil {
+			if members, err = cs.members(ctx, sessionID); err != nil {
+				return nil, err
+			}
+		}
+		if !members[result.User.ID] {
+			result.User = nil
+			result.Err = KCERR_NOT_FOUND
+		}
+	}
+
+	return results, nil
+}
+
+// Contains returns true if the user with the provided ID is a member of the
+// accociated scope's company.
+func (cs *CompanyScope) Contains(ctx context.Context, userID uint64, sessionID KCSessionID) (bool, error) {
+	members, err := cs.members(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	return members[userID], nil
+}
+
+func (cs *CompanyScope) members(ctx context.Context, sessionID KCSessionID) (map[uint64]bool, error) {
+	members := make(map[uint64]bool)
+	err := cs.ListUsers(ctx, sessionID, func(user *User) error {
+		members[user.ID] = true
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("company scope members failed: %v", err)
+	}
+
+	return members, nil
+}
@@ -0,0 +1,107 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"testing"
+)
+
+// A scopeTestClient implements the calls used by CompanyScope for two
+// companies, panicking on all other calls.
+type scopeTestClient struct {
+	KopanoClient
+}
+
+func (sc *scopeTestClient) GetCompany(ctx context.Context, companyEntryID string, sessionID KCSessionID) (*GetCompanyResponse, error) {
+	return &GetCompanyResponse{
+		Company: &Company{
+			ID:             1,
+			Name:           "company1",
+			CompanyEntryID: "company1-eid",
+		},
+	}, nil
+}
+
+func (sc *scopeTestClient) ListUsers(ctx context.Context, companyEntryID string, sessionID KCSessionID, cb func(*User) error) error {
+	if companyEntryID != "company1-eid" {
+		return KCERR_NO_ACCESS
+	}
+	return cb(&User{ID: 3, Username: "user1"})
+}
+
+func (sc *scopeTestClient) ResolveNames(ctx context.Context, names []string, props []PT, sessionID KCSessionID) ([]*ResolveNameResult, error) {
+	results := make([]*ResolveNameResult, len(names))
+	for idx, name := range names {
+		company := "company1"
+		if name == "other" {
+			company = "company2"
+		}
+		results[idx] = &ResolveNameResult{
+			Index: idx,
+			Name:  name,
+			Props: &PropTagRowSet{
+				PropTagValues: []*PropTagRowSetValue{
+					{PropTag: PR_DISPLAY_NAME, AStringValue: name},
+					{PropTag: PR_EC_COMPANY_NAME, AStringValue: company},
+				},
+			},
+		}
+	}
+	return results, nil
+}
+
+func (sc *scopeTestClient) GetUsersByName(ctx context.Context, usernames []string, sessionID KCSessionID) ([]*UserResult, error) {
+	return []*UserResult{
+		{Index: 0, Username: "user1", User: &User{ID: 3, Username: "user1"}},
+		{Index: 1, Username: "other", User: &User{ID: 4, Username: "other"}},
+	}, nil
+}
+
+func TestCompanyScope(t *testing.T) {
+	ctx := context.Background()
+	scope, err := NewCompanyScope(ctx, &scopeTestClient{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := scope.ResolveNames(ctx, []string{"user1", "other"}, []PT{PR_DISPLAY_NAME}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved[0].Err != nil || len(resolved[0].Props.PropTagValues) != 1 || resolved[0].Props.GetString(PR_DISPLAY_NAME) != "user1" {
+		t.Errorf("unexpected result 0: %+v", resolved[0])
+	}
+	if resolved[1].Err != KCERR_NOT_FOUND || resolved[1].Props != nil {
+		t.Errorf("unexpected result 1: %+v", resolved[1])
+	}
+
+	users, err := scope.GetUsersByName(ctx, []string{"user1", "other"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if users[0].Err != nil || users[0].User == nil {
+		t.Errorf("unexpected user 0: %+v", users[0])
+	}
+	if users[1].Err != KCERR_NOT_FOUND || users[1].User != nil {
+		t.Errorf("unexpected user 1: %+v", users[1])
+	}
+
+	if ok, err := scope.Contains(ctx, 4, 1); err != nil || ok {
+		t.Errorf("unexpected contains result: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+)
+
+// A SendAsReason is the reason a user may send with the address of another
+// user.
+type SendAsReason string
+
+// Send as reasons.
+const (
+	// SendAsSelf means the address is the primary mail address or an alias
+	// of the sender.
+	SendAsSelf SendAsReason = "self"
+	// SendAsList means the sender is in the send as list of the owner of the
+	// address.
+	SendAsList SendAsReason = "sendas"
+	// SendAsDelegate means the sender is a delegate of the owner of the
+	// address.
+	SendAsDelegate SendAsReason = "delegate"
+)
+
+// A SendAsPermission is the result of CheckSendAs.
+type SendAsPermission struct {
+	// Sender is the user who wants to send.
+	Sender *User
+	// Owner is the user who has the address, or nil if no user has it.
+	Owner *User
+	// Allowed is true if Sender may send with the address, for the Reason.
+	Allowed bool
+	Reason  SendAsReason
+}
+
+// CheckSendAs checks if the user with the provided username may send with the
+// provided address, using the provided session, which must have admin rights.
+// Users may send with their own addresses, with the addresses of users which
+// have them in their send as list (PR_EC_SENDAS_USER_ENTRYIDS) and with the
+// addresses of users which have them as delegate in their free/busy data
+// (PR_SCHDINFO_DELEGATE_ENTRYIDS). Groups in send as lists are not expanded.
+// Addresses are resolved with ResolveAlias, sending with addresses no user has
+// is not allowed. KCERR_NOT_FOUND is returned if there is no user with the
+// provided username.
+func (c *KCC) CheckSendAs(ctx context.Context, username string, address string, sessionID KCSessionID) (*SendAsPermission, error) {
+	if username == "" || address == "" {
+		return nil, KCERR_INVALID_PARAMETER
+	}
+
+	results, err := c.GetUsersByName(ctx, []string{username}, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if results[0].Err != nil {
+		return nil, results[0].Err
+	}
+	permission := &SendAsPermission{
+		Sender: results[0].User,
+	}
+	if permission.Sender.HasAddress(address) {
+		permission.Owner = permission.Sender
+		permission.Allowed, permission.Reason = true, SendAsSelf
+		return permission, nil
+	}
+
+	permission.Owner, err = c.ResolveAlias(ctx, address, sessionID)
+	if err == KCERR_NOT_FOUND {
+		return permission, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if permission.Owner.UserEntryID == permission.Sender.UserEntryID {
+		permission.Allowed, permission.Reason = true, SendAsSelf
+		return permission, nil
+	}
+
+	if permission.Owner.MVProps != nil {
+		entryIDs, _ := permission.Owner.MVProps.Get(PR_EC_SENDAS_USER_ENTRYIDS)
+		for _, entryID := range entryIDs {
+			if userEntryIDEqual(entryID, permission.Sender.UserEntryID) {
+				permission.Allowed, permission.Reason = true, SendAsList
+				return permission, nil
+			}
+		}
+	}
+
+	delegate, err := c.isDelegate(ctx, permission.Owner, permission.Sender, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if delegate {
+		permission.Allowed, permission.Reason = true, SendAsDelegate
+	}
+
+	return permission, nil
+}
+
+// isDelegate returns true if the provided delegate is in the delegates of the
+// free/busy data of the provided owner. Owners without store or free/busy data
+// have no delegates.
+func (c *KCC) isDelegate(ctx context.Context, owner *User, delegate *User, sessionID KCSessionID) (bool, error) {
+	store, err := c.OpenUserStore(ctx, owner.Username, sessionID)
+	switch err {
+	case nil:
+	case KCERR_NOT_FOUND, KCERR_NO_ACCESS:
+		return false, nil
+	default:
+		return false, fmt.Errorf("check send as delegates failed: %v", err)
+	}
+
+	// NOTE(longsleep): The second entry of PR_FREEBUSY_ENTRYIDS is the Entry
+	// ID of the LocalFreebusy message, which holds the delegates.
+	value, ok := store.RootProps.Get(PR_FREEBUSY_ENTRYIDS)
+	if !ok || len(value.BinValues) < 2 || len(value.BinValues[1]) == 0 || len(value.BinValues[1][0]) == 0 {
+		return false, nil
+	}
+	values, err := c.GetProps(ctx, string(value.BinValues[1][0]), []PT{PR_SCHDINFO_DELEGATE_ENTRYIDS}, sessionID)
+	switch err {
+	case nil:
+	case KCERR_NOT_FOUND, KCERR_NO_ACCESS:
+		return false, nil
+	default:
+		return false, fmt.Errorf("check send as delegates failed: %v", err)
+	}
+	if len(values) == 0 || values[0] == nil {
+		return false, nil
+	}
+	for _, entryID := range values[0].BinValues {
+		if len(entryID) > 0 && userEntryIDEqual(string(entryID[0]), delegate.UserEntryID) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// userEntryIDEqual returns true if the provided base64 encoded AB Entry IDs
+// refer to the same user. Entry IDs with external ID are compared with
+// ABEIDEqual, others by their numeric ID.
+func userEntryIDEqual(first, second string) bool {
+	if first == second {
+		return true
+	}
+	a, err := NewABEIDFromBase64([]byte(first))
+	if err != nil {
+		return false
+	}
+	b, err := NewABEIDFromBase64([]byte(second))
+	if err != nil {
+		return false
+	}
+	if len(a.ExID()) > 0 && len(b.ExID()) > 0 {
+		return ABEIDEqual(a, b)
+	}
+
+	return a.GUID() == b.GUID() && a.Type() == b.Type() && a.ID() == b.ID()
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckSendAs(t *testing.T) {
+	const (
+		jdoeEntryID   = "AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAMAAAAAAAAA"
+		bossEntryID   = "AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAQAAAAAAAAA"
+		sharedEntryID = "AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAUAAAAAAAAA"
+		amyEntryID    = "AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAYAAAAAAAAA"
+	)
+	user := func(username, mailAddress, entryID, mvProps string) string {
+		return "<lpszUsername>" + username + "</lpszUsername><lpszMailAddress>" + mailAddress + "</lpszMailAddress>" + mvProps + "<sUserId>" + entryID + "</sUserId>"
+	}
+	jdoe := user("jdoe", "jonas@example.com", jdoeEntryID, "<lpsMVPropmap><item><ulPropId>2148470814</ulPropId><sValues><item>jd@example.com</item></sValues></item></lpsMVPropmap>")
+	amy := user("amy", "amy@example.com", amyEntryID, "")
+	client := &actionSOAPClient{
+		responses: map[string]string{
+			"getUserList": "<ns:getUserListResponse><sUserArray>" +
+				"<item>" + jdoe + "</item>" +
+				"<item>" + user("boss", "boss@example.com", bossEntryID, "<lpsMVPropmap><item><ulPropId>1736642818</ulPropId><sValues><item>"+jdoeEntryID+"</item></sValues></item></lpsMVPropmap>") + "</item>" +
+				"<item>" + user("shared", "shared@example.com", sharedEntryID, "") + "</item>" +
+				"<item>" + amy + "</item>" +
+				"</sUserArray><er>0</er></ns:getUserListResponse>",
+			"resolveUserStore": "<ns:resolveUserStoreResponse><er>0</er><lpsStoreId>AAAAADhxUgoAAAAAAQAAAAAAAAA=</lpsStoreId></ns:resolveUserStoreResponse>",
+			"getStore":         "<ns:getStoreResponse><er>0</er><sStoreId>AAAAADhxUgoAAAAAAQAAAAAAAAA=</sStoreId><sRootId>AAAAADhxUgoDAAAAAQAAAAAAAAA=</sRootId><guid>OHFSCgAAAAAAAAAAAAAAAA==</guid></ns:getStoreResponse>",
+			// All objects are loaded with the same props, the root folder
+			// references the LocalFreebusy message which lists jdoe as
+			// delegate.
+			"loadObject": "<ns:loadObjectResponse><er>0</er><sSaveObject><modProps>" +
+				"<item><ulPropTag>920916226</ulPropTag><mvbin><item>AAAAADhxUgoEAAAAAQAAAAAAAAA=</item><item>AAAAADhxUgoFAAAAAQAAAAAAAAA=</item></mvbin></item>" +
+				"<item><ulPropTag>1749356802</ulPropTag><mvbin><item>" + jdoeEntryID + "</item></mvbin></item>" +
+				"</modProps><ulObjType>5</ulObjType></sSaveObject></ns:loadObjectResponse>",
+		},
+	}
+	setSender := func(user string) {
+		client.responses["resolveUsername"] = "<ns:resolveUsernameResponse><er>0</er><sUserId>AAAA</sUserId></ns:resolveUsernameResponse>"
+		client.responses["getUser"] = "<ns:getUserResponse><er>0</er><lpsUser>" + user + "</lpsUser></ns:getUserResponse>"
+	}
+	c := NewKCCWithClient(client)
+
+	for _, test := range []struct {
+		sender  string
+		address string
+		owner   string
+		allowed bool
+		reason  SendAsReason
+		err     error
+	}{
+		{jdoe, "JD@example.com", "jdoe", true, SendAsSelf, nil},
+		{jdoe, "boss@example.com", "boss", true, SendAsList, nil},
+		{jdoe, "shared@example.com", "shared", true, SendAsDelegate, nil},
+		{amy, "shared@example.com", "shared", false, "", nil},
+		{amy, "boss@example.com", "boss", false, "", nil},
+		{amy, "nobody@example.com", "", false, "", nil},
+	} {
+		setSender(test.sender)
+		permission, err := c.CheckSendAs(context.Background(), "sender", test.address, 1)
+		if err != test.err {
+			t.Errorf("unexpected error for %s: %v", test.address, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		owner := ""
+		if permission.Owner != nil {
+			owner = permission.Owner.Username
+		}
+		if owner != test.owner || permission.Allowed != test.allowed || permission.Reason != test.reason {
+			t.Errorf("unexpected permission for %s: owner %s, allowed %v, reason %q", test.address, owner, permission.Allowed, permission.Reason)
+		}
+	}
+
+	if _, err := c.CheckSendAs(context.Background(), "", "boss@example.com", 1); err != KCERR_INVALID_PARAMETER {
+		t.Errorf("expected invalid parameter without username, got %v", err)
+	}
+}
+
+func TestUserEntryIDEqual(t *testing.T) {
+	for _, test := range []struct {
+		first, second string
+		equal         bool
+	}{
+		{"AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAMAAAAAAAAA", "AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAMAAAAAAAAA", true},
+		{"AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAMAAAAAAAAA", "AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAQAAAAAAAAA", false},
+		{"AAAAAKwhqVBA0+5Isxn7p1MwRCUBAAAABgAAAAMAAAAAAAAA", "invalid", false},
+	} {
+		if equal := userEntryIDEqual(test.first, test.second); equal != test.equal {
+			t.Errorf("unexpected equality of %s and %s: %v", test.first, test.second, equal)
+		}
+	}
+}
@@ -51,6 +51,9 @@ type Session struct {
 	active     bool
 	when       time.Time
 
+	adminLevel      AdminLevel
+	adminLevelKnown bool
+
 	mutex     sync.RWMutex
 	ctx       context.Context
 	ctxCancel context.CancelFunc
@@ -62,47 +65,23 @@ type Session struct {
 // NewSession connects to the provided server with the provided parameters,
 // creates a new Session which will be automatically refreshed until detroyed.
 func NewSession(ctx context.Context, c *KCC, username, password string) (*Session, error) {
-	if c == nil {
-		c = NewKCC(nil)
-	}
-	if ctx == nil {
-		ctx = context.Background()
-	}
-
-	resp, err := c.Logon(ctx, username, password, 0)
-	if err != nil {
-		return nil, fmt.Errorf("create session logon failed: %v", err)
-	}
-	if resp.Er != KCSuccess {
-		return nil, fmt.Errorf("create session logon mapi error: %v", resp.Er)
-	}
-	if resp.SessionID == KCNoSessionID {
-		return nil, fmt.Errorf("create session logon returned invalid session ID")
-	}
-	if resp.ServerGUID == "" {
-		return nil, fmt.Errorf("create session logon return invalid server GUID")
-	}
-
-	sessionCtx, cancel := context.WithCancel(ctx)
-	s := &Session{
-		id:         resp.SessionID,
-		serverGUID: resp.ServerGUID,
-
-		active: true,
-		when:   time.Now(),
-
-		ctx:       sessionCtx,
-		ctxCancel: cancel,
-		c:         c,
-	}
-
-	err = s.StartAutoRefresh()
-	return s, err
+	return newSession(ctx, c, "logon", func(ctx context.Context, c *KCC) (*LogonResponse, error) {
+		return c.Logon(ctx, username, password, 0)
+	})
 }
 
 // NewSSOSession connects to the provided server with the provided parameters,
 // creates a new Session which will be automatically refreshed until detroyed.
 func NewSSOSession(ctx context.Context, c *KCC, prefix SSOType, username string, input []byte, sessionID KCSessionID) (*Session, error) {
+	return newSession(ctx, c, "sso logon", func(ctx context.Context, c *KCC) (*LogonResponse, error) {
+		return c.SSOLogon(ctx, prefix, username, input, sessionID, 0)
+	})
+}
+
+// newSession creates a new Session with the response of the provided logon
+// function, which will be automatically refreshed until detroyed. The
+// provided kind names the logon in errors.
+func newSession(ctx context.Context, c *KCC, kind string, logon func(context.Context, *KCC) (*LogonResponse, error)) (*Session, error) {
 	if c == nil {
 		c = NewKCC(nil)
 	}
@@ -110,18 +89,18 @@ func NewSSOSession(ctx context.Context, c *KCC, prefix SSOType, username string,
 		ctx = context.Background()
 	}
 
-	resp, err := c.SSOLogon(ctx, prefix, username, input, sessionID, 0)
+	resp, err := logon(ctx, c)
 	if err != nil {
-		return nil, fmt.Errorf("create session sso logon failed: %v", err)
+		return nil, fmt.Errorf("create session %s failed: %v", kind, err)
 	}
 	if resp.Er != KCSuccess {
-		return nil, fmt.Errorf("create session sso logon mapi error: %v", resp.Er)
+		return nil, fmt.Errorf("create session %s mapi error: %v", kind, resp.Er)
 	}
 	if resp.SessionID == KCNoSessionID {
-		return nil, fmt.Errorf("create session sso logon returned invalid session ID")
+		return nil, fmt.Errorf("create session %s returned invalid session ID", kind)
 	}
 	if resp.ServerGUID == "" {
-		return nil, fmt.Errorf("create session sso logon return invalid server GUID")
+		return nil, fmt.Errorf("create session %s return invalid server GUID", kind)
 	}
 
 	sessionCtx, cancel := context.WithCancel(ctx)
@@ -136,6 +115,7 @@ func NewSSOSession(ctx context.Context, c *KCC, prefix SSOType, username string,
 		ctxCancel: cancel,
 		c:         c,
 	}
+	s.emit(SessionCreated, nil)
 
 	err = s.StartAutoRefresh()
 	return s, err
@@ -170,6 +150,7 @@ func CreateSession(ctx context.Context, c *KCC, id KCSessionID, serverGUID strin
 	if active {
 		s.when = time.Now()
 	}
+	s.emit(SessionCreated, nil)
 
 	return s, nil
 }
@@ -207,6 +188,7 @@ func (s *Session) Destroy(ctx context.Context, logoff bool) error {
 	s.active = false
 	s.mutex.Unlock()
 	s.ctxCancel()
+	s.emit(SessionDestroyed, nil)
 
 	if logoff {
 		resp, err := s.c.Logoff(ctx, s.id)
@@ -246,6 +228,7 @@ func (s *Session) Refresh() error {
 	s.mutex.Lock()
 	s.when = time.Now()
 	s.mutex.Unlock()
+	s.emit(SessionRefreshed, nil)
 
 	return nil
 }
@@ -286,6 +269,7 @@ func (s *Session) runAutoRefresh(stop chan bool) error {
 			case <-ticker.C:
 				err := s.Refresh()
 				if err != nil {
+					s.emit(SessionExpired, err)
 					s.Destroy(ctx, err != KCERR_END_OF_SESSION)
 					s.StopAutoRefresh()
 				}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"fmt"
+	"time"
+)
+
+// A SessionEventType is the lifecycle transition a SessionEvent reports.
+type SessionEventType int
+
+// SessionEventType values.
+const (
+	// SessionCreated is emitted when a Session was created, either with a
+	// logon or from existing session data.
+	SessionCreated SessionEventType = iota + 1
+	// SessionRefreshed is emitted when a Session was refreshed successfully.
+	SessionRefreshed
+	// SessionExpired is emitted when the auto refresh of a Session failed, so
+	// the session is no longer valid at the server. The Session is destroyed
+	// afterwards, emitting SessionDestroyed.
+	SessionExpired
+	// SessionDestroyed is emitted when an active Session was destroyed.
+	SessionDestroyed
+)
+
+func (t SessionEventType) String() string {
+	switch t {
+	case SessionCreated:
+		return "created"
+	case SessionRefreshed:
+		return "refreshed"
+	case SessionExpired:
+		return "expired"
+	case SessionDestroyed:
+		return "destroyed"
+	default:
+		return "unknown"
+	}
+}
+
+// A SessionEvent describes a lifecycle transition of a Session. Err is set
+// for SessionExpired events with the error of the failed refresh.
+type SessionEvent struct {
+	Type       SessionEventType
+	SessionID  KCSessionID
+	ServerGUID string
+	When       time.Time
+	Err        error
+}
+
+func (e *SessionEvent) String() string {
+	return fmt.Sprintf("type=%s session=%s server=%s err=%v", e.Type, e.SessionID, e.ServerGUID, e.Err)
+}
+
+// DefaultSessionEventHandler is called with the SessionEvents of Sessions
+// whose KCC has no session event handler. If nil, events are not reported.
+var DefaultSessionEventHandler func(*SessionEvent)
+
+// SetSessionEventHandler sets the handler which is called with the
+// SessionEvents of all Sessions created with the accociated KCC, so
+// applications can log, meter and react to session lifecycle transitions
+// uniformly. Handlers are called synchronously and must not block. Set the
+// handler before creating sessions. If handler is nil,
+// DefaultSessionEventHandler is used.
+func (c *KCC) SetSessionEventHandler(handler func(*SessionEvent)) {
+	c.sessionEvents = handler
+}
+
+// emit reports a SessionEvent of the provided type for the accociated
+// Session. Panics of the handler are reported with ReportPanic.
+func (s *Session) emit(t SessionEventType, err error) {
+	handler := DefaultSessionEventHandler
+	if s.c != nil && s.c.sessionEvents != nil {
+		handler = s.c.sessionEvents
+	}
+	if handler == nil {
+		return
+	}
+
+	event := &SessionEvent{
+		Type:       t,
+		SessionID:  s.id,
+		ServerGUID: s.serverGUID,
+		When:       time.Now(),
+		Err:        err,
+	}
+	runSafely(func() {
+		handler(event)
+	})
+}
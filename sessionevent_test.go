@@ -0,0 +1,76 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSessionEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		switch {
+		case strings.Contains(string(body), "<ns:logon>"):
+			rw.Write([]byte(soapHeader + "<ns:logonResponse><er>0</er><ulSessionId>1</ulSessionId><sServerGuid>guid</sServerGuid></ns:logonResponse>" + soapFooter))
+		case strings.Contains(string(body), "<ns:resolveUsername>"):
+			rw.Write([]byte(soapHeader + "<ns:resolveUserResponse><er>0</er><sUserId>system-id</sUserId></ns:resolveUserResponse>" + soapFooter))
+		case strings.Contains(string(body), "<ns:logoff>"):
+			rw.Write([]byte(soapHeader + "<ns:logoffResponse><er>0</er></ns:logoffResponse>" + soapFooter))
+		default:
+			rw.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewKCCWithClient(client)
+	var events []SessionEventType
+	c.SetSessionEventHandler(func(event *SessionEvent) {
+		if event.SessionID != 1 || event.ServerGUID != "guid" {
+			t.Errorf("unexpected event: %v", event)
+		}
+		events = append(events, event.Type)
+	})
+
+	session, err := NewSession(context.Background(), c, "user1", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = session.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if err = session.Destroy(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	// Destroying again is no transition.
+	session.Destroy(context.Background(), true)
+
+	if !reflect.DeepEqual(events, []SessionEventType{SessionCreated, SessionRefreshed, SessionDestroyed}) {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
@@ -0,0 +1,543 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	mathrand "math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultSessionManagerMaxSessions is the maximum number of sessions kept
+	// by a SessionManager. When exceeded, the least recently used session is
+	// evicted.
+	DefaultSessionManagerMaxSessions = 1000
+	// DefaultSessionManagerIdleTTL is the duration after which sessions which
+	// were not used are evicted from a SessionManager.
+	DefaultSessionManagerIdleTTL = 30 * time.Minute
+	// DefaultSessionManagerRelogonInterval is the interval in which new
+	// SessionManagers log on lost sessions again, see SetRelogon. An interval
+	// of 0 disables re-logon.
+	DefaultSessionManagerRelogonInterval time.Duration
+	// DefaultSessionManagerRelogonJitter is the ratio the re-logon interval
+	// is varied randomly by.
+	DefaultSessionManagerRelogonJitter = 0.5
+)
+
+func init() {
+	if s := os.Getenv("KCC_GO_SESSION_MAX_SESSIONS"); s != "" {
+		if n, err := strconv.ParseInt(s, 10, 0); err == nil {
+			DefaultSessionManagerMaxSessions = int(n)
+		}
+	}
+	if s := os.Getenv("KCC_GO_SESSION_IDLE_TTL"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			DefaultSessionManagerIdleTTL = d
+		}
+	}
+	if s := os.Getenv("KCC_GO_SESSION_RELOGON_INTERVAL"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			DefaultSessionManagerRelogonInterval = d
+		}
+	}
+	if s := os.Getenv("KCC_GO_SESSION_RELOGON_JITTER"); s != "" {
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			DefaultSessionManagerRelogonJitter = n
+		}
+	}
+}
+
+// A SessionManager keeps a pool of per-user sessions, so repeated requests
+// of the same user reuse the session at the Kopano server. The number of
+// sessions is bounded: the least recently used session is evicted when the
+// maximum is reached and sessions which were idle for too long are evicted
+// in the background. Evicted sessions are logged off. A SessionManager is safe
+// for concurrent use.
+type SessionManager struct {
+	c   *KCC
+	ctx context.Context
+	key []byte
+
+	maxSessions int
+	idleTTL     time.Duration
+
+	mutex     sync.Mutex
+	entries   map[string]*list.Element
+	lru       *list.List
+	evictions uint64
+
+	relogon         *RateLimiter
+	relogonInterval time.Duration
+	relogonJitter   float64
+	relogonRunning  bool
+}
+
+type sessionManagerEntry struct {
+	username string
+	digest   []byte
+	session  *Session
+	used     time.Time
+
+	// password is kept to log on again when the session was lost, only if
+	// re-logon is enabled.
+	password string
+	relogon  bool
+}
+
+// NewSessionManager creates a new SessionManager logging on with the provided
+// KCC, keeping up to maxSessions sessions which are evicted after being idle
+// for idleTTL. A value of 0 selects DefaultSessionManagerMaxSessions or
+// DefaultSessionManagerIdleTTL, a negative idleTTL disables idle eviction.
+// Sessions are refreshed and idle sessions evicted until the provided context
+// is done, use Close to log off all sessions.
+func NewSessionManager(ctx context.Context, c *KCC, maxSessions int, idleTTL time.Duration) (*SessionManager, error) {
+	if c == nil {
+		c = NewKCC(nil)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if maxSessions == 0 {
+		maxSessions = DefaultSessionManagerMaxSessions
+	}
+	if maxSessions < 1 {
+		return nil, fmt.Errorf("session manager max sessions must be positive")
+	}
+	if idleTTL == 0 {
+		idleTTL = DefaultSessionManagerIdleTTL
+	}
+
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("session manager key generation failed: %v", err)
+	}
+
+	sm := &SessionManager{
+		c:   c,
+		ctx: ctx,
+		key: key,
+
+		maxSessions: maxSessions,
+		idleTTL:     idleTTL,
+
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	if idleTTL > 0 {
+		go sm.runExpiry()
+	}
+	if DefaultSessionManagerRelogonInterval > 0 {
+		sm.SetRelogon(DefaultSessionManagerRelogonInterval, DefaultSessionManagerRelogonJitter)
+	}
+
+	return sm, nil
+}
+
+// SetRelogon enables the coordinated re-logon of sessions which were lost,
+// for example because the Kopano server was restarted after a maintenance
+// window. Instead of all users logging on again at once when they return,
+// lost sessions are logged on again one at a time in the background, every
+// interval varied randomly by up to the jitter ratio. Logons of Get for users
+// whose session was lost are paced the same way. Lost sessions are kept until
+// they are idle or their credentials are rejected. To log on again, the
+// SessionManager keeps the credentials of the sessions it creates after the
+// call in memory. An interval of 0 disables re-logon.
+func (sm *SessionManager) SetRelogon(interval time.Duration, jitter float64) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.relogonInterval = interval
+	sm.relogonJitter = jitter
+	if interval <= 0 {
+		sm.relogon = nil
+		return
+	}
+	limit := float64(time.Second) / float64(interval)
+	if sm.relogon == nil {
+		sm.relogon = NewRateLimiter(limit, 1)
+	} else {
+		sm.relogon.SetLimit(limit, 1)
+	}
+	if !sm.relogonRunning {
+		sm.relogonRunning = true
+		go sm.runRelogon()
+	}
+}
+
+// Get returns the session of the provided user, logging on with the provided
+// credentials when there is no active session yet. Sessions are only reused
+// for the same credentials. The returned session can be evicted and logged
+// off at any time, so callers should call Get again when a request fails with
+// KCERR_END_OF_SESSION.
+func (sm *SessionManager) Get(ctx context.Context, username, password string) (*Session, error) {
+	digest := sm.digest(username, password)
+
+	sm.mutex.Lock()
+	if session := sm.lookup(username, digest, time.Now()); session != nil {
+		sm.mutex.Unlock()
+		return session, nil
+	}
+	lost := sm.lost(username, digest)
+	sm.mutex.Unlock()
+
+	if lost {
+		// Wait for the turn of this re-logon, the session might have been
+		// logged on again in the background meanwhile.
+		if err := sm.relogonWait(ctx); err != nil {
+			return nil, err
+		}
+		sm.mutex.Lock()
+		session := sm.lookup(username, digest, time.Now())
+		sm.mutex.Unlock()
+		if session != nil {
+			return session, nil
+		}
+	}
+
+	session, err := sm.logon(ctx, username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	var evicted []*Session
+	sm.mutex.Lock()
+	if existing := sm.lookup(username, digest, time.Now()); existing != nil {
+		// NOTE(longsleep): Another caller logged on the same user while we
+		// did, keep the first session to not log off one which is in use.
+		sm.mutex.Unlock()
+		session.Destroy(ctx, true)
+		return existing, nil
+	}
+	if elem, ok := sm.entries[username]; ok {
+		evicted = append(evicted, sm.remove(elem))
+	}
+	entry := &sessionManagerEntry{
+		username: username,
+		digest:   digest,
+		session:  session,
+		used:     time.Now(),
+	}
+	if sm.relogon != nil {
+		entry.password = password
+		entry.relogon = true
+	}
+	sm.entries[username] = sm.lru.PushFront(entry)
+	for sm.lru.Len() > sm.maxSessions {
+		evicted = append(evicted, sm.remove(sm.lru.Back()))
+		sm.evictions++
+	}
+	sm.mutex.Unlock()
+
+	sm.logoff(ctx, evicted)
+	return session, nil
+}
+
+// Remove logs off and removes the session of the provided user.
+func (sm *SessionManager) Remove(ctx context.Context, username string) error {
+	sm.mutex.Lock()
+	elem, ok := sm.entries[username]
+	if !ok {
+		sm.mutex.Unlock()
+		return nil
+	}
+	session := sm.remove(elem)
+	sm.mutex.Unlock()
+
+	return session.Destroy(ctx, true)
+}
+
+// ExpireIdle logs off and removes all sessions which were not used within the
+// idle TTL or which are no longer active, unless they are kept for re-logon.
+// It returns the number of removed sessions. Idle sessions are expired automatically, so calling it is only
+// needed to expire them right away.
+func (sm *SessionManager) ExpireIdle(ctx context.Context) int {
+	now := time.Now()
+
+	var evicted []*Session
+	sm.mutex.Lock()
+	for elem := sm.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		entry := elem.Value.(*sessionManagerEntry)
+		if sm.idle(entry, now) || (!entry.session.IsActive() && !entry.relogon) {
+			evicted = append(evicted, sm.remove(elem))
+			sm.evictions++
+		}
+		elem = prev
+	}
+	sm.mutex.Unlock()
+
+	sm.logoff(ctx, evicted)
+	return len(evicted)
+}
+
+// Close logs off and removes all sessions of the accociated SessionManager.
+// The first logoff error is returned.
+func (sm *SessionManager) Close(ctx context.Context) error {
+	var sessions []*Session
+	sm.mutex.Lock()
+	for elem := sm.lru.Front(); elem != nil; elem = sm.lru.Front() {
+		sessions = append(sessions, sm.remove(elem))
+	}
+	sm.mutex.Unlock()
+
+	var err error
+	for _, session := range sessions {
+		if destroyErr := session.Destroy(ctx, true); destroyErr != nil && err == nil {
+			err = destroyErr
+		}
+	}
+	return err
+}
+
+// Len returns the number of sessions of the accociated SessionManager.
+func (sm *SessionManager) Len() int {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	return sm.lru.Len()
+}
+
+// Evictions returns the number of sessions which were evicted from the
+// accociated SessionManager because they were idle, inactive or the least
+// recently used when the maximum number of sessions was reached.
+func (sm *SessionManager) Evictions() uint64 {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	return sm.evictions
+}
+
+func (sm *SessionManager) digest(username, password string) []byte {
+	mac := hmac.New(sha256.New, sm.key)
+	mac.Write([]byte(username))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+// lookup returns the reusable session of the provided user and marks it as
+// most recently used. Must be called with the lock held.
+func (sm *SessionManager) lookup(username string, digest []byte, now time.Time) *Session {
+	elem, ok := sm.entries[username]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*sessionManagerEntry)
+	if !hmac.Equal(entry.digest, digest) || sm.idle(entry, now) || !entry.session.IsActive() {
+		return nil
+	}
+	entry.used = now
+	sm.lru.MoveToFront(elem)
+
+	return entry.session
+}
+
+// remove removes the provided element and returns its session. Must be
+// called with the lock held.
+func (sm *SessionManager) remove(elem *list.Element) *Session {
+	entry := sm.lru.Remove(elem).(*sessionManagerEntry)
+	delete(sm.entries, entry.username)
+
+	return entry.session
+}
+
+func (sm *SessionManager) idle(entry *sessionManagerEntry, now time.Time) bool {
+	return sm.idleTTL > 0 && now.Sub(entry.used) > sm.idleTTL
+}
+
+func (sm *SessionManager) logon(ctx context.Context, username, password string) (*Session, error) {
+	resp, err := sm.c.Logon(ctx, username, password, 0)
+	if err != nil {
+		return nil, fmt.Errorf("session manager logon failed: %v", err)
+	}
+	if resp.Er != KCSuccess {
+		return nil, fmt.Errorf("session manager logon mapi error: %v", resp.Er)
+	}
+
+	return sm.createSession(resp)
+}
+
+// createSession creates and starts refreshing the session of the provided
+// successful logon response.
+func (sm *SessionManager) createSession(resp *LogonResponse) (*Session, error) {
+	// NOTE(longsleep): Sessions are bound to the context of the manager, not
+	// to the one of the request which happened to log on.
+	session, err := CreateSession(sm.ctx, sm.c, resp.SessionID, resp.ServerGUID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	err = session.StartAutoRefresh()
+	return session, err
+}
+
+// logoff logs off the provided evicted sessions. Errors are ignored, since
+// the server expires sessions which could not be logged off by itself.
+func (sm *SessionManager) logoff(ctx context.Context, sessions []*Session) {
+	for _, session := range sessions {
+		session.Destroy(ctx, true)
+	}
+}
+
+func (sm *SessionManager) runExpiry() {
+	interval := sm.idleTTL / 2
+	if interval <= 0 {
+		interval = sm.idleTTL
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sm.ctx.Done():
+			return
+		case <-ticker.C:
+			runSafely(func() {
+				sm.ExpireIdle(sm.ctx)
+			})
+		}
+	}
+}
+
+// lost returns true if the provided user has a session which was lost and is
+// kept for re-logon with the same credentials. Must be called with the lock
+// held.
+func (sm *SessionManager) lost(username string, digest []byte) bool {
+	if sm.relogon == nil {
+		return false
+	}
+	elem, ok := sm.entries[username]
+	if !ok {
+		return false
+	}
+	entry := elem.Value.(*sessionManagerEntry)
+
+	return entry.relogon && hmac.Equal(entry.digest, digest) && !entry.session.IsActive()
+}
+
+var errSessionRelogonDisabled = fmt.Errorf("session manager re-logon is disabled")
+
+// relogonWait blocks until the next re-logon is allowed or the provided
+// context is done. It returns errSessionRelogonDisabled if re-logon is
+// disabled.
+func (sm *SessionManager) relogonWait(ctx context.Context) error {
+	sm.mutex.Lock()
+	limiter := sm.relogon
+	delay := time.Duration(mathrand.Float64() * sm.relogonJitter * float64(sm.relogonInterval))
+	sm.mutex.Unlock()
+	if limiter == nil {
+		return errSessionRelogonDisabled
+	}
+
+	if err := limiter.Wait(ctx); err != nil {
+		return err
+	}
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// relogonNext logs on the most recently used lost session again. Sessions
+// whose credentials are rejected are removed, sessions which cannot be logged
+// on because the server is still unreachable are tried again later.
+func (sm *SessionManager) relogonNext(ctx context.Context) {
+	now := time.Now()
+
+	sm.mutex.Lock()
+	var entry *sessionManagerEntry
+	for elem := sm.lru.Front(); elem != nil; elem = elem.Next() {
+		candidate := elem.Value.(*sessionManagerEntry)
+		if candidate.relogon && !sm.idle(candidate, now) && !candidate.session.IsActive() {
+			entry = candidate
+			break
+		}
+	}
+	if entry == nil {
+		sm.mutex.Unlock()
+		return
+	}
+	username, password, lost := entry.username, entry.password, entry.session
+	sm.mutex.Unlock()
+
+	resp, err := sm.c.Logon(ctx, username, password, 0)
+	if err != nil {
+		// Server still unreachable, keep the session for the next turn.
+		return
+	}
+	var session *Session
+	if resp.Er == KCSuccess {
+		session, err = sm.createSession(resp)
+	}
+
+	sm.mutex.Lock()
+	elem, ok := sm.entries[username]
+	if !ok || elem.Value.(*sessionManagerEntry).session != lost {
+		// Removed or replaced meanwhile.
+		sm.mutex.Unlock()
+		if session != nil {
+			session.Destroy(ctx, true)
+		}
+		return
+	}
+	if session == nil || err != nil {
+		sm.remove(elem)
+		sm.evictions++
+	} else {
+		elem.Value.(*sessionManagerEntry).session = session
+	}
+	sm.mutex.Unlock()
+
+	// Stop the lost session, it cannot be logged off anymore.
+	lost.Destroy(ctx, false)
+}
+
+func (sm *SessionManager) runRelogon() {
+	for {
+		err := sm.relogonWait(sm.ctx)
+		if err != nil {
+			sm.mutex.Lock()
+			if sm.relogon != nil && sm.ctx.Err() == nil {
+				// Enabled again meanwhile.
+				sm.mutex.Unlock()
+				continue
+			}
+			sm.relogonRunning = false
+			sm.mutex.Unlock()
+			return
+		}
+		runSafely(func() {
+			sm.relogonNext(sm.ctx)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSessionManager(t *testing.T) {
+	var mutex sync.Mutex
+	var logons, logoffs int
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case strings.Contains(string(body), "<ns:logon>"):
+			logons++
+			rw.Write([]byte(soapHeader + "<ns:logonResponse><er>0</er><ulSessionId>" + strconv.Itoa(logons) + "</ulSessionId><sServerGuid>guid</sServerGuid></ns:logonResponse>" + soapFooter))
+		case strings.Contains(string(body), "<ns:logoff>"):
+			logoffs++
+			rw.Write([]byte(soapHeader + "<ns:logoffResponse><er>0</er></ns:logoffResponse>" + soapFooter))
+		default:
+			rw.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sm, err := NewSessionManager(ctx, NewKCCWithClient(client), 2, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user1, err := sm.Get(ctx, "user1", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := sm.Get(ctx, "user1", "pass"); again != user1 {
+		t.Errorf("session was not reused")
+	}
+	if other, _ := sm.Get(ctx, "user1", "wrong"); other == user1 {
+		t.Errorf("session was reused with other credentials")
+	}
+	user1, _ = sm.Get(ctx, "user1", "wrong")
+	sm.Get(ctx, "user2", "pass")
+	sm.Get(ctx, "user1", "wrong")
+	sm.Get(ctx, "user3", "pass")
+
+	// user2 was the least recently used.
+	if sm.Len() != 2 || sm.Evictions() != 1 {
+		t.Errorf("unexpected sessions %d and evictions %d", sm.Len(), sm.Evictions())
+	}
+	if !user1.IsActive() {
+		t.Errorf("recently used session was evicted")
+	}
+	mutex.Lock()
+	if logons != 4 || logoffs != 2 {
+		t.Errorf("unexpected logons %d and logoffs %d", logons, logoffs)
+	}
+	mutex.Unlock()
+
+	sm.idleTTL = time.Nanosecond
+	time.Sleep(time.Millisecond)
+	if n := sm.ExpireIdle(ctx); n != 2 {
+		t.Errorf("unexpected number of expired sessions: %d", n)
+	}
+	if sm.Len() != 0 || user1.IsActive() {
+		t.Errorf("idle sessions were not evicted")
+	}
+	mutex.Lock()
+	if logoffs != 4 {
+		t.Errorf("evicted sessions were not logged off: %d", logoffs)
+	}
+	mutex.Unlock()
+}
+
+func TestSessionManagerRelogon(t *testing.T) {
+	var mutex sync.Mutex
+	var logons int
+	var down bool
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case down:
+			rw.WriteHeader(http.StatusBadGateway)
+		case strings.Contains(string(body), "<ns:logon>"):
+			logons++
+			rw.Write([]byte(soapHeader + "<ns:logonResponse><er>0</er><ulSessionId>" + strconv.Itoa(logons) + "</ulSessionId><sServerGuid>guid</sServerGuid></ns:logonResponse>" + soapFooter))
+		default:
+			rw.Write([]byte(soapHeader + "<ns:logoffResponse><er>0</er></ns:logoffResponse>" + soapFooter))
+		}
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sm, err := NewSessionManager(ctx, NewKCCWithClient(client), 10, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.SetRelogon(5*time.Millisecond, 0)
+
+	var lost []*Session
+	for _, username := range []string{"user1", "user2"} {
+		session, getErr := sm.Get(ctx, username, "pass")
+		if getErr != nil {
+			t.Fatal(getErr)
+		}
+		lost = append(lost, session)
+	}
+
+	// Backend goes down, sessions are lost but kept for re-logon.
+	mutex.Lock()
+	down = true
+	mutex.Unlock()
+	for _, session := range lost {
+		session.Destroy(ctx, false)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := sm.ExpireIdle(ctx); n != 0 || sm.Len() != 2 {
+		t.Fatalf("lost sessions were not kept: %d expired, %d left", n, sm.Len())
+	}
+
+	// Backend returns, sessions are logged on again one by one.
+	mutex.Lock()
+	down = false
+	mutex.Unlock()
+	for i := 0; i < 100; i++ {
+		mutex.Lock()
+		done := logons == 4
+		mutex.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	session, err := sm.Get(ctx, "user1", "pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session == lost[0] || !session.IsActive() {
+		t.Errorf("lost session was not logged on again")
+	}
+	mutex.Lock()
+	if logons != 4 {
+		t.Errorf("unexpected logons: %d", logons)
+	}
+	mutex.Unlock()
+}
@@ -0,0 +1,239 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultSLOObjective is the share of backend requests which must succeed
+	// within the latency target.
+	DefaultSLOObjective = 0.999
+	// DefaultSLOLatencyTarget is the duration above which backend requests
+	// count against the error budget.
+	DefaultSLOLatencyTarget = 500 * time.Millisecond
+	// DefaultSLOWindow is the rolling window backend requests are tracked in.
+	DefaultSLOWindow = 5 * time.Minute
+
+	// DefaultSLOTracker tracks all backend requests of this process. Replace
+	// it before sending requests to use other objectives.
+	DefaultSLOTracker *SLOTracker
+)
+
+func init() {
+	if s := os.Getenv("KCC_GO_SLO_OBJECTIVE"); s != "" {
+		if n, err := strconv.ParseFloat(s, 64); err == nil {
+			DefaultSLOObjective = n
+		}
+	}
+	if s := os.Getenv("KCC_GO_SLO_LATENCY_TARGET"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			DefaultSLOLatencyTarget = d
+		}
+	}
+	if s := os.Getenv("KCC_GO_SLO_WINDOW"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			DefaultSLOWindow = d
+		}
+	}
+
+	DefaultSLOTracker = NewSLOTracker(DefaultSLOObjective, DefaultSLOLatencyTarget, DefaultSLOWindow)
+}
+
+// sloSlots is the number of slots the rolling window is split into.
+const sloSlots = 30
+
+// sloLatencyBounds are the upper bounds of the latency histogram buckets,
+// percentiles are reported as the bound of the bucket they fall into.
+var sloLatencyBounds = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+type sloSlot struct {
+	epoch     int64
+	requests  uint64
+	errors    uint64
+	slow      uint64
+	latencies []uint64
+}
+
+// An SLOTracker tracks the success rate and latency of backend requests in a
+// rolling window, to report how much of the error budget of the objective is
+// left. Requests count as good if they succeed within the latency target. An
+// SLOTracker is safe for concurrent use.
+type SLOTracker struct {
+	objective     float64
+	latencyTarget time.Duration
+	window        time.Duration
+	slot          time.Duration
+
+	mutex sync.Mutex
+	slots [sloSlots]sloSlot
+}
+
+// NewSLOTracker creates a new SLOTracker for the provided objective, latency
+// target and rolling window.
+func NewSLOTracker(objective float64, latencyTarget, window time.Duration) *SLOTracker {
+	slot := window / sloSlots
+	if slot <= 0 {
+		slot = time.Millisecond
+	}
+
+	t := &SLOTracker{
+		objective:     objective,
+		latencyTarget: latencyTarget,
+		window:        slot * sloSlots,
+		slot:          slot,
+	}
+	for idx := range t.slots {
+		t.slots[idx].latencies = make([]uint64, len(sloLatencyBounds)+1)
+	}
+
+	return t
+}
+
+// Observe records a backend request which took the provided duration and
+// failed with the provided error, if not nil.
+func (t *SLOTracker) Observe(duration time.Duration, err error) {
+	bucket := len(sloLatencyBounds)
+	for idx, bound := range sloLatencyBounds {
+		if duration <= bound {
+			bucket = idx
+			break
+		}
+	}
+
+	epoch := time.Now().UnixNano() / int64(t.slot)
+
+	t.mutex.Lock()
+	slot := &t.slots[epoch%sloSlots]
+	if slot.epoch != epoch {
+		slot.epoch = epoch
+		slot.requests, slot.errors, slot.slow = 0, 0, 0
+		for idx := range slot.latencies {
+			slot.latencies[idx] = 0
+		}
+	}
+	slot.requests++
+	if err != nil {
+		slot.errors++
+	} else if duration > t.latencyTarget {
+		slot.slow++
+	}
+	slot.latencies[bucket]++
+	t.mutex.Unlock()
+}
+
+// An SLOReport holds the state of the backend requests of the rolling window
+// of an SLOTracker. BurnRate is the rate the error budget is spent at, a rate
+// above 1 exhausts the budget before the end of the window.
+type SLOReport struct {
+	Objective            float64 `json:"objective"`
+	LatencyTarget        float64 `json:"latencyTargetSeconds"`
+	Window               float64 `json:"windowSeconds"`
+	Requests             uint64  `json:"requests"`
+	Errors               uint64  `json:"errors"`
+	Slow                 uint64  `json:"slow"`
+	SuccessRate          float64 `json:"successRate"`
+	LatencyP50           float64 `json:"latencyP50Seconds"`
+	LatencyP90           float64 `json:"latencyP90Seconds"`
+	LatencyP99           float64 `json:"latencyP99Seconds"`
+	BurnRate             float64 `json:"burnRate"`
+	ErrorBudgetRemaining float64 `json:"errorBudgetRemaining"`
+}
+
+// Report returns the SLOReport of the current rolling window.
+func (t *SLOTracker) Report() *SLOReport {
+	report := &SLOReport{
+		Objective:     t.objective,
+		LatencyTarget: t.latencyTarget.Seconds(),
+		Window:        t.window.Seconds(),
+		SuccessRate:   1,
+	}
+	latencies := make([]uint64, len(sloLatencyBounds)+1)
+
+	epoch := time.Now().UnixNano() / int64(t.slot)
+
+	t.mutex.Lock()
+	for idx := range t.slots {
+		slot := &t.slots[idx]
+		if slot.epoch <= epoch-sloSlots {
+			continue
+		}
+		report.Requests += slot.requests
+		report.Errors += slot.errors
+		report.Slow += slot.slow
+		for bucket, count := range slot.latencies {
+			latencies[bucket] += count
+		}
+	}
+	t.mutex.Unlock()
+
+	if report.Requests > 0 {
+		report.SuccessRate = float64(report.Requests-report.Errors-report.Slow) / float64(report.Requests)
+		report.LatencyP50 = sloPercentile(latencies, report.Requests, 0.5)
+		report.LatencyP90 = sloPercentile(latencies, report.Requests, 0.9)
+		report.LatencyP99 = sloPercentile(latencies, report.Requests, 0.99)
+	}
+	if budget := 1 - t.objective; budget > 0 {
+		report.BurnRate = (1 - report.SuccessRate) / budget
+	}
+	if report.BurnRate < 1 {
+		report.ErrorBudgetRemaining = 1 - report.BurnRate
+	}
+
+	return report
+}
+
+// sloPercentile returns the upper bound in seconds of the histogram bucket
+// the provided percentile falls into, or the largest bound if it is above.
+func sloPercentile(latencies []uint64, total uint64, percentile float64) float64 {
+	rank := uint64(percentile*float64(total) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+
+	var count uint64
+	for bucket, n := range latencies {
+		count += n
+		if count >= rank {
+			if bucket < len(sloLatencyBounds) {
+				return sloLatencyBounds[bucket].Seconds()
+			}
+			break
+		}
+	}
+	return sloLatencyBounds[len(sloLatencyBounds)-1].Seconds()
+}
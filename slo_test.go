@@ -0,0 +1,63 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSLOTracker(t *testing.T) {
+	tracker := NewSLOTracker(0.8, 100*time.Millisecond, time.Minute)
+	if report := tracker.Report(); report.Requests != 0 || report.SuccessRate != 1 || report.ErrorBudgetRemaining != 1 {
+		t.Errorf("unexpected empty report: %+v", report)
+	}
+
+	for i := 0; i < 90; i++ {
+		tracker.Observe(3*time.Millisecond, nil)
+	}
+	for i := 0; i < 5; i++ {
+		tracker.Observe(150*time.Millisecond, nil)
+		tracker.Observe(time.Millisecond, errors.New("connection refused"))
+	}
+
+	report := tracker.Report()
+	if report.Requests != 100 || report.Errors != 5 || report.Slow != 5 {
+		t.Fatalf("unexpected counts: %+v", report)
+	}
+	if math.Abs(report.SuccessRate-0.9) > 1e-9 || math.Abs(report.BurnRate-0.5) > 1e-9 || math.Abs(report.ErrorBudgetRemaining-0.5) > 1e-9 {
+		t.Errorf("unexpected budget: %+v", report)
+	}
+	if report.LatencyP50 != 0.005 || report.LatencyP99 != 0.2 {
+		t.Errorf("unexpected latency percentiles: %+v", report)
+	}
+}
+
+func TestSLOTrackerWindow(t *testing.T) {
+	tracker := NewSLOTracker(0.99, time.Second, 30*time.Millisecond)
+	tracker.Observe(time.Millisecond, errors.New("connection refused"))
+	if report := tracker.Report(); report.Errors != 1 || report.ErrorBudgetRemaining != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if report := tracker.Report(); report.Requests != 0 {
+		t.Errorf("requests outside of the window were reported: %+v", report)
+	}
+}
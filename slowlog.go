@@ -0,0 +1,157 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultSlowCallThreshold is the duration above which SOAP calls of new KCC
+// instances are logged as slow. A threshold of 0 disables the slow call log.
+var DefaultSlowCallThreshold time.Duration
+
+func init() {
+	if s := os.Getenv("KCC_GO_SLOW_CALL_THRESHOLD"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			DefaultSlowCallThreshold = d
+		}
+	}
+}
+
+// slowCallUserElements are the payload elements identifying the target user
+// of a SOAP call.
+var slowCallUserElements = []string{"szUsername", "lpszUsername", "szUserName", "sUserId"}
+
+// A SlowCall describes a SOAP call which took longer than the slow call
+// threshold. The target user is only given as hash, so slow call logs do not
+// leak user names.
+type SlowCall struct {
+	Action         string
+	Duration       time.Duration
+	PayloadSize    int
+	TargetUserHash string
+	Err            error
+}
+
+func (sc *SlowCall) String() string {
+	return fmt.Sprintf("action=%s duration=%v payloadSize=%d targetUserHash=%s err=%v", sc.Action, sc.Duration, sc.PayloadSize, sc.TargetUserHash, sc.Err)
+}
+
+// DefaultSlowCallHandler logs the provided SlowCall with the standard logger.
+func DefaultSlowCallHandler(call *SlowCall) {
+	log.Printf("kcc slow SOAP call: %s\n", call)
+}
+
+// A SlowCallSOAPClient wraps a SOAPClient, reporting calls exceeding Threshold
+// to Handler.
+type SlowCallSOAPClient struct {
+	Client    SOAPClient
+	Threshold time.Duration
+	Handler   func(*SlowCall)
+}
+
+// NewSlowCallSOAPClient creates a new SlowCallSOAPClient for the provided
+// client, reporting calls taking longer than the provided threshold to the
+// provided handler. If handler is nil, DefaultSlowCallHandler is used.
+func NewSlowCallSOAPClient(client SOAPClient, threshold time.Duration, handler func(*SlowCall)) *SlowCallSOAPClient {
+	if handler == nil {
+		handler = DefaultSlowCallHandler
+	}
+
+	return &SlowCallSOAPClient{
+		Client:    client,
+		Threshold: threshold,
+		Handler:   handler,
+	}
+}
+
+// DoRequest sends the provided payload data as SOAP through the means of the
+// accociated client and reports the call if it was slow.
+func (sc *SlowCallSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	started := time.Now()
+	err := sc.Client.DoRequest(ctx, payload, v)
+	duration := time.Since(started)
+
+	if sc.Threshold > 0 && duration > sc.Threshold {
+		callErr := err
+		if callErr == nil {
+			callErr = responseKCError(v)
+		}
+		call := &SlowCall{
+			Action:         soapAction(*payload),
+			Duration:       duration,
+			PayloadSize:    len(*payload),
+			TargetUserHash: soapTargetUserHash(*payload),
+			Err:            callErr,
+		}
+		runSafely(func() {
+			sc.Handler(call)
+		})
+	}
+
+	return err
+}
+
+func (sc *SlowCallSOAPClient) String() string {
+	return fmt.Sprintf("%s", sc.Client)
+}
+
+// SOAPAction returns the name of the SOAP action of the provided payload as
+// passed to SOAPClient.DoRequest, for example "logon", or an empty string if
+// the payload is no SOAP request.
+func SOAPAction(payload string) string {
+	return soapAction(payload)
+}
+
+// soapAction returns the name of the SOAP action of the provided payload.
+func soapAction(payload string) string {
+	if !strings.HasPrefix(payload, "<ns:") {
+		return ""
+	}
+	action := payload[4:]
+	if end := strings.IndexAny(action, " />"); end >= 0 {
+		action = action[:end]
+	}
+
+	return action
+}
+
+// soapTargetUserHash returns a short hash of the first user identifying
+// element value of the provided payload, or an empty string if there is none.
+func soapTargetUserHash(payload string) string {
+	for _, element := range slowCallUserElements {
+		start := strings.Index(payload, "<"+element+">")
+		if start < 0 {
+			continue
+		}
+		value := payload[start+len(element)+2:]
+		if end := strings.Index(value, "</"+element+">"); end >= 0 {
+			value = value[:end]
+		}
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:8])
+	}
+
+	return ""
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSlowCallLog(t *testing.T) {
+	client := &cannedSOAPClient{
+		response: "<ns:resolveUserResponse><er>" + strconv.FormatUint(uint64(KCERR_NOT_FOUND), 10) + "</er></ns:resolveUserResponse>",
+	}
+	c := NewKCCWithClient(client)
+
+	var calls []*SlowCall
+	c.SetSlowCallLog(time.Nanosecond, func(call *SlowCall) {
+		calls = append(calls, call)
+	})
+
+	resp, err := c.ResolveUsername(context.Background(), "user1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Er != KCERR_NOT_FOUND {
+		t.Errorf("unexpected response error: %v", resp.Er)
+	}
+
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 slow call, got %d", len(calls))
+	}
+	call := calls[0]
+	if call.Action != "resolveUsername" {
+		t.Errorf("unexpected action: %v", call.Action)
+	}
+	if call.PayloadSize != len(client.payloads[0]) {
+		t.Errorf("unexpected payload size: %v", call.PayloadSize)
+	}
+	if call.TargetUserHash == "" || call.TargetUserHash != soapTargetUserHash("<szUsername>user1</szUsername>") {
+		t.Errorf("unexpected target user hash: %v", call.TargetUserHash)
+	}
+	if call.Err != KCERR_NOT_FOUND {
+		t.Errorf("unexpected error: %v", call.Err)
+	}
+
+	// Fast calls are not reported.
+	c.SetSlowCallLog(time.Hour, func(call *SlowCall) {
+		calls = append(calls, call)
+	})
+	c.ResolveUsername(context.Background(), "user1", 1)
+	if len(calls) != 1 {
+		t.Errorf("expected no further slow calls, got %d", len(calls)-1)
+	}
+}
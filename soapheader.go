@@ -0,0 +1,90 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+)
+
+// A SOAPHeader is a header block sent in the SOAP-ENV:Header element of
+// requests, like a WS-Security token or a custom routing header. It is a well
+// formed XML element which declares the namespaces it uses, other than the
+// namespaces of the SOAP envelope.
+type SOAPHeader string
+
+// MarshalSOAPHeader returns the XML encoding of the provided value as
+// SOAPHeader, see encoding/xml for how it is encoded.
+func MarshalSOAPHeader(v interface{}) (SOAPHeader, error) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	return SOAPHeader(data), nil
+}
+
+// WSSecurityUsernameToken returns a WS-Security header with a UsernameToken
+// holding the provided username and password as plain text.
+func WSSecurityUsernameToken(username, password string) SOAPHeader {
+	var b bytes.Buffer
+	b.WriteString(`<wsse:Security xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"><wsse:UsernameToken><wsse:Username>`)
+	xml.EscapeText(&b, []byte(username))
+	b.WriteString(`</wsse:Username><wsse:Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordText">`)
+	xml.EscapeText(&b, []byte(password))
+	b.WriteString(`</wsse:Password></wsse:UsernameToken></wsse:Security>`)
+
+	return SOAPHeader(b.String())
+}
+
+type soapHeadersKey struct{}
+
+// WithSOAPHeaders returns a copy of the provided context with the provided
+// SOAP headers added to the SOAP headers of the context. Requests using the
+// returned context send them after the Headers of the client.
+func WithSOAPHeaders(ctx context.Context, headers ...SOAPHeader) context.Context {
+	if existing := SOAPHeadersFromContext(ctx); len(existing) > 0 {
+		headers = append(append([]SOAPHeader(nil), existing...), headers...)
+	}
+
+	return context.WithValue(ctx, soapHeadersKey{}, headers)
+}
+
+// SOAPHeadersFromContext returns the SOAP headers of the provided context,
+// added with WithSOAPHeaders.
+func SOAPHeadersFromContext(ctx context.Context) []SOAPHeader {
+	if ctx == nil {
+		return nil
+	}
+	headers, _ := ctx.Value(soapHeadersKey{}).([]SOAPHeader)
+
+	return headers
+}
+
+// soapHeaders returns the provided client headers followed by the SOAP
+// headers of the provided context.
+func soapHeaders(ctx context.Context, headers []SOAPHeader) []SOAPHeader {
+	if requestHeaders := SOAPHeadersFromContext(ctx); len(requestHeaders) > 0 {
+		if len(headers) == 0 {
+			return requestHeaders
+		}
+		return append(append([]SOAPHeader(nil), headers...), requestHeaders...)
+	}
+
+	return headers
+}
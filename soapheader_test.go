@@ -0,0 +1,90 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSOAPHeaders(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		data, _ := ioutil.ReadAll(req.Body)
+		body = string(data)
+		rw.Write([]byte(soapHeader + "<ns:logoffResponse><er>0</er></ns:logoffResponse>" + soapFooter))
+	}))
+	defer srv.Close()
+
+	type route struct {
+		XMLName xml.Name `xml:"urn:example route"`
+		Target  string   `xml:"target"`
+	}
+	routeHeader, err := MarshalSOAPHeader(&route{Target: "node<1>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		HTTPClient: srv.Client(),
+		Headers:    []SOAPHeader{WSSecurityUsernameToken("user1", "pass&word")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewKCCWithClient(client)
+
+	ctx := WithSOAPHeaders(context.Background(), routeHeader)
+	if _, err = c.Logoff(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	header := body[strings.Index(body, "<SOAP-ENV:Header>"):strings.Index(body, "<SOAP-ENV:Body")]
+	for _, part := range []string{
+		"<wsse:Username>user1</wsse:Username>",
+		"PasswordText\">pass&amp;word</wsse:Password>",
+		"<route xmlns=\"urn:example\"><target>node&lt;1&gt;</target></route></SOAP-ENV:Header>",
+	} {
+		if !strings.Contains(header, part) {
+			t.Errorf("expected %s in header: %s", part, header)
+		}
+	}
+
+	// The envelope must stay well formed.
+	var envelope struct {
+		Header struct {
+			Inner string `xml:",innerxml"`
+		} `xml:"Header"`
+	}
+	if err = xml.Unmarshal([]byte(body), &envelope); err != nil || envelope.Header.Inner == "" {
+		t.Errorf("invalid envelope: %v", err)
+	}
+
+	// Without headers, no header element is sent.
+	if _, err = NewKCCWithClient(&SOAPHTTPClient{Client: srv.Client(), URI: srv.URL}).Logoff(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(body, "SOAP-ENV:Header") {
+		t.Errorf("unexpected header element: %s", body)
+	}
+}
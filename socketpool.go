@@ -0,0 +1,531 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Default socket pool settings.
+var (
+	// DefaultUnixMinConnections is the default number of connections which
+	// are opened in advance when a SOAP socket client is created.
+	DefaultUnixMinConnections = 0
+	// DefaultUnixOverflowConnections is the default number of connections
+	// which are opened in addition to DefaultUnixMaxConnections during
+	// bursts.
+	DefaultUnixOverflowConnections = 0
+	// DefaultUnixOverflowIdleTimeout is the default duration after which idle
+	// overflow connections are closed, shrinking the pool back to
+	// DefaultUnixMaxConnections.
+	DefaultUnixOverflowIdleTimeout = 30 * time.Second
+	// DefaultUnixIdleTimeout is the default duration after which idle
+	// connections above DefaultUnixMinConnections are closed. A timeout of 0
+	// keeps them open.
+	DefaultUnixIdleTimeout = 5 * time.Minute
+	// DefaultUnixHealthCheck is the default function idle connections are
+	// checked with before they are used again. If nil, connections are not
+	// checked.
+	DefaultUnixHealthCheck = CheckConnAlive
+	// DefaultUnixPingInterval is the default interval in which all idle
+	// connections are checked with the health check in the background. An
+	// interval of 0 disables the background checks. The checks run until the
+	// pool is closed, so only enable them for long lived clients.
+	DefaultUnixPingInterval time.Duration
+	// DefaultUnixPipelineDepth is the default maximum number of requests
+	// which are sent over a connection before their responses are read. A
+	// depth of 1 disables pipelining.
+	DefaultUnixPipelineDepth = 1
+)
+
+var (
+	errSocketPoolClosed  = errors.New("socket pool is closed")
+	errSocketPoolTimeout = errors.New("timeout waiting for a socket pool connection")
+)
+
+// A ConnPool is a pool of network connections. Closing a connection of the
+// pool returns it to the pool, Remove closes it.
+type ConnPool interface {
+	Get() (net.Conn, error)
+	GetWithTimeout(timeout time.Duration) (net.Conn, error)
+	Close() error
+	Remove(conn net.Conn) error
+}
+
+// A SocketPoolConfig defines the connection pool of SOAP socket clients. The
+// pool keeps up to MaxConnections connections open. During bursts, up to
+// OverflowConnections additional connections are opened, which are closed
+// again after being idle for OverflowIdleTimeout. Connections above
+// MinConnections are closed after being idle for IdleTimeout. Idle
+// connections are checked with HealthCheck, if not nil, before they are used
+// again, so stale connections are not used for requests. In addition, all
+// idle connections are checked every PingInterval, if not 0, so connections
+// closed by the server, for example when it restarts, are closed and replaced
+// up to MinConnections before requests need them. HealthCheck is called while
+// the pool is locked during these checks and must not block. If PipelineDepth
+// is larger than 1, up to PipelineDepth requests are pipelined over each
+// connection, new connections are only opened when all connections in use
+// have that many requests in flight.
+type SocketPoolConfig struct {
+	MinConnections      int
+	MaxConnections      int
+	OverflowConnections int
+	OverflowIdleTimeout time.Duration
+	IdleTimeout         time.Duration
+	HealthCheck         func(net.Conn) error
+	PingInterval        time.Duration
+	PipelineDepth       int
+}
+
+// NewSocketPoolConfig creates a new SocketPoolConfig with default settings.
+func NewSocketPoolConfig() *SocketPoolConfig {
+	return &SocketPoolConfig{
+		MinConnections:      DefaultUnixMinConnections,
+		MaxConnections:      DefaultUnixMaxConnections,
+		OverflowConnections: DefaultUnixOverflowConnections,
+		OverflowIdleTimeout: DefaultUnixOverflowIdleTimeout,
+		IdleTimeout:         DefaultUnixIdleTimeout,
+		HealthCheck:         DefaultUnixHealthCheck,
+		PingInterval:        DefaultUnixPingInterval,
+		PipelineDepth:       DefaultUnixPipelineDepth,
+	}
+}
+
+// pipelineDepth returns the number of requests in flight per connection of
+// the accociated config, at least 1.
+func (config *SocketPoolConfig) pipelineDepth() int {
+	if config.PipelineDepth < 1 {
+		return 1
+	}
+	return config.PipelineDepth
+}
+
+// CheckConnAlive returns an error if the provided connection was closed by
+// its peer or has unexpected data to read, without blocking. On platforms
+// where this can not be checked, it always returns nil.
+func CheckConnAlive(conn net.Conn) error {
+	return connAlive(conn)
+}
+
+// A socketPool is a ConnPool which can temporarily grow beyond its size
+// during bursts. Requests waiting for a connection are served strictly in
+// FIFO order, returned connections and freed slots are handed over to them
+// directly, so new requests can not overtake them.
+type socketPool struct {
+	dial            func() (net.Conn, error)
+	observe         func(SocketPoolStats)
+	healthCheck     func(net.Conn) error
+	min             int
+	size            int
+	overflow        int
+	overflowTimeout time.Duration
+	idleTimeout     time.Duration
+	pingInterval    time.Duration
+
+	mutex   sync.Mutex
+	idle    []*socketPoolConn
+	open    int
+	waiting []chan *socketPoolConn
+	evict   *time.Timer
+	evictAt time.Time
+	pinger  *time.Timer
+	closed  bool
+}
+
+// A socketPoolConn is a connection of a socketPool. Closing it returns it to
+// its pool.
+type socketPoolConn struct {
+	net.Conn
+	pool      *socketPool
+	idleSince time.Time
+}
+
+func (c *socketPoolConn) Close() error {
+	return c.pool.put(c)
+}
+
+// newSocketPool creates a new socketPool with the provided settings, which
+// opens connections with the provided dial function. Connections up to the
+// minimum are opened in advance in the background. If not nil, the provided
+// observe function is called with the utilization of the pool whenever it
+// changes, while the pool is locked.
+func newSocketPool(config *SocketPoolConfig, dial func() (net.Conn, error), observe func(SocketPoolStats)) (*socketPool, error) {
+	if config.MaxConnections <= 0 {
+		return nil, fmt.Errorf("invalid socket pool max connections: %d", config.MaxConnections)
+	}
+	if config.MinConnections > config.MaxConnections || config.OverflowConnections < 0 {
+		return nil, fmt.Errorf("invalid socket pool settings: min %d, max %d, overflow %d", config.MinConnections, config.MaxConnections, config.OverflowConnections)
+	}
+
+	p := &socketPool{
+		dial:            dial,
+		observe:         observe,
+		healthCheck:     config.HealthCheck,
+		min:             config.MinConnections,
+		size:            config.MaxConnections,
+		overflow:        config.OverflowConnections,
+		overflowTimeout: config.OverflowIdleTimeout,
+		idleTimeout:     config.IdleTimeout,
+	}
+	if config.HealthCheck != nil && config.PingInterval > 0 {
+		p.pingInterval = config.PingInterval
+		p.pinger = time.AfterFunc(p.pingInterval, p.ping)
+	}
+
+	if config.MinConnections > 0 {
+		go p.fill()
+	}
+
+	return p, nil
+}
+
+// fill opens connections until the pool has at least its minimum number of
+// connections open and returns them to the pool.
+func (p *socketPool) fill() {
+	for {
+		p.mutex.Lock()
+		if p.closed || p.open >= p.min {
+			p.mutex.Unlock()
+			return
+		}
+		p.open++
+		p.observeLocked()
+		p.mutex.Unlock()
+
+		c, err := p.connect()
+		if err != nil {
+			// NOTE(longsleep): Failures are ignored, connections are opened
+			// on demand then.
+			return
+		}
+		c.Close()
+	}
+}
+
+// Get returns a connection of the pool, waiting for one without timeout.
+func (p *socketPool) Get() (net.Conn, error) {
+	return p.GetWithTimeout(0)
+}
+
+// GetWithTimeout returns an idle connection of the pool or opens a new one,
+// if the pool with its overflow is not exhausted. Otherwise it waits up to
+// the provided timeout for a connection. A timeout of 0 waits forever. Idle
+// connections which fail the health check are closed and replaced.
+func (p *socketPool) GetWithTimeout(timeout time.Duration) (net.Conn, error) {
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return nil, errSocketPoolClosed
+	}
+	if n := len(p.idle); n > 0 {
+		// Use the most recently used connection, so the others age out.
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.observeLocked()
+		p.mutex.Unlock()
+		if p.healthCheck != nil {
+			if err := p.healthCheck(c.Conn); err != nil {
+				if debug {
+					fmt.Printf("socket pool connection failed health check: %v\n", err)
+				}
+				// The slot of the stale connection is used for its
+				// replacement.
+				c.Conn.Close()
+				return p.connect()
+			}
+		}
+		return c, nil
+	}
+	if p.open < p.size+p.overflow {
+		p.open++
+		p.observeLocked()
+		p.mutex.Unlock()
+		return p.connect()
+	}
+
+	ready := make(chan *socketPoolConn, 1)
+	p.waiting = append(p.waiting, ready)
+	p.observeLocked()
+	p.mutex.Unlock()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case c, ok := <-ready:
+		return p.granted(c, ok)
+	case <-expired:
+		p.mutex.Lock()
+		for idx, w := range p.waiting {
+			if w == ready {
+				p.waiting = append(p.waiting[:idx], p.waiting[idx+1:]...)
+				p.observeLocked()
+				p.mutex.Unlock()
+				return nil, errSocketPoolTimeout
+			}
+		}
+		p.mutex.Unlock()
+		// Was granted meanwhile, use it.
+		c, ok := <-ready
+		return p.granted(c, ok)
+	}
+}
+
+// granted returns the connection handed over to a waiting request. A nil
+// connection grants the slot of a removed connection, for which a new
+// connection is opened.
+func (p *socketPool) granted(c *socketPoolConn, ok bool) (net.Conn, error) {
+	if !ok {
+		return nil, errSocketPoolClosed
+	}
+	if c != nil {
+		return c, nil
+	}
+
+	return p.connect()
+}
+
+// connect opens a new connection for a slot which was counted as open
+// already. If that fails, the slot is released.
+func (p *socketPool) connect() (net.Conn, error) {
+	conn, err := p.dial()
+	if err != nil {
+		p.mutex.Lock()
+		p.releaseLocked()
+		p.mutex.Unlock()
+		return nil, err
+	}
+
+	return &socketPoolConn{
+		Conn: conn,
+		pool: p,
+	}, nil
+}
+
+// put returns the provided connection to the pool, handing it over to the
+// longest waiting request if any.
+func (p *socketPool) put(c *socketPoolConn) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		p.open--
+		p.observeLocked()
+		return c.Conn.Close()
+	}
+	if len(p.waiting) > 0 {
+		ready := p.waiting[0]
+		p.waiting = p.waiting[1:]
+		p.observeLocked()
+		ready <- c
+		return nil
+	}
+
+	c.idleSince = time.Now()
+	p.idle = append(p.idle, c)
+	p.scheduleEvictLocked()
+	p.observeLocked()
+
+	return nil
+}
+
+// Remove closes the provided connection of the pool instead of returning it,
+// for example after an error.
+func (p *socketPool) Remove(conn net.Conn) error {
+	c, ok := conn.(*socketPoolConn)
+	if !ok || c.pool != p {
+		return fmt.Errorf("connection does not belong to this socket pool")
+	}
+
+	p.mutex.Lock()
+	p.releaseLocked()
+	p.mutex.Unlock()
+
+	return c.Conn.Close()
+}
+
+// releaseLocked releases the slot of a closed connection, handing it over to
+// the longest waiting request if any.
+func (p *socketPool) releaseLocked() {
+	if !p.closed && len(p.waiting) > 0 {
+		ready := p.waiting[0]
+		p.waiting = p.waiting[1:]
+		p.observeLocked()
+		ready <- nil
+		return
+	}
+	p.open--
+	p.observeLocked()
+}
+
+// evictAfterLocked returns the duration after which the oldest idle
+// connection is closed. Returns false if idle connections are kept.
+func (p *socketPool) evictAfterLocked() (time.Duration, bool) {
+	switch {
+	case p.open > p.size:
+		return p.overflowTimeout, true
+	case p.open > p.min && p.idleTimeout > 0:
+		return p.idleTimeout, true
+	}
+	return 0, false
+}
+
+// scheduleEvictLocked schedules the eviction of the oldest idle connection,
+// unless it is scheduled already at the same time or earlier.
+func (p *socketPool) scheduleEvictLocked() {
+	if len(p.idle) == 0 {
+		return
+	}
+	after, ok := p.evictAfterLocked()
+	if !ok {
+		return
+	}
+
+	// Idle connections are ordered by the time they were returned, oldest
+	// first.
+	at := p.idle[0].idleSince.Add(after)
+	if p.evict != nil {
+		if !at.Before(p.evictAt) {
+			return
+		}
+		p.evict.Stop()
+	}
+	p.evictAt = at
+	p.evict = time.AfterFunc(time.Until(at), p.evictIdle)
+}
+
+// evictIdle closes idle overflow connections which were idle for the
+// overflow idle timeout, until the pool is back to its size, and idle
+// connections which were idle for the idle timeout, until the pool is down to
+// its minimum.
+func (p *socketPool) evictIdle() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.evict = nil
+	if p.closed {
+		return
+	}
+
+	now := time.Now()
+	for len(p.idle) > 0 {
+		after, ok := p.evictAfterLocked()
+		if !ok {
+			return
+		}
+		c := p.idle[0]
+		if now.Sub(c.idleSince) < after {
+			break
+		}
+		p.idle = p.idle[1:]
+		p.open--
+		c.Conn.Close()
+	}
+	p.scheduleEvictLocked()
+	p.observeLocked()
+}
+
+// ping checks all idle connections with the health check, closes the ones
+// which fail and opens replacements up to the minimum in the background.
+func (p *socketPool) ping() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	alive := p.idle[:0]
+	for _, c := range p.idle {
+		if err := p.healthCheck(c.Conn); err != nil {
+			if debug {
+				fmt.Printf("socket pool idle connection failed health check: %v\n", err)
+			}
+			p.open--
+			c.Conn.Close()
+			continue
+		}
+		alive = append(alive, c)
+	}
+	if len(alive) < len(p.idle) {
+		for idx := len(alive); idx < len(p.idle); idx++ {
+			p.idle[idx] = nil
+		}
+		p.idle = alive
+		p.observeLocked()
+		if p.open < p.min {
+			go p.fill()
+		}
+	}
+
+	p.pinger = time.AfterFunc(p.pingInterval, p.ping)
+}
+
+// Close closes all idle connections of the pool and fails all waiting
+// requests. Connections in use are closed when they are returned.
+func (p *socketPool) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	if p.evict != nil {
+		p.evict.Stop()
+		p.evict = nil
+	}
+	if p.pinger != nil {
+		p.pinger.Stop()
+		p.pinger = nil
+	}
+	for _, c := range p.idle {
+		p.open--
+		c.Conn.Close()
+	}
+	p.idle = nil
+	for _, ready := range p.waiting {
+		close(ready)
+	}
+	p.waiting = nil
+	p.observeLocked()
+
+	return nil
+}
+
+// observeLocked passes the current utilization of the pool to its observe
+// function, if any.
+func (p *socketPool) observeLocked() {
+	if p.observe == nil {
+		return
+	}
+
+	p.observe(SocketPoolStats{
+		Open:    p.open,
+		Idle:    len(p.idle),
+		Waiting: len(p.waiting),
+		Max:     p.size + p.overflow,
+	})
+}
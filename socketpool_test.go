@@ -0,0 +1,259 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"io"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSocketPoolOverflow(t *testing.T) {
+	var dials, open int32
+	pool, err := newSocketPool(&SocketPoolConfig{
+		MaxConnections:      2,
+		OverflowConnections: 1,
+		OverflowIdleTimeout: 50 * time.Millisecond,
+	}, func() (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		atomic.AddInt32(&open, 1)
+		c1, c2 := net.Pipe()
+		c2.Close()
+		return &testCountedConn{Conn: c1, open: &open}, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// Burst beyond the pool size uses the overflow.
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		c, getErr := pool.GetWithTimeout(time.Second)
+		if getErr != nil {
+			t.Fatalf("get %d failed: %v", i, getErr)
+		}
+		conns = append(conns, c)
+	}
+	if _, err = pool.GetWithTimeout(10 * time.Millisecond); err != errSocketPoolTimeout {
+		t.Errorf("expected timeout with exhausted pool, got %v", err)
+	}
+
+	// Returned connections are handed over to waiting requests.
+	got := make(chan net.Conn)
+	go func() {
+		c, _ := pool.GetWithTimeout(time.Second)
+		got <- c
+	}()
+	time.Sleep(10 * time.Millisecond)
+	conns[0].Close()
+	if c := <-got; c != conns[0] {
+		t.Errorf("expected returned connection to be handed over")
+	}
+
+	// Removed connections grant their slot to waiting requests.
+	go func() {
+		c, _ := pool.GetWithTimeout(time.Second)
+		got <- c
+	}()
+	time.Sleep(10 * time.Millisecond)
+	pool.Remove(conns[1])
+	c := <-got
+	if n := atomic.LoadInt32(&dials); c == nil || n != 4 {
+		t.Errorf("expected new connection for removed slot, got %v with %d dials", c, n)
+	}
+
+	// The pool shrinks back to its size when idle.
+	c.Close()
+	conns[0].Close()
+	conns[2].Close()
+	if n := atomic.LoadInt32(&open); n != 3 {
+		t.Fatalf("expected 3 open connections, got %d", n)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if n := atomic.LoadInt32(&open); n != 2 {
+		t.Errorf("expected pool to shrink to 2 connections, got %d", n)
+	}
+}
+
+type testCountedConn struct {
+	net.Conn
+	open *int32
+}
+
+func (c *testCountedConn) Close() error {
+	atomic.AddInt32(c.open, -1)
+	return c.Conn.Close()
+}
+
+func TestSocketPoolIdleEviction(t *testing.T) {
+	var open int32
+	var stale net.Conn
+	pool, err := newSocketPool(&SocketPoolConfig{
+		MinConnections: 1,
+		MaxConnections: 3,
+		IdleTimeout:    50 * time.Millisecond,
+		HealthCheck: func(conn net.Conn) error {
+			if conn == stale {
+				return io.EOF
+			}
+			return nil
+		},
+	}, func() (net.Conn, error) {
+		atomic.AddInt32(&open, 1)
+		c1, c2 := net.Pipe()
+		c2.Close()
+		return &testCountedConn{Conn: c1, open: &open}, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// Stale idle connections are replaced before use.
+	c, _ := pool.GetWithTimeout(time.Second)
+	stale = c.(*socketPoolConn).Conn
+	c.Close()
+	c, _ = pool.GetWithTimeout(time.Second)
+	if c.(*socketPoolConn).Conn == stale {
+		t.Errorf("expected stale connection to be replaced")
+	}
+	if n := atomic.LoadInt32(&open); n != 1 {
+		t.Errorf("expected 1 open connection after replacement, got %d", n)
+	}
+
+	// Idle connections are closed down to the minimum.
+	c2, _ := pool.GetWithTimeout(time.Second)
+	c3, _ := pool.GetWithTimeout(time.Second)
+	c.Close()
+	c2.Close()
+	c3.Close()
+	time.Sleep(150 * time.Millisecond)
+	if n := atomic.LoadInt32(&open); n != 1 {
+		t.Errorf("expected pool to shrink to 1 connection, got %d", n)
+	}
+}
+
+func TestSocketPoolPing(t *testing.T) {
+	var open int32
+	var mutex sync.Mutex
+	dead := make(map[net.Conn]bool)
+	pool, err := newSocketPool(&SocketPoolConfig{
+		MinConnections: 2,
+		MaxConnections: 3,
+		PingInterval:   10 * time.Millisecond,
+		HealthCheck: func(conn net.Conn) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if dead[conn] {
+				return io.EOF
+			}
+			return nil
+		},
+	}, func() (net.Conn, error) {
+		atomic.AddInt32(&open, 1)
+		c1, c2 := net.Pipe()
+		c2.Close()
+		return &testCountedConn{Conn: c1, open: &open}, nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	idle := func() []net.Conn {
+		pool.mutex.Lock()
+		defer pool.mutex.Unlock()
+		conns := make([]net.Conn, len(pool.idle))
+		for idx, c := range pool.idle {
+			conns[idx] = c.Conn
+		}
+		return conns
+	}
+	waitFor := func(cond func() bool) bool {
+		for i := 0; i < 100; i++ {
+			if cond() {
+				return true
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		return false
+	}
+	if !waitFor(func() bool { return len(idle()) == 2 }) {
+		t.Fatalf("expected pool to open 2 connections in advance, got %d", len(idle()))
+	}
+
+	// Dead idle connections are closed and replaced up to the minimum in the
+	// background, before they are used.
+	mutex.Lock()
+	for _, conn := range idle() {
+		dead[conn] = true
+	}
+	mutex.Unlock()
+	if !waitFor(func() bool {
+		conns := idle()
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(conns) == 2 && !dead[conns[0]] && !dead[conns[1]]
+	}) {
+		t.Errorf("expected dead connections to be replaced")
+	}
+	if n := atomic.LoadInt32(&open); n != 2 {
+		t.Errorf("expected 2 open connections after replacement, got %d", n)
+	}
+
+	pool.Close()
+	pool.mutex.Lock()
+	if pool.pinger != nil {
+		t.Errorf("expected pings to stop when the pool is closed")
+	}
+	pool.mutex.Unlock()
+}
+
+func TestCheckConnAlive(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		c, _ := l.Accept()
+		accepted <- c
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	peer := <-accepted
+
+	if err = CheckConnAlive(conn); err != nil {
+		t.Errorf("expected connection to be alive, got %v", err)
+	}
+
+	peer.Close()
+	time.Sleep(10 * time.Millisecond)
+	if err = CheckConnAlive(conn); err == nil && runtime.GOOS != "windows" {
+		t.Errorf("expected error for connection closed by peer")
+	}
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"strings"
+)
+
+// A Folder represents a folder as listed from a hierarchy table.
+type Folder struct {
+	EntryID        string `json:"entryID"`
+	SourceKey      string `json:"sourceKey"`
+	DisplayName    string `json:"displayName"`
+	Path           string `json:"path"`
+	ContainerClass string `json:"containerClass,omitempty"`
+	Depth          uint64 `json:"depth"`
+	ContentCount   uint64 `json:"contentCount"`
+	ContentUnread  uint64 `json:"contentUnread"`
+}
+
+// FolderStats holds the statistics of the messages in a folder.
+type FolderStats struct {
+	EntryID        string            `json:"entryID"`
+	Path           string            `json:"path,omitempty"`
+	Count          uint64            `json:"count"`
+	Size           uint64            `json:"size"`
+	MessageClasses map[string]uint64 `json:"messageClasses"`
+}
+
+// StoreStats holds the statistics of a store and all of its folders.
+type StoreStats struct {
+	Size           uint64            `json:"size"`
+	Count          uint64            `json:"count"`
+	MessageClasses map[string]uint64 `json:"messageClasses"`
+	Folders        []*FolderStats    `json:"folders"`
+}
+
+var folderProps = []PT{
+	PR_ENTRYID,
+	PR_SOURCE_KEY,
+	PR_DISPLAY_NAME,
+	PR_CONTAINER_CLASS,
+	PR_DEPTH,
+	PR_CONTENT_COUNT,
+	PR_CONTENT_UNREAD,
+}
+
+// Size returns the size of the accociated Store in bytes as reported by the
+// server.
+func (s *Store) Size() uint64 {
+	if value, ok := s.Props.Get(PR_MESSAGE_SIZE_EXTENDED); ok {
+		return uint64(value.LIValue)
+	}
+	if value, ok := s.Props.Get(PR_MESSAGE_SIZE); ok {
+		return value.ULValue
+	}
+
+	return 0
+}
+
+// ListFolders lists all folders below the folder with the provided Entry ID
+// using the provided session. The folders are returned in hierarchy order,
+// each folder directly followed by its sub folders. Folder paths are built
+// from the display names of the folders, separated by slashes.
+func (c *KCC) ListFolders(ctx context.Context, folderEntryID string, sessionID KCSessionID) ([]*Folder, error) {
+	var folders []*Folder
+	var path []string
+	err := c.QueryTableRows(ctx, folderEntryID, TABLETYPE_MS, MAPI_FOLDER, CONVENIENT_DEPTH, folderProps, sessionID, func(rows []*PropTagRowSet) error {
+		for _, row := range rows {
+			folder := &Folder{
+				DisplayName:    row.GetString(PR_DISPLAY_NAME),
+				ContainerClass: row.GetString(PR_CONTAINER_CLASS),
+			}
+			if value, ok := row.Get(PR_ENTRYID); ok {
+				folder.EntryID = string(value.BinValue)
+			}
+			if value, ok := row.Get(PR_SOURCE_KEY); ok {
+				folder.SourceKey = string(value.BinValue)
+			}
+			if value, ok := row.Get(PR_DEPTH); ok {
+				folder.Depth = value.ULValue
+			}
+
+			// Depth is 1 for direct sub folders of the listed folder.
+			if depth := int(folder.Depth); depth > 0 && depth <= len(path)+1 {
+				path = append(path[:depth-1], folder.DisplayName)
+			} else {
+				path = []string{folder.DisplayName}
+			}
+			folder.Path = strings.Join(path, "/")
+
+			if value, ok := row.Get(PR_CONTENT_COUNT); ok {
+				folder.ContentCount = value.ULValue
+			}
+			if value, ok := row.Get(PR_CONTENT_UNREAD); ok {
+				folder.ContentUnread = value.ULValue
+			}
+			folders = append(folders, folder)
+		}
+		return nil
+	})
+
+	return folders, err
+}
+
+// GetFolderStats counts the messages in the folder with the provided Entry ID
+// using the provided session, summing up their sizes overall and per message
+// class.
+func (c *KCC) GetFolderStats(ctx context.Context, folderEntryID string, sessionID KCSessionID) (*FolderStats, error) {
+	stats := &FolderStats{
+		EntryID:        folderEntryID,
+		MessageClasses: make(map[string]uint64),
+	}
+
+	err := c.QueryTableRows(ctx, folderEntryID, TABLETYPE_MS, MAPI_MESSAGE, 0, []PT{PR_MESSAGE_CLASS, PR_MESSAGE_SIZE}, sessionID, func(rows []*PropTagRowSet) error {
+		for _, row := range rows {
+			stats.Count++
+			stats.MessageClasses[row.GetString(PR_MESSAGE_CLASS)]++
+			if value, ok := row.Get(PR_MESSAGE_SIZE); ok {
+				stats.Size += value.ULValue
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// GetStoreStats collects the statistics of all folders of the provided store
+// using the provided session.
+func (c *KCC) GetStoreStats(ctx context.Context, store *Store, sessionID KCSessionID) (*StoreStats, error) {
+	folders, err := c.ListFolders(ctx, store.RootEntryID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &StoreStats{
+		Size:           store.Size(),
+		MessageClasses: make(map[string]uint64),
+		Folders:        make([]*FolderStats, 0, len(folders)),
+	}
+
+	for _, folder := range folders {
+		folderStats, err := c.GetFolderStats(ctx, folder.EntryID, sessionID)
+		if err != nil {
+			return nil, err
+		}
+		folderStats.Path = folder.Path
+
+		stats.Count += folderStats.Count
+		for messageClass, count := range folderStats.MessageClasses {
+			stats.MessageClasses[messageClass] += count
+		}
+		stats.Folders = append(stats.Folders, folderStats)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+)
+
+// A Store represents an opened Kopano store together with the properties of
+// the store object and its root folder, which contain the Entry IDs of the
+// well known folders.
+type Store struct {
+	EntryID     string
+	RootEntryID string
+	GUID        [16]byte
+
+	Props     *PropTagRowSet
+	RootProps *PropTagRowSet
+}
+
+// OpenStore opens the store with the provided store Entry ID using the
+// provided session and loads the properties of the store and its root folder.
+// An empty Entry ID opens the default store of the session's user.
+func (c *KCC) OpenStore(ctx context.Context, storeEntryID string, sessionID KCSessionID) (*Store, error) {
+	resp, err := c.GetStore(ctx, storeEntryID, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("open store getStore failed: %v", err)
+	}
+	if resp.Er != KCSuccess {
+		return nil, resp.Er
+	}
+
+	guid, err := base64.StdEncoding.DecodeString(resp.GUID)
+	if err != nil || len(guid) != 16 {
+		return nil, fmt.Errorf("open store returned invalid store GUID")
+	}
+
+	store := &Store{
+		EntryID:     resp.StoreEntryID,
+		RootEntryID: resp.RootEntryID,
+	}
+	copy(store.GUID[:], guid)
+
+	for _, target := range []struct {
+		entryID string
+		props   **PropTagRowSet
+	}{
+		{store.EntryID, &store.Props},
+		{store.RootEntryID, &store.RootProps},
+	} {
+		loaded, err := c.LoadObject(ctx, target.entryID, 0, sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("open store loadObject failed: %v", err)
+		}
+		if loaded.Er != KCSuccess {
+			return nil, loaded.Er
+		}
+		if loaded.Object == nil {
+			return nil, fmt.Errorf("open store loadObject returned no object")
+		}
+		*target.props = loaded.Object.Props()
+	}
+
+	return store, nil
+}
+
+// OpenUserStore opens the private store of the user with the provided username
+// using the provided session, which must have access to that store.
+func (c *KCC) OpenUserStore(ctx context.Context, username string, sessionID KCSessionID) (*Store, error) {
+	resp, err := c.ResolveUserStore(ctx, username, 0, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("open user store resolveUserStore failed: %v", err)
+	}
+	if resp.Er != KCSuccess {
+		return nil, resp.Er
+	}
+
+	return c.OpenStore(ctx, resp.StoreEntryID, sessionID)
+}
+
+// FolderEntryID returns the Entry ID of the well known folder which is
+// referenced by the provided prop tag (for example PR_IPM_OUTBOX_ENTRYID)
+// either on the accociated store or its root folder.
+func (s *Store) FolderEntryID(pt PT) (string, bool) {
+	for _, props := range []*PropTagRowSet{s.Props, s.RootProps} {
+		if value, ok := props.Get(pt); ok && len(value.BinValue) > 0 {
+			return string(value.BinValue), true
+		}
+	}
+
+	return "", false
+}
+
+// DefaultFolderEntryID returns the Entry ID of the well known folder which is
+// referenced by the provided prop tag in the default store of the provided
+// session's user.
+func (c *KCC) DefaultFolderEntryID(ctx context.Context, pt PT, sessionID KCSessionID) (string, error) {
+	store, err := c.OpenStore(ctx, "", sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	entryID, ok := store.FolderEntryID(pt)
+	if !ok {
+		return "", fmt.Errorf("store has no folder for prop tag 0x%x", uint64(pt))
+	}
+
+	return entryID, nil
+}
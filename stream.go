@@ -0,0 +1,326 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultTableStreamBatchSize is the default number of rows which are fetched
+// per request when streaming table rows. Streamed rows are not held in memory,
+// so batches can be much larger than DefaultTableBatchSize.
+var DefaultTableStreamBatchSize uint64 = 5000
+
+// A soapStreamDecoder is a response which decodes its SOAP response element
+// itself, instead of being unmarshaled as a whole.
+type soapStreamDecoder interface {
+	decodeSOAPStream(decoder *xml.Decoder, start *xml.StartElement) error
+	// reset prepares the response to be decoded again, keeping its callback.
+	reset()
+}
+
+// A SOAPStreamFunc decodes the response element of a SOAP response
+// incrementally. It is called with the decoder positioned right after the
+// provided start element of the response element, for example
+// ns:getUserListResponse, and should read tokens only up to its end element.
+type SOAPStreamFunc func(decoder *xml.Decoder, start *xml.StartElement) error
+
+// A soapStreamFuncResponse passes its response element to a SOAPStreamFunc.
+type soapStreamFuncResponse struct {
+	fn SOAPStreamFunc
+}
+
+func (r *soapStreamFuncResponse) decodeSOAPStream(decoder *xml.Decoder, start *xml.StartElement) error {
+	return callSafely(func() error {
+		return r.fn(decoder, start)
+	})
+}
+
+func (r *soapStreamFuncResponse) reset() {
+}
+
+// DoRequestStream sends the provided payload data as SOAP through the means of
+// the provided client and calls the provided function to decode the response
+// element while the response is read, instead of decoding it as a whole. Use
+// it to process huge responses like user lists or table rows incrementally
+// without holding them in memory. The error returned by the function is
+// returned. SOAP faults are returned as ProtocolError without calling the
+// function. Requests are only retried if the function was not called yet.
+func DoRequestStream(ctx context.Context, client SOAPClient, payload *string, fn SOAPStreamFunc) error {
+	return client.DoRequest(ctx, payload, &soapStreamFuncResponse{
+		fn: fn,
+	})
+}
+
+// decodeSOAPListStream decodes a SOAP response element from the provided
+// decoder, after its start element was read. The er child is decoded into the
+// provided er and every item of the list child with the provided name is
+// passed to the provided item function with its start element. All other
+// elements are skipped.
+func decodeSOAPListStream(decoder *xml.Decoder, er *KCError, listName string, item func(*xml.StartElement) error) error {
+	inList := false
+	for {
+		t, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		switch se := t.(type) {
+		case xml.StartElement:
+			switch {
+			case inList && se.Name.Local == "item":
+				err = item(&se)
+			case !inList && se.Name.Local == listName:
+				inList = true
+			case !inList && se.Name.Local == "er":
+				err = decoder.DecodeElement(er, &se)
+			default:
+				err = decoder.Skip()
+			}
+			if err != nil {
+				return err
+			}
+
+		case xml.EndElement:
+			if !inList {
+				// End of the response element.
+				return nil
+			}
+			inList = false
+		}
+	}
+}
+
+// A TableQueryRowsStreamResponse holds the returned data of a SOAP request
+// which fetches table rows, passing each row to a callback while the response
+// is decoded instead of holding all rows.
+type TableQueryRowsStreamResponse struct {
+	Er    KCError
+	Count uint64
+
+	cb      func(*PropTagRowSet) error
+	workers int
+}
+
+func (r *TableQueryRowsStreamResponse) decodeSOAPStream(decoder *xml.Decoder, start *xml.StartElement) error {
+	deliver := func(row *PropTagRowSet) error {
+		r.Count++
+		return r.cb(row)
+	}
+
+	if r.workers > 1 {
+		pd := newParallelDecoder(r.workers, func(data []byte) (interface{}, error) {
+			var row PropTagRowSet
+			err := unmarshalItem(data, &row)
+			return &row, err
+		}, func(v interface{}) error {
+			return deliver(v.(*PropTagRowSet))
+		})
+		err := decodeSOAPListStream(decoder, &r.Er, "sRowSet", func(se *xml.StartElement) error {
+			return pd.add(decoder, se)
+		})
+		if err != nil {
+			return err
+		}
+		return pd.flush()
+	}
+
+	return decodeSOAPListStream(decoder, &r.Er, "sRowSet", func(se *xml.StartElement) error {
+		var row PropTagRowSet
+		if err := decoder.DecodeElement(&row, se); err != nil {
+			return err
+		}
+		return deliver(&row)
+	})
+}
+
+func (r *TableQueryRowsStreamResponse) reset() {
+	r.Er = KCSuccess
+	r.Count = 0
+}
+
+// A UserListStreamResponse holds the returned data of a SOAP request which
+// lists users, passing each user to a callback while the response is decoded
+// instead of holding all users.
+type UserListStreamResponse struct {
+	Er    KCError
+	Count uint64
+
+	cb      func(*User) error
+	workers int
+}
+
+func (r *UserListStreamResponse) decodeSOAPStream(decoder *xml.Decoder, start *xml.StartElement) error {
+	deliver := func(user *User) error {
+		r.Count++
+		return r.cb(user)
+	}
+
+	if r.workers > 1 {
+		pd := newParallelDecoder(r.workers, func(data []byte) (interface{}, error) {
+			var user User
+			err := unmarshalItem(data, &user)
+			return &user, err
+		}, func(v interface{}) error {
+			return deliver(v.(*User))
+		})
+		err := decodeSOAPListStream(decoder, &r.Er, "sUserArray", func(se *xml.StartElement) error {
+			return pd.add(decoder, se)
+		})
+		if err != nil {
+			return err
+		}
+		return pd.flush()
+	}
+
+	return decodeSOAPListStream(decoder, &r.Er, "sUserArray", func(se *xml.StartElement) error {
+		var user User
+		if err := decoder.DecodeElement(&user, se); err != nil {
+			return err
+		}
+		return deliver(&user)
+	})
+}
+
+func (r *UserListStreamResponse) reset() {
+	r.Er = KCSuccess
+	r.Count = 0
+}
+
+// TableQueryRowsStream fetches up to the provided number of rows from the
+// current position of the table with the provided table ID using the provided
+// session, calling the provided callback for each row as it is decoded. If
+// the callback returns an error, decoding stops and the error is returned.
+// With more than one decode worker, rows are decoded in parallel but the
+// callback is still called sequentially in the order of the rows.
+func (c *KCC) TableQueryRowsStream(ctx context.Context, tableID uint64, rowCount uint64, flags KCFlag, sessionID KCSessionID, cb func(*PropTagRowSet) error) (*TableQueryRowsStreamResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:tableQueryRows><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><ulTableId>")
+	b.WriteString(strconv.FormatUint(tableID, 10))
+	b.WriteString("</ulTableId><ulRowCount>")
+	b.WriteString(strconv.FormatUint(rowCount, 10))
+	b.WriteString("</ulRowCount><ulFlags>")
+	b.WriteString(flags.String())
+	b.WriteString("</ulFlags></ns:tableQueryRows>")
+	payload := b.String()
+
+	tableQueryRowsResponse := TableQueryRowsStreamResponse{
+		cb: func(row *PropTagRowSet) error {
+			return callSafely(func() error {
+				return cb(row)
+			})
+		},
+		workers: c.decodeWorkers,
+	}
+	err := c.Client.DoRequest(ctx, &payload, &tableQueryRowsResponse)
+
+	return &tableQueryRowsResponse, err
+}
+
+// QueryTableRowsStream opens a table of the object with the provided Entry ID,
+// sets the provided columns and calls the provided callback for every row as
+// it is decoded, until all rows were fetched or the callback returns an error.
+// A panic of the callback is returned as *PanicError.
+// Memory use does not grow with the number of rows. The table is always
+// closed before returning.
+func (c *KCC) QueryTableRowsStream(ctx context.Context, entryID string, tableType TableType, objType MAPIType, flags KCFlag, props []PT, sessionID KCSessionID, cb func(*PropTagRowSet) error) error {
+	opened, err := c.TableOpen(ctx, entryID, tableType, objType, flags, sessionID)
+	if err != nil {
+		return fmt.Errorf("query table rows stream tableOpen failed: %v", err)
+	}
+	if opened.Er != KCSuccess {
+		return opened.Er
+	}
+	defer c.TableClose(ctx, opened.TableID, sessionID)
+
+	columns, err := c.TableSetColumns(ctx, opened.TableID, props, sessionID)
+	if err != nil {
+		return fmt.Errorf("query table rows stream tableSetColumns failed: %v", err)
+	}
+	if columns.Er != KCSuccess {
+		return columns.Er
+	}
+
+	// NOTE(longsleep): Errors of the callback are returned as is, so they can
+	// be told apart from request errors.
+	var cbErr error
+	batchSize := DefaultTableStreamBatchSize
+	for {
+		rows, err := c.TableQueryRowsStream(ctx, opened.TableID, batchSize, 0, sessionID, func(row *PropTagRowSet) error {
+			cbErr = callSafely(func() error {
+				return cb(row)
+			})
+			return cbErr
+		})
+		if cbErr != nil {
+			return cbErr
+		}
+		if err != nil {
+			return fmt.Errorf("query table rows stream tableQueryRows failed: %v", err)
+		}
+		if rows.Er != KCSuccess {
+			return rows.Er
+		}
+		if rows.Count < batchSize {
+			return nil
+		}
+	}
+}
+
+// ListUsers lists all users of the company with the provided Entry ID using
+// the provided session, calling the provided callback for every user as it is
+// decoded. An empty company Entry ID lists the users of the default company.
+// If the callback returns an error, decoding stops and the error is returned.
+// A panic of the callback is returned as *PanicError.
+func (c *KCC) ListUsers(ctx context.Context, companyEntryID string, sessionID KCSessionID, cb func(*User) error) error {
+	var b strings.Builder
+	b.WriteString("<ns:getUserList><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><sCompanyId>")
+	b.WriteString(xmlCharData(companyEntryID).Escape())
+	b.WriteString("</sCompanyId><ulFlags>0</ulFlags></ns:getUserList>")
+	payload := b.String()
+
+	var cbErr error
+	userListResponse := UserListStreamResponse{
+		cb: func(user *User) error {
+			cbErr = callSafely(func() error {
+				return cb(user)
+			})
+			return cbErr
+		},
+		workers: c.decodeWorkers,
+	}
+	err := c.Client.DoRequest(ctx, &payload, &userListResponse)
+	if cbErr != nil {
+		return cbErr
+	}
+	if err != nil {
+		return fmt.Errorf("list users getUserList failed: %v", err)
+	}
+	if userListResponse.Er != KCSuccess {
+		return userListResponse.Er
+	}
+
+	return nil
+}
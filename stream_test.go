@@ -0,0 +1,151 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTableQueryRowsStream(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		testTableQueryRowsStream(t, workers)
+	}
+}
+
+func testTableQueryRowsStream(t *testing.T, workers int) {
+	var b strings.Builder
+	b.WriteString("<ns:tableQueryRowsResponse><sRowSet>")
+	for i := 0; i < 1000; i++ {
+		b.WriteString("<item><item xsi:type=\"ns:propVal\"><ulPropTag>972947487</ulPropTag><lpszA>")
+		b.WriteString(strconv.Itoa(i))
+		b.WriteString("</lpszA></item></item>")
+	}
+	b.WriteString("</sRowSet><er>0</er></ns:tableQueryRowsResponse>")
+	c := NewKCCWithClient(&cannedSOAPClient{
+		response: b.String(),
+	})
+	c.SetDecodeWorkers(workers)
+
+	next := 0
+	resp, err := c.TableQueryRowsStream(context.Background(), 1, 1000, 0, 1, func(row *PropTagRowSet) error {
+		if value := row.GetString(PR_SMTP_ADDRESS); value != strconv.Itoa(next) {
+			t.Errorf("unexpected row %d: %v", next, value)
+		}
+		next++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Er != KCSuccess || resp.Count != 1000 || next != 1000 {
+		t.Errorf("unexpected response with %d workers: %+v, %d rows", workers, resp, next)
+	}
+
+	// Callback errors stop decoding.
+	stop := errors.New("stop")
+	next = 0
+	_, err = c.TableQueryRowsStream(context.Background(), 1, 1000, 0, 1, func(row *PropTagRowSet) error {
+		next++
+		if next == 10 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || next != 10 {
+		t.Errorf("unexpected error with %d workers after %d rows: %v", workers, next, err)
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	c := NewKCCWithClient(&cannedSOAPClient{
+		response: "<ns:getUserListResponse><sUserArray>" +
+			"<item><ulUserId>3</ulUserId><lpszUsername>user1</lpszUsername><lpsPropmap><item><ulPropId>1</ulPropId></item></lpsPropmap></item>" +
+			"<item><ulUserId>4</ulUserId><lpszUsername>user2</lpszUsername></item>" +
+			"</sUserArray><er>0</er></ns:getUserListResponse>",
+	})
+
+	var usernames []string
+	err := c.ListUsers(context.Background(), "", 1, func(user *User) error {
+		usernames = append(usernames, user.Username)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(usernames, ",") != "user1,user2" {
+		t.Errorf("unexpected users: %v", usernames)
+	}
+
+	c = NewKCCWithClient(&cannedSOAPClient{
+		response: "<ns:getUserListResponse><sUserArray></sUserArray><er>" + strconv.FormatUint(uint64(KCERR_NO_ACCESS), 10) + "</er></ns:getUserListResponse>",
+	})
+	if err = c.ListUsers(context.Background(), "", 1, func(user *User) error {
+		return nil
+	}); err != KCERR_NO_ACCESS {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDoRequestStream(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("<ns:getUserListResponse><sUserArray>")
+	for i := 0; i < 100; i++ {
+		b.WriteString("<item><lpszUsername>user")
+		b.WriteString(strconv.Itoa(i))
+		b.WriteString("</lpszUsername></item>")
+	}
+	b.WriteString("</sUserArray><er>0</er></ns:getUserListResponse>")
+	client := &cannedSOAPClient{
+		response: b.String(),
+	}
+
+	var names []string
+	var er KCError
+	payload := "<ns:getUserList/>"
+	err := DoRequestStream(context.Background(), client, &payload, func(decoder *xml.Decoder, start *xml.StartElement) error {
+		if start.Name.Local != "getUserListResponse" {
+			t.Errorf("unexpected response element: %v", start.Name)
+		}
+		return decodeSOAPListStream(decoder, &er, "sUserArray", func(se *xml.StartElement) error {
+			var user User
+			if err := decoder.DecodeElement(&user, se); err != nil {
+				return err
+			}
+			names = append(names, user.Username)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if er != KCSuccess || len(names) != 100 || names[99] != "user99" {
+		t.Errorf("unexpected stream result: %v, %d users", er, len(names))
+	}
+
+	stop := errors.New("stop")
+	err = DoRequestStream(context.Background(), client, &payload, func(decoder *xml.Decoder, start *xml.StartElement) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultTableBatchSize is the default number of rows which are fetched per
+// request when iterating table rows.
+var DefaultTableBatchSize uint64 = 100
+
+// TableType is the type representing Kopano table types.
+type TableType uint64
+
+func (tt TableType) String() string {
+	return strconv.FormatUint(uint64(tt), 10)
+}
+
+// Kopano table types as defined in provider/include/kcore.hpp. This only
+// defines the types actually used or understood by kcc-go.
+const (
+	TABLETYPE_MS TableType = 1
+)
+
+// Table flags as defined in mapi4linux/include/mapidefs.h. This only defines
+// the flags actually used or understood by kcc-go.
+const (
+	CONVENIENT_DEPTH KCFlag = 0x00000001
+	MAPI_ASSOCIATED  KCFlag = 0x00000040
+	TBL_NOADVANCE    KCFlag = 0x00000001
+)
+
+// TableOpen opens a table of the object with the provided Entry ID using the
+// provided session. Use MAPI_MESSAGE as object type to open a folder contents
+// table and MAPI_FOLDER to open a hierarchy table.
+func (c *KCC) TableOpen(ctx context.Context, entryID string, tableType TableType, objType MAPIType, flags KCFlag, sessionID KCSessionID) (*TableOpenResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:tableOpen><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><sEntryId>")
+	b.WriteString(xmlCharData(entryID).Escape())
+	b.WriteString("</sEntryId><ulTableType>")
+	b.WriteString(tableType.String())
+	b.WriteString("</ulTableType><ulType>")
+	b.WriteString(objType.String())
+	b.WriteString("</ulType><ulFlags>")
+	b.WriteString(flags.String())
+	b.WriteString("</ulFlags></ns:tableOpen>")
+	payload := b.String()
+
+	var tableOpenResponse TableOpenResponse
+	err := c.Client.DoRequest(ctx, &payload, &tableOpenResponse)
+
+	return &tableOpenResponse, err
+}
+
+// TableSetColumns sets the columns of the table with the provided table ID
+// using the provided session.
+func (c *KCC) TableSetColumns(ctx context.Context, tableID uint64, props []PT, sessionID KCSessionID) (*TableResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:tableSetColumns><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><ulTableId>")
+	b.WriteString(strconv.FormatUint(tableID, 10))
+	b.WriteString("</ulTableId>")
+	writePropTagArray(&b, "aPropTag", props)
+	b.WriteString("</ns:tableSetColumns>")
+	payload := b.String()
+
+	var tableResponse TableResponse
+	err := c.Client.DoRequest(ctx, &payload, &tableResponse)
+
+	return &tableResponse, err
+}
+
+// TableQueryRows fetches up to the provided number of rows from the current
+// position of the table with the provided table ID using the provided
+// session.
+func (c *KCC) TableQueryRows(ctx context.Context, tableID uint64, rowCount uint64, flags KCFlag, sessionID KCSessionID) (*TableQueryRowsResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:tableQueryRows><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><ulTableId>")
+	b.WriteString(strconv.FormatUint(tableID, 10))
+	b.WriteString("</ulTableId><ulRowCount>")
+	b.WriteString(strconv.FormatUint(rowCount, 10))
+	b.WriteString("</ulRowCount><ulFlags>")
+	b.WriteString(flags.String())
+	b.WriteString("</ulFlags></ns:tableQueryRows>")
+	payload := b.String()
+
+	var tableQueryRowsResponse TableQueryRowsResponse
+	err := c.Client.DoRequest(ctx, &payload, &tableQueryRowsResponse)
+
+	return &tableQueryRowsResponse, err
+}
+
+// TableClose closes the table with the provided table ID using the provided
+// session.
+func (c *KCC) TableClose(ctx context.Context, tableID uint64, sessionID KCSessionID) (*TableResponse, error) {
+	payload := "<ns:tableClose><ulSessionId>" +
+		sessionID.String() +
+		"</ulSessionId><ulTableId>" +
+		strconv.FormatUint(tableID, 10) +
+		"</ulTableId></ns:tableClose>"
+
+	var tableResponse TableResponse
+	err := c.Client.DoRequest(ctx, &payload, &tableResponse)
+
+	return &tableResponse, err
+}
+
+// QueryTableRows opens a table of the object with the provided Entry ID, sets
+// the provided columns and calls the provided callback with batches of rows
+// until all rows were fetched or the callback returns an error. The table is
+// always closed before returning.
+func (c *KCC) QueryTableRows(ctx context.Context, entryID string, tableType TableType, objType MAPIType, flags KCFlag, props []PT, sessionID KCSessionID, cb func([]*PropTagRowSet) error) error {
+	opened, err := c.TableOpen(ctx, entryID, tableType, objType, flags, sessionID)
+	if err != nil {
+		return fmt.Errorf("query table rows tableOpen failed: %v", err)
+	}
+	if opened.Er != KCSuccess {
+		return opened.Er
+	}
+	defer c.TableClose(ctx, opened.TableID, sessionID)
+
+	columns, err := c.TableSetColumns(ctx, opened.TableID, props, sessionID)
+	if err != nil {
+		return fmt.Errorf("query table rows tableSetColumns failed: %v", err)
+	}
+	if columns.Er != KCSuccess {
+		return columns.Er
+	}
+
+	batchSize := DefaultTableBatchSize
+	for {
+		rows, err := c.TableQueryRows(ctx, opened.TableID, batchSize, 0, sessionID)
+		if err != nil {
+			return fmt.Errorf("query table rows tableQueryRows failed: %v", err)
+		}
+		if rows.Er != KCSuccess {
+			return rows.Er
+		}
+		if len(rows.RowSet) > 0 {
+			if err = callSafely(func() error {
+				return cb(rows.RowSet)
+			}); err != nil {
+				return err
+			}
+		}
+		if uint64(len(rows.RowSet)) < batchSize {
+			return nil
+		}
+	}
+}
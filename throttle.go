@@ -0,0 +1,249 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Default throttle settings.
+var (
+	DefaultThrottleMinBackoff = 100 * time.Millisecond
+	DefaultThrottleMaxBackoff = 30 * time.Second
+	DefaultThrottleMaxRetries = 5
+)
+
+// A Throttle delays requests to a backend which reported to be busy. Backoff
+// grows exponentially with every busy response and is reset with the next
+// successful response. A Throttle is safe for concurrent use and is meant to
+// be shared by all clients of the same backend.
+type Throttle struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	mutex   sync.Mutex
+	backoff time.Duration
+	until   time.Time
+}
+
+// NewThrottle creates a new Throttle with default settings.
+func NewThrottle() *Throttle {
+	return &Throttle{
+		MinBackoff: DefaultThrottleMinBackoff,
+		MaxBackoff: DefaultThrottleMaxBackoff,
+	}
+}
+
+var sharedThrottles = struct {
+	sync.Mutex
+	m map[string]*Throttle
+}{
+	m: make(map[string]*Throttle),
+}
+
+// SharedThrottle returns the Throttle for the provided backend, creating it
+// with default settings if it does not exist yet.
+func SharedThrottle(backend string) *Throttle {
+	sharedThrottles.Lock()
+	defer sharedThrottles.Unlock()
+
+	throttle, ok := sharedThrottles.m[backend]
+	if !ok {
+		throttle = NewThrottle()
+		sharedThrottles.m[backend] = throttle
+	}
+
+	return throttle
+}
+
+// Wait blocks until the accociated Throttle allows the next request or the
+// provided context is done.
+func (t *Throttle) Wait(ctx context.Context) error {
+	t.mutex.Lock()
+	delay := time.Until(t.until)
+	t.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Backoff records a busy response of the backend and returns the delay until
+// the next request is allowed. The delay is at least the provided retryAfter
+// as requested by the backend.
+func (t *Throttle) Backoff(retryAfter time.Duration) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.backoff < t.MinBackoff {
+		t.backoff = t.MinBackoff
+	} else {
+		t.backoff *= 2
+	}
+	if t.backoff > t.MaxBackoff {
+		t.backoff = t.MaxBackoff
+	}
+
+	delay := t.backoff
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+	if until := time.Now().Add(delay); until.After(t.until) {
+		t.until = until
+	}
+
+	return delay
+}
+
+// Reset records a successful response of the backend, clearing the backoff.
+func (t *Throttle) Reset() {
+	t.mutex.Lock()
+	t.backoff = 0
+	t.mutex.Unlock()
+}
+
+// IsServerBusy returns true if the provided error signals that the server is
+// too busy to handle the request, together with the delay the server asked
+// for if any. Timeouts are not busy, since the request might have been
+// processed by the server.
+func IsServerBusy(err error) (bool, time.Duration) {
+	switch e := err.(type) {
+	case *HTTPStatusError:
+		if e.StatusCode == http.StatusServiceUnavailable || e.StatusCode == http.StatusTooManyRequests {
+			return true, e.RetryAfter
+		}
+	case KCError:
+		if e == KCERR_BUSY {
+			return true, 0
+		}
+	}
+
+	return false, 0
+}
+
+// A ThrottledSOAPClient wraps a SOAPClient, delaying and retrying requests
+// when the backend reports to be busy.
+type ThrottledSOAPClient struct {
+	Client     SOAPClient
+	Throttle   *Throttle
+	MaxRetries int
+}
+
+// NewThrottledSOAPClient creates a new ThrottledSOAPClient for the provided
+// client using the provided throttle. If throttle is nil, the shared Throttle
+// of the client's backend is used.
+func NewThrottledSOAPClient(client SOAPClient, throttle *Throttle) *ThrottledSOAPClient {
+	if throttle == nil {
+		throttle = SharedThrottle(fmt.Sprintf("%s", client))
+	}
+
+	return &ThrottledSOAPClient{
+		Client:     client,
+		Throttle:   throttle,
+		MaxRetries: DefaultThrottleMaxRetries,
+	}
+}
+
+// DoRequest sends the provided payload data as SOAP through the means of the
+// accociated client. Busy responses, either by HTTP status or by the KC error
+// of the response, are retried after backing off up to MaxRetries times.
+func (tc *ThrottledSOAPClient) DoRequest(ctx context.Context, payload *string, v interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	for retry := 0; ; retry++ {
+		if err := tc.Throttle.Wait(ctx); err != nil {
+			return err
+		}
+
+		err := tc.Client.DoRequest(ctx, payload, v)
+		if err == nil {
+			err = responseKCError(v)
+		}
+		busy, retryAfter := IsServerBusy(err)
+		if !busy {
+			tc.Throttle.Reset()
+			if _, ok := err.(KCError); ok {
+				// NOTE(longsleep): MAPI errors are returned with the response.
+				return nil
+			}
+			return err
+		}
+
+		delay := tc.Throttle.Backoff(retryAfter)
+		if retry >= tc.MaxRetries {
+			if _, ok := err.(KCError); ok {
+				return nil
+			}
+			return err
+		}
+		if debug {
+			fmt.Printf("SOAP server busy (%v), retrying in %v\n", err, delay)
+		}
+		resetResponse(v)
+	}
+}
+
+func (tc *ThrottledSOAPClient) String() string {
+	return fmt.Sprintf("%s", tc.Client)
+}
+
+// responseKCError returns the KC error of the provided response struct, or nil
+// if the response has no error.
+func responseKCError(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	field := rv.Elem().FieldByName("Er")
+	if !field.IsValid() {
+		return nil
+	}
+	if er, ok := field.Interface().(KCError); ok && er != KCSuccess {
+		return er
+	}
+
+	return nil
+}
+
+// resetResponse zeroes the provided response struct, so it can be decoded
+// into again. Streaming responses keep their callback.
+func resetResponse(v interface{}) {
+	if sd, ok := v.(soapStreamDecoder); ok {
+		sd.reset()
+		return
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+	}
+}
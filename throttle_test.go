@@ -0,0 +1,105 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestThrottledSOAPClient(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			rw.Header().Set("Retry-After", "0")
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			rw.Write([]byte(soapHeader + "<ns:logoffResponse><er>" + strconv.FormatUint(uint64(KCERR_BUSY), 10) + "</er></ns:logoffResponse>" + soapFooter))
+		default:
+			rw.Write([]byte(soapHeader + "<ns:logoffResponse><er>0</er></ns:logoffResponse>" + soapFooter))
+		}
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	throttle := &Throttle{
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+	}
+	c := NewKCCWithClient(NewThrottledSOAPClient(client, throttle))
+
+	resp, err := c.Logoff(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Er != KCSuccess {
+		t.Errorf("unexpected error: %v", resp.Er)
+	}
+	if requests != 3 {
+		t.Errorf("unexpected number of requests: %d", requests)
+	}
+	if throttle.backoff != 0 {
+		t.Errorf("backoff not reset: %v", throttle.backoff)
+	}
+}
+
+func TestThrottledSOAPClientTimeoutNotRetried(t *testing.T) {
+	for _, er := range []KCError{KCERR_TIMEOUT, KCERR_SERVER_NOT_RESPONDING} {
+		var requests int
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			requests++
+			rw.Write([]byte(soapHeader + "<ns:logoffResponse><er>" + strconv.FormatUint(uint64(er), 10) + "</er></ns:logoffResponse>" + soapFooter))
+		}))
+
+		uri, _ := url.Parse(srv.URL)
+		client, err := NewSOAPHTTPClient(uri, srv.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		throttle := &Throttle{
+			MinBackoff: time.Millisecond,
+			MaxBackoff: 10 * time.Millisecond,
+		}
+		c := NewKCCWithClient(NewThrottledSOAPClient(client, throttle))
+
+		resp, err := c.Logoff(context.Background(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Er != er {
+			t.Errorf("unexpected error: got %v want %v", resp.Er, er)
+		}
+		if requests != 1 {
+			t.Errorf("unexpected number of requests for %v: %d", er, requests)
+		}
+		if throttle.backoff != 0 {
+			t.Errorf("unexpected backoff for %v: %v", er, throttle.backoff)
+		}
+		srv.Close()
+	}
+}
@@ -18,6 +18,9 @@ package kcc
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
 )
 
 // SetX509KeyPairToTLSConfig reads and parses a public/private key pair from a
@@ -37,3 +40,44 @@ func SetX509KeyPairToTLSConfig(certFile, keyFile string, config *tls.Config) (*t
 
 	return config, nil
 }
+
+// SetRootCAsToTLSConfig reads PEM encoded x509 certificates from the provided
+// file and sets them as root CAs to the provided TLS config, replacing the
+// system roots. Use it to connect to servers with certificates issued by a
+// private CA. If the provided TLS config is nil, a new empty one will be
+// created and returned.
+func SetRootCAsToTLSConfig(caFile string, config *tls.Config) (*tls.Config, error) {
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return config, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(pem) {
+		return config, errors.New("no certificates found")
+	}
+
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config.RootCAs = roots
+
+	return config, nil
+}
+
+// SetTLSSessionCacheToTLSConfig sets a new LRU session cache holding up to
+// size TLS sessions to the provided TLS config, so connections can resume
+// previous sessions with session tickets instead of doing full handshakes. A
+// size of 0 or less removes the session cache, disabling resumption. If the
+// provided TLS config is nil, a new empty one will be created and returned.
+func SetTLSSessionCacheToTLSConfig(size int, config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if size > 0 {
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(size)
+	} else {
+		config.ClientSessionCache = nil
+	}
+
+	return config
+}
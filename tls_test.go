@@ -0,0 +1,120 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetTLSSessionCacheToTLSConfig(t *testing.T) {
+	config := SetTLSSessionCacheToTLSConfig(8, nil)
+	if config == nil || config.ClientSessionCache == nil {
+		t.Fatal("expected TLS config with session cache")
+	}
+
+	if SetTLSSessionCacheToTLSConfig(0, config) != config || config.ClientSessionCache != nil {
+		t.Error("expected session cache to be removed")
+	}
+}
+
+func TestHTTPClientTLSSessionResumption(t *testing.T) {
+	var resumed []bool
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		resumed = append(resumed, req.TLS.DidResume)
+	}))
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	tlsConfig := SetTLSSessionCacheToTLSConfig(8, nil)
+	tlsConfig.RootCAs = roots
+
+	client := NewHTTPClient(tlsConfig)
+	// Force a new connection for every request.
+	client.Transport.(*http.Transport).DisableKeepAlives = true
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	if len(resumed) != 2 || resumed[0] || !resumed[1] {
+		t.Errorf("expected second connection to resume the TLS session: %v", resumed)
+	}
+}
+
+func TestSOAPClientConfigTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Write([]byte(soapHeader + "<ns:resolveUserResponse><er>0</er><sUserId>user1-id</sUserId></ns:resolveUserResponse>" + soapFooter))
+	}))
+	defer srv.Close()
+
+	f, err := ioutil.TempFile("", "kcc-go-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	pem.Encode(f, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	f.Close()
+
+	// The test certificate is not valid for localhost, so the server name
+	// must be overridden.
+	uri, _ := url.Parse(strings.Replace(srv.URL, "127.0.0.1", "localhost", 1))
+
+	client, err := NewSOAPClient(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewKCCWithClient(client).ResolveUsername(context.Background(), "user1", 1); err == nil {
+		t.Fatal("expected default client to fail certificate validation")
+	}
+
+	tlsConfig, err := SetRootCAsToTLSConfig(f.Name(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig.ServerName = "example.com"
+	client, err = NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		TLSConfig: tlsConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := NewKCCWithClient(client).ResolveUsername(context.Background(), "user1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.UserEntryID != "user1-id" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+	if DefaultHTTPClient.Transport.(*http.Transport).TLSClientConfig == tlsConfig {
+		t.Error("default HTTP client was modified")
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"net/http"
+)
+
+// A Tracer starts spans of a distributed tracing system, like OpenTelemetry.
+// Implementations must be safe for concurrent use. See TracingMiddleware.
+type Tracer interface {
+	// StartSpan starts a span with the provided name as child of the span of
+	// the provided context and returns a copy of the context with the new
+	// span.
+	StartSpan(ctx context.Context, name string) (context.Context, TraceSpan)
+	// Inject adds the headers which propagate the span of the provided
+	// context, like traceparent, to the provided headers.
+	Inject(ctx context.Context, headers http.Header)
+	// Extract returns a copy of the provided context with the remote span
+	// propagated with the provided headers, if any.
+	Extract(ctx context.Context, headers http.Header) context.Context
+}
+
+// A TraceSpan is a span started by a Tracer.
+type TraceSpan interface {
+	// SetAttribute sets the attribute with the provided key to the provided
+	// value.
+	SetAttribute(key, value string)
+	// End ends the span, marking it as failed if the provided error is not
+	// nil.
+	End(err error)
+}
+
+// Attributes set on spans of SOAP requests.
+const (
+	traceAttributeSystem = "rpc.system"
+	traceAttributeMethod = "rpc.method"
+	traceAttributeTarget = "kcc.target"
+	traceAttributeStatus = "kcc.status"
+	traceAttributeCode   = "kcc.error_code"
+)
+
+// traceStatusOK and traceStatusCanceled are the kcc.status attributes of spans
+// of successful and canceled requests. Failed requests have the class of their
+// error, see ClassifyBackendError.
+const (
+	traceStatusOK       = "ok"
+	traceStatusCanceled = "canceled"
+)
+
+// TracingMiddleware returns a SOAPMiddleware which wraps every request in a
+// span of the provided tracer, named kcc.soap:<action> after the SOAP action.
+// Spans carry the action, the provided target URI of the client, the status
+// and the error code of failed requests. A KC error of the response fails the
+// span like an error of the request. The span is propagated to the Kopano
+// server with the HTTP headers of the tracer, which socket clients do not
+// send. Since retries happen within the middleware, a span covers all
+// attempts of a request.
+func TracingMiddleware(tracer Tracer, target string) SOAPMiddleware {
+	return func(next SOAPRoundTrip) SOAPRoundTrip {
+		return func(ctx context.Context, payload *string, v interface{}) error {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			action := soapAction(*payload)
+
+			ctx, span := tracer.StartSpan(ctx, "kcc.soap:"+action)
+			span.SetAttribute(traceAttributeSystem, "soap")
+			span.SetAttribute(traceAttributeMethod, action)
+			if target != "" {
+				span.SetAttribute(traceAttributeTarget, target)
+			}
+
+			headers := make(http.Header)
+			tracer.Inject(ctx, headers)
+			if len(headers) > 0 {
+				ctx = WithHTTPHeaders(ctx, headers)
+			}
+
+			err := next(ctx, payload, v)
+
+			spanErr := err
+			if spanErr == nil {
+				spanErr = responseKCError(v)
+			}
+			switch {
+			case spanErr == nil:
+				span.SetAttribute(traceAttributeStatus, traceStatusOK)
+			case err != nil && ctx.Err() != nil:
+				span.SetAttribute(traceAttributeStatus, traceStatusCanceled)
+			default:
+				class, code := ClassifyBackendError(spanErr)
+				span.SetAttribute(traceAttributeStatus, string(class))
+				if code != "" {
+					span.SetAttribute(traceAttributeCode, code)
+				}
+			}
+			span.End(spanErr)
+
+			return err
+		}
+	}
+}
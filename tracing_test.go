@@ -0,0 +1,153 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+type testSpanKey struct{}
+
+type testSpan struct {
+	name       string
+	parent     *testSpan
+	attributes map[string]string
+	ended      bool
+	err        error
+}
+
+func (span *testSpan) SetAttribute(key, value string) {
+	span.attributes[key] = value
+}
+
+func (span *testSpan) End(err error) {
+	span.ended = true
+	span.err = err
+}
+
+type testTracer struct {
+	mutex sync.Mutex
+	spans []*testSpan
+}
+
+func (tracer *testTracer) StartSpan(ctx context.Context, name string) (context.Context, TraceSpan) {
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	span := &testSpan{
+		name:       name,
+		parent:     parent,
+		attributes: make(map[string]string),
+	}
+	tracer.mutex.Lock()
+	tracer.spans = append(tracer.spans, span)
+	tracer.mutex.Unlock()
+
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func (tracer *testTracer) Inject(ctx context.Context, headers http.Header) {
+	if span, _ := ctx.Value(testSpanKey{}).(*testSpan); span != nil {
+		headers.Set("Traceparent", span.name)
+	}
+}
+
+func (tracer *testTracer) Extract(ctx context.Context, headers http.Header) context.Context {
+	return ctx
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	var traceparent string
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("Traceparent")
+		requests++
+		er := "0"
+		if requests > 1 {
+			er = "2147483650"
+		}
+		rw.Write([]byte(soapHeader + "<ns:logoffResponse><er>" + er + "</er></ns:logoffResponse>" + soapFooter))
+	}))
+	defer srv.Close()
+
+	tracer := &testTracer{}
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		HTTPClient: srv.Client(),
+		Tracer:     tracer,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewKCCWithClient(client)
+
+	parent := &testSpan{name: "parent"}
+	ctx := context.WithValue(context.Background(), testSpanKey{}, parent)
+	if _, err = c.Logoff(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Logoff(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(tracer.spans))
+	}
+	if traceparent != "kcc.soap:logoff" {
+		t.Errorf("expected span to be propagated, got %q", traceparent)
+	}
+	for idx, span := range tracer.spans {
+		if span.name != "kcc.soap:logoff" || span.parent != parent || !span.ended {
+			t.Errorf("unexpected span %d: %+v", idx, span)
+		}
+		for key, expected := range map[string]string{
+			"rpc.system": "soap",
+			"rpc.method": "logoff",
+			"kcc.target": srv.URL,
+		} {
+			if value := span.attributes[key]; value != expected {
+				t.Errorf("expected span %d attribute %s %q, got %q", idx, key, expected, value)
+			}
+		}
+	}
+	if span := tracer.spans[0]; span.err != nil || span.attributes["kcc.status"] != "ok" {
+		t.Errorf("unexpected successful span: %+v", span)
+	}
+	if span := tracer.spans[1]; span.err != KCERR_NOT_FOUND || span.attributes["kcc.status"] != "not_found" || span.attributes["kcc.error_code"] != "KC:0x80000002" {
+		t.Errorf("unexpected failed span: %+v", span)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	failing := TracingMiddleware(tracer, "")(func(ctx context.Context, payload *string, v interface{}) error {
+		return errors.New("canceled")
+	})
+	payload := "<ns:logoff><ulSessionId>1</ulSessionId></ns:logoff>"
+	if err = failing(canceled, &payload, &LogoffResponse{}); err == nil {
+		t.Fatal("expected error")
+	}
+	if span := tracer.spans[2]; span.attributes["kcc.status"] != "canceled" || span.err == nil {
+		t.Errorf("unexpected canceled span: %+v", span)
+	}
+	if _, ok := tracer.spans[2].attributes["kcc.target"]; ok {
+		t.Errorf("expected no target without target")
+	}
+}
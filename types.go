@@ -30,5 +30,27 @@ func (mt MAPIType) String() string {
 // Possibe type values as defined in mapi4linux/include/mapidefs.h. We
 // only define the ones know and understood by kcc-go.
 const (
+	MAPI_STORE    MAPIType = 0x00000001
+	MAPI_ADDRBOOK MAPIType = 0x00000002
+	MAPI_FOLDER   MAPIType = 0x00000003
+	MAPI_ABCONT   MAPIType = 0x00000004
+	MAPI_MESSAGE  MAPIType = 0x00000005
 	MAPI_MAILUSER MAPIType = 0x00000006
+	MAPI_ATTACH   MAPIType = 0x00000007
+	MAPI_DISTLIST MAPIType = 0x00000008
+)
+
+// RecipientType is the type representing MAPI recipient types.
+type RecipientType uint64
+
+func (rt RecipientType) String() string {
+	return strconv.FormatUint(uint64(rt), 10)
+}
+
+// Recipient type values as defined in mapi4linux/include/mapidefs.h.
+const (
+	MAPI_ORIG RecipientType = 0
+	MAPI_TO   RecipientType = 1
+	MAPI_CC   RecipientType = 2
+	MAPI_BCC  RecipientType = 3
 )
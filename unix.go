@@ -17,7 +17,12 @@
 package kcc
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"os"
+	"strconv"
+	"sync"
 	"time"
 )
 
@@ -27,6 +32,159 @@ var DefaultUnixDialer = &net.Dialer{
 	Timeout: 10 * time.Second,
 }
 
+// DefaultTCPPort is the port of the plain gsoap listener of Kopano server,
+// used by SOAP socket clients for tcp:// URIs without port.
+var DefaultTCPPort = "236"
+
 // DefaultUnixMaxConnections is the default maximum number of connections which
 // will be created to handle parallel SOAP requests to Unix sockets.
 var DefaultUnixMaxConnections = 20
+
+// DefaultSocketPeerOwner is the expected owner of the process serving the
+// Unix socket of new SOAP socket clients. If nil, the owner is not checked.
+var DefaultSocketPeerOwner *SocketPeerOwner
+
+func init() {
+	uid, gid := -1, -1
+	if s := os.Getenv("KCC_GO_SOCKET_PEER_UID"); s != "" {
+		if n, err := strconv.ParseInt(s, 10, 0); err == nil {
+			uid = int(n)
+		}
+	}
+	if s := os.Getenv("KCC_GO_SOCKET_PEER_GID"); s != "" {
+		if n, err := strconv.ParseInt(s, 10, 0); err == nil {
+			gid = int(n)
+		}
+	}
+	if uid >= 0 || gid >= 0 {
+		DefaultSocketPeerOwner = &SocketPeerOwner{
+			UID: uid,
+			GID: gid,
+		}
+	}
+}
+
+// A SocketPeerOwner is the expected user and group of the process serving a
+// Unix socket. A negative UID or GID matches any user or group.
+type SocketPeerOwner struct {
+	UID int
+	GID int
+}
+
+// A SocketPeerCredentials holds the credentials of the process at the other
+// end of a Unix socket connection.
+type SocketPeerCredentials struct {
+	PID int
+	UID int
+	GID int
+}
+
+// A SocketPeerError is returned when the process serving a Unix socket is not
+// owned by the expected user or group, which can mean that another process
+// took over the socket path.
+type SocketPeerError struct {
+	Path     string
+	Expected SocketPeerOwner
+	Peer     SocketPeerCredentials
+}
+
+func (err *SocketPeerError) Error() string {
+	return fmt.Sprintf("unix socket %s is served by an unexpected process (pid %d uid %d gid %d), expected uid %d gid %d", err.Path, err.Peer.PID, err.Peer.UID, err.Peer.GID, err.Expected.UID, err.Expected.GID)
+}
+
+// checkSocketPeer checks the credentials of the peer of the provided Unix
+// socket connection against the provided expected owner.
+func checkSocketPeer(conn net.Conn, path string, owner *SocketPeerOwner) error {
+	cred, err := socketPeerCredentials(conn)
+	if err != nil {
+		return fmt.Errorf("failed to get peer credentials of unix socket %s: %v", path, err)
+	}
+	if (owner.UID >= 0 && cred.UID != owner.UID) || (owner.GID >= 0 && cred.GID != owner.GID) {
+		return &SocketPeerError{
+			Path:     path,
+			Expected: *owner,
+			Peer:     *cred,
+		}
+	}
+
+	return nil
+}
+
+// socketDeadline returns the deadline for reads and writes of a socket request
+// with the provided context, which is the provided timeout from now or the
+// deadline of the provided context if it is earlier. The zero time means no
+// deadline.
+func socketDeadline(ctx context.Context, timeout time.Duration) time.Time {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if ctx != nil {
+		if ctxDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+			deadline = ctxDeadline
+		}
+	}
+
+	return deadline
+}
+
+// socketContextErr returns the error of the provided context if it is done or
+// its deadline has passed, so reads and writes failing with a deadline derived
+// from it are reported with the error of the context.
+func socketContextErr(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+
+	return nil
+}
+
+// interruptOnDone interrupts pending reads and writes of the provided
+// connection when the provided context is done. The returned function stops
+// watching the context, check socketContextErr afterwards to find out if the
+// connection might have been interrupted and must not be reused.
+func interruptOnDone(ctx context.Context, c net.Conn) func() {
+	return interruptWithDeadline(ctx, c.SetDeadline)
+}
+
+// interruptReadOnDone is like interruptOnDone, but only interrupts reads, so
+// writes of others sharing the connection are not affected.
+func interruptReadOnDone(ctx context.Context, c net.Conn) func() {
+	return interruptWithDeadline(ctx, c.SetReadDeadline)
+}
+
+// interruptWithDeadline calls the provided deadline setter with a deadline in
+// the past when the provided context is done. The returned function stops
+// watching the context.
+func interruptWithDeadline(ctx context.Context, setDeadline func(time.Time) error) func() {
+	if ctx == nil || ctx.Done() == nil {
+		return func() {}
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		select {
+		case <-ctx.Done():
+			// NOTE(longsleep): A deadline in the past makes all pending and
+			// future reads and writes fail instantly.
+			setDeadline(time.Unix(1, 0))
+		case <-stopCh:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopCh)
+			<-doneCh
+		})
+	}
+}
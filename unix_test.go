@@ -0,0 +1,198 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSOAPSocketClientContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kcc-go-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "server.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			// Never respond, so requests only end with their context.
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go ioutil.ReadAll(conn)
+		}
+	}()
+
+	sc, err := NewSOAPSocketClient(&url.URL{Scheme: "file", Path: path}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.RetryPolicy = &RetryPolicy{MaxAttempts: 1}
+	metrics := NewSOAPMetrics()
+	sc.Metrics = metrics
+	payload := "<ns:logon></ns:logon>"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err = sc.DoRequest(ctx, &payload, &struct{}{})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("request did not honor context deadline, took %v", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	err = sc.DoRequest(ctx, &payload, &struct{}{})
+	if err != context.Canceled {
+		t.Errorf("expected canceled, got %v", err)
+	}
+	if open := metrics.pools[path].Open; open != 0 {
+		t.Errorf("expected interrupted connections to be removed from pool, got %d", open)
+	}
+}
+
+func TestSOAPSocketClientTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	accepted := make(chan bool, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- true
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					// Read raw envelopes, respond with HTTP like gsoap.
+					request, err := r.ReadString('>')
+					for err == nil && !strings.HasSuffix(request, soapFooter) {
+						var more string
+						more, err = r.ReadString('>')
+						request += more
+					}
+					if err != nil {
+						return
+					}
+					body := soapHeader + "<ns:resolveUserResponse><er>0</er><sUserId>user1-id</sUserId></ns:resolveUserResponse>" + soapFooter
+					fmt.Fprintf(conn, "HTTP/1.1 200 OK\r\nConnection: keep-alive\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+				}
+			}()
+		}
+	}()
+
+	uri, _ := url.Parse("tcp://" + listener.Addr().String())
+	client, err := NewSOAPClient(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := client.(*SOAPSocketClient).String(); s != "<tcp:"+listener.Addr().String()+">" {
+		t.Errorf("unexpected client string: %s", s)
+	}
+	c := NewKCCWithClient(client)
+	for i := 0; i < 3; i++ {
+		resp, err := c.ResolveUsername(context.Background(), "user1", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.UserEntryID != "user1-id" {
+			t.Errorf("unexpected response: %+v", resp)
+		}
+	}
+	if len(accepted) != 1 {
+		t.Errorf("expected pooled connection to be reused, got %d connections", len(accepted))
+	}
+
+	uri, _ = url.Parse("tcp://127.0.0.1")
+	sc, err := NewSOAPSocketClient(uri, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Path != "127.0.0.1:"+DefaultTCPPort {
+		t.Errorf("expected default port, got %s", sc.Path)
+	}
+}
+
+func TestSOAPSocketClientTimeouts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			// Never respond, so requests end with the read timeout.
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go ioutil.ReadAll(conn)
+		}
+	}()
+
+	uri, _ := url.Parse("tcp://" + listener.Addr().String())
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		SocketDialTimeout: time.Second,
+		SocketReadTimeout: 100 * time.Millisecond,
+		RetryPolicy:       &RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := client.(*SOAPSocketClient)
+	if sc.Dialer.Timeout != time.Second || DefaultUnixDialer.Timeout != 10*time.Second {
+		t.Errorf("unexpected dialer timeouts: %v, default %v", sc.Dialer.Timeout, DefaultUnixDialer.Timeout)
+	}
+	if sc.dialTimeout() != time.Second || sc.writeTimeout() != time.Second || sc.readTimeout() != 100*time.Millisecond {
+		t.Errorf("unexpected timeouts: dial %v, write %v, read %v", sc.dialTimeout(), sc.writeTimeout(), sc.readTimeout())
+	}
+
+	payload := "<ns:logon></ns:logon>"
+	started := time.Now()
+	err = sc.DoRequest(context.Background(), &payload, &struct{}{})
+	if err == nil || !strings.Contains(err.Error(), "i/o timeout") {
+		t.Errorf("expected read timeout, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("request did not honor read timeout, took %v", elapsed)
+	}
+}
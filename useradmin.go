@@ -0,0 +1,207 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// A Quota holds the store size limits of a user in bytes.
+type Quota struct {
+	UseDefaultQuota    bool  `json:"useDefaultQuota"`
+	IsUserDefaultQuota bool  `json:"isUserDefaultQuota"`
+	WarnSize           int64 `json:"warnSize"`
+	SoftSize           int64 `json:"softSize"`
+	HardSize           int64 `json:"hardSize"`
+}
+
+// writeUser writes the provided user as SOAP user struct with the provided
+// name. Empty strings are left out, so the server keeps their current values
+// when updating. An empty password keeps the current password.
+func writeUser(b *strings.Builder, name string, user *User, password string) {
+	objClass := user.ObjClass
+	if objClass == 0 {
+		objClass = ACTIVE_USER
+		if user.IsNonActive != 0 {
+			objClass = NONACTIVE_USER
+		}
+	}
+
+	b.WriteString("<")
+	b.WriteString(name)
+	b.WriteString("><ulUserId>")
+	b.WriteString(strconv.FormatUint(user.ID, 10))
+	b.WriteString("</ulUserId>")
+	writeOptionalString(b, "lpszUsername", user.Username)
+	writeOptionalString(b, "lpszPassword", password)
+	writeOptionalString(b, "lpszMailAddress", user.MailAddress)
+	writeOptionalString(b, "lpszFullName", user.FullName)
+	b.WriteString("<ulIsNonActive>")
+	b.WriteString(strconv.FormatUint(user.IsNonActive, 10))
+	b.WriteString("</ulIsNonActive><ulIsAdmin>")
+	b.WriteString(strconv.FormatUint(user.IsAdmin, 10))
+	b.WriteString("</ulIsAdmin><ulIsABHidden>")
+	b.WriteString(strconv.FormatUint(user.IsABHidden, 10))
+	b.WriteString("</ulIsABHidden><ulCapacity>")
+	b.WriteString(strconv.FormatUint(user.Capacity, 10))
+	b.WriteString("</ulCapacity><ulObjClass>")
+	b.WriteString(objClass.String())
+	b.WriteString("</ulObjClass>")
+	writePropMaps(b, user.Props, user.MVProps)
+	b.WriteString("<sUserId>")
+	b.WriteString(xmlCharData(user.UserEntryID).Escape())
+	b.WriteString("</sUserId></")
+	b.WriteString(name)
+	b.WriteString(">")
+}
+
+// writePropMaps writes the provided property maps as SOAP lpsPropmap and
+// lpsMVPropmap elements, leaving out nil maps.
+func writePropMaps(b *strings.Builder, props *PropMap, mvProps *MVPropMap) {
+	if props != nil {
+		b.WriteString("<lpsPropmap>")
+		for _, value := range *props {
+			b.WriteString("<item><ulPropId>")
+			b.WriteString(value.ID.String())
+			b.WriteString("</ulPropId><lpszValue>")
+			b.WriteString(xmlCharData(value.StringValue).Escape())
+			b.WriteString("</lpszValue></item>")
+		}
+		b.WriteString("</lpsPropmap>")
+	}
+	if mvProps != nil {
+		b.WriteString("<lpsMVPropmap>")
+		for _, value := range *mvProps {
+			b.WriteString("<item><ulPropId>")
+			b.WriteString(value.ID.String())
+			b.WriteString("</ulPropId><sValues>")
+			for _, s := range value.StringValues {
+				b.WriteString("<item>")
+				b.WriteString(xmlCharData(s).Escape())
+				b.WriteString("</item>")
+			}
+			b.WriteString("</sValues></item>")
+		}
+		b.WriteString("</lpsMVPropmap>")
+	}
+}
+
+func writeOptionalString(b *strings.Builder, name string, value string) {
+	if value == "" {
+		return
+	}
+	b.WriteString("<")
+	b.WriteString(name)
+	b.WriteString(">")
+	b.WriteString(xmlCharData(value).Escape())
+	b.WriteString("</")
+	b.WriteString(name)
+	b.WriteString(">")
+}
+
+// CreateUser creates a new user with the details of the provided user and
+// the provided password using the provided session. The ID and Entry ID of
+// the provided user are ignored.
+func (c *KCC) CreateUser(ctx context.Context, user *User, password string, sessionID KCSessionID) (*CreateUserResponse, error) {
+	create := *user
+	create.ID = 0
+	create.UserEntryID = ""
+
+	var b strings.Builder
+	b.WriteString("<ns:createUser><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId>")
+	writeUser(&b, "lpsUser", &create, password)
+	b.WriteString("</ns:createUser>")
+	payload := b.String()
+
+	var createUserResponse CreateUserResponse
+	err := c.Client.DoRequest(ctx, &payload, &createUserResponse)
+
+	return &createUserResponse, err
+}
+
+// SetUser updates the user identified by the provided user's Entry ID with
+// the details of the provided user using the provided session. An empty
+// password keeps the current password. Update a user as fetched with GetUser,
+// as all other values are set as given.
+func (c *KCC) SetUser(ctx context.Context, user *User, password string, sessionID KCSessionID) (*UserAdminResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:setUser><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId>")
+	writeUser(&b, "lpsUser", user, password)
+	b.WriteString("</ns:setUser>")
+	payload := b.String()
+
+	var setUserResponse UserAdminResponse
+	err := c.Client.DoRequest(ctx, &payload, &setUserResponse)
+	if err == nil && setUserResponse.Er == KCSuccess {
+		c.invalidate(user.UserEntryID)
+	}
+
+	return &setUserResponse, err
+}
+
+// DeleteUser deletes the user with the provided Entry ID using the provided
+// session.
+func (c *KCC) DeleteUser(ctx context.Context, userEntryID string, sessionID KCSessionID) (*UserAdminResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:deleteUser><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><ulUserId>0</ulUserId><sUserId>")
+	b.WriteString(xmlCharData(userEntryID).Escape())
+	b.WriteString("</sUserId></ns:deleteUser>")
+	payload := b.String()
+
+	var deleteUserResponse UserAdminResponse
+	err := c.Client.DoRequest(ctx, &payload, &deleteUserResponse)
+	if err == nil && deleteUserResponse.Er == KCSuccess {
+		c.invalidate(userEntryID)
+	}
+
+	return &deleteUserResponse, err
+}
+
+// SetQuota sets the quota of the user with the provided Entry ID using the
+// provided session.
+func (c *KCC) SetQuota(ctx context.Context, userEntryID string, quota *Quota, sessionID KCSessionID) (*UserAdminResponse, error) {
+	var b strings.Builder
+	b.WriteString("<ns:setQuota><ulSessionId>")
+	b.WriteString(sessionID.String())
+	b.WriteString("</ulSessionId><ulUserid>0</ulUserid><sUserId>")
+	b.WriteString(xmlCharData(userEntryID).Escape())
+	b.WriteString("</sUserId><lpsQuota><bUseDefaultQuota>")
+	b.WriteString(strconv.FormatBool(quota.UseDefaultQuota))
+	b.WriteString("</bUseDefaultQuota><bIsUserDefaultQuota>")
+	b.WriteString(strconv.FormatBool(quota.IsUserDefaultQuota))
+	b.WriteString("</bIsUserDefaultQuota><llWarnSize>")
+	b.WriteString(strconv.FormatInt(quota.WarnSize, 10))
+	b.WriteString("</llWarnSize><llSoftSize>")
+	b.WriteString(strconv.FormatInt(quota.SoftSize, 10))
+	b.WriteString("</llSoftSize><llHardSize>")
+	b.WriteString(strconv.FormatInt(quota.HardSize, 10))
+	b.WriteString("</llHardSize></lpsQuota></ns:setQuota>")
+	payload := b.String()
+
+	var setQuotaResponse UserAdminResponse
+	err := c.Client.DoRequest(ctx, &payload, &setQuotaResponse)
+
+	return &setQuotaResponse, err
+}
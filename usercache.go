@@ -0,0 +1,217 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A UserCache caches user records by username for the provided TTL. Cached
+// users are dropped when a matching Invalidation is published on the
+// InvalidationBus the cache subscribed to. The cache counts lookups per
+// username, so the most requested users can be preloaded after a restart. A
+// UserCache is safe for concurrent use.
+type UserCache struct {
+	ttl time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*userCacheEntry
+	lookups map[string]uint64
+
+	unsubscribe func()
+}
+
+type userCacheEntry struct {
+	user    *User
+	expires time.Time
+}
+
+// NewUserCache creates a new UserCache keeping users for the provided TTL,
+// subscribed to the provided InvalidationBus. If bus is nil,
+// DefaultInvalidationBus is used.
+func NewUserCache(ttl time.Duration, bus *InvalidationBus) *UserCache {
+	if bus == nil {
+		bus = DefaultInvalidationBus
+	}
+
+	uc := &UserCache{
+		ttl: ttl,
+
+		entries: make(map[string]*userCacheEntry),
+		lookups: make(map[string]uint64),
+	}
+	uc.unsubscribe = bus.Subscribe(uc.invalidate)
+
+	return uc
+}
+
+// Get returns the cached user of the provided username and counts the
+// lookup. The second return value is false if the user is not cached or
+// expired.
+func (uc *UserCache) Get(username string) (*User, bool) {
+	uc.mutex.Lock()
+	defer uc.mutex.Unlock()
+
+	uc.lookups[username]++
+	entry, ok := uc.entries[username]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(uc.entries, username)
+		return nil, false
+	}
+
+	return entry.user, true
+}
+
+// Set caches the provided user for the provided username.
+func (uc *UserCache) Set(username string, user *User) {
+	uc.mutex.Lock()
+	uc.entries[username] = &userCacheEntry{
+		user:    user,
+		expires: time.Now().Add(uc.ttl),
+	}
+	uc.mutex.Unlock()
+}
+
+// Len returns the number of cached users of the accociated UserCache,
+// including expired ones which were not dropped yet.
+func (uc *UserCache) Len() int {
+	uc.mutex.Lock()
+	defer uc.mutex.Unlock()
+
+	return len(uc.entries)
+}
+
+// Purge drops the expired users of the accociated UserCache and returns how
+// many were dropped. Expired users are otherwise only dropped when they are
+// looked up again.
+func (uc *UserCache) Purge() int {
+	uc.mutex.Lock()
+	defer uc.mutex.Unlock()
+
+	now := time.Now()
+	purged := 0
+	for username, entry := range uc.entries {
+		if now.After(entry.expires) {
+			delete(uc.entries, username)
+			purged++
+		}
+	}
+
+	return purged
+}
+
+// Fetch resolves and gets the user of the provided username using the
+// provided client and session and caches it. MAPI errors are returned as
+// KCError.
+func (uc *UserCache) Fetch(ctx context.Context, c KopanoClient, username string, sessionID KCSessionID) (*User, error) {
+	resolve, err := c.ResolveUsername(ctx, username, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if resolve.Er != KCSuccess {
+		return nil, resolve.Er
+	}
+
+	response, err := c.GetUser(ctx, resolve.UserEntryID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if response.Er != KCSuccess {
+		return nil, response.Er
+	}
+
+	uc.Set(username, response.User)
+	return response.User, nil
+}
+
+// Preload fetches and caches the users of the provided usernames, so the
+// first requests after a start do not hit a cold cache. Preloading does not
+// count as lookups. Unknown users are skipped. It returns the number of
+// cached users and an error describing the failed ones.
+func (uc *UserCache) Preload(ctx context.Context, c KopanoClient, usernames []string, sessionID KCSessionID) (int, error) {
+	var loaded, failed int
+	var firstErr error
+	for _, username := range usernames {
+		if err := ctx.Err(); err != nil {
+			return loaded, err
+		}
+		if _, err := uc.Fetch(ctx, c, username, sessionID); err != nil {
+			if err == KCERR_NOT_FOUND {
+				continue
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+			continue
+		}
+		loaded++
+	}
+
+	if failed > 0 {
+		return loaded, fmt.Errorf("preload failed for %d of %d users: %v", failed, len(usernames), firstErr)
+	}
+	return loaded, nil
+}
+
+// TopUsers returns up to n usernames with the most lookups, most requested
+// first.
+func (uc *UserCache) TopUsers(n int) []string {
+	uc.mutex.Lock()
+	usernames := make([]string, 0, len(uc.lookups))
+	counts := make(map[string]uint64, len(uc.lookups))
+	for username, count := range uc.lookups {
+		usernames = append(usernames, username)
+		counts[username] = count
+	}
+	uc.mutex.Unlock()
+
+	sort.Slice(usernames, func(i, j int) bool {
+		if counts[usernames[i]] != counts[usernames[j]] {
+			return counts[usernames[i]] > counts[usernames[j]]
+		}
+		return usernames[i] < usernames[j]
+	})
+	if len(usernames) > n {
+		usernames = usernames[:n]
+	}
+	return usernames
+}
+
+// Close unsubscribes the accociated UserCache from its InvalidationBus.
+func (uc *UserCache) Close() {
+	uc.unsubscribe()
+}
+
+// invalidate drops the users matching the provided invalidation. The cache
+// does not know the server of its users, so the server GUID is not checked.
+func (uc *UserCache) invalidate(inv *Invalidation) {
+	uc.mutex.Lock()
+	for username, entry := range uc.entries {
+		if inv.EntryID == "" || inv.EntryID == entry.user.UserEntryID {
+			delete(uc.entries, username)
+		}
+	}
+	uc.mutex.Unlock()
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestUserCachePreload(t *testing.T) {
+	usernamePattern := regexp.MustCompile(`<lpszUsername>([^<]*)</lpszUsername>`)
+	userIDPattern := regexp.MustCompile(`<sUserId>([^<]*)</sUserId>`)
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		if match := usernamePattern.FindSubmatch(body); match != nil {
+			if string(match[1]) == "unknown" {
+				rw.Write([]byte(soapHeader + "<ns:resolveUserResponse><er>" + strconv.FormatUint(uint64(KCERR_NOT_FOUND), 10) + "</er></ns:resolveUserResponse>" + soapFooter))
+				return
+			}
+			rw.Write([]byte(soapHeader + "<ns:resolveUserResponse><er>0</er><sUserId>" + string(match[1]) + "-id</sUserId></ns:resolveUserResponse>" + soapFooter))
+			return
+		}
+		if match := userIDPattern.FindSubmatch(body); match != nil {
+			rw.Write([]byte(soapHeader + "<ns:getUserResponse><er>0</er><lpsUser><sUserId>" + string(match[1]) + "</sUserId></lpsUser></ns:getUserResponse>" + soapFooter))
+			return
+		}
+		rw.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	client, err := NewSOAPHTTPClient(uri, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := NewInvalidationBus()
+	uc := NewUserCache(time.Minute, bus)
+	defer uc.Close()
+
+	loaded, err := uc.Preload(context.Background(), NewKCCWithClient(client), []string{"user1", "unknown", "user2"}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded != 2 || uc.Len() != 2 {
+		t.Errorf("unexpected number of preloaded users: %d", loaded)
+	}
+	if user, ok := uc.Get("user1"); !ok || user.UserEntryID != "user1-id" {
+		t.Errorf("preloaded user not cached: %v", user)
+	}
+
+	bus.Publish(&Invalidation{EntryID: "user1-id"})
+	if _, ok := uc.Get("user1"); ok {
+		t.Errorf("invalidated user still cached")
+	}
+	for i := 0; i < 3; i++ {
+		uc.Get("user2")
+	}
+	if top := uc.TopUsers(1); !reflect.DeepEqual(top, []string{"user2"}) {
+		t.Errorf("unexpected top users: %v", top)
+	}
+}
+
+func TestUserCachePurge(t *testing.T) {
+	uc := NewUserCache(time.Minute, NewInvalidationBus())
+	defer uc.Close()
+
+	uc.Set("user1", &User{UserEntryID: "user1-id"})
+	uc.Set("user2", &User{UserEntryID: "user2-id"})
+	uc.entries["user1"].expires = time.Now().Add(-time.Second)
+
+	if purged := uc.Purge(); purged != 1 {
+		t.Errorf("expected 1 purged user, got %d", purged)
+	}
+	if uc.Len() != 1 {
+		t.Errorf("unexpected number of cached users: %d", uc.Len())
+	}
+	if _, ok := uc.Get("user2"); !ok {
+		t.Errorf("user which is not expired was purged")
+	}
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A UserDiff is a difference of a field or property between two users. Field
+// is the JSON name of the field of the User, PropID is set for differences of
+// its property maps. From and To hold the differing values, nil if the
+// property is missing on that side.
+type UserDiff struct {
+	Field  string      `json:"field"`
+	PropID PT          `json:"propId,omitempty"`
+	From   interface{} `json:"from"`
+	To     interface{} `json:"to"`
+}
+
+// String returns the accociated difference as a single line, prefixed with +
+// for added, - for removed and ~ for changed values.
+func (d *UserDiff) String() string {
+	field := d.Field
+	if d.PropID != 0 {
+		field = fmt.Sprintf("%s[0x%08X]", d.Field, uint64(d.PropID))
+	}
+
+	switch {
+	case d.From == nil:
+		return fmt.Sprintf("+ %s: %s", field, formatUserDiffValue(d.To))
+	case d.To == nil:
+		return fmt.Sprintf("- %s: %s", field, formatUserDiffValue(d.From))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", field, formatUserDiffValue(d.From), formatUserDiffValue(d.To))
+}
+
+// formatUserDiffValue returns the provided value of a UserDiff with strings
+// quoted.
+func formatUserDiffValue(value interface{}) string {
+	switch v := value.(type) {
+	case string, []string:
+		return fmt.Sprintf("%q", v)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// DiffUsers returns the differences of the provided users, going from the
+// first to the second. The IDs of the users are not compared, so the details
+// of different users can be compared as well. Property map differences are
+// ordered by property ID. Returns nil if there are no differences.
+func DiffUsers(from, to *User) []*UserDiff {
+	if from == nil {
+		from = &User{}
+	}
+	if to == nil {
+		to = &User{}
+	}
+
+	var diffs []*UserDiff
+	for _, field := range []struct {
+		name     string
+		from, to interface{}
+	}{
+		{"lpszUsername", from.Username, to.Username},
+		{"lpszMailAddress", from.MailAddress, to.MailAddress},
+		{"lpszFullName", from.FullName, to.FullName},
+		{"ulIsAdmin", from.IsAdmin, to.IsAdmin},
+		{"ulIsNonActive", from.IsNonActive, to.IsNonActive},
+	} {
+		if field.from != field.to {
+			diffs = append(diffs, &UserDiff{
+				Field: field.name,
+				From:  field.from,
+				To:    field.to,
+			})
+		}
+	}
+
+	fromProps, toProps := propMapValues(from.Props), propMapValues(to.Props)
+	ids := make(map[PT]bool)
+	for id := range fromProps {
+		ids[id] = true
+	}
+	for id := range toProps {
+		ids[id] = true
+	}
+	for _, id := range sortedPropIDs(ids) {
+		a, inFrom := fromProps[id]
+		b, inTo := toProps[id]
+		if inFrom && inTo && a == b {
+			continue
+		}
+		diff := &UserDiff{
+			Field:  "lpsPropmap",
+			PropID: id,
+		}
+		if inFrom {
+			diff.From = a
+		}
+		if inTo {
+			diff.To = b
+		}
+		diffs = append(diffs, diff)
+	}
+
+	fromMVProps, toMVProps := mvPropMapValues(from.MVProps), mvPropMapValues(to.MVProps)
+	ids = make(map[PT]bool)
+	for id := range fromMVProps {
+		ids[id] = true
+	}
+	for id := range toMVProps {
+		ids[id] = true
+	}
+	for _, id := range sortedPropIDs(ids) {
+		a, inFrom := fromMVProps[id]
+		b, inTo := toMVProps[id]
+		if inFrom && inTo && equalStrings(a, b) {
+			continue
+		}
+		diff := &UserDiff{
+			Field:  "lpsMVPropmap",
+			PropID: id,
+		}
+		if inFrom {
+			diff.From = a
+		}
+		if inTo {
+			diff.To = b
+		}
+		diffs = append(diffs, diff)
+	}
+
+	return diffs
+}
+
+// propMapValues returns the values of the provided PropMap by property ID.
+func propMapValues(pm *PropMap) map[PT]string {
+	values := make(map[PT]string)
+	if pm != nil {
+		for _, value := range *pm {
+			values[value.ID] = value.StringValue
+		}
+	}
+	return values
+}
+
+// mvPropMapValues returns the values of the provided MVPropMap by property
+// ID.
+func mvPropMapValues(pm *MVPropMap) map[PT][]string {
+	values := make(map[PT][]string)
+	if pm != nil {
+		for _, value := range *pm {
+			values[value.ID] = value.StringValues
+		}
+	}
+	return values
+}
+
+// sortedPropIDs returns the provided set of property IDs in ascending order.
+func sortedPropIDs(ids map[PT]bool) []PT {
+	sorted := make([]PT, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
+// equalStrings returns true if the provided string slices hold the same
+// values in the same order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"testing"
+)
+
+func TestDiffUsers(t *testing.T) {
+	from := &User{
+		ID:          1,
+		Username:    "user1",
+		FullName:    "User One",
+		MailAddress: "user1@example.org",
+		UserEntryID: "AAA",
+		Props: &PropMap{
+			{ID: 0x8001001E, StringValue: "kept"},
+			{ID: 0x8002001E, StringValue: "old"},
+			{ID: 0x8003001E, StringValue: "removed"},
+		},
+		MVProps: &MVPropMap{
+			{ID: 0x8004101E, StringValues: []string{"a", "b"}},
+		},
+	}
+	to := &User{
+		ID:          2,
+		Username:    "user1",
+		FullName:    "User 1",
+		MailAddress: "user1@example.org",
+		IsAdmin:     1,
+		UserEntryID: "BBB",
+		Props: &PropMap{
+			{ID: 0x8002001E, StringValue: "new"},
+			{ID: 0x8001001E, StringValue: "kept"},
+			{ID: 0x8005001E, StringValue: "added"},
+		},
+		MVProps: &MVPropMap{
+			{ID: 0x8004101E, StringValues: []string{"b", "a"}},
+		},
+	}
+
+	expected := []string{
+		`~ lpszFullName: "User One" -> "User 1"`,
+		`~ ulIsAdmin: 0 -> 1`,
+		`~ lpsPropmap[0x8002001E]: "old" -> "new"`,
+		`- lpsPropmap[0x8003001E]: "removed"`,
+		`+ lpsPropmap[0x8005001E]: "added"`,
+		`~ lpsMVPropmap[0x8004101E]: ["a" "b"] -> ["b" "a"]`,
+	}
+	diffs := DiffUsers(from, to)
+	if len(diffs) != len(expected) {
+		t.Fatalf("expected %d differences, got %v", len(expected), diffs)
+	}
+	for idx, d := range diffs {
+		if s := d.String(); s != expected[idx] {
+			t.Errorf("expected %s, got %s", expected[idx], s)
+		}
+	}
+
+	if diffs = DiffUsers(from, from); diffs != nil {
+		t.Errorf("expected no differences, got %v", diffs)
+	}
+	if diffs = DiffUsers(nil, &User{Username: "user1"}); len(diffs) != 1 || diffs[0].From != "" || diffs[0].To != "user1" {
+		t.Errorf("unexpected differences to nil user: %v", diffs)
+	}
+}
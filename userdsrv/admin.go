@@ -0,0 +1,233 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// purgeCacheFlags maps the names accepted by the purge cache endpoint to the
+// accociated flags.
+var purgeCacheFlags = map[string]kcc.KCFlag{
+	"quota":             kcc.PURGE_CACHE_QUOTA,
+	"quotadefault":      kcc.PURGE_CACHE_QUOTADEFAULT,
+	"objects":           kcc.PURGE_CACHE_OBJECTS,
+	"stores":            kcc.PURGE_CACHE_STORES,
+	"acl":               kcc.PURGE_CACHE_ACL,
+	"cell":              kcc.PURGE_CACHE_CELL,
+	"index1":            kcc.PURGE_CACHE_INDEX1,
+	"index2":            kcc.PURGE_CACHE_INDEX2,
+	"indexedproperties": kcc.PURGE_CACHE_INDEXEDPROPERTIES,
+	"userobject":        kcc.PURGE_CACHE_USEROBJECT,
+	"externid":          kcc.PURGE_CACHE_EXTERNID,
+	"userdetails":       kcc.PURGE_CACHE_USERDETAILS,
+	"server":            kcc.PURGE_CACHE_SERVER,
+	"all":               kcc.PURGE_CACHE_ALL,
+}
+
+// purgeCacheFlagNames returns the sorted names of purgeCacheFlags.
+func purgeCacheFlagNames() []string {
+	names := make([]string, 0, len(purgeCacheFlags))
+	for name := range purgeCacheFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+type adminResponse struct {
+	Er                uint64  `json:"er"`
+	DeferredRemaining *uint64 `json:"deferredRemaining,omitempty"`
+	UserID            *uint64 `json:"ulUserID,omitempty"`
+	UserEntryID       string  `json:"sUserId,omitempty"`
+
+	Features    []*kcc.FeatureStatus `json:"features,omitempty"`
+	Maintenance *bool                `json:"maintenance,omitempty"`
+}
+
+// withAdminSession wraps the provided handler, authenticating the request
+// with HTTP basic auth against the Kopano server. The handler is called with
+// a new session of the authenticated user, which is terminated when the
+// handler returns. Users with less than the provided admin level are rejected
+// before the handler is called, further permission checks are left to the
+// Kopano server.
+func (s *Server) withAdminSession(level kcc.AdminLevel, next func(http.ResponseWriter, *http.Request, kcc.KCSessionID)) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			rw.Header().Set("Allow", http.MethodPost)
+			s.problem(rw, req, http.StatusMethodNotAllowed, "")
+			return
+		}
+
+		username, password, ok := req.BasicAuth()
+		if !ok {
+			rw.Header().Set("WWW-Authenticate", "Basic realm=\"Kopano Admin\"")
+			s.problem(rw, req, http.StatusUnauthorized, "")
+			return
+		}
+
+		response, err := s.c.Logon(s.withClientInfo(req), username, password, 0)
+		if err != nil {
+			s.logger.WithError(err).Errorln("admin request logon failed")
+			s.problem(rw, req, http.StatusInternalServerError, "")
+			return
+		}
+		switch response.Er {
+		case kcc.KCSuccess:
+		case kcc.KCERR_LOGON_FAILED:
+			rw.Header().Set("WWW-Authenticate", "Basic realm=\"Kopano Admin\"")
+			s.problem(rw, req, http.StatusUnauthorized, "")
+			return
+		default:
+			s.logger.WithError(response.Er).Errorln("admin request logon mapi error")
+			s.errorProblem(rw, req, http.StatusInternalServerError, response.Er)
+			return
+		}
+		defer func() {
+			// Always log off, even when the request was canceled.
+			if _, logoffErr := s.c.Logoff(context.Background(), response.SessionID); logoffErr != nil {
+				s.logger.WithError(logoffErr).Warnln("admin request logoff failed")
+			}
+		}()
+
+		if err = kcc.RequireAdminLevel(req.Context(), s.c, response.SessionID, level); err != nil {
+			if levelErr, ok := err.(*kcc.AdminLevelError); ok {
+				s.logger.WithField("username", username).WithField("path", req.URL.Path).Warnln("admin request with insufficient admin level")
+				s.problem(rw, req, http.StatusForbidden, "admin level %v required", levelErr.Required)
+				return
+			}
+			s.logger.WithError(err).Errorln("admin request admin level check failed")
+			s.errorProblem(rw, req, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.logger.WithField("username", username).WithField("path", req.URL.Path).Infoln("admin request")
+		next(rw, req, response.SessionID)
+	}
+}
+
+func (s *Server) writeAdminResponse(rw http.ResponseWriter, req *http.Request, er kcc.KCError, response *adminResponse) {
+	switch er {
+	case kcc.KCSuccess:
+	case kcc.KCERR_NO_ACCESS:
+		s.errorProblem(rw, req, http.StatusForbidden, er)
+		return
+	case kcc.KCERR_NOT_FOUND:
+		s.errorProblem(rw, req, http.StatusNotFound, er)
+		return
+	case kcc.KCERR_COLLISION:
+		s.errorProblem(rw, req, http.StatusConflict, er)
+		return
+	default:
+		s.errorProblem(rw, req, http.StatusInternalServerError, er)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(response)
+	if err != nil {
+		s.logger.WithError(err).Errorln("admin request failed writing response")
+	}
+}
+
+// NOTE(longsleep): Require days to be given explicitly, zero days purges all
+// soft deleted items.
+var purgeSoftDeleteParams = []*queryParam{
+	{name: "days", required: true, format: formatUint32},
+}
+
+func (s *Server) purgeSoftDeleteHandler(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+	if !s.validateRequest(rw, req, purgeSoftDeleteParams, nil, nil) {
+		return
+	}
+	days, _ := strconv.ParseUint(req.URL.Query().Get("days"), 10, 32)
+
+	response, err := s.c.PurgeSoftDelete(req.Context(), days, sessionID)
+	if err != nil {
+		s.logger.WithError(err).Errorln("purgeSoftDeleteHandler request purgeSoftDelete failed")
+		s.problem(rw, req, http.StatusInternalServerError, "")
+		return
+	}
+
+	s.writeAdminResponse(rw, req, response.Er, &adminResponse{})
+}
+
+func (s *Server) purgeDeferredUpdatesHandler(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+	response, err := s.c.PurgeDeferredUpdates(req.Context(), sessionID)
+	if err != nil {
+		s.logger.WithError(err).Errorln("purgeDeferredUpdatesHandler request purgeDeferredUpdates failed")
+		s.problem(rw, req, http.StatusInternalServerError, "")
+		return
+	}
+
+	s.writeAdminResponse(rw, req, response.Er, &adminResponse{
+		DeferredRemaining: &response.DeferredRemaining,
+	})
+}
+
+var purgeCacheParams = []*queryParam{
+	{name: "flags", required: true, list: true, enum: purgeCacheFlagNames()},
+}
+
+func (s *Server) purgeCacheHandler(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+	if !s.validateRequest(rw, req, purgeCacheParams, nil, nil) {
+		return
+	}
+
+	var flags kcc.KCFlag
+	for _, name := range strings.Split(req.URL.Query().Get("flags"), ",") {
+		flags |= purgeCacheFlags[strings.ToLower(strings.TrimSpace(name))]
+	}
+
+	response, err := s.c.PurgeCache(req.Context(), flags, sessionID)
+	if err != nil {
+		s.logger.WithError(err).Errorln("purgeCacheHandler request purgeCache failed")
+		s.problem(rw, req, http.StatusInternalServerError, "")
+		return
+	}
+	if response.Er == kcc.KCSuccess && flags&(kcc.PURGE_CACHE_USEROBJECT|kcc.PURGE_CACHE_USERDETAILS) != 0 {
+		// User data might have changed in the AB, drop all cached user data of
+		// this server.
+		inv := &kcc.Invalidation{}
+		if session := s.getSession(); session != nil {
+			inv.ServerGUID = session.State().ServerGUID
+		}
+		kcc.DefaultInvalidationBus.Publish(inv)
+	}
+
+	s.writeAdminResponse(rw, req, response.Er, &adminResponse{})
+}
+
+// featuresHandler lists the feature flags of experimental behaviors and their
+// current state.
+func (s *Server) featuresHandler(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+	s.writeAdminResponse(rw, req, kcc.KCSuccess, &adminResponse{
+		Features: kcc.Features(),
+	})
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// This file holds the API to compose custom endpoints with the internals of
+// the Server, so they get the same session handling, middleware and errors as
+// the built-in endpoints.
+
+// A SessionHandlerFunc handles a request with the server session. It must
+// respond to the request if it succeeds and must not respond if it returns an
+// error. Requests failing with KCERR_END_OF_SESSION are retried with a new
+// server session, all other errors are answered with problem details.
+type SessionHandlerFunc func(rw http.ResponseWriter, req *http.Request, session *kcc.Session) error
+
+// A customHandler is an endpoint registered with Handle.
+type customHandler struct {
+	pattern      string
+	methods      []string
+	contentTypes []string
+	handler      http.Handler
+}
+
+// Handle registers the provided handler for the provided pattern below the
+// versioned API prefix, with a deprecated legacy alias like all API
+// endpoints. The handler is served with the same middleware as the built-in
+// endpoints: the request context with the request timeout and panic recovery,
+// the provided allowed methods with JSON request bodies and maintenance mode.
+// Handle must be called before Serve or Handler.
+func (s *Server) Handle(pattern string, methods []string, handler http.Handler) {
+	s.customHandlers = append(s.customHandlers, &customHandler{
+		pattern:      pattern,
+		methods:      methods,
+		contentTypes: contentTypesJSON,
+		handler:      handler,
+	})
+}
+
+// WithSession returns a handler calling the provided handler with the server
+// session. The provided name is used for logging. Without server session, the
+// request is answered with service unavailable.
+func (s *Server) WithSession(name string, handler SessionHandlerFunc) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		s.runWithSession(rw, req, name, func(session *kcc.Session) error {
+			return handler(rw, req, session)
+		}, nil)
+	})
+}
+
+// WithMaintenance wraps the provided handler, rejecting requests while the
+// accociated Server is in maintenance mode.
+func (s *Server) WithMaintenance(next http.Handler) http.Handler {
+	return s.withMaintenance(next)
+}
+
+// WithMethods wraps the provided handler, rejecting requests with other than
+// the provided methods and request bodies with other than the provided
+// content types.
+func (s *Server) WithMethods(methods []string, contentTypes []string, next http.Handler) http.Handler {
+	return s.withMethods(methods, contentTypes, next)
+}
+
+// Client returns the kcc client of the accociated Server.
+func (s *Server) Client() *kcc.KCC {
+	return s.c
+}
+
+// Session returns the current server session of the accociated Server, or nil
+// if there is none. Use WithSession to handle ended sessions.
+func (s *Server) Session() *kcc.Session {
+	return s.getSession()
+}
+
+// Logger returns the logger of the accociated Server.
+func (s *Server) Logger() logrus.FieldLogger {
+	return s.logger
+}
+
+// ClientIP returns the address of the client of the provided request, taking
+// trusted proxies into account.
+func (s *Server) ClientIP(req *http.Request) string {
+	return s.clientIP(req)
+}
+
+// ClientContext returns the context of the provided request with the client
+// details of the request, to be used for logons made for the client.
+func (s *Server) ClientContext(req *http.Request) context.Context {
+	return s.withClientInfo(req)
+}
+
+// Problem responds to the provided request with localized problem details for
+// the provided HTTP status with the optional provided detail, formatted with
+// the provided args.
+func (s *Server) Problem(rw http.ResponseWriter, req *http.Request, status int, detail string, args ...interface{}) {
+	s.problem(rw, req, status, detail, args...)
+}
+
+// ErrorProblem responds to the provided request with localized problem
+// details for the provided HTTP status and error. KC errors are answered with
+// the problem type of their class, other errors are not exposed.
+func (s *Server) ErrorProblem(rw http.ResponseWriter, req *http.Request, status int, err error) {
+	s.errorProblem(rw, req, status, err)
+}
@@ -0,0 +1,263 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// Status values of batch items.
+const (
+	batchStatusOK        = "ok"
+	batchStatusNotFound  = "not_found"
+	batchStatusAmbiguous = "ambiguous"
+	batchStatusInvalid   = "invalid"
+	batchStatusError     = "error"
+)
+
+// A batchItem is the result of a single input of a batch request. Items are
+// returned in the order of the inputs, index is the position of the input.
+type batchItem struct {
+	Index  int         `json:"index"`
+	Input  string      `json:"input"`
+	Status string      `json:"status"`
+	Er     uint64      `json:"er,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+
+	Candidates []*kcc.NameCandidate `json:"candidates,omitempty"`
+	MatchType  kcc.NameMatchType    `json:"matchType,omitempty"`
+	Score      float64              `json:"score,omitempty"`
+}
+
+type batchResponse struct {
+	Items []*batchItem `json:"items"`
+}
+
+func newBatchItem(index int, input string, result interface{}, err error) *batchItem {
+	item := &batchItem{
+		Index:  index,
+		Input:  input,
+		Status: batchStatusOK,
+		Result: result,
+	}
+	if err == nil {
+		return item
+	}
+
+	item.Result = nil
+	item.Error = err.Error()
+	switch err {
+	case kcc.KCERR_NOT_FOUND:
+		item.Status = batchStatusNotFound
+	case kcc.KCERR_INVALID_PARAMETER:
+		item.Status = batchStatusInvalid
+	case kcc.ErrAmbiguousName:
+		item.Status = batchStatusAmbiguous
+	default:
+		item.Status = batchStatusError
+	}
+	if er, ok := err.(kcc.KCError); ok {
+		item.Er = uint64(er)
+	}
+
+	return item
+}
+
+// runBatch runs the provided batch function with the server session, retrying
+// when the session has ended. The batch function must only return an error
+// when the whole batch failed. When the Kopano server is unreachable, the
+// optional degraded function is called to respond from cache and returns
+// false if it cannot.
+func (s *Server) runBatch(rw http.ResponseWriter, req *http.Request, name string, batch func(*kcc.Session) ([]*batchItem, error), degraded func(http.ResponseWriter) bool) {
+	s.runWithSession(rw, req, name, func(session *kcc.Session) error {
+		items, err := batch(session)
+		if err != nil {
+			return err
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+
+		enc := json.NewEncoder(rw)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(&batchResponse{
+			Items: items,
+		})
+		if err != nil {
+			s.logger.WithError(err).Errorf("%s request failed writing response", name)
+		}
+		return nil
+	}, degraded)
+}
+
+// runWithSession runs the provided function with the server session, retrying
+// when the session has ended. The function must respond to the request if it
+// succeeds and must not respond if it returns an error, errors are answered
+// with problem details. When the Kopano server is unreachable, the optional
+// degraded function is called to respond from cache and returns false if it
+// cannot.
+func (s *Server) runWithSession(rw http.ResponseWriter, req *http.Request, name string, f func(*kcc.Session) error, degraded func(http.ResponseWriter) bool) {
+	retries := 0
+	for {
+		session := s.getSession()
+		if session == nil || !session.IsActive() {
+			s.logger.WithError(fmt.Errorf("no server session")).Errorf("%s request error", name)
+			if degraded == nil || !degraded(rw) {
+				s.writeUnavailable(rw, req, "")
+			}
+			return
+		}
+
+		err := f(session)
+		switch err {
+		case nil:
+			s.backend.markUp()
+			return
+
+		case kcc.KCERR_END_OF_SESSION:
+			session.Destroy(req.Context(), false)
+
+		default:
+			s.logger.WithError(err).Errorf("%s request failed", name)
+			if _, isMAPIError := err.(kcc.KCError); !isMAPIError {
+				// Backend is unreachable.
+				s.backend.markDown()
+				if degraded != nil && degraded(rw) {
+					return
+				}
+			}
+			s.problem(rw, req, http.StatusInternalServerError, "")
+			return
+		}
+
+		// If reach here, its a retry.
+		select {
+		case <-time.After(50 * time.Millisecond):
+			// Retry now.
+		case <-req.Context().Done():
+			// Abort.
+			return
+		}
+
+		retries++
+		if retries > 3 {
+			s.logger.WithField("retry", retries).Errorf("%s giving up", name)
+			s.problem(rw, req, http.StatusInternalServerError, "")
+			return
+		}
+		s.logger.WithField("retry", retries).Debugf("%s retry in progress", name)
+	}
+}
+
+var abResolveNamesParams = []*queryParam{
+	{name: "name", required: true, multiple: true},
+	{name: "candidates", enum: []string{"0", "1"}},
+}
+
+func (s *Server) abResolveNamesHandler(rw http.ResponseWriter, req *http.Request) {
+	if !s.validateRequest(rw, req, abResolveNamesParams, nil, nil) {
+		return
+	}
+	names := req.URL.Query()["name"]
+	withCandidates := req.URL.Query().Get("candidates") == "1"
+
+	props := []kcc.PT{
+		kcc.PR_ACCOUNT,
+		kcc.PR_DISPLAY_NAME,
+		kcc.PR_ADDRTYPE,
+		kcc.PR_EMAIL_ADDRESS,
+		kcc.PR_SMTP_ADDRESS,
+		kcc.PR_ENTRYID,
+		kcc.PR_INSTANCE_KEY,
+		kcc.PR_OBJECT_TYPE,
+		kcc.PR_RECORD_KEY,
+		kcc.PR_SEARCH_KEY,
+		0x6783000a, // ??
+	}
+
+	degraded := func(rw http.ResponseWriter) bool {
+		return s.writeDegradedResolveNames(rw, names)
+	}
+	if s.degraded() {
+		if !degraded(rw) {
+			s.writeUnavailable(rw, req, "")
+		}
+		return
+	}
+
+	s.runBatch(rw, req, "abResolveNamesHandler", func(session *kcc.Session) ([]*batchItem, error) {
+		results, err := s.c.ResolveNames(req.Context(), names, props, session.ID())
+		if err != nil {
+			return nil, err
+		}
+		if withCandidates {
+			if err = s.c.ResolveNameCandidates(req.Context(), results, 0, session.ID()); err != nil {
+				return nil, err
+			}
+		}
+
+		items := make([]*batchItem, len(results))
+		for idx, result := range results {
+			var props interface{}
+			if result.Props != nil {
+				props = result.Props
+			}
+			items[idx] = newBatchItem(result.Index, result.Name, props, result.Err)
+			items[idx].Candidates = result.Candidates
+			items[idx].MatchType = result.MatchType
+			items[idx].Score = result.Score
+		}
+		if s.resolvedNames != nil {
+			s.resolvedNames.set(items)
+		}
+		return items, nil
+	}, degraded)
+}
+
+var usersParams = []*queryParam{
+	{name: "username", required: true, multiple: true},
+}
+
+func (s *Server) usersHandler(rw http.ResponseWriter, req *http.Request) {
+	if !s.validateRequest(rw, req, usersParams, nil, nil) {
+		return
+	}
+	usernames := req.URL.Query()["username"]
+
+	s.runBatch(rw, req, "usersHandler", func(session *kcc.Session) ([]*batchItem, error) {
+		results, err := s.c.GetUsersByName(req.Context(), usernames, session.ID())
+		if err != nil {
+			return nil, err
+		}
+
+		items := make([]*batchItem, len(results))
+		for idx, result := range results {
+			var user interface{}
+			if result.User != nil {
+				user = result.User
+			}
+			items[idx] = newBatchItem(result.Index, result.Username, user, result.Err)
+		}
+		return items, nil
+	}, nil)
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// ParseTrustedProxies parses the provided CIDRs or IP addresses of trusted
+// proxies.
+func ParseTrustedProxies(values []string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %v", value)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %v", err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+
+	return proxies, nil
+}
+
+// isTrustedProxy returns true if the provided address is one of the trusted
+// proxies of the accociated Server.
+func (s *Server) isTrustedProxy(ip net.IP) bool {
+	for _, proxy := range s.trustedProxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the client of the provided request. If the
+// request was sent by a trusted proxy, the Forwarded or X-Forwarded-For header
+// is walked from the nearest hop until the first address which is not a
+// trusted proxy, so clients can not spoof their address by sending these
+// headers themselves.
+func (s *Server) clientIP(req *http.Request) string {
+	remoteAddr := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	ip := net.ParseIP(remoteAddr)
+	if ip == nil || !s.isTrustedProxy(ip) {
+		return remoteAddr
+	}
+
+	var hops []string
+	if values := req.Header["Forwarded"]; len(values) > 0 {
+		hops = parseForwardedFor(values)
+	} else {
+		for _, value := range req.Header["X-Forwarded-For"] {
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+
+	for idx := len(hops) - 1; idx >= 0; idx-- {
+		hop := net.ParseIP(stripHopPort(hops[idx]))
+		if hop == nil {
+			// NOTE(longsleep): Unknown or obfuscated hops end the chain, the
+			// last known address is used.
+			break
+		}
+		ip = hop
+		if !s.isTrustedProxy(ip) {
+			break
+		}
+	}
+
+	return ip.String()
+}
+
+// parseForwardedFor returns the for parameters of all elements of the
+// provided Forwarded header values (RFC 7239), in order.
+func parseForwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			hop := "unknown"
+			for _, pair := range strings.Split(element, ";") {
+				kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(kv) == 2 && strings.EqualFold(kv[0], "for") {
+					hop = strings.Trim(kv[1], `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+
+	return hops
+}
+
+// stripHopPort removes the port and the brackets of IPv6 addresses from the
+// provided forwarded address.
+func stripHopPort(hop string) string {
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]")
+}
+
+// withClientInfo returns the context of the provided request with the client
+// details of the request, so logons made for the client are shown with its
+// address and user agent in the session lists of the Kopano server.
+func (s *Server) withClientInfo(req *http.Request) context.Context {
+	return kcc.WithClientInfo(req.Context(), &kcc.ClientInfo{
+		RemoteAddr: s.clientIP(req),
+		UserAgent:  req.UserAgent(),
+	})
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", " 192.0.2.1 ", "", "2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		logger:         newTestLogger(),
+		trustedProxies: proxies,
+	}
+
+	for _, tc := range []struct {
+		name       string
+		remoteAddr string
+		header     map[string][]string
+		expected   string
+	}{
+		{"direct", "198.51.100.7:1234", nil, "198.51.100.7"},
+		{"untrusted proxy x-forwarded-for", "198.51.100.7:1234", map[string][]string{"X-Forwarded-For": {"203.0.113.5"}}, "198.51.100.7"},
+		{"untrusted proxy forwarded", "198.51.100.7:1234", map[string][]string{"Forwarded": {"for=203.0.113.5"}}, "198.51.100.7"},
+		{"trusted proxy without header", "10.1.2.3:1234", nil, "10.1.2.3"},
+		{"trusted proxy x-forwarded-for", "10.1.2.3:1234", map[string][]string{"X-Forwarded-For": {"203.0.113.5"}}, "203.0.113.5"},
+		{"trusted proxy x-forwarded-for spoofed", "10.1.2.3:1234", map[string][]string{"X-Forwarded-For": {"1.2.3.4, 203.0.113.5"}}, "203.0.113.5"},
+		{"trusted proxy chain x-forwarded-for", "10.1.2.3:1234", map[string][]string{"X-Forwarded-For": {"1.2.3.4, 203.0.113.5, 192.0.2.1", "10.9.9.9"}}, "203.0.113.5"},
+		{"trusted proxy chain only trusted", "10.1.2.3:1234", map[string][]string{"X-Forwarded-For": {"10.4.4.4, 192.0.2.1"}}, "10.4.4.4"},
+		{"trusted proxy x-forwarded-for garbage", "10.1.2.3:1234", map[string][]string{"X-Forwarded-For": {"203.0.113.5, garbage"}}, "10.1.2.3"},
+		{"trusted proxy forwarded", "10.1.2.3:1234", map[string][]string{"Forwarded": {"for=203.0.113.5;proto=https"}}, "203.0.113.5"},
+		{"trusted proxy forwarded spoofed", "10.1.2.3:1234", map[string][]string{"Forwarded": {"for=1.2.3.4, for=203.0.113.5"}}, "203.0.113.5"},
+		{"trusted proxy forwarded with port", "10.1.2.3:1234", map[string][]string{"Forwarded": {"for=\"203.0.113.5:4711\""}}, "203.0.113.5"},
+		{"trusted proxy forwarded ipv6", "10.1.2.3:1234", map[string][]string{"Forwarded": {"For=\"[2001:db8::7]:4711\""}}, "2001:db8::7"},
+		{"trusted proxy forwarded chain", "10.1.2.3:1234", map[string][]string{"Forwarded": {"for=203.0.113.5", "for=192.0.2.1;by=10.1.2.3"}}, "203.0.113.5"},
+		{"trusted proxy forwarded obfuscated", "10.1.2.3:1234", map[string][]string{"Forwarded": {"for=_hidden, for=192.0.2.1"}}, "192.0.2.1"},
+		{"trusted proxy forwarded preferred", "10.1.2.3:1234", map[string][]string{"Forwarded": {"for=203.0.113.5"}, "X-Forwarded-For": {"203.0.113.9"}}, "203.0.113.5"},
+		{"trusted ipv6 proxy", "[2001:db8::1]:1234", map[string][]string{"X-Forwarded-For": {"203.0.113.5"}}, "203.0.113.5"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remoteAddr
+		for name, values := range tc.header {
+			req.Header[http.CanonicalHeaderKey(name)] = values
+		}
+
+		if ip := s.clientIP(req); ip != tc.expected {
+			t.Errorf("%s: client ip mismatch: got %v want %v", tc.name, ip, tc.expected)
+		}
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	for _, value := range []string{"garbage", "10.0.0.0/33", "10.0.0"} {
+		if _, err := ParseTrustedProxies([]string{value}); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// degradedHeader is the response header set on responses served from cache
+// while the Kopano server is unreachable.
+const degradedHeader = "X-Kuserd-Degraded"
+
+// degradedRetryAfter is the duration clients are asked to wait before
+// retrying requests which cannot be served in degraded mode. It matches the
+// interval the server session is reestablished in.
+const degradedRetryAfter = 5 * time.Second
+
+// degradedNamesMaxEntries is the maximum number of resolved names kept for
+// degraded mode.
+const degradedNamesMaxEntries = 10000
+
+// backendHealth tracks whether the Kopano server is reachable. A transport
+// error marks it unreachable for degradedRetryAfter, so requests probe it
+// again after that.
+type backendHealth struct {
+	failed int64 // unix nano of the last transport error
+}
+
+func (h *backendHealth) markDown() {
+	atomic.StoreInt64(&h.failed, time.Now().UnixNano())
+}
+
+func (h *backendHealth) markUp() {
+	atomic.StoreInt64(&h.failed, 0)
+}
+
+func (h *backendHealth) down() bool {
+	failed := atomic.LoadInt64(&h.failed)
+	return failed != 0 && time.Since(time.Unix(0, failed)) < degradedRetryAfter
+}
+
+// degraded returns true if kuserd runs in read-only degraded mode, because
+// the server session could not be established or the Kopano server was
+// unreachable recently.
+func (s *Server) degraded() bool {
+	if atomic.LoadInt32(&s.withServerSession) == 1 {
+		if session := s.getSession(); session == nil || !session.IsActive() {
+			return true
+		}
+	}
+	return s.backend.down()
+}
+
+// writeUnavailable responds with service unavailable and a Retry-After
+// header, for requests which cannot be served in degraded mode.
+func (s *Server) writeUnavailable(rw http.ResponseWriter, req *http.Request, detail string) {
+	rw.Header().Set("Retry-After", strconv.Itoa(int(degradedRetryAfter/time.Second)))
+	s.problem(rw, req, http.StatusServiceUnavailable, detail)
+}
+
+// writeDegradedUserinfo responds with the user of the provided username from
+// the user caches, regardless of its age, marked with the degraded header.
+// Users from the disk cache are also marked as stale with Warning and Age
+// headers. Returns false if the user is not cached.
+func (s *Server) writeDegradedUserinfo(rw http.ResponseWriter, username string) bool {
+	if s.users != nil {
+		if user, ok := s.users.Get(username); ok {
+			rw.Header().Set(degradedHeader, "read-only")
+			s.writeUserinfo(rw, user)
+			return true
+		}
+	}
+	if s.diskUsers == nil {
+		return false
+	}
+	cached, ok := s.diskUsers.Get(username)
+	if !ok {
+		return false
+	}
+
+	rw.Header().Set(degradedHeader, "read-only")
+	rw.Header().Set("Age", strconv.FormatInt(int64(time.Since(cached.Stored)/time.Second), 10))
+	rw.Header().Set("Warning", `110 kuserd "Response is Stale"`)
+	s.writeUserinfo(rw, cached.User)
+	return true
+}
+
+// resolvedNames keeps the last result of resolved names, so they can be
+// served in degraded mode.
+type resolvedNames struct {
+	mutex sync.RWMutex
+	items map[string]*batchItem
+}
+
+func newResolvedNames() *resolvedNames {
+	return &resolvedNames{
+		items: make(map[string]*batchItem),
+	}
+}
+
+// len returns the number of kept names.
+func (rn *resolvedNames) len() int {
+	rn.mutex.RLock()
+	defer rn.mutex.RUnlock()
+
+	return len(rn.items)
+}
+
+// set remembers the provided items if they are conclusive, errors are not
+// kept.
+func (rn *resolvedNames) set(items []*batchItem) {
+	rn.mutex.Lock()
+	defer rn.mutex.Unlock()
+
+	for _, item := range items {
+		switch item.Status {
+		case batchStatusOK, batchStatusNotFound, batchStatusAmbiguous:
+		default:
+			continue
+		}
+		if _, exists := rn.items[item.Input]; !exists && len(rn.items) >= degradedNamesMaxEntries {
+			// Make room by dropping a random entry.
+			for name := range rn.items {
+				delete(rn.items, name)
+				break
+			}
+		}
+		rn.items[item.Input] = item
+	}
+}
+
+// get returns the items of the provided names, items of unknown names have
+// error status. The second return value is false if no name is known.
+func (rn *resolvedNames) get(names []string) ([]*batchItem, bool) {
+	rn.mutex.RLock()
+	defer rn.mutex.RUnlock()
+
+	found := false
+	items := make([]*batchItem, len(names))
+	for idx, name := range names {
+		item := &batchItem{
+			Index:  idx,
+			Input:  name,
+			Status: batchStatusError,
+			Error:  "not cached",
+		}
+		if cached, ok := rn.items[name]; ok {
+			found = true
+			item.Status = cached.Status
+			item.Er = cached.Er
+			item.Error = cached.Error
+			item.Result = cached.Result
+			item.Candidates = cached.Candidates
+			item.MatchType = cached.MatchType
+			item.Score = cached.Score
+		}
+		items[idx] = item
+	}
+
+	return items, found
+}
+
+// writeDegradedResolveNames responds with the cached results of the provided
+// names, marked with the degraded header. Returns false if none of the names
+// is cached.
+func (s *Server) writeDegradedResolveNames(rw http.ResponseWriter, names []string) bool {
+	if s.resolvedNames == nil {
+		return false
+	}
+	items, ok := s.resolvedNames.get(names)
+	if !ok {
+		return false
+	}
+
+	rw.Header().Set(degradedHeader, "read-only")
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&batchResponse{Items: items}); err != nil {
+		s.logger.WithError(err).Errorln("abResolveNamesHandler request failed writing degraded response")
+	}
+	return true
+}
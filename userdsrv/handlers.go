@@ -0,0 +1,548 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+var logonParams = []*queryParam{
+	{name: "session", enum: []string{"0", "1"}},
+}
+
+func (s *Server) logonHandler(rw http.ResponseWriter, req *http.Request) {
+	var failedErr error
+	var noSession bool
+
+	if !s.validateRequest(rw, req, logonParams, nil, nil) {
+		return
+	}
+	if s.degraded() {
+		s.writeUnavailable(rw, req, "backend unavailable, logons are disabled")
+		return
+	}
+
+	authorizationArray := req.Header["Authorization"]
+	if sessionQueryString := req.URL.Query().Get("session"); sessionQueryString == "0" {
+		noSession = true
+	}
+
+	for {
+		if len(authorizationArray) == 0 {
+			rw.Header().Set("WWW-Authenticate", "Basic realm=\"Kopano\"")
+			s.problem(rw, req, http.StatusUnauthorized, "")
+			return
+		}
+
+		authorization := strings.TrimSpace(authorizationArray[0])
+		credentials := strings.Split(authorization, " ")
+
+		if len(credentials) != 2 || credentials[0] != "Basic" {
+			s.problem(rw, req, http.StatusBadRequest, "")
+			return
+		}
+
+		auth, err := base64.StdEncoding.DecodeString(credentials[1])
+		if err != nil {
+			s.problem(rw, req, http.StatusBadRequest, "")
+			return
+		}
+
+		userpass := strings.Split(string(auth), ":")
+		if len(userpass) != 2 {
+			s.problem(rw, req, http.StatusBadRequest, "")
+			return
+		}
+
+		var logonFlags kcc.KCFlag
+		if noSession {
+			logonFlags |= kcc.KOPANO_LOGON_NO_REGISTER_SESSION
+		}
+		response, err := s.c.Logon(s.withClientInfo(req), userpass[0], userpass[1], logonFlags)
+		if err != nil {
+			if _, isMAPIError := err.(kcc.KCError); !isMAPIError {
+				s.backend.markDown()
+			}
+			failedErr = err
+			break
+		}
+		if response.Er == kcc.KCERR_LOGON_FAILED {
+			rw.Header().Set("WWW-Authenticate", "Basic realm=\"Kopano\"")
+			s.problem(rw, req, http.StatusUnauthorized, "")
+			return
+		} else if response.Er != kcc.KCSuccess {
+			failedErr = response.Er
+			break
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+
+		if noSession {
+			return
+		}
+
+		enc := json.NewEncoder(rw)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(response)
+		if err != nil {
+			s.logger.WithError(err).Errorln("logon request failed writing response")
+		}
+
+		return
+	}
+
+	if failedErr != nil {
+		s.logger.WithError(failedErr).Infoln("logon request error")
+	}
+
+	s.errorProblem(rw, req, http.StatusInternalServerError, failedErr)
+}
+
+var logoffParams = []*queryParam{
+	{name: "id", required: true, format: formatUint},
+}
+
+func (s *Server) logoffHandler(rw http.ResponseWriter, req *http.Request) {
+	if !s.validateRequest(rw, req, logoffParams, nil, nil) {
+		return
+	}
+	sessionID, _ := strconv.ParseUint(req.URL.Query().Get("id"), 10, 64)
+
+	response, err := s.c.Logoff(req.Context(), kcc.KCSessionID(sessionID))
+	if err != nil {
+		s.logger.WithError(err).Errorln("logoffHandler request logoff failed")
+		s.problem(rw, req, http.StatusInternalServerError, "")
+		return
+	}
+	if response.Er != kcc.KCSuccess {
+		s.logger.WithError(response.Er).Errorln("logoffHandler request logoff mapi error")
+		s.errorProblem(rw, req, http.StatusInternalServerError, response.Er)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+var userinfoParams = []*queryParam{
+	{name: "username", required: true},
+}
+
+func (s *Server) userinfoHandler(rw http.ResponseWriter, req *http.Request) {
+	if !s.validateRequest(rw, req, userinfoParams, nil, nil) {
+		return
+	}
+	username := req.URL.Query().Get("username")
+
+	if s.degraded() {
+		if !s.writeDegradedUserinfo(rw, username) {
+			s.writeUnavailable(rw, req, "")
+		}
+		return
+	}
+
+	if s.users != nil {
+		if user, ok := s.users.Get(username); ok {
+			s.writeUserinfo(rw, user)
+			return
+		}
+	}
+	if s.diskUsers != nil {
+		if cached, ok := s.diskUsers.Get(username); ok && !cached.Stale {
+			s.users.Set(username, cached.User)
+			s.writeUserinfo(rw, cached.User)
+			return
+		}
+	}
+
+	retries := 0
+	for {
+		session := s.getSession()
+		if session == nil || !session.IsActive() {
+			s.logger.WithError(fmt.Errorf("no server session")).Errorln("userinfoHandler request error")
+			if !s.writeDegradedUserinfo(rw, username) {
+				s.writeUnavailable(rw, req, "")
+			}
+			return
+		}
+
+		var failedErr error
+		for {
+			// Give both calls a fair share of the request's time, so a slow
+			// resolve does not leave no time for getUser.
+			budget := kcc.NewBudget(req.Context(), 2)
+
+			ctx, cancel := budget.Next("resolveUsername")
+			resolve, err := s.c.ResolveUsername(ctx, username, session.ID())
+			cancel()
+			if err != nil {
+				if budget.Exceeded() {
+					s.writeBudgetExceeded(rw, req, budget, nil)
+					return
+				}
+				s.logger.WithError(err).Errorln("userinfoHandler request resolveUserName failed")
+				failedErr = err
+				break
+
+			}
+			if resolve.Er == kcc.KCERR_NOT_FOUND {
+				s.errorProblem(rw, req, http.StatusNotFound, resolve.Er)
+				return
+			} else if resolve.Er != kcc.KCSuccess {
+				s.logger.WithError(resolve.Er).Errorln("userinfoHandler request resolveUserName mapi error")
+				failedErr = resolve.Er
+				break
+			}
+
+			ctx, cancel = budget.Next("getUser")
+			response, err := s.c.GetUser(ctx, resolve.UserEntryID, session.ID())
+			cancel()
+			if err != nil {
+				if budget.Exceeded() {
+					s.writeBudgetExceeded(rw, req, budget, map[string]interface{}{
+						"userEntryID": resolve.UserEntryID,
+					})
+					return
+				}
+				s.logger.WithError(err).Errorln("userinfoHandler request getUser failed")
+				failedErr = err
+				break
+			}
+			if response.Er != kcc.KCSuccess {
+				s.logger.WithError(response.Er).Errorln("userinfoHandler request getUser mapi error")
+				failedErr = response.Er
+				break
+			}
+
+			s.backend.markUp()
+			if s.users != nil {
+				s.users.Set(username, response.User)
+			}
+			if s.diskUsers != nil {
+				if err = s.diskUsers.Set(username, response.User); err != nil {
+					s.logger.WithError(err).Warnln("userinfoHandler failed to store user in disk cache")
+				}
+			}
+			s.writeUserinfo(rw, response.User)
+			return
+		}
+
+		if failedErr != nil {
+			switch failedErr {
+			case kcc.KCERR_END_OF_SESSION:
+				session.Destroy(req.Context(), false)
+			default:
+				if _, isMAPIError := failedErr.(kcc.KCError); !isMAPIError {
+					// Backend is unreachable.
+					s.backend.markDown()
+					if s.writeDegradedUserinfo(rw, username) {
+						return
+					}
+				}
+				s.errorProblem(rw, req, http.StatusInternalServerError, failedErr)
+				return
+			}
+		}
+
+		// If reach here, its a retry.
+		select {
+		case <-time.After(50 * time.Millisecond):
+			// Retry now.
+		case <-req.Context().Done():
+			// Abort.
+			return
+		}
+
+		retries++
+		if retries > 3 {
+			s.logger.WithField("retry", retries).Errorln("userInfoHandler giving up")
+			s.problem(rw, req, http.StatusInternalServerError, "")
+		}
+		s.logger.WithField("retry", retries).Debugln("userInfoHandler retry in progress")
+	}
+}
+
+// writeUserinfo responds with the provided user as JSON.
+func (s *Server) writeUserinfo(rw http.ResponseWriter, user *kcc.User) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(user)
+	if err != nil {
+		s.logger.WithError(err).Errorln("userInfoHandler request failed writing response")
+	}
+}
+
+// budgetExceededProblem extends problemDetails with the steps of a composite
+// request which were completed before its time budget was exceeded.
+type budgetExceededProblem struct {
+	*problemDetails
+	Step      string                 `json:"step"`
+	Completed []string               `json:"completed"`
+	Partial   map[string]interface{} `json:"partial,omitempty"`
+}
+
+// writeBudgetExceeded responds with the steps of a composite request which
+// were completed before the provided budget was exceeded, together with the
+// provided partial results.
+func (s *Server) writeBudgetExceeded(rw http.ResponseWriter, req *http.Request, budget *kcc.Budget, partial map[string]interface{}) {
+	s.logger.WithField("step", budget.Step()).Warnln("request time budget exceeded")
+
+	completed := budget.Completed()
+	if completed == nil {
+		completed = []string{}
+	}
+
+	language := requestLanguage(req)
+	s.writeProblem(rw, language, http.StatusGatewayTimeout, &budgetExceededProblem{
+		problemDetails: newProblem(language, http.StatusGatewayTimeout, "time budget exceeded"),
+		Step:           budget.Step(),
+		Completed:      completed,
+		Partial:        partial,
+	})
+}
+
+// parseErrorCode parses the provided decimal or 0x prefixed hexadecimal KC
+// error code.
+func parseErrorCode(er string) (kcc.KCError, error) {
+	var intEr uint64
+	var err error
+	if strings.HasPrefix(er, "0x") || strings.HasPrefix(er, "0X") {
+		intEr, err = strconv.ParseUint(er[2:], 16, 64)
+	} else {
+		intEr, err = strconv.ParseUint(er, 10, 64)
+	}
+
+	return kcc.KCError(intEr), err
+}
+
+var errorSenseParams = []*queryParam{
+	{name: "er", required: true, format: formatErrorCode},
+}
+
+func (s *Server) errorSenseHandler(rw http.ResponseWriter, req *http.Request) {
+	if !s.validateRequest(rw, req, errorSenseParams, nil, nil) {
+		return
+	}
+	err, _ := parseErrorCode(req.URL.Query().Get("er"))
+
+	fmt.Fprintf(rw, "%s\n", err)
+}
+
+func (s *Server) errorsList(rw http.ResponseWriter, req *http.Request) {
+	var keys []kcc.KCError
+	for k := range kcc.KCErrorNameMap {
+		keys = append(keys, k)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		a := uint64(keys[i])
+		b := uint64(keys[j])
+
+		return a < b
+	})
+
+	for _, k := range keys {
+		fmt.Fprintf(rw, "%#v : %d : %s\n", k, k, k)
+	}
+}
+
+// calendarToken returns the calendar subscription token for the provided
+// username, which is the hex encoded HMAC-SHA256 of the username using the
+// accociated Server's calendar token secret.
+func (s *Server) calendarToken(username string) string {
+	mac := hmac.New(sha256.New, s.calendarTokenSecret)
+	mac.Write([]byte(username))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var calendarParams = []*queryParam{
+	{name: "user", required: true},
+	{name: "token", required: true},
+}
+
+func (s *Server) calendarHandler(rw http.ResponseWriter, req *http.Request) {
+	if !s.validateRequest(rw, req, calendarParams, nil, nil) {
+		return
+	}
+	username := req.URL.Query().Get("user")
+	token := req.URL.Query().Get("token")
+	if !hmac.Equal([]byte(token), []byte(s.calendarToken(username))) {
+		s.problem(rw, req, http.StatusForbidden, "")
+		return
+	}
+
+	// Calendar subscriptions are polled in the background, let interactive
+	// requests go first.
+	ctx := kcc.WithPriority(req.Context(), kcc.PriorityBatch)
+
+	retries := 0
+	for {
+		session := s.getSession()
+		if session == nil || !session.IsActive() {
+			s.logger.WithError(fmt.Errorf("no server session")).Errorln("calendarHandler request error")
+			s.problem(rw, req, http.StatusServiceUnavailable, "")
+			return
+		}
+
+		var failedErr error
+		for {
+			store, err := s.c.OpenUserStore(ctx, username, session.ID())
+			if err == kcc.KCERR_NOT_FOUND {
+				s.problem(rw, req, http.StatusNotFound, "")
+				return
+			} else if err != nil {
+				s.logger.WithError(err).Errorln("calendarHandler request open user store failed")
+				failedErr = err
+				break
+			}
+
+			folderEntryID, ok := store.FolderEntryID(kcc.PR_IPM_APPOINTMENT_ENTRYID)
+			if !ok {
+				s.problem(rw, req, http.StatusNotFound, "")
+				return
+			}
+
+			events, err := s.c.ListEvents(ctx, folderEntryID, session.ID())
+			if err != nil {
+				s.logger.WithError(err).Errorln("calendarHandler request list events failed")
+				failedErr = err
+				break
+			}
+
+			rw.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+			rw.WriteHeader(http.StatusOK)
+
+			_, err = rw.Write(kcc.ICalendar(username, events, s.calendarLocation))
+			if err != nil {
+				s.logger.WithError(err).Errorln("calendarHandler request failed writing response")
+			}
+
+			return
+		}
+
+		if failedErr != nil {
+			switch failedErr {
+			case kcc.KCERR_END_OF_SESSION:
+				session.Destroy(req.Context(), false)
+			default:
+				s.errorProblem(rw, req, http.StatusInternalServerError, failedErr)
+				return
+			}
+		}
+
+		// If reach here, its a retry.
+		select {
+		case <-time.After(50 * time.Millisecond):
+			// Retry now.
+		case <-req.Context().Done():
+			// Abort.
+			return
+		}
+
+		retries++
+		if retries > 3 {
+			s.logger.WithField("retry", retries).Errorln("calendarHandler giving up")
+			s.problem(rw, req, http.StatusInternalServerError, "")
+			return
+		}
+		s.logger.WithField("retry", retries).Debugln("calendarHandler retry in progress")
+	}
+}
+
+type propsResponse struct {
+	EntryID string                `json:"entryID"`
+	Props   []*propsResponseValue `json:"props"`
+	Missing []string              `json:"missing,omitempty"`
+}
+
+type propsResponseValue struct {
+	Tag   string      `json:"tag"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+var propsParams = []*queryParam{
+	{name: "entryid", required: true, format: formatEntryID},
+	{name: "tag", required: true, multiple: true, format: formatPropTag},
+}
+
+// propsHandler reads the props with the session of the admin making the
+// request, so the Kopano server applies its permissions.
+func (s *Server) propsHandler(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+	if !s.validateRequest(rw, req, propsParams, nil, nil) {
+		return
+	}
+	entryID := parseEntryID(req.URL.Query().Get("entryid"))
+	tags := req.URL.Query()["tag"]
+
+	props := make([]kcc.PT, len(tags))
+	for idx, tag := range tags {
+		pt, _ := strconv.ParseUint(tag, 0, 32)
+		props[idx] = kcc.PT(pt)
+	}
+
+	values, err := s.c.GetProps(req.Context(), entryID, props, sessionID)
+	if err == kcc.KCERR_NOT_FOUND || err == kcc.KCERR_INVALID_ENTRYID {
+		s.problem(rw, req, http.StatusNotFound, "")
+		return
+	} else if err != nil {
+		s.logger.WithError(err).Errorln("propsHandler request get props failed")
+		s.errorProblem(rw, req, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := &propsResponse{
+		EntryID: entryID,
+		Props:   make([]*propsResponseValue, 0, len(values)),
+	}
+	for idx, value := range values {
+		tag := fmt.Sprintf("0x%08X", uint64(props[idx]))
+		if value == nil {
+			response.Missing = append(response.Missing, tag)
+			continue
+		}
+		response.Props = append(response.Props, &propsResponseValue{
+			Tag:   tag,
+			Type:  props[idx].TypeName(),
+			Value: value.Value(),
+		})
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(response)
+	if err != nil {
+		s.logger.WithError(err).Errorln("propsHandler request failed writing response")
+	}
+}
@@ -0,0 +1,205 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLanguage is the language of the message keys and used when none of
+// the accepted languages of a request is available.
+const defaultLanguage = "en"
+
+// A messageCatalog maps English messages to their translation.
+type messageCatalog map[string]string
+
+// messageCatalogs holds the translations of user facing messages by language.
+// Messages without translation are returned in English.
+var messageCatalogs = map[string]messageCatalog{
+	"en": {},
+	"de": {
+		"Bad Request":            "Ungültige Anfrage",
+		"Unauthorized":           "Nicht autorisiert",
+		"Forbidden":              "Verboten",
+		"Not Found":              "Nicht gefunden",
+		"Method Not Allowed":     "Methode nicht erlaubt",
+		"Unsupported Media Type": "Nicht unterstützter Medientyp",
+		"Conflict":               "Konflikt",
+		"Unprocessable Entity":   "Nicht verarbeitbare Anfrage",
+		"Internal Server Error":  "Interner Serverfehler",
+		"Service Unavailable":    "Dienst nicht verfügbar",
+		"Gateway Timeout":        "Zeitüberschreitung",
+
+		"Object not found": "Objekt nicht gefunden",
+		"Access denied":    "Zugriff verweigert",
+		"Logon failed":     "Anmeldung fehlgeschlagen",
+		"Session ended":    "Sitzung beendet",
+		"Invalid request":  "Ungültige Anfrage",
+		"Not supported":    "Nicht unterstützt",
+		"Server busy":      "Server ausgelastet",
+		"Quota exceeded":   "Kontingent überschritten",
+		"Server error":     "Serverfehler",
+
+		"missing request signature":                        "Anfragesignatur fehlt",
+		"invalid request signature timestamp":              "Ungültiger Zeitstempel der Anfragesignatur",
+		"request signature timestamp out of window":        "Zeitstempel der Anfragesignatur außerhalb des erlaubten Zeitfensters",
+		"invalid request signature":                        "Ungültige Anfragesignatur",
+		"replayed request":                                 "Wiederholte Anfrage",
+		"idempotency key reused for a different request":   "Idempotenzschlüssel für eine andere Anfrage wiederverwendet",
+		"request with this idempotency key is in progress": "Anfrage mit diesem Idempotenzschlüssel wird bereits bearbeitet",
+		"time budget exceeded":                             "Zeitbudget überschritten",
+		"invalid csrf token":                               "Ungültiges CSRF-Token",
+		"Logon failed, check username and password.":       "Anmeldung fehlgeschlagen, bitte Benutzername und Passwort prüfen.",
+		"admin level %v required":                          "Administrationsstufe %v erforderlich",
+		"user outside of company":                          "Benutzer außerhalb der Firma",
+		"admin outside of company":                         "Administrator außerhalb der Firma",
+		"backend unavailable, logons are disabled":         "Backend nicht verfügbar, Anmeldungen sind deaktiviert",
+		"maintenance mode, try again later":                "Wartungsmodus, bitte später erneut versuchen",
+		"unsupported content type, expected %v":            "Nicht unterstützter Inhaltstyp, erwartet wird %v",
+
+		"invalid request":                    "Ungültige Anfrage",
+		"is required":                        "ist erforderlich",
+		"must not be repeated":               "darf nicht wiederholt werden",
+		"must be an unsigned integer":        "muss eine nicht negative Ganzzahl sein",
+		"must be an unsigned 32-bit integer": "muss eine nicht negative 32-Bit-Ganzzahl sein",
+		"must be true or false":              "muss true oder false sein",
+		"must be a decimal or 0x prefixed hexadecimal error code": "muss ein dezimaler oder mit 0x beginnender hexadezimaler Fehlercode sein",
+		"must be a 32-bit property tag":                           "muss ein 32-Bit-Property-Tag sein",
+		"must be a base64 encoded entry ID":                       "muss eine base64-kodierte Entry-ID sein",
+		"unknown value %v, must be one of %v":                     "Unbekannter Wert %v, muss einer von %v sein",
+		"must be a string":                                        "muss eine Zeichenkette sein",
+		"must be a boolean":                                       "muss ein Wahrheitswert sein",
+		"must be an integer":                                      "muss eine Ganzzahl sein",
+		"must be a JSON object":                                   "muss ein JSON-Objekt sein",
+		"unknown field":                                           "Unbekanntes Feld",
+	},
+	"nl": {
+		"Bad Request":            "Ongeldig verzoek",
+		"Unauthorized":           "Niet geautoriseerd",
+		"Forbidden":              "Verboden",
+		"Not Found":              "Niet gevonden",
+		"Method Not Allowed":     "Methode niet toegestaan",
+		"Unsupported Media Type": "Niet-ondersteund mediatype",
+		"Conflict":               "Conflict",
+		"Unprocessable Entity":   "Onverwerkbaar verzoek",
+		"Internal Server Error":  "Interne serverfout",
+		"Service Unavailable":    "Dienst niet beschikbaar",
+		"Gateway Timeout":        "Time-out",
+
+		"Object not found": "Object niet gevonden",
+		"Access denied":    "Toegang geweigerd",
+		"Logon failed":     "Aanmelden mislukt",
+		"Session ended":    "Sessie beëindigd",
+		"Invalid request":  "Ongeldig verzoek",
+		"Not supported":    "Niet ondersteund",
+		"Server busy":      "Server bezet",
+		"Quota exceeded":   "Quotum overschreden",
+		"Server error":     "Serverfout",
+
+		"missing request signature":                        "Handtekening van het verzoek ontbreekt",
+		"invalid request signature timestamp":              "Ongeldige tijdstempel in de handtekening van het verzoek",
+		"request signature timestamp out of window":        "Tijdstempel van de handtekening valt buiten het toegestane tijdvenster",
+		"invalid request signature":                        "Ongeldige handtekening van het verzoek",
+		"replayed request":                                 "Herhaald verzoek",
+		"idempotency key reused for a different request":   "Idempotentiesleutel hergebruikt voor een ander verzoek",
+		"request with this idempotency key is in progress": "Verzoek met deze idempotentiesleutel wordt al verwerkt",
+		"time budget exceeded":                             "Tijdsbudget overschreden",
+		"invalid csrf token":                               "Ongeldig CSRF-token",
+		"Logon failed, check username and password.":       "Aanmelden mislukt, controleer gebruikersnaam en wachtwoord.",
+		"admin level %v required":                          "Beheerniveau %v vereist",
+		"user outside of company":                          "Gebruiker buiten het bedrijf",
+		"admin outside of company":                         "Beheerder buiten het bedrijf",
+		"backend unavailable, logons are disabled":         "Backend niet beschikbaar, aanmelden is uitgeschakeld",
+		"maintenance mode, try again later":                "Onderhoudsmodus, probeer het later opnieuw",
+		"unsupported content type, expected %v":            "Niet-ondersteund inhoudstype, verwacht wordt %v",
+
+		"invalid request":                    "Ongeldig verzoek",
+		"is required":                        "is verplicht",
+		"must not be repeated":               "mag niet herhaald worden",
+		"must be an unsigned integer":        "moet een niet-negatief geheel getal zijn",
+		"must be an unsigned 32-bit integer": "moet een niet-negatief 32-bits geheel getal zijn",
+		"must be true or false":              "moet true of false zijn",
+		"must be a decimal or 0x prefixed hexadecimal error code": "moet een decimale of met 0x beginnende hexadecimale foutcode zijn",
+		"must be a 32-bit property tag":                           "moet een 32-bits property-tag zijn",
+		"must be a base64 encoded entry ID":                       "moet een base64-gecodeerde entry-ID zijn",
+		"unknown value %v, must be one of %v":                     "Onbekende waarde %v, moet een van %v zijn",
+		"must be a string":                                        "moet een tekenreeks zijn",
+		"must be a boolean":                                       "moet een booleaanse waarde zijn",
+		"must be an integer":                                      "moet een geheel getal zijn",
+		"must be a JSON object":                                   "moet een JSON-object zijn",
+		"unknown field":                                           "Onbekend veld",
+	},
+}
+
+// translate returns the translation of the provided English message in the
+// provided language, or the message itself if there is none.
+func translate(language, message string) string {
+	if translated, ok := messageCatalogs[language][message]; ok {
+		return translated
+	}
+
+	return message
+}
+
+// requestLanguage selects the best available language for the provided
+// request from its Accept-Language header.
+func requestLanguage(req *http.Request) string {
+	type accepted struct {
+		language string
+		q        float64
+	}
+
+	var languages []accepted
+	for _, entry := range strings.Split(req.Header.Get("Accept-Language"), ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ";")
+		language := strings.ToLower(strings.TrimSpace(parts[0]))
+		if language == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = value
+				}
+			}
+		}
+		if q > 0 {
+			languages = append(languages, accepted{language, q})
+		}
+	}
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].q > languages[j].q
+	})
+
+	for _, entry := range languages {
+		if entry.language == "*" {
+			break
+		}
+		// Match by primary subtag, for example de-AT matches de.
+		primary := strings.SplitN(entry.language, "-", 2)[0]
+		if _, ok := messageCatalogs[primary]; ok {
+			return primary
+		}
+	}
+
+	return defaultLanguage
+}
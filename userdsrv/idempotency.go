@@ -0,0 +1,206 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// An idempotencyRecord is the stored response of a request with an
+// idempotency key. It is pending while the first request is in progress.
+type idempotencyRecord struct {
+	fingerprint string
+	expires     time.Time
+	pending     bool
+
+	status int
+	header http.Header
+	body   []byte
+}
+
+// An idempotencyStore remembers responses of requests by idempotency key for
+// a short time, so retried requests get the original response instead of
+// running again.
+type idempotencyStore struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	records map[string]*idempotencyRecord
+	purged  time.Time
+}
+
+func newIdempotencyStore(ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		ttl:     ttl,
+		records: make(map[string]*idempotencyRecord),
+		purged:  time.Now(),
+	}
+}
+
+// len returns the number of remembered records, including pending ones.
+func (is *idempotencyStore) len() int {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	return len(is.records)
+}
+
+// begin returns the record of the provided key. If there is none, a new
+// pending record is added and nil is returned, meaning the request should run.
+func (is *idempotencyStore) begin(key, fingerprint string) *idempotencyRecord {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(is.purged) > is.ttl {
+		for k, record := range is.records {
+			if !record.pending && now.After(record.expires) {
+				delete(is.records, k)
+			}
+		}
+		is.purged = now
+	}
+
+	if record, ok := is.records[key]; ok && (record.pending || now.Before(record.expires)) {
+		return record
+	}
+
+	is.records[key] = &idempotencyRecord{
+		fingerprint: fingerprint,
+		pending:     true,
+	}
+	return nil
+}
+
+// finish stores the provided response for the provided key. Responses with
+// server errors or authentication failures are not stored, so the request can
+// be retried.
+func (is *idempotencyStore) finish(key string, status int, header http.Header, body []byte) {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	record, ok := is.records[key]
+	if !ok {
+		return
+	}
+	if status >= http.StatusInternalServerError || status == http.StatusUnauthorized || status == http.StatusForbidden {
+		delete(is.records, key)
+		return
+	}
+
+	record.pending = false
+	record.expires = time.Now().Add(is.ttl)
+	record.status = status
+	record.header = header
+	record.body = body
+}
+
+// An idempotencyRecorder captures a response while passing it through.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (ir *idempotencyRecorder) WriteHeader(status int) {
+	if ir.status == 0 {
+		ir.status = status
+	}
+	ir.ResponseWriter.WriteHeader(status)
+}
+
+func (ir *idempotencyRecorder) Write(p []byte) (int, error) {
+	if ir.status == 0 {
+		ir.status = http.StatusOK
+	}
+	ir.body.Write(p)
+	return ir.ResponseWriter.Write(p)
+}
+
+// withIdempotency wraps the provided handler, so that requests carrying an
+// Idempotency-Key header are only run once per key. Retries with the same key
+// get the stored response of the first request, retries while the first
+// request is still running fail with status 409 and reusing a key for a
+// different request fails with status 422. Keys are scoped by the credentials
+// of the request. It wraps the handler within withAdminSession, so stored
+// responses are only returned to requests which are still authorized.
+func (s *Server) withIdempotency(next func(http.ResponseWriter, *http.Request, kcc.KCSessionID)) func(http.ResponseWriter, *http.Request, kcc.KCSessionID) {
+	return func(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+		idempotencyKey := req.Header.Get(idempotencyKeyHeader)
+		if idempotencyKey == "" || s.idempotency == nil {
+			next(rw, req, sessionID)
+			return
+		}
+
+		body, ok := s.readRequestBody(rw, req)
+		if !ok {
+			return
+		}
+
+		scope := sha256.Sum256([]byte(req.Header.Get("Authorization") + "\n" + idempotencyKey))
+		key := hex.EncodeToString(scope[:])
+		fingerprint := sha256.Sum256(append([]byte(req.Method+" "+req.URL.RequestURI()+"\n"), body...))
+
+		record := s.idempotency.begin(key, hex.EncodeToString(fingerprint[:]))
+		if record != nil {
+			switch {
+			case record.fingerprint != hex.EncodeToString(fingerprint[:]):
+				s.problem(rw, req, http.StatusUnprocessableEntity, "idempotency key reused for a different request")
+			case record.pending:
+				s.problem(rw, req, http.StatusConflict, "request with this idempotency key is in progress")
+			default:
+				for name, values := range record.header {
+					rw.Header()[name] = values
+				}
+				rw.Header().Set("Idempotent-Replayed", "true")
+				rw.WriteHeader(record.status)
+				rw.Write(record.body)
+			}
+			return
+		}
+
+		recorder := &idempotencyRecorder{
+			ResponseWriter: rw,
+		}
+		completed := false
+		defer func() {
+			status := recorder.status
+			if !completed {
+				// Forget the key when the handler did not return normally.
+				status = http.StatusInternalServerError
+			} else if status == 0 {
+				status = http.StatusOK
+			}
+			header := make(http.Header)
+			for name, values := range rw.Header() {
+				header[name] = values
+			}
+			s.idempotency.finish(key, status, header, recorder.body.Bytes())
+		}()
+
+		next(recorder, req, sessionID)
+		completed = true
+	}
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+func newTestIdempotencyRequest(key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/create-user", strings.NewReader(body))
+	req.SetBasicAuth("admin", "pass")
+	req.Header.Set(idempotencyKeyHeader, key)
+
+	return req
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	s := &Server{
+		logger:      newTestLogger(),
+		idempotency: newIdempotencyStore(time.Minute),
+	}
+	var calls int32
+	handler := s.withIdempotency(func(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+		atomic.AddInt32(&calls, 1)
+		rw.WriteHeader(http.StatusCreated)
+		rw.Write([]byte("created"))
+	})
+
+	for _, tc := range []struct {
+		name     string
+		key      string
+		body     string
+		status   int
+		replayed bool
+	}{
+		{"first", "key1", "body1", http.StatusCreated, false},
+		{"retry", "key1", "body1", http.StatusCreated, true},
+		{"different body", "key1", "body2", http.StatusUnprocessableEntity, false},
+		{"other key", "key2", "body2", http.StatusCreated, false},
+	} {
+		rw := httptest.NewRecorder()
+		handler(rw, newTestIdempotencyRequest(tc.key, tc.body), 1)
+
+		if rw.Code != tc.status {
+			t.Errorf("%s: status mismatch: got %d want %d", tc.name, rw.Code, tc.status)
+		}
+		if replayed := rw.Header().Get("Idempotent-Replayed") == "true"; replayed != tc.replayed {
+			t.Errorf("%s: replayed mismatch: got %v want %v", tc.name, replayed, tc.replayed)
+		}
+		if tc.replayed && rw.Body.String() != "created" {
+			t.Errorf("%s: replayed body mismatch: got %q", tc.name, rw.Body.String())
+		}
+	}
+	if calls != 2 {
+		t.Errorf("handler calls mismatch: got %d want %d", calls, 2)
+	}
+}
+
+func TestIdempotencyPending(t *testing.T) {
+	s := &Server{
+		logger:      newTestLogger(),
+		idempotency: newIdempotencyStore(time.Minute),
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := s.withIdempotency(func(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+		close(started)
+		<-release
+		rw.WriteHeader(http.StatusOK)
+	})
+
+	done := make(chan int)
+	go func() {
+		rw := httptest.NewRecorder()
+		handler(rw, newTestIdempotencyRequest("key", "body"), 1)
+		done <- rw.Code
+	}()
+	<-started
+
+	rw := httptest.NewRecorder()
+	handler(rw, newTestIdempotencyRequest("key", "body"), 1)
+	if rw.Code != http.StatusConflict {
+		t.Errorf("status while pending mismatch: got %d want %d", rw.Code, http.StatusConflict)
+	}
+
+	close(release)
+	if status := <-done; status != http.StatusOK {
+		t.Errorf("status of first request mismatch: got %d want %d", status, http.StatusOK)
+	}
+}
+
+func TestIdempotencyForgetsFailures(t *testing.T) {
+	s := &Server{
+		logger:      newTestLogger(),
+		idempotency: newIdempotencyStore(time.Minute),
+	}
+	for _, status := range []int{http.StatusForbidden, http.StatusUnauthorized, http.StatusBadGateway} {
+		handler := s.withIdempotency(func(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+			rw.WriteHeader(status)
+		})
+
+		rw := httptest.NewRecorder()
+		handler(rw, newTestIdempotencyRequest("key", "body"), 1)
+		if rw.Code != status {
+			t.Errorf("status mismatch: got %d want %d", rw.Code, status)
+		}
+		if n := s.idempotency.len(); n != 0 {
+			t.Errorf("stored records after status %d: got %d want 0", status, n)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// maintenanceRetryAfter is the duration clients are asked to wait before
+// retrying requests which were rejected in maintenance mode.
+const maintenanceRetryAfter = 5 * time.Minute
+
+// Health check status values.
+const (
+	healthStatusReady       = "ready"
+	healthStatusMaintenance = "maintenance"
+	healthStatusDraining    = "draining"
+)
+
+type healthResponse struct {
+	Status   string `json:"status"`
+	Degraded bool   `json:"degraded,omitempty"`
+}
+
+// inMaintenance returns true if kuserd was put into maintenance mode.
+func (s *Server) inMaintenance() bool {
+	return atomic.LoadInt32(&s.maintenance) != 0
+}
+
+// setMaintenance enables or disables maintenance mode.
+func (s *Server) setMaintenance(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&s.maintenance, value)
+}
+
+// withMaintenance wraps the provided handler, rejecting requests with service
+// unavailable and a Retry-After header while kuserd is in maintenance mode.
+func (s *Server) withMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if s.inMaintenance() {
+			rw.Header().Set("Retry-After", strconv.Itoa(int(maintenanceRetryAfter/time.Second)))
+			s.problem(rw, req, http.StatusServiceUnavailable, "maintenance mode, try again later")
+			return
+		}
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+var maintenanceParams = []*queryParam{
+	{name: "enabled", required: true, format: formatBool},
+}
+
+// maintenanceHandler enables or disables maintenance mode with the enabled
+// query parameter, so the backend can be worked on without stopping kuserd.
+func (s *Server) maintenanceHandler(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+	if !s.validateRequest(rw, req, maintenanceParams, nil, nil) {
+		return
+	}
+	enabled, _ := strconv.ParseBool(req.URL.Query().Get("enabled"))
+
+	if enabled != s.inMaintenance() {
+		s.setMaintenance(enabled)
+		if enabled {
+			s.logger.Warnln("maintenance mode enabled")
+		} else {
+			s.logger.Infoln("maintenance mode disabled")
+		}
+	}
+
+	s.writeAdminResponse(rw, req, kcc.KCSuccess, &adminResponse{
+		Maintenance: &enabled,
+	})
+}
+
+// healthCheckHandler reports whether kuserd is ready to handle requests. In
+// maintenance mode and while draining before shutdown it responds with service
+// unavailable, so load balancers take it out of rotation.
+func (s *Server) healthCheckHandler(rw http.ResponseWriter, req *http.Request) {
+	response := &healthResponse{
+		Status:   healthStatusReady,
+		Degraded: s.degraded(),
+	}
+	status := http.StatusOK
+	switch {
+	case atomic.LoadInt32(&s.draining) != 0:
+		response.Status = healthStatusDraining
+		status = http.StatusServiceUnavailable
+	case s.inMaintenance():
+		response.Status = healthStatusMaintenance
+		status = http.StatusServiceUnavailable
+		rw.Header().Set("Retry-After", strconv.Itoa(int(maintenanceRetryAfter/time.Second)))
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(response)
+	if err != nil {
+		s.logger.WithError(err).Errorln("healthCheckHandler request failed writing response")
+	}
+}
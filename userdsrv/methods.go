@@ -0,0 +1,83 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Content types of request bodies.
+const (
+	contentTypeJSON          = "application/json"
+	contentTypeForm          = "application/x-www-form-urlencoded"
+	contentTypeMultipartForm = "multipart/form-data"
+)
+
+// Allowed request methods of endpoints.
+var (
+	methodsRead     = []string{http.MethodGet, http.MethodHead}
+	methodsPost     = []string{http.MethodPost}
+	methodsReadPost = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+)
+
+// Allowed content types of request bodies of endpoints.
+var (
+	contentTypesJSON = []string{contentTypeJSON}
+	contentTypesForm = []string{contentTypeForm, contentTypeMultipartForm}
+)
+
+// withMethods wraps the provided handler, rejecting requests with a method
+// other than the provided methods with method not allowed and an Allow
+// header. If content types are provided, requests with a body of any other
+// content type are rejected with unsupported media type and an Accept-Post
+// header. Requests without body are not checked for their content type.
+func (s *Server) withMethods(methods []string, contentTypes []string, next http.Handler) http.Handler {
+	allow := strings.Join(methods, ", ")
+	accept := strings.Join(contentTypes, ", ")
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !containsString(methods, req.Method) {
+			rw.Header().Set("Allow", allow)
+			s.problem(rw, req, http.StatusMethodNotAllowed, "")
+			return
+		}
+
+		if len(contentTypes) > 0 && req.ContentLength != 0 && req.Body != nil && req.Body != http.NoBody {
+			mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+			if err != nil || !containsString(contentTypes, mediaType) {
+				rw.Header().Set("Accept-Post", accept)
+				s.problem(rw, req, http.StatusUnsupportedMediaType, "unsupported content type, expected %v", accept)
+				return
+			}
+		}
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// containsString returns true if the provided values contain the provided
+// value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// metricsHandler writes the backend request counters, SLO state and Go runtime
+// metrics in the Prometheus text exposition format.
+func (s *Server) metricsHandler(rw http.ResponseWriter, req *http.Request) {
+	stats := kcc.Stats()
+	slo := kcc.DefaultSLOTracker.Report()
+
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+
+	for _, metric := range []struct {
+		name  string
+		kind  string
+		help  string
+		value interface{}
+	}{
+		{"kcc_backend_requests_in_flight", "gauge", "Number of requests currently sent to the Kopano server.", stats.InFlight},
+		{"kcc_backend_requests_waiting", "gauge", "Number of requests waiting for a connection slot or rate limit.", stats.Waiting},
+		{"kcc_backend_requests_total", "counter", "Total number of requests sent to the Kopano server.", stats.Requests},
+		{"kcc_backend_requests_canceled_total", "counter", "Total number of requests aborted because their context was done.", stats.Canceled},
+		{"kcc_backend_slo_objective", "gauge", "Share of requests which must succeed within the latency target.", slo.Objective},
+		{"kcc_backend_slo_success_ratio", "gauge", "Share of requests of the SLO window which succeeded within the latency target.", slo.SuccessRate},
+		{"kcc_backend_slo_burn_rate", "gauge", "Rate the error budget of the SLO window is spent at, above 1 exhausts it.", slo.BurnRate},
+		{"kcc_backend_slo_error_budget_remaining", "gauge", "Share of the error budget of the SLO window which is left.", slo.ErrorBudgetRemaining},
+	} {
+		fmt.Fprintf(rw, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", metric.name, metric.help, metric.name, metric.kind, metric.name, metric.value)
+	}
+
+	fmt.Fprintf(rw, "# HELP kcc_backend_slo_latency_seconds Latency percentiles of requests of the SLO window.\n# TYPE kcc_backend_slo_latency_seconds summary\n")
+	for _, quantile := range []struct {
+		name  string
+		value float64
+	}{
+		{"0.5", slo.LatencyP50},
+		{"0.9", slo.LatencyP90},
+		{"0.99", slo.LatencyP99},
+	} {
+		fmt.Fprintf(rw, "kcc_backend_slo_latency_seconds{quantile=\"%s\"} %v\n", quantile.name, quantile.value)
+	}
+	fmt.Fprintf(rw, "kcc_backend_slo_latency_seconds_count %d\n", slo.Requests)
+
+	fmt.Fprintf(rw, "# HELP kcc_session_events_total Total number of session lifecycle transitions by type.\n# TYPE kcc_session_events_total counter\n")
+	for idx := range s.sessionEvents {
+		fmt.Fprintf(rw, "kcc_session_events_total{type=\"%s\"} %d\n", kcc.SessionEventType(idx+1), atomic.LoadUint64(&s.sessionEvents[idx]))
+	}
+
+	if tasks := s.TaskStats(); len(tasks) > 0 {
+		fmt.Fprintf(rw, "# HELP kcc_task_runs_total Total number of runs of periodic tasks by task.\n# TYPE kcc_task_runs_total counter\n")
+		for _, task := range tasks {
+			fmt.Fprintf(rw, "kcc_task_runs_total{task=\"%s\"} %d\n", labelValueReplacer.Replace(task.Name), task.Runs)
+		}
+		fmt.Fprintf(rw, "# HELP kcc_task_failures_total Total number of failed, timed out or panicked runs of periodic tasks by task.\n# TYPE kcc_task_failures_total counter\n")
+		for _, task := range tasks {
+			fmt.Fprintf(rw, "kcc_task_failures_total{task=\"%s\"} %d\n", labelValueReplacer.Replace(task.Name), task.Failures)
+		}
+		fmt.Fprintf(rw, "# HELP kcc_task_last_duration_seconds Duration of the last run of periodic tasks by task.\n# TYPE kcc_task_last_duration_seconds gauge\n")
+		for _, task := range tasks {
+			fmt.Fprintf(rw, "kcc_task_last_duration_seconds{task=\"%s\"} %v\n", labelValueReplacer.Replace(task.Name), task.LastDuration.Seconds())
+		}
+		fmt.Fprintf(rw, "# HELP kcc_task_last_success_timestamp_seconds Unix time of the start of the last successful run of periodic tasks by task.\n# TYPE kcc_task_last_success_timestamp_seconds gauge\n")
+		for _, task := range tasks {
+			var timestamp int64
+			if !task.LastSuccess.IsZero() {
+				timestamp = task.LastSuccess.Unix()
+			}
+			fmt.Fprintf(rw, "kcc_task_last_success_timestamp_seconds{task=\"%s\"} %d\n", labelValueReplacer.Replace(task.Name), timestamp)
+		}
+	}
+
+	fmt.Fprintf(rw, "# HELP kcc_backend_errors_total Total number of failed requests to the Kopano server by class and code.\n# TYPE kcc_backend_errors_total counter\n")
+	for _, count := range kcc.BackendErrors() {
+		fmt.Fprintf(rw, "kcc_backend_errors_total{class=\"%s\",code=\"%s\"} %d\n", count.Class, count.Code, count.Count)
+	}
+
+	if err := s.soapMetrics.WritePrometheus(rw); err != nil {
+		s.logger.WithError(err).Errorln("metricsHandler request failed writing soap metrics")
+	}
+
+	writeRuntimeMetrics(rw)
+}
+
+// labelValueReplacer escapes label values for the Prometheus text exposition
+// format.
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeRuntimeMetrics writes the metrics of the Go runtime to the provided
+// writer, named like the metrics of the Prometheus Go collector.
+func writeRuntimeMetrics(w io.Writer) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	fmt.Fprintf(w, "# HELP go_info Information about the Go environment.\n# TYPE go_info gauge\ngo_info{version=\"%s\"} 1\n", runtime.Version())
+	for _, metric := range []struct {
+		name  string
+		kind  string
+		help  string
+		value interface{}
+	}{
+		{"go_goroutines", "gauge", "Number of goroutines that currently exist.", runtime.NumGoroutine()},
+		{"go_threads", "gauge", "Number of OS threads created.", pprof.Lookup("threadcreate").Count()},
+		{"go_gomaxprocs", "gauge", "Maximum number of CPUs executing Go code simultaneously.", runtime.GOMAXPROCS(0)},
+		{"go_memstats_alloc_bytes_total", "counter", "Total number of bytes allocated, even if freed.", memStats.TotalAlloc},
+		{"go_memstats_sys_bytes", "gauge", "Number of bytes obtained from system.", memStats.Sys},
+		{"go_memstats_heap_alloc_bytes", "gauge", "Number of heap bytes allocated and still in use.", memStats.HeapAlloc},
+		{"go_memstats_heap_inuse_bytes", "gauge", "Number of heap bytes that are in use.", memStats.HeapInuse},
+		{"go_memstats_heap_sys_bytes", "gauge", "Number of heap bytes obtained from system.", memStats.HeapSys},
+		{"go_memstats_heap_objects", "gauge", "Number of allocated objects.", memStats.HeapObjects},
+		{"go_memstats_next_gc_bytes", "gauge", "Number of heap bytes when next garbage collection will take place.", memStats.NextGC},
+		{"go_memstats_last_gc_time_seconds", "gauge", "Number of seconds since 1970 of last garbage collection.", float64(memStats.LastGC) / 1e9},
+		{"go_memstats_gc_cpu_fraction", "gauge", "The fraction of this program's available CPU time used by the GC since the program started.", memStats.GCCPUFraction},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", metric.name, metric.help, metric.name, metric.kind, metric.name, metric.value)
+	}
+
+	gcStats := &debug.GCStats{
+		PauseQuantiles: make([]time.Duration, 5),
+	}
+	debug.ReadGCStats(gcStats)
+	fmt.Fprintf(w, "# HELP go_gc_duration_seconds A summary of the pause duration of garbage collection cycles.\n# TYPE go_gc_duration_seconds summary\n")
+	for idx, quantile := range []string{"0", "0.25", "0.5", "0.75", "1"} {
+		fmt.Fprintf(w, "go_gc_duration_seconds{quantile=\"%s\"} %v\n", quantile, gcStats.PauseQuantiles[idx].Seconds())
+	}
+	fmt.Fprintf(w, "go_gc_duration_seconds_sum %v\ngo_gc_duration_seconds_count %d\n", gcStats.PauseTotal.Seconds(), gcStats.NumGC)
+}
+
+// sloHandler writes the SLO state of the backend requests of the rolling
+// window, so operators can alert on error budget burn.
+func (s *Server) sloHandler(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(kcc.DefaultSLOTracker.Report())
+	if err != nil {
+		s.logger.WithError(err).Errorln("sloHandler request failed writing response")
+	}
+}
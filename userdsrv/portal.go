@@ -0,0 +1,333 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// Portal cookie settings.
+const (
+	portalPath          = "/portal/"
+	portalSessionCookie = "kuserd_session"
+	portalCSRFCookie    = "kuserd_csrf"
+	portalCSRFField     = "csrf_token"
+	portalSessionMaxAge = 8 * time.Hour
+)
+
+// portalTemplates holds the embedded templates of the HTML portal.
+var portalTemplates = template.Must(template.New("layout").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}} - Kopano</title>
+<style>
+body { font-family: sans-serif; max-width: 24em; margin: 4em auto; padding: 0 1em; }
+label, input, button { display: block; width: 100%; margin: 0.5em 0; box-sizing: border-box; }
+.error { color: #b00; }
+dt { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{template "content" .}}
+</body>
+</html>
+`))
+
+var portalLogonTemplate = template.Must(template.Must(portalTemplates.Clone()).Parse(`{{define "content"}}
+<form method="post" action="logon">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<label for="username">Username</label>
+<input id="username" name="username" autocomplete="username" value="{{.Username}}" required autofocus>
+<label for="password">Password</label>
+<input id="password" name="password" type="password" autocomplete="current-password" required>
+<button type="submit">Log on</button>
+</form>
+{{end}}`))
+
+var portalWhoamiTemplate = template.Must(template.Must(portalTemplates.Clone()).Parse(`{{define "content"}}
+<dl>
+<dt>Username</dt><dd>{{.User.Username}}</dd>
+<dt>Full name</dt><dd>{{.User.FullName}}</dd>
+<dt>Email address</dt><dd>{{.User.MailAddress}}</dd>
+</dl>
+<form method="post" action="logoff">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<button type="submit">Log off</button>
+</form>
+{{end}}`))
+
+type portalPage struct {
+	Title     string
+	Error     string
+	CSRFToken string
+	Username  string
+	User      *kcc.User
+}
+
+// portalSign returns the hex encoded HMAC-SHA256 of the provided value using
+// the portal secret.
+func (s *Server) portalSign(value string) string {
+	mac := hmac.New(sha256.New, s.portalSecret)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Server) setPortalCookie(rw http.ResponseWriter, req *http.Request, name, value string, maxAge time.Duration) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     portalPath,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   req.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s *Server) clearPortalCookie(rw http.ResponseWriter, req *http.Request, name string) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     name,
+		Path:     portalPath,
+		MaxAge:   -1,
+		Secure:   req.TLS != nil,
+		HttpOnly: true,
+	})
+}
+
+// portalCSRFToken returns the CSRF token for the provided request, setting a
+// new CSRF cookie if the request has none. The token is the signature of the
+// random cookie value, so it can only be created by the server and only
+// matches the browser holding the cookie.
+func (s *Server) portalCSRFToken(rw http.ResponseWriter, req *http.Request) (string, error) {
+	if cookie, err := req.Cookie(portalCSRFCookie); err == nil && cookie.Value != "" {
+		return s.portalSign("csrf:" + cookie.Value), nil
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	value := base64.RawURLEncoding.EncodeToString(random)
+	s.setPortalCookie(rw, req, portalCSRFCookie, value, 0)
+
+	return s.portalSign("csrf:" + value), nil
+}
+
+// checkPortalCSRF returns true if the provided form post carries the CSRF
+// token matching its CSRF cookie.
+func (s *Server) checkPortalCSRF(req *http.Request) bool {
+	cookie, err := req.Cookie(portalCSRFCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+
+	return hmac.Equal([]byte(req.PostFormValue(portalCSRFField)), []byte(s.portalSign("csrf:"+cookie.Value)))
+}
+
+// portalSession returns the Kopano session ID and username from the signed
+// session cookie of the provided request.
+func (s *Server) portalSession(req *http.Request) (kcc.KCSessionID, string, bool) {
+	cookie, err := req.Cookie(portalSessionCookie)
+	if err != nil {
+		return 0, "", false
+	}
+
+	// Value is sessionID:expiry:base64(username):signature.
+	parts := strings.Split(cookie.Value, ":")
+	if len(parts) != 4 {
+		return 0, "", false
+	}
+	payload := strings.Join(parts[:3], ":")
+	if !hmac.Equal([]byte(parts[3]), []byte(s.portalSign("session:"+payload))) {
+		return 0, "", false
+	}
+	sessionID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return 0, "", false
+	}
+	username, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, "", false
+	}
+
+	return kcc.KCSessionID(sessionID), string(username), true
+}
+
+func (s *Server) setPortalSession(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID, username string) {
+	payload := sessionID.String() + ":" +
+		strconv.FormatInt(time.Now().Add(portalSessionMaxAge).Unix(), 10) + ":" +
+		base64.RawURLEncoding.EncodeToString([]byte(username))
+	s.setPortalCookie(rw, req, portalSessionCookie, payload+":"+s.portalSign("session:"+payload), portalSessionMaxAge)
+}
+
+func (s *Server) renderPortal(rw http.ResponseWriter, tmpl *template.Template, status int, page *portalPage) {
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("X-Frame-Options", "DENY")
+	rw.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	rw.WriteHeader(status)
+
+	if err := tmpl.Execute(rw, page); err != nil {
+		s.logger.WithError(err).Errorln("portal request failed rendering template")
+	}
+}
+
+func (s *Server) portalIndexHandler(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != portalPath {
+		s.problem(rw, req, http.StatusNotFound, "")
+		return
+	}
+
+	if _, _, ok := s.portalSession(req); ok {
+		http.Redirect(rw, req, "whoami", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(rw, req, "logon", http.StatusSeeOther)
+}
+
+func (s *Server) portalLogonHandler(rw http.ResponseWriter, req *http.Request) {
+	page := &portalPage{
+		Title: "Log on",
+	}
+
+	csrfToken, err := s.portalCSRFToken(rw, req)
+	if err != nil {
+		s.logger.WithError(err).Errorln("portalLogonHandler request failed to create csrf token")
+		s.problem(rw, req, http.StatusInternalServerError, "")
+		return
+	}
+	page.CSRFToken = csrfToken
+
+	switch req.Method {
+	case http.MethodGet:
+		s.renderPortal(rw, portalLogonTemplate, http.StatusOK, page)
+		return
+	case http.MethodPost:
+	default:
+		rw.Header().Set("Allow", "GET, POST")
+		s.problem(rw, req, http.StatusMethodNotAllowed, "")
+		return
+	}
+
+	if !s.checkPortalCSRF(req) {
+		s.problem(rw, req, http.StatusForbidden, "invalid csrf token")
+		return
+	}
+
+	page.Username = req.PostFormValue("username")
+	response, err := s.c.Logon(s.withClientInfo(req), page.Username, req.PostFormValue("password"), 0)
+	if err != nil {
+		s.logger.WithError(err).Errorln("portalLogonHandler request logon failed")
+		s.problem(rw, req, http.StatusInternalServerError, "")
+		return
+	}
+	switch response.Er {
+	case kcc.KCSuccess:
+	case kcc.KCERR_LOGON_FAILED:
+		page.Error = translate(requestLanguage(req), "Logon failed, check username and password.")
+		s.renderPortal(rw, portalLogonTemplate, http.StatusUnauthorized, page)
+		return
+	default:
+		s.logger.WithError(response.Er).Errorln("portalLogonHandler request logon mapi error")
+		s.errorProblem(rw, req, http.StatusInternalServerError, response.Er)
+		return
+	}
+
+	s.setPortalSession(rw, req, response.SessionID, page.Username)
+	http.Redirect(rw, req, "whoami", http.StatusSeeOther)
+}
+
+func (s *Server) portalLogoffHandler(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		s.problem(rw, req, http.StatusMethodNotAllowed, "")
+		return
+	}
+	if !s.checkPortalCSRF(req) {
+		s.problem(rw, req, http.StatusForbidden, "invalid csrf token")
+		return
+	}
+
+	if sessionID, _, ok := s.portalSession(req); ok {
+		// Always log off, even when the request was canceled.
+		if _, err := s.c.Logoff(context.Background(), sessionID); err != nil {
+			s.logger.WithError(err).Warnln("portalLogoffHandler request logoff failed")
+		}
+	}
+
+	s.clearPortalCookie(rw, req, portalSessionCookie)
+	http.Redirect(rw, req, "logon", http.StatusSeeOther)
+}
+
+func (s *Server) portalWhoamiHandler(rw http.ResponseWriter, req *http.Request) {
+	sessionID, username, ok := s.portalSession(req)
+	if !ok {
+		http.Redirect(rw, req, "logon", http.StatusSeeOther)
+		return
+	}
+
+	page := &portalPage{
+		Title: "Who am I",
+	}
+	csrfToken, err := s.portalCSRFToken(rw, req)
+	if err != nil {
+		s.logger.WithError(err).Errorln("portalWhoamiHandler request failed to create csrf token")
+		s.problem(rw, req, http.StatusInternalServerError, "")
+		return
+	}
+	page.CSRFToken = csrfToken
+
+	results, err := s.c.GetUsersByName(req.Context(), []string{username}, sessionID)
+	if err == nil && results[0].Err != nil {
+		err = results[0].Err
+	}
+	switch err {
+	case nil:
+	case kcc.KCERR_END_OF_SESSION:
+		// Session has ended on the server, log on again.
+		s.clearPortalCookie(rw, req, portalSessionCookie)
+		http.Redirect(rw, req, "logon", http.StatusSeeOther)
+		return
+	default:
+		s.logger.WithError(err).Errorln("portalWhoamiHandler request get user failed")
+		s.errorProblem(rw, req, http.StatusInternalServerError, err)
+		return
+	}
+	page.User = results[0].User
+
+	s.renderPortal(rw, portalWhoamiTemplate, http.StatusOK, page)
+}
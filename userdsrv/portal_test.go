@@ -0,0 +1,94 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPortalCSRF(t *testing.T) {
+	ts := newTestSOAPServer(map[string]string{
+		"logon":  testLogonResponse,
+		"logoff": testLogoffResponse,
+	})
+	defer ts.Close()
+	s, handler := newTestServer(t, ts, &Config{Portal: true, PortalSecret: []byte("secret")})
+
+	// Get the CSRF cookie and its token from the logon form.
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, portalPath+"logon", nil))
+	if rw.Code != http.StatusOK {
+		t.Fatalf("logon form status mismatch: got %d want %d", rw.Code, http.StatusOK)
+	}
+	var cookie *http.Cookie
+	for _, c := range rw.Result().Cookies() {
+		if c.Name == portalCSRFCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatalf("logon form did not set csrf cookie")
+	}
+	token := s.portalSign("csrf:" + cookie.Value)
+	if !strings.Contains(rw.Body.String(), token) {
+		t.Errorf("logon form does not contain csrf token")
+	}
+	otherToken := s.portalSign("csrf:other")
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		cookie *http.Cookie
+		token  string
+		status int
+	}{
+		{"logon without cookie", "logon", nil, token, http.StatusForbidden},
+		{"logon without token", "logon", cookie, "", http.StatusForbidden},
+		{"logon with token of other cookie", "logon", cookie, otherToken, http.StatusForbidden},
+		{"logon with unsigned token", "logon", cookie, cookie.Value, http.StatusForbidden},
+		{"logoff with token of other cookie", "logoff", cookie, otherToken, http.StatusForbidden},
+		{"logon", "logon", cookie, token, http.StatusSeeOther},
+		{"logoff", "logoff", cookie, token, http.StatusSeeOther},
+	} {
+		form := url.Values{
+			"username": {"user1"},
+			"password": {"pass"},
+		}
+		if tc.token != "" {
+			form.Set(portalCSRFField, tc.token)
+		}
+		req := httptest.NewRequest(http.MethodPost, portalPath+tc.path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tc.cookie != nil {
+			req.AddCookie(tc.cookie)
+		}
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		if rw.Code != tc.status {
+			t.Errorf("%s: status mismatch: got %d want %d", tc.name, rw.Code, tc.status)
+		}
+	}
+
+	if logons := ts.count("logon"); logons != 1 {
+		t.Errorf("logon requests mismatch: got %d want %d", logons, 1)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// ReadUsernames reads the usernames of the provided file, one per line.
+// Empty lines and lines starting with # are ignored.
+func ReadUsernames(fn string) ([]string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var usernames []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		usernames = append(usernames, line)
+	}
+
+	return usernames, scanner.Err()
+}
+
+// writeUsernames replaces the provided file with the provided usernames, one
+// per line.
+func writeUsernames(fn string, usernames []string) error {
+	f, err := ioutil.TempFile(filepath.Dir(fn), filepath.Base(fn)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w := bufio.NewWriter(f)
+	w.WriteString("# Most requested users of kuserd, preloaded at startup.\n")
+	for _, username := range usernames {
+		w.WriteString(username + "\n")
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), fn)
+}
+
+// preloadUsers fetches the users of the preload list and of the top users
+// saved by the previous run into the user cache, using the provided session.
+func (s *Server) preloadUsers(ctx context.Context, session *kcc.Session) {
+	seen := make(map[string]bool)
+	var usernames []string
+	for _, username := range s.preloadUsernames {
+		if !seen[username] {
+			seen[username] = true
+			usernames = append(usernames, username)
+		}
+	}
+	if s.preloadTopPath != "" {
+		top, err := ReadUsernames(s.preloadTopPath)
+		if err != nil && !os.IsNotExist(err) {
+			s.logger.WithError(err).Warnln("failed to read top users for preload")
+		}
+		for _, username := range top {
+			if !seen[username] {
+				seen[username] = true
+				usernames = append(usernames, username)
+			}
+		}
+	}
+	if len(usernames) == 0 {
+		return
+	}
+
+	started := time.Now()
+	loaded, err := s.users.Preload(ctx, s.c, usernames, session.ID())
+	logger := s.logger.WithFields(logrus.Fields{
+		"users":    len(usernames),
+		"loaded":   loaded,
+		"duration": time.Since(started),
+	})
+	if err != nil {
+		logger.WithError(err).Warnln("user cache preload incomplete")
+		return
+	}
+	logger.Infoln("user cache preloaded")
+}
+
+// saveTopUsers saves the most requested users, so the next run can preload
+// them.
+func (s *Server) saveTopUsers() {
+	if err := s.writeTopUsers(); err != nil {
+		s.logger.WithError(err).Warnln("failed to save top users for preload")
+	}
+}
+
+// writeTopUsers writes the most requested users to the preload top file, if
+// any.
+func (s *Server) writeTopUsers() error {
+	if s.users == nil || s.preloadTopPath == "" {
+		return nil
+	}
+
+	top := s.users.TopUsers(s.preloadTop)
+	if len(top) == 0 {
+		// Keep the users of the previous run, nothing was requested.
+		return nil
+	}
+	if err := writeUsernames(s.preloadTopPath, top); err != nil {
+		return err
+	}
+	s.logger.WithField("users", len(top)).Debugln("top users for preload saved")
+	return nil
+}
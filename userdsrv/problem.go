@@ -0,0 +1,186 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// problemTypePrefix is the prefix of the type URIs of problem details. The
+// problem types are documented in README.md.
+const problemTypePrefix = "urn:kopano:kuserd:problem:"
+
+// problemStatusTypes maps HTTP status codes to problem types, used for errors
+// which are not caused by the Kopano server.
+var problemStatusTypes = map[int]string{
+	http.StatusBadRequest:           "bad-request",
+	http.StatusUnauthorized:         "unauthorized",
+	http.StatusForbidden:            "forbidden",
+	http.StatusNotFound:             "not-found",
+	http.StatusMethodNotAllowed:     "method-not-allowed",
+	http.StatusUnsupportedMediaType: "unsupported-media-type",
+	http.StatusConflict:             "conflict",
+	http.StatusUnprocessableEntity:  "unprocessable",
+	http.StatusServiceUnavailable:   "unavailable",
+	http.StatusGatewayTimeout:       "timeout",
+}
+
+// A kcProblemClass groups KC errors which API consumers handle alike.
+type kcProblemClass struct {
+	Type  string
+	Title string
+}
+
+// Problem classes of KC errors.
+var (
+	kcProblemNotFound     = &kcProblemClass{"kc-not-found", "Object not found"}
+	kcProblemNoAccess     = &kcProblemClass{"kc-no-access", "Access denied"}
+	kcProblemLogonFailed  = &kcProblemClass{"kc-logon-failed", "Logon failed"}
+	kcProblemSessionEnded = &kcProblemClass{"kc-session-ended", "Session ended"}
+	kcProblemInvalid      = &kcProblemClass{"kc-invalid", "Invalid request"}
+	kcProblemUnsupported  = &kcProblemClass{"kc-unsupported", "Not supported"}
+	kcProblemBusy         = &kcProblemClass{"kc-busy", "Server busy"}
+	kcProblemConflict     = &kcProblemClass{"kc-conflict", "Conflict"}
+	kcProblemQuota        = &kcProblemClass{"kc-quota", "Quota exceeded"}
+	kcProblemError        = &kcProblemClass{"kc-error", "Server error"}
+)
+
+// kcProblemClasses maps KC errors to their problem class. KC errors not listed
+// are of class kcProblemError.
+var kcProblemClasses = map[kcc.KCError]*kcProblemClass{
+	kcc.KCERR_NOT_FOUND:             kcProblemNotFound,
+	kcc.KCERR_UNKNOWN_OBJECT:        kcProblemNotFound,
+	kcc.KCERR_OBJECT_DELETED:        kcProblemNotFound,
+	kcc.KCERR_NO_ACCESS:             kcProblemNoAccess,
+	kcc.KCERR_LOGON_FAILED:          kcProblemLogonFailed,
+	kcc.KCERR_END_OF_SESSION:        kcProblemSessionEnded,
+	kcc.KCERR_INVALID_PARAMETER:     kcProblemInvalid,
+	kcc.KCERR_INVALID_TYPE:          kcProblemInvalid,
+	kcc.KCERR_INVALID_ENTRYID:       kcProblemInvalid,
+	kcc.KCERR_INVALID_BOOKMARK:      kcProblemInvalid,
+	kcc.KCERR_BAD_VALUE:             kcProblemInvalid,
+	kcc.KCERR_UNKNOWN_FLAGS:         kcProblemInvalid,
+	kcc.KCERR_NO_SUPPORT:            kcProblemUnsupported,
+	kcc.KCERR_NOT_IMPLEMENTED:       kcProblemUnsupported,
+	kcc.KCERR_BUSY:                  kcProblemBusy,
+	kcc.KCERR_TIMEOUT:               kcProblemBusy,
+	kcc.KCERR_SERVER_NOT_RESPONDING: kcProblemBusy,
+	kcc.KCERR_NETWORK_ERROR:         kcProblemBusy,
+	kcc.KCERR_COLLISION:             kcProblemConflict,
+	kcc.KCERR_HAS_MESSAGES:          kcProblemConflict,
+	kcc.KCERR_HAS_FOLDERS:           kcProblemConflict,
+	kcc.KCERR_HAS_RECIPIENTS:        kcProblemConflict,
+	kcc.KCERR_HAS_ATTACHMENTS:       kcProblemConflict,
+	kcc.KCERR_FOLDER_CYCLE:          kcProblemConflict,
+	kcc.KCERR_STORE_FULL:            kcProblemQuota,
+	kcc.KCERR_TOO_BIG:               kcProblemQuota,
+}
+
+// problemDetails is an error response as defined by RFC 7807. Er is an
+// extension member holding the KC error code, if the problem was caused by
+// one. Errors is an extension member holding the fields of the request which
+// failed validation.
+type problemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Er     uint64 `json:"er,omitempty"`
+
+	Errors []*fieldError `json:"errors,omitempty"`
+}
+
+// newProblem creates problem details for the provided HTTP status with the
+// optional provided detail in the provided language. The detail is translated
+// before it is formatted with the provided args.
+func newProblem(language string, status int, detail string, args ...interface{}) *problemDetails {
+	problemType, ok := problemStatusTypes[status]
+	if !ok {
+		problemType = "internal"
+	}
+	if detail != "" {
+		detail = translate(language, detail)
+		if len(args) > 0 {
+			detail = fmt.Sprintf(detail, args...)
+		}
+	}
+
+	return &problemDetails{
+		Type:   problemTypePrefix + problemType,
+		Title:  translate(language, http.StatusText(status)),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// newErrorProblem creates problem details for the provided HTTP status and
+// error in the provided language. KC errors get the type of their class,
+// other errors are not exposed.
+func newErrorProblem(language string, status int, err error) *problemDetails {
+	er, ok := err.(kcc.KCError)
+	if !ok {
+		return newProblem(language, status, "")
+	}
+
+	class, ok := kcProblemClasses[er]
+	if !ok {
+		class = kcProblemError
+	}
+
+	return &problemDetails{
+		Type:   problemTypePrefix + class.Type,
+		Title:  translate(language, class.Title),
+		Status: status,
+		Detail: er.Error(),
+		Er:     uint64(er),
+	}
+}
+
+// writeProblem writes the provided problem as application/problem+json with
+// the provided HTTP status in the provided language.
+func (s *Server) writeProblem(rw http.ResponseWriter, language string, status int, problem interface{}) {
+	rw.Header().Set("Content-Type", "application/problem+json")
+	rw.Header().Set("Content-Language", language)
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(status)
+
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(problem)
+	if err != nil {
+		s.logger.WithError(err).Errorln("request failed writing problem response")
+	}
+}
+
+// problem responds to the provided request with problem details for the
+// provided HTTP status with the optional provided detail, formatted with the
+// provided args.
+func (s *Server) problem(rw http.ResponseWriter, req *http.Request, status int, detail string, args ...interface{}) {
+	language := requestLanguage(req)
+	s.writeProblem(rw, language, status, newProblem(language, status, detail, args...))
+}
+
+// errorProblem responds to the provided request with problem details for the
+// provided HTTP status and error.
+func (s *Server) errorProblem(rw http.ResponseWriter, req *http.Request, status int, err error) {
+	language := requestLanguage(req)
+	s.writeProblem(rw, language, status, newErrorProblem(language, status, err))
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// A sendAsResponse is the JSON response of send as requests.
+type sendAsResponse struct {
+	Sender  string           `json:"sender"`
+	Address string           `json:"address"`
+	Owner   string           `json:"owner,omitempty"`
+	Allowed bool             `json:"allowed"`
+	Reason  kcc.SendAsReason `json:"reason,omitempty"`
+}
+
+var sendAsParams = []*queryParam{
+	{name: "sender", required: true},
+	{name: "address", required: true},
+}
+
+func (s *Server) sendAsHandler(rw http.ResponseWriter, req *http.Request) {
+	if !s.validateRequest(rw, req, sendAsParams, nil, nil) {
+		return
+	}
+	sender := req.URL.Query().Get("sender")
+	address := req.URL.Query().Get("address")
+
+	s.runWithSession(rw, req, "sendAsHandler", func(session *kcc.Session) error {
+		permission, err := s.c.CheckSendAs(req.Context(), sender, address, session.ID())
+		switch err {
+		case nil:
+		case kcc.KCERR_NOT_FOUND:
+			s.errorProblem(rw, req, http.StatusNotFound, err)
+			return nil
+		case kcc.ErrAmbiguousAlias:
+			s.errorProblem(rw, req, http.StatusConflict, err)
+			return nil
+		default:
+			return err
+		}
+
+		response := &sendAsResponse{
+			Sender:  sender,
+			Address: address,
+			Allowed: permission.Allowed,
+			Reason:  permission.Reason,
+		}
+		if permission.Owner != nil {
+			response.Owner = permission.Owner.Username
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+
+		enc := json.NewEncoder(rw)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(response); err != nil {
+			s.logger.WithError(err).Errorln("sendAsHandler request failed writing response")
+		}
+		return nil
+	}, nil)
+}
@@ -0,0 +1,565 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/longsleep/go-metrics/loggedwriter"
+	"github.com/longsleep/go-metrics/timing"
+	"github.com/sirupsen/logrus"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// Server represents the base for a HTTP server providing web service endpoints
+// utilizing Kopano Server via kcc.
+type Server struct {
+	c           *kcc.KCC
+	soapMetrics *kcc.SOAPMetrics
+	listenAddr  string
+	logger      logrus.FieldLogger
+
+	session            *kcc.Session
+	sessionMutex       sync.RWMutex
+	sessionEvents      [4]uint64
+	withServerSession  int32
+	maintenance        int32
+	draining           int32
+	drainDelay         time.Duration
+	backend            backendHealth
+	withRequestMetrics bool
+	requestTimeout     time.Duration
+	trustedProxies     []*net.IPNet
+	stateDumpPath      string
+
+	calendarTokenSecret []byte
+	calendarLocation    *time.Location
+
+	withAdminAPI  bool
+	idempotency   *idempotencyStore
+	signingSecret []byte
+	signingSkew   time.Duration
+	signingNonces *nonceCache
+
+	withPortal   bool
+	portalSecret []byte
+
+	spaAssets http.FileSystem
+	spaMaxAge time.Duration
+
+	legacyAPISunset time.Time
+
+	customHandlers []*customHandler
+
+	users            *kcc.UserCache
+	diskUsers        *kcc.DiskUserCache
+	resolvedNames    *resolvedNames
+	preloadUsernames []string
+	preloadTopPath   string
+	preloadTop       int
+
+	tasks taskScheduler
+
+	tracer kcc.Tracer
+}
+
+// Config bundles the optional settings of a Server. Features are disabled
+// when their settings are left empty.
+type Config struct {
+	// TrustedProxies are the networks of reverse proxies whose forwarding
+	// headers are used to find the client address, see ParseTrustedProxies.
+	TrustedProxies []*net.IPNet
+	// RequestTimeout limits the time to handle a request.
+	RequestTimeout time.Duration
+	// DrainDelay is the time Serve keeps handling requests after a signal to
+	// shut down, while reporting not to be ready so load balancers stop
+	// sending new requests.
+	DrainDelay time.Duration
+	// StateDumpPath is the file state dumps requested with SIGQUIT or the
+	// admin API are written to, replacing the previous dump. If empty, state
+	// dumps are logged.
+	StateDumpPath string
+
+	// AdminAPI enables the admin endpoints.
+	AdminAPI bool
+	// AdminSigningSecret requires admin requests to be signed with it, with
+	// timestamps deviating at most AdminSigningSkew.
+	AdminSigningSecret []byte
+	AdminSigningSkew   time.Duration
+	// IdempotencyTTL is the time responses of admin requests with an
+	// Idempotency-Key header are remembered.
+	IdempotencyTTL time.Duration
+
+	// Portal enables the HTML portal. Its cookies are signed with PortalSecret,
+	// a random secret is used if empty.
+	Portal       bool
+	PortalSecret []byte
+
+	// LegacyAPISunset is announced for the unversioned legacy API paths.
+	LegacyAPISunset time.Time
+
+	// SPAAssets are served as single-page app, with assets cached by clients
+	// for SPAMaxAge. See EmbeddedSPAAssets.
+	SPAAssets http.FileSystem
+	SPAMaxAge time.Duration
+
+	// CalendarTokenSecret enables calendar subscriptions, with tokens signed
+	// with it. Events are rendered in CalendarLocation, time.Local if nil.
+	CalendarTokenSecret []byte
+	CalendarLocation    *time.Location
+
+	// UserCache caches users for the user endpoints, persisted with
+	// DiskUserCache if not nil. PreloadUsernames are loaded into the cache
+	// once the server session is established, together with the users saved
+	// to PreloadTopPath. The PreloadTop most requested users are saved to
+	// PreloadTopPath on shutdown.
+	UserCache        *kcc.UserCache
+	DiskUserCache    *kcc.DiskUserCache
+	PreloadUsernames []string
+	PreloadTopPath   string
+	PreloadTop       int
+
+	// Tracer wraps requests and the SOAP requests made for them in spans,
+	// continuing traces propagated by clients. See kcc.Tracer.
+	Tracer kcc.Tracer
+}
+
+// NewServer creates a new Server with the provided parameters and optional
+// config.
+func NewServer(listenAddr string, serverURI *url.URL, logger logrus.FieldLogger, config *Config) (*Server, error) {
+	if config == nil {
+		config = &Config{}
+	}
+
+	soapMetrics := kcc.NewSOAPMetrics()
+	soap, err := kcc.NewSOAPClientWithConfig(serverURI, &kcc.SOAPClientConfig{
+		Metrics: soapMetrics,
+		Tracer:  config.Tracer,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		c:           kcc.NewKCCWithClient(soap),
+		soapMetrics: soapMetrics,
+		listenAddr:  listenAddr,
+		logger:      logger,
+
+		requestTimeout: config.RequestTimeout,
+		drainDelay:     config.DrainDelay,
+		trustedProxies: config.TrustedProxies,
+		stateDumpPath:  config.StateDumpPath,
+
+		withAdminAPI: config.AdminAPI,
+
+		withPortal:   config.Portal,
+		portalSecret: config.PortalSecret,
+
+		spaAssets: config.SPAAssets,
+		spaMaxAge: config.SPAMaxAge,
+
+		legacyAPISunset: config.LegacyAPISunset,
+
+		calendarTokenSecret: config.CalendarTokenSecret,
+		calendarLocation:    config.CalendarLocation,
+
+		users:            config.UserCache,
+		diskUsers:        config.DiskUserCache,
+		preloadUsernames: config.PreloadUsernames,
+		preloadTopPath:   config.PreloadTopPath,
+		preloadTop:       config.PreloadTop,
+
+		tracer: config.Tracer,
+	}
+	if len(config.AdminSigningSecret) > 0 {
+		s.signingSecret = config.AdminSigningSecret
+		s.signingSkew = config.AdminSigningSkew
+		s.signingNonces = newNonceCache()
+	}
+	if config.IdempotencyTTL > 0 {
+		s.idempotency = newIdempotencyStore(config.IdempotencyTTL)
+	}
+	if s.withPortal && len(s.portalSecret) == 0 {
+		s.portalSecret = make([]byte, 32)
+		if _, err = rand.Read(s.portalSecret); err != nil {
+			return nil, fmt.Errorf("failed to create portal secret: %v", err)
+		}
+	}
+	if s.calendarLocation == nil {
+		s.calendarLocation = time.Local
+	}
+	if s.users != nil {
+		s.resolvedNames = newResolvedNames()
+	}
+	s.addBuiltinTasks()
+
+	s.c.SetClientApp("kcc-go-kuserd", kcc.Version)
+	s.c.SetSessionEventHandler(s.sessionEvent)
+
+	logger.WithField("client", s.c.String()).Infoln("backend server connection set up")
+
+	return s, nil
+}
+
+func (s *Server) addContext(parent context.Context, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// Create per request context.
+		ctx, cancel := context.WithCancel(parent)
+		if s.requestTimeout > 0 {
+			ctx, cancel = context.WithTimeout(parent, s.requestTimeout)
+		}
+		loggedWriter := metrics.NewLoggedResponseWriter(rw)
+		var span kcc.TraceSpan
+		if s.tracer != nil {
+			ctx, span = s.startSpan(ctx, req)
+		}
+
+		if s.withRequestMetrics {
+			// Create per request context.
+			ctx = timing.NewContext(ctx, func(duration time.Duration) {
+				// This is the stop callback, called when complete with duration.
+				durationMs := float64(duration) / float64(time.Millisecond)
+				// Log request.
+				s.logger.WithFields(logrus.Fields{
+					"status":     loggedWriter.Status(),
+					"method":     req.Method,
+					"path":       req.URL.Path,
+					"remote":     s.clientIP(req),
+					"duration":   durationMs,
+					"user-agent": req.UserAgent(),
+				}).Debug("HTTP request complete")
+			})
+		}
+		// Cancel per request context when done.
+		defer cancel()
+		if span != nil {
+			defer endSpan(span, loggedWriter)
+		}
+		// Run the request, turning panics into errors.
+		defer s.recoverPanic(loggedWriter, req)
+		next.ServeHTTP(loggedWriter, req.WithContext(ctx))
+	})
+}
+
+// recoverPanic recovers a panic of a request handler, reporting it with
+// kcc.ReportPanic and responding with an internal server error. It must be
+// called deferred.
+func (s *Server) recoverPanic(rw http.ResponseWriter, req *http.Request) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	if value == http.ErrAbortHandler {
+		// Let net/http abort the response silently.
+		panic(value)
+	}
+
+	kcc.ReportPanic(kcc.NewPanicError(value))
+	s.logger.WithFields(logrus.Fields{
+		"method": req.Method,
+		"path":   req.URL.Path,
+	}).Errorln("request handler panic recovered")
+
+	s.problem(rw, req, http.StatusInternalServerError, "")
+}
+
+func (s *Server) setSession(session *kcc.Session) {
+	s.sessionMutex.Lock()
+	s.session = session
+	s.sessionMutex.Unlock()
+}
+
+func (s *Server) getSession() *kcc.Session {
+	s.sessionMutex.RLock()
+	session := s.session
+	s.sessionMutex.RUnlock()
+	return session
+}
+
+// sessionEvent logs and counts the provided session lifecycle event.
+func (s *Server) sessionEvent(event *kcc.SessionEvent) {
+	if idx := int(event.Type) - 1; idx >= 0 && idx < len(s.sessionEvents) {
+		atomic.AddUint64(&s.sessionEvents[idx], 1)
+	}
+
+	logger := s.logger.WithFields(logrus.Fields{
+		"event":   event.Type.String(),
+		"session": event.SessionID.String(),
+	})
+	if event.Err != nil {
+		logger.WithError(event.Err).Warnln("session event")
+	} else {
+		logger.Debugln("session event")
+	}
+}
+
+// Handler returns a handler serving all endpoints of the accociated Server,
+// to embed them into the HTTP server of another application. Request contexts
+// are derived from the provided context. Serve uses Handler, applications not
+// using Serve establish the server session with RunSession.
+func (s *Server) Handler(ctx context.Context) http.Handler {
+	mux := http.NewServeMux()
+
+	// API endpoints are served with versioned prefix, the unversioned legacy
+	// paths are deprecated aliases.
+	handle := func(pattern string, handler http.Handler) {
+		mux.Handle(apiPrefix+pattern, handler)
+		mux.Handle(pattern, s.withDeprecation(apiPrefix+pattern, handler))
+	}
+
+	mux.Handle("/metrics", s.withMethods(methodsRead, nil, http.HandlerFunc(s.metricsHandler)))
+	mux.Handle("/health-check", s.withMethods(methodsRead, nil, http.HandlerFunc(s.healthCheckHandler)))
+	mux.Handle("/api", s.addContext(ctx, s.withMethods(methodsRead, nil, http.HandlerFunc(s.apiVersionsHandler))))
+	mux.Handle("/api/", s.addContext(ctx, s.withMethods(methodsRead, nil, http.HandlerFunc(s.apiVersionsHandler))))
+
+	// NOTE(longsleep): Logon only accepts POST, so credentials are not sent
+	// with requests which might be prefetched or replayed by browsers and
+	// proxies.
+	handle("/logon", s.addContext(ctx, s.withMethods(methodsPost, contentTypesJSON, s.withMaintenance(http.HandlerFunc(s.logonHandler)))))
+	handle("/logoff", s.addContext(ctx, s.withMethods(methodsReadPost, contentTypesJSON, s.withMaintenance(http.HandlerFunc(s.logoffHandler)))))
+	handle("/userinfo", s.addContext(ctx, s.withMethods(methodsRead, nil, s.withMaintenance(http.HandlerFunc(s.userinfoHandler)))))
+	handle("/error", s.addContext(ctx, s.withMethods(methodsRead, nil, http.HandlerFunc(s.errorSenseHandler))))
+	handle("/errors", s.addContext(ctx, s.withMethods(methodsRead, nil, http.HandlerFunc(s.errorsList))))
+	handle("/version", s.addContext(ctx, s.withMethods(methodsRead, nil, http.HandlerFunc(s.versionHandler))))
+	handle("/slo", s.addContext(ctx, s.withMethods(methodsRead, nil, http.HandlerFunc(s.sloHandler))))
+	handle("/ab-resolve-names", s.addContext(ctx, s.withMethods(methodsRead, nil, s.withMaintenance(http.HandlerFunc(s.abResolveNamesHandler)))))
+	handle("/users", s.addContext(ctx, s.withMethods(methodsRead, nil, s.withMaintenance(http.HandlerFunc(s.usersHandler)))))
+	handle("/sendas", s.addContext(ctx, s.withMethods(methodsRead, nil, s.withMaintenance(http.HandlerFunc(s.sendAsHandler)))))
+	if s.withAdminAPI {
+		admin := func(level kcc.AdminLevel, next func(http.ResponseWriter, *http.Request, kcc.KCSessionID)) http.Handler {
+			return s.addContext(ctx, s.withMethods(methodsPost, contentTypesJSON, s.withSignature(s.withAdminSession(level, s.withIdempotency(next)))))
+		}
+		// NOTE(longsleep): Kopano server only allows system administrators to
+		// purge.
+		handle("/admin/purge-softdelete", admin(kcc.ADMIN_LEVEL_SYSADMIN, s.purgeSoftDeleteHandler))
+		handle("/admin/purge-deferred-updates", admin(kcc.ADMIN_LEVEL_SYSADMIN, s.purgeDeferredUpdatesHandler))
+		handle("/admin/purge-cache", admin(kcc.ADMIN_LEVEL_SYSADMIN, s.purgeCacheHandler))
+		handle("/admin/features", admin(kcc.ADMIN_LEVEL_SYSADMIN, s.featuresHandler))
+		handle("/admin/maintenance", admin(kcc.ADMIN_LEVEL_SYSADMIN, s.maintenanceHandler))
+		handle("/admin/state", admin(kcc.ADMIN_LEVEL_SYSADMIN, s.stateHandler))
+		// User administration is delegated to company admins, restricted to
+		// their own company.
+		handle("/admin/create-user", admin(kcc.ADMIN_LEVEL_ADMIN, s.createUserHandler))
+		handle("/admin/update-user", admin(kcc.ADMIN_LEVEL_ADMIN, s.updateUserHandler))
+		handle("/admin/set-quota", admin(kcc.ADMIN_LEVEL_ADMIN, s.setQuotaHandler))
+		// NOTE(longsleep): Props of any object can be read, so this is not
+		// delegated to company admins.
+		handle("/admin/props", admin(kcc.ADMIN_LEVEL_SYSADMIN, s.propsHandler))
+	}
+	for _, custom := range s.customHandlers {
+		handle(custom.pattern, s.addContext(ctx, s.withMethods(custom.methods, custom.contentTypes, s.withMaintenance(custom.handler))))
+	}
+	if len(s.calendarTokenSecret) > 0 {
+		handle("/calendar.ics", s.addContext(ctx, s.withMethods(methodsRead, nil, s.withMaintenance(http.HandlerFunc(s.calendarHandler)))))
+	}
+	if s.withPortal {
+		mux.Handle(portalPath, s.addContext(ctx, s.withMethods(methodsRead, nil, http.HandlerFunc(s.portalIndexHandler))))
+		mux.Handle(portalPath+"logon", s.addContext(ctx, s.withMethods(methodsReadPost, contentTypesForm, s.withMaintenance(http.HandlerFunc(s.portalLogonHandler)))))
+		mux.Handle(portalPath+"logoff", s.addContext(ctx, s.withMethods(methodsPost, contentTypesForm, s.withMaintenance(http.HandlerFunc(s.portalLogoffHandler)))))
+		mux.Handle(portalPath+"whoami", s.addContext(ctx, s.withMethods(methodsRead, nil, s.withMaintenance(http.HandlerFunc(s.portalWhoamiHandler)))))
+	}
+	if s.spaAssets != nil {
+		mux.Handle("/", s.addContext(ctx, s.spaHandler(s.spaAssets, s.spaMaxAge)))
+	}
+
+	return mux
+}
+
+// RunSession establishes a server session with the provided credentials and
+// keeps it up, creating a new one whenever it ends, until the provided context
+// is done. Requests of the user endpoints are made with the server session.
+// Users to preload are loaded once the first server session is established.
+// RunSession blocks and saves the most requested users for preloading before
+// it returns.
+func (s *Server) RunSession(ctx context.Context, username string, password string) {
+	logger := s.logger
+
+	logger.WithField("username", username).Infoln("server session enabled")
+	atomic.StoreInt32(&s.withServerSession, 1)
+	defer s.saveTopUsers()
+
+	retry := time.NewTimer(5 * time.Second)
+	retry.Stop()
+	refreshCh := make(chan bool, 1)
+	preloaded := false
+	for {
+		s.setSession(nil)
+		session, sessionErr := kcc.NewSession(ctx, s.c, username, password)
+		if sessionErr != nil {
+			logger.WithError(sessionErr).Errorln("failed to create server session")
+			retry.Reset(5 * time.Second)
+		} else {
+			s.logger.Debugf("server session established: %v", session)
+			s.setSession(session)
+			s.backend.markUp()
+			if s.users != nil && !preloaded {
+				preloaded = true
+				go s.preloadUsers(ctx, session)
+			}
+			go func() {
+				<-session.Context().Done()
+				s.logger.Debugf("server session has ended: %v", session)
+				refreshCh <- true
+			}()
+		}
+
+		select {
+		case <-refreshCh:
+			// will retry instantly.
+		case <-retry.C:
+			// will retry instantly.
+		case <-ctx.Done():
+			// give up.
+			return
+		}
+	}
+}
+
+// Serve is the accociated Server's main blocking runner. It listens on the
+// listen address of the accociated Server until SIGINT or SIGTERM is received
+// and runs the server session with the provided credentials, if the username
+// is not empty. SIGQUIT writes a state dump, see DumpState. The periodic tasks
+// are run like with RunTasks.
+func (s *Server) Serve(ctx context.Context, username string, password string) error {
+	serveCtx, serveCtxCancel := context.WithCancel(ctx)
+	defer serveCtxCancel()
+
+	logger := s.logger
+
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signalCh)
+
+	// HTTP listener.
+	srv := &http.Server{
+		Handler: s.Handler(serveCtx),
+	}
+
+	logger.WithField("listenAddr", s.listenAddr).Infoln("starting http listener")
+	listener, err := net.Listen("tcp", s.listenAddr)
+	if err != nil {
+		return err
+	}
+
+	// NOTE(longsleep): Subsystems are stopped in reverse order, so the HTTP
+	// listener is shut down before the server session runner, which saves
+	// the top users once requests are done.
+	runner := &subsystemRunner{
+		logger:          logger,
+		shutdownTimeout: 10 * time.Second,
+		abort:           signalCh,
+	}
+	if username != "" {
+		runner.add(&subsystem{
+			name: "session",
+			run: func(ctx context.Context) error {
+				s.RunSession(ctx, username, password)
+				return nil
+			},
+		})
+	} else {
+		runner.add(&subsystem{
+			name: "top users",
+			run: func(ctx context.Context) error {
+				<-ctx.Done()
+				s.saveTopUsers()
+				return nil
+			},
+		})
+	}
+	runner.add(&subsystem{
+		name: "tasks",
+		run:  s.RunTasks,
+	})
+	runner.add(&subsystem{
+		name: "http",
+		run: func(ctx context.Context) error {
+			serveErr := srv.Serve(listener)
+			logger.Debugln("http listener stopped")
+			if serveErr == http.ErrServerClosed {
+				return nil
+			}
+			return serveErr
+		},
+		shutdown: func(ctx context.Context) error {
+			// Shutdown, server will stop to accept new connections, requires
+			// Go 1.8+.
+			logger.Infoln("clean server shutdown start")
+			return srv.Shutdown(ctx)
+		},
+	})
+	runner.add(&subsystem{
+		name: "state dump",
+		run: func(ctx context.Context) error {
+			s.handleStateDumpSignal(ctx)
+			return nil
+		},
+	})
+	runner.add(&subsystem{
+		name: "signals",
+		run: func(ctx context.Context) error {
+			return s.waitForShutdownSignal(ctx, signalCh)
+		},
+	})
+
+	logger.Infoln("ready to handle requests")
+
+	return runner.run(serveCtx)
+}
+
+// waitForShutdownSignal blocks until the provided context is done or a signal
+// is received on the provided channel. On signal the accociated Server is
+// drained for its drain delay before waitForShutdownSignal returns, unless
+// another signal is received.
+func (s *Server) waitForShutdownSignal(ctx context.Context, signalCh <-chan os.Signal) error {
+	logger := s.logger
+
+	select {
+	case reason := <-signalCh:
+		logger.WithField("signal", reason).Warnln("received signal")
+	case <-ctx.Done():
+		return nil
+	}
+
+	// Flip readiness, so load balancers take this instance out of rotation
+	// while requests are still handled.
+	atomic.StoreInt32(&s.draining, 1)
+	if s.drainDelay > 0 {
+		logger.WithField("delay", s.drainDelay).Infoln("draining before shutdown")
+		select {
+		case <-time.After(s.drainDelay):
+		case <-ctx.Done():
+		case reason := <-signalCh:
+			logger.WithField("signal", reason).Warnln("received signal, drain skipped")
+		}
+	}
+
+	return nil
+}
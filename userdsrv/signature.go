@@ -0,0 +1,136 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Headers of signed requests.
+const (
+	signatureTimestampHeader = "X-Kuserd-Timestamp"
+	signatureNonceHeader     = "X-Kuserd-Nonce"
+	signatureHeader          = "X-Kuserd-Signature"
+)
+
+// A nonceCache remembers nonces of signed requests until their timestamp
+// falls out of the accepted window, to reject replayed requests.
+type nonceCache struct {
+	mutex  sync.Mutex
+	nonces map[string]time.Time
+	purged time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{
+		nonces: make(map[string]time.Time),
+		purged: time.Now(),
+	}
+}
+
+// add records the provided nonce until the provided expiry. It returns false
+// if the nonce was already seen.
+func (nc *nonceCache) add(nonce string, expires time.Time) bool {
+	nc.mutex.Lock()
+	defer nc.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(nc.purged) > time.Minute {
+		for n, e := range nc.nonces {
+			if now.After(e) {
+				delete(nc.nonces, n)
+			}
+		}
+		nc.purged = now
+	}
+
+	if e, ok := nc.nonces[nonce]; ok && now.Before(e) {
+		return false
+	}
+	nc.nonces[nonce] = expires
+	return true
+}
+
+// requestSignature returns the hex encoded HMAC-SHA256 signature of a request
+// with the provided values using the provided secret.
+func requestSignature(secret []byte, timestamp, nonce, method, requestURI string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n" + method + "\n" + requestURI + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// withSignature wraps the provided handler, requiring requests to be signed
+// with the configured secret. The signature covers timestamp, nonce, method,
+// request URI and body of the request. Requests with a timestamp outside of
+// the allowed clock skew or with a nonce seen before are rejected.
+func (s *Server) withSignature(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if len(s.signingSecret) == 0 {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		timestamp := req.Header.Get(signatureTimestampHeader)
+		nonce := req.Header.Get(signatureNonceHeader)
+		signature := req.Header.Get(signatureHeader)
+		if timestamp == "" || nonce == "" || signature == "" {
+			s.problem(rw, req, http.StatusUnauthorized, "missing request signature")
+			return
+		}
+
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			s.problem(rw, req, http.StatusUnauthorized, "invalid request signature timestamp")
+			return
+		}
+		signed := time.Unix(seconds, 0)
+		if skew := time.Since(signed); skew > s.signingSkew || skew < -s.signingSkew {
+			s.problem(rw, req, http.StatusUnauthorized, "request signature timestamp out of window")
+			return
+		}
+
+		body, ok := s.readRequestBody(rw, req)
+		if !ok {
+			return
+		}
+
+		expected := requestSignature(s.signingSecret, timestamp, nonce, req.Method, req.URL.RequestURI(), body)
+		if !hmac.Equal([]byte(signature), []byte(expected)) {
+			s.logger.WithField("path", req.URL.Path).Warnln("request signature mismatch")
+			s.problem(rw, req, http.StatusUnauthorized, "invalid request signature")
+			return
+		}
+
+		// Nonces only need to be remembered for as long as the timestamp is
+		// accepted.
+		if !s.signingNonces.add(nonce, signed.Add(s.signingSkew)) {
+			s.logger.WithField("path", req.URL.Path).Warnln("replayed request rejected")
+			s.problem(rw, req, http.StatusUnauthorized, "replayed request")
+			return
+		}
+
+		next.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSignedRequest(secret []byte, timestamp time.Time, nonce, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/create-user?x=1", strings.NewReader(body))
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	req.Header.Set(signatureTimestampHeader, ts)
+	req.Header.Set(signatureNonceHeader, nonce)
+	req.Header.Set(signatureHeader, requestSignature(secret, ts, nonce, req.Method, req.URL.RequestURI(), []byte(body)))
+
+	return req
+}
+
+func TestSignature(t *testing.T) {
+	secret := []byte("secret")
+	s := &Server{
+		logger:        newTestLogger(),
+		signingSecret: secret,
+		signingSkew:   5 * time.Minute,
+		signingNonces: newNonceCache(),
+	}
+	handler := s.withSignature(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	now := time.Now()
+	tampered := newTestSignedRequest(secret, now, "nonce3", "body")
+	tampered.Body = ioutil.NopCloser(strings.NewReader("other"))
+	missing := newTestSignedRequest(secret, now, "nonce4", "body")
+	missing.Header.Del(signatureHeader)
+
+	for _, tc := range []struct {
+		name   string
+		req    *http.Request
+		status int
+	}{
+		{"valid", newTestSignedRequest(secret, now, "nonce1", "body"), http.StatusOK},
+		{"replayed nonce", newTestSignedRequest(secret, now, "nonce1", "body"), http.StatusUnauthorized},
+		{"other nonce", newTestSignedRequest(secret, now, "nonce2", "body"), http.StatusOK},
+		{"too old", newTestSignedRequest(secret, now.Add(-6*time.Minute), "nonce5", "body"), http.StatusUnauthorized},
+		{"too new", newTestSignedRequest(secret, now.Add(6*time.Minute), "nonce6", "body"), http.StatusUnauthorized},
+		{"wrong secret", newTestSignedRequest([]byte("other"), now, "nonce7", "body"), http.StatusUnauthorized},
+		{"tampered body", tampered, http.StatusUnauthorized},
+		{"missing signature", missing, http.StatusUnauthorized},
+	} {
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, tc.req)
+
+		if rw.Code != tc.status {
+			t.Errorf("%s: status mismatch: got %d want %d: %s", tc.name, rw.Code, tc.status, rw.Body.String())
+		}
+	}
+}
+
+func TestSignatureRejectedNonceNotRemembered(t *testing.T) {
+	secret := []byte("secret")
+	s := &Server{
+		logger:        newTestLogger(),
+		signingSecret: secret,
+		signingSkew:   5 * time.Minute,
+		signingNonces: newNonceCache(),
+	}
+	handler := s.withSignature(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	// A request with a bad signature must not burn the nonce of the client.
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, newTestSignedRequest([]byte("other"), time.Now(), "nonce", "body"))
+	if rw.Code != http.StatusUnauthorized {
+		t.Errorf("status of bad signature mismatch: got %d want %d", rw.Code, http.StatusUnauthorized)
+	}
+
+	rw = httptest.NewRecorder()
+	handler.ServeHTTP(rw, newTestSignedRequest(secret, time.Now(), "nonce", "body"))
+	if rw.Code != http.StatusOK {
+		t.Errorf("status of valid request mismatch: got %d want %d", rw.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// spaIndex is the entry point of the single-page app, served for all paths
+// which do not exist to support routing with the history API.
+const spaIndex = "/index.html"
+
+// EmbeddedSPAAssets holds the assets of the single-page app compiled into the
+// binary. It is nil unless set by a generated source file, for example created
+// with vfsgen.
+var EmbeddedSPAAssets http.FileSystem
+
+// spaHandler returns a handler serving the single-page app from the provided
+// file system. Requests for paths without file extension which do not exist
+// are answered with the index, all other unknown paths with status 404. The
+// index is always revalidated by clients, other assets may be cached for the
+// provided max age.
+func (s *Server) spaHandler(assets http.FileSystem, maxAge time.Duration) http.Handler {
+	assetsCacheControl := "public, max-age=" + strconv.FormatInt(int64(maxAge.Seconds()), 10)
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			rw.Header().Set("Allow", "GET, HEAD")
+			s.problem(rw, req, http.StatusMethodNotAllowed, "")
+			return
+		}
+
+		name := path.Clean("/" + req.URL.Path)
+		if name == "/api" || strings.HasPrefix(name, "/api/") {
+			// Never answer unknown API endpoints with the app.
+			s.problem(rw, req, http.StatusNotFound, "")
+			return
+		}
+
+		cacheControl := assetsCacheControl
+		if name == "/" || name == spaIndex {
+			name = spaIndex
+			cacheControl = "no-cache"
+		}
+
+		f, err := assets.Open(name)
+		if err == nil {
+			if fi, statErr := f.Stat(); statErr != nil || fi.IsDir() {
+				f.Close()
+				err = os.ErrNotExist
+			}
+		}
+		if err != nil {
+			if !os.IsNotExist(err) {
+				s.logger.WithError(err).WithField("path", name).Errorln("spa request failed to open asset")
+				s.problem(rw, req, http.StatusInternalServerError, "")
+				return
+			}
+			if name == spaIndex || path.Ext(name) != "" {
+				s.problem(rw, req, http.StatusNotFound, "")
+				return
+			}
+			// History API fallback.
+			name = spaIndex
+			cacheControl = "no-cache"
+			if f, err = assets.Open(name); err != nil {
+				s.problem(rw, req, http.StatusNotFound, "")
+				return
+			}
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil {
+			s.problem(rw, req, http.StatusInternalServerError, "")
+			return
+		}
+
+		rw.Header().Set("Cache-Control", cacheControl)
+		rw.Header().Set("X-Content-Type-Options", "nosniff")
+		http.ServeContent(rw, req, fi.Name(), fi.ModTime(), f)
+	})
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// A StateDump is a snapshot of the internal state of a Server for incident
+// forensics.
+type StateDump struct {
+	Time        time.Time `json:"time"`
+	Version     string    `json:"version"`
+	Maintenance bool      `json:"maintenance"`
+	Draining    bool      `json:"draining"`
+	Degraded    bool      `json:"degraded"`
+	Goroutines  int       `json:"goroutines"`
+
+	Session *StateDumpSession `json:"session,omitempty"`
+	Backend *StateDumpBackend `json:"backend"`
+
+	// Pools are the connection pools of the SOAP socket client by path.
+	Pools map[string]*StateDumpPool `json:"pools,omitempty"`
+	// Caches are the number of entries of the enabled caches by name.
+	Caches map[string]int `json:"caches"`
+	// Tasks are the statistics of the periodic tasks.
+	Tasks []TaskStats `json:"tasks,omitempty"`
+}
+
+// A StateDumpSession describes the server session of a StateDump.
+type StateDumpSession struct {
+	Active bool              `json:"active"`
+	Events map[string]uint64 `json:"events"`
+}
+
+// A StateDumpBackend describes the requests to the Kopano server of a
+// StateDump.
+type StateDumpBackend struct {
+	InFlight       int64  `json:"inFlight"`
+	Waiting        int64  `json:"waiting"`
+	Requests       uint64 `json:"requests"`
+	Canceled       uint64 `json:"canceled"`
+	CircuitBreaker string `json:"circuitBreaker,omitempty"`
+}
+
+// A StateDumpPool describes a connection pool of a StateDump.
+type StateDumpPool struct {
+	Open    int `json:"open"`
+	Idle    int `json:"idle"`
+	Waiting int `json:"waiting"`
+	Max     int `json:"max"`
+}
+
+// DumpState returns a snapshot of the internal state of the accociated
+// Server. It contains no credentials or session IDs.
+func (s *Server) DumpState() *StateDump {
+	stats := kcc.Stats()
+	dump := &StateDump{
+		Time:        time.Now(),
+		Version:     kcc.Version,
+		Maintenance: s.inMaintenance(),
+		Draining:    atomic.LoadInt32(&s.draining) != 0,
+		Degraded:    s.degraded(),
+		Goroutines:  runtime.NumGoroutine(),
+
+		Backend: &StateDumpBackend{
+			InFlight: stats.InFlight,
+			Waiting:  stats.Waiting,
+			Requests: stats.Requests,
+			Canceled: stats.Canceled,
+		},
+		Caches: make(map[string]int),
+		Tasks:  s.TaskStats(),
+	}
+
+	if atomic.LoadInt32(&s.withServerSession) == 1 {
+		session := s.getSession()
+		dump.Session = &StateDumpSession{
+			Active: session != nil && session.IsActive(),
+			Events: make(map[string]uint64),
+		}
+		for idx := range s.sessionEvents {
+			dump.Session.Events[kcc.SessionEventType(idx+1).String()] = atomic.LoadUint64(&s.sessionEvents[idx])
+		}
+	}
+
+	if breaker := s.c.CircuitBreaker(); breaker != nil {
+		dump.Backend.CircuitBreaker = string(breaker.State())
+	}
+
+	if pools := s.soapMetrics.Pools(); len(pools) > 0 {
+		dump.Pools = make(map[string]*StateDumpPool, len(pools))
+		for path, stats := range pools {
+			dump.Pools[path] = &StateDumpPool{
+				Open:    stats.Open,
+				Idle:    stats.Idle,
+				Waiting: stats.Waiting,
+				Max:     stats.Max,
+			}
+		}
+	}
+
+	if s.users != nil {
+		dump.Caches["users"] = s.users.Len()
+	}
+	if s.diskUsers != nil {
+		dump.Caches["diskUsers"] = s.diskUsers.Len()
+	}
+	if s.resolvedNames != nil {
+		dump.Caches["resolvedNames"] = s.resolvedNames.len()
+	}
+	if s.idempotency != nil {
+		dump.Caches["idempotency"] = s.idempotency.len()
+	}
+
+	return dump
+}
+
+// writeStateDump writes a StateDump of the accociated Server as JSON to the
+// state dump file, replacing the previous dump, or to the log if no file is
+// set. The provided trigger names what asked for the dump.
+func (s *Server) writeStateDump(trigger string) *StateDump {
+	dump := s.DumpState()
+	logger := s.logger.WithField("trigger", trigger)
+
+	if s.stateDumpPath == "" {
+		data, err := json.Marshal(dump)
+		if err != nil {
+			logger.WithError(err).Errorln("failed to encode state dump")
+			return dump
+		}
+		logger.WithField("state", string(data)).Infoln("state dump")
+		return dump
+	}
+
+	data, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		logger.WithError(err).Errorln("failed to encode state dump")
+		return dump
+	}
+	// NOTE(longsleep): Write to a temporary file first, so the dump file is
+	// never seen half written.
+	tmpPath := s.stateDumpPath + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, append(data, '\n'), 0600); err == nil {
+		err = os.Rename(tmpPath, s.stateDumpPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		logger.WithError(err).Errorln("failed to write state dump")
+		return dump
+	}
+	logger.WithField("path", s.stateDumpPath).Infoln("state dump written")
+
+	return dump
+}
+
+// handleStateDumpSignal writes a state dump whenever SIGQUIT is received,
+// until the provided context is done. It replaces the default handling of
+// SIGQUIT, which exits with a stack dump of all goroutines.
+func (s *Server) handleStateDumpSignal(ctx context.Context) {
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGQUIT)
+	defer signal.Stop(signalCh)
+
+	for {
+		select {
+		case <-signalCh:
+			s.writeStateDump("signal")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// stateHandler writes a state dump like SIGQUIT and responds with it.
+func (s *Server) stateHandler(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+	dump := s.writeStateDump("admin")
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(dump)
+	if err != nil {
+		s.logger.WithError(err).Errorln("stateHandler request failed writing response")
+	}
+}
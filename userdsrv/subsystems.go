@@ -0,0 +1,141 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// A subsystem is a background task of the Server, for example the HTTP
+// listener or the server session runner.
+type subsystem struct {
+	// name identifies the subsystem in logs.
+	name string
+	// run runs the subsystem until the provided context is done. The
+	// subsystems of a subsystemRunner are stopped as soon as one of them
+	// returns, and the first error returned is the result of the runner.
+	run func(ctx context.Context) error
+	// shutdown, if not nil, stops the subsystem gracefully. It is called
+	// before the context of run is canceled and should return once the
+	// provided context is done.
+	shutdown func(ctx context.Context) error
+}
+
+// A subsystemRunner runs subsystems concurrently and stops them in the
+// reverse order of their registration, so subsystems only depend on the ones
+// registered before them.
+type subsystemRunner struct {
+	logger logrus.FieldLogger
+
+	// shutdownTimeout limits the duration of the graceful shutdown of all
+	// subsystems together.
+	shutdownTimeout time.Duration
+	// abort, if not nil, ends waiting for subsystems to exit once it receives.
+	abort <-chan os.Signal
+
+	subsystems []*subsystem
+}
+
+// add registers the provided subsystem.
+func (r *subsystemRunner) add(s *subsystem) {
+	r.subsystems = append(r.subsystems, s)
+}
+
+type subsystemResult struct {
+	subsystem *subsystem
+	err       error
+}
+
+// run starts all registered subsystems and blocks until the provided context
+// is done or one of the subsystems returns. Then the subsystems are shut down
+// and their context is canceled, both in reverse order, and run waits for all
+// of them to exit. It returns the error of the subsystem which returned
+// first, if any.
+func (r *subsystemRunner) run(ctx context.Context) error {
+	// NOTE(longsleep): The context of the subsystems is not derived from the
+	// provided context, so they are stopped in order when it is done.
+	runCtx, runCtxCancel := context.WithCancel(context.Background())
+	defer runCtxCancel()
+
+	resultCh := make(chan *subsystemResult, len(r.subsystems))
+	cancels := make([]context.CancelFunc, len(r.subsystems))
+	exitChs := make([]chan struct{}, len(r.subsystems))
+	for idx, s := range r.subsystems {
+		subsystemCtx, subsystemCtxCancel := context.WithCancel(runCtx)
+		cancels[idx] = subsystemCtxCancel
+		exitChs[idx] = make(chan struct{})
+		go func(s *subsystem, exitCh chan struct{}) {
+			defer close(exitCh)
+			err := s.run(subsystemCtx)
+			resultCh <- &subsystemResult{s, err}
+		}(s, exitChs[idx])
+	}
+
+	// Wait for exit or error.
+	var err error
+	select {
+	case result := <-resultCh:
+		err = result.err
+		if err != nil {
+			r.logger.WithError(err).WithField("subsystem", result.subsystem.name).Errorln("subsystem failed")
+		} else {
+			r.logger.WithField("subsystem", result.subsystem.name).Debugln("subsystem stopped")
+		}
+	case <-ctx.Done():
+		// breaks
+	}
+
+	shutdownCtx, shutdownCtxCancel := context.WithTimeout(context.Background(), r.shutdownTimeout)
+	defer shutdownCtxCancel() // prevent leak.
+	for idx := len(r.subsystems) - 1; idx >= 0; idx-- {
+		s := r.subsystems[idx]
+		if s.shutdown != nil {
+			if shutdownErr := s.shutdown(shutdownCtx); shutdownErr != nil {
+				r.logger.WithError(shutdownErr).WithField("subsystem", s.name).Warnln("subsystem shutdown failed")
+			}
+		}
+		cancels[idx]()
+		if !r.wait(s, exitChs[idx]) {
+			break
+		}
+	}
+
+	return err
+}
+
+// wait blocks until the provided exit channel of the provided subsystem is
+// closed. It returns false if waiting was aborted.
+func (r *subsystemRunner) wait(s *subsystem, exitCh <-chan struct{}) bool {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-exitCh:
+			return true
+		case reason := <-r.abort:
+			r.logger.WithField("signal", reason).WithField("subsystem", s.name).Warnln("received signal, not waiting for subsystem to exit")
+			return false
+		case <-ticker.C:
+			r.logger.WithField("subsystem", s.name).Infoln("waiting for subsystem to exit")
+		}
+	}
+}
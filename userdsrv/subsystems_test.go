@@ -0,0 +1,195 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestSubsystemRunner() *subsystemRunner {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	return &subsystemRunner{
+		logger:          logger,
+		shutdownTimeout: time.Second,
+	}
+}
+
+// testSubsystems records the order in which subsystems are shut down and
+// exit.
+type testSubsystems struct {
+	mutex  sync.Mutex
+	events []string
+}
+
+func (ts *testSubsystems) record(event string) {
+	ts.mutex.Lock()
+	ts.events = append(ts.events, event)
+	ts.mutex.Unlock()
+}
+
+func (ts *testSubsystems) add(r *subsystemRunner, name string, err error) {
+	r.add(&subsystem{
+		name: name,
+		run: func(ctx context.Context) error {
+			if err == nil {
+				<-ctx.Done()
+			}
+			ts.record(name + " exit")
+			return err
+		},
+		shutdown: func(ctx context.Context) error {
+			ts.record(name + " shutdown")
+			return nil
+		},
+	})
+}
+
+func TestSubsystemRunnerContextDone(t *testing.T) {
+	r := newTestSubsystemRunner()
+	ts := &testSubsystems{}
+	ts.add(r, "session", nil)
+	ts.add(r, "http", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if err := r.run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"http shutdown", "http exit", "session shutdown", "session exit"}
+	if !reflect.DeepEqual(ts.events, expected) {
+		t.Errorf("unexpected shutdown order: %v", ts.events)
+	}
+}
+
+func TestSubsystemRunnerFailure(t *testing.T) {
+	r := newTestSubsystemRunner()
+	ts := &testSubsystems{}
+	failure := errors.New("listener failed")
+	ts.add(r, "session", nil)
+	ts.add(r, "http", failure)
+	ts.add(r, "signals", nil)
+
+	if err := r.run(context.Background()); err != failure {
+		t.Fatalf("expected failure, got: %v", err)
+	}
+
+	expected := []string{"http exit", "signals shutdown", "signals exit", "http shutdown", "session shutdown", "session exit"}
+	if !reflect.DeepEqual(ts.events, expected) {
+		t.Errorf("unexpected shutdown order: %v", ts.events)
+	}
+}
+
+func TestSubsystemRunnerReturn(t *testing.T) {
+	r := newTestSubsystemRunner()
+	ts := &testSubsystems{}
+	ts.add(r, "session", nil)
+	r.add(&subsystem{
+		name: "signals",
+		run: func(ctx context.Context) error {
+			return nil
+		},
+	})
+
+	if err := r.run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"session shutdown", "session exit"}
+	if !reflect.DeepEqual(ts.events, expected) {
+		t.Errorf("unexpected shutdown order: %v", ts.events)
+	}
+}
+
+func TestSubsystemRunnerShutdownTimeout(t *testing.T) {
+	r := newTestSubsystemRunner()
+	r.shutdownTimeout = 10 * time.Millisecond
+	r.add(&subsystem{
+		name: "http",
+		run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		},
+		shutdown: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- r.run(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("runner did not return after the shutdown timeout")
+	}
+}
+
+func TestSubsystemRunnerAbort(t *testing.T) {
+	r := newTestSubsystemRunner()
+	abortCh := make(chan os.Signal, 1)
+	r.abort = abortCh
+	stuck := make(chan struct{})
+	defer close(stuck)
+	r.add(&subsystem{
+		name: "session",
+		run: func(ctx context.Context) error {
+			<-stuck
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	abortCh <- syscall.SIGINT
+	done := make(chan error, 1)
+	go func() {
+		done <- r.run(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("runner did not return after abort")
+	}
+}
@@ -0,0 +1,273 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// Intervals of the built-in tasks of a Server.
+const (
+	userCachePurgeInterval = 5 * time.Minute
+	topUsersSaveInterval   = 15 * time.Minute
+)
+
+// A Task is a named periodic background job of a Server, run by RunTasks.
+type Task struct {
+	// Name identifies the task in logs and metrics.
+	Name string
+	// Interval is the time between the end of a run and the start of the
+	// next one. The first run starts one interval after RunTasks.
+	Interval time.Duration
+	// Jitter is the ratio the interval is varied randomly by, so tasks of
+	// multiple instances do not run in lockstep.
+	Jitter float64
+	// Timeout limits the duration of a run, if not 0.
+	Timeout time.Duration
+	// Run is the job. Panics are recovered and reported like errors.
+	Run func(ctx context.Context) error
+}
+
+// TaskStats holds the statistics of a Task.
+type TaskStats struct {
+	Name         string        `json:"name"`
+	Runs         uint64        `json:"runs"`
+	Failures     uint64        `json:"failures"`
+	LastDuration time.Duration `json:"lastDuration"`
+	LastSuccess  time.Time     `json:"lastSuccess,omitempty"`
+	LastError    string        `json:"lastError,omitempty"`
+}
+
+// A taskScheduler runs periodic tasks, every task in its own goroutine so a
+// slow task does not delay the others. Runs of the same task never overlap.
+type taskScheduler struct {
+	mutex   sync.Mutex
+	tasks   []*scheduledTask
+	running bool
+}
+
+type scheduledTask struct {
+	task  *Task
+	stats TaskStats
+}
+
+// add registers the provided task.
+func (ts *taskScheduler) add(task *Task) error {
+	switch {
+	case task.Name == "":
+		return errors.New("task name is empty")
+	case task.Interval <= 0:
+		return fmt.Errorf("task %s has no interval", task.Name)
+	case task.Run == nil:
+		return fmt.Errorf("task %s has no run function", task.Name)
+	}
+
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	if ts.running {
+		return fmt.Errorf("task %s added while tasks are running", task.Name)
+	}
+	for _, st := range ts.tasks {
+		if st.task.Name == task.Name {
+			return fmt.Errorf("task %s already exists", task.Name)
+		}
+	}
+	ts.tasks = append(ts.tasks, &scheduledTask{
+		task: task,
+		stats: TaskStats{
+			Name: task.Name,
+		},
+	})
+	return nil
+}
+
+// stats returns the statistics of all registered tasks, sorted by name.
+func (ts *taskScheduler) stats() []TaskStats {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	stats := make([]TaskStats, len(ts.tasks))
+	for idx, st := range ts.tasks {
+		stats[idx] = st.stats
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// run runs the registered tasks until the provided context is done and
+// waits for running tasks to return.
+func (ts *taskScheduler) run(ctx context.Context, onError func(name string, err error)) error {
+	ts.mutex.Lock()
+	if ts.running {
+		ts.mutex.Unlock()
+		return errors.New("tasks are running already")
+	}
+	ts.running = true
+	tasks := ts.tasks
+	ts.mutex.Unlock()
+
+	defer func() {
+		ts.mutex.Lock()
+		ts.running = false
+		ts.mutex.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	for _, st := range tasks {
+		wg.Add(1)
+		go func(st *scheduledTask) {
+			defer wg.Done()
+			ts.loop(ctx, st, onError)
+		}(st)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+func (ts *taskScheduler) loop(ctx context.Context, st *scheduledTask, onError func(name string, err error)) {
+	timer := time.NewTimer(taskDelay(st.task))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+
+		started := time.Now()
+		err := runTask(ctx, st.task)
+		duration := time.Since(started)
+
+		ts.mutex.Lock()
+		st.stats.Runs++
+		st.stats.LastDuration = duration
+		if err != nil {
+			st.stats.Failures++
+			st.stats.LastError = err.Error()
+		} else {
+			st.stats.LastSuccess = started
+			st.stats.LastError = ""
+		}
+		ts.mutex.Unlock()
+
+		if err != nil && ctx.Err() == nil && onError != nil {
+			onError(st.task.Name, err)
+		}
+
+		timer.Reset(taskDelay(st.task))
+	}
+}
+
+// runTask runs the provided task once with its timeout, returning a reported
+// kcc.PanicError if it panics.
+func runTask(ctx context.Context, task *Task) (err error) {
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, task.Timeout)
+		defer cancel()
+	}
+
+	defer func() {
+		if value := recover(); value != nil {
+			panicErr := kcc.NewPanicError(value)
+			kcc.ReportPanic(panicErr)
+			err = panicErr
+		}
+	}()
+
+	return task.Run(ctx)
+}
+
+// taskDelay returns the interval of the provided task varied by its jitter.
+func taskDelay(task *Task) time.Duration {
+	delay := task.Interval
+	if task.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * task.Jitter * float64(delay))
+	}
+	if delay <= 0 {
+		delay = task.Interval
+	}
+	return delay
+}
+
+// AddTask registers the provided periodic task with the accociated Server.
+// Tasks must be added before RunTasks or Serve is called, and their names
+// must be unique.
+func (s *Server) AddTask(task *Task) error {
+	return s.tasks.add(task)
+}
+
+// RunTasks runs the periodic tasks of the accociated Server, both the
+// built-in ones and the ones added with AddTask, until the provided context
+// is done. RunTasks blocks until running tasks have returned. Serve runs the
+// tasks itself.
+func (s *Server) RunTasks(ctx context.Context) error {
+	return s.tasks.run(ctx, func(name string, err error) {
+		s.logger.WithError(err).WithField("task", name).Warnln("task failed")
+	})
+}
+
+// TaskStats returns the statistics of the periodic tasks of the accociated
+// Server, sorted by name.
+func (s *Server) TaskStats() []TaskStats {
+	return s.tasks.stats()
+}
+
+// addBuiltinTasks registers the periodic tasks needed by the configured
+// features of the accociated Server.
+func (s *Server) addBuiltinTasks() {
+	if s.users == nil {
+		return
+	}
+
+	s.tasks.add(&Task{
+		Name:     "user-cache-purge",
+		Interval: userCachePurgeInterval,
+		Jitter:   0.1,
+		Run: func(ctx context.Context) error {
+			if purged := s.users.Purge(); purged > 0 {
+				s.logger.WithField("users", purged).Debugln("expired users purged from cache")
+			}
+			return nil
+		},
+	})
+	if s.preloadTopPath != "" {
+		// NOTE(longsleep): Top users are saved on shutdown too, saving them
+		// periodically keeps them when the process is killed.
+		s.tasks.add(&Task{
+			Name:     "top-users-save",
+			Interval: topUsersSaveInterval,
+			Jitter:   0.1,
+			Run: func(ctx context.Context) error {
+				return s.writeTopUsers()
+			},
+		})
+	}
+}
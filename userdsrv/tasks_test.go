@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+func TestTaskSchedulerAdd(t *testing.T) {
+	ts := &taskScheduler{}
+	run := func(ctx context.Context) error { return nil }
+
+	if err := ts.add(&Task{Name: "purge", Interval: time.Minute, Run: run}); err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range []*Task{
+		{Name: "purge", Interval: time.Minute, Run: run},
+		{Name: "", Interval: time.Minute, Run: run},
+		{Name: "no-interval", Run: run},
+		{Name: "no-run", Interval: time.Minute},
+	} {
+		if err := ts.add(task); err == nil {
+			t.Errorf("expected error adding task %q", task.Name)
+		}
+	}
+}
+
+func TestTaskSchedulerRun(t *testing.T) {
+	kcc.SetPanicHandler(func(*kcc.PanicError) {})
+	defer kcc.SetPanicHandler(nil)
+
+	ts := &taskScheduler{}
+	var runs, panics int32
+	ts.add(&Task{
+		Name:     "ok",
+		Interval: 5 * time.Millisecond,
+		Jitter:   0.5,
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		},
+	})
+	ts.add(&Task{
+		Name:     "panic",
+		Interval: 5 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&panics, 1)
+			panic("boom")
+		},
+	})
+	ts.add(&Task{
+		Name:     "timeout",
+		Interval: 5 * time.Millisecond,
+		Timeout:  time.Millisecond,
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	failed := make(chan string, 100)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := ts.run(ctx, func(name string, err error) {
+		failed <- name
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&runs) < 2 || atomic.LoadInt32(&panics) < 2 {
+		t.Errorf("tasks did not run periodically: %d runs, %d panics", runs, panics)
+	}
+	for _, stats := range ts.stats() {
+		switch stats.Name {
+		case "ok":
+			if stats.Failures != 0 || stats.LastSuccess.IsZero() {
+				t.Errorf("unexpected stats of ok task: %+v", stats)
+			}
+		case "panic":
+			if stats.Failures != stats.Runs || stats.LastError != "panic: boom" {
+				t.Errorf("unexpected stats of panic task: %+v", stats)
+			}
+		case "timeout":
+			if stats.Failures == 0 || stats.LastError != context.DeadlineExceeded.Error() {
+				t.Errorf("unexpected stats of timeout task: %+v", stats)
+			}
+		}
+	}
+	close(failed)
+	for name := range failed {
+		if name == "ok" {
+			t.Errorf("ok task reported as failed")
+		}
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// startSpan continues the trace propagated with the headers of the provided
+// request, if any, and starts a span for the request, returning a copy of the
+// provided context with the span. SOAP requests made with the returned
+// context become children of the span.
+func (s *Server) startSpan(ctx context.Context, req *http.Request) (context.Context, kcc.TraceSpan) {
+	ctx = s.tracer.Extract(ctx, req.Header)
+	ctx, span := s.tracer.StartSpan(ctx, "kuserd "+req.Method+" "+req.URL.Path)
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.path", req.URL.Path)
+
+	return ctx, span
+}
+
+// endSpan ends the provided span of a request with the status written to the
+// provided response writer. Server errors fail the span.
+func endSpan(span kcc.TraceSpan, rw interface{ Status() int }) {
+	status := rw.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	span.SetAttribute("http.response.status_code", strconv.Itoa(status))
+
+	var err error
+	if status >= http.StatusInternalServerError {
+		err = fmt.Errorf("%d %s", status, http.StatusText(status))
+	}
+	span.End(err)
+}
@@ -0,0 +1,253 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// A userAdminRequest is the JSON body of user admin requests. Fields which
+// are not set are not changed.
+type userAdminRequest struct {
+	Username    string  `json:"username"`
+	Password    string  `json:"password"`
+	FullName    *string `json:"fullName"`
+	MailAddress *string `json:"mailAddress"`
+	NonActive   *bool   `json:"nonActive"`
+}
+
+func (r *userAdminRequest) apply(user *kcc.User) {
+	if r.FullName != nil {
+		user.FullName = *r.FullName
+	}
+	if r.MailAddress != nil {
+		user.MailAddress = *r.MailAddress
+	}
+	if r.NonActive != nil {
+		user.IsNonActive = 0
+		user.ObjClass = kcc.ACTIVE_USER
+		if *r.NonActive {
+			user.IsNonActive = 1
+			user.ObjClass = kcc.NONACTIVE_USER
+		}
+	}
+}
+
+// Fields of the JSON body of user admin requests.
+var (
+	createUserFields = []*bodyField{
+		{name: "username", kind: jsonString, required: true},
+		{name: "password", kind: jsonString, required: true},
+		{name: "fullName", kind: jsonString},
+		{name: "mailAddress", kind: jsonString},
+		{name: "nonActive", kind: jsonBoolean},
+	}
+	updateUserFields = []*bodyField{
+		{name: "username", kind: jsonString, required: true},
+		{name: "password", kind: jsonString},
+		{name: "fullName", kind: jsonString},
+		{name: "mailAddress", kind: jsonString},
+		{name: "nonActive", kind: jsonBoolean},
+	}
+	setQuotaParams = []*queryParam{
+		{name: "username", required: true},
+	}
+	setQuotaFields = []*bodyField{
+		{name: "useDefaultQuota", kind: jsonBoolean},
+		{name: "isUserDefaultQuota", kind: jsonBoolean},
+		{name: "warnSize", kind: jsonInteger},
+		{name: "softSize", kind: jsonInteger},
+		{name: "hardSize", kind: jsonInteger},
+	}
+)
+
+// errAdminOutsideScope is returned when the company scope of an admin does not
+// contain the admin itself.
+var errAdminOutsideScope = errors.New("admin outside of company scope")
+
+// adminCompanyScope returns the company scope the admin logged on with the
+// provided session is restricted to. System administrators are not restricted
+// and get a nil scope. The scope is checked to contain the admin, as users are
+// created in the company of the admin creating them.
+func (s *Server) adminCompanyScope(ctx context.Context, sessionID kcc.KCSessionID) (*kcc.CompanyScope, error) {
+	// NOTE(longsleep): getUser without user returns the session's own user.
+	response, err := s.c.GetUser(ctx, "", sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if response.Er != kcc.KCSuccess {
+		return nil, response.Er
+	}
+	if response.User == nil {
+		return nil, fmt.Errorf("admin company scope getUser returned no user")
+	}
+	if kcc.AdminLevel(response.User.IsAdmin) >= kcc.ADMIN_LEVEL_SYSADMIN {
+		return nil, nil
+	}
+
+	scope, err := kcc.NewCompanyScope(ctx, s.c, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	contained, err := scope.Contains(ctx, response.User.ID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if !contained {
+		return nil, errAdminOutsideScope
+	}
+
+	return scope, nil
+}
+
+// adminUser fetches the user with the provided username, failing with
+// KCERR_NOT_FOUND for users outside of the provided scope.
+func (s *Server) adminUser(ctx context.Context, scope *kcc.CompanyScope, username string, sessionID kcc.KCSessionID) (*kcc.User, error) {
+	var results []*kcc.UserResult
+	var err error
+	if scope != nil {
+		results, err = scope.GetUsersByName(ctx, []string{username}, sessionID)
+	} else {
+		results, err = s.c.GetUsersByName(ctx, []string{username}, sessionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if results[0].Err != nil {
+		return nil, results[0].Err
+	}
+
+	return results[0].User, nil
+}
+
+func (s *Server) writeUserAdminError(rw http.ResponseWriter, req *http.Request, handler string, err error) {
+	if er, ok := err.(kcc.KCError); ok {
+		s.writeAdminResponse(rw, req, er, nil)
+		return
+	}
+	if err == errAdminOutsideScope {
+		s.logger.WithField("path", req.URL.Path).Warnf("%s request by admin outside of company scope", handler)
+		s.problem(rw, req, http.StatusForbidden, "admin outside of company")
+		return
+	}
+	s.logger.WithError(err).Errorf("%s request failed", handler)
+	s.problem(rw, req, http.StatusInternalServerError, "")
+}
+
+func (s *Server) createUserHandler(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+	var request userAdminRequest
+	if !s.validateRequest(rw, req, nil, createUserFields, &request) {
+		return
+	}
+
+	scope, err := s.adminCompanyScope(req.Context(), sessionID)
+	if err != nil {
+		s.writeUserAdminError(rw, req, "createUserHandler", err)
+		return
+	}
+
+	user := &kcc.User{
+		Username: request.Username,
+	}
+	request.apply(user)
+
+	// NOTE(longsleep): Kopano server creates users in the company of the
+	// admin creating them, which was checked to be the company of the scope.
+	// The result is checked anyways, to never leave a user in another company
+	// behind.
+	response, err := s.c.CreateUser(req.Context(), user, request.Password, sessionID)
+	if err != nil {
+		s.writeUserAdminError(rw, req, "createUserHandler", err)
+		return
+	}
+	if response.Er == kcc.KCSuccess && scope != nil {
+		contained, containsErr := scope.Contains(req.Context(), response.ID, sessionID)
+		if containsErr != nil || !contained {
+			s.logger.WithError(containsErr).WithField("username", request.Username).Errorln("createUserHandler created user outside of company")
+			if _, deleteErr := s.c.DeleteUser(context.Background(), response.UserEntryID, sessionID); deleteErr != nil {
+				s.logger.WithError(deleteErr).Errorln("createUserHandler request deleteUser failed")
+			}
+			s.problem(rw, req, http.StatusForbidden, "user outside of company")
+			return
+		}
+	}
+
+	userID := response.ID
+	s.writeAdminResponse(rw, req, response.Er, &adminResponse{
+		UserID:      &userID,
+		UserEntryID: response.UserEntryID,
+	})
+}
+
+func (s *Server) updateUserHandler(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+	var request userAdminRequest
+	if !s.validateRequest(rw, req, nil, updateUserFields, &request) {
+		return
+	}
+
+	scope, err := s.adminCompanyScope(req.Context(), sessionID)
+	if err != nil {
+		s.writeUserAdminError(rw, req, "updateUserHandler", err)
+		return
+	}
+	user, err := s.adminUser(req.Context(), scope, request.Username, sessionID)
+	if err != nil {
+		s.writeUserAdminError(rw, req, "updateUserHandler", err)
+		return
+	}
+	request.apply(user)
+
+	response, err := s.c.SetUser(req.Context(), user, request.Password, sessionID)
+	if err != nil {
+		s.writeUserAdminError(rw, req, "updateUserHandler", err)
+		return
+	}
+
+	s.writeAdminResponse(rw, req, response.Er, &adminResponse{})
+}
+
+func (s *Server) setQuotaHandler(rw http.ResponseWriter, req *http.Request, sessionID kcc.KCSessionID) {
+	var quota kcc.Quota
+	if !s.validateRequest(rw, req, setQuotaParams, setQuotaFields, &quota) {
+		return
+	}
+	username := req.URL.Query().Get("username")
+
+	scope, err := s.adminCompanyScope(req.Context(), sessionID)
+	if err != nil {
+		s.writeUserAdminError(rw, req, "setQuotaHandler", err)
+		return
+	}
+	user, err := s.adminUser(req.Context(), scope, username, sessionID)
+	if err != nil {
+		s.writeUserAdminError(rw, req, "setQuotaHandler", err)
+		return
+	}
+
+	response, err := s.c.SetQuota(req.Context(), user.UserEntryID, &quota, sessionID)
+	if err != nil {
+		s.writeUserAdminError(rw, req, "setQuotaHandler", err)
+		return
+	}
+
+	s.writeAdminResponse(rw, req, response.Er, &adminResponse{})
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2017-2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+const (
+	testSOAPHeader = `<?xml version="1.0" encoding="UTF-8"?><SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ns="urn:zarafa"><SOAP-ENV:Body>`
+	testSOAPFooter = `</SOAP-ENV:Body></SOAP-ENV:Envelope>`
+
+	testLogonResponse  = `<ns:logonResponse><er>0</er><ulSessionId>7</ulSessionId></ns:logonResponse>`
+	testLogoffResponse = `<ns:logoffResponse><er>0</er></ns:logoffResponse>`
+)
+
+// A testSOAPServer answers SOAP requests with the response set for their
+// action and records the actions.
+type testSOAPServer struct {
+	*httptest.Server
+
+	mutex     sync.Mutex
+	responses map[string]string
+	actions   []string
+}
+
+func newTestSOAPServer(responses map[string]string) *testSOAPServer {
+	ts := &testSOAPServer{
+		responses: responses,
+	}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		payload := string(body)
+		if start := strings.Index(payload, "<SOAP-ENV:Body"); start >= 0 {
+			payload = payload[start:]
+			payload = payload[strings.Index(payload, ">")+1:]
+		}
+		action := kcc.SOAPAction(payload)
+		ts.mutex.Lock()
+		ts.actions = append(ts.actions, action)
+		response := ts.responses[action]
+		ts.mutex.Unlock()
+
+		rw.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		rw.Write([]byte(testSOAPHeader + response + testSOAPFooter))
+	}))
+
+	return ts
+}
+
+// count returns how often the provided action was requested.
+func (ts *testSOAPServer) count(action string) int {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	n := 0
+	for _, a := range ts.actions {
+		if a == action {
+			n++
+		}
+	}
+	return n
+}
+
+// newTestLogger returns a logger which discards all output.
+func newTestLogger() logrus.FieldLogger {
+	logger := logrus.New()
+	logger.Out = ioutil.Discard
+
+	return logger
+}
+
+// newTestServer creates a Server with the provided config talking to the
+// provided SOAP server and returns its handler.
+func newTestServer(t *testing.T, ts *testSOAPServer, config *Config) (*Server, http.Handler) {
+	uri, _ := url.Parse(ts.URL)
+	s, err := NewServer("", uri, newTestLogger(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, s.Handler(context.Background())
+}
+
+// testUserListResponse returns a getUserList response with users of the
+// provided IDs.
+func testUserListResponse(ids ...string) string {
+	var b strings.Builder
+	b.WriteString("<ns:getUserListResponse><er>0</er><sUserArray>")
+	for _, id := range ids {
+		b.WriteString("<item><ulUserId>" + id + "</ulUserId><lpszUsername>user" + id + "</lpszUsername></item>")
+	}
+	b.WriteString("</sUserArray></ns:getUserListResponse>")
+	return b.String()
+}
+
+func TestCreateUserCompanyScope(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		members []string
+		status  int
+		created int
+	}{
+		{"in scope", []string{"5", "6"}, http.StatusOK, 1},
+		{"out of scope", []string{"3", "4"}, http.StatusForbidden, 0},
+	} {
+		ts := newTestSOAPServer(map[string]string{
+			"logon":       testLogonResponse,
+			"logoff":      testLogoffResponse,
+			"getUser":     `<ns:getUserResponse><er>0</er><lpsUser><ulUserId>5</ulUserId><lpszUsername>admin</lpszUsername><ulIsAdmin>1</ulIsAdmin></lpsUser></ns:getUserResponse>`,
+			"getCompany":  `<ns:getCompanyResponse><er>0</er><lpsCompany><ulCompanyId>2</ulCompanyId><lpszCompanyname>company1</lpszCompanyname><sCompanyId>AAAA02</sCompanyId></lpsCompany></ns:getCompanyResponse>`,
+			"getUserList": testUserListResponse(tc.members...),
+			"createUser":  `<ns:createUserResponse><er>0</er><ulUserId>6</ulUserId><sUserId>AAAA06</sUserId></ns:createUserResponse>`,
+		})
+		_, handler := newTestServer(t, ts, &Config{AdminAPI: true})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/create-user", strings.NewReader(`{"username":"user6","password":"secret"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth("admin", "pass")
+		rw := httptest.NewRecorder()
+		handler.ServeHTTP(rw, req)
+
+		if rw.Code != tc.status {
+			t.Errorf("%s: unexpected status: got %d want %d: %s", tc.name, rw.Code, tc.status, rw.Body.String())
+		}
+		if created := ts.count("createUser"); created != tc.created {
+			t.Errorf("%s: unexpected number of created users: got %d want %d", tc.name, created, tc.created)
+		}
+		if deleted := ts.count("deleteUser"); deleted != 0 {
+			t.Errorf("%s: unexpected deleteUser requests: %d", tc.name, deleted)
+		}
+		ts.Close()
+	}
+}
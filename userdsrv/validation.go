@@ -0,0 +1,292 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxRequestBodySize is the maximum size of JSON request bodies.
+const maxRequestBodySize = 64 * 1024
+
+// readRequestBody reads the body of the provided request, limited to
+// maxRequestBodySize, and restores it so it can be read again. If the body
+// cannot be read, the request is answered and false is returned.
+func (s *Server) readRequestBody(rw http.ResponseWriter, req *http.Request) ([]byte, bool) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(rw, req.Body, maxRequestBodySize))
+	if err != nil {
+		if len(body) >= maxRequestBodySize {
+			s.problem(rw, req, http.StatusRequestEntityTooLarge, "")
+		} else {
+			s.problem(rw, req, http.StatusBadRequest, "")
+		}
+		return nil, false
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return body, true
+}
+
+// Locations of request fields.
+const (
+	fieldInQuery = "query"
+	fieldInBody  = "body"
+)
+
+// A fieldError describes a field of a request which failed validation. The
+// message is translated and formatted with args when the error is written.
+type fieldError struct {
+	Field   string `json:"field,omitempty"`
+	In      string `json:"in"`
+	Message string `json:"message"`
+
+	args []interface{}
+}
+
+// A valueFormat checks the format of the values of a request field.
+type valueFormat struct {
+	message string
+	valid   func(string) bool
+}
+
+// Formats of request fields.
+var (
+	formatUint = &valueFormat{"must be an unsigned integer", func(value string) bool {
+		_, err := strconv.ParseUint(value, 10, 64)
+		return err == nil
+	}}
+	formatUint32 = &valueFormat{"must be an unsigned 32-bit integer", func(value string) bool {
+		_, err := strconv.ParseUint(value, 10, 32)
+		return err == nil
+	}}
+	formatBool = &valueFormat{"must be true or false", func(value string) bool {
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	}}
+	formatErrorCode = &valueFormat{"must be a decimal or 0x prefixed hexadecimal error code", func(value string) bool {
+		_, err := parseErrorCode(value)
+		return err == nil
+	}}
+	formatPropTag = &valueFormat{"must be a 32-bit property tag", func(value string) bool {
+		_, err := strconv.ParseUint(value, 0, 32)
+		return err == nil
+	}}
+	formatEntryID = &valueFormat{"must be a base64 encoded entry ID", func(value string) bool {
+		decoded, err := base64.StdEncoding.DecodeString(parseEntryID(value))
+		return err == nil && len(decoded) > 0
+	}}
+)
+
+// parseEntryID returns the provided entry ID query value with + restored.
+// NOTE(longsleep): Entry IDs are base64 encoded, so restore + which was not
+// properly escaped in the query.
+func parseEntryID(value string) string {
+	return strings.Replace(value, " ", "+", -1)
+}
+
+// A queryParam declares a query parameter of an endpoint. Values of list
+// params are comma separated, each of them is validated. Values of enum params
+// are compared case insensitive. Query parameters which are not declared are
+// ignored.
+type queryParam struct {
+	name     string
+	required bool
+	multiple bool
+	list     bool
+	format   *valueFormat
+	enum     []string
+}
+
+// JSON types of request body fields.
+const (
+	jsonString  = "string"
+	jsonBoolean = "boolean"
+	jsonInteger = "integer"
+)
+
+// A bodyField declares a member of the JSON object request body of an
+// endpoint. Required string members must not be empty. Members which are not
+// declared are rejected.
+type bodyField struct {
+	name     string
+	kind     string
+	required bool
+}
+
+// validateQuery validates the provided query values against the provided
+// params, in order.
+func validateQuery(query url.Values, params []*queryParam) []*fieldError {
+	var errs []*fieldError
+	for _, param := range params {
+		fail := func(message string, args ...interface{}) {
+			errs = append(errs, &fieldError{Field: param.name, In: fieldInQuery, Message: message, args: args})
+		}
+
+		values := query[param.name]
+		if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+			if param.required {
+				fail("is required")
+			}
+			continue
+		}
+		if len(values) > 1 && !param.multiple {
+			fail("must not be repeated")
+			continue
+		}
+
+	check:
+		for _, value := range values {
+			items := []string{value}
+			if param.list {
+				items = strings.Split(value, ",")
+			}
+			for _, item := range items {
+				if param.list {
+					item = strings.TrimSpace(item)
+				}
+				switch {
+				case param.format != nil && !param.format.valid(item):
+					fail(param.format.message)
+					break check
+				case len(param.enum) > 0 && !containsString(param.enum, strings.ToLower(item)):
+					fail("unknown value %v, must be one of %v", item, strings.Join(param.enum, ", "))
+					break check
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateBody validates the provided JSON object members against the
+// provided fields, in order, followed by undeclared members sorted by name.
+func validateBody(members map[string]json.RawMessage, fields []*bodyField) []*fieldError {
+	var errs []*fieldError
+	declared := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		declared[field.name] = true
+		fail := func(message string) {
+			errs = append(errs, &fieldError{Field: field.name, In: fieldInBody, Message: message})
+		}
+
+		raw, ok := members[field.name]
+		if !ok || string(raw) == "null" {
+			if field.required {
+				fail("is required")
+			}
+			continue
+		}
+
+		switch field.kind {
+		case jsonString:
+			var value string
+			if json.Unmarshal(raw, &value) != nil {
+				fail("must be a string")
+			} else if value == "" && field.required {
+				fail("is required")
+			}
+		case jsonBoolean:
+			var value bool
+			if json.Unmarshal(raw, &value) != nil {
+				fail("must be a boolean")
+			}
+		case jsonInteger:
+			var value int64
+			if json.Unmarshal(raw, &value) != nil {
+				fail("must be an integer")
+			}
+		}
+	}
+
+	var unknown []string
+	for name := range members {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, &fieldError{Field: name, In: fieldInBody, Message: "unknown field"})
+	}
+
+	return errs
+}
+
+// validateRequest validates the query of the provided request against the
+// provided params. If fields are provided, the request body is validated
+// against them and decoded into v. Validation errors of query and body are
+// answered together with bad request and false is returned.
+func (s *Server) validateRequest(rw http.ResponseWriter, req *http.Request, params []*queryParam, fields []*bodyField, v interface{}) bool {
+	errs := validateQuery(req.URL.Query(), params)
+
+	var body []byte
+	if fields != nil {
+		var members map[string]json.RawMessage
+		var err error
+		body, err = ioutil.ReadAll(http.MaxBytesReader(rw, req.Body, maxRequestBodySize))
+		if err == nil {
+			err = json.Unmarshal(body, &members)
+		}
+		if err != nil || members == nil {
+			errs = append(errs, &fieldError{In: fieldInBody, Message: "must be a JSON object"})
+		} else {
+			errs = append(errs, validateBody(members, fields)...)
+		}
+	}
+
+	if len(errs) > 0 {
+		s.validationProblem(rw, req, errs)
+		return false
+	}
+
+	if fields != nil {
+		// NOTE(longsleep): Members were validated, so this only fails for
+		// values out of range of their Go type.
+		if err := json.Unmarshal(body, v); err != nil {
+			s.validationProblem(rw, req, []*fieldError{{In: fieldInBody, Message: "must be a JSON object"}})
+			return false
+		}
+	}
+
+	return true
+}
+
+// validationProblem responds to the provided request with bad request problem
+// details holding the provided field errors.
+func (s *Server) validationProblem(rw http.ResponseWriter, req *http.Request, errs []*fieldError) {
+	language := requestLanguage(req)
+	problem := newProblem(language, http.StatusBadRequest, "invalid request")
+	for _, err := range errs {
+		problem.Errors = append(problem.Errors, &fieldError{
+			Field:   err.Field,
+			In:      err.In,
+			Message: fmt.Sprintf(translate(language, err.Message), err.args...),
+		})
+	}
+
+	s.writeProblem(rw, language, http.StatusBadRequest, problem)
+}
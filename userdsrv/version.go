@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package userdsrv
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"stash.kopano.io/kgol/kcc-go"
+)
+
+// API versions and their path prefix.
+const (
+	apiVersion = "v1"
+	apiPrefix  = "/api/" + apiVersion
+)
+
+// Status values of API versions.
+const (
+	apiStatusCurrent    = "current"
+	apiStatusDeprecated = "deprecated"
+)
+
+type apiVersionInfo struct {
+	Version string `json:"version"`
+	Prefix  string `json:"prefix"`
+	Status  string `json:"status"`
+	Sunset  string `json:"sunset,omitempty"`
+}
+
+type apiVersionsResponse struct {
+	Current  string            `json:"current"`
+	Versions []*apiVersionInfo `json:"versions"`
+	Server   string            `json:"server"`
+}
+
+// withDeprecation wraps the provided handler of a legacy path, marking its
+// responses as deprecated in favor of the provided successor path.
+func (s *Server) withDeprecation(successor string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Deprecation", "true")
+		if !s.legacyAPISunset.IsZero() {
+			rw.Header().Set("Sunset", s.legacyAPISunset.UTC().Format(http.TimeFormat))
+		}
+		rw.Header().Add("Link", "<"+successor+">; rel=\"successor-version\"")
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// apiVersionsHandler lists the available API versions.
+func (s *Server) apiVersionsHandler(rw http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/api" && req.URL.Path != "/api/" {
+		s.problem(rw, req, http.StatusNotFound, "")
+		return
+	}
+
+	legacy := &apiVersionInfo{
+		Version: "v0",
+		Prefix:  "/",
+		Status:  apiStatusDeprecated,
+	}
+	if !s.legacyAPISunset.IsZero() {
+		legacy.Sunset = s.legacyAPISunset.UTC().Format(http.TimeFormat)
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(&apiVersionsResponse{
+		Current: apiVersion,
+		Versions: []*apiVersionInfo{
+			{
+				Version: apiVersion,
+				Prefix:  apiPrefix,
+				Status:  apiStatusCurrent,
+			},
+			legacy,
+		},
+		Server: kcc.Version,
+	})
+	if err != nil {
+		s.logger.WithError(err).Errorln("apiVersionsHandler request failed writing response")
+	}
+}
+
+// versionHandler returns the version and build details of the server.
+func (s *Server) versionHandler(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(rw)
+	enc.SetIndent("", "  ")
+	err := enc.Encode(kcc.BuildInfo())
+	if err != nil {
+		s.logger.WithError(err).Errorln("versionHandler request failed writing response")
+	}
+}
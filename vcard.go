@@ -0,0 +1,359 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Supported vCard versions.
+const (
+	VCardVersion3 = "3.0"
+	VCardVersion4 = "4.0"
+)
+
+var vcardTimeLayouts = []string{
+	"2006-01-02",
+	"20060102",
+	"2006-01-02T15:04:05Z",
+	"20060102T150405Z",
+}
+
+// VCard returns the vCard representation of the accociated Contact in the
+// provided vCard version. The Entry ID of the contact is used as UID.
+func (contact *Contact) VCard(version string) ([]byte, error) {
+	if version != VCardVersion3 && version != VCardVersion4 {
+		return nil, fmt.Errorf("unsupported vCard version: %v", version)
+	}
+
+	var b bytes.Buffer
+	writeContentLine(&b, "BEGIN", nil, "VCARD")
+	writeContentLine(&b, "VERSION", nil, version)
+	writeContentLine(&b, "PRODID", nil, "-//Kopano//kcc-go "+Version+"//EN")
+	if contact.EntryID != "" {
+		writeContentLine(&b, "UID", nil, escapeContentText(contact.EntryID))
+	}
+
+	displayName := contact.DisplayName
+	if displayName == "" {
+		displayName = strings.TrimSpace(strings.Join([]string{contact.GivenName, contact.Surname}, " "))
+	}
+	writeContentLine(&b, "FN", nil, escapeContentText(displayName))
+	writeContentLine(&b, "N", nil, vcardJoin(contact.Surname, contact.GivenName, contact.MiddleName, contact.Prefix, contact.Suffix))
+	if contact.Nickname != "" {
+		writeContentLine(&b, "NICKNAME", nil, escapeContentText(contact.Nickname))
+	}
+	if contact.Company != "" || contact.Department != "" {
+		writeContentLine(&b, "ORG", nil, vcardJoin(contact.Company, contact.Department))
+	}
+	if contact.Title != "" {
+		writeContentLine(&b, "TITLE", nil, escapeContentText(contact.Title))
+	}
+	for idx, email := range contact.Emails {
+		params := []string{"TYPE=internet"}
+		if idx == 0 {
+			if version == VCardVersion4 {
+				params = []string{"PREF=1"}
+			} else {
+				params = append(params, "TYPE=pref")
+			}
+		} else if version == VCardVersion4 {
+			params = nil
+		}
+		writeContentLine(&b, "EMAIL", params, escapeContentText(email.Address))
+	}
+	for _, tel := range []struct {
+		value string
+		types string
+	}{
+		{contact.BusinessPhone, "work,voice"},
+		{contact.HomePhone, "home,voice"},
+		{contact.MobilePhone, "cell,voice"},
+		{contact.BusinessFax, "work,fax"},
+	} {
+		if tel.value != "" {
+			writeContentLine(&b, "TEL", []string{"TYPE=" + tel.types}, escapeContentText(tel.value))
+		}
+	}
+	for _, adr := range []struct {
+		address *PostalAddress
+		types   string
+	}{
+		{contact.HomeAddress, "home"},
+		{contact.BusinessAddress, "work"},
+	} {
+		if !adr.address.IsEmpty() {
+			a := adr.address
+			writeContentLine(&b, "ADR", []string{"TYPE=" + adr.types}, vcardJoin("", "", a.Street, a.City, a.State, a.PostalCode, a.Country))
+		}
+	}
+	if !contact.Birthday.IsZero() {
+		layout := "2006-01-02"
+		if version == VCardVersion4 {
+			layout = "20060102"
+		}
+		writeContentLine(&b, "BDAY", nil, contact.Birthday.UTC().Format(layout))
+	}
+	if contact.HomePage != "" {
+		writeContentLine(&b, "URL", nil, contact.HomePage)
+	}
+	if contact.Notes != "" {
+		writeContentLine(&b, "NOTE", nil, escapeContentText(contact.Notes))
+	}
+	if !contact.LastModified.IsZero() {
+		writeContentLine(&b, "REV", nil, contact.LastModified.UTC().Format("20060102T150405Z"))
+	}
+	writeContentLine(&b, "END", nil, "VCARD")
+
+	return b.Bytes(), nil
+}
+
+// NewContactFromVCard parses the provided vCard 3.0 or 4.0 data into a new
+// Contact. Properties which have no Contact representation are ignored. The
+// UID of the vCard is not used.
+func NewContactFromVCard(data []byte) (*Contact, error) {
+	contact := &Contact{}
+
+	var inCard bool
+	var telUntyped []string
+	for _, line := range vcardUnfold(data) {
+		if line == "" {
+			continue
+		}
+		name, params, value, err := parseVCardLine(line)
+		if err != nil {
+			return nil, err
+		}
+
+		if !inCard {
+			if name == "BEGIN" && strings.EqualFold(value, "VCARD") {
+				inCard = true
+				continue
+			}
+			return nil, fmt.Errorf("vCard data does not start with BEGIN:VCARD")
+		}
+
+		types := params["TYPE"]
+		switch name {
+		case "END":
+			if contact.DisplayName == "" {
+				contact.DisplayName = strings.TrimSpace(strings.Join([]string{contact.GivenName, contact.Surname}, " "))
+			}
+			for _, tel := range telUntyped {
+				switch {
+				case contact.BusinessPhone == "":
+					contact.BusinessPhone = tel
+				case contact.HomePhone == "":
+					contact.HomePhone = tel
+				}
+			}
+			return contact, nil
+
+		case "VERSION":
+			if value != VCardVersion3 && value != VCardVersion4 {
+				return nil, fmt.Errorf("unsupported vCard version: %v", value)
+			}
+
+		case "FN":
+			contact.DisplayName = vcardUnescape(value)
+
+		case "N":
+			parts := vcardSplit(value, 5)
+			contact.Surname = parts[0]
+			contact.GivenName = parts[1]
+			contact.MiddleName = parts[2]
+			contact.Prefix = parts[3]
+			contact.Suffix = parts[4]
+
+		case "NICKNAME":
+			contact.Nickname = vcardUnescape(value)
+
+		case "ORG":
+			parts := vcardSplit(value, 2)
+			contact.Company = parts[0]
+			contact.Department = parts[1]
+
+		case "TITLE":
+			contact.Title = vcardUnescape(value)
+
+		case "EMAIL":
+			if len(contact.Emails) < MaxContactEmails {
+				contact.Emails = append(contact.Emails, &ContactEmail{
+					Address: vcardUnescape(value),
+				})
+			}
+
+		case "TEL":
+			tel := strings.TrimPrefix(vcardUnescape(value), "tel:")
+			switch {
+			case types["fax"]:
+				contact.BusinessFax = tel
+			case types["cell"]:
+				contact.MobilePhone = tel
+			case types["home"]:
+				contact.HomePhone = tel
+			case types["work"]:
+				contact.BusinessPhone = tel
+			default:
+				telUntyped = append(telUntyped, tel)
+			}
+
+		case "ADR":
+			parts := vcardSplit(value, 7)
+			address := &PostalAddress{
+				Street:     parts[2],
+				City:       parts[3],
+				State:      parts[4],
+				PostalCode: parts[5],
+				Country:    parts[6],
+			}
+			if types["home"] {
+				contact.HomeAddress = address
+			} else {
+				contact.BusinessAddress = address
+			}
+
+		case "BDAY":
+			for _, layout := range vcardTimeLayouts {
+				if t, err := time.Parse(layout, value); err == nil {
+					contact.Birthday = t
+					break
+				}
+			}
+
+		case "URL":
+			contact.HomePage = vcardUnescape(value)
+
+		case "NOTE":
+			contact.Notes = vcardUnescape(value)
+		}
+	}
+
+	return nil, fmt.Errorf("vCard data is missing END:VCARD")
+}
+
+// vcardUnfold splits the provided data into unfolded content lines.
+func vcardUnfold(data []byte) []string {
+	s := strings.Replace(string(data), "\r\n", "\n", -1)
+	s = strings.Replace(s, "\n ", "", -1)
+	s = strings.Replace(s, "\n\t", "", -1)
+
+	return strings.Split(s, "\n")
+}
+
+// parseVCardLine parses the provided unfolded content line into its upper case
+// name without group, its parameters and its raw value. Parameter values are
+// collected lower case as sets per upper case parameter name.
+func parseVCardLine(line string) (string, map[string]map[string]bool, string, error) {
+	sep := -1
+	quoted := false
+	for idx, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ':' && !quoted {
+			sep = idx
+			break
+		}
+	}
+	if sep < 0 {
+		return "", nil, "", fmt.Errorf("invalid vCard line: %v", line)
+	}
+
+	parts := strings.Split(line[:sep], ";")
+	name := strings.ToUpper(parts[0])
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+
+	params := make(map[string]map[string]bool)
+	for _, param := range parts[1:] {
+		key, values := "TYPE", param
+		if eq := strings.Index(param, "="); eq >= 0 {
+			key, values = strings.ToUpper(param[:eq]), param[eq+1:]
+		}
+		if params[key] == nil {
+			params[key] = make(map[string]bool)
+		}
+		for _, value := range strings.Split(strings.Trim(values, "\""), ",") {
+			params[key][strings.ToLower(value)] = true
+		}
+	}
+
+	return name, params, line[sep+1:], nil
+}
+
+func vcardUnescape(value string) string {
+	var b strings.Builder
+	escaped := false
+	for _, r := range value {
+		if escaped {
+			if r == 'n' || r == 'N' {
+				b.WriteRune('\n')
+			} else {
+				b.WriteRune(r)
+			}
+			escaped = false
+			continue
+		}
+		if r == '\\' {
+			escaped = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// vcardJoin escapes and joins the provided values as structured vCard value.
+func vcardJoin(values ...string) string {
+	escaped := make([]string, len(values))
+	for idx, value := range values {
+		escaped[idx] = escapeContentText(value)
+	}
+
+	return strings.Join(escaped, ";")
+}
+
+// vcardSplit splits the provided structured vCard value into exactly count
+// unescaped components.
+func vcardSplit(value string, count int) []string {
+	parts := make([]string, 0, count)
+	start := 0
+	escaped := false
+	for idx := 0; idx < len(value); idx++ {
+		switch {
+		case escaped:
+			escaped = false
+		case value[idx] == '\\':
+			escaped = true
+		case value[idx] == ';':
+			parts = append(parts, vcardUnescape(value[start:idx]))
+			start = idx + 1
+		}
+	}
+	parts = append(parts, vcardUnescape(value[start:]))
+
+	for len(parts) < count {
+		parts = append(parts, "")
+	}
+
+	return parts[:count]
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVCardRoundTrip(t *testing.T) {
+	contact := &Contact{
+		DisplayName: "Dr. Jane Doe",
+		GivenName:   "Jane",
+		Surname:     "Doe",
+		Prefix:      "Dr.",
+		Company:     "Example; Inc.",
+		Department:  "Research, Development",
+		Title:       "Chief Scientist",
+		Emails: []*ContactEmail{
+			{Address: "jane@example.com"},
+			{Address: "jane.doe@example.org"},
+		},
+		BusinessPhone: "+49 30 1234",
+		MobilePhone:   "+49 170 1234",
+		BusinessFax:   "+49 30 1235",
+		BusinessAddress: &PostalAddress{
+			Street:     "Main Street 1",
+			City:       "Berlin",
+			PostalCode: "10115",
+			Country:    "Germany",
+		},
+		Birthday: time.Date(1985, 4, 12, 0, 0, 0, 0, time.UTC),
+		HomePage: "https://example.com/~jane",
+		Notes:    "First line\nSecond line with a rather long text which must be folded to multiple lines, ÄÖÜ.",
+	}
+
+	for _, version := range []string{VCardVersion3, VCardVersion4} {
+		data, err := contact.VCard(version)
+		if err != nil {
+			t.Fatalf("version %s: %v", version, err)
+		}
+		for _, line := range strings.Split(string(data), "\r\n") {
+			if len(line) > contentLineLength {
+				t.Errorf("version %s: line exceeds length limit: %q", version, line)
+			}
+		}
+
+		parsed, err := NewContactFromVCard(data)
+		if err != nil {
+			t.Fatalf("version %s: %v", version, err)
+		}
+		if !reflect.DeepEqual(contact, parsed) {
+			t.Errorf("version %s: round trip mismatch\n%s", version, string(data))
+		}
+	}
+}
+
+func TestNewContactFromVCardGrouped(t *testing.T) {
+	data := "BEGIN:VCARD\r\nVERSION:3.0\r\nN:Doe;John;;;\r\nitem1.EMAIL;type=INTERNET;type=pref:john@example.com\r\nTEL;TYPE=HOME:123\r\nTEL:456\r\nEND:VCARD\r\n"
+
+	contact, err := NewContactFromVCard([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contact.DisplayName != "John Doe" {
+		t.Errorf("unexpected display name: %q", contact.DisplayName)
+	}
+	if len(contact.Emails) != 1 || contact.Emails[0].Address != "john@example.com" {
+		t.Errorf("unexpected emails: %v", contact.Emails)
+	}
+	if contact.HomePhone != "123" || contact.BusinessPhone != "456" {
+		t.Errorf("unexpected phones: %q %q", contact.HomePhone, contact.BusinessPhone)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// warmupPayload is sent by SOAPHTTPClient.Warmup to open connections. Logging
+// off the invalid session 0 has no effect on the server.
+const warmupPayload = "<ns:logoff><ulSessionId>0</ulSessionId></ns:logoff>"
+
+// Warmup opens up to n connections to the Kopano server of the accociated
+// client and returns them to its pool, so later requests do not wait for
+// them to be established. n is capped to the maximum number of connections
+// of the pool, excluding overflow connections. Idle connections are closed
+// again according to the pool settings. Returns the first error of opening a
+// connection, or the error of the provided context if it is done before all
+// connections were opened.
+func (sc *SOAPSocketClient) Warmup(ctx context.Context, n int) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if p, ok := sc.Pool.(*socketPool); ok && n > p.size {
+		n = p.size
+	}
+
+	err := warmup(ctx, n, func() (func(), error) {
+		c, err := sc.Pool.GetWithTimeout(sc.dialTimeout())
+		if err != nil {
+			return nil, err
+		}
+		// Close makes the connection available to the pool again.
+		return func() {
+			c.Close()
+		}, nil
+	})
+	if err != nil && err != ctx.Err() {
+		return fmt.Errorf("failed to warm up %s socket connections: %v", sc.network(), err)
+	}
+	return err
+}
+
+// Warmup opens up to n connections to the Kopano server of the accociated
+// client by sending n requests concurrently, which leave their connections
+// idle in the transport of the client. n is capped to MaxIdleConnsPerHost of
+// the transport, if it is a http.Transport. Requests are sent without the
+// Middleware and retries of the client. Returns the first error of sending a
+// request, or the error of the provided context if it is done before all
+// connections were opened.
+func (sc *SOAPHTTPClient) Warmup(ctx context.Context, n int) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	roundTripper := sc.Client.Transport
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+	if transport, ok := roundTripper.(*http.Transport); ok {
+		max := transport.MaxIdleConnsPerHost
+		if max == 0 {
+			max = http.DefaultMaxIdleConnsPerHost
+		}
+		if n > max {
+			n = max
+		}
+	}
+
+	err := warmup(ctx, n, func() (func(), error) {
+		payload := warmupPayload
+		req, err := http.NewRequest(http.MethodPost, sc.URI, soapEnvelope(&payload, soapHeaders(ctx, sc.Headers)))
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+		req.Header.Set("User-Agent", BuildInfo().UserAgent(soapUserAgent))
+		setHTTPHeaders(ctx, req)
+
+		resp, err := sc.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		// NOTE(longsleep): The connection becomes idle when the body was read
+		// completely, which happens when all connections are open, so the
+		// requests do not reuse each others connections.
+		return func() {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}, nil
+	})
+	if err != nil && err != ctx.Err() {
+		return fmt.Errorf("failed to warm up %s connections: %v", sc, err)
+	}
+	return err
+}
+
+// warmupInBackground warms up the provided client with n connections in the
+// background. Errors are ignored, connections are opened on demand then.
+func warmupInBackground(client interface {
+	Warmup(context.Context, int) error
+}, n int) {
+	go func() {
+		if err := client.Warmup(context.Background(), n); err != nil && debug {
+			fmt.Printf("SOAP client warmup failed: %v\n", err)
+		}
+	}()
+}
+
+// warmup calls the provided open function n times concurrently, and calls
+// all returned release functions when all are done. If the provided context
+// is done before, its error is returned and connections opened later are
+// released as they are done.
+func warmup(ctx context.Context, n int, open func() (func(), error)) error {
+	type opened struct {
+		release func()
+		err     error
+	}
+	results := make(chan opened, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			release, err := open()
+			results <- opened{release, err}
+		}()
+	}
+
+	var releases []func()
+	defer func() {
+		for _, release := range releases {
+			release()
+		}
+	}()
+
+	var err error
+	for i := 0; i < n; i++ {
+		select {
+		case r := <-results:
+			if r.release != nil {
+				releases = append(releases, r.release)
+			}
+			if r.err != nil && err == nil {
+				err = r.err
+			}
+		case <-ctx.Done():
+			go func(remaining int) {
+				for ; remaining > 0; remaining-- {
+					if r := <-results; r.release != nil {
+						r.release()
+					}
+				}
+			}(n - i)
+			return ctx.Err()
+		}
+	}
+
+	return err
+}
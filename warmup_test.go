@@ -0,0 +1,220 @@
+/*
+ * Copyright 2019 Kopano and its licensors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *	http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kcc
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingListener counts the connections accepted by a listener and keeps
+// them open until the listener is closed.
+type countingListener struct {
+	net.Listener
+
+	mutex sync.Mutex
+	conns []net.Conn
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mutex.Lock()
+		l.conns = append(l.conns, conn)
+		l.mutex.Unlock()
+	}
+	return conn, err
+}
+
+func (l *countingListener) Close() error {
+	l.mutex.Lock()
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+	l.mutex.Unlock()
+	return l.Listener.Close()
+}
+
+func (l *countingListener) count() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.conns)
+}
+
+func newCountingListener(t *testing.T) *countingListener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &countingListener{Listener: listener}
+}
+
+func TestSOAPSocketClientWarmup(t *testing.T) {
+	listener := newCountingListener(t)
+	defer listener.Close()
+	go func() {
+		for {
+			if _, err := listener.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+
+	uri, _ := url.Parse("tcp://" + listener.Addr().String())
+	poolConfig := NewSocketPoolConfig()
+	poolConfig.MaxConnections = 3
+	poolConfig.OverflowConnections = 2
+	client, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		SocketPool: poolConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := client.(*SOAPSocketClient)
+
+	// Capped to the pool size, excluding overflow.
+	if err = sc.Warmup(context.Background(), 5); err != nil {
+		t.Fatal(err)
+	}
+	pool := sc.Pool.(*socketPool)
+	pool.mutex.Lock()
+	open, idle := pool.open, len(pool.idle)
+	pool.mutex.Unlock()
+	if open != 3 || idle != 3 {
+		t.Errorf("expected 3 idle connections, got %d open and %d idle", open, idle)
+	}
+
+	// Open connections are counted.
+	if err = sc.Warmup(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := listener.count(); n != 3 {
+		t.Errorf("expected 3 accepted connections, got %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = sc.Warmup(ctx, 1); err != context.Canceled {
+		t.Errorf("expected context error, got %v", err)
+	}
+}
+
+func TestSOAPSocketClientWarmupConfig(t *testing.T) {
+	listener := newCountingListener(t)
+	defer listener.Close()
+	go func() {
+		for {
+			if _, err := listener.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+
+	uri, _ := url.Parse("tcp://" + listener.Addr().String())
+	_, err := NewSOAPClientWithConfig(uri, &SOAPClientConfig{
+		Warmup: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100 && listener.count() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := listener.count(); n != 2 {
+		t.Errorf("expected 2 connections opened in the background, got %d", n)
+	}
+}
+
+func TestSOAPSocketClientWarmupError(t *testing.T) {
+	listener := newCountingListener(t)
+	uri, _ := url.Parse("tcp://" + listener.Addr().String())
+	listener.Close()
+
+	client, err := NewSOAPSocketClient(uri, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.Warmup(context.Background(), 2)
+	if err == nil || !strings.Contains(err.Error(), "failed to warm up tcp socket connections") {
+		t.Errorf("expected warmup error, got %v", err)
+	}
+}
+
+func TestSOAPHTTPClientWarmup(t *testing.T) {
+	var mutex sync.Mutex
+	var payloads []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		payload, _ := ioutil.ReadAll(req.Body)
+		mutex.Lock()
+		payloads = append(payloads, string(payload))
+		mutex.Unlock()
+		rw.Write([]byte(soapHeader + "<ns:logoffResponse><er>2147483674</er></ns:logoffResponse>" + soapFooter))
+	}))
+	listener := newCountingListener(t)
+	srv.Listener = listener
+	srv.Start()
+	defer srv.Close()
+
+	uri, _ := url.Parse(srv.URL)
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: 3,
+	}
+	client, err := NewSOAPHTTPClient(uri, &http.Client{
+		Transport: transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.CloseIdleConnections()
+
+	// Capped to the idle connections of the transport.
+	if err = client.Warmup(context.Background(), 5); err != nil {
+		t.Fatal(err)
+	}
+	if n := listener.count(); n != 3 {
+		t.Errorf("expected 3 connections, got %d", n)
+	}
+	mutex.Lock()
+	if len(payloads) != 3 || !strings.Contains(payloads[0], warmupPayload) {
+		t.Errorf("unexpected warmup requests: %v", payloads)
+	}
+	mutex.Unlock()
+
+	// Requests use the warm connections.
+	c := NewKCCWithClient(client)
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Logoff(context.Background(), 1)
+		}()
+	}
+	wg.Wait()
+	if n := listener.count(); n != 3 {
+		t.Errorf("expected warm connections to be used, got %d connections", n)
+	}
+}